@@ -4,6 +4,7 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -21,6 +22,7 @@ import (
 	"github.com/smorting/backend/internal/database"
 	"github.com/smorting/backend/internal/handlers"
 	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/momosim"
 	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/migrations"
 	pkgDatabase "github.com/smorting/backend/pkg/database"
@@ -47,6 +49,10 @@ type App struct {
 	auditService        *services.AuditService
 	authHandler         *handlers.AuthHandler
 	enhancedAuthHandler *handlers.EnhancedAuthHandler
+	escrowService       *services.EscrowService
+	momoReconciler      *services.MomoReconciler
+	payoutService       *services.PayoutService
+	momoSimulator       *momosim.Simulator
 	server              *fiber.App
 }
 
@@ -300,6 +306,20 @@ func (a *App) initializeSecurityServices() error {
 		} else {
 			a.logger.Warn("Falling back to in-memory payment token store", zap.Error(err))
 		}
+		if store, err := services.NewMongoCardChargeStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			pciService.SetChargeStore(store)
+		} else {
+			a.logger.Warn("Falling back to in-memory card charge store", zap.Error(err))
+		}
+	}
+	switch {
+	case a.config.Card.FlutterwaveSecretKey != "":
+		pciService.SetGateway(services.NewFlutterwaveGateway(a.config.Card.FlutterwaveBaseURL, a.config.Card.FlutterwaveSecretKey, a.config.Card.FlutterwaveEncryptionKey), a.config.Card.ReturnURL)
+	case a.config.IsDevelopment():
+		pciService.SetGateway(services.NewFakeCardGateway(), fmt.Sprintf("http://localhost:%s/api/v1/payments/3ds/return", a.config.Server.Port))
+		a.logger.Warn("Using the in-process fake card gateway")
+	default:
+		a.logger.Warn("No card gateway configured; card payments are unavailable")
 	}
 	a.pciService = pciService
 
@@ -462,15 +482,101 @@ func (a *App) setupRoutes(app *fiber.App, authMiddleware *middleware.JWTAuthMidd
 	webhooks := api.Group("/webhooks")
 	ledgerSvc := services.NewWalletLedgerService(a.repository)
 	// Attach secure store for encrypted MongoDB Atlas system-of-record
-	if a.mongoDB != nil && a.mongoDB.GetDB() != nil && a.encryptionService != nil {
-		secure := services.NewWalletLedgerSecureStore(a.mongoDB.GetDB(), a.encryptionService, a.logger)
-		// expose via unexported field by assignment
-		// go doesn't allow direct assignment to unexported; we are in same package main, but struct in services package
-		// provide a small helper to set it
-		ledgerSvc = services.AttachSecureStore(ledgerSvc, secure)
-	}
-	walletWebhook := handlers.NewWalletWebhookHandlerWithLedger(a.logger, ledgerSvc)
+	if a.encryptionService != nil {
+		archive := services.NewMemorySecureLedgerRecordStore()
+		if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+			if store, err := services.NewMongoSecureLedgerRecordStore(a.mongoDB.GetDB(), a.logger); err == nil {
+				archive = store
+			} else {
+				a.logger.Warn("Falling back to in-memory ledger archive", zap.Error(err))
+			}
+		}
+		ledgerSvc = services.AttachSecureStore(ledgerSvc, services.NewWalletLedgerSecureStore(archive, a.encryptionService, a.logger))
+	}
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoWalletEntryStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			ledgerSvc = services.AttachEntryStore(ledgerSvc, store)
+		} else {
+			a.logger.Warn("Falling back to in-memory wallet entry store", zap.Error(err))
+		}
+	}
+	// Escrow links booking payments to their MoMo hold and settles them on booking status changes
+	var escrowStore services.EscrowStore = services.NewMemoryEscrowStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoEscrowStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			escrowStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory escrow store", zap.Error(err))
+		}
+	}
+	a.escrowService = services.NewEscrowService(escrowStore, a.repository, ledgerSvc, a.auditService, a.config.Escrow.DisputeWindow, a.config.Escrow.ReleaseInterval, a.logger.Logger)
+	// Commission and MoMo fees are deducted from each release as separate ledger lines
+	var feeScheduleStore services.FeeScheduleStore = services.NewMemoryFeeScheduleStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoFeeScheduleStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			feeScheduleStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory fee schedule store", zap.Error(err))
+		}
+	}
+	feeService := services.NewFeeService(feeScheduleStore, a.repository, a.config.Escrow.CommissionPercent, a.auditService, a.logger.Logger)
+	a.escrowService.SetFeeService(feeService)
+	// Bookings priced in one currency can be paid from the other at a locked, expiring rate
+	var fxStore services.FXStore = services.NewMemoryFXStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoFXStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			fxStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory fx store", zap.Error(err))
+		}
+	}
+	fxService := services.NewFXService(fxStore, a.repository, a.config.FX.QuoteTTL, a.config.FX.USDToLRD, a.auditService, a.logger.Logger)
+	a.escrowService.SetFXService(fxService)
+	// MoMo callbacks are authenticated (HMAC when a shared secret is configured, otherwise by
+	// re-querying MoMo), recorded in an inbox and applied once per reference/status
+	momoClient := services.NewMomoClient(a.config.Momo.BaseURL, a.config.Momo.TargetEnvironment, a.config.Momo.APIUser, a.config.Momo.APIKey, a.config.Momo.SubscriptionKeyCollection, a.config.Momo.SubscriptionKeyDisbursement)
+	if a.config.Momo.Simulator && a.config.IsDevelopment() {
+		// Local development without MTN sandbox credentials: the simulator calls back into this server
+		a.momoSimulator = momosim.New(momosim.Config{
+			CallbackURL:   fmt.Sprintf("http://localhost:%s/api/v1/webhooks/momo", a.config.Server.Port),
+			WebhookSecret: a.config.Momo.WebhookSecret,
+		})
+		momoClient = a.momoSimulator.Client()
+		a.logger.Warn("Using the in-process MoMo simulator", zap.String("url", a.momoSimulator.URL()))
+	}
+	// Wallet operations are routed to the provider the user picked; MoMo is the default
+	paymentProviders := services.NewPaymentProviders(services.NewMomoProvider(momoClient))
+	if a.config.Orange.BaseURL != "" {
+		paymentProviders.Register(services.NewOrangeMoneyClient(a.config.Orange.BaseURL, a.config.Orange.ClientID, a.config.Orange.ClientSecret,
+			a.config.Orange.APIUsername, a.config.Orange.APIPassword, a.config.Orange.ChannelMsisdn, a.config.Orange.NotifyURL))
+	}
+	var callbackVerifier services.MomoCallbackVerifier = services.NewStatusQueryVerifier(momoClient)
+	if a.config.Momo.WebhookSecret != "" {
+		callbackVerifier = services.NewHMACCallbackVerifier(a.config.Momo.WebhookSecret)
+	}
+	var webhookInbox services.WebhookInbox = services.NewMemoryWebhookInbox()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if inbox, err := services.NewMongoWebhookInbox(a.mongoDB.GetDB(), a.logger); err == nil {
+			webhookInbox = inbox
+		} else {
+			a.logger.Warn("Falling back to in-memory webhook inbox", zap.Error(err))
+		}
+	}
+	momoWebhooks := services.NewMomoWebhookService(webhookInbox, ledgerSvc, a.escrowService, callbackVerifier, a.logger.Logger)
+	walletWebhook := handlers.NewWalletWebhookHandlerWithProviders(a.logger, momoWebhooks, paymentProviders)
 	webhooks.Post("/momo", walletWebhook.MomoCallback)
+	webhooks.Post("/:provider", walletWebhook.ProviderCallback)
+
+	// Top-ups and withdrawals whose callback never arrives are settled by polling their provider
+	var reconcileReports services.ReconciliationReportStore = services.NewMemoryReconciliationStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoReconciliationStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			reconcileReports = store
+		} else {
+			a.logger.Warn("Falling back to in-memory reconciliation reports", zap.Error(err))
+		}
+	}
+	a.momoReconciler = services.NewMomoReconciler(paymentProviders, ledgerSvc.Entries(), momoWebhooks, reconcileReports, a.config.Reconcile.StaleAfter, a.config.Reconcile.Interval, a.logger.Logger)
 
 	// Auth routes (no authentication required)
 	auth := api.Group("/auth")
@@ -506,41 +612,151 @@ func (a *App) setupRoutes(app *fiber.App, authMiddleware *middleware.JWTAuthMidd
 	api.Get("/users/profile", authMiddleware.Authenticate(), a.getUserProfile)
 
 	// Services routes - PROTECTED with RBAC and audit logging
-	api.Get("/services", authMiddleware.Authenticate(), a.getServices)
+	categoryService := services.NewCategoryService(a.repository, a.logger.Logger)
+	seedCtx, cancelSeed := context.WithTimeout(context.Background(), 30*time.Second)
+	if created, err := categoryService.Seed(seedCtx, services.LaunchCategoryTaxonomy); err != nil {
+		a.logger.Warn("Failed to seed service categories", zap.Error(err))
+	} else if created > 0 {
+		a.logger.Info("Seeded service categories", zap.Int("created", created))
+	}
+	cancelSeed()
+	categoryHandler := handlers.NewCategoryHandler(categoryService, a.logger)
+	serviceHandler := handlers.NewServiceHandler(a.repository, a.logger)
+	serviceHandler.SetCategories(categoryService)
+	// Public search and categories, registered before /services/:id so they are not taken for an ID
+	api.Get("/services/search", serviceHandler.Search)
+	api.Get("/services/categories", categoryHandler.Tree)
+	api.Get("/services", authMiddleware.Authenticate(), serviceHandler.List)
 	api.Post("/services",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.ProviderRole, models.AdminRole),
 		auditMiddleware.Audit(middleware.AuditConfig{
 			Action:   services.ActionServiceCreate,
 			Resource: "services",
 		}),
-		a.createService)
+		serviceHandler.Create)
 	api.Put("/services/:id",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.ProviderRole, models.AdminRole),
 		auditMiddleware.AuditWithResourceID(services.ActionServiceUpdate, "services", "id"),
-		a.updateService)
+		serviceHandler.Update)
 	api.Delete("/services/:id",
-		authMiddleware.RequireRoles(models.AdminRole),
-		auditMiddleware.AdminActionAudit(services.ActionServiceDelete, "services"),
-		a.deleteService)
-	api.Get("/services/:id", authMiddleware.Authenticate(), a.getService)
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole, models.AdminRole),
+		auditMiddleware.AuditWithResourceID(services.ActionServiceDelete, "services", "id"),
+		serviceHandler.Delete)
+	api.Get("/services/:id", authMiddleware.Authenticate(), serviceHandler.Get)
+
+	// Provider profiles - public read; providers maintain their own
+	providerProfiles := handlers.NewProviderProfileHandler(a.repository, a.logger)
+	api.Put("/providers/profile",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		providerProfiles.Update)
+	api.Get("/providers/:id/profile", providerProfiles.Get)
+
+	// Provider calendars - providers keep their own; bookable slots are public
+	availabilityHandler := handlers.NewAvailabilityHandler(services.NewAvailabilityService(a.repository, a.logger.Logger), a.repository, a.logger)
+	api.Get("/providers/availability",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		availabilityHandler.Get)
+	api.Put("/providers/availability",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		availabilityHandler.SetWeeklyHours)
+	api.Post("/providers/availability/time-off",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		availabilityHandler.AddTimeOff)
+	api.Delete("/providers/availability/time-off/:id",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		availabilityHandler.RemoveTimeOff)
+	api.Get("/services/:id/slots", availabilityHandler.Slots)
+
+	// Booking routes - PROTECTED; transitions are checked against the booking state machine
+	bookingService := services.NewBookingService(a.repository, a.logger.Logger)
+	bookingService.OnStatusChange(a.escrowService.OnBookingStatusChange)
+	bookingHandler := handlers.NewBookingHandler(bookingService, a.auditService, a.logger)
+	escrowHandler := handlers.NewEscrowHandler(bookingService, a.escrowService, a.logger)
+	api.Post("/bookings",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.CustomerRole),
+		bookingHandler.Create)
+	api.Get("/bookings", authMiddleware.Authenticate(), bookingHandler.List)
+	api.Get("/bookings/:id", authMiddleware.Authenticate(), bookingHandler.Get)
+	api.Patch("/bookings/:id/status", authMiddleware.Authenticate(), bookingHandler.UpdateStatus)
+	api.Get("/bookings/:id/escrow", authMiddleware.Authenticate(), escrowHandler.Get)
+	api.Post("/bookings/:id/dispute",
+		authMiddleware.Authenticate(),
+		auditMiddleware.AuditWithResourceID(services.ActionEscrowDispute, "bookings", "id"),
+		escrowHandler.Dispute)
+
+	// Job requests - customers describe unpriced work, nearby providers quote, and an accepted quote becomes a booking
+	var jobStore services.JobStore = services.NewMemoryJobStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoJobStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			jobStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory job store", zap.Error(err))
+		}
+	}
+	jobService := services.NewJobService(jobStore, a.repository, bookingService, a.logger.Logger)
+	jobService.SetEscrow(a.escrowService)
+	jobService.SetCategories(categoryService)
+	jobHandler := handlers.NewJobHandler(jobService, a.logger)
+	api.Post("/jobs",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.CustomerRole),
+		auditMiddleware.AuditSensitiveOperation(services.ActionJobRequestCreate, "jobs"),
+		jobHandler.Create)
+	api.Get("/jobs", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.CustomerRole), jobHandler.List)
+	api.Get("/jobs/nearby", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.ProviderRole), jobHandler.Nearby)
+	api.Get("/jobs/:id", authMiddleware.Authenticate(), jobHandler.Get)
+	api.Post("/jobs/:id/cancel", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.CustomerRole), jobHandler.Cancel)
+	api.Get("/jobs/:id/quotes", authMiddleware.Authenticate(), jobHandler.Quotes)
+	api.Post("/jobs/:id/quotes",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		auditMiddleware.AuditWithResourceID(services.ActionQuoteSubmit, "jobs", "id"),
+		jobHandler.SubmitQuote)
+	api.Get("/quotes", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.ProviderRole), jobHandler.MyQuotes)
+	api.Post("/quotes/:id/accept",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.CustomerRole),
+		auditMiddleware.AuditWithResourceID(services.ActionQuoteAccept, "quotes", "id"),
+		jobHandler.Accept)
+	api.Post("/quotes/:id/counter", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.CustomerRole), jobHandler.Counter)
+	api.Post("/quotes/:id/reject", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.CustomerRole), jobHandler.Reject)
 
 	// Payment routes - PROTECTED (PCI-DSS compliant) with audit logging
 	api.Post("/payments/tokenize",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentProcess, "payments"),
 		a.tokenizePaymentMethod)
 	api.Post("/payments/process",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentProcess, "payments"),
 		a.processPayment)
 	api.Get("/payments/validate",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole, models.AdminRole),
 		auditMiddleware.Audit(middleware.AuditConfig{Action: services.ActionPaymentProcess, Resource: "payments"}),
 		a.validatePaymentToken)
 	api.Delete("/payments/token",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole, models.AdminRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentProcess, "payments"),
 		a.deletePaymentToken)
+	// The cardholder's browser lands here after 3-D Secure; the outcome is confirmed with the gateway
+	api.Get("/payments/3ds/return", a.completePaymentAuthentication)
+	api.Get("/payments/:id",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.CustomerRole, models.AdminRole),
+		a.getPayment)
 
 	// Sync routes - PROTECTED for offline-first functionality
 	api.Post("/sync/data", authMiddleware.Authenticate(), a.syncData)
@@ -551,30 +767,219 @@ func (a *App) setupRoutes(app *fiber.App, authMiddleware *middleware.JWTAuthMidd
 	api.Post("/sync/decompress", authMiddleware.Authenticate(), a.decompressData)
 
 	// Wallet routes - PROTECTED with RBAC and audit logging (sensitive financial operations)
-	momoClient := services.NewMomoClient(a.config.Momo.BaseURL, a.config.Momo.TargetEnvironment, a.config.Momo.APIUser, a.config.Momo.APIKey, a.config.Momo.SubscriptionKeyCollection, a.config.Momo.SubscriptionKeyDisbursement)
-	walletHandler := handlers.NewWalletHandlerWithLedger(momoClient, a.logger, ledgerSvc)
+	walletHandler := handlers.NewWalletHandlerWithProviders(paymentProviders, a.logger, ledgerSvc, a.escrowService)
+	// Linked mobile-money numbers are stored encrypted and verified by OTP before use
+	var methodStore services.PaymentMethodStore = services.NewMemoryPaymentMethodStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoPaymentMethodStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			methodStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory payment method store", zap.Error(err))
+		}
+	}
+	var methodOTP services.PaymentMethodOTPSender
+	if a.config.IsDevelopment() {
+		methodOTP = services.NewLoggingOTPSender(a.logger.Logger)
+	} else {
+		a.logger.Warn("No SMS sender configured; linking payment methods is unavailable")
+	}
+	paymentMethods := services.NewPaymentMethodService(methodStore, a.encryptionService, methodOTP, a.auditService, a.logger.Logger)
+	walletHandler.SetPaymentMethods(paymentMethods)
+	// Withdrawals are checked against the balance and role limits; velocity rules hold them for admin review
+	var withdrawalStore services.WithdrawalStore = services.NewMemoryWithdrawalStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoWithdrawalStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			withdrawalStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory withdrawal store", zap.Error(err))
+		}
+	}
+	withdrawCfg := a.config.Withdraw
+	withdrawals := services.NewWithdrawalService(withdrawalStore, a.repository, ledgerSvc, paymentProviders, a.encryptionService, services.WithdrawalPolicy{
+		Limits: map[models.UserRole]services.WithdrawalLimit{
+			models.CustomerRole: {Daily: withdrawCfg.CustomerDailyLimit, Monthly: withdrawCfg.CustomerMonthlyLimit},
+			models.ProviderRole: {Daily: withdrawCfg.ProviderDailyLimit, Monthly: withdrawCfg.ProviderMonthlyLimit},
+		},
+		MaxPerHour:    withdrawCfg.MaxPerHour,
+		NewNumberHold: withdrawCfg.NewNumberHold,
+	}, a.auditService, a.logger.Logger)
+	withdrawals.SetPaymentMethods(paymentMethods)
+	withdrawals.SetFXService(fxService)
+	walletHandler.SetWithdrawals(withdrawals)
+	withdrawalHandler := handlers.NewWithdrawalHandler(withdrawals, a.logger)
+
+	// Provider balances are paid out in scheduled batches to their default payout number
+	var payoutStore services.PayoutStore = services.NewMemoryPayoutStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoPayoutStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			payoutStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory payout store", zap.Error(err))
+		}
+	}
+	payoutCfg := a.config.Payout
+	a.payoutService = services.NewPayoutService(payoutStore, a.repository, ledgerSvc, paymentProviders, paymentMethods, a.encryptionService, momoWebhooks, services.PayoutPolicy{
+		Minimums:     map[string]float64{models.CurrencyUSD: payoutCfg.MinimumUSD, models.CurrencyLRD: payoutCfg.MinimumLRD},
+		Concurrency:  payoutCfg.Concurrency,
+		Every:        payoutCfg.Interval,
+		PollInterval: payoutCfg.PollInterval,
+	}, a.auditService, a.logger.Logger)
+	payoutHandler := handlers.NewPayoutHandler(a.payoutService, a.logger)
+
+	// Wallet-to-wallet transfers; large ones need the sender's PIN or a code sent to their phone
+	var transferStore services.TransferStore = services.NewMemoryTransferStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoTransferStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			transferStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory transfer store", zap.Error(err))
+		}
+	}
+	transfers := services.NewTransferService(transferStore, a.repository, ledgerSvc, methodOTP, services.TransferPolicy{
+		StepUpThreshold: a.config.Transfer.StepUpThreshold,
+	}, a.auditService, a.logger.Logger)
+	transfers.SetFXService(fxService)
+	transferHandler := handlers.NewTransferHandler(transfers, a.logger)
+	walletMethods := handlers.NewWalletMethodsHandler(paymentMethods, a.logger)
+	walletRoles := authMiddleware.RequireRoles(models.CustomerRole, models.ProviderRole)
+	api.Get("/wallet/methods", authMiddleware.Authenticate(), walletRoles, walletMethods.List)
+	api.Post("/wallet/methods", authMiddleware.Authenticate(), walletRoles, walletMethods.Link)
+	api.Post("/wallet/methods/:id/verify", authMiddleware.Authenticate(), walletRoles, walletMethods.Verify)
+	api.Put("/wallet/methods/:id/default", authMiddleware.Authenticate(), walletRoles, walletMethods.SetDefault)
+	api.Delete("/wallet/methods/:id", authMiddleware.Authenticate(), walletRoles, walletMethods.Delete)
 	api.Post("/wallet/topup",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole, models.ProviderRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionWalletCreate, "wallet"),
 		walletHandler.Topup)
 	api.Post("/wallet/pay",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentProcess, "wallet"),
 		walletHandler.PayEscrow)
+	api.Post("/wallet/pay/balance",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.CustomerRole),
+		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentProcess, "wallet"),
+		walletHandler.PayFromWallet)
+	fxHandler := handlers.NewFXHandler(fxService, a.logger)
+	api.Get("/wallet/fx/rates", authMiddleware.Authenticate(), fxHandler.Rates)
+	api.Post("/wallet/fx/quotes", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.CustomerRole), fxHandler.Quote)
 	api.Post("/wallet/withdraw",
+		authMiddleware.Authenticate(),
 		authMiddleware.RequireRoles(models.CustomerRole, models.ProviderRole),
 		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentRefund, "wallet"),
 		walletHandler.Withdraw)
+	api.Get("/wallet/withdrawals", authMiddleware.Authenticate(), walletRoles, withdrawalHandler.Mine)
+	api.Get("/wallet/transfers/recipient", authMiddleware.Authenticate(), walletRoles, transferHandler.Lookup)
+	api.Get("/wallet/transfers", authMiddleware.Authenticate(), walletRoles, transferHandler.List)
+	api.Get("/wallet/transfers/:id", authMiddleware.Authenticate(), walletRoles, transferHandler.Get)
+	api.Post("/wallet/transfers", authMiddleware.Authenticate(), walletRoles, transferHandler.Send)
+	api.Post("/wallet/transfers/:id/confirm", authMiddleware.Authenticate(), walletRoles, transferHandler.Confirm)
+	api.Put("/wallet/pin", authMiddleware.Authenticate(), walletRoles, transferHandler.SetPIN)
 	api.Get("/wallet/balances",
 		authMiddleware.Authenticate(),
 		auditMiddleware.Audit(middleware.AuditConfig{Action: services.ActionWalletCreate, Resource: "wallet"}),
 		walletHandler.Balances)
 
+	feeHandler := handlers.NewFeeHandler(feeService, a.logger)
+	api.Get("/wallet/earnings",
+		authMiddleware.Authenticate(),
+		authMiddleware.RequireRoles(models.ProviderRole),
+		feeHandler.Earnings)
+
+	historyHandler := handlers.NewWalletHistoryHandler(ledgerSvc, a.logger)
+	api.Get("/wallet/transactions", authMiddleware.Authenticate(), walletRoles, historyHandler.History)
+	api.Get("/wallet/statement", authMiddleware.Authenticate(), walletRoles, historyHandler.Statement)
+
 	// Composite dashboards - PROTECTED
 	dashboardHandler := handlers.NewDashboardHandler(a.repository, ledgerSvc, a.logger)
 	api.Get("/home/summary", authMiddleware.Authenticate(), dashboardHandler.HomeSummary)
 	api.Get("/wallet/dashboard", authMiddleware.Authenticate(), dashboardHandler.WalletDashboard)
 
+	// Refunds are recorded with their reason and capped at what each payment captured
+	var refundStore services.RefundStore = services.NewMemoryRefundStore()
+	if a.mongoDB != nil && a.mongoDB.GetDB() != nil {
+		if store, err := services.NewMongoRefundStore(a.mongoDB.GetDB(), a.logger); err == nil {
+			refundStore = store
+		} else {
+			a.logger.Warn("Falling back to in-memory refund store", zap.Error(err))
+		}
+	}
+	refunds := services.NewRefundService(refundStore, a.repository, ledgerSvc, a.escrowService, a.pciService, paymentProviders, a.auditService, a.logger.Logger)
+	refundHandler := handlers.NewRefundHandler(refunds, a.logger)
+
+	// Admin routes - PROTECTED, admin only
+	admin := api.Group("/admin", authMiddleware.Authenticate(), authMiddleware.RequireRoles(models.AdminRole))
+	admin.Get("/webhooks/momo", walletWebhook.ListEvents)
+	admin.Post("/payments/:id/capture",
+		auditMiddleware.AuditWithResourceID(services.ActionPaymentProcess, "payments", "id"),
+		a.capturePayment)
+	admin.Post("/payments/:id/void",
+		auditMiddleware.AuditWithResourceID(services.ActionPaymentProcess, "payments", "id"),
+		a.voidPayment)
+	admin.Post("/payments/:id/refund",
+		auditMiddleware.AuditWithResourceID(services.ActionPaymentRefund, "payments", "id"),
+		refundHandler.RefundPayment)
+	admin.Get("/refunds", refundHandler.List)
+	admin.Get("/refunds/:id", refundHandler.Get)
+	admin.Post("/refunds",
+		auditMiddleware.AuditSensitiveOperation(services.ActionPaymentRefund, "refunds"),
+		refundHandler.Create)
+	admin.Post("/bookings/:id/dispute/resolve",
+		auditMiddleware.AuditWithResourceID(services.ActionEscrowResolve, "bookings", "id"),
+		escrowHandler.Resolve)
+	admin.Get("/withdrawals", withdrawalHandler.Queue)
+	admin.Get("/withdrawals/:id", withdrawalHandler.Get)
+	admin.Post("/withdrawals/:id/approve",
+		auditMiddleware.AuditWithResourceID(services.ActionWithdrawalReview, "withdrawals", "id"),
+		withdrawalHandler.Approve)
+	admin.Post("/withdrawals/:id/reject",
+		auditMiddleware.AuditWithResourceID(services.ActionWithdrawalReview, "withdrawals", "id"),
+		withdrawalHandler.Reject)
+	admin.Get("/payouts", payoutHandler.List)
+	admin.Post("/payouts",
+		auditMiddleware.AuditSensitiveOperation(services.ActionPayoutBatch, "payouts"),
+		payoutHandler.Run)
+	admin.Get("/payouts/:id", payoutHandler.Get)
+	admin.Post("/payouts/:id/refresh", payoutHandler.Refresh)
+	admin.Post("/payouts/:id/retry",
+		auditMiddleware.AuditWithResourceID(services.ActionPayoutBatch, "payouts", "id"),
+		payoutHandler.Retry)
+	ledgerIntegrityHandler := handlers.NewLedgerIntegrityHandler(ledgerSvc, a.logger)
+	admin.Get("/ledger/integrity", ledgerIntegrityHandler.Verify)
+	admin.Get("/ledger/entries", ledgerIntegrityHandler.Entries)
+	admin.Get("/ledger/entries/:id", ledgerIntegrityHandler.Entry)
+	admin.Get("/fees", feeHandler.GetSchedule)
+	admin.Put("/fees",
+		auditMiddleware.AuditSensitiveOperation(services.ActionSystemConfiguration, "fees"),
+		feeHandler.UpdateSchedule)
+	admin.Get("/providers/:id/earnings", feeHandler.ProviderEarnings)
+	admin.Get("/fx/rates", fxHandler.Rates)
+	admin.Put("/fx/rates",
+		auditMiddleware.AuditSensitiveOperation(services.ActionSystemConfiguration, "fx_rates"),
+		fxHandler.SetRate)
+	admin.Post("/webhooks/momo/replay",
+		auditMiddleware.Audit(middleware.AuditConfig{Action: services.ActionWebhookReplay, Resource: "webhooks"}),
+		walletWebhook.ReplayFailed)
+	admin.Post("/webhooks/momo/:id/replay",
+		auditMiddleware.AuditWithResourceID(services.ActionWebhookReplay, "webhooks", "id"),
+		walletWebhook.ReplayEvent)
+	admin.Get("/categories", categoryHandler.AdminTree)
+	admin.Post("/categories",
+		auditMiddleware.Audit(middleware.AuditConfig{Action: services.ActionCategoryCreate, Resource: "categories"}),
+		categoryHandler.Create)
+	admin.Put("/categories/:id",
+		auditMiddleware.AuditWithResourceID(services.ActionCategoryUpdate, "categories", "id"),
+		categoryHandler.Update)
+	admin.Delete("/categories/:id",
+		auditMiddleware.AuditWithResourceID(services.ActionCategoryDelete, "categories", "id"),
+		categoryHandler.Delete)
+	reconciliationHandler := handlers.NewReconciliationHandler(a.momoReconciler, a.logger)
+	admin.Post("/reconciliation/run", reconciliationHandler.Run)
+	admin.Get("/reconciliation/reports/:date", reconciliationHandler.GetReport)
+	admin.Post("/reconciliation/reports/:date", reconciliationHandler.GenerateReport)
+
 	a.logger.Info("Routes configured successfully")
 }
 
@@ -660,20 +1065,107 @@ func (a *App) processPayment(c *fiber.Ctx) error {
 		})
 	}
 
-	response, err := a.pciService.ProcessPayment(&req)
+	user, _ := middleware.GetUserFromContextModels(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	req.CustomerID = user.ID.Hex()
+	if req.Email == "" {
+		req.Email = user.Email
+	}
+	response, err := a.pciService.ProcessPayment(c.Context(), &req)
 	if err != nil {
-		a.logger.Error("Failed to process payment", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process payment",
-		})
+		return a.paymentError(c, "process", err)
 	}
 
+	message := "Payment processed successfully"
+	if response.Status == string(services.CardChargeRequiresAction) {
+		message = "Card authentication required"
+	}
 	return c.JSON(fiber.Map{
-		"message": "Payment processed successfully",
+		"message": message,
 		"data":    response,
 	})
 }
 
+func (a *App) completePaymentAuthentication(c *fiber.Ctx) error {
+	ref := c.Query("tx_ref")
+	if ref == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "tx_ref is required"})
+	}
+	response, err := a.pciService.CompleteAuthentication(c.Context(), ref)
+	if err != nil {
+		return a.paymentError(c, "authenticate", err)
+	}
+	return c.JSON(fiber.Map{"data": response})
+}
+
+func (a *App) getPayment(c *fiber.Ctx) error {
+	user, _ := middleware.GetUserFromContextModels(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	charge, err := a.pciService.GetCharge(c.Context(), c.Params("id"))
+	if err == nil && charge.UserID != user.ID.Hex() && user.Role != models.AdminRole {
+		err = services.ErrCardChargeNotFound
+	}
+	if err != nil {
+		return a.paymentError(c, "get", err)
+	}
+	return c.JSON(fiber.Map{"data": charge})
+}
+
+type paymentAmountRequest struct {
+	Amount float64 `json:"amount"` // 0 means the full remaining amount
+}
+
+func (a *App) capturePayment(c *fiber.Ctx) error {
+	var req paymentAmountRequest
+	_ = c.BodyParser(&req)
+	response, err := a.pciService.CapturePayment(c.Context(), c.Params("id"), req.Amount)
+	if err != nil {
+		return a.paymentError(c, "capture", err)
+	}
+	return c.JSON(fiber.Map{"data": response})
+}
+
+func (a *App) voidPayment(c *fiber.Ctx) error {
+	response, err := a.pciService.VoidPayment(c.Context(), c.Params("id"))
+	if err != nil {
+		return a.paymentError(c, "void", err)
+	}
+	return c.JSON(fiber.Map{"data": response})
+}
+
+// paymentError maps card payment errors onto responses; declines carry their decline code
+func (a *App) paymentError(c *fiber.Ctx, op string, err error) error {
+	var declined *services.CardDeclinedError
+	switch {
+	case errors.As(err, &declined):
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":        "card_declined",
+			"decline_code": declined.Code,
+			"message":      declined.Message,
+		})
+	case errors.Is(err, services.ErrInvalidPaymentRequest):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentTokenNotFound), errors.Is(err, services.ErrCardChargeNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrCardChargeInvalidState), errors.Is(err, services.ErrCardChargeStateChanged):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrCardChargeAmountExceeded):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrCardGatewayUnavailable):
+		a.logger.Error("Card gateway unavailable", err, zap.String("operation", op))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "card gateway unavailable"})
+	default:
+		a.logger.Error("Failed to "+op+" payment", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to " + op + " payment",
+		})
+	}
+}
+
 func (a *App) validatePaymentToken(c *fiber.Ctx) error {
 	tokenID := c.Query("token_id")
 	if tokenID == "" {
@@ -768,43 +1260,6 @@ func (a *App) getUserProfile(c *fiber.Ctx) error {
 	return c.JSON(userResponse)
 }
 
-func (a *App) getServices(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"message": "Services list endpoint",
-		"data":    []fiber.Map{},
-	})
-}
-
-func (a *App) createService(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"message": "Create service endpoint",
-	})
-}
-
-func (a *App) getService(c *fiber.Ctx) error {
-	id := c.Params("id")
-	return c.JSON(fiber.Map{
-		"message": "Get service endpoint",
-		"id":      id,
-	})
-}
-
-func (a *App) updateService(c *fiber.Ctx) error {
-	id := c.Params("id")
-	return c.JSON(fiber.Map{
-		"message": "Update service endpoint",
-		"id":      id,
-	})
-}
-
-func (a *App) deleteService(c *fiber.Ctx) error {
-	id := c.Params("id")
-	return c.JSON(fiber.Map{
-		"message": "Delete service endpoint",
-		"id":      id,
-	})
-}
-
 // Enhanced sync handlers for offline-first functionality
 func (a *App) syncData(c *fiber.Ctx) error {
 	var req models.SyncRequest
@@ -1026,6 +1481,27 @@ func (a *App) Start() error {
 	// Handle graceful shutdown
 	go a.handleGracefulShutdown(ctx, cancel)
 
+	// Release escrows whose dispute window has passed
+	if a.escrowService != nil {
+		if err := a.escrowService.Start(ctx); err != nil {
+			a.logger.Warn("Failed to start escrow release worker", zap.Error(err))
+		}
+	}
+
+	// Poll MoMo for top-ups and withdrawals that never got a callback
+	if a.momoReconciler != nil {
+		if err := a.momoReconciler.Start(ctx); err != nil {
+			a.logger.Warn("Failed to start MoMo reconciler", zap.Error(err))
+		}
+	}
+
+	// Pay provider balances out in batches and track the transfers
+	if a.payoutService != nil {
+		if err := a.payoutService.Start(ctx); err != nil {
+			a.logger.Warn("Failed to start payout worker", zap.Error(err))
+		}
+	}
+
 	// Start server
 	addr := fmt.Sprintf("%s:%s", a.config.Server.Host, a.config.Server.Port)
 	environment := "production"
@@ -1067,6 +1543,23 @@ func (a *App) handleGracefulShutdown(ctx context.Context, cancel context.CancelF
 		a.logger.Error("Failed to shutdown server gracefully", err)
 	}
 
+	// Stop escrow release worker
+	if a.escrowService != nil {
+		_ = a.escrowService.Stop()
+	}
+
+	// Stop MoMo reconciler
+	if a.momoReconciler != nil {
+		_ = a.momoReconciler.Stop()
+	}
+	// Stop payout worker
+	if a.payoutService != nil {
+		_ = a.payoutService.Stop()
+	}
+	if a.momoSimulator != nil {
+		a.momoSimulator.Close()
+	}
+
 	// Stop change stream service
 	if a.changeStreamSvc != nil {
 		if err := a.changeStreamSvc.StopChangeStream(); err != nil {
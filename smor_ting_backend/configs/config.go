@@ -11,14 +11,22 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
-	CORS     CORSConfig
-	Logging  LoggingConfig
-	Security SecurityConfig
-	Momo     MomoConfig
-	KYC      KYCConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	CORS      CORSConfig
+	Logging   LoggingConfig
+	Security  SecurityConfig
+	Momo      MomoConfig
+	Orange    OrangeMoneyConfig
+	Card      CardGatewayConfig
+	KYC       KYCConfig
+	Escrow    EscrowConfig
+	FX        FXConfig
+	Withdraw  WithdrawalConfig
+	Payout    PayoutConfig
+	Transfer  TransferConfig
+	Reconcile ReconcileConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -90,6 +98,79 @@ type MomoConfig struct {
 	SubscriptionKeyCollection   string // Ocp-Apim-Subscription-Key for Collection
 	SubscriptionKeyDisbursement string // for Disbursement
 	CallbackHost                string // public URL for callbacks/webhooks
+	WebhookSecret               string // shared secret for callback HMAC; when empty callbacks are re-queried with MoMo
+	Simulator                   bool   // development only: serve MoMo from the in-process simulator instead of BaseURL
+}
+
+// OrangeMoneyConfig holds Orange Money Liberia merchant API configuration; the
+// provider is offered only when BaseURL is set
+type OrangeMoneyConfig struct {
+	BaseURL       string
+	ClientID      string // OAuth client credentials
+	ClientSecret  string
+	APIUsername   string // channel user API credentials (X-AUTH-TOKEN)
+	APIPassword   string
+	ChannelMsisdn string // merchant wallet that collects and pays out
+	NotifyURL     string // public URL of /api/v1/webhooks/orange_money
+}
+
+// CardGatewayConfig holds the Flutterwave card gateway configuration. Without a
+// secret key, development uses the in-process fake gateway and other
+// environments cannot take card payments.
+type CardGatewayConfig struct {
+	FlutterwaveBaseURL       string
+	FlutterwaveSecretKey     string
+	FlutterwaveEncryptionKey string // 24-byte 3DES key for card payloads
+	ReturnURL                string // public URL of /api/v1/payments/3ds/return
+}
+
+// ReconcileConfig controls the MoMo reconciliation job for top-ups and withdrawals without a callback
+type ReconcileConfig struct {
+	Interval   time.Duration // how often pending entries are polled
+	StaleAfter time.Duration // how long an entry may wait for its callback before it is polled
+}
+
+// EscrowConfig controls how booking payments held in escrow are settled
+type EscrowConfig struct {
+	DisputeWindow   time.Duration // delay between booking completion and release to the provider; 0 releases immediately
+	ReleaseInterval time.Duration // how often due releases are processed
+	// CommissionPercent is the platform's cut of a release until admins save a fee schedule
+	CommissionPercent float64
+}
+
+// FXConfig controls conversions between wallet currencies
+type FXConfig struct {
+	QuoteTTL time.Duration // how long a quoted rate is honoured
+	// USDToLRD is the USD/LRD rate used until admins save one; 0 leaves conversions unavailable
+	USDToLRD float64
+}
+
+// WithdrawalConfig limits payouts from wallets to mobile money. Limits are in
+// USD, other currencies are converted at the current rate; 0 disables a limit.
+type WithdrawalConfig struct {
+	CustomerDailyLimit   float64
+	CustomerMonthlyLimit float64
+	ProviderDailyLimit   float64
+	ProviderMonthlyLimit float64
+	// MaxPerHour withdrawals are paid straight away; further ones in the hour wait for review
+	MaxPerHour int
+	// NewNumberHold is how long a payout number must have been known before it is paid without review
+	NewNumberHold time.Duration
+}
+
+// PayoutConfig controls the batches that pay providers' wallet balances out to mobile money
+type PayoutConfig struct {
+	Interval     time.Duration // how often a batch is gathered; 0 leaves batches to admins
+	PollInterval time.Duration // how often submitted payouts are checked with the provider
+	Concurrency  int           // transfers in flight at once
+	MinimumUSD   float64       // smallest USD balance worth paying out
+	MinimumLRD   float64       // smallest LRD balance worth paying out
+}
+
+// TransferConfig controls wallet-to-wallet transfers between users
+type TransferConfig struct {
+	// StepUpThreshold is the amount in USD above which a transfer needs the sender's PIN or a one-time code
+	StepUpThreshold float64
 }
 
 // KYCConfig holds SmileID configuration
@@ -156,6 +237,8 @@ func LoadConfig() (*Config, error) {
 			SubscriptionKeyCollection:   getEnv("MOMO_SUB_KEY_COLLECTION", ""),
 			SubscriptionKeyDisbursement: getEnv("MOMO_SUB_KEY_DISBURSEMENT", ""),
 			CallbackHost:                getEnv("MOMO_CALLBACK_HOST", ""),
+			WebhookSecret:               getEnv("MOMO_WEBHOOK_SECRET", ""),
+			Simulator:                   getBoolEnv("MOMO_SIMULATOR", false),
 		},
 		KYC: KYCConfig{
 			BaseURL:     getEnv("SMILEID_BASE_URL", ""),
@@ -163,6 +246,52 @@ func LoadConfig() (*Config, error) {
 			APIKey:      getEnv("SMILEID_API_KEY", ""),
 			CallbackURL: getEnv("SMILEID_CALLBACK_URL", ""),
 		},
+		Escrow: EscrowConfig{
+			DisputeWindow:     getDurationEnv("ESCROW_DISPUTE_WINDOW", 24*time.Hour),
+			ReleaseInterval:   getDurationEnv("ESCROW_RELEASE_INTERVAL", 5*time.Minute),
+			CommissionPercent: getFloatEnv("PLATFORM_COMMISSION_PERCENT", 10),
+		},
+		FX: FXConfig{
+			QuoteTTL: getDurationEnv("FX_QUOTE_TTL", 10*time.Minute),
+			USDToLRD: getFloatEnv("FX_USD_LRD_RATE", 0),
+		},
+		Payout: PayoutConfig{
+			Interval:     getDurationEnv("PAYOUT_BATCH_INTERVAL", 24*time.Hour),
+			PollInterval: getDurationEnv("PAYOUT_POLL_INTERVAL", 5*time.Minute),
+			Concurrency:  getIntEnv("PAYOUT_CONCURRENCY", 4),
+			MinimumUSD:   getFloatEnv("PAYOUT_MINIMUM_USD", 5),
+			MinimumLRD:   getFloatEnv("PAYOUT_MINIMUM_LRD", 1000),
+		},
+		Transfer: TransferConfig{
+			StepUpThreshold: getFloatEnv("TRANSFER_STEP_UP_THRESHOLD_USD", 50),
+		},
+		Withdraw: WithdrawalConfig{
+			CustomerDailyLimit:   getFloatEnv("WITHDRAWAL_CUSTOMER_DAILY_LIMIT", 500),
+			CustomerMonthlyLimit: getFloatEnv("WITHDRAWAL_CUSTOMER_MONTHLY_LIMIT", 2000),
+			ProviderDailyLimit:   getFloatEnv("WITHDRAWAL_PROVIDER_DAILY_LIMIT", 2000),
+			ProviderMonthlyLimit: getFloatEnv("WITHDRAWAL_PROVIDER_MONTHLY_LIMIT", 10000),
+			MaxPerHour:           getIntEnv("WITHDRAWAL_MAX_PER_HOUR", 3),
+			NewNumberHold:        getDurationEnv("WITHDRAWAL_NEW_NUMBER_HOLD", 24*time.Hour),
+		},
+		Orange: OrangeMoneyConfig{
+			BaseURL:       getEnv("ORANGE_MONEY_BASE_URL", ""),
+			ClientID:      getEnv("ORANGE_MONEY_CLIENT_ID", ""),
+			ClientSecret:  getEnv("ORANGE_MONEY_CLIENT_SECRET", ""),
+			APIUsername:   getEnv("ORANGE_MONEY_API_USERNAME", ""),
+			APIPassword:   getEnv("ORANGE_MONEY_API_PASSWORD", ""),
+			ChannelMsisdn: getEnv("ORANGE_MONEY_CHANNEL_MSISDN", ""),
+			NotifyURL:     getEnv("ORANGE_MONEY_NOTIFY_URL", ""),
+		},
+		Card: CardGatewayConfig{
+			FlutterwaveBaseURL:       getEnv("FLUTTERWAVE_BASE_URL", "https://api.flutterwave.com"),
+			FlutterwaveSecretKey:     getEnv("FLUTTERWAVE_SECRET_KEY", ""),
+			FlutterwaveEncryptionKey: getEnv("FLUTTERWAVE_ENCRYPTION_KEY", ""),
+			ReturnURL:                getEnv("CARD_3DS_RETURN_URL", ""),
+		},
+		Reconcile: ReconcileConfig{
+			Interval:   getDurationEnv("MOMO_RECONCILE_INTERVAL", 10*time.Minute),
+			StaleAfter: getDurationEnv("MOMO_RECONCILE_STALE_AFTER", 30*time.Minute),
+		},
 	}
 
 	// Validate configuration
@@ -505,6 +634,15 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
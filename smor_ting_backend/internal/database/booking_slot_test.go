@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryBookingSlots_PendingHoldExpires(t *testing.T) {
+	db := NewMemoryDatabase()
+	ctx := context.Background()
+	provider := primitive.NewObjectID()
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Hour)
+	window := func() []models.Booking {
+		booked, err := db.GetProviderSchedule(ctx, provider, start.Add(-time.Hour), start.Add(time.Hour))
+		require.NoError(t, err)
+		return booked
+	}
+
+	pending := &models.Booking{ProviderID: provider, ScheduledDate: start, Status: models.BookingPending}
+	require.NoError(t, db.CreateBooking(ctx, pending))
+	assert.Len(t, window(), 1)
+	assert.ErrorIs(t, db.CreateBooking(ctx, &models.Booking{ProviderID: provider, ScheduledDate: start, Status: models.BookingPending}), ErrSlotTaken)
+
+	// Left unconfirmed past the hold, the booking frees its slot for someone else
+	db.bookings[pending.ID.Hex()].CreatedAt = time.Now().Add(-PendingSlotHold - time.Minute)
+	assert.Empty(t, window())
+	fresh := &models.Booking{ProviderID: provider, ScheduledDate: start, Status: models.BookingPending}
+	require.NoError(t, db.CreateBooking(ctx, fresh))
+	assert.ErrorIs(t, db.TransitionBookingStatus(ctx, pending.ID, models.BookingPending, models.BookingConfirmed), ErrSlotTaken)
+
+	// Confirmed bookings keep the slot however old they are
+	require.NoError(t, db.TransitionBookingStatus(ctx, fresh.ID, models.BookingPending, models.BookingConfirmed))
+	db.bookings[fresh.ID.Hex()].CreatedAt = time.Now().Add(-PendingSlotHold - time.Minute)
+	if booked := window(); assert.Len(t, booked, 1) {
+		assert.Equal(t, fresh.ID, booked[0].ID)
+	}
+}
@@ -2,19 +2,79 @@ package database
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/smorting/backend/internal/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrVersionConflict is returned when an optimistic update loses a race with a concurrent writer
+var ErrVersionConflict = errors.New("document was modified concurrently")
+
+// ErrServiceProviderNotFound is returned when a user has no provider profile
+var ErrServiceProviderNotFound = errors.New("service provider profile not found")
+
+// ErrCategoryNotFound is returned when no category has the requested ID or slug
+var ErrCategoryNotFound = errors.New("category not found")
+
+// ErrDuplicateCategory is returned when another category already has the slug
+var ErrDuplicateCategory = errors.New("category slug already in use")
+
+// ErrAvailabilityNotFound is returned when a provider has not published a calendar
+var ErrAvailabilityNotFound = errors.New("provider availability not found")
+
+// ErrDuplicateLedgerTransaction is returned when a ledger transaction's idempotency key has already been posted
+var ErrDuplicateLedgerTransaction = errors.New("ledger transaction already recorded")
+
+// ErrSlotTaken is returned when another active booking already holds the provider's start time
+var ErrSlotTaken = errors.New("provider already has a booking at that time")
+
+// PendingSlotHold is how long a booking the provider has not confirmed keeps its
+// slot; after that the slot is offered, and can be booked, again
+const PendingSlotHold = 48 * time.Hour
+
+// LedgerCursor is the position of a row in newest-first ledger listings
+type LedgerCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+// After reports whether a row at (createdAt, id) comes after the cursor, i.e. is older
+func (c *LedgerCursor) After(createdAt time.Time, id primitive.ObjectID) bool {
+	if c == nil {
+		return true
+	}
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.Before(c.CreatedAt)
+	}
+	return id.Hex() < c.ID.Hex()
+}
+
+// LedgerQuery selects a user's ledger transactions or payment intents, newest first.
+// Empty fields do not filter.
+type LedgerQuery struct {
+	UserID   primitive.ObjectID
+	Types    []models.LedgerType
+	Statuses []models.LedgerStatus // payment intents only; ledger transactions are always completed
+	Currency string                // a currency the user's side of the row moves
+	From     time.Time
+	To       time.Time // exclusive
+	Before   *LedgerCursor
+	Limit    int
+}
+
 // Repository defines the interface for data access operations
 type Repository interface {
 	// User operations
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	// GetUserByPhone returns the user whose phone is stored exactly as phone
+	GetUserByPhone(ctx context.Context, phone string) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	// GetUsersByRole returns every user with the role
+	GetUsersByRole(ctx context.Context, role models.UserRole) ([]models.User, error)
 
 	// OTP operations
 	CreateOTP(ctx context.Context, otp *models.OTPRecord) error
@@ -23,18 +83,73 @@ type Repository interface {
 	// Test-only helper: latest OTP by email (unconsumed, unexpired)
 	GetLatestOTPByEmail(ctx context.Context, email string) (*models.OTPRecord, error)
 
+	// Category operations. Categories are never deleted, only deactivated.
+	// CreateCategory and UpdateCategory return ErrDuplicateCategory when the slug is taken.
+	CreateCategory(ctx context.Context, category *models.ServiceCategory) error
+	// GetCategories returns every category, active or not, ordered by sort order then name
+	GetCategories(ctx context.Context) ([]models.ServiceCategory, error)
+	GetCategoryByID(ctx context.Context, id primitive.ObjectID) (*models.ServiceCategory, error)
+	GetCategoryBySlug(ctx context.Context, slug string) (*models.ServiceCategory, error)
+	UpdateCategory(ctx context.Context, category *models.ServiceCategory) error
+
 	// Service operations
 	CreateService(ctx context.Context, service *models.Service) error
 	GetServices(ctx context.Context, categoryID *primitive.ObjectID, location *models.Address, radius float64) ([]models.Service, error)
+	// SearchServices returns the active services matching q, ranked by distance, rating and completed jobs
+	SearchServices(ctx context.Context, q ServiceSearch) ([]ServiceSearchResult, error)
+	GetServiceByID(ctx context.Context, id primitive.ObjectID) (*models.Service, error)
+	GetProviderServices(ctx context.Context, providerID primitive.ObjectID) ([]models.Service, error)
+	// UpdateService replaces the service if its Version still matches the stored one, then bumps Version
+	UpdateService(ctx context.Context, service *models.Service) error
+	// DeleteService soft-deletes a service by clearing IsActive
+	DeleteService(ctx context.Context, id primitive.ObjectID) error
+
+	// Provider profile operations, keyed by the provider's user ID
+	// UpsertServiceProvider creates or replaces the profile of provider.UserID
+	UpsertServiceProvider(ctx context.Context, provider *models.ServiceProvider) error
+	GetServiceProviderByUserID(ctx context.Context, userID primitive.ObjectID) (*models.ServiceProvider, error)
+
+	// Provider calendars, keyed by the provider's user ID
+	// UpsertProviderAvailability creates or replaces the calendar of availability.ProviderID
+	UpsertProviderAvailability(ctx context.Context, availability *models.ProviderAvailability) error
+	GetProviderAvailability(ctx context.Context, providerID primitive.ObjectID) (*models.ProviderAvailability, error)
 
 	// Booking operations
 	CreateBooking(ctx context.Context, booking *models.Booking) error
 	GetUserBookings(ctx context.Context, userID primitive.ObjectID) ([]models.Booking, error)
+	GetProviderBookings(ctx context.Context, providerID primitive.ObjectID) ([]models.Booking, error)
+	// GetProviderSchedule returns the provider's confirmed and in-progress bookings,
+	// and pending ones created within PendingSlotHold, scheduled from from up to
+	// to, earliest first
+	GetProviderSchedule(ctx context.Context, providerID primitive.ObjectID, from, to time.Time) ([]models.Booking, error)
+	GetBookingByID(ctx context.Context, bookingID primitive.ObjectID) (*models.Booking, error)
 	UpdateBookingStatus(ctx context.Context, bookingID primitive.ObjectID, status models.BookingStatus) error
+	// TransitionBookingStatus moves a booking from one status to another only if it is still in from;
+	// otherwise it returns ErrVersionConflict. CompletedDate is stamped when moving to completed.
+	TransitionBookingStatus(ctx context.Context, bookingID primitive.ObjectID, from, to models.BookingStatus) error
 
 	// Wallet operations
 	UpdateWallet(ctx context.Context, userID primitive.ObjectID, transaction *models.Transaction) error
 
+	// Double-entry wallet ledger. Transactions are append-only; balances are derived from posting sums.
+	// AppendLedgerTransaction returns ErrDuplicateLedgerTransaction when the idempotency key was already used.
+	AppendLedgerTransaction(ctx context.Context, tx *models.LedgerTransaction) error
+	// WithWalletLock runs fn once, holding the user's wallet lock, which is shared by
+	// every instance. Debits check the balance and post or reserve funds inside fn so
+	// two debits cannot spend the same funds. fn must not take the same wallet's lock again.
+	WithWalletLock(ctx context.Context, userID primitive.ObjectID, fn func(ctx context.Context) error) error
+	// GetLedgerCurrencyBalances returns credits minus debits for each requested account key,
+	// split by posting currency: account key -> currency -> balance
+	GetLedgerCurrencyBalances(ctx context.Context, accounts []string) (map[string]map[string]float64, error)
+	// GetUserLedgerTransactions returns the newest transactions touching any of the user's accounts
+	GetUserLedgerTransactions(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LedgerTransaction, error)
+	// ListUserLedgerTransactions returns the user's transactions matching q, newest first
+	ListUserLedgerTransactions(ctx context.Context, q LedgerQuery) ([]models.LedgerTransaction, error)
+	// GetLedgerCurrencyBalancesBefore is GetLedgerCurrencyBalances over transactions created before at
+	GetLedgerCurrencyBalancesBefore(ctx context.Context, accounts []string, at time.Time) (map[string]map[string]float64, error)
+	// GetUserLedgerTransactionsBetween returns the transactions touching the user's accounts created in [from, to), oldest first
+	GetUserLedgerTransactionsBetween(ctx context.Context, userID primitive.ObjectID, from, to time.Time) ([]models.LedgerTransaction, error)
+
 	// Offline-first sync operations
 	GetUnsyncedData(ctx context.Context, userID primitive.ObjectID, lastSyncAt time.Time) (map[string]interface{}, error)
 	SyncData(ctx context.Context, userID primitive.ObjectID, data map[string]interface{}) error
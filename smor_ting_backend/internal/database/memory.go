@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,7 +15,10 @@ import (
 type MemoryDatabase struct {
 	users                map[string]*models.User
 	otpRecords           map[string]*models.OTPRecord
+	categories           map[string]*models.ServiceCategory
 	services             map[string]*models.Service
+	serviceProviders     map[string]*models.ServiceProvider      // by user ID
+	availability         map[string]*models.ProviderAvailability // by provider user ID
 	bookings             map[string]*models.Booking
 	deviceSessions       map[string]*models.DeviceSession
 	securityEvents       map[string]*models.SecurityEvent
@@ -23,6 +27,9 @@ type MemoryDatabase struct {
 	syncStatuses         map[string]*models.SyncStatus
 	syncQueueItems       map[string]*models.SyncQueueItem
 	backgroundSyncStatus map[string]*models.BackgroundSyncStatus
+	ledger               []models.LedgerTransaction
+	ledgerKeys           map[string]bool
+	walletLocks          map[primitive.ObjectID]*sync.Mutex
 	mu                   sync.RWMutex
 }
 
@@ -30,7 +37,10 @@ func NewMemoryDatabase() *MemoryDatabase {
 	return &MemoryDatabase{
 		users:                make(map[string]*models.User),
 		otpRecords:           make(map[string]*models.OTPRecord),
+		categories:           make(map[string]*models.ServiceCategory),
 		services:             make(map[string]*models.Service),
+		serviceProviders:     make(map[string]*models.ServiceProvider),
+		availability:         make(map[string]*models.ProviderAvailability),
 		bookings:             make(map[string]*models.Booking),
 		deviceSessions:       make(map[string]*models.DeviceSession),
 		securityEvents:       make(map[string]*models.SecurityEvent),
@@ -39,6 +49,8 @@ func NewMemoryDatabase() *MemoryDatabase {
 		syncStatuses:         make(map[string]*models.SyncStatus),
 		syncQueueItems:       make(map[string]*models.SyncQueueItem),
 		backgroundSyncStatus: make(map[string]*models.BackgroundSyncStatus),
+		ledgerKeys:           make(map[string]bool),
+		walletLocks:          make(map[primitive.ObjectID]*sync.Mutex),
 	}
 }
 
@@ -86,6 +98,19 @@ func (m *MemoryDatabase) CreateUser(ctx context.Context, user *models.User) erro
 	return nil
 }
 
+func (m *MemoryDatabase) GetUsersByRole(ctx context.Context, role models.UserRole) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range m.users {
+		if user.Role == role {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
 func (m *MemoryDatabase) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -99,6 +124,19 @@ func (m *MemoryDatabase) GetUserByEmail(ctx context.Context, email string) (*mod
 	return nil, errors.New("user not found")
 }
 
+func (m *MemoryDatabase) GetUserByPhone(ctx context.Context, phone string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if phone != "" && user.Phone == phone {
+			return user, nil
+		}
+	}
+
+	return nil, errors.New("user not found")
+}
+
 func (m *MemoryDatabase) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -196,6 +234,96 @@ func (m *MemoryDatabase) GetLatestOTPByEmail(ctx context.Context, email string)
 	return latest, nil
 }
 
+// Category operations
+func (m *MemoryDatabase) CreateCategory(ctx context.Context, category *models.ServiceCategory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.categorySlugTaken(category.Slug, primitive.NilObjectID) {
+		return ErrDuplicateCategory
+	}
+	category.ID = primitive.NewObjectID()
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	stored := *category
+	stored.Children = nil
+	m.categories[category.ID.Hex()] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) GetCategories(ctx context.Context) ([]models.ServiceCategory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	categories := make([]models.ServiceCategory, 0, len(m.categories))
+	for _, category := range m.categories {
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].SortOrder != categories[j].SortOrder {
+			return categories[i].SortOrder < categories[j].SortOrder
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+func (m *MemoryDatabase) GetCategoryByID(ctx context.Context, id primitive.ObjectID) (*models.ServiceCategory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	category, exists := m.categories[id.Hex()]
+	if !exists {
+		return nil, ErrCategoryNotFound
+	}
+	out := *category
+	return &out, nil
+}
+
+func (m *MemoryDatabase) GetCategoryBySlug(ctx context.Context, slug string) (*models.ServiceCategory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, category := range m.categories {
+		if category.Slug == slug {
+			out := *category
+			return &out, nil
+		}
+	}
+	return nil, ErrCategoryNotFound
+}
+
+func (m *MemoryDatabase) UpdateCategory(ctx context.Context, category *models.ServiceCategory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.categories[category.ID.Hex()]
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	if m.categorySlugTaken(category.Slug, category.ID) {
+		return ErrDuplicateCategory
+	}
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+
+	stored := *category
+	stored.Children = nil
+	m.categories[category.ID.Hex()] = &stored
+	return nil
+}
+
+// categorySlugTaken reports whether a category other than except uses slug; callers hold m.mu
+func (m *MemoryDatabase) categorySlugTaken(slug string, except primitive.ObjectID) bool {
+	for _, category := range m.categories {
+		if category.Slug == slug && category.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
 // Service operations
 func (m *MemoryDatabase) CreateService(ctx context.Context, service *models.Service) error {
 	m.mu.Lock()
@@ -206,6 +334,7 @@ func (m *MemoryDatabase) CreateService(ctx context.Context, service *models.Serv
 	service.UpdatedAt = time.Now()
 	service.LastSyncAt = time.Now()
 	service.Version = 1
+	service.Geo = service.Location.GeoPoint()
 
 	m.services[service.ID.Hex()] = service
 	return nil
@@ -225,17 +354,214 @@ func (m *MemoryDatabase) GetServices(ctx context.Context, categoryID *primitive.
 			continue
 		}
 
+		if location != nil && radius > 0 {
+			near := location.GeoPoint()
+			if near == nil || service.Geo == nil || HaversineKm(near, service.Geo) > radius {
+				continue
+			}
+		}
+
 		services = append(services, *service)
 	}
 
 	return services, nil
 }
 
+// SearchServices mirrors the Mongo $geoNear search: services without a location
+// are left out of location searches and distances are measured with haversine
+func (m *MemoryDatabase) SearchServices(ctx context.Context, q ServiceSearch) ([]ServiceSearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []ServiceSearchResult{}
+	for _, service := range m.services {
+		if !q.matches(service) {
+			continue
+		}
+		result := ServiceSearchResult{Service: *service}
+		if q.Near != nil {
+			if service.Geo == nil {
+				continue
+			}
+			distance := HaversineKm(q.Near, service.Geo)
+			if q.RadiusKm > 0 && distance > q.RadiusKm {
+				continue
+			}
+			result.DistanceKm = &distance
+		}
+		results = append(results, result)
+	}
+
+	providers := map[primitive.ObjectID]*models.ServiceProvider{}
+	for _, p := range m.serviceProviders {
+		copied := *p
+		providers[p.UserID] = &copied
+	}
+	results = q.matchText(results, providers)
+
+	completed := map[primitive.ObjectID]int{}
+	for _, booking := range m.bookings {
+		if booking.Status == models.BookingCompleted {
+			completed[booking.ProviderID]++
+		}
+	}
+	for i := range results {
+		results[i].CompletedJobs = completed[results[i].Service.ProviderID]
+	}
+
+	return rankServiceResults(results, q), nil
+}
+
+// Provider profile operations
+func (m *MemoryDatabase) UpsertServiceProvider(ctx context.Context, provider *models.ServiceProvider) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.serviceProviders[provider.UserID.Hex()]; ok {
+		provider.ID = existing.ID
+		provider.CreatedAt = existing.CreatedAt
+		provider.Version = existing.Version + 1
+	} else {
+		provider.ID = primitive.NewObjectID()
+		provider.CreatedAt = now
+		provider.Version = 1
+	}
+	provider.UpdatedAt = now
+	provider.LastSyncAt = now
+
+	stored := *provider
+	m.serviceProviders[provider.UserID.Hex()] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) GetServiceProviderByUserID(ctx context.Context, userID primitive.ObjectID) (*models.ServiceProvider, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	provider, exists := m.serviceProviders[userID.Hex()]
+	if !exists {
+		return nil, ErrServiceProviderNotFound
+	}
+	out := *provider
+	return &out, nil
+}
+
+func (m *MemoryDatabase) UpsertProviderAvailability(ctx context.Context, availability *models.ProviderAvailability) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.availability[availability.ProviderID.Hex()]; ok {
+		availability.ID = existing.ID
+		availability.CreatedAt = existing.CreatedAt
+		availability.Version = existing.Version + 1
+	} else {
+		availability.ID = primitive.NewObjectID()
+		availability.CreatedAt = now
+		availability.Version = 1
+	}
+	availability.UpdatedAt = now
+
+	stored := *availability
+	stored.WeeklyHours = append([]models.WorkingHours(nil), availability.WeeklyHours...)
+	stored.TimeOff = append([]models.TimeOff(nil), availability.TimeOff...)
+	m.availability[availability.ProviderID.Hex()] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) GetProviderAvailability(ctx context.Context, providerID primitive.ObjectID) (*models.ProviderAvailability, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	availability, exists := m.availability[providerID.Hex()]
+	if !exists {
+		return nil, ErrAvailabilityNotFound
+	}
+	out := *availability
+	out.WeeklyHours = append([]models.WorkingHours(nil), availability.WeeklyHours...)
+	out.TimeOff = append([]models.TimeOff(nil), availability.TimeOff...)
+	return &out, nil
+}
+
+func (m *MemoryDatabase) GetServiceByID(ctx context.Context, id primitive.ObjectID) (*models.Service, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	service, exists := m.services[id.Hex()]
+	if !exists {
+		return nil, errors.New("service not found")
+	}
+
+	// Return a copy so callers cannot mutate stored state outside UpdateService
+	out := *service
+	return &out, nil
+}
+
+func (m *MemoryDatabase) GetProviderServices(ctx context.Context, providerID primitive.ObjectID) ([]models.Service, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var services []models.Service
+	for _, service := range m.services {
+		if service.ProviderID == providerID {
+			services = append(services, *service)
+		}
+	}
+
+	return services, nil
+}
+
+func (m *MemoryDatabase) UpdateService(ctx context.Context, service *models.Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.services[service.ID.Hex()]
+	if !exists {
+		return errors.New("service not found")
+	}
+	if existing.Version != service.Version {
+		return ErrVersionConflict
+	}
+
+	service.CreatedAt = existing.CreatedAt
+	service.UpdatedAt = time.Now()
+	service.LastSyncAt = time.Now()
+	service.Version++
+	service.Geo = service.Location.GeoPoint()
+
+	stored := *service
+	m.services[service.ID.Hex()] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) DeleteService(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	service, exists := m.services[id.Hex()]
+	if !exists {
+		return errors.New("service not found")
+	}
+
+	service.IsActive = false
+	service.UpdatedAt = time.Now()
+	service.LastSyncAt = time.Now()
+	service.Version++
+
+	return nil
+}
+
 // Booking operations
 func (m *MemoryDatabase) CreateBooking(ctx context.Context, booking *models.Booking) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	booking.SlotHeld = booking.Status.HoldsSlot()
+	if booking.SlotHeld && m.slotTaken(booking.ProviderID, booking.ScheduledDate, primitive.NilObjectID) {
+		return ErrSlotTaken
+	}
+
 	booking.ID = primitive.NewObjectID()
 	booking.CreatedAt = time.Now()
 	booking.UpdatedAt = time.Now()
@@ -266,6 +592,54 @@ func (m *MemoryDatabase) GetUserBookings(ctx context.Context, userID primitive.O
 	return bookings, nil
 }
 
+func (m *MemoryDatabase) GetProviderBookings(ctx context.Context, providerID primitive.ObjectID) ([]models.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bookings []models.Booking
+	for _, booking := range m.bookings {
+		if booking.ProviderID == providerID {
+			bookings = append(bookings, *booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+func (m *MemoryDatabase) GetProviderSchedule(ctx context.Context, providerID primitive.ObjectID, from, to time.Time) ([]models.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bookings []models.Booking
+	for _, booking := range m.bookings {
+		if booking.ProviderID != providerID || booking.ScheduledDate.Before(from) || !booking.ScheduledDate.Before(to) {
+			continue
+		}
+		if booking.Status == models.BookingPending && stalePending(booking) {
+			continue
+		}
+		switch booking.Status {
+		case models.BookingPending, models.BookingConfirmed, models.BookingInProgress:
+			bookings = append(bookings, *booking)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].ScheduledDate.Before(bookings[j].ScheduledDate) })
+	return bookings, nil
+}
+
+func (m *MemoryDatabase) GetBookingByID(ctx context.Context, bookingID primitive.ObjectID) (*models.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	booking, exists := m.bookings[bookingID.Hex()]
+	if !exists {
+		return nil, errors.New("booking not found")
+	}
+
+	out := *booking
+	return &out, nil
+}
+
 func (m *MemoryDatabase) UpdateBookingStatus(ctx context.Context, bookingID primitive.ObjectID, status models.BookingStatus) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -275,14 +649,67 @@ func (m *MemoryDatabase) UpdateBookingStatus(ctx context.Context, bookingID prim
 		return errors.New("booking not found")
 	}
 
-	booking.Status = status
-	booking.UpdatedAt = time.Now()
-	booking.LastSyncAt = time.Now()
-	booking.Version++
+	if status.HoldsSlot() && !booking.SlotHeld && m.slotTaken(booking.ProviderID, booking.ScheduledDate, booking.ID) {
+		return ErrSlotTaken
+	}
+	setBookingStatus(booking, status)
+	return nil
+}
 
+func (m *MemoryDatabase) TransitionBookingStatus(ctx context.Context, bookingID primitive.ObjectID, from, to models.BookingStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	booking, exists := m.bookings[bookingID.Hex()]
+	if !exists {
+		return errors.New("booking not found")
+	}
+	if booking.Status != from {
+		return ErrVersionConflict
+	}
+	if to.HoldsSlot() && !booking.SlotHeld && m.slotTaken(booking.ProviderID, booking.ScheduledDate, booking.ID) {
+		return ErrSlotTaken
+	}
+
+	setBookingStatus(booking, to)
 	return nil
 }
 
+// slotTaken reports whether a booking other than except holds the provider's
+// start time, mirroring the unique slot index of the MongoDB repository.
+// Pending bookings past PendingSlotHold give the slot up. Callers must hold m.mu.
+func (m *MemoryDatabase) slotTaken(providerID primitive.ObjectID, start time.Time, except primitive.ObjectID) bool {
+	taken := false
+	for _, booking := range m.bookings {
+		if !booking.SlotHeld || booking.ID == except || booking.ProviderID != providerID || !booking.ScheduledDate.Equal(start) {
+			continue
+		}
+		if booking.Status == models.BookingPending && stalePending(booking) {
+			booking.SlotHeld = false
+			continue
+		}
+		taken = true
+	}
+	return taken
+}
+
+// stalePending reports whether a pending booking has outlived PendingSlotHold
+func stalePending(booking *models.Booking) bool {
+	return booking.CreatedAt.Before(time.Now().Add(-PendingSlotHold))
+}
+
+func setBookingStatus(booking *models.Booking, status models.BookingStatus) {
+	now := time.Now()
+	booking.Status = status
+	booking.SlotHeld = status.HoldsSlot()
+	if status == models.BookingCompleted {
+		booking.CompletedDate = &now
+	}
+	booking.UpdatedAt = now
+	booking.LastSyncAt = now
+	booking.Version++
+}
+
 // Wallet operations
 func (m *MemoryDatabase) UpdateWallet(ctx context.Context, userID primitive.ObjectID, transaction *models.Transaction) error {
 	m.mu.Lock()
@@ -303,6 +730,186 @@ func (m *MemoryDatabase) UpdateWallet(ctx context.Context, userID primitive.Obje
 	return nil
 }
 
+// Double-entry ledger operations
+func (m *MemoryDatabase) AppendLedgerTransaction(ctx context.Context, tx *models.LedgerTransaction) error {
+	if err := tx.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tx.IdempotencyKey != "" {
+		if m.ledgerKeys[tx.IdempotencyKey] {
+			return ErrDuplicateLedgerTransaction
+		}
+		m.ledgerKeys[tx.IdempotencyKey] = true
+	}
+	tx.ID = primitive.NewObjectID()
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now()
+	}
+
+	stored := *tx
+	stored.Postings = append([]models.LedgerPosting(nil), tx.Postings...)
+	m.ledger = append(m.ledger, stored)
+	return nil
+}
+
+func (m *MemoryDatabase) WithWalletLock(ctx context.Context, userID primitive.ObjectID, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	lock, ok := m.walletLocks[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.walletLocks[userID] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	return fn(ctx)
+}
+
+func (m *MemoryDatabase) GetLedgerCurrencyBalances(ctx context.Context, accounts []string) (map[string]map[string]float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balances := make(map[string]map[string]float64, len(accounts))
+	for _, account := range accounts {
+		balances[account] = map[string]float64{}
+	}
+	for _, tx := range m.ledger {
+		for _, p := range tx.Postings {
+			byCurrency, wanted := balances[p.Account]
+			if !wanted {
+				continue
+			}
+			if p.Direction == models.LedgerCredit {
+				byCurrency[p.Currency] += p.Amount
+			} else {
+				byCurrency[p.Currency] -= p.Amount
+			}
+		}
+	}
+	return balances, nil
+}
+
+func (m *MemoryDatabase) GetUserLedgerTransactions(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []models.LedgerTransaction
+	for i := len(m.ledger) - 1; i >= 0; i-- {
+		tx := m.ledger[i]
+		for _, p := range tx.Postings {
+			if p.UserID == userID {
+				tx.Postings = append([]models.LedgerPosting(nil), tx.Postings...)
+				out = append(out, tx)
+				break
+			}
+		}
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryDatabase) ListUserLedgerTransactions(ctx context.Context, q LedgerQuery) ([]models.LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []models.LedgerTransaction
+	for _, tx := range m.ledger {
+		if !ledgerTransactionMatches(&tx, q) {
+			continue
+		}
+		tx.Postings = append([]models.LedgerPosting(nil), tx.Postings...)
+		out = append(out, tx)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID.Hex() > out[j].ID.Hex()
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func ledgerTransactionMatches(tx *models.LedgerTransaction, q LedgerQuery) bool {
+	if (!q.From.IsZero() && tx.CreatedAt.Before(q.From)) || (!q.To.IsZero() && !tx.CreatedAt.Before(q.To)) {
+		return false
+	}
+	if !q.Before.After(tx.CreatedAt, tx.ID) {
+		return false
+	}
+	if len(q.Types) > 0 {
+		found := false
+		for _, t := range q.Types {
+			found = found || t == tx.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, p := range tx.Postings {
+		if p.UserID == q.UserID && (q.Currency == "" || p.Currency == q.Currency) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryDatabase) GetLedgerCurrencyBalancesBefore(ctx context.Context, accounts []string, at time.Time) (map[string]map[string]float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balances := make(map[string]map[string]float64, len(accounts))
+	for _, account := range accounts {
+		balances[account] = map[string]float64{}
+	}
+	for _, tx := range m.ledger {
+		if !tx.CreatedAt.Before(at) {
+			continue
+		}
+		for _, p := range tx.Postings {
+			byCurrency, wanted := balances[p.Account]
+			if !wanted {
+				continue
+			}
+			if p.Direction == models.LedgerCredit {
+				byCurrency[p.Currency] += p.Amount
+			} else {
+				byCurrency[p.Currency] -= p.Amount
+			}
+		}
+	}
+	return balances, nil
+}
+
+func (m *MemoryDatabase) GetUserLedgerTransactionsBetween(ctx context.Context, userID primitive.ObjectID, from, to time.Time) ([]models.LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []models.LedgerTransaction
+	for _, tx := range m.ledger {
+		if tx.CreatedAt.Before(from) || !tx.CreatedAt.Before(to) {
+			continue
+		}
+		for _, p := range tx.Postings {
+			if p.UserID == userID {
+				tx.Postings = append([]models.LedgerPosting(nil), tx.Postings...)
+				out = append(out, tx)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
 // Offline-first sync operations
 func (m *MemoryDatabase) GetUnsyncedData(ctx context.Context, userID primitive.ObjectID, lastSyncAt time.Time) (map[string]interface{}, error) {
 	m.mu.RLock()
@@ -2,7 +2,9 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/smorting/backend/internal/models"
@@ -76,6 +78,21 @@ func (r *MongoDBRepository) GetUserByEmail(ctx context.Context, email string) (*
 	return &user, nil
 }
 
+func (r *MongoDBRepository) GetUserByPhone(ctx context.Context, phone string) (*models.User, error) {
+	collection := r.db.Collection("users")
+
+	var user models.User
+	err := collection.FindOne(ctx, bson.M{"phone": phone}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
 func (r *MongoDBRepository) GetUserByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
 	collection := r.db.Collection("users")
 
@@ -105,6 +122,21 @@ func (r *MongoDBRepository) UpdateUser(ctx context.Context, user *models.User) e
 	return nil
 }
 
+func (r *MongoDBRepository) GetUsersByRole(ctx context.Context, role models.UserRole) ([]models.User, error) {
+	collection := r.db.Collection("users")
+	cursor, err := collection.Find(ctx, bson.M{"role": role})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %w", err)
+	}
+	return users, nil
+}
+
 // OTP operations with TTL index support
 func (r *MongoDBRepository) CreateOTP(ctx context.Context, otp *models.OTPRecord) error {
 	otp.ID = primitive.NewObjectID()
@@ -170,6 +202,85 @@ func (r *MongoDBRepository) GetLatestOTPByEmail(ctx context.Context, email strin
 	return &otp, nil
 }
 
+// Category operations
+func (r *MongoDBRepository) CreateCategory(ctx context.Context, category *models.ServiceCategory) error {
+	category.ID = primitive.NewObjectID()
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	_, err := r.db.Collection("categories").InsertOne(ctx, category)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateCategory
+		}
+		return fmt.Errorf("failed to create category: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoDBRepository) GetCategories(ctx context.Context) ([]models.ServiceCategory, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := r.db.Collection("categories").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	categories := []models.ServiceCategory{}
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, fmt.Errorf("failed to decode categories: %w", err)
+	}
+	return categories, nil
+}
+
+func (r *MongoDBRepository) GetCategoryByID(ctx context.Context, id primitive.ObjectID) (*models.ServiceCategory, error) {
+	return r.findCategory(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoDBRepository) GetCategoryBySlug(ctx context.Context, slug string) (*models.ServiceCategory, error) {
+	return r.findCategory(ctx, bson.M{"slug": slug})
+}
+
+func (r *MongoDBRepository) findCategory(ctx context.Context, filter bson.M) (*models.ServiceCategory, error) {
+	var category models.ServiceCategory
+	err := r.db.Collection("categories").FindOne(ctx, filter).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+	return &category, nil
+}
+
+func (r *MongoDBRepository) UpdateCategory(ctx context.Context, category *models.ServiceCategory) error {
+	category.UpdatedAt = time.Now()
+	result, err := r.db.Collection("categories").UpdateOne(ctx,
+		bson.M{"_id": category.ID},
+		bson.M{"$set": bson.M{
+			"name":        category.Name,
+			"slug":        category.Slug,
+			"description": category.Description,
+			"parent_id":   category.ParentID,
+			"icon":        category.Icon,
+			"color":       category.Color,
+			"sort_order":  category.SortOrder,
+			"is_active":   category.IsActive,
+			"updated_at":  category.UpdatedAt,
+		}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateCategory
+		}
+		return fmt.Errorf("failed to update category: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
 // Service operations with embedded documents
 func (r *MongoDBRepository) CreateService(ctx context.Context, service *models.Service) error {
 	service.ID = primitive.NewObjectID()
@@ -177,6 +288,7 @@ func (r *MongoDBRepository) CreateService(ctx context.Context, service *models.S
 	service.UpdatedAt = time.Now()
 	service.LastSyncAt = time.Now()
 	service.Version = 1
+	service.Geo = service.Location.GeoPoint()
 
 	collection := r.db.Collection("services")
 	_, err := collection.InsertOne(ctx, service)
@@ -197,16 +309,19 @@ func (r *MongoDBRepository) GetServices(ctx context.Context, categoryID *primiti
 	}
 
 	if location != nil && radius > 0 {
-		// Geospatial query for nearby services
-		filter["location"] = bson.M{
+		near := models.NewGeoPoint(location.Latitude, location.Longitude)
+		if near == nil {
+			return nil, fmt.Errorf("location %v,%v is out of range", location.Latitude, location.Longitude)
+		}
+		// Geospatial query for nearby services; the geo.type match lets it use the
+		// partial 2dsphere index, which only covers points
+		filter["geo"] = bson.M{
 			"$near": bson.M{
-				"$geometry": bson.M{
-					"type":        "Point",
-					"coordinates": []float64{location.Longitude, location.Latitude},
-				},
+				"$geometry":    near,
 				"$maxDistance": radius * 1000, // Convert km to meters
 			},
 		}
+		filter["geo.type"] = "Point"
 	}
 
 	cursor, err := collection.Find(ctx, filter)
@@ -223,8 +338,356 @@ func (r *MongoDBRepository) GetServices(ctx context.Context, categoryID *primiti
 	return services, nil
 }
 
+// SearchServices runs a $geoNear aggregation when the search has a location;
+// distances and completed jobs are then ranked by rankServiceResults. Text
+// searches are first narrowed in Mongo to services whose name, description or
+// provider profile has a word starting like a search term, and at most
+// maxSearchCandidates services are loaded for fuzzy matching.
+func (r *MongoDBRepository) SearchServices(ctx context.Context, q ServiceSearch) ([]ServiceSearchResult, error) {
+	filter := bson.M{"is_active": true}
+	if q.CategoryID != nil {
+		filter["category_id"] = *q.CategoryID
+	}
+	price := bson.M{}
+	if q.MinPrice > 0 {
+		price["$gte"] = q.MinPrice
+	}
+	if q.MaxPrice > 0 {
+		price["$lte"] = q.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+	if q.MinRating > 0 {
+		filter["rating"] = bson.M{"$gte": q.MinRating}
+	}
+	if pattern := parseTextQuery(q.Text).prefilterPattern(); pattern != "" {
+		re := primitive.Regex{Pattern: pattern, Options: "i"}
+		anyOf := bson.A{bson.M{"name": re}, bson.M{"description": re}}
+		owners, err := r.providerUserIDsMatching(ctx, re)
+		if err != nil {
+			return nil, err
+		}
+		if len(owners) > 0 {
+			anyOf = append(anyOf, bson.M{"provider_id": bson.M{"$in": owners}})
+		}
+		filter["$or"] = anyOf
+	}
+
+	var pipeline mongo.Pipeline
+	if q.Near != nil {
+		// The 2dsphere index is partial on geo.type, so the query must match it too
+		filter["geo.type"] = "Point"
+		geoNear := bson.M{
+			"near":          q.Near,
+			"key":           "geo",
+			"distanceField": "distance_m",
+			"spherical":     true,
+			"query":         filter,
+		}
+		if q.RadiusKm > 0 {
+			geoNear["maxDistance"] = q.RadiusKm * 1000
+		}
+		pipeline = mongo.Pipeline{{{Key: "$geoNear", Value: geoNear}}}
+	} else {
+		pipeline = mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$sort", Value: bson.D{{Key: "rating", Value: -1}, {Key: "_id", Value: 1}}}},
+		}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: maxSearchCandidates}})
+
+	cursor, err := r.db.Collection("services").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search services: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		models.Service `bson:",inline"`
+		DistanceM      float64 `bson:"distance_m"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode services: %w", err)
+	}
+
+	results := make([]ServiceSearchResult, 0, len(rows))
+	providers := map[primitive.ObjectID]bool{}
+	for _, row := range rows {
+		result := ServiceSearchResult{Service: row.Service}
+		if q.Near != nil {
+			distance := row.DistanceM / 1000
+			result.DistanceKm = &distance
+		}
+		results = append(results, result)
+		providers[row.ProviderID] = true
+	}
+
+	profiles, err := r.serviceProvidersByUserID(ctx, providers)
+	if err != nil {
+		return nil, err
+	}
+	results = q.matchText(results, profiles)
+
+	completed, err := r.completedJobs(ctx, providers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].CompletedJobs = completed[results[i].Service.ProviderID]
+	}
+
+	return rankServiceResults(results, q), nil
+}
+
+// providerUserIDsMatching returns the user IDs of providers whose business name
+// or service areas match re
+func (r *MongoDBRepository) providerUserIDsMatching(ctx context.Context, re primitive.Regex) ([]primitive.ObjectID, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"business_name": re}, bson.M{"service_areas": re}}}
+	opts := options.Find().SetProjection(bson.M{"user_id": 1}).SetLimit(maxSearchCandidates)
+	cursor, err := r.db.Collection("service_providers").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match service providers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode service providers: %w", err)
+	}
+	ids := make([]primitive.ObjectID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.UserID)
+	}
+	return ids, nil
+}
+
+// serviceProvidersByUserID loads the profiles of the given provider user IDs
+func (r *MongoDBRepository) serviceProvidersByUserID(ctx context.Context, providers map[primitive.ObjectID]bool) (map[primitive.ObjectID]*models.ServiceProvider, error) {
+	profiles := map[primitive.ObjectID]*models.ServiceProvider{}
+	if len(providers) == 0 {
+		return profiles, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(providers))
+	for id := range providers {
+		ids = append(ids, id)
+	}
+
+	cursor, err := r.db.Collection("service_providers").Find(ctx, bson.M{"user_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service providers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var list []models.ServiceProvider
+	if err = cursor.All(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode service providers: %w", err)
+	}
+	for i := range list {
+		profiles[list[i].UserID] = &list[i]
+	}
+	return profiles, nil
+}
+
+// completedJobs counts each provider's completed bookings
+func (r *MongoDBRepository) completedJobs(ctx context.Context, providers map[primitive.ObjectID]bool) (map[primitive.ObjectID]int, error) {
+	counts := map[primitive.ObjectID]int{}
+	if len(providers) == 0 {
+		return counts, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(providers))
+	for id := range providers {
+		ids = append(ids, id)
+	}
+
+	cursor, err := r.db.Collection("bookings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"provider_id": bson.M{"$in": ids}, "status": models.BookingCompleted}}},
+		{{Key: "$group", Value: bson.M{"_id": "$provider_id", "jobs": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count completed jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ProviderID primitive.ObjectID `bson:"_id"`
+		Jobs       int                `bson:"jobs"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode completed jobs: %w", err)
+	}
+	for _, row := range rows {
+		counts[row.ProviderID] = row.Jobs
+	}
+	return counts, nil
+}
+
+// Provider profile operations
+func (r *MongoDBRepository) UpsertServiceProvider(ctx context.Context, provider *models.ServiceProvider) error {
+	collection := r.db.Collection("service_providers")
+	now := time.Now()
+	provider.UpdatedAt = now
+	provider.LastSyncAt = now
+
+	existing, err := r.GetServiceProviderByUserID(ctx, provider.UserID)
+	switch {
+	case err == nil:
+		provider.ID = existing.ID
+		provider.CreatedAt = existing.CreatedAt
+		provider.Version = existing.Version + 1
+	case errors.Is(err, ErrServiceProviderNotFound):
+		provider.ID = primitive.NewObjectID()
+		provider.CreatedAt = now
+		provider.Version = 1
+	default:
+		return err
+	}
+
+	_, err = collection.ReplaceOne(ctx, bson.M{"user_id": provider.UserID}, provider, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save service provider: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoDBRepository) GetServiceProviderByUserID(ctx context.Context, userID primitive.ObjectID) (*models.ServiceProvider, error) {
+	var provider models.ServiceProvider
+	err := r.db.Collection("service_providers").FindOne(ctx, bson.M{"user_id": userID}).Decode(&provider)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrServiceProviderNotFound
+		}
+		return nil, fmt.Errorf("failed to get service provider: %w", err)
+	}
+	return &provider, nil
+}
+
+func (r *MongoDBRepository) UpsertProviderAvailability(ctx context.Context, availability *models.ProviderAvailability) error {
+	collection := r.db.Collection("provider_availability")
+	now := time.Now()
+	availability.UpdatedAt = now
+
+	existing, err := r.GetProviderAvailability(ctx, availability.ProviderID)
+	switch {
+	case err == nil:
+		availability.ID = existing.ID
+		availability.CreatedAt = existing.CreatedAt
+		availability.Version = existing.Version + 1
+	case errors.Is(err, ErrAvailabilityNotFound):
+		availability.ID = primitive.NewObjectID()
+		availability.CreatedAt = now
+		availability.Version = 1
+	default:
+		return err
+	}
+
+	_, err = collection.ReplaceOne(ctx, bson.M{"provider_id": availability.ProviderID}, availability, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save provider availability: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoDBRepository) GetProviderAvailability(ctx context.Context, providerID primitive.ObjectID) (*models.ProviderAvailability, error) {
+	var availability models.ProviderAvailability
+	err := r.db.Collection("provider_availability").FindOne(ctx, bson.M{"provider_id": providerID}).Decode(&availability)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAvailabilityNotFound
+		}
+		return nil, fmt.Errorf("failed to get provider availability: %w", err)
+	}
+	return &availability, nil
+}
+
+func (r *MongoDBRepository) GetServiceByID(ctx context.Context, id primitive.ObjectID) (*models.Service, error) {
+	collection := r.db.Collection("services")
+
+	var service models.Service
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&service)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("service not found")
+		}
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	return &service, nil
+}
+
+func (r *MongoDBRepository) GetProviderServices(ctx context.Context, providerID primitive.ObjectID) ([]models.Service, error) {
+	collection := r.db.Collection("services")
+
+	cursor, err := collection.Find(ctx, bson.M{"provider_id": providerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider services: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var services []models.Service
+	if err = cursor.All(ctx, &services); err != nil {
+		return nil, fmt.Errorf("failed to decode services: %w", err)
+	}
+
+	return services, nil
+}
+
+func (r *MongoDBRepository) UpdateService(ctx context.Context, service *models.Service) error {
+	expectedVersion := service.Version
+	service.UpdatedAt = time.Now()
+	service.LastSyncAt = time.Now()
+	service.Version = expectedVersion + 1
+	service.Geo = service.Location.GeoPoint()
+
+	collection := r.db.Collection("services")
+	result, err := collection.ReplaceOne(ctx, bson.M{"_id": service.ID, "version": expectedVersion}, service)
+	if err != nil {
+		service.Version = expectedVersion
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		service.Version = expectedVersion
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+func (r *MongoDBRepository) DeleteService(ctx context.Context, id primitive.ObjectID) error {
+	collection := r.db.Collection("services")
+	result, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{
+				"is_active":    false,
+				"updated_at":   time.Now(),
+				"last_sync_at": time.Now(),
+			},
+			"$inc": bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("service not found")
+	}
+
+	return nil
+}
+
 // Booking operations with embedded documents
+// oneBookingPerSlot is the unique index that lets only one booking hold a
+// provider's start time, whichever instance inserts it
+const oneBookingPerSlot = "one_booking_per_slot"
+
+// CreateBooking inserts the booking and returns ErrSlotTaken when another
+// active booking already holds the provider's start time
 func (r *MongoDBRepository) CreateBooking(ctx context.Context, booking *models.Booking) error {
+	booking.SlotHeld = booking.Status.HoldsSlot()
 	booking.ID = primitive.NewObjectID()
 	booking.CreatedAt = time.Now()
 	booking.UpdatedAt = time.Now()
@@ -261,6 +724,17 @@ func (r *MongoDBRepository) CreateBooking(ctx context.Context, booking *models.B
 		return nil, nil
 	})
 
+	if err != nil && isSlotTaken(err) {
+		// The holder may be a pending booking past its hold; release it and try once more
+		released, releaseErr := r.releaseStaleSlot(ctx, booking.ProviderID, booking.ScheduledDate)
+		if releaseErr != nil {
+			return releaseErr
+		}
+		if !released {
+			return ErrSlotTaken
+		}
+		return r.CreateBooking(ctx, booking)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create booking: %w", err)
 	}
@@ -268,6 +742,26 @@ func (r *MongoDBRepository) CreateBooking(ctx context.Context, booking *models.B
 	return nil
 }
 
+// releaseStaleSlot frees the provider's start time from pending bookings that
+// were never confirmed within PendingSlotHold. The bookings stay pending, but
+// confirming one later needs the slot to be free again.
+func (r *MongoDBRepository) releaseStaleSlot(ctx context.Context, providerID primitive.ObjectID, start time.Time) (bool, error) {
+	result, err := r.db.Collection("bookings").UpdateMany(ctx,
+		bson.M{
+			"provider_id":    providerID,
+			"scheduled_date": start,
+			"status":         models.BookingPending,
+			"slot_held":      true,
+			"created_at":     bson.M{"$lt": time.Now().Add(-PendingSlotHold)},
+		},
+		bson.M{"$unset": bson.M{"slot_held": ""}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to release booking slot: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
 func (r *MongoDBRepository) GetUserBookings(ctx context.Context, userID primitive.ObjectID) ([]models.Booking, error) {
 	collection := r.db.Collection("bookings")
 
@@ -285,27 +779,116 @@ func (r *MongoDBRepository) GetUserBookings(ctx context.Context, userID primitiv
 	return bookings, nil
 }
 
-func (r *MongoDBRepository) UpdateBookingStatus(ctx context.Context, bookingID primitive.ObjectID, status models.BookingStatus) error {
+func (r *MongoDBRepository) GetProviderBookings(ctx context.Context, providerID primitive.ObjectID) ([]models.Booking, error) {
 	collection := r.db.Collection("bookings")
-	_, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": bookingID},
-		bson.M{
-			"$set": bson.M{
-				"status":       status,
-				"updated_at":   time.Now(),
-				"last_sync_at": time.Now(),
-			},
-			"$inc": bson.M{"version": 1},
+
+	cursor, err := collection.Find(ctx, bson.M{"provider_id": providerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider bookings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bookings []models.Booking
+	if err = cursor.All(ctx, &bookings); err != nil {
+		return nil, fmt.Errorf("failed to decode bookings: %w", err)
+	}
+
+	return bookings, nil
+}
+
+func (r *MongoDBRepository) GetProviderSchedule(ctx context.Context, providerID primitive.ObjectID, from, to time.Time) ([]models.Booking, error) {
+	filter := bson.M{
+		"provider_id":    providerID,
+		"scheduled_date": bson.M{"$gte": from, "$lt": to},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": []models.BookingStatus{models.BookingConfirmed, models.BookingInProgress}}},
+			bson.M{"status": models.BookingPending, "created_at": bson.M{"$gte": time.Now().Add(-PendingSlotHold)}},
 		},
-	)
+	}
+	cursor, err := r.db.Collection("bookings").Find(ctx, filter, options.Find().SetSort(bson.M{"scheduled_date": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider schedule: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bookings []models.Booking
+	if err = cursor.All(ctx, &bookings); err != nil {
+		return nil, fmt.Errorf("failed to decode bookings: %w", err)
+	}
+	return bookings, nil
+}
+
+func (r *MongoDBRepository) GetBookingByID(ctx context.Context, bookingID primitive.ObjectID) (*models.Booking, error) {
+	collection := r.db.Collection("bookings")
+
+	var booking models.Booking
+	err := collection.FindOne(ctx, bson.M{"_id": bookingID}).Decode(&booking)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("booking not found")
+		}
+		return nil, fmt.Errorf("failed to get booking: %w", err)
+	}
+
+	return &booking, nil
+}
+
+func (r *MongoDBRepository) UpdateBookingStatus(ctx context.Context, bookingID primitive.ObjectID, status models.BookingStatus) error {
+	collection := r.db.Collection("bookings")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": bookingID}, bookingStatusUpdate(status))
 	if err != nil {
+		if isSlotTaken(err) {
+			return ErrSlotTaken
+		}
 		return fmt.Errorf("failed to update booking status: %w", err)
 	}
 
 	return nil
 }
 
+func (r *MongoDBRepository) TransitionBookingStatus(ctx context.Context, bookingID primitive.ObjectID, from, to models.BookingStatus) error {
+	collection := r.db.Collection("bookings")
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": bookingID, "status": from}, bookingStatusUpdate(to))
+	if err != nil {
+		if isSlotTaken(err) {
+			return ErrSlotTaken
+		}
+		return fmt.Errorf("failed to update booking status: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		if _, err := r.GetBookingByID(ctx, bookingID); err != nil {
+			return err
+		}
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+func bookingStatusUpdate(status models.BookingStatus) bson.M {
+	now := time.Now()
+	set := bson.M{
+		"status":       status,
+		"updated_at":   now,
+		"last_sync_at": now,
+	}
+	if status == models.BookingCompleted {
+		set["completed_date"] = now
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if status.HoldsSlot() {
+		set["slot_held"] = true
+	} else {
+		update["$unset"] = bson.M{"slot_held": ""}
+	}
+	return update
+}
+
+// isSlotTaken reports whether err is a collision on the one_booking_per_slot index
+func isSlotTaken(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), oneBookingPerSlot)
+}
+
 // Wallet operations
 func (r *MongoDBRepository) UpdateWallet(ctx context.Context, userID primitive.ObjectID, transaction *models.Transaction) error {
 	transaction.ID = primitive.NewObjectID()
@@ -328,6 +911,232 @@ func (r *MongoDBRepository) UpdateWallet(ctx context.Context, userID primitive.O
 	return nil
 }
 
+// Double-entry ledger operations. Each transaction is a single document with its
+// postings embedded, so a transaction is written atomically and never updated.
+func (r *MongoDBRepository) AppendLedgerTransaction(ctx context.Context, tx *models.LedgerTransaction) error {
+	if err := tx.Validate(); err != nil {
+		return err
+	}
+	tx.ID = primitive.NewObjectID()
+	if tx.CreatedAt.IsZero() {
+		tx.CreatedAt = time.Now()
+	}
+
+	collection := r.db.Collection("ledger_transactions")
+	if _, err := collection.InsertOne(ctx, tx); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateLedgerTransaction
+		}
+		return fmt.Errorf("failed to append ledger transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Wallet locks are wallet_locks documents leased to one caller at a time. The
+// holder renews the lease while fn runs; a lock left by a crashed instance is
+// taken over once its lease has run out.
+const (
+	walletLockLease = 30 * time.Second
+	walletLockPoll  = 25 * time.Millisecond
+)
+
+// WithWalletLock takes the user's wallet_locks document with a conditional
+// upsert, which needs no transaction and so works on a standalone server as
+// well as a replica set. fn runs exactly once while the lock is held and the
+// lock is released when it returns.
+func (r *MongoDBRepository) WithWalletLock(ctx context.Context, userID primitive.ObjectID, fn func(ctx context.Context) error) error {
+	locks := r.db.Collection("wallet_locks")
+	owner := primitive.NewObjectID()
+	for {
+		now := time.Now()
+		err := locks.FindOneAndUpdate(ctx,
+			bson.M{"_id": userID, "$or": bson.A{
+				bson.M{"expires_at": bson.M{"$lt": now}},
+				bson.M{"expires_at": bson.M{"$exists": false}},
+			}},
+			bson.M{"$set": bson.M{"owner": owner, "locked_at": now, "expires_at": now.Add(walletLockLease)}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Err()
+		if err == nil {
+			break
+		}
+		// Another holder's live lease makes the upsert collide on _id
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to lock wallet: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(walletLockPoll):
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(walletLockLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, _ = locks.UpdateOne(context.Background(),
+					bson.M{"_id": userID, "owner": owner},
+					bson.M{"$set": bson.M{"expires_at": time.Now().Add(walletLockLease)}})
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		if _, err := locks.DeleteOne(context.Background(), bson.M{"_id": userID, "owner": owner}); err != nil {
+			r.logger.Warn("Failed to release wallet lock; it will expire", zap.Error(err), zap.String("user_id", userID.Hex()))
+		}
+	}()
+	return fn(ctx)
+}
+
+func (r *MongoDBRepository) GetLedgerCurrencyBalances(ctx context.Context, accounts []string) (map[string]map[string]float64, error) {
+	return r.ledgerCurrencyBalances(ctx, accounts, nil)
+}
+
+// ledgerCurrencyBalances sums postings per account and currency, optionally only
+// those of transactions whose created_at matches createdAt
+func (r *MongoDBRepository) ledgerCurrencyBalances(ctx context.Context, accounts []string, createdAt bson.M) (map[string]map[string]float64, error) {
+	collection := r.db.Collection("ledger_transactions")
+
+	match := bson.M{"postings.account": bson.M{"$in": accounts}}
+	if createdAt != nil {
+		match["created_at"] = createdAt
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$match", Value: bson.M{"postings.account": bson.M{"$in": accounts}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"account": "$postings.account", "currency": "$postings.currency"},
+			"balance": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$postings.direction", models.LedgerCredit}},
+				"$postings.amount",
+				bson.M{"$multiply": bson.A{"$postings.amount", -1}},
+			}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate ledger balances: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			Account  string `bson:"account"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Balance float64 `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger balances: %w", err)
+	}
+
+	balances := make(map[string]map[string]float64, len(accounts))
+	for _, account := range accounts {
+		balances[account] = map[string]float64{}
+	}
+	for _, row := range rows {
+		balances[row.ID.Account][row.ID.Currency] = row.Balance
+	}
+	return balances, nil
+}
+
+func (r *MongoDBRepository) GetUserLedgerTransactions(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LedgerTransaction, error) {
+	collection := r.db.Collection("ledger_transactions")
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := collection.Find(ctx, bson.M{"postings.user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []models.LedgerTransaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger transactions: %w", err)
+	}
+	return txs, nil
+}
+
+func (r *MongoDBRepository) ListUserLedgerTransactions(ctx context.Context, q LedgerQuery) ([]models.LedgerTransaction, error) {
+	collection := r.db.Collection("ledger_transactions")
+
+	posting := bson.M{"user_id": q.UserID}
+	if q.Currency != "" {
+		posting["currency"] = q.Currency
+	}
+	filter := bson.M{"postings": bson.M{"$elemMatch": posting}}
+	if len(q.Types) > 0 {
+		filter["type"] = bson.M{"$in": q.Types}
+	}
+	created := bson.M{}
+	if !q.From.IsZero() {
+		created["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		created["$lt"] = q.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	if q.Before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": q.Before.CreatedAt}},
+			bson.M{"created_at": q.Before.CreatedAt, "_id": bson.M{"$lt": q.Before.ID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []models.LedgerTransaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger transactions: %w", err)
+	}
+	return txs, nil
+}
+
+func (r *MongoDBRepository) GetLedgerCurrencyBalancesBefore(ctx context.Context, accounts []string, at time.Time) (map[string]map[string]float64, error) {
+	return r.ledgerCurrencyBalances(ctx, accounts, bson.M{"$lt": at})
+}
+
+func (r *MongoDBRepository) GetUserLedgerTransactionsBetween(ctx context.Context, userID primitive.ObjectID, from, to time.Time) ([]models.LedgerTransaction, error) {
+	collection := r.db.Collection("ledger_transactions")
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{
+		"postings.user_id": userID,
+		"created_at":       bson.M{"$gte": from, "$lt": to},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []models.LedgerTransaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger transactions: %w", err)
+	}
+	return txs, nil
+}
+
 // Offline-first sync operations
 func (r *MongoDBRepository) GetUnsyncedData(ctx context.Context, userID primitive.ObjectID, lastSyncAt time.Time) (map[string]interface{}, error) {
 	// Get unsynced bookings
@@ -504,9 +1313,10 @@ func (r *MongoDBRepository) SetupIndexes(ctx context.Context) error {
 		Keys: bson.M{"provider_id": 1},
 	}
 
-	// Geospatial index for service location
+	// Geospatial index for service location; services without coordinates have no geo point
 	serviceLocationIndex := mongo.IndexModel{
-		Keys: bson.M{"location": "2dsphere"},
+		Keys:    bson.M{"geo": "2dsphere"},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"geo.type": "Point"}),
 	}
 
 	// Compound index for active services by category
@@ -521,6 +1331,36 @@ func (r *MongoDBRepository) SetupIndexes(ctx context.Context) error {
 		r.logger.Warn("Failed to create service indexes", zap.Error(err))
 	}
 
+	// Category slugs are unique
+	categoriesCollection := r.db.Collection("categories")
+	_, err = categoriesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"slug": 1},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		r.logger.Warn("Failed to create category indexes", zap.Error(err))
+	}
+
+	// One provider profile per user
+	providersCollection := r.db.Collection("service_providers")
+	_, err = providersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"user_id": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		r.logger.Warn("Failed to create service provider indexes", zap.Error(err))
+	}
+
+	// One calendar per provider
+	availabilityCollection := r.db.Collection("provider_availability")
+	_, err = availabilityCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"provider_id": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		r.logger.Warn("Failed to create provider availability indexes", zap.Error(err))
+	}
+
 	// Bookings collection indexes
 	bookingsCollection := r.db.Collection("bookings")
 
@@ -544,13 +1384,44 @@ func (r *MongoDBRepository) SetupIndexes(ctx context.Context) error {
 		Keys: bson.M{"customer_id": 1, "status": 1},
 	}
 
+	// Compound index for a provider's schedule
+	providerScheduleIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "provider_id", Value: 1}, {Key: "scheduled_date", Value: 1}},
+	}
+
 	_, err = bookingsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		customerIndex, providerBookingIndex, statusIndex, customerStatusIndex,
+		customerIndex, providerBookingIndex, statusIndex, customerStatusIndex, providerScheduleIndex,
 	})
 	if err != nil {
 		r.logger.Warn("Failed to create booking indexes", zap.Error(err))
 	}
 
+	// One active booking per provider and start time
+	_, err = bookingsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "provider_id", Value: 1}, {Key: "scheduled_date", Value: 1}, {Key: "slot_held", Value: 1}},
+		Options: options.Index().SetName(oneBookingPerSlot).SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slot_held": true}),
+	})
+	if err != nil {
+		r.logger.Warn("Failed to create booking slot index", zap.Error(err))
+	}
+
+	// Ledger transactions: idempotency and per-account / per-user lookups
+	ledgerCollection := r.db.Collection("ledger_transactions")
+	_, err = ledgerCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.M{"idempotency_key": 1},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.M{"postings.account": 1}},
+		{Keys: bson.D{{Key: "postings.user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.M{"reference": 1}},
+	})
+	if err != nil {
+		r.logger.Warn("Failed to create ledger indexes", zap.Error(err))
+	}
+
 	r.logger.Info("MongoDB indexes setup completed")
 	return nil
 }
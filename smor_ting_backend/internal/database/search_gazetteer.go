@@ -0,0 +1,127 @@
+package database
+
+import "github.com/smorting/backend/internal/models"
+
+// PlaceKind says whether a gazetteer place is a community or a whole county
+type PlaceKind string
+
+const (
+	PlaceCommunity PlaceKind = "community"
+	PlaceCounty    PlaceKind = "county"
+)
+
+// Place is a community or county the text search recognises by name. A
+// service is in a place when it lies within RadiusKm of Center, its address
+// names the place, or its provider lists the place as a service area.
+type Place struct {
+	Name     string
+	Kind     PlaceKind
+	County   string // the county a community belongs to
+	Center   *models.GeoPoint
+	RadiusKm float64
+	Aliases  []string
+}
+
+// gazetteer lists Greater Monrovia's communities, the main upcountry towns
+// and the fifteen counties. Centres and radii are approximate; they only need
+// to be good enough to turn "plumber Sinkor" into a geo filter.
+var gazetteer = []Place{
+	// Greater Monrovia
+	{Name: "Monrovia", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3006, -10.7969), RadiusKm: 15, Aliases: []string{"greater monrovia"}},
+	{Name: "Central Monrovia", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3106, -10.8047), RadiusKm: 2, Aliases: []string{"downtown", "broad street", "waterside", "snapper hill"}},
+	{Name: "Mamba Point", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3170, -10.8110), RadiusKm: 1},
+	{Name: "West Point", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3240, -10.8080), RadiusKm: 1},
+	{Name: "Sinkor", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2950, -10.7800), RadiusKm: 2.5, Aliases: []string{"sinkor old road"}},
+	{Name: "Fiamah", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2980, -10.7870), RadiusKm: 1},
+	{Name: "Lakpazee", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2985, -10.7720), RadiusKm: 1},
+	{Name: "Old Road", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2890, -10.7680), RadiusKm: 1.5},
+	{Name: "Congo Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2790, -10.7560), RadiusKm: 2, Aliases: []string{"congotown"}},
+	{Name: "Jacob Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2900, -10.7300), RadiusKm: 1.5, Aliases: []string{"jacobtown"}},
+	{Name: "Duport Road", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2750, -10.7280), RadiusKm: 2},
+	{Name: "Paynesville", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2817, -10.7153), RadiusKm: 5, Aliases: []string{"paynesville city"}},
+	{Name: "Red Light", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2930, -10.7090), RadiusKm: 1.5, Aliases: []string{"redlight"}},
+	{Name: "ELWA", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.2400, -10.7010), RadiusKm: 2, Aliases: []string{"elwa junction"}},
+	{Name: "Gardnersville", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3330, -10.7450), RadiusKm: 3},
+	{Name: "Barnersville", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3370, -10.7280), RadiusKm: 3},
+	{Name: "Johnsonville", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3520, -10.6600), RadiusKm: 3},
+	{Name: "Caldwell", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3600, -10.7560), RadiusKm: 3},
+	{Name: "Vai Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3300, -10.7960), RadiusKm: 1},
+	{Name: "Bushrod Island", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3530, -10.7850), RadiusKm: 3, Aliases: []string{"bushrod"}},
+	{Name: "Clara Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3420, -10.7900), RadiusKm: 1},
+	{Name: "Logan Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3610, -10.7880), RadiusKm: 1.5},
+	{Name: "Duala", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3570, -10.7800), RadiusKm: 1.5},
+	{Name: "New Kru Town", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.3720, -10.7930), RadiusKm: 2, Aliases: []string{"kru town"}},
+	{Name: "Virginia", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.4000, -10.8000), RadiusKm: 3},
+	{Name: "Brewerville", Kind: PlaceCommunity, County: "Montserrado", Center: models.NewGeoPoint(6.4180, -10.7750), RadiusKm: 4},
+
+	// Upcountry towns
+	{Name: "Kakata", Kind: PlaceCommunity, County: "Margibi", Center: models.NewGeoPoint(6.5300, -10.3530), RadiusKm: 5},
+	{Name: "Harbel", Kind: PlaceCommunity, County: "Margibi", Center: models.NewGeoPoint(6.2790, -10.3500), RadiusKm: 5},
+	{Name: "Buchanan", Kind: PlaceCommunity, County: "Grand Bassa", Center: models.NewGeoPoint(5.8808, -10.0467), RadiusKm: 6},
+	{Name: "Gbarnga", Kind: PlaceCommunity, County: "Bong", Center: models.NewGeoPoint(6.9956, -9.4722), RadiusKm: 6},
+	{Name: "Ganta", Kind: PlaceCommunity, County: "Nimba", Center: models.NewGeoPoint(7.2370, -8.9810), RadiusKm: 6},
+
+	// Counties
+	{Name: "Montserrado", Kind: PlaceCounty, County: "Montserrado", Center: models.NewGeoPoint(6.5500, -10.5500), RadiusKm: 35},
+	{Name: "Margibi", Kind: PlaceCounty, County: "Margibi", Center: models.NewGeoPoint(6.5200, -10.3000), RadiusKm: 35},
+	{Name: "Grand Bassa", Kind: PlaceCounty, County: "Grand Bassa", Center: models.NewGeoPoint(6.2300, -9.8100), RadiusKm: 60, Aliases: []string{"bassa"}},
+	{Name: "Bomi", Kind: PlaceCounty, County: "Bomi", Center: models.NewGeoPoint(6.7560, -10.8450), RadiusKm: 35},
+	{Name: "Bong", Kind: PlaceCounty, County: "Bong", Center: models.NewGeoPoint(6.8300, -9.3700), RadiusKm: 70},
+	{Name: "Gbarpolu", Kind: PlaceCounty, County: "Gbarpolu", Center: models.NewGeoPoint(7.4950, -10.0800), RadiusKm: 70},
+	{Name: "Grand Cape Mount", Kind: PlaceCounty, County: "Grand Cape Mount", Center: models.NewGeoPoint(7.0470, -11.0710), RadiusKm: 50, Aliases: []string{"cape mount"}},
+	{Name: "Grand Gedeh", Kind: PlaceCounty, County: "Grand Gedeh", Center: models.NewGeoPoint(5.9220, -8.2210), RadiusKm: 80},
+	{Name: "Grand Kru", Kind: PlaceCounty, County: "Grand Kru", Center: models.NewGeoPoint(4.7610, -8.2210), RadiusKm: 50},
+	{Name: "Lofa", Kind: PlaceCounty, County: "Lofa", Center: models.NewGeoPoint(8.1910, -9.7230), RadiusKm: 90},
+	{Name: "Maryland", Kind: PlaceCounty, County: "Maryland", Center: models.NewGeoPoint(4.7260, -7.7410), RadiusKm: 50},
+	{Name: "Nimba", Kind: PlaceCounty, County: "Nimba", Center: models.NewGeoPoint(7.6170, -8.5290), RadiusKm: 80},
+	{Name: "River Cess", Kind: PlaceCounty, County: "River Cess", Center: models.NewGeoPoint(5.9025, -9.4561), RadiusKm: 50, Aliases: []string{"rivercess"}},
+	{Name: "River Gee", Kind: PlaceCounty, County: "River Gee", Center: models.NewGeoPoint(5.2605, -7.8722), RadiusKm: 50},
+	{Name: "Sinoe", Kind: PlaceCounty, County: "Sinoe", Center: models.NewGeoPoint(5.4987, -8.6601), RadiusKm: 70},
+}
+
+// placeNames maps every normalised place name and alias to its gazetteer entry
+var placeNames = func() map[string]*Place {
+	names := map[string]*Place{}
+	for i := range gazetteer {
+		p := &gazetteer[i]
+		names[normalizePhrase(p.Name)] = p
+		for _, alias := range p.Aliases {
+			names[normalizePhrase(alias)] = p
+		}
+	}
+	return names
+}()
+
+// LookupPlace returns the gazetteer place called name, or nil
+func LookupPlace(name string) *Place {
+	return placeNames[normalizePhrase(name)]
+}
+
+// names reports whether the free-text place name s (an address city or county,
+// or a provider's service area) refers to p or, for a county, to a place in it
+func (p *Place) names(s string) bool {
+	named := LookupPlace(s)
+	if named == nil {
+		return false
+	}
+	return named == p || (p.Kind == PlaceCounty && named.County == p.County)
+}
+
+// contains reports whether the service, offered by provider (nil when it has
+// no profile), is in p
+func (p *Place) contains(s *models.Service, provider *models.ServiceProvider) bool {
+	if s.Geo != nil && HaversineKm(p.Center, s.Geo) <= p.RadiusKm {
+		return true
+	}
+	if p.names(s.Location.City) || p.names(s.Location.County) {
+		return true
+	}
+	if provider != nil {
+		for _, area := range provider.ServiceAreas {
+			if p.names(area) {
+				return true
+			}
+		}
+	}
+	return false
+}
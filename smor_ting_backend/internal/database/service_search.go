@@ -0,0 +1,145 @@
+package database
+
+import (
+	"math"
+	"sort"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// earthRadiusKm is the sphere MongoDB measures 2dsphere distances on, so the
+// memory backend's haversine distances match $geoNear's
+const earthRadiusKm = 6378.1
+
+// Ranking blends distance, rating and completed jobs. Without a search
+// location the distance weight is shared out between the other two.
+const (
+	rankWeightDistance = 0.5
+	rankWeightRating   = 0.3
+	rankWeightJobs     = 0.2
+	// rankJobsHalfScore completed jobs earn half the jobs score; more keep helping, with diminishing returns
+	rankJobsHalfScore = 20
+	// textWeightRel is the share of a text search's score that is text relevance rather than the rank above
+	textWeightRel = 0.6
+)
+
+// maxSearchCandidates caps how many services the Mongo search loads for text
+// matching and ranking: the nearest ones for a location search, otherwise the
+// best rated
+const maxSearchCandidates = 500
+
+// ServiceSearch filters the public service search. Zero fields do not filter;
+// RadiusKm only applies with Near.
+type ServiceSearch struct {
+	// Text is free text such as "AC repair Paynesville", matched against the
+	// service and its provider's profile; place names in it filter by place
+	Text       string
+	CategoryID *primitive.ObjectID
+	Near       *models.GeoPoint
+	RadiusKm   float64
+	MinPrice   float64
+	MaxPrice   float64
+	MinRating  float64
+	Limit      int
+}
+
+// ServiceSearchResult is a matching service with the inputs to its rank
+type ServiceSearchResult struct {
+	Service models.Service `json:"service"`
+	// DistanceKm is set when the search has a location
+	DistanceKm    *float64 `json:"distance_km,omitempty"`
+	CompletedJobs int      `json:"completed_jobs"`
+	// Relevance is how well a text search matched, from 0 to 1
+	Relevance float64                 `json:"relevance,omitempty"`
+	Provider  *models.ServiceProvider `json:"provider,omitempty"`
+	Score     float64                 `json:"score"`
+}
+
+// matches applies the non-location filters, the same ones the Mongo backend puts in its query
+func (q ServiceSearch) matches(s *models.Service) bool {
+	if !s.IsActive {
+		return false
+	}
+	if q.CategoryID != nil && s.CategoryID != *q.CategoryID {
+		return false
+	}
+	if q.MinPrice > 0 && s.Price < q.MinPrice {
+		return false
+	}
+	if q.MaxPrice > 0 && s.Price > q.MaxPrice {
+		return false
+	}
+	return q.MinRating <= 0 || s.Rating >= q.MinRating
+}
+
+// matchText keeps the results that match q.Text, attaching their provider's
+// profile and relevance. providers is keyed by the provider's user ID.
+func (q ServiceSearch) matchText(results []ServiceSearchResult, providers map[primitive.ObjectID]*models.ServiceProvider) []ServiceSearchResult {
+	for i := range results {
+		results[i].Provider = providers[results[i].Service.ProviderID]
+	}
+	if q.Text == "" {
+		return results
+	}
+	text := parseTextQuery(q.Text)
+	out := results[:0]
+	for _, r := range results {
+		if relevance, ok := text.relevance(&r.Service, r.Provider); ok {
+			r.Relevance = relevance
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rankServiceResults scores results, orders them best first and applies the limit.
+// Ties go to the nearer service, then the older ID, so both backends return the same order.
+func rankServiceResults(results []ServiceSearchResult, q ServiceSearch) []ServiceSearchResult {
+	for i := range results {
+		results[i].Score = q.score(&results[i])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.DistanceKm != nil && b.DistanceKm != nil && *a.DistanceKm != *b.DistanceKm {
+			return *a.DistanceKm < *b.DistanceKm
+		}
+		return a.Service.ID.Hex() < b.Service.ID.Hex()
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+func (q ServiceSearch) score(r *ServiceSearchResult) float64 {
+	rating := math.Min(math.Max(r.Service.Rating, 0), 5) / 5
+	jobs := float64(r.CompletedJobs) / float64(r.CompletedJobs+rankJobsHalfScore)
+	var base float64
+	if r.DistanceKm == nil {
+		scale := 1 / (rankWeightRating + rankWeightJobs)
+		base = rankWeightRating*scale*rating + rankWeightJobs*scale*jobs
+	} else {
+		proximity := 1 / (1 + *r.DistanceKm)
+		if q.RadiusKm > 0 {
+			proximity = math.Max(0, 1-*r.DistanceKm/q.RadiusKm)
+		}
+		base = rankWeightDistance*proximity + rankWeightRating*rating + rankWeightJobs*jobs
+	}
+	if q.Text == "" {
+		return base
+	}
+	return textWeightRel*r.Relevance + (1-textWeightRel)*base
+}
+
+// HaversineKm is the great-circle distance between two points in kilometres
+func HaversineKm(a, b *models.GeoPoint) float64 {
+	lat1, lat2 := a.Lat()*math.Pi/180, b.Lat()*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng() - a.Lng()) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	monrovia    = models.Address{City: "Monrovia", Latitude: 6.3156, Longitude: -10.8074}
+	paynesville = models.Address{City: "Paynesville", Latitude: 6.2817, Longitude: -10.7153}
+	buchanan    = models.Address{City: "Buchanan", Latitude: 5.8808, Longitude: -10.0467}
+)
+
+func TestHaversineKm(t *testing.T) {
+	d := HaversineKm(monrovia.GeoPoint(), paynesville.GeoPoint())
+	assert.InDelta(t, 10.9, d, 0.3)
+	assert.Zero(t, HaversineKm(monrovia.GeoPoint(), monrovia.GeoPoint()))
+}
+
+func TestMemorySearchServices_FiltersAndRanks(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	plumbing, cleaning := primitive.NewObjectID(), primitive.NewObjectID()
+	busy, fresh := primitive.NewObjectID(), primitive.NewObjectID()
+
+	create := func(name string, provider, category primitive.ObjectID, loc models.Address, price, rating float64) *models.Service {
+		s := &models.Service{Name: name, ProviderID: provider, CategoryID: category, Location: loc, Price: price, Rating: rating, IsActive: true}
+		require.NoError(t, db.CreateService(ctx, s))
+		return s
+	}
+	near := create("Near, poorly rated", fresh, plumbing, monrovia, 20, 2.5)
+	across := create("Across town, busy", busy, plumbing, paynesville, 30, 4.8)
+	far := create("Buchanan", busy, plumbing, buchanan, 25, 5.0)
+	create("Unlocated", fresh, plumbing, models.Address{City: "Monrovia"}, 20, 5.0)
+	create("Cleaning", fresh, cleaning, monrovia, 15, 5.0)
+	pricey := create("Pricey", fresh, plumbing, monrovia, 200, 4.5)
+	inactive := create("Inactive", fresh, plumbing, monrovia, 20, 5.0)
+	require.NoError(t, db.DeleteService(ctx, inactive.ID))
+	for i := 0; i < 30; i++ {
+		require.NoError(t, db.CreateBooking(ctx, &models.Booking{ProviderID: busy, Status: models.BookingCompleted}))
+	}
+	require.NoError(t, db.CreateBooking(ctx, &models.Booking{ProviderID: fresh, Status: models.BookingCancelled}))
+
+	assert.Equal(t, []float64{monrovia.Longitude, monrovia.Latitude}, near.Geo.Coordinates)
+
+	results, err := db.SearchServices(ctx, ServiceSearch{CategoryID: &plumbing, Near: monrovia.GeoPoint(), RadiusKm: 25, MaxPrice: 100})
+	require.NoError(t, err)
+	require.Len(t, results, 2, "far, unlocated, pricey, inactive and other-category services are excluded")
+	// The busy, well rated provider 11km away outranks the poorly rated one next door
+	assert.Equal(t, across.ID, results[0].Service.ID)
+	assert.Equal(t, 30, results[0].CompletedJobs)
+	assert.InDelta(t, 10.9, *results[0].DistanceKm, 0.3)
+	assert.Equal(t, near.ID, results[1].Service.ID)
+	assert.Equal(t, 0, results[1].CompletedJobs)
+	assert.Greater(t, results[0].Score, results[1].Score)
+
+	// Without a location every located or unlocated match is ranked on rating and jobs alone
+	results, err = db.SearchServices(ctx, ServiceSearch{CategoryID: &plumbing, MinRating: 4.5, MinPrice: 21})
+	require.NoError(t, err)
+	ids := []primitive.ObjectID{}
+	for _, r := range results {
+		assert.Nil(t, r.DistanceKm)
+		ids = append(ids, r.Service.ID)
+	}
+	assert.Equal(t, []primitive.ObjectID{far.ID, across.ID, pricey.ID}, ids)
+
+	// Moving a service updates its point
+	far.Location = monrovia
+	require.NoError(t, db.UpdateService(ctx, far))
+	results, err = db.SearchServices(ctx, ServiceSearch{Near: monrovia.GeoPoint(), RadiusKm: 1, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, results, 4)
+
+	list, err := db.GetServices(ctx, &plumbing, &paynesville, 5)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, across.ID, list[0].ID)
+}
@@ -0,0 +1,361 @@
+package database
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/smorting/backend/internal/models"
+)
+
+// stopWords carry no meaning in a service search ("plumber in Sinkor")
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "in": true, "at": true, "near": true, "around": true,
+	"for": true, "and": true, "of": true, "to": true, "my": true, "me": true, "i": true,
+	"need": true, "someone": true, "service": true, "county": true, "city": true,
+}
+
+// synonymSets group words and phrases customers use for the same thing; each
+// is rewritten to the set's first entry in both queries and documents
+var synonymSets = [][]string{
+	{"ac", "air conditioner", "air conditioning", "aircon", "air condition", "cooling"},
+	{"plumbing", "plumber", "pipe", "pipe fitter", "water leak"},
+	{"electrical", "electrician", "electric", "wiring", "light man"},
+	{"carpentry", "carpenter", "woodwork", "furniture maker"},
+	{"masonry", "mason", "bricklayer", "block layer"},
+	{"cleaning", "cleaner", "housekeeping", "house cleaning", "maid"},
+	{"mechanic", "auto repair", "car repair", "garage"},
+	{"generator", "genset", "generator man"},
+	{"painting", "painter"},
+	{"repair", "fix", "fixing", "fixer", "maintenance"},
+	{"tv", "television"},
+	{"fridge", "refrigerator", "freezer"},
+	{"phone", "cellphone", "cell phone", "mobile phone"},
+	{"barber", "haircut", "barbershop"},
+	{"hairdresser", "hair braiding", "braiding", "salon"},
+	{"tailor", "seamstress", "sewing"},
+	{"welding", "welder"},
+	{"tiling", "tiler", "tile"},
+	{"solar", "solar panel", "solar power"},
+	{"laundry", "washing", "washerman"},
+}
+
+// synonyms maps each normalised synonym phrase to its canonical token
+var synonyms = func() map[string]string {
+	out := map[string]string{}
+	for _, set := range synonymSets {
+		canonical := normalizePhrase(set[0])
+		for _, phrase := range set {
+			out[normalizePhrase(phrase)] = canonical
+		}
+	}
+	return out
+}()
+
+// maxPhraseWords is the longest synonym or place name, in words
+const maxPhraseWords = 3
+
+// prefilterPrefixLen is how many leading letters of a term the Mongo prefilter
+// matches on; typos after them are left to the fuzzy relevance check
+const prefilterPrefixLen = 3
+
+// Match qualities and field weights for text relevance
+const (
+	textExact  = 1.0
+	textPrefix = 0.8
+	textFuzzy  = 0.6
+
+	fieldServiceName  = 1.0
+	fieldBusinessName = 0.9
+	fieldServiceAreas = 0.7
+	fieldDescription  = 0.5
+)
+
+// tokenize lowercases s and splits it into stemmed words, dropping stop words
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if w = stem(w); !stopWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// stem strips a plural "s" so "plumbers" and "plumber" match
+func stem(w string) string {
+	if len(w) > 4 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func normalizePhrase(s string) string {
+	return strings.Join(tokenize(s), " ")
+}
+
+// canonicalize rewrites synonym phrases in tokens to their canonical token, longest phrase first
+func canonicalize(tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		n := 1
+		word := tokens[i]
+		for size := maxPhraseWords; size > 0; size-- {
+			if i+size > len(tokens) {
+				continue
+			}
+			if canonical, ok := synonyms[strings.Join(tokens[i:i+size], " ")]; ok {
+				n, word = size, canonical
+				break
+			}
+		}
+		out = append(out, word)
+		i += n
+	}
+	return out
+}
+
+// textQuery is a parsed free-text search: the words every result must match
+// and the places named in it, any one of which a result must be in
+type textQuery struct {
+	terms  []string
+	places []*Place
+}
+
+// parseTextQuery pulls place names out of raw and canonicalises the remaining
+// words. Misspelt places and synonyms ("Paynsville", "plumbr") are corrected
+// when they are within the typo tolerance of a known one.
+func parseTextQuery(raw string) textQuery {
+	tokens := tokenize(raw)
+	var q textQuery
+	var rest []string
+	for i := 0; i < len(tokens); {
+		n := 0
+		for size := maxPhraseWords; size > 0 && n == 0; size-- {
+			if i+size > len(tokens) {
+				continue
+			}
+			if place := lookupPlaceFuzzy(strings.Join(tokens[i:i+size], " ")); place != nil {
+				q.places = appendPlace(q.places, place)
+				n = size
+			}
+		}
+		if n == 0 {
+			rest = append(rest, correctToVocabulary(tokens[i]))
+			n = 1
+		}
+		i += n
+	}
+	q.terms = canonicalize(rest)
+	return q
+}
+
+func appendPlace(places []*Place, p *Place) []*Place {
+	for _, existing := range places {
+		if existing == p {
+			return places
+		}
+	}
+	return append(places, p)
+}
+
+// lookupPlaceFuzzy finds the place called phrase, allowing typos in names of five letters or more
+func lookupPlaceFuzzy(phrase string) *Place {
+	if p, ok := placeNames[phrase]; ok {
+		return p
+	}
+	if len(phrase) < 5 {
+		return nil
+	}
+	if name := closestWithinTypos(phrase, placeNames); name != "" {
+		return placeNames[name]
+	}
+	return nil
+}
+
+// correctToVocabulary replaces a misspelt synonym with the known word
+func correctToVocabulary(word string) string {
+	if _, ok := synonyms[word]; ok {
+		return word
+	}
+	if known := closestWithinTypos(word, synonyms); known != "" {
+		return known
+	}
+	return word
+}
+
+// closestWithinTypos returns the key of vocabulary nearest to word within its
+// typo tolerance, the alphabetically first on a tie, or "" when none is
+func closestWithinTypos[V any](word string, vocabulary map[string]V) string {
+	limit := maxTypos(word)
+	if limit == 0 {
+		return ""
+	}
+	best, bestDistance := "", limit+1
+	for candidate := range vocabulary {
+		d := editDistance(word, candidate, limit)
+		if d < bestDistance || (d == bestDistance && d <= limit && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// maxTypos is how many edits a word of this length may be off by and still match
+func maxTypos(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func withinTypos(word, target string) bool {
+	limit := maxTypos(word)
+	return limit > 0 && editDistance(word, target, limit) <= limit
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment) distance
+// between a and b, giving up with limit+1 once it is certainly above limit
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// termQuality is how well term matches one of a field's tokens: exactly, as a
+// prefix of a longer word ("plumb"), or within the typo tolerance
+func termQuality(term string, tokens []string) float64 {
+	best := 0.0
+	for _, tok := range tokens {
+		switch {
+		case tok == term:
+			return textExact
+		case len(term) >= 3 && strings.HasPrefix(tok, term):
+			best = max(best, textPrefix)
+		case best < textFuzzy && withinTypos(term, tok):
+			best = textFuzzy
+		}
+	}
+	return best
+}
+
+// textField is a searchable field's tokens and how much a match in it counts
+type textField struct {
+	weight float64
+	tokens []string
+}
+
+// relevance scores the service and its provider's profile against the query's
+// terms, from 0 to 1. ok is false when a term matches nowhere or the service
+// is in none of the places named.
+func (q textQuery) relevance(s *models.Service, provider *models.ServiceProvider) (float64, bool) {
+	if len(q.places) > 0 {
+		in := false
+		for _, p := range q.places {
+			if p.contains(s, provider) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return 0, false
+		}
+	}
+	if len(q.terms) == 0 {
+		return 1, true
+	}
+
+	fields := []textField{
+		{fieldServiceName, canonicalize(tokenize(s.Name))},
+		{fieldDescription, canonicalize(tokenize(s.Description))},
+	}
+	if provider != nil {
+		fields = append(fields,
+			textField{fieldBusinessName, canonicalize(tokenize(provider.BusinessName))},
+			textField{fieldServiceAreas, tokenize(strings.Join(provider.ServiceAreas, " "))},
+		)
+	}
+
+	total := 0.0
+	for _, term := range q.terms {
+		best := 0.0
+		for _, f := range fields {
+			best = max(best, f.weight*termQuality(term, f.tokens))
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total / float64(len(q.terms)), true
+}
+
+// prefilterPattern is a case-insensitive regex for words starting like one of
+// the query's terms or their synonyms. It only narrows what the database loads;
+// relevance still decides what matches. It is "" when there are no terms.
+func (q textQuery) prefilterPattern() string {
+	seen := map[string]bool{}
+	var prefixes []string
+	add := func(word string) {
+		if r := []rune(word); len(r) > prefilterPrefixLen {
+			word = string(r[:prefilterPrefixLen])
+		}
+		if word != "" && !seen[word] {
+			seen[word] = true
+			prefixes = append(prefixes, regexp.QuoteMeta(word))
+		}
+	}
+	for _, term := range q.terms {
+		add(term)
+		for _, set := range synonymSets {
+			if normalizePhrase(set[0]) != term {
+				continue
+			}
+			for _, phrase := range set {
+				if words := tokenize(phrase); len(words) > 0 {
+					add(words[0])
+				}
+			}
+		}
+	}
+	if len(prefixes) == 0 {
+		return ""
+	}
+	sort.Strings(prefixes)
+	return `\b(` + strings.Join(prefixes, "|") + `)`
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseTextQuery_PlacesSynonymsAndTypos(t *testing.T) {
+	cases := []struct {
+		raw    string
+		terms  []string
+		places []string
+	}{
+		{"plumber Sinkor", []string{"plumbing"}, []string{"Sinkor"}},
+		{"AC repair Paynesville", []string{"ac", "repair"}, []string{"Paynesville"}},
+		{"air conditioner fixing in Paynsville", []string{"ac", "repair"}, []string{"Paynesville"}},
+		{"plumbr near red light", []string{"plumbing"}, []string{"Red Light"}},
+		{"electricians Montserrado County", []string{"electrical"}, []string{"Montserrado"}},
+		{"generator man Congo Town or ELWA", []string{"generator", "or"}, []string{"Congo Town", "ELWA"}},
+		{"Central Monrovia", nil, []string{"Central Monrovia"}},
+		{"tile work", []string{"tiling", "work"}, nil},
+	}
+	for _, c := range cases {
+		q := parseTextQuery(c.raw)
+		var places []string
+		for _, p := range q.places {
+			places = append(places, p.Name)
+		}
+		assert.Equal(t, c.terms, nilIfEmpty(q.terms), c.raw)
+		assert.Equal(t, c.places, places, c.raw)
+	}
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 1, editDistance("plumbr", "plumber", 2))
+	assert.Equal(t, 1, editDistance("eletcrician", "electrician", 2), "a transposition is one edit")
+	assert.Equal(t, 3, editDistance("sinkor", "paynesville", 2))
+}
+
+func TestPrefilterPattern_KeepsEveryPossibleMatch(t *testing.T) {
+	assert.Empty(t, parseTextQuery("Central Monrovia").prefilterPattern(), "a place-only search has no terms to narrow by")
+
+	re := regexp.MustCompile("(?i)" + parseTextQuery("plumbr Sinkor").prefilterPattern())
+	for _, doc := range []string{"Plumbing works", "Sinkor Pipe Masters", "burst WATER LEAK", "plumbers"} {
+		assert.True(t, re.MatchString(doc), doc)
+	}
+	for _, doc := range []string{"House painting", "Generator repair", "applumb"} {
+		assert.False(t, re.MatchString(doc), doc)
+	}
+
+	re = regexp.MustCompile("(?i)" + parseTextQuery("aircon fixing").prefilterPattern())
+	for _, doc := range []string{"Cool Breeze", "AC service", "air conditioner", "Repairs", "maintenance"} {
+		assert.True(t, re.MatchString(doc), doc)
+	}
+}
+
+func TestMemorySearchServices_TextAcrossServicesAndProviders(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	coolAir, pipes, bushrod := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	require.NoError(t, db.UpsertServiceProvider(ctx, &models.ServiceProvider{UserID: coolAir, BusinessName: "Cool Breeze Aircon", ServiceAreas: []string{"Paynesville", "Red Light"}}))
+	require.NoError(t, db.UpsertServiceProvider(ctx, &models.ServiceProvider{UserID: pipes, BusinessName: "Sinkor Pipe Masters", ServiceAreas: []string{"Sinkor", "Congo Town"}}))
+
+	create := func(s *models.Service) *models.Service {
+		s.IsActive = true
+		require.NoError(t, db.CreateService(ctx, s))
+		return s
+	}
+	// Matches "AC" through its provider's name and Paynesville through its service areas
+	unitService := create(&models.Service{Name: "Split unit servicing", ProviderID: coolAir, Rating: 4.5})
+	// Matches in its own name, located in Paynesville
+	acRepair := create(&models.Service{Name: "Air conditioning repair", ProviderID: bushrod, Rating: 4.0,
+		Location: models.Address{Latitude: 6.2850, Longitude: -10.7200}})
+	// Right words, wrong side of town
+	create(&models.Service{Name: "AC repair", ProviderID: bushrod, Rating: 5,
+		Location: models.Address{City: "Bushrod Island", Latitude: 6.3530, Longitude: -10.7850}})
+	leak := create(&models.Service{Name: "Leaking tap fix", Description: "Plumbers for homes and offices", ProviderID: pipes, Rating: 4.2})
+
+	results, err := db.SearchServices(ctx, ServiceSearch{Text: "AC repair Paynesville"})
+	require.NoError(t, err)
+	ids := resultIDs(results)
+	assert.ElementsMatch(t, []primitive.ObjectID{acRepair.ID}, ids, "only services that match every word and the place")
+
+	results, err = db.SearchServices(ctx, ServiceSearch{Text: "aircon Paynesville"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, acRepair.ID, results[0].Service.ID, "a match in the service name outranks one in the business name")
+	assert.Equal(t, unitService.ID, results[1].Service.ID)
+	require.NotNil(t, results[1].Provider)
+	assert.Equal(t, "Cool Breeze Aircon", results[1].Provider.BusinessName)
+	assert.Greater(t, results[0].Relevance, results[1].Relevance)
+
+	results, err = db.SearchServices(ctx, ServiceSearch{Text: "plumbr congotown"})
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{leak.ID}, resultIDs(results))
+
+	results, err = db.SearchServices(ctx, ServiceSearch{Text: "Montserrado"})
+	require.NoError(t, err)
+	assert.Len(t, results, 4, "every service is somewhere in Montserrado")
+
+	results, err = db.SearchServices(ctx, ServiceSearch{Text: "welder"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func resultIDs(results []ServiceSearchResult) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, r := range results {
+		ids = append(ids, r.Service.ID)
+	}
+	return ids
+}
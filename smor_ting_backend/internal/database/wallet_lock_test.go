@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryWithWalletLock_RunsOnceAndSerialises(t *testing.T) {
+	db := NewMemoryDatabase()
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+
+	calls := 0
+	boom := errors.New("boom")
+	err := db.WithWalletLock(ctx, user, func(ctx context.Context) error {
+		calls++
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, 1, calls, "fn runs exactly once, even when it fails")
+
+	// The failed call released the lock, and concurrent holders never overlap
+	var wg sync.WaitGroup
+	inside, overlaps := 0, 0
+	var mu sync.Mutex
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = db.WithWalletLock(ctx, user, func(ctx context.Context) error {
+				mu.Lock()
+				inside++
+				if inside > 1 {
+					overlaps++
+				}
+				mu.Unlock()
+				runtime.Gosched()
+				mu.Lock()
+				inside--
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, overlaps)
+}
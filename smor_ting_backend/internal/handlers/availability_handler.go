@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// defaultSlotDays is how far ahead slots are listed when no end is given
+const defaultSlotDays = 7
+
+// AvailabilityHandler serves provider calendars and the bookable slots of services
+type AvailabilityHandler struct {
+	availability *services.AvailabilityService
+	repo         database.Repository
+	logger       *logger.Logger
+}
+
+func NewAvailabilityHandler(availability *services.AvailabilityService, repo database.Repository, logger *logger.Logger) *AvailabilityHandler {
+	return &AvailabilityHandler{availability: availability, repo: repo, logger: logger}
+}
+
+type weeklyHoursRequest struct {
+	WeeklyHours   []models.WorkingHours `json:"weekly_hours"`
+	BufferMinutes int                   `json:"buffer_minutes"`
+}
+
+type timeOffRequest struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+// Get returns the caller's calendar
+func (h *AvailabilityHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	availability, err := h.availability.Get(c.Context(), user.ID)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": availability})
+}
+
+// SetWeeklyHours replaces the caller's working hours and travel buffer
+func (h *AvailabilityHandler) SetWeeklyHours(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req weeklyHoursRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	availability, err := h.availability.SetWeeklyHours(c.Context(), user.ID, req.WeeklyHours, req.BufferMinutes)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": availability})
+}
+
+// AddTimeOff blocks part of the caller's calendar
+func (h *AvailabilityHandler) AddTimeOff(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req timeOffRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	availability, err := h.availability.AddTimeOff(c.Context(), user.ID, models.TimeOff{Start: req.Start, End: req.End, Reason: req.Reason})
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": availability})
+}
+
+// RemoveTimeOff reopens the caller's time off block :id
+func (h *AvailabilityHandler) RemoveTimeOff(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid time off id"})
+	}
+	availability, err := h.availability.RemoveTimeOff(c.Context(), user.ID, id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": availability})
+}
+
+// Slots lists the open start times of service :id. from and to are RFC 3339
+// times; from defaults to now and to to a week after from.
+func (h *AvailabilityHandler) Slots(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid service id"})
+	}
+	from := time.Now()
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid from"})
+		}
+	}
+	to := from.AddDate(0, 0, defaultSlotDays)
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid to"})
+		}
+	}
+
+	service, err := h.repo.GetServiceByID(c.Context(), id)
+	if err != nil || !service.IsActive {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "service not found"})
+	}
+	slots, err := h.availability.Slots(c.Context(), service, from, to)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": slots})
+}
+
+func (h *AvailabilityHandler) fail(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidAvailability), errors.Is(err, services.ErrInvalidSlotRange):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTimeOffNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Availability request failed", err, zap.String("path", c.Path()))
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "availability request failed"})
+}
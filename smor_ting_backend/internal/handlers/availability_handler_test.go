@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+// openSlot returns the first open slot for the service in the coming week
+func openSlot(t *testing.T, repo database.Repository, svc *models.Service) time.Time {
+	t.Helper()
+	slots, err := services.NewAvailabilityService(repo, nil).Slots(context.TODO(), svc, time.Now(), time.Now().AddDate(0, 0, 7))
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no open slot: %v", err)
+	}
+	return slots[0].Start
+}
+
+func TestAvailabilityHandler_ProviderCalendarDrivesSlots(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	h := handlers.NewAvailabilityHandler(services.NewAvailabilityService(repo, nil), repo, lg)
+
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	if err := repo.CreateUser(context.TODO(), provider); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	svc := &models.Service{Name: "Generator servicing", ProviderID: provider.ID, Duration: 120, IsActive: true}
+	if err := repo.CreateService(context.TODO(), svc); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	app := withUser(fiber.New(), provider)
+	app.Get("/providers/availability", h.Get)
+	app.Put("/providers/availability", h.SetWeeklyHours)
+	app.Post("/providers/availability/time-off", h.AddTimeOff)
+	app.Delete("/providers/availability/time-off/:id", h.RemoveTimeOff)
+	app.Get("/services/:id/slots", h.Slots)
+
+	// Until the provider publishes hours, the default calendar applies
+	_, body := doJSON(t, app, http.MethodGet, "/providers/availability", nil)
+	if hours := body["data"].(map[string]interface{})["weekly_hours"].([]interface{}); len(hours) != 6 {
+		t.Fatalf("expected the default Monday to Saturday hours, got %v", hours)
+	}
+
+	resp, body := doJSON(t, app, http.MethodPut, "/providers/availability", map[string]interface{}{
+		"weekly_hours":   []map[string]interface{}{{"weekday": 3, "start": "09:00", "end": "13:00"}},
+		"buffer_minutes": 15,
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("set hours expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	if resp, _ = doJSON(t, app, http.MethodPut, "/providers/availability", map[string]interface{}{
+		"weekly_hours": []map[string]interface{}{{"weekday": 3, "start": "13:00", "end": "09:00"}},
+	}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("inverted hours expected 400, got %d", resp.StatusCode)
+	}
+
+	wednesday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	for wednesday.Weekday() != time.Wednesday {
+		wednesday = wednesday.AddDate(0, 0, 1)
+	}
+	slotsPath := "/services/" + svc.ID.Hex() + "/slots?from=" + wednesday.Format(time.RFC3339) + "&to=" + wednesday.AddDate(0, 0, 1).Format(time.RFC3339)
+	_, body = doJSON(t, app, http.MethodGet, slotsPath, nil)
+	// 09:00-13:00 fits two hour jobs starting 09:00 to 11:00
+	if slots := body["data"].([]interface{}); len(slots) != 5 {
+		t.Fatalf("expected 5 slots, got %v", slots)
+	}
+
+	resp, body = doJSON(t, app, http.MethodPost, "/providers/availability/time-off", map[string]interface{}{
+		"start": wednesday, "end": wednesday.AddDate(0, 0, 1), "reason": "family",
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add time off expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	offID := body["data"].(map[string]interface{})["time_off"].([]interface{})[0].(map[string]interface{})["id"].(string)
+	if _, body = doJSON(t, app, http.MethodGet, slotsPath, nil); len(body["data"].([]interface{})) != 0 {
+		t.Fatalf("expected no slots on a day off, got %v", body["data"])
+	}
+	if resp, _ = doJSON(t, app, http.MethodDelete, "/providers/availability/time-off/"+offID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove time off expected 200, got %d", resp.StatusCode)
+	}
+	if resp, _ = doJSON(t, app, http.MethodDelete, "/providers/availability/time-off/"+offID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("removing twice expected 404, got %d", resp.StatusCode)
+	}
+
+	if resp, _ = doJSON(t, app, http.MethodGet, "/services/"+svc.ID.Hex()+"/slots?from=2030-01-01T00:00:00Z&to=2030-03-01T00:00:00Z", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("oversized range expected 400, got %d", resp.StatusCode)
+	}
+	if resp, _ = doJSON(t, app, http.MethodGet, "/services/"+svc.ID.Hex()+"/slots?from=tomorrow", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad from expected 400, got %d", resp.StatusCode)
+	}
+}
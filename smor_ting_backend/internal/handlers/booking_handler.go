@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// BookingHandler exposes customer and provider booking endpoints
+type BookingHandler struct {
+	bookings     *services.BookingService
+	auditService *services.AuditService
+	logger       *logger.Logger
+}
+
+func NewBookingHandler(bookings *services.BookingService, auditService *services.AuditService, logger *logger.Logger) *BookingHandler {
+	if auditService == nil {
+		auditService = services.NewAuditService(nil, nil)
+	}
+	return &BookingHandler{bookings: bookings, auditService: auditService, logger: logger}
+}
+
+type createBookingRequest struct {
+	ServiceID     string         `json:"service_id"`
+	ScheduledDate time.Time      `json:"scheduled_date"`
+	Address       models.Address `json:"address"`
+	Notes         string         `json:"notes"`
+}
+
+type bookingStatusRequest struct {
+	Status models.BookingStatus `json:"status"`
+	Reason string               `json:"reason"`
+}
+
+// Create books a service for the authenticated customer
+func (h *BookingHandler) Create(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var req createBookingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	serviceID, err := primitive.ObjectIDFromHex(req.ServiceID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid service_id"})
+	}
+
+	booking := &models.Booking{
+		ServiceID:     serviceID,
+		ScheduledDate: req.ScheduledDate,
+		Address:       req.Address,
+		Notes:         req.Notes,
+	}
+	if err := h.bookings.Create(c.Context(), user, booking); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidBookingSchedule), errors.Is(err, services.ErrServiceUnavailable):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrSlotUnavailable):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrBookingForbidden):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "you cannot book your own service"})
+		}
+		h.logger.Error("Failed to create booking", err, zap.String("user_id", user.ID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create booking"})
+	}
+
+	h.audit(c, user, services.ActionBookingCreate, booking.ID, true, map[string]interface{}{
+		"service_id":   booking.ServiceID.Hex(),
+		"provider_id":  booking.ProviderID.Hex(),
+		"total_amount": booking.TotalAmount,
+		"currency":     booking.Currency,
+	})
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": booking})
+}
+
+// List returns the caller's bookings (jobs for providers, orders for customers), optionally filtered by status
+func (h *BookingHandler) List(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	status := models.BookingStatus(c.Query("status"))
+	if status != "" && !status.IsValid() {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid status"})
+	}
+	list, err := h.bookings.ListForUser(c.Context(), user, status)
+	if err != nil {
+		h.logger.Error("Failed to list bookings", err, zap.String("user_id", user.ID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list bookings"})
+	}
+	return c.JSON(fiber.Map{"data": list})
+}
+
+// Get returns a booking the caller is party to
+func (h *BookingHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking id"})
+	}
+	booking, err := h.bookings.Get(c.Context(), user, id)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "booking not found"})
+	}
+	return c.JSON(fiber.Map{"data": booking})
+}
+
+// UpdateStatus applies a state machine transition to a booking
+func (h *BookingHandler) UpdateStatus(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking id"})
+	}
+	var req bookingStatusRequest
+	if err := c.BodyParser(&req); err != nil || !req.Status.IsValid() {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid status"})
+	}
+
+	booking, previous, err := h.bookings.UpdateStatus(c.Context(), user, id, req.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBookingNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "booking not found"})
+		case errors.Is(err, services.ErrBookingForbidden):
+			h.audit(c, user, services.ActionBookingStatusChange, id, false, map[string]interface{}{"from": previous, "to": req.Status})
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "only the provider can confirm or start this booking"})
+		case errors.Is(err, services.ErrInvalidBookingTransition):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "cannot move booking from " + string(previous) + " to " + string(req.Status)})
+		case errors.Is(err, services.ErrSlotUnavailable):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "the provider has since been booked at this time"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update booking"})
+	}
+
+	details := map[string]interface{}{"from": previous, "to": booking.Status}
+	if req.Reason != "" {
+		details["reason"] = req.Reason
+	}
+	h.audit(c, user, services.ActionBookingStatusChange, id, true, details)
+	return c.JSON(fiber.Map{"data": booking})
+}
+
+func (h *BookingHandler) audit(c *fiber.Ctx, user *models.User, action services.AuditAction, bookingID primitive.ObjectID, success bool, details map[string]interface{}) {
+	_ = h.auditService.LogAction(c.Context(), &services.AuditEntry{
+		UserID:     user.ID.Hex(),
+		UserEmail:  user.Email,
+		UserRole:   string(user.Role),
+		Action:     action,
+		Resource:   "bookings",
+		ResourceID: bookingID.Hex(),
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Success:    success,
+		Details:    details,
+	})
+}
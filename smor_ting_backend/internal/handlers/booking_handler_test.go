@@ -0,0 +1,93 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func newBookingApp(h *handlers.BookingHandler, u *models.User) *fiber.App {
+	app := withUser(fiber.New(), u)
+	app.Post("/bookings", h.Create)
+	app.Get("/bookings", h.List)
+	app.Get("/bookings/:id", h.Get)
+	app.Patch("/bookings/:id/status", h.UpdateStatus)
+	return app
+}
+
+func TestBookingHandler_StateMachine(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	h := handlers.NewBookingHandler(services.NewBookingService(repo, nil), services.NewAuditService(nil, nil), lg)
+
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	customer := &models.User{Email: "customer@test.com", Role: models.CustomerRole}
+	stranger := &models.User{Email: "stranger@test.com", Role: models.CustomerRole}
+	for _, u := range []*models.User{provider, customer, stranger} {
+		if err := repo.CreateUser(context.TODO(), u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	svc := &models.Service{Name: "Plumbing", ProviderID: provider.ID, Price: 40, Currency: "USD", IsActive: true}
+	if err := repo.CreateService(context.TODO(), svc); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	providerApp := newBookingApp(h, provider)
+	customerApp := newBookingApp(h, customer)
+	strangerApp := newBookingApp(h, stranger)
+
+	resp, body := doJSON(t, customerApp, http.MethodPost, "/bookings", map[string]interface{}{
+		"service_id":     svc.ID.Hex(),
+		"scheduled_date": openSlot(t, repo, svc),
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	data := body["data"].(map[string]interface{})
+	id := data["id"].(string)
+	if data["status"] != "pending" || data["total_amount"].(float64) != 40 || data["provider_id"] != provider.ID.Hex() {
+		t.Fatalf("unexpected booking: %+v", data)
+	}
+
+	// Strangers cannot see it; the provider sees it in their job list
+	if resp, _ = doJSON(t, strangerApp, http.MethodGet, "/bookings/"+id, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("stranger get expected 404, got %d", resp.StatusCode)
+	}
+	_, body = doJSON(t, providerApp, http.MethodGet, "/bookings", nil)
+	if len(body["data"].([]interface{})) != 1 {
+		t.Fatalf("provider should list 1 booking: %v", body["data"])
+	}
+
+	path := "/bookings/" + id + "/status"
+	// Customer cannot confirm; nobody can skip straight to completed
+	if resp, _ = doJSON(t, customerApp, http.MethodPatch, path, map[string]string{"status": "confirmed"}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("customer confirm expected 403, got %d", resp.StatusCode)
+	}
+	if resp, _ = doJSON(t, providerApp, http.MethodPatch, path, map[string]string{"status": "completed"}); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("pending->completed expected 409, got %d", resp.StatusCode)
+	}
+
+	for _, next := range []string{"confirmed", "in_progress"} {
+		if resp, body = doJSON(t, providerApp, http.MethodPatch, path, map[string]string{"status": next}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("provider %s expected 200, got %d: %v", next, resp.StatusCode, body)
+		}
+	}
+	if resp, _ = doJSON(t, customerApp, http.MethodPatch, path, map[string]string{"status": "cancelled"}); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("cancel after start expected 409, got %d", resp.StatusCode)
+	}
+	resp, body = doJSON(t, customerApp, http.MethodPatch, path, map[string]string{"status": "completed"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("complete expected 200, got %d", resp.StatusCode)
+	}
+	data = body["data"].(map[string]interface{})
+	if data["status"] != "completed" || data["completed_date"] == nil {
+		t.Fatalf("completed booking should carry completed_date: %+v", data)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// CategoryHandler serves the service category tree and its admin management
+type CategoryHandler struct {
+	categories *services.CategoryService
+	logger     *logger.Logger
+}
+
+func NewCategoryHandler(categories *services.CategoryService, logger *logger.Logger) *CategoryHandler {
+	return &CategoryHandler{categories: categories, logger: logger}
+}
+
+type categoryRequest struct {
+	Name        *string `json:"name"`
+	Slug        *string `json:"slug"`
+	Description *string `json:"description"`
+	// ParentID nests the category; "" moves it to the top level
+	ParentID  *string `json:"parent_id"`
+	Icon      *string `json:"icon"`
+	Color     *string `json:"color"`
+	SortOrder *int    `json:"sort_order"`
+	IsActive  *bool   `json:"is_active"`
+}
+
+// Tree returns the active categories nested under their parents, for the home grid
+func (h *CategoryHandler) Tree(c *fiber.Ctx) error {
+	tree, err := h.categories.Tree(c.Context(), false)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": tree})
+}
+
+// AdminTree returns every category, inactive ones included
+func (h *CategoryHandler) AdminTree(c *fiber.Ctx) error {
+	tree, err := h.categories.Tree(c.Context(), true)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": tree})
+}
+
+// Create adds a category
+func (h *CategoryHandler) Create(c *fiber.Ctx) error {
+	in, ok := parseCategoryRequest(c)
+	if !ok {
+		return nil
+	}
+	category, err := h.categories.Create(c.Context(), in)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": category})
+}
+
+// Update applies a partial update to a category
+func (h *CategoryHandler) Update(c *fiber.Ctx) error {
+	id, ok := categoryID(c)
+	if !ok {
+		return nil
+	}
+	in, ok := parseCategoryRequest(c)
+	if !ok {
+		return nil
+	}
+	category, err := h.categories.Update(c.Context(), id, in)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": category})
+}
+
+// Delete deactivates a category; it is kept so existing services still resolve it
+func (h *CategoryHandler) Delete(c *fiber.Ctx) error {
+	id, ok := categoryID(c)
+	if !ok {
+		return nil
+	}
+	category, err := h.categories.Deactivate(c.Context(), id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": category})
+}
+
+func parseCategoryRequest(c *fiber.Ctx) (services.CategoryInput, bool) {
+	var req categoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		return services.CategoryInput{}, false
+	}
+	in := services.CategoryInput{
+		Name:        req.Name,
+		Slug:        req.Slug,
+		Description: req.Description,
+		Icon:        req.Icon,
+		Color:       req.Color,
+		SortOrder:   req.SortOrder,
+		IsActive:    req.IsActive,
+	}
+	if req.ParentID != nil {
+		in.SetParent = true
+		if *req.ParentID != "" {
+			parent, err := primitive.ObjectIDFromHex(*req.ParentID)
+			if err != nil {
+				_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid parent_id"})
+				return services.CategoryInput{}, false
+			}
+			in.Parent = &parent
+		}
+	}
+	return in, true
+}
+
+func categoryID(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category id"})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func (h *CategoryHandler) fail(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCategory):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrCategorySlugTaken):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Category request failed", err, zap.String("path", c.Path()))
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "category request failed"})
+}
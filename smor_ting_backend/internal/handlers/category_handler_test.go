@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestCategoryHandler_AdminManagesTreeAndServicesRespectIt(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	categories := services.NewCategoryService(repo, nil)
+	h := handlers.NewCategoryHandler(categories, lg)
+	serviceHandler := handlers.NewServiceHandler(repo, lg)
+	serviceHandler.SetCategories(categories)
+
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	app := withUser(fiber.New(), provider)
+	app.Get("/services/categories", h.Tree)
+	app.Post("/services", serviceHandler.Create)
+	app.Get("/admin/categories", h.AdminTree)
+	app.Post("/admin/categories", h.Create)
+	app.Put("/admin/categories/:id", h.Update)
+	app.Delete("/admin/categories/:id", h.Delete)
+
+	resp, body := doJSON(t, app, http.MethodPost, "/admin/categories", map[string]interface{}{"name": "Plumbing", "icon": "plumbing", "color": "#2196F3"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	plumbing := body["data"].(map[string]interface{})
+	if plumbing["slug"] != "plumbing" {
+		t.Fatalf("expected a slug from the name, got %v", plumbing)
+	}
+	plumbingID := plumbing["id"].(string)
+
+	resp, body = doJSON(t, app, http.MethodPost, "/admin/categories", map[string]interface{}{"name": "Leak Repair", "parent_id": plumbingID})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create subcategory expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	leakID := body["data"].(map[string]interface{})["id"].(string)
+
+	if resp, _ = doJSON(t, app, http.MethodPost, "/admin/categories", map[string]interface{}{"name": "Plumbing"}); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate slug expected 409, got %d", resp.StatusCode)
+	}
+	if resp, _ = doJSON(t, app, http.MethodPut, "/admin/categories/"+plumbingID, map[string]interface{}{"parent_id": leakID}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("cycle expected 400, got %d", resp.StatusCode)
+	}
+	if resp, _ = doJSON(t, app, http.MethodPut, "/admin/categories/not-an-id", map[string]interface{}{"name": "X"}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid id expected 400, got %d", resp.StatusCode)
+	}
+
+	_, body = doJSON(t, app, http.MethodGet, "/services/categories", nil)
+	tree := body["data"].([]interface{})
+	if len(tree) != 1 || len(tree[0].(map[string]interface{})["children"].([]interface{})) != 1 {
+		t.Fatalf("expected plumbing with one subcategory, got %v", tree)
+	}
+
+	service := map[string]interface{}{"name": "Tap repair", "price": 15.0, "currency": "USD", "duration": 30, "category_id": leakID}
+	if resp, body = doJSON(t, app, http.MethodPost, "/services", service); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("service in an active category expected 201, got %d: %v", resp.StatusCode, body)
+	}
+
+	if resp, _ = doJSON(t, app, http.MethodDelete, "/admin/categories/"+plumbingID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("deactivate expected 200, got %d", resp.StatusCode)
+	}
+	_, body = doJSON(t, app, http.MethodGet, "/services/categories", nil)
+	if len(body["data"].([]interface{})) != 0 {
+		t.Fatalf("expected the deactivated subtree to be hidden, got %v", body["data"])
+	}
+	_, body = doJSON(t, app, http.MethodGet, "/admin/categories", nil)
+	if len(body["data"].([]interface{})) != 1 {
+		t.Fatalf("expected admins to still see plumbing, got %v", body["data"])
+	}
+
+	if resp, body = doJSON(t, app, http.MethodPost, "/services", service); resp.StatusCode != http.StatusBadRequest || body["error"] != "category is not active" {
+		t.Fatalf("service under an inactive parent expected 400, got %d: %v", resp.StatusCode, body)
+	}
+	service["category_id"] = "64b7f0000000000000000000"
+	if resp, body = doJSON(t, app, http.MethodPost, "/services", service); resp.StatusCode != http.StatusBadRequest || body["error"] != "unknown category_id" {
+		t.Fatalf("unknown category expected 400, got %d: %v", resp.StatusCode, body)
+	}
+	delete(service, "category_id")
+	if resp, body = doJSON(t, app, http.MethodPost, "/services", service); resp.StatusCode != http.StatusBadRequest || body["error"] != "category_id is required" {
+		t.Fatalf("service without a category expected 400, got %d: %v", resp.StatusCode, body)
+	}
+}
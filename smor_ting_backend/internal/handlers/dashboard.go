@@ -108,16 +108,15 @@ func (h *DashboardHandler) WalletDashboard(c *fiber.Ctx) error {
 		user = latestUser
 	}
 
-	txs := user.Wallet.Transactions
-	sort.Slice(txs, func(i, j int) bool { return txs[i].CreatedAt.After(txs[j].CreatedAt) })
-	if len(txs) > 10 {
-		txs = txs[:10]
+	// Project a compact transaction representation. Ledger transactions are the source
+	// of truth; embedded wallet transactions predate the ledger and are still listed.
+	type recentTx struct {
+		at  time.Time
+		row fiber.Map
 	}
-
-	// Project a compact transaction representation
-	recent := make([]fiber.Map, 0, len(txs))
-	for _, t := range txs {
-		recent = append(recent, fiber.Map{
+	var rows []recentTx
+	for _, t := range user.Wallet.Transactions {
+		rows = append(rows, recentTx{at: t.CreatedAt, row: fiber.Map{
 			"id":          t.ID.Hex(),
 			"type":        t.Type,
 			"amount":      t.Amount,
@@ -125,7 +124,38 @@ func (h *DashboardHandler) WalletDashboard(c *fiber.Ctx) error {
 			"reference":   t.Reference,
 			"description": t.Description,
 			"created_at":  t.CreatedAt,
-		})
+		}})
+	}
+	if h.ledger != nil {
+		if txs, err := h.ledger.RecentTransactions(c.Context(), user.ID, 10); err == nil {
+			for i := range txs {
+				t := &txs[i]
+				net := services.UserNet(t, user.ID)
+				direction := models.LedgerCredit
+				if net < 0 {
+					direction = models.LedgerDebit
+					net = -net
+				}
+				rows = append(rows, recentTx{at: t.CreatedAt, row: fiber.Map{
+					"id":          t.ID.Hex(),
+					"type":        t.Type,
+					"amount":      net,
+					"direction":   direction,
+					"status":      models.LedgerCompleted,
+					"reference":   t.Reference,
+					"description": t.Description,
+					"created_at":  t.CreatedAt,
+				}})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].at.After(rows[j].at) })
+	if len(rows) > 10 {
+		rows = rows[:10]
+	}
+	recent := make([]fiber.Map, 0, len(rows))
+	for _, r := range rows {
+		recent = append(recent, r.row)
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// EscrowHandler exposes the escrow state of a booking, lets the customer dispute
+// a pending release and lets an admin resolve the dispute
+type EscrowHandler struct {
+	bookings *services.BookingService
+	escrow   *services.EscrowService
+	logger   *logger.Logger
+}
+
+func NewEscrowHandler(bookings *services.BookingService, escrow *services.EscrowService, logger *logger.Logger) *EscrowHandler {
+	return &EscrowHandler{bookings: bookings, escrow: escrow, logger: logger}
+}
+
+type disputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+type resolveDisputeRequest struct {
+	Resolution services.DisputeResolution `json:"resolution"`
+	Note       string                     `json:"note"`
+}
+
+// Get returns the escrow for a booking the caller is party to
+func (h *EscrowHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookingID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking id"})
+	}
+	if _, err := h.bookings.Get(c.Context(), user, bookingID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "booking not found"})
+	}
+	escrow, err := h.escrow.Get(c.Context(), bookingID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no escrow for booking"})
+	}
+	return c.JSON(fiber.Map{"data": escrow})
+}
+
+// Dispute halts the release of a completed booking's escrow while the dispute window is open
+func (h *EscrowHandler) Dispute(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookingID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking id"})
+	}
+	var req disputeRequest
+	_ = c.BodyParser(&req)
+
+	escrow, err := h.escrow.Dispute(c.Context(), user, bookingID, req.Reason)
+	switch {
+	case errors.Is(err, services.ErrEscrowNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no escrow for booking"})
+	case errors.Is(err, services.ErrBookingForbidden):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "only the customer can dispute this booking"})
+	case errors.Is(err, services.ErrEscrowNotDisputable):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("Failed to dispute escrow", err, zap.String("booking_id", bookingID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to dispute escrow"})
+	}
+	return c.JSON(fiber.Map{"data": escrow})
+}
+
+// Resolve settles a disputed escrow: release pays the provider, refund returns the funds to the customer
+func (h *EscrowHandler) Resolve(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookingID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking id"})
+	}
+	var req resolveDisputeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	escrow, err := h.escrow.Resolve(c.Context(), user, bookingID, req.Resolution, req.Note)
+	switch {
+	case errors.Is(err, services.ErrInvalidResolution):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrEscrowNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no escrow for booking"})
+	case errors.Is(err, services.ErrBookingForbidden):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "only an admin can resolve a dispute"})
+	case errors.Is(err, services.ErrEscrowNotDisputed):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("Failed to resolve escrow dispute", err, zap.String("booking_id", bookingID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to resolve dispute"})
+	}
+	return c.JSON(fiber.Map{"data": escrow})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FeeHandler manages the platform fee schedule and serves provider earnings statements
+type FeeHandler struct {
+	fees   *services.FeeService
+	logger *logger.Logger
+}
+
+func NewFeeHandler(fees *services.FeeService, logger *logger.Logger) *FeeHandler {
+	return &FeeHandler{fees: fees, logger: logger}
+}
+
+func (h *FeeHandler) GetSchedule(c *fiber.Ctx) error {
+	schedule, err := h.fees.Schedule(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to load fee schedule", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load fee schedule"})
+	}
+	return c.JSON(fiber.Map{"data": schedule})
+}
+
+// UpdateSchedule replaces the commission rules, mobile money fees and promotions
+func (h *FeeHandler) UpdateSchedule(c *fiber.Ctx) error {
+	var schedule models.FeeSchedule
+	if err := c.BodyParser(&schedule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	admin, _ := c.Locals("user").(*models.User)
+	if err := h.fees.UpdateSchedule(c.Context(), admin, &schedule, auditContext(c)); err != nil {
+		if errors.Is(err, models.ErrInvalidFeeSchedule) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		h.logger.Error("Failed to save fee schedule", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save fee schedule"})
+	}
+	return c.JSON(fiber.Map{"data": schedule})
+}
+
+// Earnings returns the caller's earnings statement for ?from and ?to (YYYY-MM-DD, inclusive)
+func (h *FeeHandler) Earnings(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	return h.statement(c, user.ID)
+}
+
+// ProviderEarnings returns the earnings statement of provider :id
+func (h *FeeHandler) ProviderEarnings(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid provider id"})
+	}
+	return h.statement(c, id)
+}
+
+func (h *FeeHandler) statement(c *fiber.Ctx, providerID primitive.ObjectID) error {
+	from, to, ok := statementPeriod(c)
+	if !ok {
+		return nil
+	}
+	statement, err := h.fees.EarningsStatement(c.Context(), providerID, from, to)
+	if err != nil {
+		h.logger.Error("Failed to build earnings statement", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build earnings statement"})
+	}
+	return c.JSON(fiber.Map{"data": statement})
+}
+
+// statementPeriod reads ?from and ?to as whole UTC days and returns [from, to+1d);
+// the default is the current month to date
+func statementPeriod(c *fiber.Ctx) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.Parse("2006-01-02", raw); err != nil {
+			_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+			return from, to, false
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.Parse("2006-01-02", raw); err != nil {
+			_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "to must not be before from"})
+		return from, to, false
+	}
+	return from, to.AddDate(0, 0, 1), true
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FXHandler serves the exchange rate table and locked conversion quotes
+type FXHandler struct {
+	fx     *services.FXService
+	logger *logger.Logger
+}
+
+func NewFXHandler(fx *services.FXService, logger *logger.Logger) *FXHandler {
+	return &FXHandler{fx: fx, logger: logger}
+}
+
+func (h *FXHandler) Rates(c *fiber.Ctx) error {
+	rates, err := h.fx.Rates(c.Context())
+	if err != nil {
+		h.logger.Error("Failed to load fx rates", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load rates"})
+	}
+	return c.JSON(fiber.Map{"data": rates})
+}
+
+// SetRate saves one pair of the rate table, e.g. {"base":"USD","quote":"LRD","rate":190}
+func (h *FXHandler) SetRate(c *fiber.Ctx) error {
+	var rate models.FXRate
+	if err := c.BodyParser(&rate); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	admin, _ := c.Locals("user").(*models.User)
+	if err := h.fx.SetRate(c.Context(), admin, &rate, auditContext(c)); err != nil {
+		if errors.Is(err, services.ErrInvalidFXRate) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		h.logger.Error("Failed to save fx rate", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save rate"})
+	}
+	return c.JSON(fiber.Map{"data": rate})
+}
+
+type FXQuoteRequest struct {
+	BookingID string `json:"booking_id"`
+	Currency  string `json:"currency"`
+}
+
+// Quote locks the price of one of the caller's bookings in another currency
+func (h *FXHandler) Quote(c *fiber.Ctx) error {
+	var req FXQuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	bookingID, err := primitive.ObjectIDFromHex(req.BookingID)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking_id"})
+	}
+	user, _ := c.Locals("user").(*models.User)
+	quote, err := h.fx.QuoteBooking(c.Context(), user, bookingID, req.Currency)
+	switch {
+	case errors.Is(err, services.ErrBookingNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "booking not found"})
+	case errors.Is(err, models.ErrUnsupportedCurrency), errors.Is(err, services.ErrFXSameCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "supported": models.SupportedCurrencies})
+	case errors.Is(err, services.ErrFXRateUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("Failed to quote fx conversion", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to quote"})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": quote})
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestFX_QuoteAndPayBookingFromOtherCurrency(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	customer := &models.User{Email: "fx-customer@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "LRD"}}
+	provider := &models.User{Email: "fx-provider@example.com", Role: models.ProviderRole}
+	for _, u := range []*models.User{customer, provider} {
+		if err := repo.CreateUser(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	svc := &models.Service{Name: "Wiring", ProviderID: provider.ID, Price: 40, Currency: "USD", IsActive: true}
+	_ = repo.CreateService(ctx, svc)
+	booking := &models.Booking{ServiceID: svc.ID, ScheduledDate: openSlot(t, repo, svc)}
+	if err := services.NewBookingService(repo, nil).Create(ctx, customer, booking); err != nil {
+		t.Fatalf("create booking: %v", err)
+	}
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 10000, Status: models.LedgerCompleted, Reference: "lrd-topup"})
+
+	escrow := services.NewEscrowService(services.NewMemoryEscrowStore(), repo, ledger, nil, 0, time.Minute, nil)
+	fx := services.NewFXService(nil, repo, time.Minute, 0, nil, nil)
+	escrow.SetFXService(fx)
+	fxHandler := handlers.NewFXHandler(fx, lg)
+	wallet := handlers.NewWalletHandlerWithProviders(nil, lg, ledger, escrow)
+
+	admin := withUser(fiber.New(), &models.User{Email: "admin@example.com", Role: models.AdminRole})
+	admin.Put("/admin/fx/rates", fxHandler.SetRate)
+	app := withUser(fiber.New(), customer)
+	app.Post("/wallet/fx/quotes", fxHandler.Quote)
+	app.Post("/wallet/pay/balance", wallet.PayFromWallet)
+
+	send := func(app *fiber.App, method, path string, body map[string]interface{}) (int, map[string]interface{}) {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code, _ := send(admin, http.MethodPut, "/admin/fx/rates", map[string]interface{}{"base": "USD", "quote": "LRD", "rate": -1}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative rate, got %d", code)
+	}
+	if code, _ := send(admin, http.MethodPut, "/admin/fx/rates", map[string]interface{}{"base": "USD", "quote": "LRD", "rate": 190}); code != http.StatusOK {
+		t.Fatalf("expected 200 saving the rate, got %d", code)
+	}
+	if code, _ := send(app, http.MethodPost, "/wallet/pay/balance", map[string]interface{}{"booking_ref": booking.ID.Hex(), "currency": "LRD"}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 paying in LRD without a quote, got %d", code)
+	}
+	code, out := send(app, http.MethodPost, "/wallet/fx/quotes", map[string]interface{}{"booking_id": booking.ID.Hex(), "currency": "LRD"})
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201 for the quote, got %d: %v", code, out)
+	}
+	quote := out["data"].(map[string]interface{})
+	if quote["from_amount"] != 7600.0 {
+		t.Fatalf("expected 40 USD to cost 7600 LRD, got %v", quote)
+	}
+	code, out = send(app, http.MethodPost, "/wallet/pay/balance", map[string]interface{}{"booking_ref": booking.ID.Hex(), "currency": "LRD", "quote_id": quote["id"]})
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 paying with the quote, got %d: %v", code, out)
+	}
+	if code, _ := send(app, http.MethodPost, "/wallet/pay/balance", map[string]interface{}{"booking_ref": booking.ID.Hex(), "currency": "LRD", "quote_id": quote["id"]}); code != http.StatusConflict {
+		t.Fatalf("expected 409 paying the booking twice, got %d", code)
+	}
+	bal, _ := ledger.ComputeBalances(ctx, customer.ID)
+	if bal.Currency != "LRD" || bal.Available != 2400 || bal.Currencies["USD"].PendingHeld != 40 {
+		t.Fatalf("unexpected balances: %+v", bal)
+	}
+}
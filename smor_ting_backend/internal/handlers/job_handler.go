@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// JobHandler serves job requests and the quotes providers make on them
+type JobHandler struct {
+	jobs   *services.JobService
+	logger *logger.Logger
+}
+
+func NewJobHandler(jobs *services.JobService, logger *logger.Logger) *JobHandler {
+	return &JobHandler{jobs: jobs, logger: logger}
+}
+
+type jobRequestRequest struct {
+	Title         string         `json:"title"`
+	Description   string         `json:"description"`
+	CategoryID    string         `json:"category_id"`
+	Photos        []string       `json:"photos"`
+	Location      models.Address `json:"location"`
+	PreferredDate *time.Time     `json:"preferred_date"`
+}
+
+type quoteRequest struct {
+	Price         float64    `json:"price"`
+	Currency      string     `json:"currency"`
+	Duration      int        `json:"duration"`
+	ScheduledDate time.Time  `json:"scheduled_date"`
+	Message       string     `json:"message"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+type counterRequest struct {
+	Price   float64 `json:"price"`
+	Message string  `json:"message"`
+}
+
+type acceptQuoteRequest struct {
+	// PayWith is "wallet" (the default) to pay into escrow from the wallet balance,
+	// or "mobile_money" to pay the booking afterwards with POST /wallet/pay
+	PayWith string `json:"pay_with"`
+}
+
+// Create opens a job request for the authenticated customer
+func (h *JobHandler) Create(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req jobRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	in := services.JobRequestInput{
+		Title:         req.Title,
+		Description:   req.Description,
+		Photos:        req.Photos,
+		Location:      req.Location,
+		PreferredDate: req.PreferredDate,
+	}
+	if req.CategoryID != "" {
+		id, err := primitive.ObjectIDFromHex(req.CategoryID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+		}
+		in.CategoryID = &id
+	}
+	job, err := h.jobs.CreateRequest(c.Context(), user, in)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": job})
+}
+
+// List returns the caller's job requests
+func (h *JobHandler) List(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	jobs, err := h.jobs.ListRequests(c.Context(), user)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": jobs})
+}
+
+// Nearby lists open job requests within radius km (default 15, at most 100) of
+// lat/lng for providers to quote on, nearest first; category_id narrows them
+func (h *JobHandler) Nearby(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	latitude, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	longitude, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat != nil || errLng != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lat and lng are required"})
+	}
+	near := models.NewGeoPoint(latitude, longitude)
+	if near == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lat/lng out of range"})
+	}
+	radius, err := strconv.ParseFloat(c.Query("radius", strconv.Itoa(services.DefaultJobRadiusKm)), 64)
+	if err != nil || !(radius > 0 && radius <= services.MaxJobRadiusKm) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "radius must be between 0 and 100 km"})
+	}
+	var categoryID *primitive.ObjectID
+	if categoryHex := c.Query("category_id"); categoryHex != "" {
+		id, err := primitive.ObjectIDFromHex(categoryHex)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+		}
+		categoryID = &id
+	}
+	jobs, err := h.jobs.Nearby(c.Context(), user, near, radius, categoryID)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": jobs})
+}
+
+// Get returns a job request the caller may see
+func (h *JobHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid job request id")
+	if !ok {
+		return nil
+	}
+	job, err := h.jobs.GetRequest(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": job})
+}
+
+// Cancel withdraws the caller's open job request
+func (h *JobHandler) Cancel(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid job request id")
+	if !ok {
+		return nil
+	}
+	job, err := h.jobs.CancelRequest(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": job})
+}
+
+// Quotes lists the quotes on job request :id the caller may see
+func (h *JobHandler) Quotes(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid job request id")
+	if !ok {
+		return nil
+	}
+	quotes, err := h.jobs.Quotes(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": quotes})
+}
+
+// SubmitQuote makes or revises the calling provider's quote on job request :id
+func (h *JobHandler) SubmitQuote(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid job request id")
+	if !ok {
+		return nil
+	}
+	var req quoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	quote, err := h.jobs.SubmitQuote(c.Context(), user, id, services.QuoteInput{
+		Price:         req.Price,
+		Currency:      req.Currency,
+		Duration:      req.Duration,
+		ScheduledDate: req.ScheduledDate,
+		Message:       req.Message,
+		ExpiresAt:     req.ExpiresAt,
+	})
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": quote})
+}
+
+// MyQuotes lists the calling provider's quotes, newest first
+func (h *JobHandler) MyQuotes(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	quotes, err := h.jobs.ProviderQuotes(c.Context(), user, c.QueryInt("limit", 50))
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": quotes})
+}
+
+// Counter proposes another price for quote :id
+func (h *JobHandler) Counter(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid quote id")
+	if !ok {
+		return nil
+	}
+	var req counterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	quote, err := h.jobs.Counter(c.Context(), user, id, req.Price, req.Message)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": quote})
+}
+
+// Reject turns down quote :id
+func (h *JobHandler) Reject(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid quote id")
+	if !ok {
+		return nil
+	}
+	quote, err := h.jobs.Reject(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": quote})
+}
+
+// Accept books quote :id and starts escrow payment
+func (h *JobHandler) Accept(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := objectIDParam(c, "invalid quote id")
+	if !ok {
+		return nil
+	}
+	var req acceptQuoteRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+	}
+	if req.PayWith != "" && req.PayWith != "wallet" && req.PayWith != "mobile_money" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "pay_with must be wallet or mobile_money"})
+	}
+	acceptance, err := h.jobs.Accept(c.Context(), user, id, req.PayWith != "mobile_money")
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": acceptance})
+}
+
+func objectIDParam(c *fiber.Ctx, invalid string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": invalid})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func (h *JobHandler) fail(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidJobRequest), errors.Is(err, services.ErrInvalidQuote),
+		errors.Is(err, services.ErrInvalidBookingSchedule), errors.Is(err, models.ErrUnsupportedCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrBookingForbidden):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "you cannot quote on your own job"})
+	case errors.Is(err, services.ErrJobRequestNotFound), errors.Is(err, services.ErrQuoteNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrJobRequestClosed), errors.Is(err, services.ErrQuoteClosed),
+		errors.Is(err, services.ErrQuoteCountered), errors.Is(err, services.ErrSlotUnavailable):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrQuoteStateChanged), errors.Is(err, services.ErrJobRequestStateChanged):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "the quote changed; reload it and try again"})
+	}
+	h.logger.Error("Job request failed", err, zap.String("path", c.Path()))
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "job request failed"})
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestJobHandler_QuoteNegotiationEndsInABooking(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	jobs := services.NewJobService(services.NewMemoryJobStore(), repo, services.NewBookingService(repo, nil), nil)
+	h := handlers.NewJobHandler(jobs, lg)
+
+	customer := &models.User{Email: "customer@test.com", Role: models.CustomerRole}
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	for _, u := range []*models.User{customer, provider} {
+		if err := repo.CreateUser(context.TODO(), u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	routes := func(u *models.User) *fiber.App {
+		app := withUser(fiber.New(), u)
+		app.Post("/jobs", h.Create)
+		app.Get("/jobs", h.List)
+		app.Get("/jobs/nearby", h.Nearby)
+		app.Get("/jobs/:id", h.Get)
+		app.Get("/jobs/:id/quotes", h.Quotes)
+		app.Post("/jobs/:id/quotes", h.SubmitQuote)
+		app.Get("/quotes", h.MyQuotes)
+		app.Post("/quotes/:id/accept", h.Accept)
+		app.Post("/quotes/:id/counter", h.Counter)
+		app.Post("/quotes/:id/reject", h.Reject)
+		return app
+	}
+	customerApp, providerApp := routes(customer), routes(provider)
+
+	if resp, _ := doJSON(t, customerApp, http.MethodPost, "/jobs", map[string]interface{}{"title": "Fix roof"}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("a job without a location expected 400, got %d", resp.StatusCode)
+	}
+	resp, body := doJSON(t, customerApp, http.MethodPost, "/jobs", map[string]interface{}{
+		"title":    "Fix leaking zinc roof",
+		"location": map[string]interface{}{"city": "Monrovia", "latitude": 6.3005, "longitude": -10.7969},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	jobID := body["data"].(map[string]interface{})["id"].(string)
+
+	if resp, _ := doJSON(t, providerApp, http.MethodGet, "/jobs/nearby", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("nearby without lat/lng expected 400, got %d", resp.StatusCode)
+	}
+	if resp, _ := doJSON(t, providerApp, http.MethodGet, "/jobs/nearby?lat=6.27&lng=-10.77&radius=500", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("a 500 km radius expected 400, got %d", resp.StatusCode)
+	}
+	_, body = doJSON(t, providerApp, http.MethodGet, "/jobs/nearby?lat=6.2727&lng=-10.7725", nil)
+	if nearby := body["data"].([]interface{}); len(nearby) != 1 {
+		t.Fatalf("expected the job nearby, got %v", body)
+	}
+
+	start := openSlot(t, repo, &models.Service{ProviderID: provider.ID})
+	resp, body = doJSON(t, providerApp, http.MethodPost, "/jobs/"+jobID+"/quotes", map[string]interface{}{
+		"price": 200, "duration": 120, "scheduled_date": start, "message": "Sheets and labour",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("quote expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	quoteID := body["data"].(map[string]interface{})["id"].(string)
+
+	if resp, _ := doJSON(t, providerApp, http.MethodPost, "/quotes/"+quoteID+"/accept", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("only the job's customer accepts, got %d", resp.StatusCode)
+	}
+	resp, body = doJSON(t, customerApp, http.MethodPost, "/quotes/"+quoteID+"/counter", map[string]interface{}{"price": 150})
+	if resp.StatusCode != http.StatusOK || body["data"].(map[string]interface{})["status"] != "countered" {
+		t.Fatalf("counter expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	if resp, _ := doJSON(t, customerApp, http.MethodPost, "/quotes/"+quoteID+"/accept", nil); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("accepting a countered quote expected 409, got %d", resp.StatusCode)
+	}
+	if resp, body := doJSON(t, providerApp, http.MethodPost, "/jobs/"+jobID+"/quotes", map[string]interface{}{
+		"price": 170, "duration": 120, "scheduled_date": start,
+	}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revise expected 200, got %d: %v", resp.StatusCode, body)
+	}
+
+	if resp, _ := doJSON(t, customerApp, http.MethodPost, "/quotes/"+quoteID+"/accept", map[string]interface{}{"pay_with": "cash"}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("an unknown payment method expected 400, got %d", resp.StatusCode)
+	}
+	resp, body = doJSON(t, customerApp, http.MethodPost, "/quotes/"+quoteID+"/accept", map[string]interface{}{"pay_with": "mobile_money"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("accept expected 201, got %d: %v", resp.StatusCode, body)
+	}
+	booking := body["data"].(map[string]interface{})["booking"].(map[string]interface{})
+	if booking["total_amount"] != 170.0 || booking["status"] != "confirmed" {
+		t.Fatalf("expected a confirmed 170 booking, got %v", booking)
+	}
+
+	_, body = doJSON(t, customerApp, http.MethodGet, "/jobs/"+jobID, nil)
+	if body["data"].(map[string]interface{})["status"] != "booked" {
+		t.Fatalf("expected the job booked, got %v", body)
+	}
+	if resp, _ := doJSON(t, providerApp, http.MethodPost, "/jobs/"+jobID+"/quotes", map[string]interface{}{
+		"price": 160, "duration": 120, "scheduled_date": start,
+	}); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("quoting a booked job expected 409, got %d", resp.StatusCode)
+	}
+	_, body = doJSON(t, providerApp, http.MethodGet, "/quotes", nil)
+	if mine := body["data"].([]interface{}); len(mine) != 1 || mine[0].(map[string]interface{})["status"] != "accepted" {
+		t.Fatalf("expected the provider's accepted quote, got %v", body)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// LedgerIntegrityHandler lets operators read the encrypted ledger archive and check it for tampering
+type LedgerIntegrityHandler struct {
+	ledger *services.WalletLedgerService
+	logger *logger.Logger
+}
+
+func NewLedgerIntegrityHandler(ledger *services.WalletLedgerService, logger *logger.Logger) *LedgerIntegrityHandler {
+	return &LedgerIntegrityHandler{ledger: ledger, logger: logger}
+}
+
+// Verify checks the archive for ?user_id, or for every user, and reports tampered and missing entries
+func (h *LedgerIntegrityHandler) Verify(c *fiber.Ctx) error {
+	userID, ok := optionalUserID(c)
+	if !ok {
+		return nil
+	}
+	report, err := h.ledger.VerifyArchive(c.Context(), userID)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	if !report.OK() {
+		h.logger.Warn("Ledger archive failed integrity check", zap.Int("tampered", report.Tampered), zap.Int("missing", report.Missing))
+	}
+	return c.JSON(fiber.Map{"data": report, "ok": report.OK()})
+}
+
+// Entries returns ?user_id's decrypted archived entries, oldest first, up to ?limit
+func (h *LedgerIntegrityHandler) Entries(c *fiber.Ctx) error {
+	userID, ok := optionalUserID(c)
+	if !ok {
+		return nil
+	}
+	if userID.IsZero() {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "user_id is required"})
+	}
+	entries, err := h.ledger.ArchivedEntries(c.Context(), userID, c.QueryInt("limit", 0))
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": entries})
+}
+
+// Entry returns one decrypted archived entry
+func (h *LedgerIntegrityHandler) Entry(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid entry id"})
+	}
+	entry, err := h.ledger.ArchivedEntry(c.Context(), id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": entry})
+}
+
+func (h *LedgerIntegrityHandler) fail(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSecureLedgerRecordNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrLedgerRecordTampered):
+		h.logger.Warn("Archived ledger entry failed integrity check", zap.Error(err))
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrLedgerArchiveUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Failed to read ledger archive", err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read ledger archive"})
+}
+
+// optionalUserID parses ?user_id, writing a 400 and returning false when it is malformed
+func optionalUserID(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	raw := c.Query("user_id")
+	if raw == "" {
+		return primitive.NilObjectID, true
+	}
+	id, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_id"})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PayoutHandler lets admins run, inspect and retry provider payout batches
+type PayoutHandler struct {
+	payouts *services.PayoutService
+	logger  *logger.Logger
+}
+
+func NewPayoutHandler(payouts *services.PayoutService, logger *logger.Logger) *PayoutHandler {
+	return &PayoutHandler{payouts: payouts, logger: logger}
+}
+
+// List returns the newest batches
+func (h *PayoutHandler) List(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	batches, err := h.payouts.ListBatches(c.Context(), limit)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": batches})
+}
+
+// Run gathers and pays a batch now; 200 with no data when no balance is due
+func (h *PayoutHandler) Run(c *fiber.Ctx) error {
+	admin, _ := c.Locals("user").(*models.User)
+	batch, err := h.payouts.RunBatch(c.Context(), admin, auditContext(c))
+	if err != nil {
+		return h.fail(c, err)
+	}
+	if batch == nil {
+		return c.JSON(fiber.Map{"data": nil, "message": "no provider balances are due"})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": batch})
+}
+
+// Get returns the batch :id with its items
+func (h *PayoutHandler) Get(c *fiber.Ctx) error {
+	id, ok := batchID(c)
+	if !ok {
+		return nil
+	}
+	batch, err := h.payouts.GetBatch(c.Context(), id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	items, err := h.payouts.Items(c.Context(), id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": batch, "items": items})
+}
+
+// Refresh checks the batch's submitted transfers with the provider
+func (h *PayoutHandler) Refresh(c *fiber.Ctx) error {
+	id, ok := batchID(c)
+	if !ok {
+		return nil
+	}
+	batch, err := h.payouts.Refresh(c.Context(), id)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": batch})
+}
+
+// Retry sends the batch's failed items again
+func (h *PayoutHandler) Retry(c *fiber.Ctx) error {
+	id, ok := batchID(c)
+	if !ok {
+		return nil
+	}
+	admin, _ := c.Locals("user").(*models.User)
+	batch, err := h.payouts.Retry(c.Context(), admin, id, auditContext(c))
+	if err != nil {
+		return h.fail(c, err)
+	}
+	return c.JSON(fiber.Map{"data": batch})
+}
+
+func batchID(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid batch id"})
+		return id, false
+	}
+	return id, true
+}
+
+func (h *PayoutHandler) fail(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrPayoutBatchNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Payout request failed", err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payout request failed"})
+}
@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestPayouts_AdminRunsAndTracksBatch(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	provider := &models.User{Email: "earner@example.com", Phone: "231770000031", Role: models.ProviderRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, provider)
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: provider.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 80, Currency: "USD", Status: models.LedgerCompleted, Reference: "earned"})
+
+	key, _ := services.GenerateEncryptionKey()
+	enc, _ := services.NewEncryptionService(key)
+	providers := services.NewPaymentProviders(services.NewMomoProvider(&fakeMomo{online: true}))
+	webhooks := services.NewMomoWebhookService(nil, ledger, nil, nil, nil)
+	payouts := services.NewPayoutService(nil, repo, ledger, providers, nil, enc, webhooks, services.PayoutPolicy{
+		Minimums: map[string]float64{"USD": 5},
+	}, nil, nil)
+	h := handlers.NewPayoutHandler(payouts, lg)
+
+	app := withUser(fiber.New(), &models.User{Email: "admin@example.com", Role: models.AdminRole})
+	app.Post("/admin/payouts", h.Run)
+	app.Get("/admin/payouts/:id", h.Get)
+	app.Post("/admin/payouts/:id/refresh", h.Refresh)
+
+	send := func(method, path string) (int, map[string]interface{}) {
+		resp, _ := app.Test(httptest.NewRequest(method, path, nil))
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	code, out := send(http.MethodPost, "/admin/payouts")
+	data, _ := out["data"].(map[string]interface{})
+	if code != http.StatusCreated || data["item_count"] != float64(1) {
+		t.Fatalf("expected a batch with one payout, got %d %v", code, out)
+	}
+	id, _ := data["id"].(string)
+	if code, out := send(http.MethodPost, "/admin/payouts"); code != http.StatusOK || out["data"] != nil {
+		t.Fatalf("expected nothing due while the payout is in flight, got %d %v", code, out)
+	}
+
+	code, out = send(http.MethodPost, "/admin/payouts/"+id+"/refresh")
+	data, _ = out["data"].(map[string]interface{})
+	if code != http.StatusOK || data["status"] != string(models.PayoutBatchCompleted) {
+		t.Fatalf("expected the batch to complete, got %d %v", code, out)
+	}
+	code, out = send(http.MethodGet, "/admin/payouts/"+id)
+	items, _ := out["items"].([]interface{})
+	if code != http.StatusOK || len(items) != 1 || items[0].(map[string]interface{})["status"] != string(models.PayoutItemCompleted) {
+		t.Fatalf("expected the completed item, got %d %v", code, out)
+	}
+	if code, _ := send(http.MethodGet, "/admin/payouts/"+"64b7f0f0f0f0f0f0f0f0f0f0"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown batch, got %d", code)
+	}
+}
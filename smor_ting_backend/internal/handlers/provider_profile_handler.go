@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// maxServiceAreas bounds how many communities a provider can claim to serve
+const maxServiceAreas = 20
+
+// ProviderProfileHandler serves provider business profiles, whose name and
+// service areas the service search matches against
+type ProviderProfileHandler struct {
+	repo   database.Repository
+	logger *logger.Logger
+}
+
+func NewProviderProfileHandler(repo database.Repository, logger *logger.Logger) *ProviderProfileHandler {
+	return &ProviderProfileHandler{repo: repo, logger: logger}
+}
+
+type providerProfileRequest struct {
+	BusinessName   string   `json:"business_name"`
+	Description    string   `json:"description"`
+	Experience     int      `json:"experience"`
+	Certifications []string `json:"certifications"`
+	ServiceAreas   []string `json:"service_areas"`
+}
+
+// Get returns the profile of the provider with user ID :id
+func (h *ProviderProfileHandler) Get(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid provider id"})
+	}
+	profile, err := h.repo.GetServiceProviderByUserID(c.Context(), userID)
+	if err != nil {
+		return h.fail(c, userID, err)
+	}
+	return c.JSON(fiber.Map{"data": profile})
+}
+
+// Update creates or replaces the caller's profile. Verification, rating and
+// job counts are kept as they were.
+func (h *ProviderProfileHandler) Update(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req providerProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	req.BusinessName = strings.TrimSpace(req.BusinessName)
+	if req.BusinessName == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "business_name is required"})
+	}
+	if req.Experience < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "experience cannot be negative"})
+	}
+	areas := make([]string, 0, len(req.ServiceAreas))
+	for _, area := range req.ServiceAreas {
+		if area = strings.TrimSpace(area); area != "" {
+			areas = append(areas, area)
+		}
+	}
+	if len(areas) > maxServiceAreas {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "too many service_areas"})
+	}
+
+	profile, err := h.repo.GetServiceProviderByUserID(c.Context(), user.ID)
+	if errors.Is(err, database.ErrServiceProviderNotFound) {
+		profile, err = &models.ServiceProvider{UserID: user.ID}, nil
+	}
+	if err != nil {
+		return h.fail(c, user.ID, err)
+	}
+	profile.BusinessName = req.BusinessName
+	profile.Description = req.Description
+	profile.Experience = req.Experience
+	profile.Certifications = req.Certifications
+	profile.ServiceAreas = areas
+
+	if err := h.repo.UpsertServiceProvider(c.Context(), profile); err != nil {
+		return h.fail(c, user.ID, err)
+	}
+	return c.JSON(fiber.Map{"data": profile})
+}
+
+func (h *ProviderProfileHandler) fail(c *fiber.Ctx, userID primitive.ObjectID, err error) error {
+	if errors.Is(err, database.ErrServiceProviderNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Provider profile request failed", err, zap.String("user_id", userID.Hex()))
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load provider profile"})
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestProviderProfile_FeedsTextSearch(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	ctx := context.TODO()
+	provider := &models.User{Email: "breeze@test.com", Role: models.ProviderRole}
+	if err := repo.CreateUser(ctx, provider); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	profiles := handlers.NewProviderProfileHandler(repo, lg)
+	search := handlers.NewServiceHandler(repo, lg)
+	app := withUser(fiber.New(), provider)
+	app.Put("/providers/profile", profiles.Update)
+	app.Get("/providers/:id/profile", profiles.Get)
+	app.Get("/services/search", search.Search)
+
+	if resp, _ := doJSON(t, app, http.MethodGet, "/providers/"+provider.ID.Hex()+"/profile", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 before the profile exists, got %d", resp.StatusCode)
+	}
+	if resp, _ := doJSON(t, app, http.MethodPut, "/providers/profile", map[string]interface{}{"business_name": " "}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a blank business name to be rejected, got %d", resp.StatusCode)
+	}
+	resp, body := doJSON(t, app, http.MethodPut, "/providers/profile", map[string]interface{}{
+		"business_name": "Cool Breeze Aircon", "service_areas": []string{"Paynesville", " ", "Red Light"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the profile to save, got %d: %v", resp.StatusCode, body)
+	}
+	if areas := body["data"].(map[string]interface{})["service_areas"].([]interface{}); len(areas) != 2 {
+		t.Fatalf("expected blank areas to be dropped, got %v", areas)
+	}
+
+	service := &models.Service{Name: "Split unit servicing", ProviderID: provider.ID, Price: 30, IsActive: true}
+	if err := repo.CreateService(ctx, service); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	_, body = doJSON(t, app, http.MethodGet, "/services/search?q="+url.QueryEscape("air conditioner Paynsville"), nil)
+	data := body["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("expected the provider's service to match, got %v", body)
+	}
+	hit := data[0].(map[string]interface{})
+	if hit["provider"].(map[string]interface{})["business_name"] != "Cool Breeze Aircon" || hit["relevance"].(float64) <= 0 {
+		t.Fatalf("unexpected hit %+v", hit)
+	}
+
+	_, body = doJSON(t, app, http.MethodGet, "/services/search?q=aircon+Sinkor", nil)
+	if len(body["data"].([]interface{})) != 0 {
+		t.Fatalf("expected no match outside the provider's areas, got %v", body["data"])
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+// ReconciliationHandler lets operators run MoMo reconciliation on demand and read the daily reports
+type ReconciliationHandler struct {
+	reconciler *services.MomoReconciler
+	logger     *logger.Logger
+}
+
+func NewReconciliationHandler(reconciler *services.MomoReconciler, logger *logger.Logger) *ReconciliationHandler {
+	return &ReconciliationHandler{reconciler: reconciler, logger: logger}
+}
+
+// Run polls MoMo for stale pending entries now instead of waiting for the next scheduled run
+func (h *ReconciliationHandler) Run(c *fiber.Ctx) error {
+	res, err := h.reconciler.RunOnce(c.Context())
+	if err != nil {
+		h.logger.Error("Manual reconciliation run failed", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reconciliation failed"})
+	}
+	return c.JSON(fiber.Map{"data": res})
+}
+
+// GetReport returns the saved report for :date (YYYY-MM-DD)
+func (h *ReconciliationHandler) GetReport(c *fiber.Ctx) error {
+	date := c.Params("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	report, err := h.reconciler.Report(c.Context(), date)
+	if errors.Is(err, services.ErrReconciliationReportNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no report for date"})
+	}
+	if err != nil {
+		h.logger.Error("Failed to load reconciliation report", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load report"})
+	}
+	return c.JSON(fiber.Map{"data": report})
+}
+
+// GenerateReport rebuilds the report for :date (YYYY-MM-DD) against MoMo's current view
+func (h *ReconciliationHandler) GenerateReport(c *fiber.Ctx) error {
+	day, err := time.Parse("2006-01-02", c.Params("date"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	report, err := h.reconciler.GenerateReport(c.Context(), day)
+	if err != nil {
+		h.logger.Error("Failed to generate reconciliation report", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate report"})
+	}
+	return c.JSON(fiber.Map{"data": report})
+}
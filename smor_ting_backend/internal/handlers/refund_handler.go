@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// RefundHandler lets admins return card, mobile money, wallet and escrow payments
+type RefundHandler struct {
+	refunds *services.RefundService
+	logger  *logger.Logger
+}
+
+func NewRefundHandler(refunds *services.RefundService, logger *logger.Logger) *RefundHandler {
+	return &RefundHandler{refunds: refunds, logger: logger}
+}
+
+// Create issues a refund described by the body: kind, source, amount (0 for the rest), reason and note
+func (h *RefundHandler) Create(c *fiber.Ctx) error {
+	var req services.RefundRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	return h.refund(c, req)
+}
+
+// RefundPayment refunds the card charge :id; the body carries amount, reason and note
+func (h *RefundHandler) RefundPayment(c *fiber.Ctx) error {
+	var req services.RefundRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	req.Kind = models.RefundCard
+	req.Source = c.Params("id")
+	return h.refund(c, req)
+}
+
+func (h *RefundHandler) refund(c *fiber.Ctx, req services.RefundRequest) error {
+	admin, _ := c.Locals("user").(*models.User)
+	refund, err := h.refunds.Refund(c.Context(), admin, req, auditContext(c))
+	if err != nil {
+		return h.fail(c, refund, err)
+	}
+	status := http.StatusOK
+	if refund.Status == models.RefundPending {
+		status = http.StatusAccepted
+	}
+	return c.Status(status).JSON(fiber.Map{"data": refund})
+}
+
+// List returns the newest refunds; ?user_id narrows them to one customer
+func (h *RefundHandler) List(c *fiber.Ctx) error {
+	var userID *primitive.ObjectID
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_id"})
+		}
+		userID = &id
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	refunds, err := h.refunds.List(c.Context(), userID, limit)
+	if err != nil {
+		return h.fail(c, nil, err)
+	}
+	return c.JSON(fiber.Map{"data": refunds})
+}
+
+func (h *RefundHandler) Get(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid refund id"})
+	}
+	refund, err := h.refunds.Get(c.Context(), id)
+	if err != nil {
+		return h.fail(c, nil, err)
+	}
+	return c.JSON(fiber.Map{"data": refund})
+}
+
+// fail maps refund errors onto responses; a refund that was recorded but failed is returned with the error
+func (h *RefundHandler) fail(c *fiber.Ctx, refund *models.Refund, err error) error {
+	body := fiber.Map{"error": err.Error()}
+	if refund != nil {
+		body["data"] = refund
+	}
+	switch {
+	case errors.Is(err, services.ErrRefundNotFound), errors.Is(err, services.ErrRefundSourceNotFound):
+		return c.Status(http.StatusNotFound).JSON(body)
+	case errors.Is(err, services.ErrInvalidRefundRequest), errors.Is(err, services.ErrUnknownPaymentProvider):
+		return c.Status(http.StatusBadRequest).JSON(body)
+	case errors.Is(err, services.ErrRefundNotRefundable):
+		return c.Status(http.StatusConflict).JSON(body)
+	case errors.Is(err, services.ErrRefundAmountExceeded), errors.Is(err, services.ErrRefundInsufficientFunds):
+		return c.Status(http.StatusUnprocessableEntity).JSON(body)
+	case errors.Is(err, services.ErrRefundUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(body)
+	case refund != nil:
+		// The payment provider or gateway refused the refund
+		h.logger.Error("Refund failed", err, zap.String("refund_id", refund.ID.Hex()), zap.String("kind", string(refund.Kind)))
+		body["error"] = "refund failed"
+		return c.Status(http.StatusBadGateway).JSON(body)
+	default:
+		h.logger.Error("Refund request failed", err, zap.String("path", c.Path()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "refund failed"})
+	}
+}
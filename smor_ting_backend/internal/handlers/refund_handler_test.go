@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func TestRefunds_CardRefundAndErrors(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	key := make([]byte, 32)
+	pci, err := services.NewPCIDSSService(key, zap.NewNop())
+	if err != nil {
+		t.Fatalf("pci: %v", err)
+	}
+	pci.SetTokenTTL(time.Hour)
+	pci.SetGateway(services.NewFakeCardGateway(), "https://api.example.com/api/v1/payments/3ds/return")
+	customer := primitive.NewObjectID().Hex()
+	token, err := pci.TokenizePaymentMethod(&services.SensitivePaymentData{CardNumber: services.FakeCardApproved, CVV: "123", ExpiryMonth: "12", ExpiryYear: "2030"}, customer)
+	if err != nil {
+		t.Fatalf("tokenize: %v", err)
+	}
+	charge, err := pci.ProcessPayment(context.Background(), &services.PaymentRequest{Amount: 30, Currency: "USD", TokenID: token.TokenID, CustomerID: customer})
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	refunds := services.NewRefundService(nil, repo, services.NewWalletLedgerService(repo), nil, pci, nil, nil, nil)
+	h := handlers.NewRefundHandler(refunds, lg)
+	app := withUser(fiber.New(), &models.User{ID: primitive.NewObjectID(), Email: "admin@example.com", Role: models.AdminRole})
+	app.Post("/admin/refunds", h.Create)
+	app.Post("/admin/payments/:id/refund", h.RefundPayment)
+	app.Get("/admin/refunds/:id", h.Get)
+
+	post := func(path string, body map[string]interface{}) (*http.Response, map[string]interface{}) {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	resp, out := post("/admin/refunds", map[string]interface{}{"kind": "card", "source": charge.TransactionID, "amount": 10, "reason": "provider_no_show", "note": "provider never arrived"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %v", resp.StatusCode, out)
+	}
+	data := out["data"].(map[string]interface{})
+	if data["status"] != "completed" || data["reason"] != "provider_no_show" {
+		t.Fatalf("unexpected refund: %v", data)
+	}
+
+	if resp, _ := post("/admin/payments/"+charge.TransactionID+"/refund", map[string]interface{}{"amount": 25, "reason": "other"}); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 when refunding more than is left, got %d", resp.StatusCode)
+	}
+	if resp, _ := post("/admin/refunds", map[string]interface{}{"kind": "card", "source": "missing", "reason": "other"}); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown charge, got %d", resp.StatusCode)
+	}
+	if resp, _ := post("/admin/refunds", map[string]interface{}{"kind": "card", "source": charge.TransactionID}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a reason, got %d", resp.StatusCode)
+	}
+
+	get, _ := app.Test(httptest.NewRequest(http.MethodGet, "/admin/refunds/"+data["id"].(string), nil))
+	if get.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 fetching the refund, got %d", get.StatusCode)
+	}
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// ServiceHandler exposes the provider service catalog backed by the repository
+type ServiceHandler struct {
+	repo       database.Repository
+	categories *services.CategoryService
+	logger     *logger.Logger
+}
+
+func NewServiceHandler(repo database.Repository, logger *logger.Logger) *ServiceHandler {
+	return &ServiceHandler{repo: repo, logger: logger}
+}
+
+// SetCategories makes Create and Update reject services filed under unknown or inactive categories
+func (h *ServiceHandler) SetCategories(categories *services.CategoryService) {
+	h.categories = categories
+}
+
+const (
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 100
+	defaultSearchRadiusKm = 10
+	maxSearchRadiusKm     = 100
+	maxSearchTextLength   = 200
+)
+
+type serviceRequest struct {
+	Name        *string         `json:"name"`
+	Description *string         `json:"description"`
+	CategoryID  *string         `json:"category_id"`
+	ProviderID  *string         `json:"provider_id"` // admin only, ignored for providers
+	Price       *float64        `json:"price"`
+	Currency    *string         `json:"currency"`
+	Duration    *int            `json:"duration"`
+	Images      []string        `json:"images"`
+	Location    *models.Address `json:"location"`
+	IsActive    *bool           `json:"is_active"`
+}
+
+// List returns active services, optionally filtered by category and location.
+// When provider_id is given, the provider's own catalog is returned; inactive
+// entries are only visible to that provider or an admin.
+func (h *ServiceHandler) List(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if providerHex := c.Query("provider_id"); providerHex != "" {
+		providerID, err := primitive.ObjectIDFromHex(providerHex)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid provider_id"})
+		}
+		list, err := h.repo.GetProviderServices(c.Context(), providerID)
+		if err != nil {
+			h.logger.Error("Failed to list provider services", err, zap.String("provider_id", providerHex))
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list services"})
+		}
+		if !canManageService(user, providerID) {
+			list = activeOnly(list)
+		}
+		return c.JSON(fiber.Map{"data": nonNilServices(list)})
+	}
+
+	var categoryID *primitive.ObjectID
+	if categoryHex := c.Query("category_id"); categoryHex != "" {
+		id, err := primitive.ObjectIDFromHex(categoryHex)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+		}
+		categoryID = &id
+	}
+
+	var location *models.Address
+	var radius float64
+	if lat, lng := c.Query("lat"), c.Query("lng"); lat != "" && lng != "" {
+		latitude, errLat := strconv.ParseFloat(lat, 64)
+		longitude, errLng := strconv.ParseFloat(lng, 64)
+		if errLat != nil || errLng != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid lat/lng"})
+		}
+		if models.NewGeoPoint(latitude, longitude) == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lat/lng out of range"})
+		}
+		location = &models.Address{Latitude: latitude, Longitude: longitude}
+		radius, _ = strconv.ParseFloat(c.Query("radius", "10"), 64)
+	}
+
+	list, err := h.repo.GetServices(c.Context(), categoryID, location, radius)
+	if err != nil {
+		h.logger.Error("Failed to list services", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list services"})
+	}
+	return c.JSON(fiber.Map{"data": nonNilServices(list)})
+}
+
+// Search is the public service search. q is free text ("AC repair Paynesville")
+// matched with typo tolerance and synonyms against services and provider
+// profiles; place names in it filter by place. It also filters by category_id,
+// price range (min_price, max_price) and min_rating and, given lat/lng, by
+// distance within radius km. Results are ranked by a blend of text relevance,
+// distance, rating and completed jobs.
+func (h *ServiceHandler) Search(c *fiber.Ctx) error {
+	q := database.ServiceSearch{Text: c.Query("q"), Limit: c.QueryInt("limit", defaultSearchLimit)}
+	if q.Limit <= 0 || q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+	if len(q.Text) > maxSearchTextLength {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "q is too long"})
+	}
+
+	if categoryHex := c.Query("category_id"); categoryHex != "" {
+		id, err := primitive.ObjectIDFromHex(categoryHex)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid category_id"})
+		}
+		q.CategoryID = &id
+	}
+
+	lat, lng := c.Query("lat"), c.Query("lng")
+	if (lat == "") != (lng == "") {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lat and lng must be given together"})
+	}
+	if lat != "" {
+		latitude, errLat := strconv.ParseFloat(lat, 64)
+		longitude, errLng := strconv.ParseFloat(lng, 64)
+		if errLat != nil || errLng != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid lat/lng"})
+		}
+		if q.Near = models.NewGeoPoint(latitude, longitude); q.Near == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lat/lng out of range"})
+		}
+		radius, err := strconv.ParseFloat(c.Query("radius", strconv.Itoa(defaultSearchRadiusKm)), 64)
+		if err != nil || !(radius > 0 && radius <= maxSearchRadiusKm) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "radius must be between 0 and 100 km"})
+		}
+		q.RadiusKm = radius
+	}
+
+	var msg string
+	if q.MinPrice, msg = nonNegativeQuery(c, "min_price"); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if q.MaxPrice, msg = nonNegativeQuery(c, "max_price"); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if q.MaxPrice > 0 && q.MinPrice > q.MaxPrice {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "min_price cannot exceed max_price"})
+	}
+	if q.MinRating, msg = nonNegativeQuery(c, "min_rating"); msg != "" || q.MinRating > 5 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "min_rating must be between 0 and 5"})
+	}
+
+	results, err := h.repo.SearchServices(c.Context(), q)
+	if err != nil {
+		h.logger.Error("Failed to search services", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to search services"})
+	}
+	return c.JSON(fiber.Map{"data": results})
+}
+
+// Get returns a single service; soft-deleted services are hidden from everyone but the owner and admins
+func (h *ServiceHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	service, status, msg := h.loadService(c)
+	if service == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !service.IsActive && !canManageService(user, service.ProviderID) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "service not found"})
+	}
+	return c.JSON(fiber.Map{"data": service})
+}
+
+// Create adds a service to the caller's catalog (admins may create on behalf of
+// a provider). Every new service must be filed under an active category.
+func (h *ServiceHandler) Create(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var req serviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if req.Name == nil || *req.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+	if req.Price == nil || *req.Price <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "price must be greater than 0"})
+	}
+
+	service := &models.Service{
+		ProviderID: user.ID,
+		Currency:   user.Wallet.Currency,
+		IsActive:   true,
+	}
+	if user.Role == models.AdminRole && req.ProviderID != nil {
+		providerID, err := primitive.ObjectIDFromHex(*req.ProviderID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid provider_id"})
+		}
+		service.ProviderID = providerID
+	}
+	if msg := applyServiceRequest(service, &req); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if service.CategoryID.IsZero() {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "category_id is required"})
+	}
+	if !h.categoryUsable(c, service.CategoryID) {
+		return nil
+	}
+	if service.Currency == "" {
+		service.Currency = "USD"
+	}
+
+	if err := h.repo.CreateService(c.Context(), service); err != nil {
+		h.logger.Error("Failed to create service", err, zap.String("provider_id", service.ProviderID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create service"})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": service})
+}
+
+// Update applies a partial update to a service owned by the caller
+func (h *ServiceHandler) Update(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	service, status, msg := h.loadService(c)
+	if service == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !canManageService(user, service.ProviderID) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "you can only modify your own services"})
+	}
+
+	var req serviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if req.Name != nil && *req.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name cannot be empty"})
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "price must be greater than 0"})
+	}
+	previousCategory := service.CategoryID
+	if msg := applyServiceRequest(service, &req); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	// Services already in a category that has since been deactivated may still be edited
+	if service.CategoryID != previousCategory && !h.categoryUsable(c, service.CategoryID) {
+		return nil
+	}
+
+	if err := h.repo.UpdateService(c.Context(), service); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "service was modified concurrently, retry"})
+		}
+		h.logger.Error("Failed to update service", err, zap.String("service_id", service.ID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update service"})
+	}
+	return c.JSON(fiber.Map{"data": service})
+}
+
+// Delete soft-deletes a service owned by the caller by clearing IsActive
+func (h *ServiceHandler) Delete(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	service, status, msg := h.loadService(c)
+	if service == nil {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if !canManageService(user, service.ProviderID) {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "you can only modify your own services"})
+	}
+
+	if err := h.repo.DeleteService(c.Context(), service.ID); err != nil {
+		h.logger.Error("Failed to delete service", err, zap.String("service_id", service.ID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete service"})
+	}
+	return c.JSON(fiber.Map{"status": "deleted", "id": service.ID.Hex()})
+}
+
+// categoryUsable checks that services may be filed under the category, writing the error response when not
+func (h *ServiceHandler) categoryUsable(c *fiber.Ctx, id primitive.ObjectID) bool {
+	if h.categories == nil {
+		return true
+	}
+	err := h.categories.RequireActive(c.Context(), id)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrCategoryNotFound):
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unknown category_id"})
+	case errors.Is(err, services.ErrCategoryInactive):
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "category is not active"})
+	default:
+		h.logger.Error("Failed to check service category", err, zap.String("category_id", id.Hex()))
+		_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to check category"})
+	}
+	return false
+}
+
+// loadService resolves the :id route param; on failure it returns the HTTP status and message to send
+func (h *ServiceHandler) loadService(c *fiber.Ctx) (*models.Service, int, string) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, "invalid service id"
+	}
+	service, err := h.repo.GetServiceByID(c.Context(), id)
+	if err != nil {
+		return nil, http.StatusNotFound, "service not found"
+	}
+	return service, 0, ""
+}
+
+// applyServiceRequest copies the set fields of req onto service and returns a validation message on failure
+func applyServiceRequest(service *models.Service, req *serviceRequest) string {
+	if req.Name != nil {
+		service.Name = *req.Name
+	}
+	if req.Description != nil {
+		service.Description = *req.Description
+	}
+	if req.CategoryID != nil {
+		categoryID, err := primitive.ObjectIDFromHex(*req.CategoryID)
+		if err != nil {
+			return "invalid category_id"
+		}
+		service.CategoryID = categoryID
+	}
+	if req.Price != nil {
+		service.Price = *req.Price
+	}
+	if req.Currency != nil && *req.Currency != "" {
+		service.Currency = *req.Currency
+	}
+	if req.Duration != nil {
+		if *req.Duration < 0 {
+			return "duration cannot be negative"
+		}
+		service.Duration = *req.Duration
+	}
+	if req.Images != nil {
+		service.Images = req.Images
+	}
+	if req.Location != nil {
+		service.Location = *req.Location
+	}
+	if req.IsActive != nil {
+		service.IsActive = *req.IsActive
+	}
+	return ""
+}
+
+// nonNegativeQuery parses an optional non-negative number query param; absent is 0
+func nonNegativeQuery(c *fiber.Ctx, key string) (float64, string) {
+	raw := c.Query(key)
+	if raw == "" {
+		return 0, ""
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || !(v >= 0) || math.IsInf(v, 1) {
+		return 0, "invalid " + key
+	}
+	return v, ""
+}
+
+func canManageService(user *models.User, providerID primitive.ObjectID) bool {
+	return user.Role == models.AdminRole || user.ID == providerID
+}
+
+func activeOnly(list []models.Service) []models.Service {
+	out := make([]models.Service, 0, len(list))
+	for _, s := range list {
+		if s.IsActive {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func nonNilServices(list []models.Service) []models.Service {
+	if list == nil {
+		return []models.Service{}
+	}
+	return list
+}
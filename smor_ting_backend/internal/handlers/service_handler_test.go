@@ -0,0 +1,186 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newServiceApp(h *handlers.ServiceHandler, u *models.User) *fiber.App {
+	app := withUser(fiber.New(), u)
+	app.Get("/services", h.List)
+	app.Post("/services", h.Create)
+	app.Get("/services/:id", h.Get)
+	app.Put("/services/:id", h.Update)
+	app.Delete("/services/:id", h.Delete)
+	return app
+}
+
+func doJSON(t *testing.T, app *fiber.App, method, path string, body interface{}) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	var req *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		req = httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func TestServiceHandler_CRUDWithOwnership(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	h := handlers.NewServiceHandler(repo, lg)
+
+	owner := &models.User{Email: "owner@test.com", Role: models.ProviderRole}
+	other := &models.User{Email: "other@test.com", Role: models.ProviderRole}
+	customer := &models.User{Email: "customer@test.com", Role: models.CustomerRole}
+	for _, u := range []*models.User{owner, other, customer} {
+		if err := repo.CreateUser(context.TODO(), u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	ownerApp := newServiceApp(h, owner)
+	otherApp := newServiceApp(h, other)
+	customerApp := newServiceApp(h, customer)
+
+	// Create
+	resp, body := doJSON(t, ownerApp, http.MethodPost, "/services", map[string]interface{}{"name": "Pipe repair", "price": 25.0, "currency": "USD", "duration": 60, "category_id": primitive.NewObjectID().Hex()})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d", resp.StatusCode)
+	}
+	data := body["data"].(map[string]interface{})
+	id := data["id"].(string)
+	if data["provider_id"].(string) != owner.ID.Hex() || data["version"].(float64) != 1 {
+		t.Fatalf("unexpected created service: %+v", data)
+	}
+
+	// Public list includes it
+	_, body = doJSON(t, customerApp, http.MethodGet, "/services", nil)
+	if len(body["data"].([]interface{})) != 1 {
+		t.Fatalf("expected 1 listed service, got %v", body["data"])
+	}
+	if resp, _ := doJSON(t, customerApp, http.MethodGet, "/services?lat=6.3&lng=200", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("out of range lat/lng expected 400, got %d", resp.StatusCode)
+	}
+
+	// Another provider cannot update or delete it
+	resp, _ = doJSON(t, otherApp, http.MethodPut, "/services/"+id, map[string]interface{}{"price": 1.0})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign update expected 403, got %d", resp.StatusCode)
+	}
+	resp, _ = doJSON(t, otherApp, http.MethodDelete, "/services/"+id, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign delete expected 403, got %d", resp.StatusCode)
+	}
+
+	// Owner update bumps version
+	resp, body = doJSON(t, ownerApp, http.MethodPut, "/services/"+id, map[string]interface{}{"price": 30.0})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update expected 200, got %d", resp.StatusCode)
+	}
+	data = body["data"].(map[string]interface{})
+	if data["price"].(float64) != 30 || data["version"].(float64) != 2 || data["name"].(string) != "Pipe repair" {
+		t.Fatalf("unexpected updated service: %+v", data)
+	}
+
+	// Soft delete hides it from customers but not from the owner
+	resp, _ = doJSON(t, ownerApp, http.MethodDelete, "/services/"+id, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = doJSON(t, customerApp, http.MethodGet, "/services/"+id, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("deleted service expected 404 for customer, got %d", resp.StatusCode)
+	}
+	_, body = doJSON(t, customerApp, http.MethodGet, "/services", nil)
+	if len(body["data"].([]interface{})) != 0 {
+		t.Fatalf("deleted service should not be listed: %v", body["data"])
+	}
+	_, body = doJSON(t, ownerApp, http.MethodGet, "/services?provider_id="+owner.ID.Hex(), nil)
+	list := body["data"].([]interface{})
+	if len(list) != 1 || list[0].(map[string]interface{})["is_active"].(bool) {
+		t.Fatalf("owner should see own inactive service: %v", list)
+	}
+}
+
+func TestMemoryUpdateService_RejectsStaleVersion(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	svc := &models.Service{Name: "Wiring", Price: 10, IsActive: true}
+	if err := repo.CreateService(context.TODO(), svc); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	first, _ := repo.GetServiceByID(context.TODO(), svc.ID)
+	second, _ := repo.GetServiceByID(context.TODO(), svc.ID)
+
+	first.Price = 12
+	if err := repo.UpdateService(context.TODO(), first); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	second.Price = 15
+	if err := repo.UpdateService(context.TODO(), second); err != database.ErrVersionConflict {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+}
+
+func TestServiceHandler_PublicSearch(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	h := handlers.NewServiceHandler(repo, lg)
+	app := fiber.New()
+	app.Get("/services/search", h.Search)
+
+	ctx := context.TODO()
+	provider := primitive.NewObjectID()
+	near := &models.Service{Name: "Sinkor plumber", ProviderID: provider, Price: 20, Rating: 4.5, IsActive: true,
+		Location: models.Address{Latitude: 6.2950, Longitude: -10.7800}}
+	far := &models.Service{Name: "Buchanan plumber", ProviderID: provider, Price: 20, Rating: 5, IsActive: true,
+		Location: models.Address{Latitude: 5.8808, Longitude: -10.0467}}
+	for _, s := range []*models.Service{near, far} {
+		if err := repo.CreateService(ctx, s); err != nil {
+			t.Fatalf("create service: %v", err)
+		}
+	}
+
+	resp, body := doJSON(t, app, http.MethodGet, "/services/search?lat=6.3156&lng=-10.8074&radius=20&min_rating=4", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("search expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	data := body["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("expected only the nearby service, got %v", data)
+	}
+	hit := data[0].(map[string]interface{})
+	if hit["service"].(map[string]interface{})["id"] != near.ID.Hex() || hit["distance_km"].(float64) > 5 {
+		t.Fatalf("unexpected result %+v", hit)
+	}
+
+	_, body = doJSON(t, app, http.MethodGet, "/services/search?min_price=10&max_price=30", nil)
+	if len(body["data"].([]interface{})) != 2 {
+		t.Fatalf("expected both services without a location, got %v", body["data"])
+	}
+
+	for _, bad := range []string{"lat=6.3", "lat=95&lng=0", "lat=6&lng=-10&radius=500", "min_price=50&max_price=10", "min_rating=6", "category_id=x"} {
+		if resp, _ := doJSON(t, app, http.MethodGet, "/services/search?"+bad, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", bad, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// TransferHandler serves wallet-to-wallet transfers and the wallet PIN that authorises large ones
+type TransferHandler struct {
+	transfers *services.TransferService
+	logger    *logger.Logger
+}
+
+func NewTransferHandler(transfers *services.TransferService, logger *logger.Logger) *TransferHandler {
+	return &TransferHandler{transfers: transfers, logger: logger}
+}
+
+type SendTransferRequest struct {
+	Recipient string `json:"recipient"` // phone number or email
+	Amount    string `json:"amount"`
+	Currency  string `json:"currency"`
+	Note      string `json:"note"`
+	PIN       string `json:"pin"`
+}
+
+type ConfirmTransferRequest struct {
+	Code string `json:"code"`
+}
+
+type SetWalletPINRequest struct {
+	PIN        string `json:"pin"`
+	CurrentPIN string `json:"current_pin"`
+}
+
+// Lookup finds the recipient for ?q, a phone number or email, so the sender can check who they are paying
+func (h *TransferHandler) Lookup(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	recipient, err := h.transfers.Lookup(c.Context(), user, c.Query("q"))
+	if err != nil {
+		return h.fail(c, user, err)
+	}
+	return c.JSON(fiber.Map{"data": recipient})
+}
+
+// Send transfers funds to another user. Transfers above the step-up threshold
+// need "pin"; without a PIN set, they are accepted (202) pending the code sent
+// to the sender's phone.
+func (h *TransferHandler) Send(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req SendTransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid amount"})
+	}
+	t, err := h.transfers.Send(c.Context(), user, services.WalletTransferRequest{
+		Recipient: req.Recipient,
+		Amount:    amount,
+		Currency:  req.Currency,
+		Note:      req.Note,
+		PIN:       req.PIN,
+	}, auditContext(c))
+	if err != nil {
+		return h.fail(c, user, err)
+	}
+	if t.Status == models.TransferPendingVerification {
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"data": t, "message": "enter the code sent to your phone to complete the transfer"})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"data": t})
+}
+
+// Confirm completes a transfer with the code sent to the sender's phone
+func (h *TransferHandler) Confirm(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := transferID(c)
+	if !ok {
+		return nil
+	}
+	var req ConfirmTransferRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+	t, err := h.transfers.Confirm(c.Context(), user, id, req.Code, auditContext(c))
+	if err != nil {
+		return h.fail(c, user, err)
+	}
+	return c.JSON(fiber.Map{"data": t})
+}
+
+// List returns the transfers the caller sent or received, newest first
+func (h *TransferHandler) List(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	list, err := h.transfers.List(c.Context(), user.ID, c.QueryInt("limit", 50))
+	if err != nil {
+		return h.fail(c, user, err)
+	}
+	return c.JSON(fiber.Map{"data": list})
+}
+
+// Get returns one transfer the caller sent or received
+func (h *TransferHandler) Get(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	id, ok := transferID(c)
+	if !ok {
+		return nil
+	}
+	t, err := h.transfers.Get(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, user, err)
+	}
+	return c.JSON(fiber.Map{"data": t})
+}
+
+// SetPIN sets the caller's wallet PIN; changing it needs "current_pin"
+func (h *TransferHandler) SetPIN(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	var req SetWalletPINRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if err := h.transfers.SetPIN(c.Context(), user, req.CurrentPIN, req.PIN); err != nil {
+		return h.fail(c, user, err)
+	}
+	return c.JSON(fiber.Map{"message": "wallet PIN saved"})
+}
+
+func transferID(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid transfer id"})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func (h *TransferHandler) fail(c *fiber.Ctx, user *models.User, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTransfer), errors.Is(err, services.ErrWalletPINFormat):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, models.ErrUnsupportedCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported currency", "supported": models.SupportedCurrencies})
+	case errors.Is(err, services.ErrTransferRecipientNotFound), errors.Is(err, services.ErrTransferNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTransferStepUpRequired), errors.Is(err, services.ErrTransferStepUpUnavailable),
+		errors.Is(err, services.ErrWalletPINInvalid), errors.Is(err, services.ErrTransferOTPInvalid):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrWalletPINLocked):
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTransferNotPending), errors.Is(err, services.ErrTransferOTPExpired), errors.Is(err, services.ErrTransferStateChanged):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientBalance):
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.logger.Error("Wallet transfer failed", err, zap.String("user_id", user.ID.Hex()))
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "transfer failed"})
+}
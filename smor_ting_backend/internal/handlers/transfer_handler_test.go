@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestTransfers_SendAndStepUp(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	sender := &models.User{Email: "splitter@example.com", Phone: "231770000301", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	friend := &models.User{Email: "friend@example.com", FirstName: "Kpana", LastName: "Doe", Phone: "231770000302", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, sender)
+	_ = repo.CreateUser(ctx, friend)
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: sender.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 200, Status: models.LedgerCompleted, Reference: "funded"})
+	transfers := services.NewTransferService(nil, repo, ledger, nil, services.TransferPolicy{StepUpThreshold: 50}, nil, nil)
+	h := handlers.NewTransferHandler(transfers, lg)
+
+	app := withUser(fiber.New(), sender)
+	app.Get("/wallet/transfers/recipient", h.Lookup)
+	app.Post("/wallet/transfers", h.Send)
+	app.Put("/wallet/pin", h.SetPIN)
+	send := func(method, path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	code, out := send(http.MethodGet, "/wallet/transfers/recipient?q=friend@example.com", "")
+	if data, _ := out["data"].(map[string]interface{}); code != http.StatusOK || data["name"] != "Kpana D." {
+		t.Fatalf("expected the recipient preview, got %d %v", code, out)
+	}
+	if code, _ := send(http.MethodGet, "/wallet/transfers/recipient?q=231779999999", ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown number, got %d", code)
+	}
+	code, out = send(http.MethodPost, "/wallet/transfers", `{"recipient":"231770000302","amount":"20","note":"lunch"}`)
+	if data, _ := out["data"].(map[string]interface{}); code != http.StatusCreated || data["status"] != string(models.TransferCompleted) {
+		t.Fatalf("expected the transfer to complete, got %d %v", code, out)
+	}
+
+	// No PIN and no way to send a code: large transfers are refused until a PIN is set
+	if code, _ := send(http.MethodPost, "/wallet/transfers", `{"recipient":"231770000302","amount":"120"}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without a PIN, got %d", code)
+	}
+	if code, _ := send(http.MethodPut, "/wallet/pin", `{"pin":"2468"}`); code != http.StatusOK {
+		t.Fatalf("expected the PIN to be set, got %d", code)
+	}
+	code, out = send(http.MethodPost, "/wallet/transfers", `{"recipient":"231770000302","amount":"120","pin":"2468"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("expected the PIN to authorise the transfer, got %d %v", code, out)
+	}
+	if code, _ := send(http.MethodPost, "/wallet/transfers", `{"recipient":"231770000302","amount":"100","pin":"2468"}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 once the wallet is short, got %d", code)
+	}
+}
@@ -1,64 +1,147 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/smorting/backend/internal/models"
 	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
 )
 
-// WalletHandler exposes wallet endpoints backed by MoMo
+// WalletHandler exposes wallet endpoints backed by the mobile-money providers
 type WalletHandler struct {
-	momo   services.MomoAPI
-	logger *logger.Logger
-	ledger *services.WalletLedgerService
+	providers *services.PaymentProviders
+	logger    *logger.Logger
+	ledger    *services.WalletLedgerService
+	escrow    *services.EscrowService
+	methods   *services.PaymentMethodService
+	// withdrawals applies limits and review to withdrawals; without it they are refused
+	withdrawals *services.WithdrawalService
 }
 
+// NewWalletHandler and the WithLedger/WithEscrow variants serve MoMo only;
+// production wiring uses WithProviders.
 func NewWalletHandler(momo services.MomoAPI, logger *logger.Logger) *WalletHandler {
-	return &WalletHandler{momo: momo, logger: logger}
+	return NewWalletHandlerWithEscrow(momo, logger, nil, nil)
 }
 func NewWalletHandlerWithLedger(momo services.MomoAPI, logger *logger.Logger, ledger *services.WalletLedgerService) *WalletHandler {
-	return &WalletHandler{momo: momo, logger: logger, ledger: ledger}
+	return NewWalletHandlerWithEscrow(momo, logger, ledger, nil)
+}
+func NewWalletHandlerWithEscrow(momo services.MomoAPI, logger *logger.Logger, ledger *services.WalletLedgerService, escrow *services.EscrowService) *WalletHandler {
+	return NewWalletHandlerWithProviders(services.NewPaymentProviders(services.NewMomoProvider(momo)), logger, ledger, escrow)
+}
+func NewWalletHandlerWithProviders(providers *services.PaymentProviders, logger *logger.Logger, ledger *services.WalletLedgerService, escrow *services.EscrowService) *WalletHandler {
+	return &WalletHandler{providers: providers, logger: logger, ledger: ledger, escrow: escrow}
+}
+
+// SetPaymentMethods lets top-ups and withdrawals name a linked method instead of a raw MSISDN
+func (h *WalletHandler) SetPaymentMethods(methods *services.PaymentMethodService) {
+	h.methods = methods
+}
+
+// SetWithdrawals checks withdrawals against the balance, limits and velocity rules before paying them
+func (h *WalletHandler) SetWithdrawals(withdrawals *services.WithdrawalService) {
+	h.withdrawals = withdrawals
+}
+
+// provider resolves the provider a request names (the registry default when it
+// names none), writing a 400 for providers we do not support
+func (h *WalletHandler) provider(c *fiber.Ctx, name string) (services.PaymentProvider, bool) {
+	p, err := h.providers.Get(name)
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported payment provider", "supported": h.providers.Names()})
+		return nil, false
+	}
+	return p, true
 }
 
-// Online-only guard wrapper
-func (h *WalletHandler) ensureOnline(c *fiber.Ctx) error {
-	if err := h.momo.EnsureOnline(c.Context()); err != nil {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{
+// counterparty resolves the provider and MSISDN a request pays from or to: the
+// linked method when methodID is set, otherwise the named provider and raw MSISDN
+func (h *WalletHandler) counterparty(c *fiber.Ctx, methodID, providerName, msisdn string) (services.PaymentProvider, string, bool) {
+	if methodID == "" {
+		p, ok := h.provider(c, providerName)
+		return p, msisdn, ok
+	}
+	user, _ := c.Locals("user").(*models.User)
+	if h.methods == nil || user == nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "linked payment methods are not available"})
+		return nil, "", false
+	}
+	id, err := primitive.ObjectIDFromHex(methodID)
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid method_id"})
+		return nil, "", false
+	}
+	method, number, err := h.methods.Resolve(c.Context(), user.ID, id)
+	switch {
+	case errors.Is(err, services.ErrPaymentMethodNotFound):
+		_ = c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "payment method not found"})
+		return nil, "", false
+	case errors.Is(err, services.ErrPaymentMethodInactive):
+		_ = c.Status(http.StatusConflict).JSON(fiber.Map{"error": "payment method is not verified"})
+		return nil, "", false
+	case err != nil:
+		h.logger.Error("Failed to resolve payment method", err, zap.String("method_id", methodID))
+		_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payment method unavailable"})
+		return nil, "", false
+	}
+	p, ok := h.provider(c, method.Provider)
+	return p, number, ok
+}
+
+// ensureOnline reports whether the provider is reachable, writing a 403 when it is not
+func (h *WalletHandler) ensureOnline(c *fiber.Ctx, p services.PaymentProvider) bool {
+	if err := p.EnsureOnline(c.Context()); err != nil {
+		_ = c.Status(http.StatusForbidden).JSON(fiber.Map{
 			"error":   "Wallet requires internet",
 			"message": "Please connect to the internet to use wallet",
 		})
+		return false
 	}
-	return nil
+	return true
 }
 
+// Provider in wallet requests is a LinkedPaymentMethod provider name or alias;
+// empty means the default provider (MTN MoMo). MethodID, a verified linked
+// method of the caller, replaces both Provider and Msisdn.
 type TopupRequest struct {
 	Amount   string `json:"amount"`
 	Currency string `json:"currency"`
 	Msisdn   string `json:"msisdn"`
+	Provider string `json:"provider"`
+	MethodID string `json:"method_id"`
 }
 
 func (h *WalletHandler) Topup(c *fiber.Ctx) error {
-	if err := h.ensureOnline(c); err != nil {
-		return err
-	}
 	var req TopupRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 	}
+	provider, msisdn, ok := h.counterparty(c, req.MethodID, req.Provider, req.Msisdn)
+	if !ok || !h.ensureOnline(c, provider) {
+		return nil
+	}
 
-	body := services.RequestToPay{
-		Amount:       req.Amount,
-		Currency:     req.Currency,
-		ExternalId:   "wallet_topup",
-		Payer:        services.Party{PartyIdType: "MSISDN", PartyId: req.Msisdn},
-		PayerMessage: "Wallet topup",
-		PayeeNote:    "Smor-Ting Wallet",
+	ref := services.NewMomoReferenceID()
+	intent := &models.WalletLedgerEntry{Type: models.LedgerTopup, Direction: models.LedgerCredit, Currency: req.Currency, Reference: ref, Provider: provider.Name()}
+	if !h.recordIntent(c, intent, req.Amount) {
+		return nil
 	}
-	ref, err := h.momo.RequestToPay(c.Context(), body)
-	if err != nil {
+	body := services.MobileMoneyRequest{
+		ReferenceID: ref,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		MSISDN:      msisdn,
+		ExternalID:  "wallet_topup",
+		Message:     "Wallet topup",
+		Note:        "Smor-Ting Wallet",
+	}
+	if err := provider.Collect(c.Context(), body); err != nil && h.rejected(c, err, ref, nil) {
 		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "topup failed"})
 	}
 	return c.JSON(fiber.Map{"reference_id": ref, "status": "PENDING"})
@@ -69,44 +152,239 @@ type PayRequest struct {
 	Currency   string `json:"currency"`
 	Msisdn     string `json:"msisdn"`
 	BookingRef string `json:"booking_ref"`
+	Provider   string `json:"provider"`
 }
 
 func (h *WalletHandler) PayEscrow(c *fiber.Ctx) error {
-	if err := h.ensureOnline(c); err != nil {
-		return err
-	}
 	var req PayRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 	}
-	// Initiate R2P into escrow (handled by our ledger on webhook confirmation)
-	body := services.RequestToPay{Amount: req.Amount, Currency: req.Currency, ExternalId: req.BookingRef, Payer: services.Party{PartyIdType: "MSISDN", PartyId: req.Msisdn}, PayerMessage: "Task escrow", PayeeNote: req.BookingRef}
-	ref, err := h.momo.RequestToPay(c.Context(), body)
-	if err != nil {
+	provider, ok := h.provider(c, req.Provider)
+	if !ok || !h.ensureOnline(c, provider) {
+		return nil
+	}
+	ref := services.NewMomoReferenceID()
+	// With escrow wired, the booking dictates the amount and the hold is linked to it
+	// before the provider is called, so the callback can only ever fund this booking
+	var booking *models.Booking
+	if h.escrow != nil {
+		user, _ := c.Locals("user").(*models.User)
+		if user == nil {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		bookingID, err := primitive.ObjectIDFromHex(req.BookingRef)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking_ref"})
+		}
+		booking, err = h.escrow.PrepareHold(c.Context(), user, bookingID)
+		switch {
+		case errors.Is(err, services.ErrBookingNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "booking not found"})
+		case errors.Is(err, services.ErrEscrowExists), errors.Is(err, services.ErrEscrowNotPayable):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payment failed"})
+		}
+		req.Amount = strconv.FormatFloat(booking.TotalAmount, 'f', 2, 64)
+		req.Currency = booking.Currency
+		if _, err := h.escrow.Link(c.Context(), booking, ref); err != nil {
+			h.logger.Error("Failed to link escrow hold to booking", err, zap.String("booking_id", booking.ID.Hex()), zap.String("reference_id", ref))
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "payment could not be linked to booking"})
+		}
+	}
+	intent := &models.WalletLedgerEntry{Type: models.LedgerEscrowHold, Direction: models.LedgerCredit, Currency: req.Currency, Reference: ref, IsEscrow: true, Provider: provider.Name()}
+	if booking != nil {
+		intent.BookingID = &booking.ID
+	}
+	if !h.recordIntent(c, intent, req.Amount) {
+		h.failHold(c, booking, ref)
+		return nil
+	}
+	// Collect into escrow (handled by our ledger on webhook confirmation)
+	body := services.MobileMoneyRequest{ReferenceID: ref, Amount: req.Amount, Currency: req.Currency, MSISDN: req.Msisdn, ExternalID: req.BookingRef, Message: "Task escrow", Note: req.BookingRef}
+	if err := provider.Collect(c.Context(), body); err != nil && h.rejected(c, err, ref, booking) {
 		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "payment failed"})
 	}
 	return c.JSON(fiber.Map{"reference_id": ref, "status": "PENDING"})
 }
 
+// PayFromWalletRequest pays a booking from the wallet balance in Currency (the
+// booking's own when empty); another currency needs QuoteID from /wallet/fx/quotes
+type PayFromWalletRequest struct {
+	BookingRef string `json:"booking_ref"`
+	Currency   string `json:"currency"`
+	QuoteID    string `json:"quote_id"`
+}
+
+func (h *WalletHandler) PayFromWallet(c *fiber.Ctx) error {
+	var req PayFromWalletRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	user, _ := c.Locals("user").(*models.User)
+	if h.escrow == nil || user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	bookingID, err := primitive.ObjectIDFromHex(req.BookingRef)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid booking_ref"})
+	}
+	var quoteID *primitive.ObjectID
+	if req.QuoteID != "" {
+		id, err := primitive.ObjectIDFromHex(req.QuoteID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid quote_id"})
+		}
+		quoteID = &id
+	}
+	escrow, err := h.escrow.PayFromWallet(c.Context(), user, bookingID, req.Currency, quoteID)
+	switch {
+	case errors.Is(err, services.ErrBookingNotFound), errors.Is(err, services.ErrFXQuoteNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, models.ErrUnsupportedCurrency), errors.Is(err, services.ErrFXQuoteRequired), errors.Is(err, services.ErrFXQuoteMismatch):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrEscrowExists), errors.Is(err, services.ErrEscrowNotPayable),
+		errors.Is(err, services.ErrFXQuoteUsed), errors.Is(err, services.ErrFXQuoteExpired):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientBalance):
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("Failed to pay booking from wallet", err, zap.String("booking_id", req.BookingRef))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payment failed"})
+	}
+	return c.JSON(fiber.Map{"data": escrow})
+}
+
 type WithdrawRequest struct {
 	Amount   string `json:"amount"`
 	Currency string `json:"currency"`
 	Msisdn   string `json:"msisdn"`
+	Provider string `json:"provider"`
+	MethodID string `json:"method_id"`
 }
 
+// Withdraw pays wallet funds out to mobile money. Withdrawals are only paid
+// through the withdrawal service, which checks the balance and limits, so they
+// are refused when none is configured.
 func (h *WalletHandler) Withdraw(c *fiber.Ctx) error {
-	if err := h.ensureOnline(c); err != nil {
-		return err
+	if h.withdrawals == nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "withdrawals are unavailable"})
 	}
 	var req WithdrawRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 	}
-	ref, err := h.momo.Transfer(c.Context(), services.TransferRequest{Amount: req.Amount, Currency: req.Currency, ExternalId: "wallet_withdraw", Payee: services.Party{PartyIdType: "MSISDN", PartyId: req.Msisdn}})
+	provider, msisdn, ok := h.counterparty(c, req.MethodID, req.Provider, req.Msisdn)
+	if !ok || !h.ensureOnline(c, provider) {
+		return nil
+	}
+	return h.withdraw(c, req, provider, msisdn)
+}
+
+// withdraw pays out through the withdrawal service. A flagged withdrawal is
+// accepted for review and paid only once an admin approves it.
+func (h *WalletHandler) withdraw(c *fiber.Ctx, req WithdrawRequest, provider services.PaymentProvider, msisdn string) error {
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	amount, err := strconv.ParseFloat(req.Amount, 64)
 	if err != nil {
-		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "withdrawal failed"})
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid amount"})
+	}
+	w, err := h.withdrawals.Withdraw(c.Context(), user, services.WithdrawalRequest{
+		Amount:   amount,
+		Currency: req.Currency,
+		Provider: provider.Name(),
+		Msisdn:   msisdn,
+	}, auditContext(c))
+	switch {
+	case errors.Is(err, services.ErrInvalidWithdrawal):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, models.ErrUnsupportedCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported currency", "supported": models.SupportedCurrencies})
+	case errors.Is(err, services.ErrInsufficientBalance), errors.Is(err, services.ErrWithdrawalLimitExceeded):
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrWithdrawalPayoutRejected):
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "withdrawal failed", "data": w})
+	case err != nil:
+		h.logger.Error("Withdrawal failed", err, zap.String("user_id", user.ID.Hex()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "withdrawal could not be started"})
+	}
+	if w.Status == models.WithdrawalPendingReview {
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"withdrawal_id": w.ID.Hex(), "status": "PENDING_REVIEW", "data": w})
+	}
+	return c.JSON(fiber.Map{"reference_id": w.Reference, "status": "PENDING", "data": w})
+}
+
+// recordIntent persists the caller's pending operation before the provider is called.
+// It reports whether the caller may proceed, writing the error response when not.
+func (h *WalletHandler) recordIntent(c *fiber.Ctx, intent *models.WalletLedgerEntry, amount string) bool {
+	if h.ledger == nil {
+		return true
+	}
+	user, _ := c.Locals("user").(*models.User)
+	if user == nil {
+		_ = c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return false
+	}
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil || value <= 0 {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid amount"})
+		return false
+	}
+	intent.UserID = user.ID
+	intent.Amount = value
+	if err := h.ledger.RecordIntent(c.Context(), intent); err != nil {
+		if errors.Is(err, models.ErrUnsupportedCurrency) {
+			_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported currency", "supported": models.SupportedCurrencies})
+			return false
+		}
+		h.logger.Error("Failed to record payment intent", err, zap.String("reference_id", intent.Reference), zap.String("type", string(intent.Type)))
+		_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payment could not be started"})
+		return false
+	}
+	return true
+}
+
+// rejected handles a provider error on the request for intent ref. Only a
+// definitive rejection closes the intent and releases the booking's escrow
+// link; after a timeout or 5xx the provider may still collect or pay, so the
+// intent stays pending for its callback or the reconciler and the caller is
+// answered as if the request had been accepted.
+func (h *WalletHandler) rejected(c *fiber.Ctx, err error, ref string, booking *models.Booking) bool {
+	if !errors.Is(err, services.ErrPaymentRejected) {
+		h.logger.Warn("Payment outcome unknown; left for reconciliation", zap.Error(err), zap.String("reference_id", ref))
+		return false
+	}
+	h.failIntent(c, ref)
+	h.failHold(c, booking, ref)
+	return true
+}
+
+// failIntent closes an intent whose provider request was rejected, so it is never polled
+func (h *WalletHandler) failIntent(c *fiber.Ctx, ref string) {
+	if h.ledger == nil {
+		return
+	}
+	intent, err := h.ledger.Intent(c.Context(), ref)
+	if err == nil {
+		err = h.ledger.SettleIntent(c.Context(), intent, models.LedgerFailed)
+	}
+	if err != nil {
+		h.logger.Error("Failed to close payment intent", err, zap.String("reference_id", ref))
+	}
+}
+
+// failHold releases a booking's escrow link when the provider rejected its hold
+func (h *WalletHandler) failHold(c *fiber.Ctx, booking *models.Booking, ref string) {
+	if booking == nil {
+		return
+	}
+	if err := h.escrow.MarkFailed(c.Context(), ref); err != nil {
+		h.logger.Error("Failed to release escrow link", err, zap.String("booking_id", booking.ID.Hex()), zap.String("reference_id", ref))
 	}
-	return c.JSON(fiber.Map{"reference_id": ref, "status": "PENDING"})
 }
 
 // Placeholder: balances and transactions will pull from repository
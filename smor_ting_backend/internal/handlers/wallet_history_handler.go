@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+// WalletHistoryHandler serves the paginated transaction history and downloadable statements
+type WalletHistoryHandler struct {
+	ledger *services.WalletLedgerService
+	logger *logger.Logger
+}
+
+func NewWalletHistoryHandler(ledger *services.WalletLedgerService, logger *logger.Logger) *WalletHistoryHandler {
+	return &WalletHistoryHandler{ledger: ledger, logger: logger}
+}
+
+// History lists the caller's wallet transactions, newest first. Filters:
+// ?type=topup,withdraw ?status=completed|pending|failed ?currency=LRD
+// ?from=YYYY-MM-DD ?to=YYYY-MM-DD (inclusive); page with ?limit and ?cursor.
+func (h *WalletHistoryHandler) History(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	filter := services.HistoryFilter{
+		Status:   models.LedgerStatus(c.Query("status")),
+		Currency: c.Query("currency"),
+		Cursor:   c.Query("cursor"),
+		Limit:    c.QueryInt("limit", 0),
+	}
+	switch filter.Status {
+	case "", models.LedgerCompleted, models.LedgerPending, models.LedgerFailed:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status must be completed, pending or failed"})
+	}
+	if raw := c.Query("type"); raw != "" {
+		for _, t := range strings.Split(raw, ",") {
+			filter.Types = append(filter.Types, models.LedgerType(strings.TrimSpace(t)))
+		}
+	}
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if filter.From, err = time.Parse("2006-01-02", raw); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+		}
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	page, err := h.ledger.History(c.Context(), user.ID, filter)
+	switch {
+	case errors.Is(err, services.ErrInvalidHistoryCursor):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, models.ErrUnsupportedCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "supported": models.SupportedCurrencies})
+	case err != nil:
+		h.logger.Error("Failed to list wallet history", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load history"})
+	}
+	return c.JSON(fiber.Map{"data": page.Items, "next_cursor": page.NextCursor})
+}
+
+// Statement returns the caller's statement for ?from and ?to (YYYY-MM-DD,
+// inclusive; default the current month) in ?currency, as ?format=json, csv or pdf
+func (h *WalletHistoryHandler) Statement(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" && format != "pdf" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be json, csv or pdf"})
+	}
+	from, to, ok := statementPeriod(c)
+	if !ok {
+		return nil
+	}
+	st, err := h.ledger.Statement(c.Context(), user.ID, c.Query("currency"), from, to)
+	switch {
+	case errors.Is(err, models.ErrUnsupportedCurrency):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "supported": models.SupportedCurrencies})
+	case err != nil:
+		h.logger.Error("Failed to build wallet statement", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build statement"})
+	}
+	if format == "json" {
+		return c.JSON(fiber.Map{"data": st})
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/csv"
+	if format == "csv" {
+		err = services.WriteStatementCSV(&buf, st)
+	} else {
+		contentType = "application/pdf"
+		err = services.WriteStatementPDF(&buf, st)
+	}
+	if err != nil {
+		h.logger.Error("Failed to render wallet statement", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to render statement"})
+	}
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", st.Currency, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), format)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestWalletHistory_CursorPagingAndStatementDownload(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "history-handler@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, user)
+	ledger := services.NewWalletLedgerService(repo)
+	for _, ref := range []string{"t1", "t2", "t3"} {
+		_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 5, Status: models.LedgerCompleted, Reference: ref})
+	}
+
+	h := handlers.NewWalletHistoryHandler(ledger, lg)
+	app := withUser(fiber.New(), user)
+	app.Get("/wallet/transactions", h.History)
+	app.Get("/wallet/statement", h.Statement)
+
+	list := func(path string) (int, map[string]interface{}) {
+		resp, _ := app.Test(httptest.NewRequest("GET", path, nil))
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	code, first := list("/wallet/transactions?limit=2")
+	cursor, _ := first["next_cursor"].(string)
+	if code != 200 || len(first["data"].([]interface{})) != 2 || cursor == "" {
+		t.Fatalf("unexpected first page %d: %v", code, first)
+	}
+	code, second := list("/wallet/transactions?limit=2&cursor=" + cursor)
+	if code != 200 || len(second["data"].([]interface{})) != 1 || second["next_cursor"] != "" {
+		t.Fatalf("unexpected second page %d: %v", code, second)
+	}
+	if code, _ := list("/wallet/transactions?cursor=bogus"); code != 400 {
+		t.Fatalf("expected 400 for a bad cursor, got %d", code)
+	}
+	if code, _ := list("/wallet/transactions?status=settled"); code != 400 {
+		t.Fatalf("expected 400 for an unknown status, got %d", code)
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/wallet/statement?format=csv", nil))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/csv" ||
+		!strings.HasPrefix(resp.Header.Get("Content-Disposition"), `attachment; filename="statement-USD-`) {
+		t.Fatalf("unexpected csv response %d %v", resp.StatusCode, resp.Header)
+	}
+	if !strings.Contains(string(body), "closing_balance,,,15.00,0.00,15.00,USD") {
+		t.Fatalf("unexpected csv body:\n%s", body)
+	}
+	if code, _ := list("/wallet/statement?format=xls"); code != 400 {
+		t.Fatalf("expected 400 for an unknown format, got %d", code)
+	}
+}
@@ -1,24 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/smorting/backend/internal/database"
 	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
 )
 
+// WalletMethodsHandler manages the mobile-money numbers a user can pay from and withdraw to
 type WalletMethodsHandler struct {
-	repo    database.Repository
+	methods *services.PaymentMethodService
 	logger  *logger.Logger
-	methods map[string][]models.LinkedPaymentMethod
 }
 
-func NewWalletMethodsHandler(repo database.Repository, logger *logger.Logger) *WalletMethodsHandler {
-	return &WalletMethodsHandler{repo: repo, logger: logger, methods: make(map[string][]models.LinkedPaymentMethod)}
+func NewWalletMethodsHandler(methods *services.PaymentMethodService, logger *logger.Logger) *WalletMethodsHandler {
+	return &WalletMethodsHandler{methods: methods, logger: logger}
 }
 
 type linkReq struct {
@@ -28,6 +29,11 @@ type linkReq struct {
 	Default  bool   `json:"default"`
 }
 
+type verifyMethodReq struct {
+	OTP string `json:"otp"`
+}
+
+// Link starts linking a number; it stays pending until Verify confirms the OTP sent to it
 func (h *WalletMethodsHandler) Link(c *fiber.Ctx) error {
 	var req linkReq
 	if err := c.BodyParser(&req); err != nil {
@@ -36,46 +42,100 @@ func (h *WalletMethodsHandler) Link(c *fiber.Ctx) error {
 	if req.Provider == "" || req.Msisdn == "" {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "provider and msisdn required"})
 	}
+	if req.Type != "" && req.Type != string(models.PaymentMethodMobileMoney) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "only mobile_money methods can be linked"})
+	}
 	user, _ := c.Locals("user").(*models.User)
-	method := models.LinkedPaymentMethod{
-		ID:        primitive.NewObjectID(),
-		UserID:    user.ID,
-		Type:      models.PaymentMethodMobileMoney,
-		Provider:  req.Provider,
-		Msisdn:    maskMsisdn(req.Msisdn),
-		IsDefault: req.Default,
-		Status:    "active",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	method, err := h.methods.Link(c.Context(), user, req.Provider, req.Msisdn, req.Default)
+	if err != nil {
+		return h.fail(c, "link", err)
 	}
-	// Store in-memory by user
-	uid := user.ID.Hex()
-	h.methods[uid] = append(h.methods[uid], method)
-	return c.JSON(fiber.Map{"data": []models.LinkedPaymentMethod{method}})
+	return c.JSON(fiber.Map{"data": []models.LinkedPaymentMethod{*method}, "verification": "otp_sent"})
+}
+
+// Verify activates a pending method with the OTP sent to its number
+func (h *WalletMethodsHandler) Verify(c *fiber.Ctx) error {
+	id, ok := methodID(c)
+	if !ok {
+		return nil
+	}
+	var req verifyMethodReq
+	if err := c.BodyParser(&req); err != nil || req.OTP == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "otp required"})
+	}
+	user, _ := c.Locals("user").(*models.User)
+	method, err := h.methods.Verify(c.Context(), user, id, req.OTP, auditContext(c))
+	if err != nil {
+		return h.fail(c, "verify", err)
+	}
+	return c.JSON(fiber.Map{"data": method})
 }
 
 func (h *WalletMethodsHandler) List(c *fiber.Ctx) error {
 	user, _ := c.Locals("user").(*models.User)
-	return c.JSON(fiber.Map{"data": h.methods[user.ID.Hex()]})
+	methods, err := h.methods.List(c.Context(), user.ID)
+	if err != nil {
+		return h.fail(c, "list", err)
+	}
+	return c.JSON(fiber.Map{"data": methods})
+}
+
+// SetDefault makes an active method the one used when a request names none
+func (h *WalletMethodsHandler) SetDefault(c *fiber.Ctx) error {
+	id, ok := methodID(c)
+	if !ok {
+		return nil
+	}
+	user, _ := c.Locals("user").(*models.User)
+	method, err := h.methods.SetDefault(c.Context(), user, id)
+	if err != nil {
+		return h.fail(c, "set default", err)
+	}
+	return c.JSON(fiber.Map{"data": method})
 }
 
 func (h *WalletMethodsHandler) Delete(c *fiber.Ctx) error {
+	id, ok := methodID(c)
+	if !ok {
+		return nil
+	}
 	user, _ := c.Locals("user").(*models.User)
-	id := c.Params("id")
-	list := h.methods[user.ID.Hex()]
-	out := make([]models.LinkedPaymentMethod, 0, len(list))
-	for _, m := range list {
-		if m.ID.Hex() != id {
-			out = append(out, m)
-		}
+	if err := h.methods.Unlink(c.Context(), user, id, auditContext(c)); err != nil {
+		return h.fail(c, "unlink", err)
 	}
-	h.methods[user.ID.Hex()] = out
 	return c.JSON(fiber.Map{"status": "deleted"})
 }
 
-func maskMsisdn(msisdn string) string {
-	if len(msisdn) < 4 {
-		return msisdn
+// fail maps payment method errors onto responses
+func (h *WalletMethodsHandler) fail(c *fiber.Ctx, op string, err error) error {
+	switch {
+	case errors.Is(err, services.ErrPaymentMethodNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "payment method not found"})
+	case errors.Is(err, services.ErrUnknownPaymentProvider), errors.Is(err, services.ErrInvalidMsisdn):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentMethodExists), errors.Is(err, services.ErrPaymentMethodNotPending), errors.Is(err, services.ErrPaymentMethodInactive):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentMethodOTPInvalid), errors.Is(err, services.ErrPaymentMethodOTPExpired):
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentMethodOTPLocked):
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrPaymentMethodVerificationUnavailable):
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	default:
+		h.logger.Error("Payment method "+op+" failed", err, zap.String("path", c.Path()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "payment method " + op + " failed"})
 	}
-	return "***" + msisdn[len(msisdn)-4:]
+}
+
+func methodID(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payment method id"})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func auditContext(c *fiber.Ctx) services.AuditContext {
+	return services.AuditContext{IPAddress: c.IP(), UserAgent: c.Get("User-Agent")}
 }
@@ -6,37 +6,62 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/smorting/backend/internal/database"
 	"github.com/smorting/backend/internal/handlers"
 	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/pkg/logger"
 )
 
+// smsOutbox records the last verification code sent to each number
+type smsOutbox map[string]string
+
+func (o smsOutbox) SendOTP(ctx context.Context, msisdn, code string) error {
+	o[msisdn] = code
+	return nil
+}
+
+func newPaymentMethods(t *testing.T, outbox smsOutbox) *services.PaymentMethodService {
+	t.Helper()
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption: %v", err)
+	}
+	return services.NewPaymentMethodService(services.NewMemoryPaymentMethodStore(), enc, outbox, nil, nil)
+}
+
 func TestWalletMethods_LinkListDelete(t *testing.T) {
 	repo := database.NewMemoryDatabase()
 	lg, _ := logger.New("debug", "console", "stdout")
-	h := handlers.NewWalletMethodsHandler(repo, lg)
+	outbox := smsOutbox{}
+	h := handlers.NewWalletMethodsHandler(newPaymentMethods(t, outbox), lg)
 
 	// Seed user
 	u := &models.User{Email: "msisdn@example.com"}
 	_ = repo.CreateUser(context.TODO(), u)
 
-	app := fiber.New()
-	app.Post("/wallet/methods", func(c *fiber.Ctx) error {
-		c.Locals("user", u)
-		return h.Link(c)
-	})
-	app.Get("/wallet/methods", func(c *fiber.Ctx) error {
-		c.Locals("user", u)
-		return h.List(c)
-	})
-	app.Delete("/wallet/methods/:id", func(c *fiber.Ctx) error {
-		c.Locals("user", u)
-		return h.Delete(c)
-	})
+	app := withUser(fiber.New(), u)
+	app.Post("/wallet/methods", h.Link)
+	app.Post("/wallet/methods/:id/verify", h.Verify)
+	app.Get("/wallet/methods", h.List)
+	app.Delete("/wallet/methods/:id", h.Delete)
+	list := func() []models.LinkedPaymentMethod {
+		t.Helper()
+		resp, _ := app.Test(httptest.NewRequest(http.MethodGet, "/wallet/methods", nil))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list expected 200, got %d", resp.StatusCode)
+		}
+		var got struct {
+			Data []models.LinkedPaymentMethod `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+		return got.Data
+	}
 
 	// Link
 	body := map[string]interface{}{"type": "mobile_money", "provider": "lonestar", "msisdn": "231770000000", "default": true}
@@ -48,26 +73,91 @@ func TestWalletMethods_LinkListDelete(t *testing.T) {
 		t.Fatalf("link expected 200, got %d", resp.StatusCode)
 	}
 
-	// List
-	req2 := httptest.NewRequest(http.MethodGet, "/wallet/methods", nil)
-	resp2, _ := app.Test(req2)
-	if resp2.StatusCode != http.StatusOK {
-		t.Fatalf("list expected 200, got %d", resp2.StatusCode)
+	// List: pending until the OTP is confirmed, and never the full number
+	got := list()
+	if len(got) != 1 || got[0].Provider != models.PaymentProviderMTNMomo || got[0].Status != models.PaymentMethodPending || got[0].Msisdn != "***0000" {
+		t.Fatalf("unexpected list: %+v", got)
 	}
+	id := got[0].ID.Hex()
 
-	var got struct {
-		Data []models.LinkedPaymentMethod `json:"data"`
+	verify := func(otp string) int {
+		req := httptest.NewRequest(http.MethodPost, "/wallet/methods/"+id+"/verify", strings.NewReader(`{"otp":"`+otp+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		return resp.StatusCode
 	}
-	_ = json.NewDecoder(resp2.Body).Decode(&got)
-	if len(got.Data) != 1 || got.Data[0].Provider != "lonestar" {
-		t.Fatalf("unexpected list: %+v", got)
+	if code := verify("bad"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong otp expected 422, got %d", code)
+	}
+	if code := verify(outbox["231770000000"]); code != http.StatusOK {
+		t.Fatalf("verify expected 200, got %d", code)
+	}
+	if got = list(); got[0].Status != models.PaymentMethodActive || !got[0].IsDefault {
+		t.Fatalf("expected an active default method, got %+v", got[0])
 	}
 
 	// Delete
-	id := got.Data[0].ID.Hex()
 	req3 := httptest.NewRequest(http.MethodDelete, "/wallet/methods/"+id, nil)
 	resp3, _ := app.Test(req3)
 	if resp3.StatusCode != http.StatusOK {
 		t.Fatalf("delete expected 200, got %d", resp3.StatusCode)
 	}
+	if got = list(); len(got) != 0 {
+		t.Fatalf("expected no methods after delete, got %+v", got)
+	}
+}
+
+func TestWallet_Withdraw_ToLinkedMethod(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "payout@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordEntry(context.TODO(), &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 10, Currency: "USD", Status: models.LedgerCompleted, Reference: "earned"})
+	outbox := smsOutbox{}
+	methods := newPaymentMethods(t, outbox)
+	payee := &payeeMomo{fakeMomo: fakeMomo{online: true}}
+
+	h := handlers.NewWalletHandler(payee, lg)
+	h.SetPaymentMethods(methods)
+	app := withUser(fiber.New(), user)
+	app.Post("/withdraw", h.Withdraw)
+	withdraw := func(methodID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/withdraw", strings.NewReader(`{"amount":"10","currency":"USD","method_id":"`+methodID+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		return resp.StatusCode
+	}
+
+	method, err := methods.Link(context.TODO(), user, "mtn", "231770005555", false)
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if code := withdraw(method.ID.Hex()); code != http.StatusServiceUnavailable {
+		t.Fatalf("without the withdrawal service nothing is paid, expected 503, got %d", code)
+	}
+	h.SetWithdrawals(newWithdrawals(t, repo, ledger, payee))
+	if code := withdraw(method.ID.Hex()); code != http.StatusConflict {
+		t.Fatalf("an unverified method expected 409, got %d", code)
+	}
+	if _, err := methods.Verify(context.TODO(), user, method.ID, outbox["231770005555"], services.AuditContext{}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if code := withdraw(method.ID.Hex()); code != http.StatusOK {
+		t.Fatalf("withdraw expected 200, got %d", code)
+	}
+	if payee.payee != "231770005555" {
+		t.Fatalf("expected the payout to go to the full linked number, got %q", payee.payee)
+	}
+}
+
+// payeeMomo records who a transfer paid
+type payeeMomo struct {
+	fakeMomo
+	payee string
+}
+
+func (f *payeeMomo) Transfer(ctx context.Context, body services.TransferRequest) (string, error) {
+	f.payee = body.Payee.PartyId
+	return body.ReferenceID, nil
 }
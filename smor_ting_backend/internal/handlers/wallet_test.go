@@ -2,14 +2,21 @@ package handlers_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/smorting/backend/internal/database"
 	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/momosim"
 	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/pkg/logger"
 )
@@ -61,3 +68,267 @@ func TestWallet_Topup_OnlineOnly(t *testing.T) {
 		t.Fatalf("expected 200 online, got %d", resp.StatusCode)
 	}
 }
+
+// intentMomo records whether an intent already existed when MoMo was called
+type intentMomo struct {
+	fakeMomo
+	ledger      *services.WalletLedgerService
+	sawIntent   bool
+	lastRef     string
+	rejectCalls bool
+	timeout     bool
+}
+
+func (f *intentMomo) RequestToPay(ctx context.Context, body services.RequestToPay) (string, error) {
+	f.lastRef = body.ReferenceID
+	_, err := f.ledger.Intent(ctx, body.ReferenceID)
+	f.sawIntent = err == nil
+	if f.rejectCalls {
+		return "", fmt.Errorf("%w: payer limit reached", services.ErrPaymentRejected)
+	}
+	if f.timeout {
+		return "", context.DeadlineExceeded
+	}
+	return body.ReferenceID, nil
+}
+
+func TestWallet_Topup_PersistsIntentBeforeCallingMomo(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "intent@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	momo := &intentMomo{fakeMomo: fakeMomo{online: true}, ledger: ledger}
+
+	app := withUser(fiber.New(), user)
+	app.Post("/topup", handlers.NewWalletHandlerWithLedger(momo, lg, ledger).Topup)
+	req := httptest.NewRequest(http.MethodPost, "/topup", strings.NewReader(`{"amount":"25","currency":"USD","msisdn":"231770000000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if !momo.sawIntent || momo.lastRef == "" {
+		t.Fatalf("intent must be written before MoMo is called (ref %q)", momo.lastRef)
+	}
+
+	// The callback is matched through the intent: a forged user_id and amount are ignored
+	other := &models.User{Email: "attacker@example.com"}
+	_ = repo.CreateUser(context.TODO(), other)
+	wh := handlers.NewWalletWebhookHandlerWithLedger(lg, ledger)
+	cbApp := fiber.New()
+	cbApp.Post("/webhooks/momo", wh.MomoCallback)
+	body := `{"status":"SUCCESSFUL","amount":9999,"currency":"USD","user_id":"` + other.ID.Hex() + `","referenceId":"` + momo.lastRef + `"}`
+	cbReq := httptest.NewRequest(http.MethodPost, "/webhooks/momo", strings.NewReader(body))
+	cbReq.Header.Set("Content-Type", "application/json")
+	if resp, _ := cbApp.Test(cbReq); resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback expected 200, got %d", resp.StatusCode)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), user.ID); bal.Available != 25 {
+		t.Fatalf("intent owner should be credited 25, got %+v", bal)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), other.ID); bal.Available != 0 {
+		t.Fatalf("client-supplied user_id must not be credited, got %+v", bal)
+	}
+	intent, _ := ledger.Intent(context.TODO(), momo.lastRef)
+	if intent.Status != models.LedgerCompleted {
+		t.Fatalf("intent should be settled, got %s", intent.Status)
+	}
+}
+
+func TestWallet_Topup_RejectedRequestClosesIntent(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "rejected@example.com"}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	momo := &intentMomo{fakeMomo: fakeMomo{online: true}, ledger: ledger, rejectCalls: true}
+
+	app := withUser(fiber.New(), user)
+	app.Post("/topup", handlers.NewWalletHandlerWithLedger(momo, lg, ledger).Topup)
+	req := httptest.NewRequest(http.MethodPost, "/topup", strings.NewReader(`{"amount":"25","currency":"USD","msisdn":"231770000000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", resp.StatusCode)
+	}
+	intent, err := ledger.Intent(context.TODO(), momo.lastRef)
+	if err != nil || intent.Status != models.LedgerFailed {
+		t.Fatalf("rejected request should leave a failed intent, got %+v, %v", intent, err)
+	}
+}
+
+func TestWallet_Topup_UnknownOutcomeLeavesIntentPending(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "timeout@example.com"}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	momo := &intentMomo{fakeMomo: fakeMomo{online: true}, ledger: ledger, timeout: true}
+
+	app := withUser(fiber.New(), user)
+	app.Post("/topup", handlers.NewWalletHandlerWithLedger(momo, lg, ledger).Topup)
+	req := httptest.NewRequest(http.MethodPost, "/topup", strings.NewReader(`{"amount":"25","currency":"USD","msisdn":"231770000000"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("a timed-out request may still be collected, expected 200, got %d", resp.StatusCode)
+	}
+	intent, err := ledger.Intent(context.TODO(), momo.lastRef)
+	if err != nil || intent.Status != models.LedgerPending {
+		t.Fatalf("the intent should wait for its callback or the reconciler, got %+v, %v", intent, err)
+	}
+}
+
+func TestWallet_EndToEndWithMomoSimulator(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "e2e@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+
+	// MoMo calls back into the real webhook handler over HTTP, signed with the shared secret
+	webhooks := services.NewMomoWebhookService(nil, ledger, nil, services.NewHMACCallbackVerifier("e2e-secret"), nil)
+	cbApp := fiber.New()
+	cbApp.Post("/webhooks/momo", handlers.NewWalletWebhookHandlerWithService(lg, webhooks).MomoCallback)
+	cbServer := httptest.NewServer(adaptor.FiberApp(cbApp))
+	defer cbServer.Close()
+
+	sim := momosim.New(momosim.Config{APIUser: "api-user", APIKey: "api-key", CallbackURL: cbServer.URL + "/webhooks/momo", WebhookSecret: "e2e-secret"})
+	defer sim.Close()
+	sim.SetOutcome("231770000002", momosim.Failed)
+
+	app := withUser(fiber.New(), user)
+	h := handlers.NewWalletHandlerWithLedger(sim.Client(), lg, ledger)
+	h.SetWithdrawals(newWithdrawals(t, repo, ledger, sim.Client()))
+	app.Post("/topup", h.Topup)
+	app.Post("/withdraw", h.Withdraw)
+	post := func(path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if resp, _ := app.Test(req); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+
+	post("/topup", `{"amount":"100","currency":"USD","msisdn":"231770000001"}`)
+	post("/topup", `{"amount":"70","currency":"USD","msisdn":"231770000002"}`)
+	post("/withdraw", `{"amount":"30","currency":"USD","msisdn":"231770000001"}`)
+	if errs := sim.WaitCallbacks(); len(errs) != 0 {
+		t.Fatalf("callbacks rejected: %v", errs)
+	}
+
+	// Only the approved top-up lands, and the payout comes out of it
+	if bal, _ := ledger.ComputeBalances(context.TODO(), user.ID); bal.Available != 70 {
+		t.Fatalf("expected 100 in and 30 out, got %+v", bal)
+	}
+	pending, _ := ledger.Entries().ListPending(context.TODO(), time.Now(), 10)
+	if len(pending) != 0 {
+		t.Fatalf("every intent should be settled by its callback, %d pending", len(pending))
+	}
+}
+
+// newWithdrawals returns a withdrawal service paying through momo with no limits or review
+func newWithdrawals(t *testing.T, repo database.Repository, ledger *services.WalletLedgerService, momo services.MomoAPI) *services.WithdrawalService {
+	t.Helper()
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption: %v", err)
+	}
+	providers := services.NewPaymentProviders(services.NewMomoProvider(momo))
+	return services.NewWithdrawalService(nil, repo, ledger, providers, enc, services.WithdrawalPolicy{}, nil, nil)
+}
+
+// fakeOrange is a PaymentProvider that settles whatever it was asked to collect
+type fakeOrange struct {
+	collected map[string]string // reference -> msisdn
+}
+
+func (f *fakeOrange) Name() string                           { return models.PaymentProviderOrangeMoney }
+func (f *fakeOrange) EnsureOnline(ctx context.Context) error { return nil }
+func (f *fakeOrange) Collect(ctx context.Context, req services.MobileMoneyRequest) error {
+	f.collected[req.ReferenceID] = req.MSISDN
+	return nil
+}
+func (f *fakeOrange) Disburse(ctx context.Context, req services.MobileMoneyRequest) error {
+	return errors.New("not used")
+}
+func (f *fakeOrange) Status(ctx context.Context, op services.PaymentOperation, ref string) (string, error) {
+	if _, ok := f.collected[ref]; ok {
+		return services.PaymentStatusSuccessful, nil
+	}
+	return services.PaymentStatusFailed, nil
+}
+func (f *fakeOrange) ParseCallback(body []byte) (*services.PaymentCallback, error) {
+	var n struct {
+		OrderID string `json:"orderId"`
+		Status  string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil || n.OrderID == "" {
+		return nil, services.ErrWebhookInvalidPayload
+	}
+	return &services.PaymentCallback{ReferenceID: n.OrderID, Status: n.Status, Provider: f.Name()}, nil
+}
+
+func TestWallet_Topup_RoutesToTheRequestedProvider(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "orange@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	orange := &fakeOrange{collected: map[string]string{}}
+	momo := &intentMomo{fakeMomo: fakeMomo{online: true}, ledger: ledger}
+	providers := services.NewPaymentProviders(services.NewMomoProvider(momo), orange)
+
+	app := withUser(fiber.New(), user)
+	app.Post("/topup", handlers.NewWalletHandlerWithProviders(providers, lg, ledger, nil).Topup)
+	topup := func(body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/topup", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		return resp
+	}
+
+	if resp := topup(`{"amount":"40","currency":"USD","msisdn":"231880000001","provider":"orange"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(orange.collected) != 1 || momo.lastRef != "" {
+		t.Fatalf("expected the top-up to go to Orange only, orange=%v momo=%q", orange.collected, momo.lastRef)
+	}
+	var ref string
+	for r := range orange.collected {
+		ref = r
+	}
+	if intent, err := ledger.Intent(context.TODO(), ref); err != nil || intent.Provider != models.PaymentProviderOrangeMoney {
+		t.Fatalf("intent should record the provider, got %+v, %v", intent, err)
+	}
+
+	resp := topup(`{"amount":"40","currency":"USD","msisdn":"231880000001","provider":"paypal"}`)
+	var out struct {
+		Supported []string `json:"supported"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusBadRequest || len(out.Supported) != 2 {
+		t.Fatalf("expected 400 listing the supported providers, got %d %+v", resp.StatusCode, out)
+	}
+
+	// Orange's notification comes in on its own route and is confirmed with Orange
+	webhooks := services.NewMomoWebhookService(nil, ledger, nil, services.NewHMACCallbackVerifier("s3cret"), nil)
+	cbApp := fiber.New()
+	cbApp.Post("/webhooks/:provider", handlers.NewWalletWebhookHandlerWithProviders(lg, webhooks, providers).ProviderCallback)
+	callback := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := cbApp.Test(req)
+		return resp.StatusCode
+	}
+	if code := callback("/webhooks/airtel", `{"orderId":"`+ref+`","status":"SUCCESSFUL"}`); code != http.StatusNotFound {
+		t.Fatalf("unknown provider route: expected 404, got %d", code)
+	}
+	if code := callback("/webhooks/orange_money", `{"orderId":"`+ref+`","status":"SUCCESSFUL"}`); code != http.StatusOK {
+		t.Fatalf("orange callback: expected 200, got %d", code)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), user.ID); bal.Available != 40 {
+		t.Fatalf("expected 40 credited, got %+v", bal)
+	}
+}
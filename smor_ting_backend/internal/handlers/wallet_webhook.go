@@ -1,78 +1,133 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/smorting/backend/internal/models"
 	"github.com/smorting/backend/internal/services"
 	"github.com/smorting/backend/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
 )
 
+// MomoSignatureHeader carries the hex HMAC-SHA256 of the callback body
+const MomoSignatureHeader = "X-Momo-Signature"
+
 // WalletWebhookHandler processes provider callbacks (Lonestar/MoMo)
 type WalletWebhookHandler struct {
-	logger *logger.Logger
-	ledger *services.WalletLedgerService
+	logger    *logger.Logger
+	webhooks  *services.MomoWebhookService
+	providers *services.PaymentProviders
 }
 
+// NewWalletWebhookHandler and the WithLedger/WithEscrow variants skip authenticity
+// checks and keep the inbox in memory; production wiring uses WithService.
 func NewWalletWebhookHandler(logger *logger.Logger) *WalletWebhookHandler {
-	return &WalletWebhookHandler{logger: logger}
+	return NewWalletWebhookHandlerWithEscrow(logger, nil, nil)
 }
 func NewWalletWebhookHandlerWithLedger(logger *logger.Logger, ledger *services.WalletLedgerService) *WalletWebhookHandler {
-	return &WalletWebhookHandler{logger: logger, ledger: ledger}
+	return NewWalletWebhookHandlerWithEscrow(logger, ledger, nil)
+}
+func NewWalletWebhookHandlerWithEscrow(logger *logger.Logger, ledger *services.WalletLedgerService, escrow *services.EscrowService) *WalletWebhookHandler {
+	return NewWalletWebhookHandlerWithService(logger, services.NewMomoWebhookService(nil, ledger, escrow, nil, nil))
+}
+func NewWalletWebhookHandlerWithService(logger *logger.Logger, webhooks *services.MomoWebhookService) *WalletWebhookHandler {
+	return NewWalletWebhookHandlerWithProviders(logger, webhooks, nil)
+}
+func NewWalletWebhookHandlerWithProviders(logger *logger.Logger, webhooks *services.MomoWebhookService, providers *services.PaymentProviders) *WalletWebhookHandler {
+	return &WalletWebhookHandler{logger: logger, webhooks: webhooks, providers: providers}
 }
 
-// Callback payload is provider-specific; accept generic map and log securely (no PII)
+// MomoCallback authenticates and applies a MoMo callback. Repeats of an already
+// applied reference/status are acknowledged without effect; a processing failure
+// returns 500 so MoMo retries, and the event stays in the inbox for replay.
 func (h *WalletWebhookHandler) MomoCallback(c *fiber.Ctx) error {
-	var payload struct {
-		Type        string  `json:"type"`
-		Status      string  `json:"status"`
-		Amount      float64 `json:"amount"`
-		Currency    string  `json:"currency"`
-		UserID      string  `json:"user_id"`
-		ReferenceID string  `json:"referenceId"`
-		ProviderRef string  `json:"provider_ref"`
+	event, err := h.webhooks.Receive(c.Context(), c.Body(), c.Get(MomoSignatureHeader))
+	return h.respond(c, event, err)
+}
+
+// ProviderCallback applies a notification from the provider named in the path
+// (e.g. /webhooks/orange_money), confirming its status with that provider
+func (h *WalletWebhookHandler) ProviderCallback(c *fiber.Ctx) error {
+	if h.providers == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "unknown payment provider"})
 	}
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	provider, err := h.providers.Get(c.Params("provider"))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "unknown payment provider"})
 	}
-	if h.ledger != nil && payload.UserID != "" {
-		if uid, err := primitive.ObjectIDFromHex(payload.UserID); err == nil {
-			entry := &models.WalletLedgerEntry{
-				UserID:      uid,
-				Amount:      payload.Amount,
-				Currency:    payload.Currency,
-				Reference:   payload.ReferenceID,
-				ProviderRef: payload.ProviderRef,
-				Direction:   models.LedgerCredit,
-				Status:      models.LedgerPending,
-			}
-			switch payload.Type {
-			case "topup":
-				entry.Type = models.LedgerTopup
-			case "payment":
-				entry.Type = models.LedgerPayment
-			case "escrow_hold":
-				entry.Type = models.LedgerEscrowHold
-				entry.IsEscrow = true
-			case "escrow_release":
-				entry.Type = models.LedgerEscrowRelease
-			case "withdraw":
-				entry.Type = models.LedgerWithdraw
-				entry.Direction = models.LedgerDebit
-			}
-			if payload.Status == "SUCCESSFUL" {
-				entry.Status = models.LedgerCompleted
-				// Escrow holds should remain Pending (counted in pending/held balance)
-				if entry.Type == models.LedgerEscrowHold {
-					entry.Status = models.LedgerPending
-				}
-			} else if payload.Status == "FAILED" {
-				entry.Status = models.LedgerFailed
-			}
-			_ = h.ledger.RecordEntry(c.Context(), entry)
+	event, err := h.webhooks.ReceiveFrom(c.Context(), provider, c.Body())
+	return h.respond(c, event, err)
+}
+
+// respond maps the outcome of a callback onto the status the provider expects
+func (h *WalletWebhookHandler) respond(c *fiber.Ctx, event *models.WebhookEvent, err error) error {
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{"status": "ok"})
+	case errors.Is(err, services.ErrWebhookDuplicate):
+		return c.JSON(fiber.Map{"status": "duplicate"})
+	case errors.Is(err, services.ErrWebhookInvalidPayload):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	case errors.Is(err, services.ErrWebhookUnknownReference):
+		h.logger.Warn("Payment callback for unknown reference", zap.String("path", c.Path()), zap.String("ip", c.IP()))
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "unknown reference"})
+	case errors.Is(err, services.ErrWebhookUnauthenticated):
+		h.logger.Warn("Rejected unauthenticated payment callback", zap.String("path", c.Path()), zap.String("ip", c.IP()), zap.Error(err))
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated callback"})
+	default:
+		fields := []zap.Field{}
+		if event != nil {
+			fields = append(fields, zap.String("event_id", event.ID.Hex()), zap.String("reference_id", event.ReferenceID))
 		}
+		h.logger.Error("Failed to process payment callback", err, fields...)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "callback processing failed"})
+	}
+}
+
+// ListEvents returns inbox events by state (default failed) for operators
+func (h *WalletWebhookHandler) ListEvents(c *fiber.Ctx) error {
+	state := models.WebhookEventState(c.Query("state", string(models.WebhookFailed)))
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid limit"})
+	}
+	events, err := h.webhooks.Events(c.Context(), state, limit)
+	if err != nil {
+		h.logger.Error("Failed to list webhook events", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list webhook events"})
+	}
+	return c.JSON(fiber.Map{"data": events})
+}
+
+// ReplayEvent re-applies a single failed inbox event
+func (h *WalletWebhookHandler) ReplayEvent(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid event id"})
+	}
+	event, err := h.webhooks.Replay(c.Context(), id)
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{"data": event})
+	case errors.Is(err, services.ErrWebhookEventNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "webhook event not found"})
+	case errors.Is(err, services.ErrWebhookNotReplayable), errors.Is(err, services.ErrWebhookDuplicate):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "webhook event is not in a failed state"})
+	default:
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error(), "data": event})
+	}
+}
+
+// ReplayFailed re-applies every failed inbox event, oldest first
+func (h *WalletWebhookHandler) ReplayFailed(c *fiber.Ctx) error {
+	n, err := h.webhooks.ReplayFailed(c.Context(), 0)
+	if err != nil {
+		h.logger.Error("Failed to replay webhook events", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to replay webhook events"})
 	}
-	return c.JSON(fiber.Map{"status": "ok"})
+	return c.JSON(fiber.Map{"replayed": n})
 }
@@ -93,3 +93,46 @@ func TestMomoWebhook_EscrowHoldAndRelease(t *testing.T) {
 		t.Fatalf("after release unexpected balances: %+v", bal2)
 	}
 }
+
+func TestMomoWebhook_RejectsUnsignedAndAcksDuplicates(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	user := &models.User{Email: "signed@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), user)
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordIntent(context.TODO(), &models.WalletLedgerEntry{
+		UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 300, Currency: "USD", Reference: "ref-signed",
+	})
+	verifier := services.NewHMACCallbackVerifier("webhook-secret")
+	lg, _ := logger.New("debug", "console", "stdout")
+	wh := handlers.NewWalletWebhookHandlerWithService(lg, services.NewMomoWebhookService(nil, ledger, nil, verifier, nil))
+
+	app := fiber.New()
+	app.Post("/webhooks/momo", wh.MomoCallback)
+
+	body, _ := json.Marshal(map[string]any{"type": "topup", "status": "SUCCESSFUL", "amount": 300.0, "currency": "USD", "user_id": user.ID.Hex(), "referenceId": "ref-signed"})
+	post := func(signature string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/momo", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if signature != "" {
+			req.Header.Set(handlers.MomoSignatureHeader, signature)
+		}
+		resp, _ := app.Test(req)
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		status, _ := out["status"].(string)
+		return resp.StatusCode, status
+	}
+
+	if code, _ := post(""); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned callback expected 401, got %d", code)
+	}
+	if code, status := post(verifier.Sign(body)); code != http.StatusOK || status != "ok" {
+		t.Fatalf("signed callback expected 200 ok, got %d %q", code, status)
+	}
+	if code, status := post(verifier.Sign(body)); code != http.StatusOK || status != "duplicate" {
+		t.Fatalf("retried callback expected 200 duplicate, got %d %q", code, status)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), user.ID); bal.Available != 300 {
+		t.Fatalf("expected a single 300 credit, got %+v", bal)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// WithdrawalHandler lists withdrawals and lets admins work the review queue
+type WithdrawalHandler struct {
+	withdrawals *services.WithdrawalService
+	logger      *logger.Logger
+}
+
+func NewWithdrawalHandler(withdrawals *services.WithdrawalService, logger *logger.Logger) *WithdrawalHandler {
+	return &WithdrawalHandler{withdrawals: withdrawals, logger: logger}
+}
+
+// ReviewRequest carries the admin's note on an approval or rejection
+type ReviewRequest struct {
+	Note string `json:"note"`
+}
+
+// Mine returns the caller's newest withdrawals
+func (h *WithdrawalHandler) Mine(c *fiber.Ctx) error {
+	user, _ := c.Locals("user").(*models.User)
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	list, err := h.withdrawals.List(c.Context(), services.WithdrawalFilter{UserID: &user.ID, Limit: limit})
+	if err != nil {
+		return h.fail(c, nil, err)
+	}
+	return c.JSON(fiber.Map{"data": list})
+}
+
+// Queue returns withdrawals awaiting review, newest first; ?status lists
+// another status and ?user_id narrows them to one user
+func (h *WithdrawalHandler) Queue(c *fiber.Ctx) error {
+	f := services.WithdrawalFilter{Status: models.WithdrawalStatus(c.Query("status", string(models.WithdrawalPendingReview)))}
+	switch f.Status {
+	case models.WithdrawalPendingReview, models.WithdrawalSubmitted, models.WithdrawalRejected, models.WithdrawalFailed:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid status"})
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_id"})
+		}
+		f.UserID = &id
+	}
+	f.Limit, _ = strconv.Atoi(c.Query("limit", "50"))
+	list, err := h.withdrawals.List(c.Context(), f)
+	if err != nil {
+		return h.fail(c, nil, err)
+	}
+	return c.JSON(fiber.Map{"data": list})
+}
+
+func (h *WithdrawalHandler) Get(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid withdrawal id"})
+	}
+	w, err := h.withdrawals.Get(c.Context(), id)
+	if err != nil {
+		return h.fail(c, nil, err)
+	}
+	return c.JSON(fiber.Map{"data": w})
+}
+
+// Approve pays the reviewed withdrawal :id
+func (h *WithdrawalHandler) Approve(c *fiber.Ctx) error {
+	return h.review(c, h.withdrawals.Approve)
+}
+
+// Reject declines the reviewed withdrawal :id
+func (h *WithdrawalHandler) Reject(c *fiber.Ctx) error {
+	return h.review(c, h.withdrawals.Reject)
+}
+
+type reviewFunc func(ctx context.Context, admin *models.User, id primitive.ObjectID, note string, ac services.AuditContext) (*models.Withdrawal, error)
+
+func (h *WithdrawalHandler) review(c *fiber.Ctx, decide reviewFunc) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid withdrawal id"})
+	}
+	var req ReviewRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+		}
+	}
+	admin, _ := c.Locals("user").(*models.User)
+	w, err := decide(c.Context(), admin, id, req.Note, auditContext(c))
+	if err != nil {
+		return h.fail(c, w, err)
+	}
+	return c.JSON(fiber.Map{"data": w})
+}
+
+// fail maps withdrawal errors onto responses; a withdrawal that was recorded is returned with the error
+func (h *WithdrawalHandler) fail(c *fiber.Ctx, w *models.Withdrawal, err error) error {
+	body := fiber.Map{"error": err.Error()}
+	if w != nil {
+		body["data"] = w
+	}
+	switch {
+	case errors.Is(err, services.ErrWithdrawalNotFound):
+		return c.Status(http.StatusNotFound).JSON(body)
+	case errors.Is(err, services.ErrWithdrawalNotPending), errors.Is(err, services.ErrWithdrawalStateChanged):
+		return c.Status(http.StatusConflict).JSON(body)
+	case errors.Is(err, services.ErrInsufficientBalance):
+		return c.Status(http.StatusUnprocessableEntity).JSON(body)
+	case errors.Is(err, services.ErrWithdrawalPayoutRejected):
+		h.logger.Error("Withdrawal payout failed", err, zap.String("withdrawal_id", w.ID.Hex()))
+		body["error"] = "withdrawal failed"
+		return c.Status(http.StatusBadGateway).JSON(body)
+	default:
+		h.logger.Error("Withdrawal request failed", err, zap.String("path", c.Path()))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "withdrawal request failed"})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"github.com/smorting/backend/pkg/logger"
+)
+
+func TestWithdraw_FlaggedWithdrawalWaitsForAdminApproval(t *testing.T) {
+	lg, _ := logger.New("debug", "console", "stdout")
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	provider := &models.User{Email: "payout@example.com", Role: models.ProviderRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, provider)
+	ledger := services.NewWalletLedgerService(repo)
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: provider.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 300, Status: models.LedgerCompleted, Reference: "earned"})
+
+	key, _ := services.GenerateEncryptionKey()
+	enc, _ := services.NewEncryptionService(key)
+	providers := services.NewPaymentProviders(services.NewMomoProvider(&fakeMomo{online: true}))
+	withdrawals := services.NewWithdrawalService(nil, repo, ledger, providers, enc, services.WithdrawalPolicy{
+		Limits:        map[models.UserRole]services.WithdrawalLimit{models.ProviderRole: {Daily: 250}},
+		NewNumberHold: 24 * time.Hour,
+	}, nil, nil)
+	wallet := handlers.NewWalletHandlerWithProviders(providers, lg, ledger, nil)
+	wallet.SetWithdrawals(withdrawals)
+	h := handlers.NewWithdrawalHandler(withdrawals, lg)
+
+	app := withUser(fiber.New(), provider)
+	app.Post("/wallet/withdraw", wallet.Withdraw)
+	admin := withUser(fiber.New(), &models.User{Email: "admin@example.com", Role: models.AdminRole})
+	admin.Get("/admin/withdrawals", h.Queue)
+	admin.Post("/admin/withdrawals/:id/approve", h.Approve)
+
+	send := func(app *fiber.App, method, path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	if code, _ := send(app, http.MethodPost, "/wallet/withdraw", `{"amount":"260","msisdn":"231880000001"}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the daily limit to reject 260, got %d", code)
+	}
+	code, out := send(app, http.MethodPost, "/wallet/withdraw", `{"amount":"200","msisdn":"231880000001"}`)
+	if code != http.StatusAccepted || out["status"] != "PENDING_REVIEW" {
+		t.Fatalf("expected a new number to be queued, got %d %v", code, out)
+	}
+	id, _ := out["withdrawal_id"].(string)
+
+	code, out = send(admin, http.MethodGet, "/admin/withdrawals", "")
+	if queue, _ := out["data"].([]interface{}); code != http.StatusOK || len(queue) != 1 {
+		t.Fatalf("expected one queued withdrawal, got %d %v", code, out)
+	}
+	code, out = send(admin, http.MethodPost, "/admin/withdrawals/"+id+"/approve", `{"note":"verified by phone"}`)
+	data, _ := out["data"].(map[string]interface{})
+	if code != http.StatusOK || data["status"] != string(models.WithdrawalSubmitted) || data["reference"] == "" {
+		t.Fatalf("expected approval to submit the payout, got %d %v", code, out)
+	}
+	if code, _ := send(admin, http.MethodPost, "/admin/withdrawals/"+id+"/approve", ""); code != http.StatusConflict {
+		t.Fatalf("expected a second approval to conflict, got %d", code)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProviderAvailability is a provider's booking calendar: the weekly hours they
+// work, blocks of time off and the travel buffer kept clear between jobs.
+// Times are Liberian time, which is GMT all year, so they are stored in UTC.
+type ProviderAvailability struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProviderID primitive.ObjectID `json:"provider_id" bson:"provider_id"` // the provider's user ID
+	// WeeklyHours are the open windows; a day may have several, e.g. around lunch
+	WeeklyHours []WorkingHours `json:"weekly_hours" bson:"weekly_hours"`
+	TimeOff     []TimeOff      `json:"time_off" bson:"time_off"`
+	// BufferMinutes is kept free before and after every job for travel
+	BufferMinutes int       `json:"buffer_minutes" bson:"buffer_minutes"`
+	Version       int       `json:"version" bson:"version"`
+	CreatedAt     time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkingHours is one open window on a weekday, from Start to End as "15:04"
+type WorkingHours struct {
+	Weekday time.Weekday `json:"weekday" bson:"weekday"` // 0 = Sunday
+	Start   string       `json:"start" bson:"start"`
+	End     string       `json:"end" bson:"end"`
+}
+
+// TimeOff blocks the provider's calendar from Start up to End
+type TimeOff struct {
+	ID     primitive.ObjectID `json:"id" bson:"id"`
+	Start  time.Time          `json:"start" bson:"start"`
+	End    time.Time          `json:"end" bson:"end"`
+	Reason string             `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// TimeSlot is a bookable start time for a service and when the job would end
+type TimeSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EscrowStatus string
+
+const (
+	EscrowAwaitingFunds  EscrowStatus = "awaiting_funds"  // request-to-pay sent, hold not yet confirmed
+	EscrowHeld           EscrowStatus = "held"            // funds confirmed and held for the booking
+	EscrowReleasePending EscrowStatus = "release_pending" // booking completed, waiting out the dispute window
+	EscrowDisputed       EscrowStatus = "disputed"        // release halted until resolved by an admin
+	EscrowReleased       EscrowStatus = "released"        // paid out to the provider's wallet
+	EscrowRefunded       EscrowStatus = "refunded"        // returned to the customer's wallet
+	EscrowCancelled      EscrowStatus = "cancelled"       // booking cancelled before funds arrived
+	EscrowFailed         EscrowStatus = "failed"          // the hold payment failed
+)
+
+// Escrow links a booking to the MoMo hold that pays for it
+type Escrow struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BookingID     primitive.ObjectID `json:"booking_id" bson:"booking_id"`
+	CustomerID    primitive.ObjectID `json:"customer_id" bson:"customer_id"`
+	ProviderID    primitive.ObjectID `json:"provider_id" bson:"provider_id"`
+	HoldReference string             `json:"hold_reference" bson:"hold_reference"`
+	Amount        float64            `json:"amount" bson:"amount"`
+	Currency      string             `json:"currency" bson:"currency"`
+	Status        EscrowStatus       `json:"status" bson:"status"`
+	// RefundedAmount is what partial refunds have already returned to the customer
+	RefundedAmount float64    `json:"refunded_amount,omitempty" bson:"refunded_amount,omitempty"`
+	ReleaseAt      *time.Time `json:"release_at,omitempty" bson:"release_at,omitempty"`
+	SettledAt      *time.Time `json:"settled_at,omitempty" bson:"settled_at,omitempty"`
+	// Fees is how the release was split between the provider and the platform
+	Fees *FeeBreakdown `json:"fees,omitempty" bson:"fees,omitempty"`
+	// Version is bumped by every store update so a stale copy cannot overwrite a refund
+	Version   int64     `json:"-" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Outstanding is the part of the escrow not yet refunded, i.e. what a release pays out
+func (e *Escrow) Outstanding() float64 {
+	return math.Round((e.Amount-e.RefundedAmount)*100) / 100
+}
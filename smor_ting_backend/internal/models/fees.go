@@ -0,0 +1,119 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidFeeSchedule = errors.New("invalid fee schedule")
+
+// CommissionRule is the platform's cut of a booking in one service category.
+// The rule without a CategoryID applies to every category that has none.
+type CommissionRule struct {
+	CategoryID *primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"`
+	Percent    float64             `json:"percent" bson:"percent"`
+	MinFee     float64             `json:"min_fee,omitempty" bson:"min_fee,omitempty"`
+	MaxFee     float64             `json:"max_fee,omitempty" bson:"max_fee,omitempty"` // 0 means uncapped
+}
+
+// FeePromotion waives fees on releases in [StartsAt, EndsAt), for one category
+// or for all of them when CategoryID is nil
+type FeePromotion struct {
+	Name            string              `json:"name" bson:"name"`
+	CategoryID      *primitive.ObjectID `json:"category_id,omitempty" bson:"category_id,omitempty"`
+	StartsAt        time.Time           `json:"starts_at" bson:"starts_at"`
+	EndsAt          time.Time           `json:"ends_at" bson:"ends_at"`
+	WaiveCommission bool                `json:"waive_commission" bson:"waive_commission"`
+	WaiveMomoFee    bool                `json:"waive_momo_fee" bson:"waive_momo_fee"`
+}
+
+// Applies reports whether the promotion covers a release in categoryID at t
+func (p *FeePromotion) Applies(categoryID primitive.ObjectID, t time.Time) bool {
+	if p.CategoryID != nil && *p.CategoryID != categoryID {
+		return false
+	}
+	return !t.Before(p.StartsAt) && t.Before(p.EndsAt)
+}
+
+// FeeSchedule is the full set of fee rules applied when escrow is released
+type FeeSchedule struct {
+	Commission []CommissionRule `json:"commission" bson:"commission"`
+	// MomoFees is the flat mobile money fee deducted from each release, by currency
+	MomoFees   map[string]float64 `json:"momo_fees" bson:"momo_fees"`
+	Promotions []FeePromotion     `json:"promotions" bson:"promotions"`
+	UpdatedBy  primitive.ObjectID `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Validate checks percentages, fee bounds and promotion periods, and that each category has at most one rule
+func (s *FeeSchedule) Validate() error {
+	seen := map[primitive.ObjectID]bool{}
+	for _, rule := range s.Commission {
+		if rule.Percent < 0 || rule.Percent > 100 || rule.MinFee < 0 || rule.MaxFee < 0 ||
+			(rule.MaxFee > 0 && rule.MaxFee < rule.MinFee) {
+			return ErrInvalidFeeSchedule
+		}
+		key := primitive.NilObjectID
+		if rule.CategoryID != nil {
+			key = *rule.CategoryID
+		}
+		if seen[key] {
+			return ErrInvalidFeeSchedule
+		}
+		seen[key] = true
+	}
+	for _, fee := range s.MomoFees {
+		if fee < 0 {
+			return ErrInvalidFeeSchedule
+		}
+	}
+	for _, promo := range s.Promotions {
+		if promo.Name == "" || !promo.EndsAt.After(promo.StartsAt) || (!promo.WaiveCommission && !promo.WaiveMomoFee) {
+			return ErrInvalidFeeSchedule
+		}
+	}
+	return nil
+}
+
+// FeeBreakdown is how a release is split between the provider and the platform
+type FeeBreakdown struct {
+	Gross             float64 `json:"gross" bson:"gross"`
+	CommissionPercent float64 `json:"commission_percent" bson:"commission_percent"`
+	Commission        float64 `json:"commission" bson:"commission"`
+	MomoFee           float64 `json:"momo_fee" bson:"momo_fee"`
+	Net               float64 `json:"net" bson:"net"`
+	Currency          string  `json:"currency" bson:"currency"`
+	Promotion         string  `json:"promotion,omitempty" bson:"promotion,omitempty"`
+}
+
+// EarningsLine is one release to (or clawback from) a provider on an earnings statement
+type EarningsLine struct {
+	Date       time.Time  `json:"date"`
+	Type       LedgerType `json:"type"`
+	Reference  string     `json:"reference"`
+	Item       string     `json:"item"`
+	Gross      float64    `json:"gross"`
+	Commission float64    `json:"commission"`
+	MomoFee    float64    `json:"momo_fee"`
+	Net        float64    `json:"net"`
+	Currency   string     `json:"currency"`
+}
+
+// EarningsTotal sums a statement's lines in one currency
+type EarningsTotal struct {
+	Gross      float64 `json:"gross"`
+	Commission float64 `json:"commission"`
+	MomoFees   float64 `json:"momo_fees"`
+	Net        float64 `json:"net"`
+}
+
+// EarningsStatement itemises a provider's releases, fees and clawbacks over [From, To)
+type EarningsStatement struct {
+	ProviderID primitive.ObjectID       `json:"provider_id"`
+	From       time.Time                `json:"from"`
+	To         time.Time                `json:"to"`
+	Lines      []EarningsLine           `json:"lines"`
+	Totals     map[string]EarningsTotal `json:"totals"` // by currency
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Wallet currencies; Liberia prices in both
+const (
+	CurrencyUSD = "USD"
+	CurrencyLRD = "LRD"
+)
+
+// DefaultCurrency is used for wallets and entries that do not name one
+const DefaultCurrency = CurrencyUSD
+
+var SupportedCurrencies = []string{CurrencyUSD, CurrencyLRD}
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// NormalizeCurrency upper-cases a currency code and reports whether wallets support it
+func NormalizeCurrency(currency string) (string, bool) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	for _, c := range SupportedCurrencies {
+		if c == currency {
+			return currency, true
+		}
+	}
+	return currency, false
+}
+
+// FXRate prices one Base unit in Quote units, e.g. USD/LRD 190 means 1 USD = 190 LRD.
+// The opposite direction is derived from it.
+type FXRate struct {
+	Base      string             `json:"base" bson:"base"`
+	Quote     string             `json:"quote" bson:"quote"`
+	Rate      float64            `json:"rate" bson:"rate"`
+	UpdatedBy primitive.ObjectID `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Pair identifies the rate, e.g. "USD/LRD"
+func (r *FXRate) Pair() string {
+	return r.Base + "/" + r.Quote
+}
+
+// FXQuote locks a conversion for one booking payment until ExpiresAt: the
+// customer pays FromAmount in From so that ToAmount in To lands in escrow
+type FXQuote struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	BookingID  primitive.ObjectID `json:"booking_id" bson:"booking_id"`
+	From       string             `json:"from" bson:"from"`
+	FromAmount float64            `json:"from_amount" bson:"from_amount"`
+	To         string             `json:"to" bson:"to"`
+	ToAmount   float64            `json:"to_amount" bson:"to_amount"`
+	// Rate is To units per From unit
+	Rate      float64    `json:"rate" bson:"rate"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	// Reference is the escrow hold the quote paid for
+	Reference string    `json:"reference,omitempty" bson:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
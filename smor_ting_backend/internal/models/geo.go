@@ -0,0 +1,28 @@
+package models
+
+// GeoPoint is a GeoJSON point, the shape MongoDB 2dsphere indexes need.
+// Coordinates are [longitude, latitude].
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// NewGeoPoint returns the point at lat/lng, or nil when they are out of range (or NaN)
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	if !(lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180) {
+		return nil
+	}
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+func (p *GeoPoint) Lng() float64 { return p.Coordinates[0] }
+func (p *GeoPoint) Lat() float64 { return p.Coordinates[1] }
+
+// GeoPoint returns the address's coordinates as a point. Addresses saved
+// without coordinates carry 0/0, which is treated as no location.
+func (a Address) GeoPoint() *GeoPoint {
+	if a.Latitude == 0 && a.Longitude == 0 {
+		return nil
+	}
+	return NewGeoPoint(a.Latitude, a.Longitude)
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobRequestStatus is where a customer's job request stands
+type JobRequestStatus string
+
+const (
+	JobRequestOpen      JobRequestStatus = "open"      // nearby providers may quote
+	JobRequestBooked    JobRequestStatus = "booked"    // a quote was accepted and booked
+	JobRequestCancelled JobRequestStatus = "cancelled" // withdrawn by the customer
+)
+
+// JobRequest is work a customer describes for providers to quote on, for jobs
+// such as roofing or wiring that cannot be priced up front
+type JobRequest struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CustomerID  primitive.ObjectID `json:"customer_id" bson:"customer_id"`
+	CategoryID  primitive.ObjectID `json:"category_id" bson:"category_id,omitempty"`
+	Title       string             `json:"title" bson:"title"`
+	Description string             `json:"description" bson:"description"`
+	Photos      []string           `json:"photos" bson:"photos"` // image URLs
+	Location    Address            `json:"location" bson:"location"`
+	// Geo mirrors Location's coordinates for finding jobs near a provider
+	Geo           *GeoPoint           `json:"geo,omitempty" bson:"geo,omitempty"`
+	PreferredDate *time.Time          `json:"preferred_date,omitempty" bson:"preferred_date,omitempty"`
+	Status        JobRequestStatus    `json:"status" bson:"status"`
+	QuoteID       *primitive.ObjectID `json:"quote_id,omitempty" bson:"quote_id,omitempty"`     // the accepted quote
+	BookingID     *primitive.ObjectID `json:"booking_id,omitempty" bson:"booking_id,omitempty"` // booked from it
+	// ExpiresAt is when an open request stops taking quotes
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// DistanceKm is filled in when jobs are listed near a provider
+	DistanceKm *float64 `json:"distance_km,omitempty" bson:"-"`
+}
+
+// QuoteStatus is where a provider's quote stands
+type QuoteStatus string
+
+const (
+	QuotePending   QuoteStatus = "pending"   // awaiting the customer
+	QuoteCountered QuoteStatus = "countered" // the customer proposed another price; awaiting the provider
+	QuoteAccepted  QuoteStatus = "accepted"  // booked
+	QuoteRejected  QuoteStatus = "rejected"  // by the customer, or because another quote was accepted
+	// QuoteExpired is reported for pending and countered quotes past ExpiresAt; it is never stored
+	QuoteExpired QuoteStatus = "expired"
+)
+
+// Quote is a provider's offer for a job request. A customer counter moves it to
+// countered and the provider answers by revising it; every offer is kept in Offers.
+type Quote struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	JobRequestID primitive.ObjectID `json:"job_request_id" bson:"job_request_id"`
+	ProviderID   primitive.ObjectID `json:"provider_id" bson:"provider_id"`
+	Price        float64            `json:"price" bson:"price"`
+	Currency     string             `json:"currency" bson:"currency"`
+	Duration     int                `json:"duration" bson:"duration"` // in minutes
+	// ScheduledDate is when the provider would start; it must be an open slot in their calendar
+	ScheduledDate time.Time   `json:"scheduled_date" bson:"scheduled_date"`
+	Message       string      `json:"message,omitempty" bson:"message,omitempty"`
+	ExpiresAt     time.Time   `json:"expires_at" bson:"expires_at"`
+	Status        QuoteStatus `json:"status" bson:"status"`
+	// CounterPrice is the customer's latest counter-offer
+	CounterPrice *float64     `json:"counter_price,omitempty" bson:"counter_price,omitempty"`
+	Offers       []QuoteOffer `json:"offers" bson:"offers"`
+	// Version guards against the customer and provider answering at the same time
+	Version   int       `json:"version" bson:"version"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// QuoteOffer is one step of the negotiation over a quote
+type QuoteOffer struct {
+	By      UserRole  `json:"by" bson:"by"` // provider or customer
+	Price   float64   `json:"price" bson:"price"`
+	Message string    `json:"message,omitempty" bson:"message,omitempty"`
+	At      time.Time `json:"at" bson:"at"`
+}
+
+// Open reports whether the quote is still being negotiated at now
+func (q *Quote) Open(now time.Time) bool {
+	return (q.Status == QuotePending || q.Status == QuoteCountered) && now.Before(q.ExpiresAt)
+}
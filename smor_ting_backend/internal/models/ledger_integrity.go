@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SecureLedgerRecord is a wallet ledger entry as archived in the system of record:
+// the entry encrypted, plus plaintext copies of its metadata for querying
+type SecureLedgerRecord struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Type        LedgerType         `bson:"type" json:"type"`
+	Direction   LedgerDirection    `bson:"direction" json:"direction"`
+	Amount      float64            `bson:"amount" json:"amount"`
+	Currency    string             `bson:"currency" json:"currency"`
+	Status      LedgerStatus       `bson:"status" json:"status"`
+	IsEscrow    bool               `bson:"is_escrow" json:"is_escrow"`
+	Reference   string             `bson:"reference" json:"reference"`
+	ProviderRef string             `bson:"provider_ref" json:"provider_ref"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Encrypted   string             `bson:"encrypted" json:"-"`
+}
+
+// LedgerIntegrityProblem says what is wrong with an archived ledger entry
+type LedgerIntegrityProblem string
+
+const (
+	// LedgerRecordUndecryptable: the encrypted payload is corrupt or was not written with our key
+	LedgerRecordUndecryptable LedgerIntegrityProblem = "undecryptable"
+	// LedgerRecordMismatch: the plaintext metadata no longer matches the encrypted payload
+	LedgerRecordMismatch LedgerIntegrityProblem = "mismatch"
+	// LedgerRecordMissing: a posted ledger transaction has no archived entry
+	LedgerRecordMissing LedgerIntegrityProblem = "missing"
+)
+
+// LedgerIntegrityIssue is one tampered or missing archived entry
+type LedgerIntegrityIssue struct {
+	Problem LedgerIntegrityProblem `json:"problem"`
+	// RecordID is the archived record, or the ledger transaction for missing entries
+	RecordID  primitive.ObjectID `json:"record_id"`
+	UserID    primitive.ObjectID `json:"user_id"`
+	Type      LedgerType         `json:"type"`
+	Reference string             `json:"reference"`
+	// Fields lists the metadata columns that differ from the payload
+	Fields []string `json:"fields,omitempty"`
+}
+
+// LedgerIntegrityReport is the result of checking the archived ledger entries
+type LedgerIntegrityReport struct {
+	Records      int                    `json:"records"`
+	Transactions int                    `json:"transactions"`
+	Tampered     int                    `json:"tampered"`
+	Missing      int                    `json:"missing"`
+	Issues       []LedgerIntegrityIssue `json:"issues"`
+	CheckedAt    time.Time              `json:"checked_at"`
+}
+
+// OK reports whether no tampered or missing entries were found
+func (r *LedgerIntegrityReport) OK() bool {
+	return len(r.Issues) == 0
+}
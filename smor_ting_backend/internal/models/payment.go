@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,14 +14,55 @@ const (
 	PaymentMethodCard        PaymentMethodType = "card"
 )
 
+// Mobile-money providers a LinkedPaymentMethod can name
+const (
+	PaymentProviderMTNMomo     = "mtn_momo"
+	PaymentProviderOrangeMoney = "orange_money"
+)
+
+// PaymentProviderAliases maps other names clients use for a provider onto the canonical one
+var PaymentProviderAliases = map[string]string{
+	"mtn":               PaymentProviderMTNMomo,
+	"mtn_mobile_money":  PaymentProviderMTNMomo,
+	"lonestar":          PaymentProviderMTNMomo,
+	"lonestar_cell_mtn": PaymentProviderMTNMomo,
+	"orange":            PaymentProviderOrangeMoney,
+}
+
+// CanonicalPaymentProvider resolves a provider name or alias to its canonical name
+func CanonicalPaymentProvider(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case PaymentProviderMTNMomo, PaymentProviderOrangeMoney:
+		return name, true
+	}
+	canonical, ok := PaymentProviderAliases[name]
+	return canonical, ok
+}
+
+// Linked payment method lifecycle: pending until the owner confirms the OTP sent to the number
+const (
+	PaymentMethodPending  = "pending"
+	PaymentMethodActive   = "active"
+	PaymentMethodDisabled = "disabled"
+)
+
 type LinkedPaymentMethod struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
-	Type      PaymentMethodType  `json:"type" bson:"type"`
-	Provider  string             `json:"provider" bson:"provider"`
-	Msisdn    string             `json:"msisdn" bson:"msisdn"` // masked in responses
-	IsDefault bool               `json:"is_default" bson:"is_default"`
-	Status    string             `json:"status" bson:"status"` // active, pending, disabled
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID          primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Type            PaymentMethodType  `json:"type" bson:"type"`
+	Provider        string             `json:"provider" bson:"provider"`
+	Msisdn          string             `json:"msisdn" bson:"msisdn"` // masked; the full number is only stored encrypted
+	MsisdnEncrypted string             `json:"-" bson:"msisdn_encrypted"`
+	IsDefault       bool               `json:"is_default" bson:"is_default"`
+	Status          string             `json:"status" bson:"status"` // active, pending, disabled
+	VerifiedAt      *time.Time         `json:"verified_at,omitempty" bson:"verified_at,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Ownership verification while pending
+	OTPHash         string     `json:"-" bson:"otp_hash,omitempty"`
+	OTPExpiresAt    *time.Time `json:"-" bson:"otp_expires_at,omitempty"`
+	OTPAttempts     int        `json:"-" bson:"otp_attempts,omitempty"`
+	DefaultOnVerify bool       `json:"-" bson:"default_on_verify,omitempty"`
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutBatchStatus string
+
+const (
+	PayoutBatchProcessing      PayoutBatchStatus = "processing"       // items are being sent or await the provider
+	PayoutBatchCompleted       PayoutBatchStatus = "completed"        // every item was paid
+	PayoutBatchPartiallyFailed PayoutBatchStatus = "partially_failed" // settled with some failed items; a retry pays only those
+	PayoutBatchFailed          PayoutBatchStatus = "failed"           // no item was paid
+)
+
+type PayoutItemStatus string
+
+const (
+	PayoutItemPending   PayoutItemStatus = "pending"   // recorded and reserved, not yet sent
+	PayoutItemSubmitted PayoutItemStatus = "submitted" // the provider accepted the transfer
+	PayoutItemCompleted PayoutItemStatus = "completed" // the provider paid it
+	PayoutItemFailed    PayoutItemStatus = "failed"    // nothing was paid; the item may be retried
+)
+
+// PayoutBatch is one run paying providers' wallet balances out to mobile money
+type PayoutBatch struct {
+	ID          primitive.ObjectID       `json:"id" bson:"_id,omitempty"`
+	Status      PayoutBatchStatus        `json:"status" bson:"status"`
+	TriggeredBy *primitive.ObjectID      `json:"triggered_by,omitempty" bson:"triggered_by,omitempty"` // the admin; empty when scheduled
+	ItemCount   int                      `json:"item_count" bson:"item_count"`
+	Totals      map[string]float64       `json:"totals" bson:"totals"` // currency -> amount
+	Counts      map[PayoutItemStatus]int `json:"counts" bson:"counts"`
+	Skipped     int                      `json:"skipped" bson:"skipped"` // eligible providers without a payout number
+	CreatedAt   time.Time                `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at" bson:"updated_at"`
+	CompletedAt *time.Time               `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
+
+// PayoutItem pays one provider's balance in one currency. Each attempt has its
+// own disbursement reference; a failed attempt is retried under a new one.
+type PayoutItem struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BatchID         primitive.ObjectID `json:"batch_id" bson:"batch_id"`
+	UserID          primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Amount          float64            `json:"amount" bson:"amount"`
+	Currency        string             `json:"currency" bson:"currency"`
+	Provider        string             `json:"provider" bson:"provider"`
+	Msisdn          string             `json:"msisdn" bson:"msisdn"` // masked
+	MsisdnEncrypted string             `json:"-" bson:"msisdn_encrypted"`
+	Reference       string             `json:"reference" bson:"reference"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	Status          PayoutItemStatus   `json:"status" bson:"status"`
+	Failure         string             `json:"failure,omitempty" bson:"failure,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+	CompletedAt     *time.Time         `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
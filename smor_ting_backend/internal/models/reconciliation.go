@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReconciliationMismatch is one wallet entry whose ledger status disagrees with MoMo
+type ReconciliationMismatch struct {
+	EntryID        primitive.ObjectID `json:"entry_id" bson:"entry_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Type           LedgerType         `json:"type" bson:"type"`
+	Reference      string             `json:"reference" bson:"reference"`
+	Amount         float64            `json:"amount" bson:"amount"`
+	Currency       string             `json:"currency" bson:"currency"`
+	LedgerStatus   LedgerStatus       `json:"ledger_status" bson:"ledger_status"`
+	ProviderStatus string             `json:"provider_status" bson:"provider_status"`
+	Error          string             `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// ReconciliationReport compares one day of MoMo-backed wallet entries with the provider
+type ReconciliationReport struct {
+	ID          primitive.ObjectID       `json:"id" bson:"_id,omitempty"`
+	Date        string                   `json:"date" bson:"date"` // YYYY-MM-DD (UTC) of the entries checked
+	Checked     int                      `json:"checked" bson:"checked"`
+	Matched     int                      `json:"matched" bson:"matched"`
+	Mismatches  []ReconciliationMismatch `json:"mismatches" bson:"mismatches"`
+	GeneratedAt time.Time                `json:"generated_at" bson:"generated_at"`
+}
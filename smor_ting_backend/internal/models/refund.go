@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefundKind says where the refunded money was originally paid and how it is returned
+type RefundKind string
+
+const (
+	RefundCard        RefundKind = "card"         // card charge, refunded through the card gateway
+	RefundMobileMoney RefundKind = "mobile_money" // mobile money collection, paid back by disbursement
+	RefundWallet      RefundKind = "wallet"       // released escrow, moved back from the provider's wallet
+	RefundEscrow      RefundKind = "escrow"       // funds still held in escrow, returned to the customer's wallet
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"   // waiting for the provider to confirm the payout
+	RefundCompleted RefundStatus = "completed" // money returned
+	RefundFailed    RefundStatus = "failed"    // nothing was returned; the amount may be refunded again
+)
+
+// RefundReason classifies why money was returned
+type RefundReason string
+
+const (
+	RefundReasonProviderNoShow      RefundReason = "provider_no_show"
+	RefundReasonServiceNotDelivered RefundReason = "service_not_delivered"
+	RefundReasonPoorQuality         RefundReason = "poor_quality"
+	RefundReasonDuplicatePayment    RefundReason = "duplicate_payment"
+	RefundReasonCustomerRequest     RefundReason = "customer_request"
+	RefundReasonOther               RefundReason = "other"
+)
+
+// IsValid reports whether r is a known refund reason
+func (r RefundReason) IsValid() bool {
+	switch r {
+	case RefundReasonProviderNoShow, RefundReasonServiceNotDelivered, RefundReasonPoorQuality,
+		RefundReasonDuplicatePayment, RefundReasonCustomerRequest, RefundReasonOther:
+		return true
+	}
+	return false
+}
+
+// Refund records money returned to a customer. Source identifies what was paid:
+// the card transaction ID, the mobile money reference, or the booking ID for
+// escrow and wallet refunds.
+type Refund struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Kind     RefundKind         `json:"kind" bson:"kind"`
+	Source   string             `json:"source" bson:"source"`
+	UserID   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Amount   float64            `json:"amount" bson:"amount"`
+	Currency string             `json:"currency" bson:"currency"`
+	Reason   RefundReason       `json:"reason" bson:"reason"`
+	Note     string             `json:"note,omitempty" bson:"note,omitempty"`
+	Status   RefundStatus       `json:"status" bson:"status"`
+	// Reference is the disbursement reference of a mobile money refund
+	Reference   string             `json:"reference,omitempty" bson:"reference,omitempty"`
+	Provider    string             `json:"provider,omitempty" bson:"provider,omitempty"`
+	Failure     string             `json:"failure,omitempty" bson:"failure,omitempty"`
+	RequestedBy primitive.ObjectID `json:"requested_by" bson:"requested_by"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
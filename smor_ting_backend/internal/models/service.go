@@ -6,15 +6,25 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ServiceCategory groups services for browsing. Categories nest through
+// ParentID; a category is only usable while it and all its ancestors are active.
 type ServiceCategory struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
-	Icon        string             `json:"icon" bson:"icon"`
-	Color       string             `json:"color" bson:"color"`
-	IsActive    bool               `json:"is_active" bson:"is_active"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	ID   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+	// Slug is the category's stable, unique key, e.g. "generator-repair"
+	Slug        string              `json:"slug" bson:"slug"`
+	Description string              `json:"description" bson:"description"`
+	ParentID    *primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	// Icon and Color (hex, "#2196F3") style the tile on the mobile home grid
+	Icon  string `json:"icon" bson:"icon"`
+	Color string `json:"color" bson:"color"`
+	// SortOrder places the category among its siblings, lowest first
+	SortOrder int       `json:"sort_order" bson:"sort_order"`
+	IsActive  bool      `json:"is_active" bson:"is_active"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// Children is filled in when categories are returned as a tree
+	Children []ServiceCategory `json:"children,omitempty" bson:"-"`
 }
 
 type Service struct {
@@ -31,9 +41,11 @@ type Service struct {
 	Rating      float64            `json:"rating" bson:"rating"`
 	ReviewCount int                `json:"review_count" bson:"review_count"`
 	// Embedded reviews for better performance
-	Reviews []Review `json:"reviews,omitempty" bson:"reviews,omitempty"`
-	// Location for geospatial queries
-	Location Address `json:"location" bson:"location"`
+	Reviews  []Review `json:"reviews,omitempty" bson:"reviews,omitempty"`
+	Location Address  `json:"location" bson:"location"`
+	// Geo mirrors Location's coordinates as GeoJSON for the 2dsphere index; the
+	// repository keeps it in sync on every write
+	Geo *GeoPoint `json:"geo,omitempty" bson:"geo,omitempty"`
 	// Offline-first fields
 	LastSyncAt time.Time `json:"last_sync_at" bson:"last_sync_at"`
 	Version    int       `json:"version" bson:"version"`
@@ -72,6 +84,42 @@ const (
 	BookingCancelled  BookingStatus = "cancelled"
 )
 
+// bookingTransitions lists the statuses each booking status may move to;
+// completed and cancelled are terminal
+var bookingTransitions = map[BookingStatus][]BookingStatus{
+	BookingPending:    {BookingConfirmed, BookingCancelled},
+	BookingConfirmed:  {BookingInProgress, BookingCancelled},
+	BookingInProgress: {BookingCompleted},
+}
+
+// CanTransitionTo reports whether a booking in status s may move to next
+func (s BookingStatus) CanTransitionTo(next BookingStatus) bool {
+	for _, allowed := range bookingTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsSlot reports whether a booking in status s occupies its provider's time slot
+func (s BookingStatus) HoldsSlot() bool {
+	switch s {
+	case BookingPending, BookingConfirmed, BookingInProgress:
+		return true
+	}
+	return false
+}
+
+// IsValid reports whether s is one of the known booking statuses
+func (s BookingStatus) IsValid() bool {
+	switch s {
+	case BookingPending, BookingConfirmed, BookingInProgress, BookingCompleted, BookingCancelled:
+		return true
+	}
+	return false
+}
+
 type Booking struct {
 	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	CustomerID    primitive.ObjectID `json:"customer_id" bson:"customer_id"`
@@ -85,8 +133,15 @@ type Booking struct {
 	TotalAmount   float64            `json:"total_amount" bson:"total_amount"`
 	Currency      string             `json:"currency" bson:"currency"`
 	PaymentStatus string             `json:"payment_status" bson:"payment_status"`
-	// Embedded service details for offline access
+	// SlotHeld is set while the booking occupies its provider's slot; a unique
+	// index over it stops two bookings holding the same provider and start time
+	SlotHeld bool `json:"-" bson:"slot_held,omitempty"`
+	// Embedded service details for offline access. Bookings made from a quote
+	// have no ServiceID; their snapshot describes the quoted job instead.
 	Service Service `json:"service" bson:"service"`
+	// JobRequestID and QuoteID link a booking made by accepting a quote
+	JobRequestID *primitive.ObjectID `json:"job_request_id,omitempty" bson:"job_request_id,omitempty"`
+	QuoteID      *primitive.ObjectID `json:"quote_id,omitempty" bson:"quote_id,omitempty"`
 	// Payment information
 	Payment Payment `json:"payment" bson:"payment"`
 	// Tracking information
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookingStatus_CanTransitionTo(t *testing.T) {
+	cases := []struct {
+		from, to BookingStatus
+		ok       bool
+	}{
+		{BookingPending, BookingConfirmed, true},
+		{BookingPending, BookingInProgress, false},
+		{BookingPending, BookingCompleted, false},
+		{BookingConfirmed, BookingCancelled, true},
+		{BookingInProgress, BookingCompleted, true},
+		{BookingInProgress, BookingCancelled, false},
+		{BookingCompleted, BookingCancelled, false},
+		{BookingCancelled, BookingPending, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.ok, c.from.CanTransitionTo(c.to), "%s -> %s", c.from, c.to)
+	}
+}
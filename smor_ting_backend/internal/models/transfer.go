@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LedgerTransfer moves funds between two users' wallets
+const LedgerTransfer LedgerType = "transfer"
+
+// TransferStatus is where a wallet-to-wallet transfer stands
+type TransferStatus string
+
+const (
+	// TransferPendingVerification transfers wait for the code sent to the sender
+	TransferPendingVerification TransferStatus = "pending_verification"
+	TransferCompleted           TransferStatus = "completed"
+	// TransferCancelled transfers expired or ran out of verification attempts; nothing moved
+	TransferCancelled TransferStatus = "cancelled"
+)
+
+// TransferVerification is how the sender authorised a transfer
+type TransferVerification string
+
+const (
+	TransferVerifiedNone TransferVerification = "none" // at or below the step-up threshold
+	TransferVerifiedPIN  TransferVerification = "pin"
+	TransferVerifiedOTP  TransferVerification = "otp"
+)
+
+// WalletTransfer is a payment from one user's wallet to another's. Both parties
+// see it; the names are kept as they were when it was sent.
+type WalletTransfer struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	SenderID      primitive.ObjectID   `json:"sender_id" bson:"sender_id"`
+	SenderName    string               `json:"sender_name" bson:"sender_name"`
+	RecipientID   primitive.ObjectID   `json:"recipient_id" bson:"recipient_id"`
+	RecipientName string               `json:"recipient_name" bson:"recipient_name"`
+	Amount        float64              `json:"amount" bson:"amount"`
+	Currency      string               `json:"currency" bson:"currency"`
+	Note          string               `json:"note,omitempty" bson:"note,omitempty"`
+	Status        TransferStatus       `json:"status" bson:"status"`
+	Verification  TransferVerification `json:"verification" bson:"verification"`
+	// Reference is the ledger transaction's reference, shown in both parties' histories
+	Reference    string     `json:"reference" bson:"reference"`
+	OTPHash      string     `json:"-" bson:"otp_hash,omitempty"`
+	OTPExpiresAt *time.Time `json:"-" bson:"otp_expires_at,omitempty"`
+	OTPAttempts  int        `json:"-" bson:"otp_attempts,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" bson:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
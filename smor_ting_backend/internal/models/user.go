@@ -29,6 +29,10 @@ type User struct {
 	Bookings []Booking `json:"bookings,omitempty" bson:"bookings,omitempty"`
 	Services []Service `json:"services,omitempty" bson:"services,omitempty"`
 	Wallet   Wallet    `json:"wallet,omitempty" bson:"wallet,omitempty"`
+	// WalletPIN is the bcrypt hash of the PIN that authorises large wallet transfers
+	WalletPIN            string     `json:"-" bson:"wallet_pin,omitempty"`
+	WalletPINAttempts    int        `json:"-" bson:"wallet_pin_attempts,omitempty"`
+	WalletPINLockedUntil *time.Time `json:"-" bson:"wallet_pin_locked_until,omitempty"`
 	// Offline-first fields
 	LastSyncAt time.Time `json:"last_sync_at" bson:"last_sync_at"`
 	IsOffline  bool      `json:"is_offline" bson:"is_offline"`
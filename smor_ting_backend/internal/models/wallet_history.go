@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WalletHistoryItem is one row of a wallet's transaction history: a settled ledger
+// transaction, or a mobile money operation that is still pending or has failed.
+// A conversion between currencies is listed once per currency.
+type WalletHistoryItem struct {
+	ID          primitive.ObjectID `json:"id"`
+	Type        LedgerType         `json:"type"`
+	Direction   LedgerDirection    `json:"direction"`
+	Amount      float64            `json:"amount"`
+	Currency    string             `json:"currency"`
+	Status      LedgerStatus       `json:"status"`
+	Reference   string             `json:"reference,omitempty"`
+	Description string             `json:"description,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// WalletHistoryPage is one page of history; NextCursor is empty on the last page
+type WalletHistoryPage struct {
+	Items      []WalletHistoryItem `json:"items"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// WalletStatementLine is one movement of the available balance on a statement
+type WalletStatementLine struct {
+	Date        time.Time  `json:"date"`
+	Type        LedgerType `json:"type"`
+	Reference   string     `json:"reference"`
+	Description string     `json:"description"`
+	Credit      float64    `json:"credit"`
+	Debit       float64    `json:"debit"`
+	Balance     float64    `json:"balance"`
+}
+
+// WalletStatement lists the movements of a wallet's available balance in one
+// currency over [From, To), between the balances at either end
+type WalletStatement struct {
+	UserID         primitive.ObjectID    `json:"user_id"`
+	AccountName    string                `json:"account_name"`
+	Currency       string                `json:"currency"`
+	From           time.Time             `json:"from"`
+	To             time.Time             `json:"to"`
+	OpeningBalance float64               `json:"opening_balance"`
+	TotalCredits   float64               `json:"total_credits"`
+	TotalDebits    float64               `json:"total_debits"`
+	ClosingBalance float64               `json:"closing_balance"`
+	Lines          []WalletStatementLine `json:"lines"`
+	GeneratedAt    time.Time             `json:"generated_at"`
+}
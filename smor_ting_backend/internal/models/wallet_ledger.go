@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,7 +17,12 @@ const (
 	LedgerPayment       LedgerType = "payment"
 	LedgerEscrowHold    LedgerType = "escrow_hold"
 	LedgerEscrowRelease LedgerType = "escrow_release"
+	LedgerEscrowRefund  LedgerType = "escrow_refund"
 	LedgerWithdraw      LedgerType = "withdraw"
+	// LedgerRefund pays a collection back out to the payer's mobile wallet
+	LedgerRefund LedgerType = "refund"
+	// LedgerPayout pays a provider's earnings out to their mobile wallet in a payout batch
+	LedgerPayout LedgerType = "payout"
 )
 
 const (
@@ -27,6 +34,8 @@ const (
 	LedgerPending   LedgerStatus = "pending"
 	LedgerCompleted LedgerStatus = "completed"
 	LedgerFailed    LedgerStatus = "failed"
+	// LedgerHeld is a confirmed escrow hold: collected, and held until released or refunded
+	LedgerHeld LedgerStatus = "held"
 )
 
 type WalletLedgerEntry struct {
@@ -40,13 +49,169 @@ type WalletLedgerEntry struct {
 	IsEscrow    bool               `bson:"is_escrow" json:"is_escrow"`
 	Reference   string             `bson:"reference" json:"reference"`
 	ProviderRef string             `bson:"provider_ref" json:"provider_ref"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	// Provider is the mobile-money provider an intent was sent to; empty means MTN MoMo
+	Provider string `bson:"provider,omitempty" json:"provider,omitempty"`
+	// BookingID links an escrow hold intent to the booking it pays for
+	BookingID *primitive.ObjectID `bson:"booking_id,omitempty" json:"booking_id,omitempty"`
+	// ReconcileAttempts counts the reconciler's polls that left the intent pending
+	ReconcileAttempts int `bson:"reconcile_attempts,omitempty" json:"reconcile_attempts,omitempty"`
+	// NextReconcileAt is when the reconciler may poll the intent again
+	NextReconcileAt *time.Time `bson:"next_reconcile_at,omitempty" json:"next_reconcile_at,omitempty"`
+	// NeedsReview is set when the reconciler gives up on the intent; it stays
+	// pending until a late callback or an admin settles it
+	NeedsReview bool      `bson:"needs_review,omitempty" json:"needs_review,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// WalletBalances reports every currency the user holds in Currencies. The
+// top-level figures are their sum, kept for clients of single-currency
+// wallets; Currency is the wallet's primary currency.
 type WalletBalances struct {
+	Available   float64                    `json:"available"`
+	PendingHeld float64                    `json:"pending"`
+	Total       float64                    `json:"total"`
+	Currency    string                     `json:"currency"`
+	Currencies  map[string]CurrencyBalance `json:"currencies"`
+}
+
+// CurrencyBalance is a wallet's sub-balance in one currency
+type CurrencyBalance struct {
 	Available   float64 `json:"available"`
 	PendingHeld float64 `json:"pending"`
 	Total       float64 `json:"total"`
-	Currency    string  `json:"currency"`
 }
+
+// LedgerOpeningBalance carries a legacy embedded wallet balance into the double-entry ledger
+const LedgerOpeningBalance LedgerType = "opening_balance"
+
+// LedgerAccountKind identifies one of the double-entry ledger's account classes
+type LedgerAccountKind string
+
+const (
+	AccountUserAvailable LedgerAccountKind = "user_available" // spendable funds owed to a user
+	AccountUserEscrow    LedgerAccountKind = "user_escrow"    // funds a user has paid into escrow for bookings
+	AccountPlatformFees  LedgerAccountKind = "platform_fees"  // commission and fees earned by the platform
+	AccountMomoClearing  LedgerAccountKind = "momo_clearing"  // money held at the mobile money operator
+	AccountFXConversion  LedgerAccountKind = "fx_conversion"  // the platform's position from currency conversions
+)
+
+// LedgerAccount addresses a ledger account; user accounts carry the owning user's ID
+type LedgerAccount struct {
+	Kind   LedgerAccountKind
+	UserID primitive.ObjectID
+}
+
+func UserAvailableAccount(userID primitive.ObjectID) LedgerAccount {
+	return LedgerAccount{Kind: AccountUserAvailable, UserID: userID}
+}
+
+func UserEscrowAccount(userID primitive.ObjectID) LedgerAccount {
+	return LedgerAccount{Kind: AccountUserEscrow, UserID: userID}
+}
+
+var (
+	PlatformFeesAccount = LedgerAccount{Kind: AccountPlatformFees}
+	MomoClearingAccount = LedgerAccount{Kind: AccountMomoClearing}
+	FXConversionAccount = LedgerAccount{Kind: AccountFXConversion}
+)
+
+// Key is the stable identifier stored on postings, e.g. "user_available:<hex>" or "momo_clearing"
+func (a LedgerAccount) Key() string {
+	if a.UserID.IsZero() {
+		return string(a.Kind)
+	}
+	return string(a.Kind) + ":" + a.UserID.Hex()
+}
+
+// LedgerPosting is one leg of a ledger transaction
+type LedgerPosting struct {
+	Account   string             `bson:"account" json:"account"`
+	Kind      LedgerAccountKind  `bson:"kind" json:"kind"`
+	UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Direction LedgerDirection    `bson:"direction" json:"direction"`
+	Amount    float64            `bson:"amount" json:"amount"`
+	Currency  string             `bson:"currency" json:"currency"`
+	// Memo tells apart several legs on the same account, e.g. the fee lines of a release
+	Memo string `bson:"memo,omitempty" json:"memo,omitempty"`
+}
+
+// Memos on the platform fee legs of an escrow release
+const (
+	LedgerMemoCommission = "commission"
+	LedgerMemoMomoFee    = "momo_fee"
+)
+
+// LedgerTransaction is an immutable, balanced set of postings. Once appended it is
+// never updated or deleted; corrections are made with new transactions.
+type LedgerTransaction struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	IdempotencyKey string             `bson:"idempotency_key,omitempty" json:"idempotency_key,omitempty"`
+	Type           LedgerType         `bson:"type" json:"type"`
+	Reference      string             `bson:"reference" json:"reference"`
+	ProviderRef    string             `bson:"provider_ref,omitempty" json:"provider_ref,omitempty"`
+	Description    string             `bson:"description,omitempty" json:"description,omitempty"`
+	Postings       []LedgerPosting    `bson:"postings" json:"postings"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Debit adds a debit leg against account
+func (t *LedgerTransaction) Debit(account LedgerAccount, amount float64, currency string) *LedgerTransaction {
+	return t.post(account, LedgerDebit, amount, currency)
+}
+
+// Credit adds a credit leg against account
+func (t *LedgerTransaction) Credit(account LedgerAccount, amount float64, currency string) *LedgerTransaction {
+	return t.post(account, LedgerCredit, amount, currency)
+}
+
+// Memo labels the most recently added leg
+func (t *LedgerTransaction) Memo(memo string) *LedgerTransaction {
+	if n := len(t.Postings); n > 0 {
+		t.Postings[n-1].Memo = memo
+	}
+	return t
+}
+
+func (t *LedgerTransaction) post(account LedgerAccount, dir LedgerDirection, amount float64, currency string) *LedgerTransaction {
+	t.Postings = append(t.Postings, LedgerPosting{
+		Account:   account.Key(),
+		Kind:      account.Kind,
+		UserID:    account.UserID,
+		Direction: dir,
+		Amount:    amount,
+		Currency:  currency,
+	})
+	return t
+}
+
+// Validate checks that the transaction has at least two positive legs and that
+// debits equal credits in every currency (compared in minor units)
+func (t *LedgerTransaction) Validate() error {
+	if len(t.Postings) < 2 {
+		return ErrLedgerUnbalanced
+	}
+	net := make(map[string]int64)
+	for _, p := range t.Postings {
+		if p.Amount <= 0 || p.Account == "" {
+			return ErrLedgerInvalidPosting
+		}
+		minor := int64(math.Round(p.Amount * 100))
+		if p.Direction == LedgerDebit {
+			net[p.Currency] += minor
+		} else {
+			net[p.Currency] -= minor
+		}
+	}
+	for _, v := range net {
+		if v != 0 {
+			return ErrLedgerUnbalanced
+		}
+	}
+	return nil
+}
+
+var (
+	ErrLedgerUnbalanced     = errors.New("ledger transaction debits and credits do not balance")
+	ErrLedgerInvalidPosting = errors.New("ledger posting must have an account and a positive amount")
+)
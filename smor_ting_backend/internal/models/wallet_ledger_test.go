@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLedgerTransaction_Validate(t *testing.T) {
+	user := primitive.NewObjectID()
+
+	balanced := (&LedgerTransaction{Type: LedgerTopup}).
+		Debit(MomoClearingAccount, 10.10, "USD").
+		Credit(UserAvailableAccount(user), 10.10, "USD")
+	assert.NoError(t, balanced.Validate())
+
+	unbalanced := (&LedgerTransaction{Type: LedgerTopup}).
+		Debit(MomoClearingAccount, 10, "USD").
+		Credit(UserAvailableAccount(user), 9.99, "USD")
+	assert.ErrorIs(t, unbalanced.Validate(), ErrLedgerUnbalanced)
+
+	// Legs in different currencies must balance on their own
+	mixed := (&LedgerTransaction{Type: LedgerTopup}).
+		Debit(MomoClearingAccount, 10, "USD").
+		Credit(UserAvailableAccount(user), 10, "LRD")
+	assert.ErrorIs(t, mixed.Validate(), ErrLedgerUnbalanced)
+
+	oneLeg := (&LedgerTransaction{Type: LedgerTopup}).Credit(UserAvailableAccount(user), 10, "USD")
+	assert.ErrorIs(t, oneLeg.Validate(), ErrLedgerUnbalanced)
+
+	negative := (&LedgerTransaction{Type: LedgerTopup}).
+		Debit(MomoClearingAccount, -5, "USD").
+		Credit(UserAvailableAccount(user), -5, "USD")
+	assert.ErrorIs(t, negative.Validate(), ErrLedgerInvalidPosting)
+}
+
+func TestLedgerAccount_Key(t *testing.T) {
+	user := primitive.NewObjectID()
+	assert.Equal(t, "user_available:"+user.Hex(), UserAvailableAccount(user).Key())
+	assert.Equal(t, "platform_fees", PlatformFeesAccount.Key())
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookEventState string
+
+const (
+	WebhookPending   WebhookEventState = "pending"   // accepted and being applied
+	WebhookProcessed WebhookEventState = "processed" // applied to the ledger/escrow; repeats are ignored
+	WebhookFailed    WebhookEventState = "failed"    // applying failed; a provider retry or an admin replay picks it up
+)
+
+// WebhookEvent is an inbox record of a verified provider callback. DedupKey is
+// unique so the same reference/status pair is only ever applied once.
+type WebhookEvent struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Provider    string             `json:"provider" bson:"provider"`
+	DedupKey    string             `json:"dedup_key" bson:"dedup_key"`
+	ReferenceID string             `json:"reference_id" bson:"reference_id"`
+	Type        string             `json:"type" bson:"type"`
+	Status      string             `json:"status" bson:"status"`
+	Payload     string             `json:"payload" bson:"payload"`
+	State       WebhookEventState  `json:"state" bson:"state"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	LastError   string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	ReceivedAt  time.Time          `json:"received_at" bson:"received_at"`
+	ProcessedAt *time.Time         `json:"processed_at,omitempty" bson:"processed_at,omitempty"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
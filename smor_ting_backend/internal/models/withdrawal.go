@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WithdrawalStatus string
+
+const (
+	WithdrawalPendingReview WithdrawalStatus = "pending_review" // flagged; held for an admin before any money moves
+	WithdrawalSubmitted     WithdrawalStatus = "submitted"      // disbursement requested; settles with its ledger intent
+	WithdrawalRejected      WithdrawalStatus = "rejected"       // an admin declined it; nothing was paid
+	WithdrawalFailed        WithdrawalStatus = "failed"         // the provider refused the disbursement
+)
+
+// WithdrawalFlag names a velocity rule that sent a withdrawal to review
+type WithdrawalFlag string
+
+const (
+	WithdrawalFlagHourlyVelocity  WithdrawalFlag = "hourly_velocity"   // too many withdrawals in the last hour
+	WithdrawalFlagNewPayoutNumber WithdrawalFlag = "new_payout_number" // paid to a number the user has not used long enough
+	WithdrawalFlagLimitUnverified WithdrawalFlag = "limit_unverified"  // no exchange rate to check the limits with
+)
+
+// Withdrawal records a request to pay wallet funds out to a mobile money number.
+// The full number is only stored encrypted, so a reviewed withdrawal can still be paid.
+type Withdrawal struct {
+	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID          primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	Role            UserRole            `json:"role" bson:"role"`
+	Amount          float64             `json:"amount" bson:"amount"`
+	Currency        string              `json:"currency" bson:"currency"`
+	Provider        string              `json:"provider" bson:"provider"`
+	Msisdn          string              `json:"msisdn" bson:"msisdn"` // masked
+	MsisdnEncrypted string              `json:"-" bson:"msisdn_encrypted"`
+	Status          WithdrawalStatus    `json:"status" bson:"status"`
+	Flags           []WithdrawalFlag    `json:"flags,omitempty" bson:"flags,omitempty"`
+	Reference       string              `json:"reference,omitempty" bson:"reference,omitempty"` // disbursement reference once submitted
+	Failure         string              `json:"failure,omitempty" bson:"failure,omitempty"`
+	ReviewedBy      *primitive.ObjectID `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	ReviewNote      string              `json:"review_note,omitempty" bson:"review_note,omitempty"`
+	ReviewedAt      *time.Time          `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at" bson:"updated_at"`
+}
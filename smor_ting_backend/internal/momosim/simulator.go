@@ -0,0 +1,444 @@
+// Package momosim is an in-process stand-in for the MTN MoMo Collection and
+// Disbursement APIs. It serves the token, requesttopay, transfer and status
+// endpoints that services.MomoClient calls, decides each transaction's outcome
+// from the payer/payee MSISDN, and posts callbacks the way MoMo does.
+package momosim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/services"
+)
+
+// Outcome is the final state the simulator gives a transaction
+type Outcome string
+
+const (
+	// Successful completes the transaction and sends a SUCCESSFUL callback
+	Successful Outcome = "SUCCESSFUL"
+	// Failed rejects the transaction and sends a FAILED callback
+	Failed Outcome = "FAILED"
+	// Pending leaves the transaction PENDING with no callback until Complete is called
+	Pending Outcome = "PENDING"
+	// Timeout accepts the transaction but never answers the request, so the
+	// client gives up; MoMo still holds it as PENDING until Complete is called
+	Timeout Outcome = "TIMEOUT"
+)
+
+// Config configures a Simulator. Empty credentials accept any caller.
+type Config struct {
+	APIUser                     string
+	APIKey                      string
+	SubscriptionKeyCollection   string
+	SubscriptionKeyDisbursement string
+	TargetEnvironment           string
+	// CallbackURL receives a services.PaymentCallback for every final status; empty disables callbacks
+	CallbackURL string
+	// WebhookSecret signs callbacks in the handlers.MomoSignatureHeader header when set
+	WebhookSecret string
+	// TokenTTL is the expires_in of issued access tokens (default one hour)
+	TokenTTL time.Duration
+	// DefaultOutcome applies to MSISDNs without an outcome of their own (default Successful)
+	DefaultOutcome Outcome
+}
+
+// Transaction is a request-to-pay or transfer as the simulator recorded it
+type Transaction struct {
+	ReferenceID            string
+	Product                string // "collection" or "disbursement"
+	Amount                 string
+	Currency               string
+	ExternalID             string
+	MSISDN                 string
+	Status                 Outcome
+	FinancialTransactionID string
+}
+
+type issuedToken struct {
+	product   string
+	expiresAt time.Time
+}
+
+// Simulator is a running fake MoMo server
+type Simulator struct {
+	cfg    Config
+	server *httptest.Server
+	signer *services.HMACCallbackVerifier
+	client *http.Client
+
+	mu           sync.Mutex
+	outcomes     map[string]Outcome
+	transactions map[string]*Transaction
+	tokens       map[string]issuedToken
+	tokensIssued int
+	callbackErrs []error
+	callbacks    sync.WaitGroup
+	closing      chan struct{}
+}
+
+// New starts a simulator on a local port
+func New(cfg Config) *Simulator {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = time.Hour
+	}
+	if cfg.DefaultOutcome == "" {
+		cfg.DefaultOutcome = Successful
+	}
+	s := &Simulator{
+		cfg:          cfg,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		outcomes:     map[string]Outcome{},
+		transactions: map[string]*Transaction{},
+		tokens:       map[string]issuedToken{},
+		closing:      make(chan struct{}),
+	}
+	if cfg.WebhookSecret != "" {
+		s.signer = services.NewHMACCallbackVerifier(cfg.WebhookSecret)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.ping)
+	for _, product := range []string{"collection", "disbursement"} {
+		mux.HandleFunc("/"+product+"/token/", s.token(product))
+	}
+	mux.HandleFunc("/collection/v1_0/requesttopay", s.create("collection"))
+	mux.HandleFunc("/collection/v1_0/requesttopay/", s.status("collection", "/collection/v1_0/requesttopay/"))
+	mux.HandleFunc("/disbursement/v1_0/transfer", s.create("disbursement"))
+	mux.HandleFunc("/disbursement/v1_0/transfer/", s.status("disbursement", "/disbursement/v1_0/transfer/"))
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+// URL is the base URL to hand to services.NewMomoClient
+func (s *Simulator) URL() string { return s.server.URL }
+
+// Client returns a MomoClient pointed at the simulator with its credentials
+func (s *Simulator) Client() *services.MomoClient {
+	env := s.cfg.TargetEnvironment
+	if env == "" {
+		env = "sandbox"
+	}
+	return services.NewMomoClient(s.URL(), env, s.cfg.APIUser, s.cfg.APIKey, s.cfg.SubscriptionKeyCollection, s.cfg.SubscriptionKeyDisbursement)
+}
+
+// Close releases requests held by Timeout, waits for callbacks and stops the server
+func (s *Simulator) Close() {
+	close(s.closing)
+	s.callbacks.Wait()
+	s.server.Close()
+}
+
+// SetOutcome decides the outcome of every later transaction for msisdn
+func (s *Simulator) SetOutcome(msisdn string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[msisdn] = outcome
+}
+
+// Complete moves a PENDING transaction to a final status and sends its callback
+func (s *Simulator) Complete(referenceID string, status Outcome) error {
+	if status != Successful && status != Failed {
+		return fmt.Errorf("momosim: %s is not a final status", status)
+	}
+	s.mu.Lock()
+	tx, ok := s.transactions[referenceID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("momosim: unknown reference %s", referenceID)
+	}
+	if tx.Status != Pending {
+		s.mu.Unlock()
+		return fmt.Errorf("momosim: %s is already %s", referenceID, tx.Status)
+	}
+	tx.Status = status
+	snapshot := *tx
+	s.mu.Unlock()
+	s.notify(snapshot)
+	return nil
+}
+
+// Transaction returns the recorded transaction for a reference
+func (s *Simulator) Transaction(referenceID string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.transactions[referenceID]
+	if !ok {
+		return Transaction{}, false
+	}
+	return *tx, true
+}
+
+// RevokeTokens invalidates every issued access token, as MoMo does on key rotation
+func (s *Simulator) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]issuedToken{}
+}
+
+// TokensIssued counts access tokens handed out so far
+func (s *Simulator) TokensIssued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokensIssued
+}
+
+// WaitCallbacks blocks until every callback sent so far has been delivered and
+// returns the delivery errors (non-2xx answers included)
+func (s *Simulator) WaitCallbacks() []error {
+	s.callbacks.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.callbackErrs...)
+}
+
+func (s *Simulator) ping(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Simulator) subscriptionKey(product string) string {
+	if product == "collection" {
+		return s.cfg.SubscriptionKeyCollection
+	}
+	return s.cfg.SubscriptionKeyDisbursement
+}
+
+func (s *Simulator) token(product string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if key := s.subscriptionKey(product); key != "" && r.Header.Get("Ocp-Apim-Subscription-Key") != key {
+			writeError(w, http.StatusUnauthorized, "invalid subscription key")
+			return
+		}
+		if s.cfg.APIUser != "" || s.cfg.APIKey != "" {
+			want := "Basic " + base64.StdEncoding.EncodeToString([]byte(s.cfg.APIUser+":"+s.cfg.APIKey))
+			if r.Header.Get("Authorization") != want {
+				writeError(w, http.StatusUnauthorized, "invalid api user or key")
+				return
+			}
+		}
+		access := randomHex(16)
+		s.mu.Lock()
+		s.tokens[access] = issuedToken{product: product, expiresAt: time.Now().Add(s.cfg.TokenTTL)}
+		s.tokensIssued++
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": access,
+			"token_type":   "Bearer",
+			"expires_in":   int(s.cfg.TokenTTL / time.Second),
+		})
+	}
+}
+
+// authorized checks the bearer token, subscription key and target environment
+func (s *Simulator) authorized(w http.ResponseWriter, r *http.Request, product string) bool {
+	access := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	tok, ok := s.tokens[access]
+	s.mu.Unlock()
+	if !ok || tok.product != product || time.Now().After(tok.expiresAt) {
+		writeError(w, http.StatusUnauthorized, "access token is missing, invalid or expired")
+		return false
+	}
+	if key := s.subscriptionKey(product); key != "" && r.Header.Get("Ocp-Apim-Subscription-Key") != key {
+		writeError(w, http.StatusUnauthorized, "invalid subscription key")
+		return false
+	}
+	if r.Header.Get("X-Target-Environment") == "" {
+		writeError(w, http.StatusBadRequest, "missing X-Target-Environment")
+		return false
+	}
+	return true
+}
+
+// create handles requesttopay (outcome keyed by payer) and transfer (keyed by payee)
+func (s *Simulator) create(product string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(w, r, product) {
+			return
+		}
+		ref := r.Header.Get("X-Reference-Id")
+		if ref == "" {
+			writeError(w, http.StatusBadRequest, "missing X-Reference-Id")
+			return
+		}
+		var req struct {
+			Amount     string         `json:"amount"`
+			Currency   string         `json:"currency"`
+			ExternalID string         `json:"externalId"`
+			Payer      services.Party `json:"payer"`
+			Payee      services.Party `json:"payee"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+		owner := req.Payer
+		if product == "disbursement" {
+			owner = req.Payee
+		}
+		if _, err := strconv.ParseFloat(req.Amount, 64); err != nil || owner.PartyId == "" {
+			writeError(w, http.StatusBadRequest, "amount and party MSISDN are required")
+			return
+		}
+
+		s.mu.Lock()
+		if _, exists := s.transactions[ref]; exists {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, "duplicated reference id")
+			return
+		}
+		outcome, ok := s.outcomes[owner.PartyId]
+		if !ok {
+			outcome = s.cfg.DefaultOutcome
+		}
+		tx := &Transaction{
+			ReferenceID: ref,
+			Product:     product,
+			Amount:      req.Amount,
+			Currency:    req.Currency,
+			ExternalID:  req.ExternalID,
+			MSISDN:      owner.PartyId,
+			Status:      outcome,
+		}
+		if outcome == Timeout {
+			tx.Status = Pending
+		}
+		if tx.Status != Pending {
+			tx.FinancialTransactionID = randomHex(8)
+		}
+		s.transactions[ref] = tx
+		snapshot := *tx
+		s.mu.Unlock()
+
+		if outcome == Timeout {
+			// Hold the response until the caller gives up
+			select {
+			case <-r.Context().Done():
+			case <-s.closing:
+			}
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if snapshot.Status != Pending {
+			s.notify(snapshot)
+		}
+	}
+}
+
+// status serves GET <prefix>{referenceId} and the MTN <prefix>status/{referenceId} form
+func (s *Simulator) status(product, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorized(w, r, product) {
+			return
+		}
+		ref := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "status/")
+		s.mu.Lock()
+		tx, ok := s.transactions[ref]
+		var snapshot Transaction
+		if ok {
+			snapshot = *tx
+		}
+		s.mu.Unlock()
+		if !ok || snapshot.Product != product {
+			writeError(w, http.StatusNotFound, "requested resource was not found")
+			return
+		}
+		out := map[string]any{
+			"amount":     snapshot.Amount,
+			"currency":   snapshot.Currency,
+			"externalId": snapshot.ExternalID,
+			"status":     string(snapshot.Status),
+		}
+		if snapshot.FinancialTransactionID != "" {
+			out["financialTransactionId"] = snapshot.FinancialTransactionID
+		}
+		if snapshot.Status == Failed {
+			out["reason"] = "APPROVAL_REJECTED"
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// notify posts the final status of tx to the callback URL in the background
+func (s *Simulator) notify(tx Transaction) {
+	if s.cfg.CallbackURL == "" {
+		return
+	}
+	cbType := "topup"
+	if tx.Product == "disbursement" {
+		cbType = "withdraw"
+	}
+	amount, _ := strconv.ParseFloat(tx.Amount, 64)
+	// The receiver resolves the user and the real type from its payment intent
+	body, _ := json.Marshal(services.PaymentCallback{
+		Type:        cbType,
+		Status:      string(tx.Status),
+		Amount:      amount,
+		Currency:    tx.Currency,
+		ReferenceID: tx.ReferenceID,
+		ProviderRef: tx.FinancialTransactionID,
+	})
+	s.callbacks.Add(1)
+	go func() {
+		defer s.callbacks.Done()
+		req, _ := http.NewRequest(http.MethodPost, s.cfg.CallbackURL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if s.signer != nil {
+			req.Header.Set(handlers.MomoSignatureHeader, s.signer.Sign(body))
+		}
+		resp, err := s.client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("momosim: callback for %s answered %d", tx.ReferenceID, resp.StatusCode)
+			}
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.callbackErrs = append(s.callbackErrs, err)
+			s.mu.Unlock()
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"code": http.StatusText(status), "message": message})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,150 @@
+package momosim_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/handlers"
+	"github.com/smorting/backend/internal/momosim"
+	"github.com/smorting/backend/internal/services"
+)
+
+func r2p(msisdn string) services.RequestToPay {
+	return services.RequestToPay{Amount: "50", Currency: "LRD", ExternalId: "ext", Payer: services.Party{PartyIdType: "MSISDN", PartyId: msisdn}}
+}
+
+func TestSimulator_OutcomesByMSISDN(t *testing.T) {
+	sim := momosim.New(momosim.Config{APIUser: "user", APIKey: "key", SubscriptionKeyCollection: "col", SubscriptionKeyDisbursement: "disb"})
+	defer sim.Close()
+	sim.SetOutcome("231770000002", momosim.Failed)
+	sim.SetOutcome("231770000003", momosim.Pending)
+	c := sim.Client()
+	ctx := context.Background()
+
+	if err := c.EnsureOnline(ctx); err != nil {
+		t.Fatalf("online: %v", err)
+	}
+	for msisdn, want := range map[string]string{"231770000001": "SUCCESSFUL", "231770000002": "FAILED", "231770000003": "PENDING"} {
+		ref, err := c.RequestToPay(ctx, r2p(msisdn))
+		if err != nil {
+			t.Fatalf("r2p %s: %v", msisdn, err)
+		}
+		if status, err := c.GetRequestToPayStatus(ctx, ref); err != nil || status != want {
+			t.Fatalf("%s: expected %s, got %q, %v", msisdn, want, status, err)
+		}
+	}
+
+	ref, err := c.Transfer(ctx, services.TransferRequest{Amount: "20", Currency: "LRD", Payee: services.Party{PartyIdType: "MSISDN", PartyId: "231770000002"}})
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if status, err := c.GetTransferStatus(ctx, ref); err != nil || status != "FAILED" {
+		t.Fatalf("transfer: expected FAILED, got %q, %v", status, err)
+	}
+	// References are scoped to their product
+	if _, err := c.GetRequestToPayStatus(ctx, ref); err == nil {
+		t.Fatal("a transfer reference must not resolve as a request-to-pay")
+	}
+	if n := sim.TokensIssued(); n != 2 {
+		t.Fatalf("expected one token per product, got %d", n)
+	}
+}
+
+func TestSimulator_RejectsBadCredentialsAndDuplicateReferences(t *testing.T) {
+	sim := momosim.New(momosim.Config{APIUser: "user", APIKey: "key"})
+	defer sim.Close()
+	ctx := context.Background()
+
+	bad := services.NewMomoClient(sim.URL(), "sandbox", "user", "wrong", "", "")
+	if _, err := bad.RequestToPay(ctx, r2p("231770000001")); err == nil {
+		t.Fatal("expected the token request to fail with a wrong API key")
+	}
+
+	c := sim.Client()
+	body := r2p("231770000001")
+	body.ReferenceID = services.NewMomoReferenceID()
+	if _, err := c.RequestToPay(ctx, body); err != nil {
+		t.Fatalf("r2p: %v", err)
+	}
+	if _, err := c.RequestToPay(ctx, body); err == nil {
+		t.Fatal("a reused X-Reference-Id must be refused")
+	}
+}
+
+func TestSimulator_TimeoutThenLateCompletion(t *testing.T) {
+	sim := momosim.New(momosim.Config{})
+	defer sim.Close()
+	sim.SetOutcome("231770000009", momosim.Timeout)
+	c := sim.Client()
+
+	body := r2p("231770000009")
+	body.ReferenceID = services.NewMomoReferenceID()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := c.RequestToPay(ctx, body); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to time out, got %v", err)
+	}
+
+	// MoMo took the request anyway; it stays pending until it completes
+	status, err := c.GetRequestToPayStatus(context.Background(), body.ReferenceID)
+	if err != nil || status != "PENDING" {
+		t.Fatalf("expected PENDING, got %q, %v", status, err)
+	}
+	if err := sim.Complete(body.ReferenceID, momosim.Successful); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if status, _ := c.GetRequestToPayStatus(context.Background(), body.ReferenceID); status != "SUCCESSFUL" {
+		t.Fatalf("expected SUCCESSFUL after completion, got %q", status)
+	}
+}
+
+func TestSimulator_SignedCallbacks(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []services.PaymentCallback
+	)
+	verifier := services.NewHMACCallbackVerifier("cb-secret")
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.Verify(r.Context(), body, r.Header.Get(handlers.MomoSignatureHeader), nil); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var cb services.PaymentCallback
+		_ = json.Unmarshal(body, &cb)
+		mu.Lock()
+		received = append(received, cb)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	sim := momosim.New(momosim.Config{CallbackURL: receiver.URL, WebhookSecret: "cb-secret"})
+	defer sim.Close()
+	sim.SetOutcome("231770000003", momosim.Pending)
+	c := sim.Client()
+	ctx := context.Background()
+
+	okRef, _ := c.RequestToPay(ctx, r2p("231770000001"))
+	pendingRef, _ := c.RequestToPay(ctx, r2p("231770000003"))
+	if errs := sim.WaitCallbacks(); len(errs) != 0 {
+		t.Fatalf("callback delivery: %v", errs)
+	}
+	if len(received) != 1 || received[0].ReferenceID != okRef || received[0].Status != "SUCCESSFUL" || received[0].Type != "topup" {
+		t.Fatalf("expected one SUCCESSFUL callback for %s, got %+v", okRef, received)
+	}
+
+	if err := sim.Complete(pendingRef, momosim.Failed); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	sim.WaitCallbacks()
+	if len(received) != 2 || received[1].ReferenceID != pendingRef || received[1].Status != "FAILED" {
+		t.Fatalf("expected a FAILED callback for %s, got %+v", pendingRef, received)
+	}
+}
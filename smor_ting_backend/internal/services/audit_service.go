@@ -32,12 +32,31 @@ const (
 	ActionServiceCreate       AuditAction = "SERVICE_CREATE"
 	ActionServiceUpdate       AuditAction = "SERVICE_UPDATE"
 	ActionServiceDelete       AuditAction = "SERVICE_DELETE"
+	ActionCategoryCreate      AuditAction = "CATEGORY_CREATE"
+	ActionCategoryUpdate      AuditAction = "CATEGORY_UPDATE"
+	ActionCategoryDelete      AuditAction = "CATEGORY_DELETE"
+	ActionBookingCreate       AuditAction = "BOOKING_CREATE"
+	ActionBookingStatusChange AuditAction = "BOOKING_STATUS_CHANGE"
+	ActionJobRequestCreate    AuditAction = "JOB_REQUEST_CREATE"
+	ActionQuoteSubmit         AuditAction = "QUOTE_SUBMIT"
+	ActionQuoteAccept         AuditAction = "QUOTE_ACCEPT"
 	ActionPaymentProcess      AuditAction = "PAYMENT_PROCESS"
 	ActionPaymentRefund       AuditAction = "PAYMENT_REFUND"
 	ActionWalletCreate        AuditAction = "WALLET_CREATE"
 	ActionWalletLink          AuditAction = "WALLET_LINK"
 	ActionWalletUnlink        AuditAction = "WALLET_UNLINK"
 	ActionWalletDelete        AuditAction = "WALLET_DELETE"
+	ActionWalletWithdraw      AuditAction = "WALLET_WITHDRAW"
+	ActionWithdrawalReview    AuditAction = "WITHDRAWAL_REVIEW"
+	ActionPayoutBatch         AuditAction = "PAYOUT_BATCH"
+	ActionWalletTransfer      AuditAction = "WALLET_TRANSFER"
+	ActionWalletPINChange     AuditAction = "WALLET_PIN_CHANGE"
+	ActionEscrowHold          AuditAction = "ESCROW_HOLD"
+	ActionEscrowRelease       AuditAction = "ESCROW_RELEASE"
+	ActionEscrowRefund        AuditAction = "ESCROW_REFUND"
+	ActionEscrowDispute       AuditAction = "ESCROW_DISPUTE"
+	ActionEscrowResolve       AuditAction = "ESCROW_RESOLVE"
+	ActionWebhookReplay       AuditAction = "WEBHOOK_REPLAY"
 	ActionDataExport          AuditAction = "DATA_EXPORT"
 	ActionSystemConfiguration AuditAction = "SYSTEM_CONFIG"
 	ActionKYCUpdate           AuditAction = "KYC_UPDATE"
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidAvailability = errors.New("invalid availability")
+	ErrTimeOffNotFound     = errors.New("time off not found")
+	ErrInvalidSlotRange    = errors.New("invalid slot range")
+	ErrSlotUnavailable     = errors.New("requested time is not an open slot")
+)
+
+const (
+	// slotStep is the spacing of bookable start times within a working window
+	slotStep = 30 * time.Minute
+	// defaultJobDuration is used for services that do not state a duration
+	defaultJobDuration = time.Hour
+	// maxJobDuration bounds how far back a booking can reach into a slot
+	maxJobDuration       = 24 * time.Hour
+	maxSlotRange         = 14 * 24 * time.Hour
+	maxBufferMinutes     = 240
+	maxWindowsPerDay     = 4
+	maxTimeOffBlocks     = 100
+	defaultBufferMinutes = 30
+)
+
+// DefaultAvailability is the calendar of a provider who has not published their
+// own: Monday to Saturday, 08:00 to 17:00, with a 30 minute travel buffer
+func DefaultAvailability(providerID primitive.ObjectID) *models.ProviderAvailability {
+	availability := &models.ProviderAvailability{ProviderID: providerID, BufferMinutes: defaultBufferMinutes}
+	for day := time.Monday; day <= time.Saturday; day++ {
+		availability.WeeklyHours = append(availability.WeeklyHours, models.WorkingHours{Weekday: day, Start: "08:00", End: "17:00"})
+	}
+	return availability
+}
+
+// AvailabilityService manages provider calendars and works out the slots in
+// which a service can be booked
+type AvailabilityService struct {
+	repo   database.Repository
+	logger *zap.Logger
+	// mu serialises calendar edits, which read, change and replace the calendar
+	mu sync.Mutex
+}
+
+func NewAvailabilityService(repo database.Repository, logger *zap.Logger) *AvailabilityService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &AvailabilityService{repo: repo, logger: logger}
+}
+
+// Get returns the provider's calendar, or DefaultAvailability when they have not published one
+func (s *AvailabilityService) Get(ctx context.Context, providerID primitive.ObjectID) (*models.ProviderAvailability, error) {
+	availability, err := s.repo.GetProviderAvailability(ctx, providerID)
+	if errors.Is(err, database.ErrAvailabilityNotFound) {
+		return DefaultAvailability(providerID), nil
+	}
+	return availability, err
+}
+
+// SetWeeklyHours replaces the provider's working hours and travel buffer; time off is kept
+func (s *AvailabilityService) SetWeeklyHours(ctx context.Context, providerID primitive.ObjectID, hours []models.WorkingHours, bufferMinutes int) (*models.ProviderAvailability, error) {
+	if err := validateWeeklyHours(hours); err != nil {
+		return nil, err
+	}
+	if bufferMinutes < 0 || bufferMinutes > maxBufferMinutes {
+		return nil, fmt.Errorf("%w: buffer_minutes must be between 0 and %d", ErrInvalidAvailability, maxBufferMinutes)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	availability, err := s.Get(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	availability.WeeklyHours = hours
+	availability.BufferMinutes = bufferMinutes
+	return availability, s.save(ctx, availability)
+}
+
+// AddTimeOff blocks the provider's calendar. Bookings already in the block are
+// not cancelled; the provider still has to deal with them.
+func (s *AvailabilityService) AddTimeOff(ctx context.Context, providerID primitive.ObjectID, off models.TimeOff) (*models.ProviderAvailability, error) {
+	off.Reason = strings.TrimSpace(off.Reason)
+	if off.Start.IsZero() || !off.End.After(off.Start) {
+		return nil, fmt.Errorf("%w: time off must end after it starts", ErrInvalidAvailability)
+	}
+	if !off.End.After(time.Now()) {
+		return nil, fmt.Errorf("%w: time off must end in the future", ErrInvalidAvailability)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	availability, err := s.Get(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	// Drop blocks that are over so the calendar does not grow without bound
+	now := time.Now()
+	current := availability.TimeOff[:0]
+	for _, existing := range availability.TimeOff {
+		if existing.End.After(now) {
+			current = append(current, existing)
+		}
+	}
+	if len(current) >= maxTimeOffBlocks {
+		return nil, fmt.Errorf("%w: at most %d upcoming time off blocks", ErrInvalidAvailability, maxTimeOffBlocks)
+	}
+	off.ID = primitive.NewObjectID()
+	off.Start, off.End = off.Start.UTC(), off.End.UTC()
+	availability.TimeOff = append(current, off)
+	sort.Slice(availability.TimeOff, func(i, j int) bool { return availability.TimeOff[i].Start.Before(availability.TimeOff[j].Start) })
+	return availability, s.save(ctx, availability)
+}
+
+// RemoveTimeOff reopens a block of time off
+func (s *AvailabilityService) RemoveTimeOff(ctx context.Context, providerID, timeOffID primitive.ObjectID) (*models.ProviderAvailability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	availability, err := s.Get(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	for i, off := range availability.TimeOff {
+		if off.ID == timeOffID {
+			availability.TimeOff = append(availability.TimeOff[:i], availability.TimeOff[i+1:]...)
+			return availability, s.save(ctx, availability)
+		}
+	}
+	return nil, ErrTimeOffNotFound
+}
+
+// Slots returns the open start times for the service from from up to to. A
+// slot lies inside a working window, clear of time off, and the job plus the
+// travel buffer either side does not overlap the provider's other bookings.
+func (s *AvailabilityService) Slots(ctx context.Context, service *models.Service, from, to time.Time) ([]models.TimeSlot, error) {
+	if !to.After(from) || to.Sub(from) > maxSlotRange {
+		return nil, fmt.Errorf("%w: the range must end after it starts and span at most %d days", ErrInvalidSlotRange, int(maxSlotRange/(24*time.Hour)))
+	}
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	if !to.After(from) {
+		return []models.TimeSlot{}, nil
+	}
+	availability, err := s.Get(ctx, service.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	// Bookings that started up to a day earlier may still run into the range
+	booked, err := s.repo.GetProviderSchedule(ctx, service.ProviderID, from.Add(-maxJobDuration), to.Add(maxJobDuration))
+	if err != nil {
+		return nil, err
+	}
+	return openSlots(availability, booked, jobDuration(service), from.UTC(), to.UTC()), nil
+}
+
+// CheckSlot returns ErrSlotUnavailable unless start is an open slot for the service
+func (s *AvailabilityService) CheckSlot(ctx context.Context, service *models.Service, start time.Time) error {
+	slots, err := s.Slots(ctx, service, start, start.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	if len(slots) == 0 || !slots[0].Start.Equal(start) {
+		return ErrSlotUnavailable
+	}
+	return nil
+}
+
+func (s *AvailabilityService) save(ctx context.Context, availability *models.ProviderAvailability) error {
+	if err := s.repo.UpsertProviderAvailability(ctx, availability); err != nil {
+		s.logger.Error("Failed to save provider availability", zap.Error(err), zap.String("provider_id", availability.ProviderID.Hex()))
+		return err
+	}
+	return nil
+}
+
+// openSlots lays slotStep-spaced start times over each working window between
+// from and to and keeps those the job fits in
+func openSlots(availability *models.ProviderAvailability, booked []models.Booking, duration time.Duration, from, to time.Time) []models.TimeSlot {
+	buffer := time.Duration(availability.BufferMinutes) * time.Minute
+	slots := []models.TimeSlot{}
+	for day := from.Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		for _, window := range availability.WeeklyHours {
+			if window.Weekday != day.Weekday() {
+				continue
+			}
+			opensAt, _ := clockMinutes(window.Start)
+			closesAt, _ := clockMinutes(window.End)
+			windowEnd := day.Add(time.Duration(closesAt) * time.Minute)
+			for start := day.Add(time.Duration(opensAt) * time.Minute); !start.Add(duration).After(windowEnd); start = start.Add(slotStep) {
+				if start.Before(from) || !start.Before(to) {
+					continue
+				}
+				end := start.Add(duration)
+				if !clearOfTimeOff(availability.TimeOff, start, end) || !clearOfBookings(booked, start.Add(-buffer), end.Add(buffer)) {
+					continue
+				}
+				slots = append(slots, models.TimeSlot{Start: start, End: end})
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+func clearOfTimeOff(timeOff []models.TimeOff, start, end time.Time) bool {
+	for _, off := range timeOff {
+		if start.Before(off.End) && off.Start.Before(end) {
+			return false
+		}
+	}
+	return true
+}
+
+func clearOfBookings(booked []models.Booking, start, end time.Time) bool {
+	for _, b := range booked {
+		if start.Before(b.ScheduledDate.Add(jobDuration(&b.Service))) && b.ScheduledDate.Before(end) {
+			return false
+		}
+	}
+	return true
+}
+
+// jobDuration is how long a booking of the service keeps the provider busy
+func jobDuration(service *models.Service) time.Duration {
+	if service.Duration <= 0 {
+		return defaultJobDuration
+	}
+	return min(time.Duration(service.Duration)*time.Minute, maxJobDuration)
+}
+
+func validateWeeklyHours(hours []models.WorkingHours) error {
+	byDay := map[time.Weekday][][2]int{}
+	for _, window := range hours {
+		if window.Weekday < time.Sunday || window.Weekday > time.Saturday {
+			return fmt.Errorf("%w: weekday must be 0 (Sunday) to 6 (Saturday)", ErrInvalidAvailability)
+		}
+		opensAt, ok := clockMinutes(window.Start)
+		closesAt, ok2 := clockMinutes(window.End)
+		if !ok || !ok2 {
+			return fmt.Errorf("%w: working hours must be times like 08:00", ErrInvalidAvailability)
+		}
+		if closesAt <= opensAt {
+			return fmt.Errorf("%w: working hours must end after they start", ErrInvalidAvailability)
+		}
+		for _, other := range byDay[window.Weekday] {
+			if opensAt < other[1] && other[0] < closesAt {
+				return fmt.Errorf("%w: working hours on %s overlap", ErrInvalidAvailability, window.Weekday)
+			}
+		}
+		byDay[window.Weekday] = append(byDay[window.Weekday], [2]int{opensAt, closesAt})
+		if len(byDay[window.Weekday]) > maxWindowsPerDay {
+			return fmt.Errorf("%w: at most %d windows per day", ErrInvalidAvailability, maxWindowsPerDay)
+		}
+	}
+	return nil
+}
+
+// clockMinutes parses "15:04" into minutes after midnight; "24:00" closes a window at midnight
+func clockMinutes(clock string) (int, bool) {
+	if clock == "24:00" {
+		return 24 * 60, true
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
@@ -0,0 +1,210 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// openSlot returns the first open slot for the service in the coming week
+func openSlot(t *testing.T, repo database.Repository, svc *models.Service) time.Time {
+	t.Helper()
+	slots, err := services.NewAvailabilityService(repo, nil).Slots(context.TODO(), svc, time.Now(), time.Now().AddDate(0, 0, 7))
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no open slot: %v", err)
+	}
+	return slots[0].Start
+}
+
+// upcoming returns midnight UTC of the next given weekday at least two days away
+func upcoming(day time.Weekday) time.Time {
+	d := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 2)
+	for d.Weekday() != day {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+func slotStarts(slots []models.TimeSlot) map[string]bool {
+	starts := map[string]bool{}
+	for _, s := range slots {
+		starts[s.Start.Format("15:04")] = true
+	}
+	return starts
+}
+
+func TestAvailability_SlotsAvoidBookingsBuffersAndTimeOff(t *testing.T) {
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	availability := services.NewAvailabilityService(repo, nil)
+	bookings := services.NewBookingService(repo, nil)
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	customer := &models.User{Email: "customer@test.com", Role: models.CustomerRole}
+	for _, u := range []*models.User{provider, customer} {
+		if err := repo.CreateUser(ctx, u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	svc := &models.Service{Name: "Wiring", ProviderID: provider.ID, Price: 30, Currency: "USD", Duration: 90, IsActive: true}
+	if err := repo.CreateService(ctx, svc); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	monday := upcoming(time.Monday)
+	at := func(clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return monday.Add(time.Duration(c.Hour())*time.Hour + time.Duration(c.Minute())*time.Minute)
+	}
+
+	// Default hours: 08:00 to 17:00, so a 90 minute job can start at 15:30 at the latest
+	slots, err := availability.Slots(ctx, svc, monday, monday.AddDate(0, 0, 1))
+	if err != nil || len(slots) != 16 || !slots[15].End.Equal(at("17:00")) {
+		t.Fatalf("expected 16 slots ending by 17:00, got %d, %v", len(slots), err)
+	}
+	if slots, _ = availability.Slots(ctx, svc, monday.AddDate(0, 0, -1), monday); len(slots) != 0 {
+		t.Fatalf("expected no slots on Sunday, got %d", len(slots))
+	}
+
+	// A 10:00 booking holds 10:00-11:30 plus 30 minutes of travel either side
+	for _, bad := range []time.Time{at("03:00"), at("10:15"), at("16:00")} {
+		if err := bookings.Create(ctx, customer, &models.Booking{ServiceID: svc.ID, ScheduledDate: bad}); !errors.Is(err, services.ErrSlotUnavailable) {
+			t.Fatalf("expected %s to be rejected, got %v", bad.Format("15:04"), err)
+		}
+	}
+	booked := &models.Booking{ServiceID: svc.ID, ScheduledDate: at("10:00")}
+	if err := bookings.Create(ctx, customer, booked); err != nil {
+		t.Fatalf("book 10:00: %v", err)
+	}
+	if err := bookings.Create(ctx, customer, &models.Booking{ServiceID: svc.ID, ScheduledDate: at("11:30")}); !errors.Is(err, services.ErrSlotUnavailable) {
+		t.Fatalf("expected the travel buffer to block 11:30, got %v", err)
+	}
+	slots, _ = availability.Slots(ctx, svc, monday, monday.AddDate(0, 0, 1))
+	starts := slotStarts(slots)
+	if !starts["08:00"] || starts["08:30"] || starts["10:00"] || starts["11:30"] || !starts["12:00"] {
+		t.Fatalf("unexpected slots around the booking: %v", starts)
+	}
+
+	if _, err := availability.AddTimeOff(ctx, provider.ID, models.TimeOff{Start: at("13:00"), End: at("14:00"), Reason: "clinic"}); err != nil {
+		t.Fatalf("add time off: %v", err)
+	}
+	slots, _ = availability.Slots(ctx, svc, monday, monday.AddDate(0, 0, 1))
+	if starts = slotStarts(slots); starts["12:00"] || starts["13:30"] || !starts["14:00"] {
+		t.Fatalf("unexpected slots around time off: %v", starts)
+	}
+
+	// Cancelling frees the slot
+	if _, _, err := bookings.UpdateStatus(ctx, customer, booked.ID, models.BookingCancelled); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := availability.CheckSlot(ctx, svc, at("10:00")); err != nil {
+		t.Fatalf("expected 10:00 to reopen: %v", err)
+	}
+}
+
+func TestAvailability_WeeklyHoursAndTimeOff(t *testing.T) {
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	availability := services.NewAvailabilityService(repo, nil)
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	_ = repo.CreateUser(ctx, provider)
+	svc := &models.Service{Name: "Braiding", ProviderID: provider.ID, Duration: 90, IsActive: true}
+	_ = repo.CreateService(ctx, svc)
+
+	for _, bad := range [][]models.WorkingHours{
+		{{Weekday: time.Sunday, Start: "12:00", End: "10:00"}},
+		{{Weekday: time.Sunday, Start: "8am", End: "10:00"}},
+		{{Weekday: 7, Start: "08:00", End: "10:00"}},
+		{{Weekday: time.Sunday, Start: "08:00", End: "12:00"}, {Weekday: time.Sunday, Start: "11:00", End: "14:00"}},
+	} {
+		if _, err := availability.SetWeeklyHours(ctx, provider.ID, bad, 0); !errors.Is(err, services.ErrInvalidAvailability) {
+			t.Fatalf("expected %+v to be invalid, got %v", bad, err)
+		}
+	}
+	if _, err := availability.SetWeeklyHours(ctx, provider.ID, nil, 500); !errors.Is(err, services.ErrInvalidAvailability) {
+		t.Fatalf("expected an oversized buffer to be invalid, got %v", err)
+	}
+
+	hours := []models.WorkingHours{{Weekday: time.Sunday, Start: "10:00", End: "12:00"}, {Weekday: time.Sunday, Start: "14:00", End: "24:00"}}
+	if _, err := availability.SetWeeklyHours(ctx, provider.ID, hours, 0); err != nil {
+		t.Fatalf("set hours: %v", err)
+	}
+	sunday := upcoming(time.Sunday)
+	slots, err := availability.Slots(ctx, svc, sunday, sunday.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("slots: %v", err)
+	}
+	starts := slotStarts(slots)
+	// 10:00-12:00 fits two 90 minute starts; 14:00-24:00 fits 14:00 to 22:30; Monday is now closed
+	if len(slots) != 2+18 || !starts["10:30"] || starts["11:00"] || !starts["22:30"] {
+		t.Fatalf("unexpected slots: %d %v", len(slots), starts)
+	}
+
+	got, err := availability.AddTimeOff(ctx, provider.ID, models.TimeOff{Start: sunday, End: sunday.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("add time off: %v", err)
+	}
+	if slots, _ = availability.Slots(ctx, svc, sunday, sunday.AddDate(0, 0, 2)); len(slots) != 0 {
+		t.Fatalf("expected the day off to close Sunday, got %d slots", len(slots))
+	}
+	if _, err := availability.RemoveTimeOff(ctx, provider.ID, got.TimeOff[0].ID); err != nil {
+		t.Fatalf("remove time off: %v", err)
+	}
+	if _, err := availability.RemoveTimeOff(ctx, provider.ID, got.TimeOff[0].ID); !errors.Is(err, services.ErrTimeOffNotFound) {
+		t.Fatalf("expected removed time off to be gone, got %v", err)
+	}
+	if _, err := availability.Slots(ctx, svc, sunday, sunday.AddDate(0, 1, 0)); !errors.Is(err, services.ErrInvalidSlotRange) {
+		t.Fatalf("expected a month-long range to be rejected, got %v", err)
+	}
+}
+
+func TestAvailability_ConcurrentBookingsTakeASlotOnce(t *testing.T) {
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	bookings := services.NewBookingService(repo, nil)
+	provider := &models.User{Email: "provider@test.com", Role: models.ProviderRole}
+	_ = repo.CreateUser(ctx, provider)
+	svc := &models.Service{Name: "Plumbing", ProviderID: provider.ID, Price: 20, Currency: "USD", Duration: 60, IsActive: true}
+	_ = repo.CreateService(ctx, svc)
+	start := openSlot(t, repo, svc)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	booked, refused := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			customer := &models.User{Role: models.CustomerRole}
+			_ = repo.CreateUser(ctx, customer)
+			err := bookings.Create(ctx, customer, &models.Booking{ServiceID: svc.ID, ScheduledDate: start})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				booked++
+			case errors.Is(err, services.ErrSlotUnavailable):
+				refused++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if booked != 1 || refused != 9 {
+		t.Fatalf("expected one booking and nine refusals, got %d and %d", booked, refused)
+	}
+
+	// The repository itself refuses a second active booking at that time
+	err := repo.CreateBooking(ctx, &models.Booking{ProviderID: provider.ID, ScheduledDate: start, Status: models.BookingConfirmed})
+	if !errors.Is(err, database.ErrSlotTaken) {
+		t.Fatalf("expected the slot to be taken, got %v", err)
+	}
+	if err := repo.CreateBooking(ctx, &models.Booking{ProviderID: provider.ID, ScheduledDate: start, Status: models.BookingCancelled}); err != nil {
+		t.Fatalf("a cancelled booking holds no slot: %v", err)
+	}
+}
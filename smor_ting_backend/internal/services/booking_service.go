@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrBookingNotFound          = errors.New("booking not found")
+	ErrBookingForbidden         = errors.New("not allowed to change this booking")
+	ErrInvalidBookingTransition = errors.New("invalid booking status transition")
+	ErrServiceUnavailable       = errors.New("service is not available for booking")
+	ErrInvalidBookingSchedule   = errors.New("scheduled date must be in the future")
+)
+
+// BookingStatusListener is notified after a booking has moved from previous to booking.Status
+type BookingStatusListener func(ctx context.Context, booking *models.Booking, previous models.BookingStatus)
+
+// BookingService owns booking creation and enforces the booking status state machine
+type BookingService struct {
+	repo         database.Repository
+	availability *AvailabilityService
+	logger       *zap.Logger
+	listeners    []BookingStatusListener
+}
+
+// NewBookingService creates a new booking service
+func NewBookingService(repo database.Repository, logger *zap.Logger) *BookingService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &BookingService{repo: repo, availability: NewAvailabilityService(repo, logger), logger: logger}
+}
+
+// OnStatusChange registers a listener invoked after every successful status transition.
+// Listeners must be registered before the service starts handling requests.
+func (s *BookingService) OnStatusChange(listener BookingStatusListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// Create books a service for the customer. Price, currency and provider are taken
+// from the service itself and a snapshot is embedded for offline access. The
+// scheduled date must be one of the open slots of the provider's calendar; the
+// repository refuses a second booking for the same provider and start time, so
+// concurrent requests for one slot cannot both succeed.
+func (s *BookingService) Create(ctx context.Context, customer *models.User, booking *models.Booking) error {
+	if !bookingScheduleValid(booking.ScheduledDate) {
+		return ErrInvalidBookingSchedule
+	}
+	service, err := s.repo.GetServiceByID(ctx, booking.ServiceID)
+	if err != nil || !service.IsActive {
+		return ErrServiceUnavailable
+	}
+	if service.ProviderID == customer.ID {
+		return ErrBookingForbidden
+	}
+
+	if err := s.availability.CheckSlot(ctx, service, booking.ScheduledDate); err != nil {
+		return err
+	}
+
+	booking.CustomerID = customer.ID
+	booking.ProviderID = service.ProviderID
+	booking.Status = models.BookingPending
+	booking.CompletedDate = nil
+	booking.TotalAmount = service.Price
+	booking.Currency = service.Currency
+	booking.PaymentStatus = "pending"
+	booking.Service = *service
+
+	if err := s.repo.CreateBooking(ctx, booking); err != nil {
+		if errors.Is(err, database.ErrSlotTaken) {
+			return ErrSlotUnavailable
+		}
+		s.logger.Error("Failed to create booking", zap.Error(err), zap.String("customer_id", customer.ID.Hex()))
+		return err
+	}
+	return nil
+}
+
+// CreateFromQuote books a quoted job at the agreed price and start time, which
+// must still be open in the provider's calendar. The provider committed to the
+// quote, so the booking starts out confirmed.
+func (s *BookingService) CreateFromQuote(ctx context.Context, customer *models.User, job *models.JobRequest, quote *models.Quote) (*models.Booking, error) {
+	if !bookingScheduleValid(quote.ScheduledDate) {
+		return nil, ErrInvalidBookingSchedule
+	}
+	if quote.ProviderID == customer.ID {
+		return nil, ErrBookingForbidden
+	}
+	service := quotedService(job, quote)
+	if err := s.availability.CheckSlot(ctx, service, quote.ScheduledDate); err != nil {
+		return nil, err
+	}
+	booking := &models.Booking{
+		CustomerID:    customer.ID,
+		ProviderID:    quote.ProviderID,
+		Status:        models.BookingConfirmed,
+		ScheduledDate: quote.ScheduledDate,
+		Address:       job.Location,
+		Notes:         job.Description,
+		TotalAmount:   quote.Price,
+		Currency:      quote.Currency,
+		PaymentStatus: "pending",
+		Service:       *service,
+		JobRequestID:  &job.ID,
+		QuoteID:       &quote.ID,
+	}
+	if err := s.repo.CreateBooking(ctx, booking); err != nil {
+		if errors.Is(err, database.ErrSlotTaken) {
+			return nil, ErrSlotUnavailable
+		}
+		s.logger.Error("Failed to create booking from quote", zap.Error(err), zap.String("quote_id", quote.ID.Hex()))
+		return nil, err
+	}
+	return booking, nil
+}
+
+// Get returns a booking visible to the user (its customer, its provider or an admin)
+func (s *BookingService) Get(ctx context.Context, user *models.User, id primitive.ObjectID) (*models.Booking, error) {
+	booking, err := s.repo.GetBookingByID(ctx, id)
+	if err != nil {
+		return nil, ErrBookingNotFound
+	}
+	if !isBookingParty(user, booking) {
+		return nil, ErrBookingNotFound
+	}
+	return booking, nil
+}
+
+// ListForUser returns the bookings the user provides when they are a provider, otherwise the ones they placed
+func (s *BookingService) ListForUser(ctx context.Context, user *models.User, status models.BookingStatus) ([]models.Booking, error) {
+	var (
+		list []models.Booking
+		err  error
+	)
+	if user.Role == models.ProviderRole {
+		list, err = s.repo.GetProviderBookings(ctx, user.ID)
+	} else {
+		list, err = s.repo.GetUserBookings(ctx, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.Booking, 0, len(list))
+	for _, b := range list {
+		if status == "" || b.Status == status {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// UpdateStatus moves a booking to next on behalf of actor. Only the provider may
+// confirm or start a job; either party may cancel before work starts or mark an
+// in-progress job completed; admins may apply any valid transition.
+func (s *BookingService) UpdateStatus(ctx context.Context, actor *models.User, id primitive.ObjectID, next models.BookingStatus) (*models.Booking, models.BookingStatus, error) {
+	booking, err := s.repo.GetBookingByID(ctx, id)
+	if err != nil {
+		return nil, "", ErrBookingNotFound
+	}
+	if !isBookingParty(actor, booking) {
+		return nil, "", ErrBookingNotFound
+	}
+	previous := booking.Status
+	if !previous.CanTransitionTo(next) {
+		return nil, previous, ErrInvalidBookingTransition
+	}
+	if !canActorTransition(actor, booking, next) {
+		return nil, previous, ErrBookingForbidden
+	}
+
+	if err := s.repo.TransitionBookingStatus(ctx, id, previous, next); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			return nil, previous, ErrInvalidBookingTransition
+		}
+		// A pending booking past its hold may have lost its slot to a newer booking
+		if errors.Is(err, database.ErrSlotTaken) {
+			return nil, previous, ErrSlotUnavailable
+		}
+		s.logger.Error("Failed to update booking status", zap.Error(err), zap.String("booking_id", id.Hex()))
+		return nil, previous, err
+	}
+
+	updated, err := s.repo.GetBookingByID(ctx, id)
+	if err != nil {
+		return nil, previous, err
+	}
+	for _, listener := range s.listeners {
+		listener(ctx, updated, previous)
+	}
+	return updated, previous, nil
+}
+
+func isBookingParty(user *models.User, booking *models.Booking) bool {
+	return user.Role == models.AdminRole || user.ID == booking.CustomerID || user.ID == booking.ProviderID
+}
+
+func canActorTransition(actor *models.User, booking *models.Booking, next models.BookingStatus) bool {
+	if actor.Role == models.AdminRole {
+		return true
+	}
+	switch next {
+	case models.BookingConfirmed, models.BookingInProgress:
+		return actor.ID == booking.ProviderID
+	case models.BookingCompleted, models.BookingCancelled:
+		return actor.ID == booking.ProviderID || actor.ID == booking.CustomerID
+	}
+	return false
+}
+
+// bookingScheduleValid rejects bookings scheduled in the past
+func bookingScheduleValid(scheduled time.Time) bool {
+	return !scheduled.IsZero() && scheduled.After(time.Now().Add(-time.Minute))
+}
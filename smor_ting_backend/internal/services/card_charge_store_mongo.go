@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCardChargeStore persists card charges in the card_charges collection
+type MongoCardChargeStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoCardChargeStore(db *mongo.Database, logger *logger.Logger) (*MongoCardChargeStore, error) {
+	s := &MongoCardChargeStore{coll: db.Collection("card_charges"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "gateway_ref", Value: 1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoCardChargeStore) Create(ctx context.Context, charge *CardCharge) error {
+	charge.CreatedAt = time.Now()
+	charge.UpdatedAt = charge.CreatedAt
+	_, err := m.coll.InsertOne(ctx, charge)
+	return err
+}
+
+func (m *MongoCardChargeStore) Get(ctx context.Context, transactionID string) (*CardCharge, error) {
+	var out CardCharge
+	if err := m.coll.FindOne(ctx, bson.M{"_id": transactionID}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCardChargeNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoCardChargeStore) Update(ctx context.Context, charge *CardCharge, from CardChargeStatus) error {
+	charge.UpdatedAt = time.Now()
+	res, err := m.coll.ReplaceOne(ctx, bson.M{"_id": charge.TransactionID, "status": from}, charge)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.Get(ctx, charge.TransactionID); err != nil {
+			return err
+		}
+		return ErrCardChargeStateChanged
+	}
+	return nil
+}
+
+func (m *MongoCardChargeStore) ReserveRefund(ctx context.Context, transactionID string, amount float64) (*CardCharge, error) {
+	unreserved := bson.M{"$subtract": bson.A{"$captured_amount", bson.M{"$add": bson.A{"$refunded_amount", bson.M{"$ifNull": bson.A{"$refund_pending", 0}}}}}}
+	filter := bson.M{
+		"_id":    transactionID,
+		"status": CardChargeCaptured,
+		// Half a cent of slack absorbs float noise in the stored sums
+		"$expr": bson.M{"$gte": bson.A{unreserved, amount - 0.005}},
+	}
+	update := bson.M{"$inc": bson.M{"refund_pending": amount}, "$set": bson.M{"updated_at": time.Now()}}
+	var out CardCharge
+	err := m.coll.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		charge, err := m.Get(ctx, transactionID)
+		if err != nil {
+			return nil, err
+		}
+		if charge.Status != CardChargeCaptured {
+			return nil, ErrCardChargeInvalidState
+		}
+		return nil, ErrCardChargeAmountExceeded
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoCardChargeStore) SettleRefund(ctx context.Context, transactionID string, amount float64, refunded bool) (*CardCharge, error) {
+	inc := bson.M{"refund_pending": -amount}
+	if refunded {
+		inc["refunded_amount"] = amount
+	}
+	var out CardCharge
+	err := m.coll.FindOneAndUpdate(ctx, bson.M{"_id": transactionID}, bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCardChargeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if refunded && out.Status == CardChargeCaptured && roundCents(out.RefundedAmount) >= out.CapturedAmount {
+		res, err := m.coll.UpdateOne(ctx, bson.M{"_id": transactionID, "status": CardChargeCaptured}, bson.M{"$set": bson.M{"status": CardChargeRefunded}})
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount > 0 {
+			out.Status = CardChargeRefunded
+		}
+	}
+	return &out, nil
+}
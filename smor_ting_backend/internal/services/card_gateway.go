@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCardDeclined matches every *CardDeclinedError
+	ErrCardDeclined             = errors.New("card declined")
+	ErrCardGatewayUnavailable   = errors.New("card gateway unavailable")
+	ErrCardChargeNotFound       = errors.New("card charge not found")
+	ErrCardChargeStateChanged   = errors.New("card charge status changed concurrently")
+	ErrCardChargeInvalidState   = errors.New("operation not allowed in the charge's current status")
+	ErrCardChargeAmountExceeded = errors.New("amount exceeds what the charge allows")
+)
+
+// Decline codes surfaced to clients, independent of the gateway's own wording
+const (
+	DeclineInsufficientFunds    = "insufficient_funds"
+	DeclineDoNotHonor           = "do_not_honor"
+	DeclineExpiredCard          = "expired_card"
+	DeclineIncorrectCVV         = "incorrect_cvv"
+	DeclineInvalidCard          = "invalid_card"
+	DeclineSuspectedFraud       = "suspected_fraud"
+	DeclineAuthenticationFailed = "authentication_failed"
+	DeclineNotPermitted         = "transaction_not_permitted"
+	DeclineGeneric              = "generic_decline"
+)
+
+// CardDeclinedError is a decline by the issuer or gateway; it is final for the
+// attempt, unlike ErrCardGatewayUnavailable which may be retried
+type CardDeclinedError struct {
+	Code    string
+	Message string
+}
+
+func (e *CardDeclinedError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("card declined: %s", e.Code)
+	}
+	return fmt.Sprintf("card declined: %s (%s)", e.Code, e.Message)
+}
+
+func (e *CardDeclinedError) Is(target error) bool { return target == ErrCardDeclined }
+
+// CardChargeStatus is where a card charge is in its authorize/capture lifecycle
+type CardChargeStatus string
+
+const (
+	CardChargeRequiresAction CardChargeStatus = "requires_action" // waiting for 3-D Secure
+	CardChargeAuthorized     CardChargeStatus = "authorized"
+	CardChargeCapturing      CardChargeStatus = "capturing" // capture sent to the gateway
+	CardChargeCaptured       CardChargeStatus = "captured"
+	CardChargeVoided         CardChargeStatus = "voided"
+	CardChargeRefunded       CardChargeStatus = "refunded" // fully refunded; partial refunds stay captured
+	CardChargeFailed         CardChargeStatus = "failed"
+)
+
+// Capture methods: automatic captures as soon as the charge is authorized
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+)
+
+// CardCharge is our record of a charge at the gateway
+type CardCharge struct {
+	TransactionID  string           `json:"transaction_id" bson:"_id"`
+	Reference      string           `json:"reference" bson:"reference"` // the caller's reference
+	UserID         string           `json:"user_id" bson:"user_id"`
+	TokenID        string           `json:"-" bson:"token_id"`
+	Gateway        string           `json:"gateway" bson:"gateway"`
+	GatewayRef     string           `json:"gateway_ref" bson:"gateway_ref"`
+	GatewayID      string           `json:"-" bson:"gateway_id,omitempty"` // the gateway's numeric/transaction id where it differs from GatewayRef
+	Status         CardChargeStatus `json:"status" bson:"status"`
+	Amount         float64          `json:"amount" bson:"amount"`
+	CapturedAmount float64          `json:"captured_amount" bson:"captured_amount"`
+	RefundedAmount float64          `json:"refunded_amount" bson:"refunded_amount"`
+	RefundPending  float64          `json:"refund_pending" bson:"refund_pending"` // refunds sent to the gateway, not yet confirmed
+	Currency       string           `json:"currency" bson:"currency"`
+	CaptureMethod  string           `json:"capture_method" bson:"capture_method"`
+	RedirectURL    string           `json:"redirect_url,omitempty" bson:"redirect_url,omitempty"`
+	DeclineCode    string           `json:"decline_code,omitempty" bson:"decline_code,omitempty"`
+	CreatedAt      time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at" bson:"updated_at"`
+}
+
+// CardAuthorization asks the gateway to hold Amount on a card. Reference is our
+// transaction id and comes back on the 3-D Secure return.
+type CardAuthorization struct {
+	Reference   string
+	Amount      float64
+	Currency    string
+	Card        *SensitivePaymentData
+	Email       string
+	RedirectURL string // where the cardholder returns after 3-D Secure
+}
+
+// GatewayResult is the gateway's view of a charge after an operation
+type GatewayResult struct {
+	Status      CardChargeStatus
+	GatewayRef  string
+	GatewayID   string
+	RedirectURL string // set when Status is requires_action
+}
+
+// CardGateway is a card processor. Declines are returned as *CardDeclinedError;
+// transport and processor faults as ErrCardGatewayUnavailable.
+type CardGateway interface {
+	Name() string
+	Authorize(ctx context.Context, req CardAuthorization) (*GatewayResult, error)
+	// ConfirmAuthentication asks the gateway how 3-D Secure ended; the
+	// parameters of the redirect itself are never trusted
+	ConfirmAuthentication(ctx context.Context, charge *CardCharge) (*GatewayResult, error)
+	Capture(ctx context.Context, charge *CardCharge, amount float64) (*GatewayResult, error)
+	Void(ctx context.Context, charge *CardCharge) (*GatewayResult, error)
+	Refund(ctx context.Context, charge *CardCharge, amount float64) (*GatewayResult, error)
+}
+
+// CardChargeStore persists card charges. Update is a compare-and-set on Status
+// so a capture, void and refund racing on the same charge cannot all succeed.
+type CardChargeStore interface {
+	Create(ctx context.Context, charge *CardCharge) error
+	Get(ctx context.Context, transactionID string) (*CardCharge, error)
+	// Update replaces the charge if its stored status is still from, otherwise returns ErrCardChargeStateChanged
+	Update(ctx context.Context, charge *CardCharge, from CardChargeStatus) error
+	// ReserveRefund adds amount to a captured charge's RefundPending if what is
+	// neither refunded nor reserved covers it, otherwise it returns
+	// ErrCardChargeInvalidState or ErrCardChargeAmountExceeded
+	ReserveRefund(ctx context.Context, transactionID string, amount float64) (*CardCharge, error)
+	// SettleRefund releases a reservation, adding it to RefundedAmount when the
+	// gateway refunded it; a charge refunded in full becomes refunded
+	SettleRefund(ctx context.Context, transactionID string, amount float64, refunded bool) (*CardCharge, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryCardChargeStore struct {
+	mu      sync.RWMutex
+	charges map[string]*CardCharge
+}
+
+func NewMemoryCardChargeStore() CardChargeStore {
+	return &memoryCardChargeStore{charges: make(map[string]*CardCharge)}
+}
+
+func (m *memoryCardChargeStore) Create(ctx context.Context, charge *CardCharge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.charges[charge.TransactionID]; ok {
+		return fmt.Errorf("card charge %s already exists", charge.TransactionID)
+	}
+	charge.CreatedAt = time.Now()
+	charge.UpdatedAt = charge.CreatedAt
+	cp := *charge
+	m.charges[charge.TransactionID] = &cp
+	return nil
+}
+
+func (m *memoryCardChargeStore) Get(ctx context.Context, transactionID string) (*CardCharge, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	charge, ok := m.charges[transactionID]
+	if !ok {
+		return nil, ErrCardChargeNotFound
+	}
+	cp := *charge
+	return &cp, nil
+}
+
+func (m *memoryCardChargeStore) Update(ctx context.Context, charge *CardCharge, from CardChargeStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.charges[charge.TransactionID]
+	if !ok {
+		return ErrCardChargeNotFound
+	}
+	if stored.Status != from {
+		return ErrCardChargeStateChanged
+	}
+	charge.UpdatedAt = time.Now()
+	cp := *charge
+	m.charges[charge.TransactionID] = &cp
+	return nil
+}
+
+func (m *memoryCardChargeStore) ReserveRefund(ctx context.Context, transactionID string, amount float64) (*CardCharge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.charges[transactionID]
+	if !ok {
+		return nil, ErrCardChargeNotFound
+	}
+	if stored.Status != CardChargeCaptured {
+		return nil, ErrCardChargeInvalidState
+	}
+	if amount > roundCents(stored.CapturedAmount-stored.RefundedAmount-stored.RefundPending) {
+		return nil, ErrCardChargeAmountExceeded
+	}
+	stored.RefundPending = roundCents(stored.RefundPending + amount)
+	stored.UpdatedAt = time.Now()
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryCardChargeStore) SettleRefund(ctx context.Context, transactionID string, amount float64, refunded bool) (*CardCharge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.charges[transactionID]
+	if !ok {
+		return nil, ErrCardChargeNotFound
+	}
+	stored.RefundPending = roundCents(stored.RefundPending - amount)
+	if refunded {
+		stored.RefundedAmount = roundCents(stored.RefundedAmount + amount)
+		if stored.Status == CardChargeCaptured && stored.RefundedAmount >= stored.CapturedAmount {
+			stored.Status = CardChargeRefunded
+		}
+	}
+	stored.UpdatedAt = time.Now()
+	cp := *stored
+	return &cp, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Test cards understood by FakeCardGateway; any other number is approved
+const (
+	FakeCardApproved          = "4242424242424242"
+	FakeCard3DS               = "4000000000003220" // approved after 3-D Secure
+	FakeCard3DSFails          = "4000008400001629" // 3-D Secure is not completed
+	FakeCardInsufficientFunds = "4000000000009995"
+	FakeCardDeclined          = "4000000000000002"
+	FakeCardExpired           = "4000000000000069"
+	FakeCardIncorrectCVV      = "4000000000000127"
+	FakeCardFraud             = "4100000000000019"
+	FakeCardProcessingError   = "4000000000000119" // the gateway fails, not the card
+)
+
+// FakeCardGateway is a deterministic in-process gateway for tests and local development
+type FakeCardGateway struct {
+	mu      sync.Mutex
+	seq     int
+	charges map[string]*fakeCardCharge
+}
+
+type fakeCardCharge struct {
+	card       string
+	authorized float64
+	captured   float64
+	refunded   float64
+	status     CardChargeStatus
+}
+
+func NewFakeCardGateway() *FakeCardGateway {
+	return &FakeCardGateway{charges: make(map[string]*fakeCardCharge)}
+}
+
+func (g *FakeCardGateway) Name() string { return "fake" }
+
+func (g *FakeCardGateway) Authorize(ctx context.Context, req CardAuthorization) (*GatewayResult, error) {
+	if req.Card == nil || req.Card.CardNumber == "" {
+		return nil, &CardDeclinedError{Code: DeclineInvalidCard}
+	}
+	switch req.Card.CardNumber {
+	case FakeCardInsufficientFunds:
+		return nil, &CardDeclinedError{Code: DeclineInsufficientFunds, Message: "Insufficient funds"}
+	case FakeCardDeclined:
+		return nil, &CardDeclinedError{Code: DeclineDoNotHonor, Message: "Do not honor"}
+	case FakeCardExpired:
+		return nil, &CardDeclinedError{Code: DeclineExpiredCard, Message: "Expired card"}
+	case FakeCardIncorrectCVV:
+		return nil, &CardDeclinedError{Code: DeclineIncorrectCVV, Message: "Incorrect CVV"}
+	case FakeCardFraud:
+		return nil, &CardDeclinedError{Code: DeclineSuspectedFraud, Message: "Suspected fraud"}
+	case FakeCardProcessingError:
+		return nil, fmt.Errorf("%w: processor timeout", ErrCardGatewayUnavailable)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq++
+	ref := fmt.Sprintf("FAKE-%06d", g.seq)
+	charge := &fakeCardCharge{card: req.Card.CardNumber, authorized: req.Amount, status: CardChargeAuthorized}
+	g.charges[ref] = charge
+	if charge.card == FakeCard3DS || charge.card == FakeCard3DSFails {
+		charge.status = CardChargeRequiresAction
+		return &GatewayResult{Status: charge.status, GatewayRef: ref, RedirectURL: "https://3ds.fake-gateway.test/challenge/" + ref}, nil
+	}
+	return &GatewayResult{Status: charge.status, GatewayRef: ref}, nil
+}
+
+func (g *FakeCardGateway) ConfirmAuthentication(ctx context.Context, c *CardCharge) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	charge, err := g.charge(c.GatewayRef)
+	if err != nil {
+		return nil, err
+	}
+	if charge.status == CardChargeRequiresAction {
+		if charge.card == FakeCard3DSFails {
+			charge.status = CardChargeFailed
+			return nil, &CardDeclinedError{Code: DeclineAuthenticationFailed, Message: "3-D Secure not completed"}
+		}
+		charge.status = CardChargeAuthorized
+	}
+	return &GatewayResult{Status: charge.status, GatewayRef: c.GatewayRef}, nil
+}
+
+func (g *FakeCardGateway) Capture(ctx context.Context, c *CardCharge, amount float64) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	charge, err := g.charge(c.GatewayRef)
+	if err != nil {
+		return nil, err
+	}
+	if charge.status != CardChargeAuthorized {
+		return nil, ErrCardChargeInvalidState
+	}
+	if amount > charge.authorized {
+		return nil, ErrCardChargeAmountExceeded
+	}
+	charge.captured = amount
+	charge.status = CardChargeCaptured
+	return &GatewayResult{Status: charge.status, GatewayRef: c.GatewayRef}, nil
+}
+
+func (g *FakeCardGateway) Void(ctx context.Context, c *CardCharge) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	charge, err := g.charge(c.GatewayRef)
+	if err != nil {
+		return nil, err
+	}
+	if charge.status != CardChargeAuthorized && charge.status != CardChargeRequiresAction {
+		return nil, ErrCardChargeInvalidState
+	}
+	charge.status = CardChargeVoided
+	return &GatewayResult{Status: charge.status, GatewayRef: c.GatewayRef}, nil
+}
+
+func (g *FakeCardGateway) Refund(ctx context.Context, c *CardCharge, amount float64) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	charge, err := g.charge(c.GatewayRef)
+	if err != nil {
+		return nil, err
+	}
+	if charge.status != CardChargeCaptured {
+		return nil, ErrCardChargeInvalidState
+	}
+	if amount > charge.captured-charge.refunded {
+		return nil, ErrCardChargeAmountExceeded
+	}
+	charge.refunded += amount
+	if charge.refunded >= charge.captured {
+		charge.status = CardChargeRefunded
+	}
+	return &GatewayResult{Status: charge.status, GatewayRef: c.GatewayRef}, nil
+}
+
+func (g *FakeCardGateway) charge(ref string) (*fakeCardCharge, error) {
+	charge, ok := g.charges[ref]
+	if !ok {
+		return nil, ErrCardChargeNotFound
+	}
+	return charge, nil
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrInvalidCategory   = errors.New("invalid category")
+	ErrCategorySlugTaken = errors.New("category slug already in use")
+	ErrCategoryInactive  = errors.New("category is not active")
+)
+
+// maxCategoryDepth bounds nesting: a category, a subcategory and one level below that
+const maxCategoryDepth = 3
+
+var (
+	categorySlugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	categoryColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+	slugSeparators       = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// CategoryInput is a create or partial update. Nil fields are left unchanged;
+// on update, SetParent moves the category under Parent, or to the top level when Parent is nil.
+type CategoryInput struct {
+	Name        *string
+	Slug        *string
+	Description *string
+	SetParent   bool
+	Parent      *primitive.ObjectID
+	Icon        *string
+	Color       *string
+	SortOrder   *int
+	IsActive    *bool
+}
+
+// CategorySeed is a category in a seeded taxonomy, with its subcategories
+type CategorySeed struct {
+	Name     string
+	Slug     string
+	Icon     string
+	Color    string
+	Children []CategorySeed
+}
+
+// CategoryService manages the service category tree
+type CategoryService struct {
+	repo   database.Repository
+	logger *zap.Logger
+	// mu serialises writes so parent and depth checks see a stable tree
+	mu sync.Mutex
+}
+
+func NewCategoryService(repo database.Repository, logger *zap.Logger) *CategoryService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &CategoryService{repo: repo, logger: logger}
+}
+
+// Tree returns the categories nested under their parents, each level in sort
+// order. Unless includeInactive, inactive categories and everything below them are left out.
+func (s *CategoryService) Tree(ctx context.Context, includeInactive bool) ([]models.ServiceCategory, error) {
+	all, err := s.repo.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	children := map[primitive.ObjectID][]models.ServiceCategory{}
+	for _, c := range all {
+		if !includeInactive && !c.IsActive {
+			continue
+		}
+		parent := primitive.NilObjectID
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+	var build func(parent primitive.ObjectID) []models.ServiceCategory
+	build = func(parent primitive.ObjectID) []models.ServiceCategory {
+		level := children[parent]
+		for i := range level {
+			level[i].Children = build(level[i].ID)
+		}
+		return level
+	}
+	tree := build(primitive.NilObjectID)
+	if tree == nil {
+		tree = []models.ServiceCategory{}
+	}
+	return tree, nil
+}
+
+// Get returns one category
+func (s *CategoryService) Get(ctx context.Context, id primitive.ObjectID) (*models.ServiceCategory, error) {
+	category, err := s.repo.GetCategoryByID(ctx, id)
+	if errors.Is(err, database.ErrCategoryNotFound) {
+		return nil, ErrCategoryNotFound
+	}
+	return category, err
+}
+
+// Create adds a category; the slug defaults to one made from the name
+func (s *CategoryService) Create(ctx context.Context, in CategoryInput) (*models.ServiceCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category := &models.ServiceCategory{IsActive: true}
+	in.SetParent = true
+	if err := s.apply(ctx, category, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateCategory(ctx, category); err != nil {
+		return nil, s.writeError(err)
+	}
+	return category, nil
+}
+
+// Update applies a partial update. Moving a category checks that it does not
+// end up under itself or deeper than maxCategoryDepth.
+func (s *CategoryService) Update(ctx context.Context, id primitive.ObjectID, in CategoryInput) (*models.ServiceCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, category, in); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateCategory(ctx, category); err != nil {
+		return nil, s.writeError(err)
+	}
+	return category, nil
+}
+
+// Deactivate hides a category and everything below it; services already in it
+// keep their category but no service can be added to or moved into it
+func (s *CategoryService) Deactivate(ctx context.Context, id primitive.ObjectID) (*models.ServiceCategory, error) {
+	inactive := false
+	return s.Update(ctx, id, CategoryInput{IsActive: &inactive})
+}
+
+// RequireActive checks that services may be filed under the category: it
+// exists and neither it nor any ancestor is inactive
+func (s *CategoryService) RequireActive(ctx context.Context, id primitive.ObjectID) error {
+	for depth := 0; depth <= maxCategoryDepth; depth++ {
+		category, err := s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !category.IsActive {
+			return ErrCategoryInactive
+		}
+		if category.ParentID == nil {
+			return nil
+		}
+		id = *category.ParentID
+	}
+	return ErrCategoryInactive
+}
+
+// Seed creates the taxonomy's categories that do not exist yet, matching on
+// slug. Existing categories are left as they are, so admin edits survive a reseed.
+func (s *CategoryService) Seed(ctx context.Context, taxonomy []CategorySeed) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seed(ctx, taxonomy, nil)
+}
+
+func (s *CategoryService) seed(ctx context.Context, taxonomy []CategorySeed, parent *primitive.ObjectID) (int, error) {
+	created := 0
+	for i, seed := range taxonomy {
+		category, err := s.repo.GetCategoryBySlug(ctx, seed.Slug)
+		if errors.Is(err, database.ErrCategoryNotFound) {
+			category = &models.ServiceCategory{
+				Name:      seed.Name,
+				Slug:      seed.Slug,
+				ParentID:  parent,
+				Icon:      seed.Icon,
+				Color:     seed.Color,
+				SortOrder: (i + 1) * 10,
+				IsActive:  true,
+			}
+			err = s.repo.CreateCategory(ctx, category)
+			if err == nil {
+				created++
+			}
+		}
+		if err != nil {
+			return created, fmt.Errorf("seed category %s: %w", seed.Slug, err)
+		}
+		n, err := s.seed(ctx, seed.Children, &category.ID)
+		created += n
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// apply validates in and copies it onto category
+func (s *CategoryService) apply(ctx context.Context, category *models.ServiceCategory, in CategoryInput) error {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidCategory)
+		}
+		category.Name = name
+	}
+	if category.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCategory)
+	}
+	if in.Slug != nil {
+		category.Slug = strings.TrimSpace(*in.Slug)
+	}
+	if category.Slug == "" {
+		category.Slug = slugify(category.Name)
+	}
+	if !categorySlugPattern.MatchString(category.Slug) {
+		return fmt.Errorf("%w: slug must be lowercase letters and digits separated by hyphens", ErrInvalidCategory)
+	}
+	if in.Description != nil {
+		category.Description = *in.Description
+	}
+	if in.Icon != nil {
+		category.Icon = strings.TrimSpace(*in.Icon)
+	}
+	if in.Color != nil {
+		color := strings.TrimSpace(*in.Color)
+		if color != "" && !categoryColorPattern.MatchString(color) {
+			return fmt.Errorf("%w: color must be a hex colour like #2196F3", ErrInvalidCategory)
+		}
+		category.Color = color
+	}
+	if in.SortOrder != nil {
+		category.SortOrder = *in.SortOrder
+	}
+	if in.IsActive != nil {
+		category.IsActive = *in.IsActive
+	}
+	if in.SetParent {
+		if err := s.checkParent(ctx, category.ID, in.Parent); err != nil {
+			return err
+		}
+		category.ParentID = in.Parent
+	}
+	return nil
+}
+
+// checkParent checks that the category id (zero when new) can sit under parent
+func (s *CategoryService) checkParent(ctx context.Context, id primitive.ObjectID, parent *primitive.ObjectID) error {
+	all, err := s.repo.GetCategories(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[primitive.ObjectID]models.ServiceCategory, len(all))
+	for _, c := range all {
+		byID[c.ID] = c
+	}
+
+	// Levels from the top down to the new parent, inclusive
+	parentDepth := 0
+	for p := parent; p != nil; p = byID[*p].ParentID {
+		if _, ok := byID[*p]; !ok {
+			return fmt.Errorf("%w: parent category not found", ErrInvalidCategory)
+		}
+		if *p == id {
+			return fmt.Errorf("%w: a category cannot be moved under itself", ErrInvalidCategory)
+		}
+		parentDepth++
+		if parentDepth > maxCategoryDepth {
+			break
+		}
+	}
+
+	// Levels from the category down to its deepest descendant, inclusive
+	var height func(primitive.ObjectID) int
+	height = func(of primitive.ObjectID) int {
+		h := 1
+		for _, c := range all {
+			if c.ParentID != nil && *c.ParentID == of {
+				h = max(h, 1+height(c.ID))
+			}
+		}
+		return h
+	}
+	subtree := 1
+	if !id.IsZero() {
+		subtree = height(id)
+	}
+	if parentDepth+subtree > maxCategoryDepth {
+		return fmt.Errorf("%w: categories nest at most %d levels deep", ErrInvalidCategory, maxCategoryDepth)
+	}
+	return nil
+}
+
+func (s *CategoryService) writeError(err error) error {
+	if errors.Is(err, database.ErrDuplicateCategory) {
+		return ErrCategorySlugTaken
+	}
+	if errors.Is(err, database.ErrCategoryNotFound) {
+		return ErrCategoryNotFound
+	}
+	s.logger.Error("Failed to save category", zap.Error(err))
+	return err
+}
+
+// slugify makes a slug from a category name: "AC & Refrigeration" -> "ac-refrigeration"
+func slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestCategories_SeedIsIdempotentAndBuildsTheTree(t *testing.T) {
+	ctx := context.TODO()
+	categories := services.NewCategoryService(database.NewMemoryDatabase(), nil)
+
+	created, err := categories.Seed(ctx, services.LaunchCategoryTaxonomy)
+	if err != nil || created == 0 {
+		t.Fatalf("seed: %d, %v", created, err)
+	}
+	generator, err := categories.Update(ctx, mustSlug(t, categories, "generator-repair"), services.CategoryInput{Name: strPtr("Generators")})
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if again, err := categories.Seed(ctx, services.LaunchCategoryTaxonomy); err != nil || again != 0 {
+		t.Fatalf("expected a reseed to create nothing, got %d, %v", again, err)
+	}
+
+	tree, err := categories.Tree(ctx, false)
+	if err != nil {
+		t.Fatalf("tree: %v", err)
+	}
+	if len(tree) != len(services.LaunchCategoryTaxonomy) || tree[0].Slug != "plumbing" || len(tree[0].Children) != 4 {
+		t.Fatalf("unexpected tree %+v", tree)
+	}
+	for _, c := range tree {
+		if c.ID == generator.ID && c.Name != "Generators" {
+			t.Fatalf("reseeding must keep admin edits, got %q", c.Name)
+		}
+	}
+
+	// Deactivating a parent hides its subtree and makes its subcategories unusable
+	leak := mustSlug(t, categories, "plumbing-leak-repair")
+	if err := categories.RequireActive(ctx, leak); err != nil {
+		t.Fatalf("expected leak repair to be usable: %v", err)
+	}
+	if _, err := categories.Deactivate(ctx, tree[0].ID); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if err := categories.RequireActive(ctx, leak); !errors.Is(err, services.ErrCategoryInactive) {
+		t.Fatalf("expected the subcategory of an inactive parent to be unusable, got %v", err)
+	}
+	if tree, _ = categories.Tree(ctx, false); len(tree) != len(services.LaunchCategoryTaxonomy)-1 {
+		t.Fatalf("expected plumbing to be hidden, got %d top-level categories", len(tree))
+	}
+	if tree, _ = categories.Tree(ctx, true); len(tree) != len(services.LaunchCategoryTaxonomy) {
+		t.Fatalf("expected admins to see inactive categories, got %d", len(tree))
+	}
+	if err := categories.RequireActive(ctx, primitive.NewObjectID()); !errors.Is(err, services.ErrCategoryNotFound) {
+		t.Fatalf("expected an unknown category to be rejected, got %v", err)
+	}
+}
+
+func TestCategories_ValidatesSlugsColoursAndNesting(t *testing.T) {
+	ctx := context.TODO()
+	categories := services.NewCategoryService(database.NewMemoryDatabase(), nil)
+
+	top, err := categories.Create(ctx, services.CategoryInput{Name: strPtr("AC & Refrigeration"), Color: strPtr("#00BCD4")})
+	if err != nil || top.Slug != "ac-refrigeration" || !top.IsActive {
+		t.Fatalf("create: %+v, %v", top, err)
+	}
+	if _, err := categories.Create(ctx, services.CategoryInput{Name: strPtr("AC and refrigeration"), Slug: strPtr("ac-refrigeration")}); !errors.Is(err, services.ErrCategorySlugTaken) {
+		t.Fatalf("expected a duplicate slug to be rejected, got %v", err)
+	}
+	for _, bad := range []services.CategoryInput{
+		{Name: strPtr(" ")},
+		{Name: strPtr("Tiling"), Slug: strPtr("Tiling Work")},
+		{Name: strPtr("Tiling"), Color: strPtr("blue")},
+		{Name: strPtr("Tiling"), SetParent: true, Parent: &primitive.NilObjectID},
+	} {
+		if _, err := categories.Create(ctx, bad); !errors.Is(err, services.ErrInvalidCategory) {
+			t.Fatalf("expected %+v to be invalid, got %v", bad, err)
+		}
+	}
+
+	mid, err := categories.Create(ctx, services.CategoryInput{Name: strPtr("AC Repair"), SetParent: true, Parent: &top.ID})
+	if err != nil {
+		t.Fatalf("create subcategory: %v", err)
+	}
+	leaf, err := categories.Create(ctx, services.CategoryInput{Name: strPtr("Split Units"), SetParent: true, Parent: &mid.ID})
+	if err != nil {
+		t.Fatalf("create third level: %v", err)
+	}
+	if _, err := categories.Create(ctx, services.CategoryInput{Name: strPtr("Too Deep"), SetParent: true, Parent: &leaf.ID}); !errors.Is(err, services.ErrInvalidCategory) {
+		t.Fatalf("expected a fourth level to be rejected, got %v", err)
+	}
+	if _, err := categories.Update(ctx, top.ID, services.CategoryInput{SetParent: true, Parent: &leaf.ID}); !errors.Is(err, services.ErrInvalidCategory) {
+		t.Fatalf("expected a cycle to be rejected, got %v", err)
+	}
+
+	other, _ := categories.Create(ctx, services.CategoryInput{Name: strPtr("Appliances")})
+	if _, err := categories.Update(ctx, mid.ID, services.CategoryInput{SetParent: true, Parent: &other.ID}); err != nil {
+		t.Fatalf("expected the subtree to move: %v", err)
+	}
+	moved, err := categories.Update(ctx, mid.ID, services.CategoryInput{SetParent: true})
+	if err != nil || moved.ParentID != nil {
+		t.Fatalf("expected the category to move to the top level, got %+v, %v", moved, err)
+	}
+}
+
+func mustSlug(t *testing.T, categories *services.CategoryService, slug string) primitive.ObjectID {
+	t.Helper()
+	tree, err := categories.Tree(context.TODO(), true)
+	if err != nil {
+		t.Fatalf("tree: %v", err)
+	}
+	for _, c := range tree {
+		if c.Slug == slug {
+			return c.ID
+		}
+		for _, child := range c.Children {
+			if child.Slug == slug {
+				return child.ID
+			}
+		}
+	}
+	t.Fatalf("no category %q", slug)
+	return primitive.NilObjectID
+}
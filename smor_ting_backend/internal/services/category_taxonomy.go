@@ -0,0 +1,51 @@
+package services
+
+// LaunchCategoryTaxonomy is the category tree we launched with. It is seeded
+// at startup; icons are the names the mobile home grid maps to its icon set.
+var LaunchCategoryTaxonomy = []CategorySeed{
+	{Name: "Plumbing", Slug: "plumbing", Icon: "plumbing", Color: "#2196F3", Children: []CategorySeed{
+		{Name: "Leak Repair", Slug: "plumbing-leak-repair", Icon: "plumbing", Color: "#2196F3"},
+		{Name: "Pipe Installation", Slug: "plumbing-pipe-installation", Icon: "plumbing", Color: "#2196F3"},
+		{Name: "Toilet & Sink Repair", Slug: "plumbing-toilet-sink", Icon: "plumbing", Color: "#2196F3"},
+		{Name: "Water Pumps & Tanks", Slug: "plumbing-pumps-tanks", Icon: "plumbing", Color: "#2196F3"},
+	}},
+	{Name: "Electrical", Slug: "electrical", Icon: "electrical", Color: "#FF9800", Children: []CategorySeed{
+		{Name: "Wiring & Rewiring", Slug: "electrical-wiring", Icon: "electrical", Color: "#FF9800"},
+		{Name: "Lighting & Fixtures", Slug: "electrical-lighting", Icon: "electrical", Color: "#FF9800"},
+		{Name: "Sockets & Switches", Slug: "electrical-sockets", Icon: "electrical", Color: "#FF9800"},
+		{Name: "Solar Installation", Slug: "electrical-solar", Icon: "solar", Color: "#FF9800"},
+	}},
+	{Name: "Cleaning", Slug: "cleaning", Icon: "cleaning", Color: "#9C27B0", Children: []CategorySeed{
+		{Name: "Home Cleaning", Slug: "cleaning-home", Icon: "cleaning", Color: "#9C27B0"},
+		{Name: "Office Cleaning", Slug: "cleaning-office", Icon: "cleaning", Color: "#9C27B0"},
+		{Name: "Post-Construction Cleaning", Slug: "cleaning-post-construction", Icon: "cleaning", Color: "#9C27B0"},
+		{Name: "Laundry", Slug: "cleaning-laundry", Icon: "laundry", Color: "#9C27B0"},
+	}},
+	{Name: "Carpentry", Slug: "carpentry", Icon: "carpentry", Color: "#8BC34A", Children: []CategorySeed{
+		{Name: "Furniture Making & Repair", Slug: "carpentry-furniture", Icon: "carpentry", Color: "#8BC34A"},
+		{Name: "Doors & Windows", Slug: "carpentry-doors-windows", Icon: "carpentry", Color: "#8BC34A"},
+	}},
+	{Name: "Generator Repair", Slug: "generator-repair", Icon: "generator", Color: "#F44336", Children: []CategorySeed{
+		{Name: "Generator Servicing", Slug: "generator-servicing", Icon: "generator", Color: "#F44336"},
+		{Name: "Generator Installation", Slug: "generator-installation", Icon: "generator", Color: "#F44336"},
+	}},
+	{Name: "AC & Refrigeration", Slug: "ac-refrigeration", Icon: "ac", Color: "#00BCD4", Children: []CategorySeed{
+		{Name: "AC Installation", Slug: "ac-installation", Icon: "ac", Color: "#00BCD4"},
+		{Name: "AC Servicing & Repair", Slug: "ac-repair", Icon: "ac", Color: "#00BCD4"},
+		{Name: "Fridge & Freezer Repair", Slug: "fridge-freezer-repair", Icon: "appliance", Color: "#00BCD4"},
+	}},
+	{Name: "Painting", Slug: "painting", Icon: "painting", Color: "#E91E63"},
+	{Name: "Roofing", Slug: "roofing", Icon: "roofing", Color: "#795548"},
+	{Name: "Masonry & Tiling", Slug: "masonry-tiling", Icon: "masonry", Color: "#9E9E9E"},
+	{Name: "Appliance & Electronics Repair", Slug: "appliance-repair", Icon: "appliance", Color: "#607D8B", Children: []CategorySeed{
+		{Name: "TV Repair", Slug: "appliance-tv-repair", Icon: "appliance", Color: "#607D8B"},
+		{Name: "Phone Repair", Slug: "appliance-phone-repair", Icon: "appliance", Color: "#607D8B"},
+	}},
+	{Name: "Auto Mechanic", Slug: "auto-mechanic", Icon: "mechanic", Color: "#3F51B5"},
+	{Name: "Gardening", Slug: "gardening", Icon: "gardening", Color: "#4CAF50"},
+	{Name: "Beauty & Grooming", Slug: "beauty-grooming", Icon: "beauty", Color: "#FF4081", Children: []CategorySeed{
+		{Name: "Barbering", Slug: "beauty-barbering", Icon: "beauty", Color: "#FF4081"},
+		{Name: "Hair Braiding", Slug: "beauty-hair-braiding", Icon: "beauty", Color: "#FF4081"},
+	}},
+	{Name: "Tailoring", Slug: "tailoring", Icon: "tailoring", Color: "#673AB7"},
+}
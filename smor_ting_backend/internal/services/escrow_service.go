@@ -0,0 +1,589 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEscrowNotPayable    = errors.New("booking cannot be paid into escrow in its current status")
+	ErrEscrowNotDisputable = errors.New("escrow can only be disputed while its release is pending")
+	ErrEscrowNotRefundable = errors.New("escrow holds no funds that can be refunded")
+	ErrEscrowNotDisputed   = errors.New("escrow is not under dispute")
+	ErrInvalidResolution   = errors.New("resolution must be release or refund")
+	ErrInsufficientBalance = errors.New("insufficient wallet balance")
+)
+
+// EscrowService holds booking payments until the job is done. It links a booking
+// to the MoMo hold reference, releases the funds to the provider's wallet once the
+// booking completes and the dispute window has passed, and refunds the customer's
+// wallet when the booking is cancelled. It is driven by booking status changes via
+// OnBookingStatusChange and by hold confirmations from the MoMo webhook.
+type EscrowService struct {
+	store         EscrowStore
+	repo          database.Repository
+	ledger        *WalletLedgerService
+	fees          *FeeService
+	fx            *FXService
+	auditService  *AuditService
+	disputeWindow time.Duration
+	interval      time.Duration
+	logger        *zap.Logger
+	now           func() time.Time
+
+	isRunning bool
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+}
+
+// NewEscrowService creates a new escrow service. A zero disputeWindow releases
+// funds as soon as the booking completes.
+func NewEscrowService(store EscrowStore, repo database.Repository, ledger *WalletLedgerService, auditService *AuditService, disputeWindow, interval time.Duration, logger *zap.Logger) *EscrowService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &EscrowService{
+		store:         store,
+		repo:          repo,
+		ledger:        ledger,
+		auditService:  auditService,
+		disputeWindow: disputeWindow,
+		interval:      interval,
+		logger:        logger,
+		now:           time.Now,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// SetFeeService makes releases deduct the platform's commission and mobile money fee
+func (s *EscrowService) SetFeeService(fees *FeeService) {
+	s.fees = fees
+}
+
+// SetFXService lets bookings be paid from a wallet balance in another currency
+func (s *EscrowService) SetFXService(fx *FXService) {
+	s.fx = fx
+}
+
+// PrepareHold checks that the customer may pay the booking into escrow and returns it
+func (s *EscrowService) PrepareHold(ctx context.Context, customer *models.User, bookingID primitive.ObjectID) (*models.Booking, error) {
+	booking, err := s.repo.GetBookingByID(ctx, bookingID)
+	if err != nil || booking.CustomerID != customer.ID {
+		return nil, ErrBookingNotFound
+	}
+	if booking.Status != models.BookingPending && booking.Status != models.BookingConfirmed {
+		return nil, ErrEscrowNotPayable
+	}
+	if existing, err := s.store.GetByBooking(ctx, bookingID); err == nil && escrowIsOpen(existing.Status) {
+		return nil, ErrEscrowExists
+	}
+	return booking, nil
+}
+
+// Link records that the request-to-pay identified by reference funds the booking
+func (s *EscrowService) Link(ctx context.Context, booking *models.Booking, reference string) (*models.Escrow, error) {
+	escrow := &models.Escrow{
+		BookingID:     booking.ID,
+		CustomerID:    booking.CustomerID,
+		ProviderID:    booking.ProviderID,
+		HoldReference: reference,
+		Amount:        booking.TotalAmount,
+		Currency:      booking.Currency,
+		Status:        models.EscrowAwaitingFunds,
+	}
+	if err := s.store.Create(ctx, escrow); err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// PayFromWallet funds a booking's escrow from the customer's available balance
+// in currency (the booking's own when empty). Paying in another currency needs
+// an unexpired quote from FXService.QuoteBooking; the conversion is posted
+// through the platform's FX account at the quoted rate. Refunds of the escrow
+// are made in the booking's currency. The balance check and the hold run under
+// the customer's wallet lock.
+func (s *EscrowService) PayFromWallet(ctx context.Context, customer *models.User, bookingID primitive.ObjectID, currency string, quoteID *primitive.ObjectID) (*models.Escrow, error) {
+	var escrow *models.Escrow
+	err := s.ledger.WithWalletLock(ctx, customer.ID, func(ctx context.Context) error {
+		var err error
+		escrow, err = s.payFromWallet(ctx, customer, bookingID, currency, quoteID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+func (s *EscrowService) payFromWallet(ctx context.Context, customer *models.User, bookingID primitive.ObjectID, currency string, quoteID *primitive.ObjectID) (*models.Escrow, error) {
+	booking, err := s.PrepareHold(ctx, customer, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	price, _ := models.NormalizeCurrency(booking.Currency)
+	if currency == "" {
+		currency = price
+	}
+	currency, ok := models.NormalizeCurrency(currency)
+	if !ok {
+		return nil, models.ErrUnsupportedCurrency
+	}
+	charge := roundMinor(booking.TotalAmount)
+	var quote *models.FXQuote
+	if currency != price {
+		if s.fx == nil || quoteID == nil {
+			return nil, ErrFXQuoteRequired
+		}
+		if quote, err = s.fx.checkQuote(ctx, customer, *quoteID, booking, currency); err != nil {
+			return nil, err
+		}
+		charge = quote.FromAmount
+	}
+	spendable, err := s.ledger.Spendable(ctx, customer.ID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if spendable < charge {
+		return nil, ErrInsufficientBalance
+	}
+
+	ref := "wallet_" + NewMomoReferenceID()
+	if quote != nil {
+		if err := s.fx.useQuote(ctx, quote, ref); err != nil {
+			return nil, err
+		}
+	}
+	escrow, err := s.Link(ctx, booking, ref)
+	if err != nil {
+		return nil, err
+	}
+	tx := &models.LedgerTransaction{
+		IdempotencyKey: "escrow_hold:" + ref,
+		Type:           models.LedgerEscrowHold,
+		Reference:      ref,
+		Description:    "Booking " + booking.ID.Hex(),
+	}
+	if quote == nil {
+		tx.Debit(models.UserAvailableAccount(customer.ID), charge, currency).
+			Credit(models.UserEscrowAccount(customer.ID), charge, currency)
+	} else {
+		tx.Debit(models.UserAvailableAccount(customer.ID), quote.FromAmount, quote.From).
+			Credit(models.FXConversionAccount, quote.FromAmount, quote.From).
+			Debit(models.FXConversionAccount, quote.ToAmount, quote.To).
+			Credit(models.UserEscrowAccount(customer.ID), quote.ToAmount, quote.To)
+	}
+	if err := s.ledger.Post(ctx, tx); err != nil {
+		if markErr := s.MarkFailed(ctx, ref); markErr != nil {
+			s.logger.Error("Failed to release escrow link", zap.Error(markErr), zap.String("reference", ref))
+		}
+		return nil, err
+	}
+	if err := s.MarkFunded(ctx, ref); err != nil {
+		return nil, err
+	}
+	return s.store.GetByReference(ctx, escrow.HoldReference)
+}
+
+// Get returns the latest escrow for a booking
+func (s *EscrowService) Get(ctx context.Context, bookingID primitive.ObjectID) (*models.Escrow, error) {
+	return s.store.GetByBooking(ctx, bookingID)
+}
+
+// MarkFunded is called once MoMo confirms the hold. If the booking moved on while
+// the payment was in flight the escrow is settled straight away.
+func (s *EscrowService) MarkFunded(ctx context.Context, reference string) error {
+	escrow, err := s.store.GetByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	switch escrow.Status {
+	case models.EscrowAwaitingFunds:
+		escrow.Status = models.EscrowHeld
+		if err := s.store.Update(ctx, escrow, models.EscrowAwaitingFunds); err != nil {
+			return err
+		}
+		s.audit(ctx, ActionEscrowHold, escrow, nil)
+	case models.EscrowCancelled:
+		// Booking was cancelled before the money arrived: hand it straight back
+		return s.refund(ctx, escrow, models.EscrowCancelled)
+	default:
+		// Duplicate confirmation
+		return nil
+	}
+
+	booking, err := s.repo.GetBookingByID(ctx, escrow.BookingID)
+	if err != nil {
+		return err
+	}
+	switch booking.Status {
+	case models.BookingCompleted:
+		return s.scheduleRelease(ctx, escrow)
+	case models.BookingCancelled:
+		return s.refund(ctx, escrow, models.EscrowHeld)
+	}
+	return nil
+}
+
+// MarkFailed records that the hold payment failed so the customer may retry
+func (s *EscrowService) MarkFailed(ctx context.Context, reference string) error {
+	escrow, err := s.store.GetByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	if escrow.Status != models.EscrowAwaitingFunds {
+		return nil
+	}
+	escrow.Status = models.EscrowFailed
+	return s.store.Update(ctx, escrow, models.EscrowAwaitingFunds)
+}
+
+// OnBookingStatusChange is registered with BookingService.OnStatusChange
+func (s *EscrowService) OnBookingStatusChange(ctx context.Context, booking *models.Booking, previous models.BookingStatus) {
+	escrow, err := s.store.GetByBooking(ctx, booking.ID)
+	if err != nil {
+		if !errors.Is(err, ErrEscrowNotFound) {
+			s.logger.Error("Failed to load escrow for booking", zap.Error(err), zap.String("booking_id", booking.ID.Hex()))
+		}
+		return
+	}
+
+	switch booking.Status {
+	case models.BookingCompleted:
+		if escrow.Status == models.EscrowHeld {
+			err = s.scheduleRelease(ctx, escrow)
+		}
+	case models.BookingCancelled:
+		switch escrow.Status {
+		case models.EscrowHeld:
+			err = s.refund(ctx, escrow, models.EscrowHeld)
+		case models.EscrowAwaitingFunds:
+			escrow.Status = models.EscrowCancelled
+			err = s.store.Update(ctx, escrow, models.EscrowAwaitingFunds)
+		}
+	}
+	if err != nil {
+		s.logger.Error("Failed to settle escrow after booking status change",
+			zap.Error(err),
+			zap.String("booking_id", booking.ID.Hex()),
+			zap.String("booking_status", string(booking.Status)),
+		)
+	}
+}
+
+// Dispute halts a pending release; only the booking's customer (or an admin) may raise it
+func (s *EscrowService) Dispute(ctx context.Context, actor *models.User, bookingID primitive.ObjectID, reason string) (*models.Escrow, error) {
+	escrow, err := s.store.GetByBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.AdminRole && actor.ID != escrow.CustomerID {
+		return nil, ErrBookingForbidden
+	}
+	if escrow.Status != models.EscrowReleasePending {
+		return nil, ErrEscrowNotDisputable
+	}
+	escrow.Status = models.EscrowDisputed
+	if err := s.store.Update(ctx, escrow, models.EscrowReleasePending); err != nil {
+		if errors.Is(err, ErrEscrowStateChanged) {
+			return nil, ErrEscrowNotDisputable
+		}
+		return nil, err
+	}
+	s.audit(ctx, ActionEscrowDispute, escrow, map[string]interface{}{"raised_by": actor.ID.Hex(), "reason": reason})
+	return escrow, nil
+}
+
+// DisputeResolution is how an admin settles a disputed escrow
+type DisputeResolution string
+
+const (
+	ResolveRelease DisputeResolution = "release" // pay the provider what is left
+	ResolveRefund  DisputeResolution = "refund"  // return what is left to the customer
+)
+
+// Resolve settles a disputed escrow by releasing it to the provider or refunding
+// the customer; only an admin may resolve a dispute
+func (s *EscrowService) Resolve(ctx context.Context, admin *models.User, bookingID primitive.ObjectID, resolution DisputeResolution, note string) (*models.Escrow, error) {
+	if admin.Role != models.AdminRole {
+		return nil, ErrBookingForbidden
+	}
+	escrow, err := s.store.GetByBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.Status != models.EscrowDisputed {
+		return nil, ErrEscrowNotDisputed
+	}
+	switch resolution {
+	case ResolveRelease:
+		err = s.release(ctx, escrow, models.EscrowDisputed)
+	case ResolveRefund:
+		err = s.refund(ctx, escrow, models.EscrowDisputed)
+	default:
+		return nil, ErrInvalidResolution
+	}
+	if errors.Is(err, ErrEscrowStateChanged) {
+		return nil, ErrEscrowNotDisputed
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, ActionEscrowResolve, escrow, map[string]interface{}{"resolved_by": admin.ID.Hex(), "resolution": string(resolution), "note": note})
+	return escrow, nil
+}
+
+// Refund returns part of a held escrow to the customer's wallet; the provider is
+// later paid only what remains. Refunding everything that is left settles the
+// escrow as refunded. key identifies the refund so a retried call posts once.
+func (s *EscrowService) Refund(ctx context.Context, bookingID primitive.ObjectID, amount float64, key, reason string) (*models.Escrow, error) {
+	escrow, err := s.store.GetByBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	from := escrow.Status
+	switch from {
+	case models.EscrowHeld, models.EscrowReleasePending, models.EscrowDisputed:
+	default:
+		return nil, ErrEscrowNotRefundable
+	}
+	amount = roundMinor(amount)
+	if amount <= 0 || amount > escrow.Outstanding() {
+		return nil, ErrRefundAmountExceeded
+	}
+
+	escrow.RefundedAmount = roundMinor(escrow.RefundedAmount + amount)
+	if escrow.Outstanding() == 0 {
+		settledAt := s.now()
+		escrow.Status = models.EscrowRefunded
+		escrow.SettledAt = &settledAt
+	}
+	if err := s.store.Update(ctx, escrow, from); err != nil {
+		return nil, err
+	}
+
+	tx := &models.LedgerTransaction{
+		IdempotencyKey: "escrow_refund:" + escrow.ID.Hex() + ":" + key,
+		Type:           models.LedgerEscrowRefund,
+		Reference:      escrow.HoldReference,
+		Description:    "Partial refund for booking " + escrow.BookingID.Hex(),
+	}
+	tx.Debit(models.UserEscrowAccount(escrow.CustomerID), amount, escrow.Currency).
+		Credit(models.UserAvailableAccount(escrow.CustomerID), amount, escrow.Currency)
+	if err := s.ledger.Post(ctx, tx); err != nil {
+		claimed := escrow.Status
+		escrow.Status = from
+		escrow.SettledAt = nil
+		escrow.RefundedAmount = roundMinor(escrow.RefundedAmount - amount)
+		if rbErr := s.store.Update(ctx, escrow, claimed); rbErr != nil {
+			s.logger.Error("Failed to roll back escrow refund", zap.Error(rbErr), zap.String("escrow_id", escrow.ID.Hex()))
+		}
+		return nil, err
+	}
+	s.audit(ctx, ActionEscrowRefund, escrow, map[string]interface{}{"refund_amount": amount, "reason": reason, "refund_key": key})
+	return escrow, nil
+}
+
+// ReleaseDue pays out every escrow whose dispute window has passed and returns how many were released
+func (s *EscrowService) ReleaseDue(ctx context.Context) (int, error) {
+	due, err := s.store.ListDueReleases(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+	released := 0
+	for i := range due {
+		if err := s.release(ctx, &due[i], models.EscrowReleasePending); err != nil {
+			if !errors.Is(err, ErrEscrowStateChanged) {
+				s.logger.Error("Failed to release escrow", zap.Error(err), zap.String("escrow_id", due[i].ID.Hex()))
+			}
+			continue
+		}
+		released++
+	}
+	return released, nil
+}
+
+// Start runs ReleaseDue on a ticker until Stop is called or ctx is cancelled
+func (s *EscrowService) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isRunning {
+		return fmt.Errorf("escrow release worker is already running")
+	}
+	s.isRunning = true
+	s.wg.Add(1)
+	go s.run(ctx)
+	s.logger.Info("Escrow release worker started", zap.Duration("interval", s.interval), zap.Duration("dispute_window", s.disputeWindow))
+	return nil
+}
+
+// Stop stops the release worker
+func (s *EscrowService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isRunning {
+		return fmt.Errorf("escrow release worker is not running")
+	}
+	close(s.stopChan)
+	s.wg.Wait()
+	s.isRunning = false
+	s.logger.Info("Escrow release worker stopped")
+	return nil
+}
+
+func (s *EscrowService) run(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if n, err := s.ReleaseDue(ctx); err != nil {
+				s.logger.Error("Escrow release run failed", zap.Error(err))
+			} else if n > 0 {
+				s.logger.Info("Released escrows", zap.Int("count", n))
+			}
+		}
+	}
+}
+
+// scheduleRelease starts the dispute window for a held escrow, or releases immediately when there is none
+func (s *EscrowService) scheduleRelease(ctx context.Context, escrow *models.Escrow) error {
+	if s.disputeWindow <= 0 {
+		return s.release(ctx, escrow, models.EscrowHeld)
+	}
+	releaseAt := s.now().Add(s.disputeWindow)
+	escrow.Status = models.EscrowReleasePending
+	escrow.ReleaseAt = &releaseAt
+	return s.store.Update(ctx, escrow, models.EscrowHeld)
+}
+
+// release claims the escrow first so it can never be paid twice, then moves the
+// funds; if the ledger write fails the claim is rolled back for the next run and
+// the idempotency key keeps a retried posting from landing twice
+func (s *EscrowService) release(ctx context.Context, escrow *models.Escrow, from models.EscrowStatus) error {
+	fees, err := s.releaseFees(ctx, escrow)
+	if err != nil {
+		return err
+	}
+	settledAt := s.now()
+	escrow.Status = models.EscrowReleased
+	escrow.SettledAt = &settledAt
+	escrow.Fees = fees
+	if err := s.store.Update(ctx, escrow, from); err != nil {
+		return err
+	}
+
+	// One balanced transfer from the customer's escrow account to the provider's
+	// wallet, with the platform's commission and mobile money fee as separate lines
+	tx := &models.LedgerTransaction{
+		IdempotencyKey: "escrow_release:" + escrow.ID.Hex(),
+		Type:           models.LedgerEscrowRelease,
+		Reference:      escrow.HoldReference,
+		Description:    "Booking " + escrow.BookingID.Hex(),
+	}
+	tx.Debit(models.UserEscrowAccount(escrow.CustomerID), fees.Gross, escrow.Currency)
+	if fees.Net > 0 {
+		tx.Credit(models.UserAvailableAccount(escrow.ProviderID), fees.Net, escrow.Currency)
+	}
+	if fees.Commission > 0 {
+		tx.Credit(models.PlatformFeesAccount, fees.Commission, escrow.Currency).Memo(models.LedgerMemoCommission)
+	}
+	if fees.MomoFee > 0 {
+		tx.Credit(models.PlatformFeesAccount, fees.MomoFee, escrow.Currency).Memo(models.LedgerMemoMomoFee)
+	}
+	if err := s.ledger.Post(ctx, tx); err != nil {
+		escrow.Fees = nil
+		s.rollback(ctx, escrow, from)
+		return err
+	}
+	s.audit(ctx, ActionEscrowRelease, escrow, map[string]interface{}{
+		"commission": fees.Commission,
+		"momo_fee":   fees.MomoFee,
+		"net":        fees.Net,
+	})
+	return nil
+}
+
+// releaseFees splits what is left in escrow between the provider and the
+// platform according to the booked service's category
+func (s *EscrowService) releaseFees(ctx context.Context, escrow *models.Escrow) (*models.FeeBreakdown, error) {
+	gross := escrow.Outstanding()
+	if s.fees == nil {
+		return &models.FeeBreakdown{Gross: gross, Net: gross, Currency: escrow.Currency}, nil
+	}
+	booking, err := s.repo.GetBookingByID(ctx, escrow.BookingID)
+	if err != nil {
+		return nil, err
+	}
+	return s.fees.Quote(ctx, booking.Service.CategoryID, gross, escrow.Currency)
+}
+
+// refund returns the funds still held to the customer's wallet
+func (s *EscrowService) refund(ctx context.Context, escrow *models.Escrow, from models.EscrowStatus) error {
+	settledAt := s.now()
+	escrow.Status = models.EscrowRefunded
+	escrow.SettledAt = &settledAt
+	if err := s.store.Update(ctx, escrow, from); err != nil {
+		return err
+	}
+
+	tx := &models.LedgerTransaction{
+		IdempotencyKey: "escrow_refund:" + escrow.ID.Hex(),
+		Type:           models.LedgerEscrowRefund,
+		Reference:      escrow.HoldReference,
+		Description:    "Booking " + escrow.BookingID.Hex(),
+	}
+	tx.Debit(models.UserEscrowAccount(escrow.CustomerID), escrow.Outstanding(), escrow.Currency).
+		Credit(models.UserAvailableAccount(escrow.CustomerID), escrow.Outstanding(), escrow.Currency)
+	err := s.ledger.Post(ctx, tx)
+	if err != nil {
+		s.rollback(ctx, escrow, from)
+		return err
+	}
+	s.audit(ctx, ActionEscrowRefund, escrow, nil)
+	return nil
+}
+
+func (s *EscrowService) rollback(ctx context.Context, escrow *models.Escrow, to models.EscrowStatus) {
+	claimed := escrow.Status
+	escrow.Status = to
+	escrow.SettledAt = nil
+	if err := s.store.Update(ctx, escrow, claimed); err != nil {
+		s.logger.Error("Failed to roll back escrow claim", zap.Error(err), zap.String("escrow_id", escrow.ID.Hex()))
+	}
+}
+
+func (s *EscrowService) audit(ctx context.Context, action AuditAction, escrow *models.Escrow, extra map[string]interface{}) {
+	details := map[string]interface{}{
+		"escrow_id":   escrow.ID.Hex(),
+		"booking_id":  escrow.BookingID.Hex(),
+		"customer_id": escrow.CustomerID.Hex(),
+		"provider_id": escrow.ProviderID.Hex(),
+		"amount":      escrow.Amount,
+		"currency":    escrow.Currency,
+	}
+	for k, v := range extra {
+		details[k] = v
+	}
+	_ = s.auditService.LogSystemAction(ctx, action, "escrow", details)
+}
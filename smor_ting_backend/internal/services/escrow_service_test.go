@@ -0,0 +1,255 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type escrowFixture struct {
+	repo     *database.MemoryDatabase
+	ledger   *services.WalletLedgerService
+	bookings *services.BookingService
+	escrow   *services.EscrowService
+	customer *models.User
+	provider *models.User
+}
+
+func newEscrowFixture(t *testing.T, window time.Duration) *escrowFixture {
+	t.Helper()
+	repo := database.NewMemoryDatabase()
+	f := &escrowFixture{
+		repo:     repo,
+		ledger:   services.NewWalletLedgerService(repo),
+		bookings: services.NewBookingService(repo, nil),
+		customer: &models.User{Email: "customer@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}},
+		provider: &models.User{Email: "provider@example.com", Role: models.ProviderRole, Wallet: models.Wallet{Currency: "USD"}},
+	}
+	f.escrow = services.NewEscrowService(services.NewMemoryEscrowStore(), repo, f.ledger, nil, window, time.Minute, nil)
+	f.bookings.OnStatusChange(f.escrow.OnBookingStatusChange)
+	for _, u := range []*models.User{f.customer, f.provider} {
+		if err := repo.CreateUser(context.TODO(), u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return f
+}
+
+// book books a 150 USD service without paying for it
+func (f *escrowFixture) book(t *testing.T) *models.Booking {
+	t.Helper()
+	ctx := context.TODO()
+	svc := &models.Service{Name: "Painting", ProviderID: f.provider.ID, Price: 150, Currency: "USD", IsActive: true}
+	if err := f.repo.CreateService(ctx, svc); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	booking := &models.Booking{ServiceID: svc.ID, ScheduledDate: openSlot(t, f.repo, svc)}
+	if err := f.bookings.Create(ctx, f.customer, booking); err != nil {
+		t.Fatalf("create booking: %v", err)
+	}
+	return booking
+}
+
+// fundedBooking books a 150 USD service and confirms the MoMo hold the way the webhook would
+func (f *escrowFixture) fundedBooking(t *testing.T, ref string) *models.Booking {
+	t.Helper()
+	ctx := context.TODO()
+	booking := f.book(t)
+	if _, err := f.escrow.PrepareHold(ctx, f.customer, booking.ID); err != nil {
+		t.Fatalf("prepare hold: %v", err)
+	}
+	if _, err := f.escrow.Link(ctx, booking, ref); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	_ = f.ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerEscrowHold, Direction: models.LedgerCredit, Amount: 150, Currency: "USD", Status: models.LedgerHeld, IsEscrow: true, Reference: ref})
+	if err := f.escrow.MarkFunded(ctx, ref); err != nil {
+		t.Fatalf("mark funded: %v", err)
+	}
+	return booking
+}
+
+func (f *escrowFixture) advance(t *testing.T, id primitive.ObjectID, statuses ...models.BookingStatus) {
+	t.Helper()
+	for _, next := range statuses {
+		if _, _, err := f.bookings.UpdateStatus(context.TODO(), f.provider, id, next); err != nil {
+			t.Fatalf("move to %s: %v", next, err)
+		}
+	}
+}
+
+func (f *escrowFixture) balances(t *testing.T, u *models.User) *models.WalletBalances {
+	t.Helper()
+	bal, err := f.ledger.ComputeBalances(context.TODO(), u.ID)
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	return bal
+}
+
+func TestEscrow_ReleasesToProviderOnCompletion(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	booking := f.fundedBooking(t, "hold-1")
+	if bal := f.balances(t, f.customer); bal.PendingHeld != 150 {
+		t.Fatalf("customer should have 150 held, got %+v", bal)
+	}
+
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+
+	escrow, _ := f.escrow.Get(context.TODO(), booking.ID)
+	if escrow.Status != models.EscrowReleased {
+		t.Fatalf("expected released escrow, got %s", escrow.Status)
+	}
+	if bal := f.balances(t, f.provider); bal.Available != 150 {
+		t.Fatalf("provider should be credited 150, got %+v", bal)
+	}
+	if bal := f.balances(t, f.customer); bal.PendingHeld != 0 || bal.Available != 0 {
+		t.Fatalf("customer hold should be settled without credit, got %+v", bal)
+	}
+
+	// A duplicate hold confirmation must not pay twice
+	_ = f.escrow.MarkFunded(context.TODO(), "hold-1")
+	if bal := f.balances(t, f.provider); bal.Available != 150 {
+		t.Fatalf("duplicate callback paid provider again: %+v", bal)
+	}
+}
+
+func TestEscrow_DisputeWindowDelaysRelease(t *testing.T) {
+	f := newEscrowFixture(t, 20*time.Millisecond)
+	booking := f.fundedBooking(t, "hold-2")
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+
+	if n, _ := f.escrow.ReleaseDue(context.TODO()); n != 0 {
+		t.Fatalf("nothing should be released inside the dispute window, released %d", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := f.escrow.ReleaseDue(context.TODO()); n != 1 {
+		t.Fatalf("expected 1 release after the window, got %d", n)
+	}
+	if n, _ := f.escrow.ReleaseDue(context.TODO()); n != 0 {
+		t.Fatalf("release must not repeat, got %d", n)
+	}
+	if bal := f.balances(t, f.provider); bal.Available != 150 {
+		t.Fatalf("provider should be credited once, got %+v", bal)
+	}
+}
+
+func TestEscrow_DisputeHaltsRelease(t *testing.T) {
+	f := newEscrowFixture(t, 10*time.Millisecond)
+	booking := f.fundedBooking(t, "hold-3")
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+
+	if _, err := f.escrow.Dispute(context.TODO(), f.provider, booking.ID, "not me"); err != services.ErrBookingForbidden {
+		t.Fatalf("provider dispute expected forbidden, got %v", err)
+	}
+	if _, err := f.escrow.Dispute(context.TODO(), f.customer, booking.ID, "leaking pipe"); err != nil {
+		t.Fatalf("dispute: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n, _ := f.escrow.ReleaseDue(context.TODO()); n != 0 {
+		t.Fatalf("disputed escrow must not be released, released %d", n)
+	}
+}
+
+func TestEscrow_AdminResolvesDispute(t *testing.T) {
+	ctx := context.TODO()
+	admin := &models.User{Role: models.AdminRole}
+	for _, tc := range []struct {
+		resolution       services.DisputeResolution
+		status           models.EscrowStatus
+		customer, worker float64
+	}{
+		{services.ResolveRelease, models.EscrowReleased, 0, 150},
+		{services.ResolveRefund, models.EscrowRefunded, 150, 0},
+	} {
+		f := newEscrowFixture(t, time.Hour)
+		booking := f.fundedBooking(t, "hold-"+string(tc.resolution))
+		f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+
+		if _, err := f.escrow.Resolve(ctx, admin, booking.ID, tc.resolution, ""); !errors.Is(err, services.ErrEscrowNotDisputed) {
+			t.Fatalf("only a disputed escrow can be resolved, got %v", err)
+		}
+		if _, err := f.escrow.Dispute(ctx, f.customer, booking.ID, "unfinished"); err != nil {
+			t.Fatalf("dispute: %v", err)
+		}
+		if _, err := f.escrow.Resolve(ctx, f.customer, booking.ID, tc.resolution, ""); !errors.Is(err, services.ErrBookingForbidden) {
+			t.Fatalf("the customer cannot resolve their own dispute, got %v", err)
+		}
+		if _, err := f.escrow.Resolve(ctx, admin, booking.ID, "split", ""); !errors.Is(err, services.ErrInvalidResolution) {
+			t.Fatalf("expected an unknown resolution to be refused, got %v", err)
+		}
+		escrow, err := f.escrow.Resolve(ctx, admin, booking.ID, tc.resolution, "checked the photos")
+		if err != nil || escrow.Status != tc.status {
+			t.Fatalf("expected %s, got %+v, %v", tc.status, escrow, err)
+		}
+		if c, p := f.balances(t, f.customer), f.balances(t, f.provider); c.Available != tc.customer || c.PendingHeld != 0 || p.Available != tc.worker {
+			t.Fatalf("%s: unexpected balances customer %+v provider %+v", tc.resolution, c, p)
+		}
+		if _, err := f.escrow.Resolve(ctx, admin, booking.ID, tc.resolution, ""); !errors.Is(err, services.ErrEscrowNotDisputed) {
+			t.Fatalf("a settled dispute cannot be resolved again, got %v", err)
+		}
+	}
+}
+
+func TestEscrow_RefundsCustomerOnCancel(t *testing.T) {
+	f := newEscrowFixture(t, time.Hour)
+	booking := f.fundedBooking(t, "hold-4")
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingCancelled)
+
+	escrow, _ := f.escrow.Get(context.TODO(), booking.ID)
+	if escrow.Status != models.EscrowRefunded {
+		t.Fatalf("expected refunded escrow, got %s", escrow.Status)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 150 || bal.PendingHeld != 0 {
+		t.Fatalf("customer should get 150 back, got %+v", bal)
+	}
+}
+
+func TestEscrow_LateFundingAfterCancelIsRefunded(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	svc := &models.Service{Name: "Cleaning", ProviderID: f.provider.ID, Price: 80, Currency: "USD", IsActive: true}
+	_ = f.repo.CreateService(ctx, svc)
+	booking := &models.Booking{ServiceID: svc.ID, ScheduledDate: openSlot(t, f.repo, svc)}
+	_ = f.bookings.Create(ctx, f.customer, booking)
+	if _, err := f.escrow.Link(ctx, booking, "hold-5"); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	if _, _, err := f.bookings.UpdateStatus(ctx, f.customer, booking.ID, models.BookingCancelled); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := f.escrow.MarkFunded(ctx, "hold-5"); err != nil {
+		t.Fatalf("mark funded: %v", err)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 80 {
+		t.Fatalf("late hold should be refunded, got %+v", bal)
+	}
+}
+
+func TestPayFromWallet_PendingPayoutsAreNotSpendable(t *testing.T) {
+	ctx := context.TODO()
+	f := newEscrowFixture(t, 0)
+	booking := f.book(t)
+	_ = f.ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 200, Currency: "USD", Status: models.LedgerCompleted, Reference: "topup-spend"})
+	withdrawal := &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerWithdraw, Direction: models.LedgerDebit, Amount: 100, Currency: "USD", Reference: "withdraw-spend"}
+	if err := f.ledger.RecordIntent(ctx, withdrawal); err != nil {
+		t.Fatalf("record withdrawal: %v", err)
+	}
+
+	// 100 of the 200 is already on its way to the customer's phone
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "", nil); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("a pending withdrawal must not be spent again, got %v", err)
+	}
+	if err := f.ledger.SettleIntent(ctx, withdrawal, models.LedgerFailed); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "", nil); err != nil {
+		t.Fatalf("the failed withdrawal frees the money: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrEscrowNotFound     = errors.New("escrow not found")
+	ErrEscrowExists       = errors.New("booking already has an active escrow")
+	ErrEscrowStateChanged = errors.New("escrow status changed concurrently")
+)
+
+// EscrowStore persists escrow records. Update is a compare-and-set on Status and
+// Version so that concurrent webhooks, status changes, refunds and the release
+// worker cannot settle the same escrow twice or write back a stale copy.
+type EscrowStore interface {
+	Create(ctx context.Context, escrow *models.Escrow) error
+	GetByBooking(ctx context.Context, bookingID primitive.ObjectID) (*models.Escrow, error)
+	GetByReference(ctx context.Context, reference string) (*models.Escrow, error)
+	// Update replaces the escrow if its stored status is still from and it has not
+	// been updated since it was read, otherwise returns ErrEscrowStateChanged.
+	// On success escrow.Version is advanced.
+	Update(ctx context.Context, escrow *models.Escrow, from models.EscrowStatus) error
+	// ListDueReleases returns release_pending escrows whose ReleaseAt is at or before now
+	ListDueReleases(ctx context.Context, now time.Time) ([]models.Escrow, error)
+}
+
+// escrowIsOpen reports whether an escrow still blocks a new hold for the same booking
+func escrowIsOpen(status models.EscrowStatus) bool {
+	return status != models.EscrowCancelled && status != models.EscrowFailed
+}
+
+// In-memory implementation for tests/dev
+type memoryEscrowStore struct {
+	mu      sync.RWMutex
+	escrows map[primitive.ObjectID]*models.Escrow
+}
+
+func NewMemoryEscrowStore() EscrowStore {
+	return &memoryEscrowStore{escrows: make(map[primitive.ObjectID]*models.Escrow)}
+}
+
+func (m *memoryEscrowStore) Create(ctx context.Context, escrow *models.Escrow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.escrows {
+		if e.BookingID == escrow.BookingID && escrowIsOpen(e.Status) {
+			return ErrEscrowExists
+		}
+	}
+	if escrow.ID.IsZero() {
+		escrow.ID = primitive.NewObjectID()
+	}
+	escrow.CreatedAt = time.Now()
+	escrow.UpdatedAt = escrow.CreatedAt
+	cp := *escrow
+	m.escrows[escrow.ID] = &cp
+	return nil
+}
+
+func (m *memoryEscrowStore) GetByBooking(ctx context.Context, bookingID primitive.ObjectID) (*models.Escrow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var latest *models.Escrow
+	for _, e := range m.escrows {
+		if e.BookingID == bookingID && (latest == nil || e.CreatedAt.After(latest.CreatedAt)) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil, ErrEscrowNotFound
+	}
+	cp := *latest
+	return &cp, nil
+}
+
+func (m *memoryEscrowStore) GetByReference(ctx context.Context, reference string) (*models.Escrow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.escrows {
+		if e.HoldReference == reference {
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, ErrEscrowNotFound
+}
+
+func (m *memoryEscrowStore) Update(ctx context.Context, escrow *models.Escrow, from models.EscrowStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.escrows[escrow.ID]
+	if !ok {
+		return ErrEscrowNotFound
+	}
+	if stored.Status != from || stored.Version != escrow.Version {
+		return ErrEscrowStateChanged
+	}
+	escrow.UpdatedAt = time.Now()
+	escrow.Version++
+	cp := *escrow
+	m.escrows[escrow.ID] = &cp
+	return nil
+}
+
+func (m *memoryEscrowStore) ListDueReleases(ctx context.Context, now time.Time) ([]models.Escrow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.Escrow
+	for _, e := range m.escrows {
+		if e.Status == models.EscrowReleasePending && e.ReleaseAt != nil && !e.ReleaseAt.After(now) {
+			out = append(out, *e)
+		}
+	}
+	return out, nil
+}
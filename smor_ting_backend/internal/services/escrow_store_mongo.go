@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// oneOpenEscrowPerBooking is the unique index that lets a booking have only one
+// escrow that is not cancelled or failed
+const oneOpenEscrowPerBooking = "one_open_per_booking"
+
+// openEscrowStatuses are the statuses escrowIsOpen accepts
+var openEscrowStatuses = []models.EscrowStatus{
+	models.EscrowAwaitingFunds,
+	models.EscrowHeld,
+	models.EscrowReleasePending,
+	models.EscrowDisputed,
+	models.EscrowReleased,
+	models.EscrowRefunded,
+}
+
+// MongoEscrowStore persists escrow records in the escrows collection
+type MongoEscrowStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoEscrowStore(db *mongo.Database, logger *logger.Logger) (*MongoEscrowStore, error) {
+	s := &MongoEscrowStore{coll: db.Collection("escrows"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hold_reference", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "booking_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "release_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "booking_id", Value: 1}},
+			Options: options.Index().SetName(oneOpenEscrowPerBooking).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": bson.M{"$in": openEscrowStatuses}}),
+		},
+	})
+	return s, nil
+}
+
+// Create relies on the one_open_per_booking index, so two concurrent holds for
+// the same booking cannot both be inserted
+func (m *MongoEscrowStore) Create(ctx context.Context, escrow *models.Escrow) error {
+	if escrow.ID.IsZero() {
+		escrow.ID = primitive.NewObjectID()
+	}
+	escrow.CreatedAt = time.Now()
+	escrow.UpdatedAt = escrow.CreatedAt
+	_, err := m.coll.InsertOne(ctx, escrow)
+	if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), oneOpenEscrowPerBooking) {
+		return ErrEscrowExists
+	}
+	return err
+}
+
+func (m *MongoEscrowStore) GetByBooking(ctx context.Context, bookingID primitive.ObjectID) (*models.Escrow, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	return m.findOne(ctx, bson.M{"booking_id": bookingID}, opts)
+}
+
+func (m *MongoEscrowStore) GetByReference(ctx context.Context, reference string) (*models.Escrow, error) {
+	return m.findOne(ctx, bson.M{"hold_reference": reference})
+}
+
+func (m *MongoEscrowStore) Update(ctx context.Context, escrow *models.Escrow, from models.EscrowStatus) error {
+	filter := bson.M{"_id": escrow.ID, "status": from, "version": escrow.Version}
+	if escrow.Version == 0 {
+		// Escrows written before versioning have no version field
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	next := *escrow
+	next.UpdatedAt = time.Now()
+	next.Version++
+	res, err := m.coll.ReplaceOne(ctx, filter, &next)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.findOne(ctx, bson.M{"_id": escrow.ID}); err != nil {
+			return err
+		}
+		return ErrEscrowStateChanged
+	}
+	*escrow = next
+	return nil
+}
+
+func (m *MongoEscrowStore) ListDueReleases(ctx context.Context, now time.Time) ([]models.Escrow, error) {
+	cur, err := m.coll.Find(ctx, bson.M{
+		"status":     models.EscrowReleasePending,
+		"release_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.Escrow
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *MongoEscrowStore) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*models.Escrow, error) {
+	var out models.Escrow
+	if err := m.coll.FindOne(ctx, filter, opts...).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrEscrowNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/smorting/backend/internal/models"
+)
+
+var ErrFeeScheduleNotFound = errors.New("no fee schedule saved")
+
+// FeeScheduleStore keeps the current fee schedule; saving replaces it
+type FeeScheduleStore interface {
+	Get(ctx context.Context) (*models.FeeSchedule, error)
+	Save(ctx context.Context, schedule *models.FeeSchedule) error
+}
+
+// In-memory implementation for tests/dev
+type memoryFeeScheduleStore struct {
+	mu       sync.RWMutex
+	schedule *models.FeeSchedule
+}
+
+func NewMemoryFeeScheduleStore() FeeScheduleStore {
+	return &memoryFeeScheduleStore{}
+}
+
+func (m *memoryFeeScheduleStore) Get(ctx context.Context) (*models.FeeSchedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.schedule == nil {
+		return nil, ErrFeeScheduleNotFound
+	}
+	cp := *m.schedule
+	return &cp, nil
+}
+
+func (m *memoryFeeScheduleStore) Save(ctx context.Context, schedule *models.FeeSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *schedule
+	m.schedule = &cp
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// feeScheduleID is the _id of the single document holding the current schedule
+const feeScheduleID = "current"
+
+// MongoFeeScheduleStore persists the fee schedule in the fee_schedules collection
+type MongoFeeScheduleStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoFeeScheduleStore(db *mongo.Database, logger *logger.Logger) (*MongoFeeScheduleStore, error) {
+	return &MongoFeeScheduleStore{coll: db.Collection("fee_schedules"), logger: logger}, nil
+}
+
+func (m *MongoFeeScheduleStore) Get(ctx context.Context) (*models.FeeSchedule, error) {
+	var out models.FeeSchedule
+	if err := m.coll.FindOne(ctx, bson.M{"_id": feeScheduleID}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFeeScheduleNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoFeeScheduleStore) Save(ctx context.Context, schedule *models.FeeSchedule) error {
+	_, err := m.coll.ReplaceOne(ctx, bson.M{"_id": feeScheduleID}, schedule, options.Replace().SetUpsert(true))
+	return err
+}
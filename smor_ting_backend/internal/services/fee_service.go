@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// FeeService decides the platform's cut of each escrow release. Commission is a
+// percentage per service category (with optional minimum and maximum), a flat
+// mobile money fee per currency is deducted on top, and promotions waive either
+// for a period. It also builds the provider earnings statements that itemise
+// those deductions from the ledger.
+type FeeService struct {
+	store          FeeScheduleStore
+	repo           database.Repository
+	defaultPercent float64
+	auditService   *AuditService
+	logger         *zap.Logger
+	now            func() time.Time
+}
+
+// NewFeeService creates a fee service. defaultPercent is the commission on every
+// category until an admin saves a schedule.
+func NewFeeService(store FeeScheduleStore, repo database.Repository, defaultPercent float64, auditService *AuditService, logger *zap.Logger) *FeeService {
+	if store == nil {
+		store = NewMemoryFeeScheduleStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	return &FeeService{
+		store:          store,
+		repo:           repo,
+		defaultPercent: defaultPercent,
+		auditService:   auditService,
+		logger:         logger,
+		now:            time.Now,
+	}
+}
+
+// Schedule returns the saved schedule, or the default commission when none was saved
+func (s *FeeService) Schedule(ctx context.Context) (*models.FeeSchedule, error) {
+	schedule, err := s.store.Get(ctx)
+	if errors.Is(err, ErrFeeScheduleNotFound) {
+		return &models.FeeSchedule{
+			Commission: []models.CommissionRule{{Percent: s.defaultPercent}},
+			MomoFees:   map[string]float64{},
+			Promotions: []models.FeePromotion{},
+		}, nil
+	}
+	return schedule, err
+}
+
+// UpdateSchedule replaces the schedule; it applies to releases from now on
+func (s *FeeService) UpdateSchedule(ctx context.Context, admin *models.User, schedule *models.FeeSchedule, ac AuditContext) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	momoFees := make(map[string]float64, len(schedule.MomoFees))
+	for currency, fee := range schedule.MomoFees {
+		momoFees[strings.ToUpper(currency)] = roundMinor(fee)
+	}
+	schedule.MomoFees = momoFees
+	schedule.UpdatedBy = admin.ID
+	schedule.UpdatedAt = s.now()
+	if err := s.store.Save(ctx, schedule); err != nil {
+		return err
+	}
+	_ = s.auditService.LogAction(ctx, &AuditEntry{
+		UserID:    admin.ID.Hex(),
+		UserEmail: admin.Email,
+		UserRole:  string(admin.Role),
+		Action:    ActionSystemConfiguration,
+		Resource:  "fee_schedule",
+		IPAddress: ac.IPAddress,
+		UserAgent: ac.UserAgent,
+		Details: map[string]interface{}{
+			"commission_rules": len(schedule.Commission),
+			"momo_fees":        schedule.MomoFees,
+			"promotions":       len(schedule.Promotions),
+		},
+		Success: true,
+	})
+	return nil
+}
+
+// Quote splits a release of gross in categoryID into commission, the mobile
+// money fee and the provider's net. Fees never exceed gross.
+func (s *FeeService) Quote(ctx context.Context, categoryID primitive.ObjectID, gross float64, currency string) (*models.FeeBreakdown, error) {
+	schedule, err := s.Schedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gross = roundMinor(gross)
+	fees := &models.FeeBreakdown{Gross: gross, Currency: currency}
+
+	waiveCommission, waiveMomo := false, false
+	now := s.now()
+	for i := range schedule.Promotions {
+		promo := &schedule.Promotions[i]
+		if !promo.Applies(categoryID, now) {
+			continue
+		}
+		waiveCommission = waiveCommission || promo.WaiveCommission
+		waiveMomo = waiveMomo || promo.WaiveMomoFee
+		if fees.Promotion == "" {
+			fees.Promotion = promo.Name
+		}
+	}
+
+	if rule := commissionRule(schedule.Commission, categoryID); rule != nil && !waiveCommission {
+		commission := gross * rule.Percent / 100
+		if commission < rule.MinFee {
+			commission = rule.MinFee
+		}
+		if rule.MaxFee > 0 && commission > rule.MaxFee {
+			commission = rule.MaxFee
+		}
+		fees.CommissionPercent = rule.Percent
+		fees.Commission = roundMinor(math.Min(commission, gross))
+	}
+	if !waiveMomo {
+		fees.MomoFee = roundMinor(math.Min(schedule.MomoFees[strings.ToUpper(currency)], gross-fees.Commission))
+	}
+	fees.Net = roundMinor(gross - fees.Commission - fees.MomoFee)
+	return fees, nil
+}
+
+// isClawback reports whether a refund moved money from the provider's wallet to
+// a customer's, as opposed to paying the provider's own top-up back out
+func isClawback(tx *models.LedgerTransaction, providerID primitive.ObjectID) bool {
+	for _, p := range tx.Postings {
+		if p.Kind == models.AccountUserAvailable && p.Direction == models.LedgerCredit && p.UserID != providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// commissionRule picks the category's own rule, falling back to the default one
+func commissionRule(rules []models.CommissionRule, categoryID primitive.ObjectID) *models.CommissionRule {
+	var fallback *models.CommissionRule
+	for i := range rules {
+		switch {
+		case rules[i].CategoryID == nil:
+			fallback = &rules[i]
+		case *rules[i].CategoryID == categoryID:
+			return &rules[i]
+		}
+	}
+	return fallback
+}
+
+// EarningsStatement itemises what a provider was paid over [from, to): each
+// escrow release with its gross, commission, mobile money fee and net, and any
+// refunds clawed back from the provider's wallet
+func (s *FeeService) EarningsStatement(ctx context.Context, providerID primitive.ObjectID, from, to time.Time) (*models.EarningsStatement, error) {
+	txs, err := s.repo.GetUserLedgerTransactionsBetween(ctx, providerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	statement := &models.EarningsStatement{
+		ProviderID: providerID,
+		From:       from,
+		To:         to,
+		Lines:      []models.EarningsLine{},
+		Totals:     map[string]models.EarningsTotal{},
+	}
+	available := models.UserAvailableAccount(providerID).Key()
+	for i := range txs {
+		tx := &txs[i]
+		line := models.EarningsLine{Date: tx.CreatedAt, Type: tx.Type, Reference: tx.Reference, Item: tx.Description}
+		switch tx.Type {
+		case models.LedgerEscrowRelease:
+			for _, p := range tx.Postings {
+				switch {
+				case p.Direction == models.LedgerDebit:
+					line.Gross += p.Amount
+				case p.Account == available:
+					line.Net += p.Amount
+					line.Currency = p.Currency
+				case p.Memo == models.LedgerMemoCommission:
+					line.Commission += p.Amount
+				case p.Memo == models.LedgerMemoMomoFee:
+					line.MomoFee += p.Amount
+				}
+			}
+		case models.LedgerRefund:
+			if !isClawback(tx, providerID) {
+				continue
+			}
+			for _, p := range tx.Postings {
+				if p.Account == available && p.Direction == models.LedgerDebit {
+					line.Gross -= p.Amount
+					line.Net -= p.Amount
+					line.Currency = p.Currency
+				}
+			}
+		}
+		if line.Currency == "" {
+			// Not an earning of this provider (e.g. their own top-ups or bookings as a customer)
+			continue
+		}
+		line.Gross, line.Commission = roundMinor(line.Gross), roundMinor(line.Commission)
+		line.MomoFee, line.Net = roundMinor(line.MomoFee), roundMinor(line.Net)
+		statement.Lines = append(statement.Lines, line)
+
+		total := statement.Totals[line.Currency]
+		total.Gross = roundMinor(total.Gross + line.Gross)
+		total.Commission = roundMinor(total.Commission + line.Commission)
+		total.MomoFees = roundMinor(total.MomoFees + line.MomoFee)
+		total.Net = roundMinor(total.Net + line.Net)
+		statement.Totals[line.Currency] = total
+	}
+	return statement, nil
+}
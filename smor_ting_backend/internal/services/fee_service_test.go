@@ -0,0 +1,119 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFees_QuoteAppliesCategoryRulesAndPromotions(t *testing.T) {
+	ctx := context.TODO()
+	fees := services.NewFeeService(nil, database.NewMemoryDatabase(), 10, nil, nil)
+	plumbing, cleaning := primitive.NewObjectID(), primitive.NewObjectID()
+	schedule := &models.FeeSchedule{
+		Commission: []models.CommissionRule{
+			{Percent: 10},
+			{CategoryID: &plumbing, Percent: 20, MinFee: 5, MaxFee: 15},
+		},
+		MomoFees: map[string]float64{"usd": 1},
+	}
+	if err := fees.UpdateSchedule(ctx, refundAdmin, schedule, services.AuditContext{}); err != nil {
+		t.Fatalf("update schedule: %v", err)
+	}
+
+	cases := []struct {
+		category               primitive.ObjectID
+		gross, commission, net float64
+	}{
+		{plumbing, 150, 15, 134}, // capped at the maximum
+		{plumbing, 10, 5, 4},     // raised to the minimum
+		{cleaning, 100, 10, 89},  // default rule
+		{plumbing, 5, 5, 0},      // fees never exceed the release
+	}
+	for _, c := range cases {
+		q, err := fees.Quote(ctx, c.category, c.gross, "USD")
+		if err != nil {
+			t.Fatalf("quote: %v", err)
+		}
+		if q.Commission != c.commission || q.Net != c.net {
+			t.Fatalf("gross %v: expected commission %v and net %v, got %+v", c.gross, c.commission, c.net, q)
+		}
+	}
+
+	schedule.Promotions = []models.FeePromotion{{
+		Name: "Plumbing week", CategoryID: &plumbing, WaiveCommission: true,
+		StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour),
+	}}
+	if err := fees.UpdateSchedule(ctx, refundAdmin, schedule, services.AuditContext{}); err != nil {
+		t.Fatalf("update schedule: %v", err)
+	}
+	if q, _ := fees.Quote(ctx, plumbing, 150, "USD"); q.Commission != 0 || q.MomoFee != 1 || q.Promotion != "Plumbing week" {
+		t.Fatalf("expected only the MoMo fee during the promotion, got %+v", q)
+	}
+	if q, _ := fees.Quote(ctx, cleaning, 100, "USD"); q.Commission != 10 || q.Promotion != "" {
+		t.Fatalf("the promotion must not apply to other categories, got %+v", q)
+	}
+
+	schedule.Commission = append(schedule.Commission, models.CommissionRule{Percent: 5})
+	if err := fees.UpdateSchedule(ctx, refundAdmin, schedule, services.AuditContext{}); !errors.Is(err, models.ErrInvalidFeeSchedule) {
+		t.Fatalf("two default rules must be rejected, got %v", err)
+	}
+}
+
+func TestFees_ReleasePostsFeeLinesOnEarningsStatement(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	fees := services.NewFeeService(nil, f.repo, 10, nil, nil)
+	if err := fees.UpdateSchedule(ctx, refundAdmin, &models.FeeSchedule{
+		Commission: []models.CommissionRule{{Percent: 10}},
+		MomoFees:   map[string]float64{"USD": 0.5},
+	}, services.AuditContext{}); err != nil {
+		t.Fatalf("update schedule: %v", err)
+	}
+	f.escrow.SetFeeService(fees)
+
+	booking := f.fundedBooking(t, "hold-fees-1")
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+	if bal := f.balances(t, f.provider); bal.Available != 134.5 {
+		t.Fatalf("provider should be paid 150 less 15 commission and 0.5 MoMo fee, got %+v", bal)
+	}
+	escrow, _ := f.escrow.Get(ctx, booking.ID)
+	if escrow.Fees == nil || escrow.Fees.Commission != 15 || escrow.Fees.Net != 134.5 {
+		t.Fatalf("expected the fee breakdown on the escrow, got %+v", escrow.Fees)
+	}
+
+	// A clawback is capped at what the provider actually received
+	refunds := services.NewRefundService(nil, f.repo, f.ledger, f.escrow, nil, nil, nil, nil)
+	req := services.RefundRequest{Kind: models.RefundWallet, Source: booking.ID.Hex(), Amount: 140, Reason: models.RefundReasonPoorQuality}
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("expected the clawback to be capped at the net, got %v", err)
+	}
+	req.Amount = 20
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); err != nil {
+		t.Fatalf("wallet refund: %v", err)
+	}
+
+	statement, err := fees.EarningsStatement(ctx, f.provider.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if len(statement.Lines) != 2 {
+		t.Fatalf("expected the release and the clawback, got %+v", statement.Lines)
+	}
+	release := statement.Lines[0]
+	if release.Gross != 150 || release.Commission != 15 || release.MomoFee != 0.5 || release.Net != 134.5 {
+		t.Fatalf("unexpected release line: %+v", release)
+	}
+	if clawback := statement.Lines[1]; clawback.Net != -20 {
+		t.Fatalf("unexpected clawback line: %+v", clawback)
+	}
+	if total := statement.Totals["USD"]; total.Gross != 130 || total.Commission != 15 || total.MomoFees != 0.5 || total.Net != 114.5 {
+		t.Fatalf("unexpected totals: %+v", total)
+	}
+}
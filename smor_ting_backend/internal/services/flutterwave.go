@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/des"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FlutterwaveGateway charges cards through Flutterwave v3 with pre-authorization:
+//
+//	POST /v3/charges?type=card                    authorize (3DES-encrypted card payload)
+//	GET  /v3/transactions/verify_by_reference     outcome after the 3-D Secure redirect
+//	POST /v3/charges/{flw_ref}/capture            capture all or part of the hold
+//	POST /v3/charges/{flw_ref}/void               release the hold
+//	POST /v3/charges/{flw_ref}/refund             refund a captured charge
+//
+// Our transaction id is sent as tx_ref so the redirect and verification are keyed by it.
+type FlutterwaveGateway struct {
+	httpClient    *http.Client
+	baseURL       string
+	secretKey     string
+	encryptionKey string
+}
+
+func NewFlutterwaveGateway(baseURL, secretKey, encryptionKey string) *FlutterwaveGateway {
+	return &FlutterwaveGateway{
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		secretKey:     secretKey,
+		encryptionKey: encryptionKey,
+	}
+}
+
+func (g *FlutterwaveGateway) Name() string { return "flutterwave" }
+
+type flutterwaveResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    *struct {
+		ID                int64   `json:"id"`
+		TxRef             string  `json:"tx_ref"`
+		FlwRef            string  `json:"flw_ref"`
+		Amount            float64 `json:"amount"`
+		Currency          string  `json:"currency"`
+		Status            string  `json:"status"`
+		ProcessorResponse string  `json:"processor_response"`
+	} `json:"data"`
+	Meta *struct {
+		Authorization *struct {
+			Mode     string `json:"mode"`
+			Redirect string `json:"redirect"`
+		} `json:"authorization"`
+	} `json:"meta"`
+}
+
+func (g *FlutterwaveGateway) Authorize(ctx context.Context, req CardAuthorization) (*GatewayResult, error) {
+	if req.Card == nil || req.Card.CardNumber == "" {
+		return nil, &CardDeclinedError{Code: DeclineInvalidCard}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"card_number":  req.Card.CardNumber,
+		"cvv":          req.Card.CVV,
+		"expiry_month": req.Card.ExpiryMonth,
+		"expiry_year":  req.Card.ExpiryYear,
+		"currency":     req.Currency,
+		"amount":       req.Amount,
+		"email":        req.Email,
+		"tx_ref":       req.Reference,
+		"redirect_url": req.RedirectURL,
+		"preauthorize": true,
+	})
+	client, err := flutterwaveEncrypt(g.encryptionKey, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCardGatewayUnavailable, err)
+	}
+	res, err := g.call(ctx, http.MethodPost, "/v3/charges?type=card", map[string]string{"client": client})
+	if err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, fmt.Errorf("%w: charge response without data", ErrCardGatewayUnavailable)
+	}
+	result := &GatewayResult{GatewayRef: res.Data.FlwRef, GatewayID: fmt.Sprint(res.Data.ID)}
+	if res.Meta != nil && res.Meta.Authorization != nil {
+		switch mode := res.Meta.Authorization.Mode; mode {
+		case "redirect":
+			result.Status = CardChargeRequiresAction
+			result.RedirectURL = res.Meta.Authorization.Redirect
+			return result, nil
+		case "":
+		default:
+			// PIN, OTP and AVS collection happen in the client, not through our API
+			return nil, &CardDeclinedError{Code: DeclineNotPermitted, Message: "unsupported authorization mode " + mode}
+		}
+	}
+	switch strings.ToLower(res.Data.Status) {
+	case "successful":
+		result.Status = CardChargeAuthorized
+		return result, nil
+	case "failed":
+		return nil, flutterwaveDecline(res.Data.ProcessorResponse)
+	}
+	return nil, fmt.Errorf("%w: charge %s is %s without an authorization step", ErrCardGatewayUnavailable, req.Reference, res.Data.Status)
+}
+
+func (g *FlutterwaveGateway) ConfirmAuthentication(ctx context.Context, charge *CardCharge) (*GatewayResult, error) {
+	res, err := g.call(ctx, http.MethodGet, "/v3/transactions/verify_by_reference?tx_ref="+url.QueryEscape(charge.TransactionID), nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.Data == nil {
+		return nil, fmt.Errorf("%w: verification without data", ErrCardGatewayUnavailable)
+	}
+	result := &GatewayResult{GatewayRef: res.Data.FlwRef, GatewayID: fmt.Sprint(res.Data.ID)}
+	switch strings.ToLower(res.Data.Status) {
+	case "successful":
+		// The charge must be the one we asked for, not one re-created with a smaller amount
+		if !strings.EqualFold(res.Data.Currency, charge.Currency) || res.Data.Amount+0.005 < charge.Amount {
+			return nil, &CardDeclinedError{Code: DeclineAuthenticationFailed, Message: "verified amount does not match the charge"}
+		}
+		result.Status = CardChargeAuthorized
+	case "pending":
+		result.Status = CardChargeRequiresAction
+	default:
+		decline := flutterwaveDecline(res.Data.ProcessorResponse)
+		if decline.Code == DeclineGeneric {
+			decline.Code = DeclineAuthenticationFailed
+		}
+		return nil, decline
+	}
+	return result, nil
+}
+
+func (g *FlutterwaveGateway) Capture(ctx context.Context, charge *CardCharge, amount float64) (*GatewayResult, error) {
+	if _, err := g.call(ctx, http.MethodPost, "/v3/charges/"+url.PathEscape(charge.GatewayRef)+"/capture", map[string]float64{"amount": amount}); err != nil {
+		return nil, err
+	}
+	return &GatewayResult{Status: CardChargeCaptured, GatewayRef: charge.GatewayRef, GatewayID: charge.GatewayID}, nil
+}
+
+func (g *FlutterwaveGateway) Void(ctx context.Context, charge *CardCharge) (*GatewayResult, error) {
+	if _, err := g.call(ctx, http.MethodPost, "/v3/charges/"+url.PathEscape(charge.GatewayRef)+"/void", nil); err != nil {
+		return nil, err
+	}
+	return &GatewayResult{Status: CardChargeVoided, GatewayRef: charge.GatewayRef, GatewayID: charge.GatewayID}, nil
+}
+
+func (g *FlutterwaveGateway) Refund(ctx context.Context, charge *CardCharge, amount float64) (*GatewayResult, error) {
+	if _, err := g.call(ctx, http.MethodPost, "/v3/charges/"+url.PathEscape(charge.GatewayRef)+"/refund", map[string]float64{"amount": amount}); err != nil {
+		return nil, err
+	}
+	status := CardChargeCaptured
+	if charge.RefundedAmount+amount >= charge.CapturedAmount {
+		status = CardChargeRefunded
+	}
+	return &GatewayResult{Status: status, GatewayRef: charge.GatewayRef, GatewayID: charge.GatewayID}, nil
+}
+
+// call sends an authenticated request. Rejections (4xx with status "error") become
+// declines; transport failures and 5xx become ErrCardGatewayUnavailable.
+func (g *FlutterwaveGateway) call(ctx context.Context, method, path string, body interface{}) (*flutterwaveResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	req.Header.Set("Authorization", "Bearer "+g.secretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCardGatewayUnavailable, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: flutterwave %d: %s", ErrCardGatewayUnavailable, resp.StatusCode, string(raw))
+	}
+	var out flutterwaveResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("%w: unreadable flutterwave response: %v", ErrCardGatewayUnavailable, err)
+	}
+	if resp.StatusCode >= 300 || out.Status == "error" {
+		return nil, flutterwaveDecline(out.Message)
+	}
+	return &out, nil
+}
+
+// flutterwaveDecline maps Flutterwave's processor wording onto our decline codes
+func flutterwaveDecline(message string) *CardDeclinedError {
+	m := strings.ToLower(message)
+	code := DeclineGeneric
+	switch {
+	case strings.Contains(m, "insufficient"):
+		code = DeclineInsufficientFunds
+	case strings.Contains(m, "expired"):
+		code = DeclineExpiredCard
+	case strings.Contains(m, "cvv"), strings.Contains(m, "cvc"), strings.Contains(m, "security code"):
+		code = DeclineIncorrectCVV
+	case strings.Contains(m, "fraud"), strings.Contains(m, "stolen"), strings.Contains(m, "lost card"):
+		code = DeclineSuspectedFraud
+	case strings.Contains(m, "do not honor"), strings.Contains(m, "do not honour"):
+		code = DeclineDoNotHonor
+	case strings.Contains(m, "not permitted"), strings.Contains(m, "restricted"):
+		code = DeclineNotPermitted
+	case strings.Contains(m, "invalid card"), strings.Contains(m, "card number"):
+		code = DeclineInvalidCard
+	case strings.Contains(m, "authentication"), strings.Contains(m, "3ds"), strings.Contains(m, "otp"):
+		code = DeclineAuthenticationFailed
+	}
+	return &CardDeclinedError{Code: code, Message: message}
+}
+
+// flutterwaveEncrypt is Flutterwave's card payload encryption: 3DES-ECB with
+// PKCS#5 padding under the account's 24-byte encryption key, base64 encoded
+func flutterwaveEncrypt(key string, plaintext []byte) (string, error) {
+	block, err := des.NewTripleDESCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	size := block.BlockSize()
+	pad := size - len(plaintext)%size
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(padded))
+	for i := 0; i < len(padded); i += size {
+		block.Encrypt(out[i:i+size], padded[i:i+size])
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// roundCents keeps card amounts at two decimals
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"context"
+	"crypto/des"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smorting/backend/internal/services"
+)
+
+const flwEncryptionKey = "FLWSECK_TEST0123456789ab" // 24 bytes
+
+// decryptFlutterwave reverses the 3DES-ECB card payload encryption
+func decryptFlutterwave(t *testing.T, client string) map[string]interface{} {
+	t.Helper()
+	raw, _ := base64.StdEncoding.DecodeString(client)
+	block, err := des.NewTripleDESCipher([]byte(flwEncryptionKey))
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	out := make([]byte, len(raw))
+	for i := 0; i < len(raw); i += block.BlockSize() {
+		block.Decrypt(out[i:i+block.BlockSize()], raw[i:i+block.BlockSize()])
+	}
+	out = out[:len(out)-int(out[len(out)-1])]
+	var payload map[string]interface{}
+	if err := json.Unmarshal(out, &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	return payload
+}
+
+func TestFlutterwave_RedirectVerifyCaptureAndDecline(t *testing.T) {
+	var captured map[string]float64
+	verifiedAmount := 25.0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/charges", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" || r.URL.Query().Get("type") != "card" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		payload := decryptFlutterwave(t, body["client"])
+		switch payload["card_number"] {
+		case "5531886652142950":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","message":"Insufficient Funds","data":null}`))
+		default:
+			if payload["tx_ref"] != "txn_1" || payload["preauthorize"] != true || payload["redirect_url"] != "https://api.example.com/return" {
+				t.Errorf("unexpected payload: %v", payload)
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"id":77,"flw_ref":"FLW-77","status":"pending"},"meta":{"authorization":{"mode":"redirect","redirect":"https://checkout.flutterwave.com/3ds/77"}}}`))
+		}
+	})
+	mux.HandleFunc("/v3/transactions/verify_by_reference", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "data": map[string]interface{}{
+			"id": 77, "flw_ref": "FLW-77", "tx_ref": r.URL.Query().Get("tx_ref"), "amount": verifiedAmount, "currency": "USD", "status": "successful",
+		}})
+	})
+	mux.HandleFunc("/v3/charges/FLW-77/capture", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&captured)
+		_, _ = w.Write([]byte(`{"status":"success","data":{"id":77,"flw_ref":"FLW-77","status":"successful"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	gw := services.NewFlutterwaveGateway(srv.URL, "sk_test", flwEncryptionKey)
+	ctx := context.Background()
+	card := &services.SensitivePaymentData{CardNumber: "4187427415564246", CVV: "828", ExpiryMonth: "09", ExpiryYear: "32"}
+
+	res, err := gw.Authorize(ctx, services.CardAuthorization{Reference: "txn_1", Amount: 25, Currency: "USD", Card: card, RedirectURL: "https://api.example.com/return"})
+	if err != nil || res.Status != services.CardChargeRequiresAction || res.RedirectURL != "https://checkout.flutterwave.com/3ds/77" {
+		t.Fatalf("expected a 3-D Secure redirect, got %+v, %v", res, err)
+	}
+	charge := &services.CardCharge{TransactionID: "txn_1", Amount: 25, Currency: "USD", GatewayRef: res.GatewayRef}
+	if res, err = gw.ConfirmAuthentication(ctx, charge); err != nil || res.Status != services.CardChargeAuthorized {
+		t.Fatalf("verify: %+v, %v", res, err)
+	}
+	if _, err = gw.Capture(ctx, charge, 25); err != nil || captured["amount"] != 25 {
+		t.Fatalf("capture: %v, %v", captured, err)
+	}
+
+	// A verified charge for less than we asked is not accepted
+	verifiedAmount = 1
+	var declined *services.CardDeclinedError
+	if _, err := gw.ConfirmAuthentication(ctx, charge); !errors.As(err, &declined) || declined.Code != services.DeclineAuthenticationFailed {
+		t.Fatalf("expected an amount mismatch to be refused, got %v", err)
+	}
+
+	card.CardNumber = "5531886652142950"
+	_, err = gw.Authorize(ctx, services.CardAuthorization{Reference: "txn_2", Amount: 25, Currency: "USD", Card: card})
+	if !errors.As(err, &declined) || declined.Code != services.DeclineInsufficientFunds {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+
+	down := services.NewFlutterwaveGateway("http://127.0.0.1:1", "sk_test", flwEncryptionKey)
+	if _, err := down.Authorize(ctx, services.CardAuthorization{Reference: "txn_3", Amount: 1, Currency: "USD", Card: card}); !errors.Is(err, services.ErrCardGatewayUnavailable) {
+		t.Fatalf("expected gateway unavailable, got %v", err)
+	}
+}
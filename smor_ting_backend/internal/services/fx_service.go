@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidFXRate     = errors.New("fx rate needs two different supported currencies and a positive rate")
+	ErrFXRateUnavailable = errors.New("no exchange rate for these currencies")
+	ErrFXQuoteExpired    = errors.New("fx quote has expired")
+	ErrFXQuoteRequired   = errors.New("paying in another currency needs an fx quote")
+	ErrFXQuoteMismatch   = errors.New("fx quote was issued for another payment")
+	ErrFXSameCurrency    = errors.New("booking is already priced in this currency")
+)
+
+// FXService keeps the admin-maintained exchange rate table and locks rates into
+// short-lived quotes, so that what a customer is shown is exactly what they pay
+// when a booking priced in one currency is paid from a balance in the other.
+type FXService struct {
+	store        FXStore
+	repo         database.Repository
+	quoteTTL     time.Duration
+	defaults     map[string]models.FXRate
+	auditService *AuditService
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+// NewFXService creates an FX service; usdToLRD, when positive, is used until an
+// admin saves a USD/LRD rate
+func NewFXService(store FXStore, repo database.Repository, quoteTTL time.Duration, usdToLRD float64, auditService *AuditService, logger *zap.Logger) *FXService {
+	if store == nil {
+		store = NewMemoryFXStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	if quoteTTL <= 0 {
+		quoteTTL = 10 * time.Minute
+	}
+	defaults := map[string]models.FXRate{}
+	if usdToLRD > 0 {
+		def := models.FXRate{Base: models.CurrencyUSD, Quote: models.CurrencyLRD, Rate: usdToLRD}
+		defaults[def.Pair()] = def
+	}
+	return &FXService{
+		store:        store,
+		repo:         repo,
+		quoteTTL:     quoteTTL,
+		defaults:     defaults,
+		auditService: auditService,
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// Rates returns the saved rate table, including configured defaults not yet overridden
+func (s *FXService) Rates(ctx context.Context) ([]models.FXRate, error) {
+	rates, err := s.store.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	saved := map[string]bool{}
+	for i := range rates {
+		saved[rates[i].Pair()] = true
+	}
+	for pair, def := range s.defaults {
+		if !saved[pair] {
+			rates = append(rates, def)
+		}
+	}
+	return rates, nil
+}
+
+// SetRate saves base/quote; quotes already issued keep the rate they locked
+func (s *FXService) SetRate(ctx context.Context, admin *models.User, rate *models.FXRate, ac AuditContext) error {
+	base, okBase := models.NormalizeCurrency(rate.Base)
+	quote, okQuote := models.NormalizeCurrency(rate.Quote)
+	if !okBase || !okQuote || base == quote || rate.Rate <= 0 {
+		return ErrInvalidFXRate
+	}
+	rate.Base, rate.Quote = base, quote
+	rate.UpdatedBy = admin.ID
+	rate.UpdatedAt = s.now()
+	if err := s.store.SaveRate(ctx, rate); err != nil {
+		return err
+	}
+	_ = s.auditService.LogAction(ctx, &AuditEntry{
+		UserID:     admin.ID.Hex(),
+		UserEmail:  admin.Email,
+		UserRole:   string(admin.Role),
+		Action:     ActionSystemConfiguration,
+		Resource:   "fx_rate",
+		ResourceID: rate.Pair(),
+		IPAddress:  ac.IPAddress,
+		UserAgent:  ac.UserAgent,
+		Details:    map[string]interface{}{"rate": rate.Rate},
+		Success:    true,
+	})
+	return nil
+}
+
+// Rate returns how many units of to one unit of from buys, using the inverse
+// of the opposite pair when only that one is saved
+func (s *FXService) Rate(ctx context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	if rate, err := s.pairRate(ctx, from, to); err == nil {
+		return rate, nil
+	} else if !errors.Is(err, ErrFXRateNotFound) {
+		return 0, err
+	}
+	rate, err := s.pairRate(ctx, to, from)
+	if errors.Is(err, ErrFXRateNotFound) {
+		return 0, ErrFXRateUnavailable
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1 / rate, nil
+}
+
+func (s *FXService) pairRate(ctx context.Context, base, quote string) (float64, error) {
+	rate, err := s.store.Rate(ctx, base, quote)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if errors.Is(err, ErrFXRateNotFound) {
+		if def, ok := s.defaults[base+"/"+quote]; ok {
+			return def.Rate, nil
+		}
+	}
+	return 0, err
+}
+
+// QuoteBooking locks the price of a booking in currency for the quote TTL
+func (s *FXService) QuoteBooking(ctx context.Context, customer *models.User, bookingID primitive.ObjectID, currency string) (*models.FXQuote, error) {
+	from, ok := models.NormalizeCurrency(currency)
+	if !ok {
+		return nil, models.ErrUnsupportedCurrency
+	}
+	booking, err := s.repo.GetBookingByID(ctx, bookingID)
+	if err != nil || booking.CustomerID != customer.ID {
+		return nil, ErrBookingNotFound
+	}
+	to, _ := models.NormalizeCurrency(booking.Currency)
+	if from == to {
+		return nil, ErrFXSameCurrency
+	}
+	// Price the booking amount directly off the from-per-to rate so the
+	// customer pays the same figure an admin would compute from the table
+	perUnit, err := s.Rate(ctx, to, from)
+	if err != nil {
+		return nil, err
+	}
+	fromAmount := roundMinor(booking.TotalAmount * perUnit)
+	if fromAmount <= 0 {
+		return nil, ErrFXRateUnavailable
+	}
+	now := s.now()
+	quote := &models.FXQuote{
+		UserID:     customer.ID,
+		BookingID:  booking.ID,
+		From:       from,
+		FromAmount: fromAmount,
+		To:         to,
+		ToAmount:   roundMinor(booking.TotalAmount),
+		Rate:       1 / perUnit,
+		ExpiresAt:  now.Add(s.quoteTTL),
+	}
+	if err := s.store.CreateQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// checkQuote returns the quote if customer may still use it to pay booking
+func (s *FXService) checkQuote(ctx context.Context, customer *models.User, quoteID primitive.ObjectID, booking *models.Booking, from string) (*models.FXQuote, error) {
+	quote, err := s.store.GetQuote(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	if quote.UserID != customer.ID || quote.BookingID != booking.ID || quote.From != from ||
+		quote.ToAmount != roundMinor(booking.TotalAmount) {
+		return nil, ErrFXQuoteMismatch
+	}
+	if quote.UsedAt != nil {
+		return nil, ErrFXQuoteUsed
+	}
+	if !s.now().Before(quote.ExpiresAt) {
+		return nil, ErrFXQuoteExpired
+	}
+	return quote, nil
+}
+
+// useQuote spends the quote on the hold reference; only one payment can win it
+func (s *FXService) useQuote(ctx context.Context, quote *models.FXQuote, reference string) error {
+	return s.store.UseQuote(ctx, quote.ID, reference, s.now())
+}
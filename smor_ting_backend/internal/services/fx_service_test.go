@@ -0,0 +1,100 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+func TestFX_RateTableAndInverse(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	fx := services.NewFXService(nil, f.repo, time.Minute, 185, nil, nil)
+
+	if rate, err := fx.Rate(ctx, "LRD", "USD"); err != nil || rate != 1.0/185 {
+		t.Fatalf("expected the configured default inverted, got %v, %v", rate, err)
+	}
+	if err := fx.SetRate(ctx, refundAdmin, &models.FXRate{Base: "usd", Quote: "lrd", Rate: 190}, services.AuditContext{}); err != nil {
+		t.Fatalf("set rate: %v", err)
+	}
+	if rate, _ := fx.Rate(ctx, "USD", "LRD"); rate != 190 {
+		t.Fatalf("the saved rate must replace the default, got %v", rate)
+	}
+	if rates, _ := fx.Rates(ctx); len(rates) != 1 || rates[0].Pair() != "USD/LRD" {
+		t.Fatalf("expected one USD/LRD rate, got %+v", rates)
+	}
+	for _, bad := range []models.FXRate{{Base: "USD", Quote: "USD", Rate: 1}, {Base: "USD", Quote: "EUR", Rate: 0.9}, {Base: "USD", Quote: "LRD"}} {
+		if err := fx.SetRate(ctx, refundAdmin, &bad, services.AuditContext{}); !errors.Is(err, services.ErrInvalidFXRate) {
+			t.Fatalf("expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestFX_PayUSDBookingFromLRDBalanceWithLockedQuote(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	fx := services.NewFXService(nil, f.repo, 30*time.Millisecond, 0, nil, nil)
+	f.escrow.SetFXService(fx)
+	booking := f.book(t)
+
+	if _, err := fx.QuoteBooking(ctx, f.customer, booking.ID, "LRD"); !errors.Is(err, services.ErrFXRateUnavailable) {
+		t.Fatalf("quoting without a rate must fail, got %v", err)
+	}
+	_ = fx.SetRate(ctx, refundAdmin, &models.FXRate{Base: "USD", Quote: "LRD", Rate: 190}, services.AuditContext{})
+	topup := func(ref string, amount float64) {
+		err := f.ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: amount, Currency: "LRD", Status: models.LedgerCompleted, Reference: ref})
+		if err != nil {
+			t.Fatalf("top-up: %v", err)
+		}
+	}
+	topup("lrd-1", 20000)
+
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "LRD", nil); !errors.Is(err, services.ErrFXQuoteRequired) {
+		t.Fatalf("paying in LRD without a quote must fail, got %v", err)
+	}
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "", nil); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("the USD balance is empty, got %v", err)
+	}
+
+	stale, _ := fx.QuoteBooking(ctx, f.customer, booking.ID, "LRD")
+	time.Sleep(40 * time.Millisecond)
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "LRD", &stale.ID); !errors.Is(err, services.ErrFXQuoteExpired) {
+		t.Fatalf("an expired quote must be refused, got %v", err)
+	}
+
+	quote, err := fx.QuoteBooking(ctx, f.customer, booking.ID, "lrd")
+	if err != nil || quote.FromAmount != 28500 || quote.ToAmount != 150 || quote.To != "USD" {
+		t.Fatalf("expected 150 USD for 28500 LRD, got %+v, %v", quote, err)
+	}
+	if _, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "LRD", &quote.ID); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("20000 LRD cannot cover 28500, got %v", err)
+	}
+	topup("lrd-2", 10000)
+	// A rate change after quoting does not move the locked price
+	_ = fx.SetRate(ctx, refundAdmin, &models.FXRate{Base: "USD", Quote: "LRD", Rate: 200}, services.AuditContext{})
+	escrow, err := f.escrow.PayFromWallet(ctx, f.customer, booking.ID, "LRD", &quote.ID)
+	if err != nil || escrow.Status != models.EscrowHeld || escrow.Currency != "USD" {
+		t.Fatalf("expected 150 USD held, got %+v, %v", escrow, err)
+	}
+	bal := f.balances(t, f.customer)
+	if bal.Currencies["LRD"].Available != 1500 || bal.Currencies["USD"].PendingHeld != 150 {
+		t.Fatalf("expected 1500 LRD left and 150 USD held, got %+v", bal.Currencies)
+	}
+
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+	if bal := f.balances(t, f.provider); bal.Available != 150 || bal.Currency != "USD" {
+		t.Fatalf("provider should be paid 150 USD, got %+v", bal)
+	}
+}
+
+func TestLedger_RejectsUnsupportedCurrency(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	err := f.ledger.RecordIntent(context.TODO(), &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 5, Currency: "EUR", Reference: "eur-1"})
+	if !errors.Is(err, models.ErrUnsupportedCurrency) {
+		t.Fatalf("expected EUR to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrFXRateNotFound  = errors.New("fx rate not found")
+	ErrFXQuoteNotFound = errors.New("fx quote not found")
+	ErrFXQuoteUsed     = errors.New("fx quote already used")
+)
+
+// FXStore keeps the admin-maintained rate table and the quotes locked against it
+type FXStore interface {
+	// Rates returns every saved rate ordered by pair
+	Rates(ctx context.Context) ([]models.FXRate, error)
+	// Rate returns the rate saved for base/quote, or ErrFXRateNotFound
+	Rate(ctx context.Context, base, quote string) (*models.FXRate, error)
+	// SaveRate replaces the rate for the pair
+	SaveRate(ctx context.Context, rate *models.FXRate) error
+	CreateQuote(ctx context.Context, quote *models.FXQuote) error
+	GetQuote(ctx context.Context, id primitive.ObjectID) (*models.FXQuote, error)
+	// UseQuote marks an unused quote as spent on reference, otherwise returns ErrFXQuoteUsed
+	UseQuote(ctx context.Context, id primitive.ObjectID, reference string, at time.Time) error
+}
+
+// In-memory implementation for tests/dev
+type memoryFXStore struct {
+	mu     sync.RWMutex
+	rates  map[string]models.FXRate
+	quotes map[primitive.ObjectID]*models.FXQuote
+}
+
+func NewMemoryFXStore() FXStore {
+	return &memoryFXStore{rates: make(map[string]models.FXRate), quotes: make(map[primitive.ObjectID]*models.FXQuote)}
+}
+
+func (m *memoryFXStore) Rates(ctx context.Context) ([]models.FXRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]models.FXRate, 0, len(m.rates))
+	for _, r := range m.rates {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pair() < out[j].Pair() })
+	return out, nil
+}
+
+func (m *memoryFXStore) Rate(ctx context.Context, base, quote string) (*models.FXRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.rates[base+"/"+quote]
+	if !ok {
+		return nil, ErrFXRateNotFound
+	}
+	return &r, nil
+}
+
+func (m *memoryFXStore) SaveRate(ctx context.Context, rate *models.FXRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rates[rate.Pair()] = *rate
+	return nil
+}
+
+func (m *memoryFXStore) CreateQuote(ctx context.Context, quote *models.FXQuote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if quote.ID.IsZero() {
+		quote.ID = primitive.NewObjectID()
+	}
+	quote.CreatedAt = time.Now()
+	cp := *quote
+	m.quotes[quote.ID] = &cp
+	return nil
+}
+
+func (m *memoryFXStore) GetQuote(ctx context.Context, id primitive.ObjectID) (*models.FXQuote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	q, ok := m.quotes[id]
+	if !ok {
+		return nil, ErrFXQuoteNotFound
+	}
+	cp := *q
+	return &cp, nil
+}
+
+func (m *memoryFXStore) UseQuote(ctx context.Context, id primitive.ObjectID, reference string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.quotes[id]
+	if !ok {
+		return ErrFXQuoteNotFound
+	}
+	if q.UsedAt != nil {
+		return ErrFXQuoteUsed
+	}
+	q.UsedAt = &at
+	q.Reference = reference
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoFXStore persists rates in fx_rates (one document per pair) and quotes in fx_quotes
+type MongoFXStore struct {
+	rates  *mongo.Collection
+	quotes *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoFXStore(db *mongo.Database, logger *logger.Logger) (*MongoFXStore, error) {
+	s := &MongoFXStore{rates: db.Collection("fx_rates"), quotes: db.Collection("fx_quotes"), logger: logger}
+	_, _ = s.quotes.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// Expired quotes are of no use once a day has passed
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60)},
+	})
+	return s, nil
+}
+
+func (m *MongoFXStore) Rates(ctx context.Context) ([]models.FXRate, error) {
+	cursor, err := m.rates.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	out := []models.FXRate{}
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *MongoFXStore) Rate(ctx context.Context, base, quote string) (*models.FXRate, error) {
+	var out models.FXRate
+	if err := m.rates.FindOne(ctx, bson.M{"_id": base + "/" + quote}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFXRateNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoFXStore) SaveRate(ctx context.Context, rate *models.FXRate) error {
+	_, err := m.rates.ReplaceOne(ctx, bson.M{"_id": rate.Pair()}, rate, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoFXStore) CreateQuote(ctx context.Context, quote *models.FXQuote) error {
+	if quote.ID.IsZero() {
+		quote.ID = primitive.NewObjectID()
+	}
+	quote.CreatedAt = time.Now()
+	_, err := m.quotes.InsertOne(ctx, quote)
+	return err
+}
+
+func (m *MongoFXStore) GetQuote(ctx context.Context, id primitive.ObjectID) (*models.FXQuote, error) {
+	var out models.FXQuote
+	if err := m.quotes.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFXQuoteNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoFXStore) UseQuote(ctx context.Context, id primitive.ObjectID, reference string, at time.Time) error {
+	res, err := m.quotes.UpdateOne(ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": at, "reference": reference}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.GetQuote(ctx, id); err != nil {
+			return err
+		}
+		return ErrFXQuoteUsed
+	}
+	return nil
+}
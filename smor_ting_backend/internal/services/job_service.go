@@ -0,0 +1,520 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidJobRequest = errors.New("invalid job request")
+	ErrInvalidQuote      = errors.New("invalid quote")
+	ErrJobRequestClosed  = errors.New("job request is no longer open")
+	ErrQuoteClosed       = errors.New("quote is no longer open")
+	ErrQuoteCountered    = errors.New("quote is awaiting the provider's answer to a counter-offer")
+)
+
+const (
+	jobRequestLifetime   = 14 * 24 * time.Hour
+	defaultQuoteValidity = 48 * time.Hour
+	maxQuoteValidity     = 14 * 24 * time.Hour
+	minQuoteDuration     = 15 // minutes
+	maxJobPhotos         = 10
+	maxJobTitleLength    = 120
+	maxJobDescription    = 4000
+	// DefaultJobRadiusKm and MaxJobRadiusKm bound how far around a provider open jobs are listed
+	DefaultJobRadiusKm = 15
+	MaxJobRadiusKm     = 100
+	maxNearbyJobs      = 50
+)
+
+// JobRequestInput describes the work a customer wants quoted
+type JobRequestInput struct {
+	Title         string
+	Description   string
+	CategoryID    *primitive.ObjectID
+	Photos        []string
+	Location      models.Address
+	PreferredDate *time.Time
+}
+
+// QuoteInput is a provider's offer; ExpiresAt defaults to 48 hours away
+type QuoteInput struct {
+	Price         float64
+	Currency      string
+	Duration      int // minutes
+	ScheduledDate time.Time
+	Message       string
+	ExpiresAt     *time.Time
+}
+
+// JobAcceptance is the outcome of accepting a quote
+type JobAcceptance struct {
+	Job     *models.JobRequest `json:"job"`
+	Quote   *models.Quote      `json:"quote"`
+	Booking *models.Booking    `json:"booking"`
+	// Escrow is set when the booking was paid from the customer's wallet
+	Escrow *models.Escrow `json:"escrow,omitempty"`
+	// PaymentError says why the wallet did not pay; the booking can still be paid by mobile money
+	PaymentError string `json:"payment_error,omitempty"`
+}
+
+// JobService runs job requests for work without a fixed price: customers
+// describe the job, nearby providers quote, and the customer accepts, rejects
+// or counters. Accepting books the job at the agreed price and starts escrow.
+type JobService struct {
+	store        JobStore
+	repo         database.Repository
+	bookings     *BookingService
+	availability *AvailabilityService
+	escrow       *EscrowService
+	categories   *CategoryService
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+func NewJobService(store JobStore, repo database.Repository, bookings *BookingService, logger *zap.Logger) *JobService {
+	if store == nil {
+		store = NewMemoryJobStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &JobService{
+		store:        store,
+		repo:         repo,
+		bookings:     bookings,
+		availability: NewAvailabilityService(repo, logger),
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// SetEscrow makes accepting a quote pay the booking into escrow from the customer's wallet
+func (s *JobService) SetEscrow(escrow *EscrowService) {
+	s.escrow = escrow
+}
+
+// SetCategories makes job requests reject unknown or inactive categories
+func (s *JobService) SetCategories(categories *CategoryService) {
+	s.categories = categories
+}
+
+// CreateRequest opens a job request for providers near its location to quote on
+func (s *JobService) CreateRequest(ctx context.Context, customer *models.User, in JobRequestInput) (*models.JobRequest, error) {
+	job := &models.JobRequest{
+		CustomerID:    customer.ID,
+		Title:         strings.TrimSpace(in.Title),
+		Description:   strings.TrimSpace(in.Description),
+		Photos:        []string{},
+		Location:      in.Location,
+		Geo:           in.Location.GeoPoint(),
+		PreferredDate: in.PreferredDate,
+		Status:        models.JobRequestOpen,
+		ExpiresAt:     s.now().Add(jobRequestLifetime),
+	}
+	switch {
+	case job.Title == "" || len(job.Title) > maxJobTitleLength:
+		return nil, fmt.Errorf("%w: title is required and at most %d characters", ErrInvalidJobRequest, maxJobTitleLength)
+	case len(job.Description) > maxJobDescription:
+		return nil, fmt.Errorf("%w: description is at most %d characters", ErrInvalidJobRequest, maxJobDescription)
+	case job.Geo == nil:
+		return nil, fmt.Errorf("%w: location needs latitude and longitude", ErrInvalidJobRequest)
+	case len(in.Photos) > maxJobPhotos:
+		return nil, fmt.Errorf("%w: at most %d photos", ErrInvalidJobRequest, maxJobPhotos)
+	case in.PreferredDate != nil && !bookingScheduleValid(*in.PreferredDate):
+		return nil, fmt.Errorf("%w: preferred_date must be in the future", ErrInvalidJobRequest)
+	}
+	for _, photo := range in.Photos {
+		photo = strings.TrimSpace(photo)
+		if !strings.HasPrefix(photo, "https://") && !strings.HasPrefix(photo, "http://") {
+			return nil, fmt.Errorf("%w: photos must be image URLs", ErrInvalidJobRequest)
+		}
+		job.Photos = append(job.Photos, photo)
+	}
+	if in.CategoryID != nil {
+		if s.categories != nil {
+			if err := s.categories.RequireActive(ctx, *in.CategoryID); errors.Is(err, ErrCategoryNotFound) || errors.Is(err, ErrCategoryInactive) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidJobRequest, err)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		job.CategoryID = *in.CategoryID
+	}
+
+	if err := s.store.CreateJob(ctx, job); err != nil {
+		s.logger.Error("Failed to create job request", zap.Error(err), zap.String("customer_id", customer.ID.Hex()))
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetRequest returns a job request to its customer, an admin, or a provider
+// while it is open or once they have quoted on it
+func (s *JobService) GetRequest(ctx context.Context, user *models.User, id primitive.ObjectID) (*models.JobRequest, error) {
+	job, err := s.store.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case user.Role == models.AdminRole || job.CustomerID == user.ID:
+		return job, nil
+	case user.Role == models.ProviderRole:
+		if s.jobOpen(job) {
+			return job, nil
+		}
+		if _, err := s.providerQuote(ctx, job.ID, user.ID); err == nil {
+			return job, nil
+		}
+	}
+	return nil, ErrJobRequestNotFound
+}
+
+// ListRequests returns the customer's job requests, newest first
+func (s *JobService) ListRequests(ctx context.Context, customer *models.User) ([]models.JobRequest, error) {
+	return s.store.ListJobs(ctx, JobQuery{CustomerID: &customer.ID})
+}
+
+// Nearby returns open job requests within radiusKm of near, nearest first
+func (s *JobService) Nearby(ctx context.Context, provider *models.User, near *models.GeoPoint, radiusKm float64, categoryID *primitive.ObjectID) ([]models.JobRequest, error) {
+	now := s.now()
+	jobs, err := s.store.ListJobs(ctx, JobQuery{
+		Status:     models.JobRequestOpen,
+		CategoryID: categoryID,
+		OpenAt:     &now,
+		Near:       near,
+		RadiusKm:   radiusKm,
+		Limit:      maxNearbyJobs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := jobs[:0]
+	for _, job := range jobs {
+		if job.CustomerID != provider.ID {
+			out = append(out, job)
+		}
+	}
+	return out, nil
+}
+
+// CancelRequest withdraws an open job request; its open quotes are rejected
+func (s *JobService) CancelRequest(ctx context.Context, customer *models.User, id primitive.ObjectID) (*models.JobRequest, error) {
+	job, err := s.store.GetJob(ctx, id)
+	if err != nil || job.CustomerID != customer.ID {
+		return nil, ErrJobRequestNotFound
+	}
+	if job.Status != models.JobRequestOpen {
+		return nil, ErrJobRequestClosed
+	}
+	job.Status = models.JobRequestCancelled
+	if err := s.store.UpdateJob(ctx, job, models.JobRequestOpen); err != nil {
+		if errors.Is(err, ErrJobRequestStateChanged) {
+			return nil, ErrJobRequestClosed
+		}
+		return nil, err
+	}
+	s.rejectOpenQuotes(ctx, job.ID, primitive.NilObjectID)
+	return job, nil
+}
+
+// SubmitQuote makes the provider's quote on an open job, or revises it. Revising
+// answers a counter-offer and puts the quote back to the customer.
+func (s *JobService) SubmitQuote(ctx context.Context, provider *models.User, jobID primitive.ObjectID, in QuoteInput) (*models.Quote, error) {
+	job, err := s.store.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.CustomerID == provider.ID {
+		return nil, ErrBookingForbidden
+	}
+	if !s.jobOpen(job) {
+		return nil, ErrJobRequestClosed
+	}
+
+	now := s.now()
+	currency, ok := models.NormalizeCurrency(in.Currency)
+	if in.Currency == "" {
+		currency, ok = models.CurrencyUSD, true
+	}
+	expiresAt := now.Add(defaultQuoteValidity)
+	if in.ExpiresAt != nil {
+		expiresAt = *in.ExpiresAt
+	}
+	switch {
+	case in.Price <= 0:
+		return nil, fmt.Errorf("%w: price must be positive", ErrInvalidQuote)
+	case !ok:
+		return nil, models.ErrUnsupportedCurrency
+	case in.Duration < minQuoteDuration || time.Duration(in.Duration)*time.Minute > maxJobDuration:
+		return nil, fmt.Errorf("%w: duration must be between %d minutes and %d hours", ErrInvalidQuote, minQuoteDuration, int(maxJobDuration/time.Hour))
+	case !expiresAt.After(now) || expiresAt.Sub(now) > maxQuoteValidity:
+		return nil, fmt.Errorf("%w: expires_at must be within %d days", ErrInvalidQuote, int(maxQuoteValidity/(24*time.Hour)))
+	case !bookingScheduleValid(in.ScheduledDate):
+		return nil, ErrInvalidBookingSchedule
+	}
+
+	quote, err := s.providerQuote(ctx, jobID, provider.ID)
+	switch {
+	case errors.Is(err, ErrQuoteNotFound):
+		quote = &models.Quote{JobRequestID: jobID, ProviderID: provider.ID}
+	case err != nil:
+		return nil, err
+	case quote.Status == models.QuoteAccepted || quote.Status == models.QuoteRejected:
+		return nil, ErrQuoteClosed
+	}
+	quote.Price = roundMinor(in.Price)
+	quote.Currency = currency
+	quote.Duration = in.Duration
+	quote.ScheduledDate = in.ScheduledDate.UTC()
+	quote.Message = strings.TrimSpace(in.Message)
+	quote.ExpiresAt = expiresAt
+	quote.Status = models.QuotePending
+	quote.CounterPrice = nil
+	quote.Offers = append(quote.Offers, models.QuoteOffer{By: models.ProviderRole, Price: quote.Price, Message: quote.Message, At: now})
+
+	// The start time has to be free in the provider's calendar now; it is checked again on acceptance
+	if err := s.availability.CheckSlot(ctx, quotedService(job, quote), quote.ScheduledDate); err != nil {
+		return nil, err
+	}
+	if quote.ID.IsZero() {
+		err = s.store.CreateQuote(ctx, quote)
+		if errors.Is(err, ErrDuplicateQuote) {
+			err = ErrQuoteStateChanged
+		}
+	} else {
+		err = s.store.UpdateQuote(ctx, quote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return presentQuote(quote, now), nil
+}
+
+// Quotes returns the quotes on a job: all of them to its customer and admins,
+// only their own to a provider
+func (s *JobService) Quotes(ctx context.Context, user *models.User, jobID primitive.ObjectID) ([]models.Quote, error) {
+	job, err := s.GetRequest(ctx, user, jobID)
+	if err != nil {
+		return nil, err
+	}
+	quotes, err := s.store.ListQuotes(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	out := quotes[:0]
+	for i := range quotes {
+		if user.Role == models.ProviderRole && quotes[i].ProviderID != user.ID && job.CustomerID != user.ID {
+			continue
+		}
+		out = append(out, *presentQuote(&quotes[i], now))
+	}
+	return out, nil
+}
+
+// ProviderQuotes returns the provider's quotes, newest first
+func (s *JobService) ProviderQuotes(ctx context.Context, provider *models.User, limit int) ([]models.Quote, error) {
+	quotes, err := s.store.ListProviderQuotes(ctx, provider.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	for i := range quotes {
+		presentQuote(&quotes[i], now)
+	}
+	return quotes, nil
+}
+
+// Counter proposes another price to the provider, who answers by revising the quote
+func (s *JobService) Counter(ctx context.Context, customer *models.User, quoteID primitive.ObjectID, price float64, message string) (*models.Quote, error) {
+	_, quote, err := s.customerQuote(ctx, customer, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Status == models.QuoteCountered {
+		return nil, ErrQuoteCountered
+	}
+	if price <= 0 {
+		return nil, fmt.Errorf("%w: price must be positive", ErrInvalidQuote)
+	}
+	price = roundMinor(price)
+	quote.Status = models.QuoteCountered
+	quote.CounterPrice = &price
+	quote.Offers = append(quote.Offers, models.QuoteOffer{By: models.CustomerRole, Price: price, Message: strings.TrimSpace(message), At: s.now()})
+	if err := s.store.UpdateQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return presentQuote(quote, s.now()), nil
+}
+
+// Reject turns the quote down; the job stays open for other quotes
+func (s *JobService) Reject(ctx context.Context, customer *models.User, quoteID primitive.ObjectID) (*models.Quote, error) {
+	_, quote, err := s.customerQuote(ctx, customer, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	quote.Status = models.QuoteRejected
+	if err := s.store.UpdateQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// Accept books the job with the quote's provider at the agreed price and start
+// time and rejects the other quotes. With payFromWallet and escrow wired, the
+// booking is then paid into escrow from the customer's wallet; when that fails
+// the booking stands and PaymentError says why. When another booking takes the
+// provider's slot first, Accept fails with ErrSlotUnavailable and reopens the
+// job and the quote.
+func (s *JobService) Accept(ctx context.Context, customer *models.User, quoteID primitive.ObjectID, payFromWallet bool) (*JobAcceptance, error) {
+	job, quote, err := s.customerQuote(ctx, customer, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Status == models.QuoteCountered {
+		return nil, ErrQuoteCountered
+	}
+
+	// Claim the job, then the quote, so a job is booked once and the provider
+	// cannot revise the quote underneath the acceptance
+	job.Status = models.JobRequestBooked
+	job.QuoteID = &quote.ID
+	if err := s.store.UpdateJob(ctx, job, models.JobRequestOpen); err != nil {
+		if errors.Is(err, ErrJobRequestStateChanged) {
+			return nil, ErrJobRequestClosed
+		}
+		return nil, err
+	}
+	quote.Status = models.QuoteAccepted
+	if err := s.store.UpdateQuote(ctx, quote); err != nil {
+		s.reopen(ctx, job)
+		return nil, err
+	}
+	booking, err := s.bookings.CreateFromQuote(ctx, customer, job, quote)
+	if err != nil {
+		quote.Status = models.QuotePending
+		if rollbackErr := s.store.UpdateQuote(ctx, quote); rollbackErr != nil {
+			s.logger.Error("Failed to reopen quote", zap.Error(rollbackErr), zap.String("quote_id", quote.ID.Hex()))
+		}
+		s.reopen(ctx, job)
+		return nil, err
+	}
+
+	job.BookingID = &booking.ID
+	if err := s.store.UpdateJob(ctx, job, models.JobRequestBooked); err != nil {
+		s.logger.Error("Failed to link booking to job request", zap.Error(err), zap.String("job_request_id", job.ID.Hex()), zap.String("booking_id", booking.ID.Hex()))
+	}
+	s.rejectOpenQuotes(ctx, job.ID, quote.ID)
+
+	out := &JobAcceptance{Job: job, Quote: quote, Booking: booking}
+	if payFromWallet && s.escrow != nil {
+		out.Escrow, err = s.escrow.PayFromWallet(ctx, customer, booking.ID, "", nil)
+		if err != nil {
+			out.PaymentError = err.Error()
+			if !errors.Is(err, ErrInsufficientBalance) {
+				s.logger.Error("Failed to pay accepted quote from wallet", zap.Error(err), zap.String("booking_id", booking.ID.Hex()))
+				out.PaymentError = "wallet payment failed"
+			}
+		}
+	}
+	return out, nil
+}
+
+// customerQuote loads an open quote on one of the customer's open job requests
+func (s *JobService) customerQuote(ctx context.Context, customer *models.User, quoteID primitive.ObjectID) (*models.JobRequest, *models.Quote, error) {
+	quote, err := s.store.GetQuote(ctx, quoteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	job, err := s.store.GetJob(ctx, quote.JobRequestID)
+	if err != nil || job.CustomerID != customer.ID {
+		return nil, nil, ErrQuoteNotFound
+	}
+	if !s.jobOpen(job) {
+		return nil, nil, ErrJobRequestClosed
+	}
+	if !quote.Open(s.now()) {
+		return nil, nil, ErrQuoteClosed
+	}
+	return job, quote, nil
+}
+
+func (s *JobService) providerQuote(ctx context.Context, jobID, providerID primitive.ObjectID) (*models.Quote, error) {
+	quotes, err := s.store.ListQuotes(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range quotes {
+		if quotes[i].ProviderID == providerID {
+			return &quotes[i], nil
+		}
+	}
+	return nil, ErrQuoteNotFound
+}
+
+func (s *JobService) jobOpen(job *models.JobRequest) bool {
+	return job.Status == models.JobRequestOpen && s.now().Before(job.ExpiresAt)
+}
+
+// reopen undoes a claim on the job after the acceptance failed
+func (s *JobService) reopen(ctx context.Context, job *models.JobRequest) {
+	job.Status = models.JobRequestOpen
+	job.QuoteID = nil
+	if err := s.store.UpdateJob(ctx, job, models.JobRequestBooked); err != nil {
+		s.logger.Error("Failed to reopen job request", zap.Error(err), zap.String("job_request_id", job.ID.Hex()))
+	}
+}
+
+// rejectOpenQuotes closes the job's pending and countered quotes other than keep
+func (s *JobService) rejectOpenQuotes(ctx context.Context, jobID, keep primitive.ObjectID) {
+	quotes, err := s.store.ListQuotes(ctx, jobID)
+	if err != nil {
+		s.logger.Error("Failed to list quotes to reject", zap.Error(err), zap.String("job_request_id", jobID.Hex()))
+		return
+	}
+	for i := range quotes {
+		quote := &quotes[i]
+		if quote.ID == keep || (quote.Status != models.QuotePending && quote.Status != models.QuoteCountered) {
+			continue
+		}
+		quote.Status = models.QuoteRejected
+		if err := s.store.UpdateQuote(ctx, quote); err != nil {
+			s.logger.Warn("Failed to reject quote", zap.Error(err), zap.String("quote_id", quote.ID.Hex()))
+		}
+	}
+}
+
+// presentQuote reports lapsed open quotes as expired
+func presentQuote(quote *models.Quote, now time.Time) *models.Quote {
+	if (quote.Status == models.QuotePending || quote.Status == models.QuoteCountered) && !now.Before(quote.ExpiresAt) {
+		quote.Status = models.QuoteExpired
+	}
+	return quote
+}
+
+// quotedService describes a quoted job as a service, for calendar checks and
+// as the booking's service snapshot
+func quotedService(job *models.JobRequest, quote *models.Quote) *models.Service {
+	return &models.Service{
+		Name:        job.Title,
+		Description: job.Description,
+		CategoryID:  job.CategoryID,
+		ProviderID:  quote.ProviderID,
+		Price:       quote.Price,
+		Currency:    quote.Currency,
+		Duration:    quote.Duration,
+		Images:      job.Photos,
+		IsActive:    true,
+		Location:    job.Location,
+		Geo:         job.Geo,
+	}
+}
@@ -0,0 +1,204 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var monrovia = models.Address{Street: "Broad Street", City: "Monrovia", Latitude: 6.3005, Longitude: -10.7969}
+
+func TestJobs_QuoteCounterAndAcceptBooksAtTheAgreedPrice(t *testing.T) {
+	ctx := context.TODO()
+	f := newEscrowFixture(t, 0)
+	jobs := services.NewJobService(services.NewMemoryJobStore(), f.repo, f.bookings, nil)
+	jobs.SetEscrow(f.escrow)
+	rival := &models.User{Email: "rival@example.com", Role: models.ProviderRole}
+	if err := f.repo.CreateUser(ctx, rival); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	if _, err := jobs.CreateRequest(ctx, f.customer, services.JobRequestInput{Title: "Fix roof"}); !errors.Is(err, services.ErrInvalidJobRequest) {
+		t.Fatalf("a job without a location must be refused, got %v", err)
+	}
+	job, err := jobs.CreateRequest(ctx, f.customer, services.JobRequestInput{
+		Title:       "Fix leaking zinc roof",
+		Description: "Two sheets blew off in the storm",
+		Photos:      []string{"https://cdn.example.com/roof.jpg"},
+		Location:    monrovia,
+	})
+	if err != nil || job.Status != models.JobRequestOpen {
+		t.Fatalf("create job: %+v, %v", job, err)
+	}
+
+	// Sinkor is about 4 km away; Kakata is well outside the default radius
+	sinkor := models.NewGeoPoint(6.2727, -10.7725)
+	if nearby, err := jobs.Nearby(ctx, f.provider, sinkor, services.DefaultJobRadiusKm, nil); err != nil || len(nearby) != 1 || nearby[0].DistanceKm == nil {
+		t.Fatalf("expected the job near Sinkor, got %+v, %v", nearby, err)
+	}
+	if nearby, _ := jobs.Nearby(ctx, f.provider, models.NewGeoPoint(6.5308, -10.3537), services.DefaultJobRadiusKm, nil); len(nearby) != 0 {
+		t.Fatalf("the job is too far from Kakata, got %+v", nearby)
+	}
+
+	start := openSlot(t, f.repo, &models.Service{ProviderID: f.provider.ID})
+	quote, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 200, Duration: 120, ScheduledDate: start, Message: "Sheets and labour"})
+	if err != nil || quote.Status != models.QuotePending || quote.Currency != "USD" {
+		t.Fatalf("submit quote: %+v, %v", quote, err)
+	}
+	other, err := jobs.SubmitQuote(ctx, rival, job.ID, services.QuoteInput{Price: 260, Duration: 60, ScheduledDate: start})
+	if err != nil {
+		t.Fatalf("rival quote: %v", err)
+	}
+	if _, err := jobs.SubmitQuote(ctx, f.customer, job.ID, services.QuoteInput{Price: 1, Duration: 60, ScheduledDate: start}); !errors.Is(err, services.ErrBookingForbidden) {
+		t.Fatalf("customers cannot quote their own job, got %v", err)
+	}
+	if visible, _ := jobs.Quotes(ctx, rival, job.ID); len(visible) != 1 || visible[0].ID != other.ID {
+		t.Fatalf("providers only see their own quote, got %+v", visible)
+	}
+
+	countered, err := jobs.Counter(ctx, f.customer, quote.ID, 150, "Can you do 150?")
+	if err != nil || countered.Status != models.QuoteCountered || *countered.CounterPrice != 150 {
+		t.Fatalf("counter: %+v, %v", countered, err)
+	}
+	if _, err := jobs.Accept(ctx, f.customer, quote.ID, true); !errors.Is(err, services.ErrQuoteCountered) {
+		t.Fatalf("a countered quote waits for the provider, got %v", err)
+	}
+	revised, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 170, Duration: 120, ScheduledDate: start, Message: "Meet you at 170"})
+	if err != nil || revised.ID != quote.ID || revised.Status != models.QuotePending || len(revised.Offers) != 3 {
+		t.Fatalf("revise: %+v, %v", revised, err)
+	}
+
+	// Nothing in the wallet: the booking stands and can be paid by mobile money
+	accepted, err := jobs.Accept(ctx, f.customer, quote.ID, true)
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	booking := accepted.Booking
+	switch {
+	case booking.Status != models.BookingConfirmed || booking.TotalAmount != 170 || booking.ProviderID != f.provider.ID:
+		t.Fatalf("expected a confirmed 170 USD booking with the provider, got %+v", booking)
+	case booking.QuoteID == nil || *booking.QuoteID != quote.ID || !booking.ScheduledDate.Equal(start):
+		t.Fatalf("booking should carry the quote and its start, got %+v", booking)
+	case accepted.Escrow != nil || accepted.PaymentError == "":
+		t.Fatalf("an empty wallet cannot pay, got %+v", accepted)
+	case accepted.Job.Status != models.JobRequestBooked || *accepted.Job.BookingID != booking.ID:
+		t.Fatalf("job should be booked, got %+v", accepted.Job)
+	}
+	if rejected, _ := jobs.Quotes(ctx, rival, job.ID); rejected[0].Status != models.QuoteRejected {
+		t.Fatalf("the other quote should be rejected, got %+v", rejected[0])
+	}
+	if _, err := jobs.Accept(ctx, f.customer, other.ID, true); !errors.Is(err, services.ErrJobRequestClosed) {
+		t.Fatalf("a job is booked once, got %v", err)
+	}
+	if _, err := f.escrow.PrepareHold(ctx, f.customer, booking.ID); err != nil {
+		t.Fatalf("the booking can still be paid by mobile money: %v", err)
+	}
+	if err := f.bookings.Create(ctx, f.customer, &models.Booking{ServiceID: f.book(t).ServiceID, ScheduledDate: start}); !errors.Is(err, services.ErrSlotUnavailable) {
+		t.Fatalf("the accepted quote holds the provider's slot, got %v", err)
+	}
+}
+
+func TestJobs_AcceptPaysEscrowFromAFundedWallet(t *testing.T) {
+	ctx := context.TODO()
+	f := newEscrowFixture(t, 0)
+	jobs := services.NewJobService(services.NewMemoryJobStore(), f.repo, f.bookings, nil)
+	jobs.SetEscrow(f.escrow)
+	err := f.ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 100, Currency: "USD", Status: models.LedgerCompleted, Reference: "topup-job"})
+	if err != nil {
+		t.Fatalf("top-up: %v", err)
+	}
+
+	job, err := jobs.CreateRequest(ctx, f.customer, services.JobRequestInput{Title: "Rewire kitchen", Location: monrovia})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	start := openSlot(t, f.repo, &models.Service{ProviderID: f.provider.ID})
+	expiresAt := time.Now().Add(time.Hour)
+	quote, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 80, Duration: 90, ScheduledDate: start, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("submit quote: %v", err)
+	}
+	accepted, err := jobs.Accept(ctx, f.customer, quote.ID, true)
+	if err != nil || accepted.PaymentError != "" || accepted.Escrow == nil || accepted.Escrow.Status != models.EscrowHeld {
+		t.Fatalf("expected 80 USD held in escrow, got %+v, %v", accepted, err)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 20 {
+		t.Fatalf("expected 20 USD left, got %+v", bal)
+	}
+
+	f.advance(t, accepted.Booking.ID, models.BookingInProgress, models.BookingCompleted)
+	if bal := f.balances(t, f.provider); bal.Available != 80 {
+		t.Fatalf("provider should be paid 80 USD, got %+v", bal)
+	}
+}
+
+func TestJobs_CancelClosesTheJobAndItsQuotes(t *testing.T) {
+	ctx := context.TODO()
+	f := newEscrowFixture(t, 0)
+	jobs := services.NewJobService(nil, f.repo, f.bookings, nil)
+	job, _ := jobs.CreateRequest(ctx, f.customer, services.JobRequestInput{Title: "Paint fence", Location: monrovia})
+	start := openSlot(t, f.repo, &models.Service{ProviderID: f.provider.ID})
+	quote, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 40, Duration: 60, ScheduledDate: start})
+	if err != nil {
+		t.Fatalf("submit quote: %v", err)
+	}
+
+	if _, err := jobs.CancelRequest(ctx, f.provider, job.ID); !errors.Is(err, services.ErrJobRequestNotFound) {
+		t.Fatalf("only the customer cancels, got %v", err)
+	}
+	if _, err := jobs.CancelRequest(ctx, f.customer, job.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if _, err := jobs.Accept(ctx, f.customer, quote.ID, false); !errors.Is(err, services.ErrJobRequestClosed) {
+		t.Fatalf("a cancelled job cannot be booked, got %v", err)
+	}
+	if _, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 35, Duration: 60, ScheduledDate: start}); !errors.Is(err, services.ErrJobRequestClosed) {
+		t.Fatalf("a cancelled job takes no quotes, got %v", err)
+	}
+	if nearby, _ := jobs.Nearby(ctx, f.provider, monrovia.GeoPoint(), 5, nil); len(nearby) != 0 {
+		t.Fatalf("a cancelled job is not listed, got %+v", nearby)
+	}
+}
+
+// staleSchedule hides every booking from the calendar check, as if another
+// instance took the slot between that check and the insert
+type staleSchedule struct {
+	*database.MemoryDatabase
+}
+
+func (staleSchedule) GetProviderSchedule(context.Context, primitive.ObjectID, time.Time, time.Time) ([]models.Booking, error) {
+	return nil, nil
+}
+
+func TestJobs_AcceptLosingTheSlotRaceReopensTheQuote(t *testing.T) {
+	ctx := context.TODO()
+	f := newEscrowFixture(t, 0)
+	repo := staleSchedule{f.repo}
+	jobs := services.NewJobService(nil, repo, services.NewBookingService(repo, nil), nil)
+	job, _ := jobs.CreateRequest(ctx, f.customer, services.JobRequestInput{Title: "Fix gate", Location: monrovia})
+	start := openSlot(t, f.repo, &models.Service{ProviderID: f.provider.ID})
+	quote, err := jobs.SubmitQuote(ctx, f.provider, job.ID, services.QuoteInput{Price: 60, Duration: 60, ScheduledDate: start})
+	if err != nil {
+		t.Fatalf("submit quote: %v", err)
+	}
+	if booked := f.book(t); !booked.ScheduledDate.Equal(start) {
+		t.Fatalf("expected the direct booking to take %s, got %s", start, booked.ScheduledDate)
+	}
+
+	if _, err := jobs.Accept(ctx, f.customer, quote.ID, false); !errors.Is(err, services.ErrSlotUnavailable) {
+		t.Fatalf("the slot is already booked, got %v", err)
+	}
+	quotes, _ := jobs.Quotes(ctx, f.customer, job.ID)
+	if len(quotes) != 1 || quotes[0].Status != models.QuotePending {
+		t.Fatalf("the quote should be open again, got %+v", quotes)
+	}
+	if reopened, err := jobs.GetRequest(ctx, f.customer, job.ID); err != nil || reopened.Status != models.JobRequestOpen {
+		t.Fatalf("the job should be open again, got %+v, %v", reopened, err)
+	}
+}
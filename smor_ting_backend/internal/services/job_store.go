@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrJobRequestNotFound     = errors.New("job request not found")
+	ErrJobRequestStateChanged = errors.New("job request status changed concurrently")
+	ErrQuoteNotFound          = errors.New("quote not found")
+	ErrQuoteStateChanged      = errors.New("quote changed concurrently")
+	ErrDuplicateQuote         = errors.New("provider has already quoted this job")
+)
+
+// JobQuery filters job requests. Near and RadiusKm find open requests around a
+// provider; without Near, results are newest first.
+type JobQuery struct {
+	CustomerID *primitive.ObjectID
+	Status     models.JobRequestStatus
+	CategoryID *primitive.ObjectID
+	// OpenAt, when set, keeps only requests that have not expired by then
+	OpenAt   *time.Time
+	Near     *models.GeoPoint
+	RadiusKm float64
+	Limit    int
+}
+
+// JobStore persists job requests and the quotes providers make on them.
+// UpdateJob is a compare-and-set on Status and UpdateQuote on Version, so a
+// job is booked once and a quote is never answered twice.
+type JobStore interface {
+	CreateJob(ctx context.Context, job *models.JobRequest) error
+	GetJob(ctx context.Context, id primitive.ObjectID) (*models.JobRequest, error)
+	// UpdateJob replaces the job if its stored status is still from, otherwise returns ErrJobRequestStateChanged
+	UpdateJob(ctx context.Context, job *models.JobRequest, from models.JobRequestStatus) error
+	ListJobs(ctx context.Context, q JobQuery) ([]models.JobRequest, error)
+
+	// CreateQuote returns ErrDuplicateQuote when the provider already quoted the job
+	CreateQuote(ctx context.Context, quote *models.Quote) error
+	GetQuote(ctx context.Context, id primitive.ObjectID) (*models.Quote, error)
+	// UpdateQuote replaces the quote and bumps Version if the stored Version still
+	// matches, otherwise returns ErrQuoteStateChanged
+	UpdateQuote(ctx context.Context, quote *models.Quote) error
+	// ListQuotes returns the job's quotes, oldest first
+	ListQuotes(ctx context.Context, jobID primitive.ObjectID) ([]models.Quote, error)
+	// ListProviderQuotes returns the provider's quotes, newest first
+	ListProviderQuotes(ctx context.Context, providerID primitive.ObjectID, limit int) ([]models.Quote, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryJobStore struct {
+	mu     sync.RWMutex
+	jobs   map[primitive.ObjectID]*models.JobRequest
+	quotes map[primitive.ObjectID]*models.Quote
+}
+
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{
+		jobs:   make(map[primitive.ObjectID]*models.JobRequest),
+		quotes: make(map[primitive.ObjectID]*models.Quote),
+	}
+}
+
+func (m *memoryJobStore) CreateJob(ctx context.Context, job *models.JobRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	cp := *job
+	m.jobs[job.ID] = &cp
+	return nil
+}
+
+func (m *memoryJobStore) GetJob(ctx context.Context, id primitive.ObjectID) (*models.JobRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobRequestNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryJobStore) UpdateJob(ctx context.Context, job *models.JobRequest, from models.JobRequestStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.jobs[job.ID]
+	if !ok {
+		return ErrJobRequestNotFound
+	}
+	if stored.Status != from {
+		return ErrJobRequestStateChanged
+	}
+	job.UpdatedAt = time.Now()
+	cp := *job
+	cp.DistanceKm = nil
+	m.jobs[job.ID] = &cp
+	return nil
+}
+
+func (m *memoryJobStore) ListJobs(ctx context.Context, q JobQuery) ([]models.JobRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.JobRequest{}
+	for _, job := range m.jobs {
+		switch {
+		case q.CustomerID != nil && job.CustomerID != *q.CustomerID,
+			q.Status != "" && job.Status != q.Status,
+			q.CategoryID != nil && job.CategoryID != *q.CategoryID,
+			q.OpenAt != nil && !q.OpenAt.Before(job.ExpiresAt):
+			continue
+		}
+		cp := *job
+		if q.Near != nil {
+			if job.Geo == nil {
+				continue
+			}
+			d := database.HaversineKm(q.Near, job.Geo)
+			if d > q.RadiusKm {
+				continue
+			}
+			cp.DistanceKm = &d
+		}
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if q.Near != nil && *out[i].DistanceKm != *out[j].DistanceKm {
+			return *out[i].DistanceKm < *out[j].DistanceKm
+		}
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func (m *memoryJobStore) CreateQuote(ctx context.Context, quote *models.Quote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.quotes {
+		if existing.JobRequestID == quote.JobRequestID && existing.ProviderID == quote.ProviderID {
+			return ErrDuplicateQuote
+		}
+	}
+	if quote.ID.IsZero() {
+		quote.ID = primitive.NewObjectID()
+	}
+	quote.Version = 1
+	quote.CreatedAt = time.Now()
+	quote.UpdatedAt = quote.CreatedAt
+	m.quotes[quote.ID] = copyQuote(quote)
+	return nil
+}
+
+func (m *memoryJobStore) GetQuote(ctx context.Context, id primitive.ObjectID) (*models.Quote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.quotes[id]
+	if !ok {
+		return nil, ErrQuoteNotFound
+	}
+	return copyQuote(stored), nil
+}
+
+func (m *memoryJobStore) UpdateQuote(ctx context.Context, quote *models.Quote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.quotes[quote.ID]
+	if !ok {
+		return ErrQuoteNotFound
+	}
+	if stored.Version != quote.Version {
+		return ErrQuoteStateChanged
+	}
+	quote.Version++
+	quote.UpdatedAt = time.Now()
+	m.quotes[quote.ID] = copyQuote(quote)
+	return nil
+}
+
+func (m *memoryJobStore) ListQuotes(ctx context.Context, jobID primitive.ObjectID) ([]models.Quote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.Quote{}
+	for _, quote := range m.quotes {
+		if quote.JobRequestID == jobID {
+			out = append(out, *copyQuote(quote))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryJobStore) ListProviderQuotes(ctx context.Context, providerID primitive.ObjectID, limit int) ([]models.Quote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.Quote{}
+	for _, quote := range m.quotes {
+		if quote.ProviderID == providerID {
+			out = append(out, *copyQuote(quote))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// copyQuote copies the quote and its offers so stored quotes are never shared
+func copyQuote(quote *models.Quote) *models.Quote {
+	cp := *quote
+	cp.Offers = append([]models.QuoteOffer(nil), quote.Offers...)
+	if quote.CounterPrice != nil {
+		price := *quote.CounterPrice
+		cp.CounterPrice = &price
+	}
+	return &cp
+}
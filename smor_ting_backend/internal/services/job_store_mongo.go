@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoJobStore persists job requests in the job_requests collection and
+// quotes in the job_quotes collection
+type MongoJobStore struct {
+	jobs   *mongo.Collection
+	quotes *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoJobStore(db *mongo.Database, logger *logger.Logger) (*MongoJobStore, error) {
+	s := &MongoJobStore{jobs: db.Collection("job_requests"), quotes: db.Collection("job_quotes"), logger: logger}
+	_, _ = s.jobs.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{
+			Keys:    bson.M{"geo": "2dsphere"},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"geo.type": "Point"}),
+		},
+	})
+	_, _ = s.quotes.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "job_request_id", Value: 1}, {Key: "provider_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "provider_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoJobStore) CreateJob(ctx context.Context, job *models.JobRequest) error {
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	_, err := m.jobs.InsertOne(ctx, job)
+	return err
+}
+
+func (m *MongoJobStore) GetJob(ctx context.Context, id primitive.ObjectID) (*models.JobRequest, error) {
+	var out models.JobRequest
+	if err := m.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrJobRequestNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoJobStore) UpdateJob(ctx context.Context, job *models.JobRequest, from models.JobRequestStatus) error {
+	job.UpdatedAt = time.Now()
+	res, err := m.jobs.ReplaceOne(ctx, bson.M{"_id": job.ID, "status": from}, job)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.GetJob(ctx, job.ID); err != nil {
+			return err
+		}
+		return ErrJobRequestStateChanged
+	}
+	return nil
+}
+
+func (m *MongoJobStore) ListJobs(ctx context.Context, q JobQuery) ([]models.JobRequest, error) {
+	filter := bson.M{}
+	if q.CustomerID != nil {
+		filter["customer_id"] = *q.CustomerID
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	if q.CategoryID != nil {
+		filter["category_id"] = *q.CategoryID
+	}
+	if q.OpenAt != nil {
+		filter["expires_at"] = bson.M{"$gt": *q.OpenAt}
+	}
+	opts := options.Find()
+	if q.Near != nil {
+		// $nearSphere returns the nearest first
+		filter["geo"] = bson.M{"$nearSphere": bson.M{"$geometry": q.Near, "$maxDistance": q.RadiusKm * 1000}}
+		// Matches the partial filter of the 2dsphere index so the planner can use it
+		filter["geo.type"] = "Point"
+	} else {
+		opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+	cur, err := m.jobs.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.JobRequest{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	if q.Near != nil {
+		for i := range out {
+			if out[i].Geo != nil {
+				d := database.HaversineKm(q.Near, out[i].Geo)
+				out[i].DistanceKm = &d
+			}
+		}
+	}
+	return out, nil
+}
+
+func (m *MongoJobStore) CreateQuote(ctx context.Context, quote *models.Quote) error {
+	if quote.ID.IsZero() {
+		quote.ID = primitive.NewObjectID()
+	}
+	quote.Version = 1
+	quote.CreatedAt = time.Now()
+	quote.UpdatedAt = quote.CreatedAt
+	_, err := m.quotes.InsertOne(ctx, quote)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateQuote
+	}
+	return err
+}
+
+func (m *MongoJobStore) GetQuote(ctx context.Context, id primitive.ObjectID) (*models.Quote, error) {
+	var out models.Quote
+	if err := m.quotes.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrQuoteNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoJobStore) UpdateQuote(ctx context.Context, quote *models.Quote) error {
+	from := quote.Version
+	quote.Version++
+	quote.UpdatedAt = time.Now()
+	res, err := m.quotes.ReplaceOne(ctx, bson.M{"_id": quote.ID, "version": from}, quote)
+	if err != nil {
+		quote.Version = from
+		return err
+	}
+	if res.MatchedCount == 0 {
+		quote.Version = from
+		if _, err := m.GetQuote(ctx, quote.ID); err != nil {
+			return err
+		}
+		return ErrQuoteStateChanged
+	}
+	return nil
+}
+
+func (m *MongoJobStore) ListQuotes(ctx context.Context, jobID primitive.ObjectID) ([]models.Quote, error) {
+	return m.findQuotes(ctx, bson.M{"job_request_id": jobID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+}
+
+func (m *MongoJobStore) ListProviderQuotes(ctx context.Context, providerID primitive.ObjectID, limit int) ([]models.Quote, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return m.findQuotes(ctx, bson.M{"provider_id": providerID}, opts)
+}
+
+func (m *MongoJobStore) findQuotes(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Quote, error) {
+	cur, err := m.quotes.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.Quote{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,6 +9,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Minimal MTN MoMo client scaffold to integrate Collection and Disbursement
@@ -23,10 +24,12 @@ type MomoClient struct {
 	apiKey             string
 	subKeyCollection   string
 	subKeyDisbursement string
+	collectionTokens   *momoTokenCache
+	disbursementTokens *momoTokenCache
 }
 
 func NewMomoClient(baseURL, targetEnv, apiUser, apiKey, subCollection, subDisbursement string) *MomoClient {
-	return &MomoClient{
+	c := &MomoClient{
 		httpClient:         &http.Client{Timeout: 30 * time.Second},
 		baseURL:            strings.TrimRight(baseURL, "/"),
 		targetEnv:          targetEnv,
@@ -35,6 +38,13 @@ func NewMomoClient(baseURL, targetEnv, apiUser, apiKey, subCollection, subDisbur
 		subKeyCollection:   subCollection,
 		subKeyDisbursement: subDisbursement,
 	}
+	c.collectionTokens = newMomoTokenCache(func(ctx context.Context) (*momoToken, error) {
+		return c.fetchToken(ctx, "collection", c.subKeyCollection)
+	})
+	c.disbursementTokens = newMomoTokenCache(func(ctx context.Context) (*momoToken, error) {
+		return c.fetchToken(ctx, "disbursement", c.subKeyDisbursement)
+	})
+	return c
 }
 
 // Online-only guard; caller should prevent offline wallet actions
@@ -60,32 +70,21 @@ func (c *MomoClient) basicAuth() string {
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.apiUser+":"+c.apiKey))
 }
 
+// GetCollectionToken returns the cached collection token, refreshing it when it is about to expire
 func (c *MomoClient) GetCollectionToken(ctx context.Context) (*momoToken, error) {
-	url := c.baseURL + "/collection/token/"
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
-	req.Header.Set("Authorization", c.basicAuth())
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyCollection)
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("collection token failed: %s", string(b))
-	}
-	var t momoToken
-	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
-		return nil, err
-	}
-	return &t, nil
+	return c.collectionTokens.Get(ctx)
 }
 
+// GetDisbursementToken returns the cached disbursement token, refreshing it when it is about to expire
 func (c *MomoClient) GetDisbursementToken(ctx context.Context) (*momoToken, error) {
-	url := c.baseURL + "/disbursement/token/"
+	return c.disbursementTokens.Get(ctx)
+}
+
+func (c *MomoClient) fetchToken(ctx context.Context, product, subKey string) (*momoToken, error) {
+	url := c.baseURL + "/" + product + "/token/"
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	req.Header.Set("Authorization", c.basicAuth())
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyDisbursement)
+	req.Header.Set("Ocp-Apim-Subscription-Key", subKey)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -93,7 +92,7 @@ func (c *MomoClient) GetDisbursementToken(ctx context.Context) (*momoToken, erro
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("disbursement token failed: %s", string(b))
+		return nil, fmt.Errorf("%s token failed: %s", product, string(b))
 	}
 	var t momoToken
 	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
@@ -102,12 +101,34 @@ func (c *MomoClient) GetDisbursementToken(ctx context.Context) (*momoToken, erro
 	return &t, nil
 }
 
+// do sends the request built for a token from tokens. If MoMo rejects the token
+// with 401 it is dropped from the cache and the request is sent once more with a
+// fresh one; the X-Reference-Id is unchanged, so MoMo cannot apply it twice.
+func (c *MomoClient) do(ctx context.Context, tokens *momoTokenCache, build func(tok *momoToken) *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		tok, err := tokens.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(build(tok))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		tokens.Invalidate(tok)
+	}
+}
+
 // Collection request-to-pay
 type Party struct {
 	PartyIdType string `json:"partyIdType"`
 	PartyId     string `json:"partyId"`
 }
 type RequestToPay struct {
+	ReferenceID  string `json:"-"` // sent as X-Reference-Id; generated when empty
 	Amount       string `json:"amount"`
 	Currency     string `json:"currency"`
 	ExternalId   string `json:"externalId"`
@@ -117,42 +138,41 @@ type RequestToPay struct {
 }
 
 func (c *MomoClient) RequestToPay(ctx context.Context, body RequestToPay) (string, error) {
-	tok, err := c.GetCollectionToken(ctx)
-	if err != nil {
-		return "", err
+	ref := body.ReferenceID
+	if ref == "" {
+		ref = NewMomoReferenceID()
 	}
-	ref := randomUUID()
 	url := c.baseURL + "/collection/v1_0/requesttopay"
 	data, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(data)))
-	req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyCollection)
-	req.Header.Set("X-Target-Environment", c.targetEnv)
-	req.Header.Set("X-Reference-Id", ref)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, c.collectionTokens, func(tok *momoToken) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(data)))
+		req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
+		req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyCollection)
+		req.Header.Set("X-Target-Environment", c.targetEnv)
+		req.Header.Set("X-Reference-Id", ref)
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	})
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusAccepted {
 		b, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("r2p failed: %s", string(b))
+		return "", paymentRequestError("r2p", resp.StatusCode, b)
 	}
 	return ref, nil
 }
 
 func (c *MomoClient) GetRequestToPayStatus(ctx context.Context, referenceId string) (string, error) {
-	tok, err := c.GetCollectionToken(ctx)
-	if err != nil {
-		return "", err
-	}
 	url := c.baseURL + "/collection/v1_0/requesttopay/status/" + referenceId
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyCollection)
-	req.Header.Set("X-Target-Environment", c.targetEnv)
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, c.collectionTokens, func(tok *momoToken) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
+		req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyCollection)
+		req.Header.Set("X-Target-Environment", c.targetEnv)
+		return req
+	})
 	if err != nil {
 		return "", err
 	}
@@ -172,6 +192,7 @@ func (c *MomoClient) GetRequestToPayStatus(ctx context.Context, referenceId stri
 
 // Disbursement transfer
 type TransferRequest struct {
+	ReferenceID  string `json:"-"` // sent as X-Reference-Id; generated when empty
 	Amount       string `json:"amount"`
 	Currency     string `json:"currency"`
 	ExternalId   string `json:"externalId"`
@@ -181,42 +202,41 @@ type TransferRequest struct {
 }
 
 func (c *MomoClient) Transfer(ctx context.Context, body TransferRequest) (string, error) {
-	tok, err := c.GetDisbursementToken(ctx)
-	if err != nil {
-		return "", err
+	ref := body.ReferenceID
+	if ref == "" {
+		ref = NewMomoReferenceID()
 	}
-	ref := randomUUID()
 	url := c.baseURL + "/disbursement/v1_0/transfer"
 	data, _ := json.Marshal(body)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(data)))
-	req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyDisbursement)
-	req.Header.Set("X-Reference-Id", ref)
-	req.Header.Set("X-Target-Environment", c.targetEnv)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, c.disbursementTokens, func(tok *momoToken) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(data)))
+		req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
+		req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyDisbursement)
+		req.Header.Set("X-Reference-Id", ref)
+		req.Header.Set("X-Target-Environment", c.targetEnv)
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	})
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusAccepted {
 		b, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("transfer failed: %s", string(b))
+		return "", paymentRequestError("transfer", resp.StatusCode, b)
 	}
 	return ref, nil
 }
 
 func (c *MomoClient) GetTransferStatus(ctx context.Context, referenceId string) (string, error) {
-	tok, err := c.GetDisbursementToken(ctx)
-	if err != nil {
-		return "", err
-	}
 	url := c.baseURL + "/disbursement/v1_0/transfer/status/" + referenceId
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyDisbursement)
-	req.Header.Set("X-Target-Environment", c.targetEnv)
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, c.disbursementTokens, func(tok *momoToken) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		req.Header.Set("Authorization", tok.TokenType+" "+tok.AccessToken)
+		req.Header.Set("Ocp-Apim-Subscription-Key", c.subKeyDisbursement)
+		req.Header.Set("X-Target-Environment", c.targetEnv)
+		return req
+	})
 	if err != nil {
 		return "", err
 	}
@@ -234,8 +254,8 @@ func (c *MomoClient) GetTransferStatus(ctx context.Context, referenceId string)
 	return out.Status, nil
 }
 
-func randomUUID() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
+// NewMomoReferenceID returns a UUID v4 for X-Reference-Id. Callers generate it up
+// front so the operation can be recorded locally before MoMo is called.
+func NewMomoReferenceID() string {
+	return uuid.NewString()
 }
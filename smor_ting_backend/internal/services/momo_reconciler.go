@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.uber.org/zap"
+)
+
+// reconcileBatchSize bounds how many pending entries one run polls
+const reconcileBatchSize = 200
+
+// An entry the provider will not settle is polled again after a backoff that
+// starts at the worker's interval and doubles up to reconcileMaxBackoff, so it
+// cannot keep newer entries out of the batch; after reconcileMaxAttempts polls
+// it is left for review.
+const (
+	reconcileMaxAttempts = 10
+	reconcileMaxBackoff  = 24 * time.Hour
+)
+
+// ReconcileResult summarises one reconciliation run
+type ReconcileResult struct {
+	Checked      int `json:"checked"`
+	Settled      int `json:"settled"`
+	Failed       int `json:"failed"`
+	StillPending int `json:"still_pending"`
+	Errors       int `json:"errors"`
+	NeedsReview  int `json:"needs_review"`
+}
+
+// MomoReconciler settles payment intents (top-ups, withdrawals, escrow holds)
+// whose MoMo callback never arrived by polling MoMo for their status, and writes
+// a daily report of every intent whose status disagrees with the provider
+type MomoReconciler struct {
+	providers  *PaymentProviders
+	entries    WalletEntryStore
+	webhooks   *MomoWebhookService
+	reports    ReconciliationReportStore
+	staleAfter time.Duration
+	interval   time.Duration
+	logger     *zap.Logger
+
+	mu             sync.Mutex
+	isRunning      bool
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+	lastReportDate string
+}
+
+// NewMomoReconciler creates a reconciler. Pending entries older than staleAfter
+// are polled every interval at the provider each was sent to; settlements go
+// through webhooks so that a late callback for the same reference is recognised
+// as a duplicate.
+func NewMomoReconciler(providers *PaymentProviders, entries WalletEntryStore, webhooks *MomoWebhookService, reports ReconciliationReportStore, staleAfter, interval time.Duration, logger *zap.Logger) *MomoReconciler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if reports == nil {
+		reports = NewMemoryReconciliationStore()
+	}
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	return &MomoReconciler{
+		providers:  providers,
+		entries:    entries,
+		webhooks:   webhooks,
+		reports:    reports,
+		staleAfter: staleAfter,
+		interval:   interval,
+		logger:     logger,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// RunOnce polls MoMo for every stale pending entry and settles the ones with a final status
+func (r *MomoReconciler) RunOnce(ctx context.Context) (*ReconcileResult, error) {
+	pending, err := r.entries.ListPending(ctx, time.Now().Add(-r.staleAfter), reconcileBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReconcileResult{}
+	for i := range pending {
+		entry := &pending[i]
+		result.Checked++
+		status, err := r.providerStatus(ctx, entry)
+		if err != nil {
+			result.Errors++
+			r.logger.Warn("Failed to poll payment status", zap.Error(err), zap.String("provider", entry.Provider),
+				zap.String("reference_id", entry.Reference), zap.String("type", string(entry.Type)))
+			r.deferEntry(ctx, entry, result)
+			continue
+		}
+		if status == "PENDING" {
+			result.StillPending++
+			r.deferEntry(ctx, entry, result)
+			continue
+		}
+		_, err = r.webhooks.Apply(ctx, &PaymentCallback{
+			Type:        string(entry.Type),
+			Status:      status,
+			Amount:      entry.Amount,
+			Currency:    entry.Currency,
+			UserID:      entry.UserID.Hex(),
+			ReferenceID: entry.Reference,
+			ProviderRef: entry.ProviderRef,
+			Provider:    entry.Provider,
+		})
+		if err != nil && !errors.Is(err, ErrWebhookDuplicate) {
+			result.Errors++
+			r.logger.Error("Failed to settle pending entry", zap.Error(err), zap.String("reference_id", entry.Reference))
+			r.deferEntry(ctx, entry, result)
+			continue
+		}
+		if status == "SUCCESSFUL" {
+			result.Settled++
+		} else {
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// deferEntry backs off the next poll of an entry that is still unsettled, or
+// leaves it for review once it has used up its attempts
+func (r *MomoReconciler) deferEntry(ctx context.Context, entry *models.WalletLedgerEntry, result *ReconcileResult) {
+	attempts := entry.ReconcileAttempts + 1
+	var next *time.Time
+	if attempts < reconcileMaxAttempts {
+		backoff := reconcileMaxBackoff
+		if shift := attempts - 1; shift < 32 && r.interval<<shift < reconcileMaxBackoff {
+			backoff = r.interval << shift
+		}
+		at := time.Now().Add(backoff)
+		next = &at
+	}
+	if err := r.entries.DeferReconcile(ctx, entry.ID, attempts, next); err != nil {
+		if !errors.Is(err, ErrWalletEntrySettled) {
+			r.logger.Error("Failed to defer reconciliation", zap.Error(err), zap.String("reference_id", entry.Reference))
+		}
+		return
+	}
+	if next == nil {
+		result.NeedsReview++
+		r.logger.Error("Giving up reconciling payment intent; it needs review", zap.String("provider", entry.Provider),
+			zap.String("reference_id", entry.Reference), zap.String("type", string(entry.Type)), zap.Int("attempts", attempts))
+	}
+}
+
+// GenerateReport checks every entry created on day (UTC) against MoMo and saves the mismatches
+func (r *MomoReconciler) GenerateReport(ctx context.Context, day time.Time) (*models.ReconciliationReport, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	entries, err := r.entries.ListCreatedBetween(ctx, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	report := &models.ReconciliationReport{
+		Date:       from.Format("2006-01-02"),
+		Mismatches: []models.ReconciliationMismatch{},
+	}
+	for i := range entries {
+		entry := &entries[i]
+		report.Checked++
+		status, err := r.providerStatus(ctx, entry)
+		if err == nil && ledgerStatusForProvider(status) == entry.Status {
+			report.Matched++
+			continue
+		}
+		mismatch := models.ReconciliationMismatch{
+			EntryID:        entry.ID,
+			UserID:         entry.UserID,
+			Type:           entry.Type,
+			Reference:      entry.Reference,
+			Amount:         entry.Amount,
+			Currency:       entry.Currency,
+			LedgerStatus:   entry.Status,
+			ProviderStatus: status,
+		}
+		if err != nil {
+			mismatch.Error = err.Error()
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	report.GeneratedAt = time.Now()
+	if err := r.reports.Save(ctx, report); err != nil {
+		return nil, err
+	}
+	if len(report.Mismatches) > 0 {
+		r.logger.Warn("MoMo reconciliation found mismatches",
+			zap.String("date", report.Date), zap.Int("checked", report.Checked), zap.Int("mismatches", len(report.Mismatches)))
+	}
+	return report, nil
+}
+
+// Report returns the saved report for a YYYY-MM-DD date
+func (r *MomoReconciler) Report(ctx context.Context, date string) (*models.ReconciliationReport, error) {
+	return r.reports.GetByDate(ctx, date)
+}
+
+// providerStatus asks the entry's provider for its normalised status
+func (r *MomoReconciler) providerStatus(ctx context.Context, entry *models.WalletLedgerEntry) (string, error) {
+	op, ok := paymentOperationFor(entry.Type)
+	if !ok {
+		return "", fmt.Errorf("%s entries are not reconciled with a payment provider", entry.Type)
+	}
+	provider, err := r.providers.Get(entry.Provider)
+	if err != nil {
+		return "", err
+	}
+	return provider.Status(ctx, op, entry.Reference)
+}
+
+// ledgerStatusForProvider maps a normalised MoMo status onto the ledger status it should produce
+func ledgerStatusForProvider(status string) models.LedgerStatus {
+	switch status {
+	case PaymentStatusSuccessful:
+		return models.LedgerCompleted
+	case PaymentStatusFailed:
+		return models.LedgerFailed
+	default:
+		return models.LedgerPending
+	}
+}
+
+// Start runs RunOnce on a ticker and writes the previous day's report once per UTC day
+func (r *MomoReconciler) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.isRunning {
+		return fmt.Errorf("momo reconciler is already running")
+	}
+	r.isRunning = true
+	r.wg.Add(1)
+	go r.run(ctx)
+	r.logger.Info("MoMo reconciler started", zap.Duration("interval", r.interval), zap.Duration("stale_after", r.staleAfter))
+	return nil
+}
+
+// Stop stops the reconciler
+func (r *MomoReconciler) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.isRunning {
+		return fmt.Errorf("momo reconciler is not running")
+	}
+	close(r.stopChan)
+	r.wg.Wait()
+	r.isRunning = false
+	r.logger.Info("MoMo reconciler stopped")
+	return nil
+}
+
+func (r *MomoReconciler) run(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+			if res, err := r.RunOnce(ctx); err != nil {
+				r.logger.Error("MoMo reconciliation run failed", zap.Error(err))
+			} else if res.Checked > 0 {
+				r.logger.Info("MoMo reconciliation run", zap.Int("checked", res.Checked), zap.Int("settled", res.Settled),
+					zap.Int("failed", res.Failed), zap.Int("still_pending", res.StillPending), zap.Int("errors", res.Errors),
+					zap.Int("needs_review", res.NeedsReview))
+			}
+			r.reportIfDue(ctx, time.Now().UTC())
+		}
+	}
+}
+
+// reportIfDue writes yesterday's report the first time the worker runs on a new
+// UTC day. A saved report for yesterday counts as done, so a restart does not
+// poll the provider for the whole day again.
+func (r *MomoReconciler) reportIfDue(ctx context.Context, now time.Time) {
+	today := now.Format("2006-01-02")
+	if r.lastReportDate == today {
+		return
+	}
+	yesterday := now.AddDate(0, 0, -1)
+	if _, err := r.reports.GetByDate(ctx, yesterday.Format("2006-01-02")); err == nil {
+		r.lastReportDate = today
+		return
+	} else if !errors.Is(err, ErrReconciliationReportNotFound) {
+		r.logger.Error("Failed to look up reconciliation report", zap.Error(err))
+		return
+	}
+	if _, err := r.GenerateReport(ctx, yesterday); err != nil {
+		r.logger.Error("Failed to generate reconciliation report", zap.Error(err))
+		return
+	}
+	r.lastReportDate = today
+}
@@ -0,0 +1,206 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// fakeMomoAPI reports statuses from a table and counts status polls
+type fakeMomoAPI struct {
+	mu        sync.Mutex
+	collect   map[string]string
+	transfers map[string]string
+	polls     int
+}
+
+func newFakeMomoAPI() *fakeMomoAPI {
+	return &fakeMomoAPI{collect: map[string]string{}, transfers: map[string]string{}}
+}
+
+func (f *fakeMomoAPI) EnsureOnline(ctx context.Context) error { return nil }
+func (f *fakeMomoAPI) RequestToPay(ctx context.Context, body services.RequestToPay) (string, error) {
+	return "", errors.New("not used")
+}
+func (f *fakeMomoAPI) Transfer(ctx context.Context, body services.TransferRequest) (string, error) {
+	return "", errors.New("not used")
+}
+func (f *fakeMomoAPI) GetRequestToPayStatus(ctx context.Context, ref string) (string, error) {
+	return f.lookup(f.collect, ref)
+}
+func (f *fakeMomoAPI) GetTransferStatus(ctx context.Context, ref string) (string, error) {
+	return f.lookup(f.transfers, ref)
+}
+func (f *fakeMomoAPI) lookup(table map[string]string, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	status, ok := table[ref]
+	if !ok {
+		return "", errors.New("resource not found")
+	}
+	return status, nil
+}
+
+type reconcileFixture struct {
+	ledger     *services.WalletLedgerService
+	webhooks   *services.MomoWebhookService
+	reconciler *services.MomoReconciler
+	momo       *fakeMomoAPI
+	user       *models.User
+}
+
+func newReconcileFixture(t *testing.T) *reconcileFixture {
+	t.Helper()
+	repo := database.NewMemoryDatabase()
+	f := &reconcileFixture{
+		ledger: services.NewWalletLedgerService(repo),
+		momo:   newFakeMomoAPI(),
+		user:   &models.User{Email: "recon@example.com", Wallet: models.Wallet{Currency: "USD"}},
+	}
+	if err := repo.CreateUser(context.TODO(), f.user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	f.webhooks = services.NewMomoWebhookService(nil, f.ledger, nil, nil, nil)
+	f.reconciler = f.newReconciler(10 * time.Millisecond)
+	return f
+}
+
+// newReconciler polls every stale entry, backing off from interval
+func (f *reconcileFixture) newReconciler(interval time.Duration) *services.MomoReconciler {
+	return services.NewMomoReconciler(services.NewPaymentProviders(services.NewMomoProvider(f.momo)), f.ledger.Entries(), f.webhooks, nil, 0, interval, nil)
+}
+
+func (f *reconcileFixture) pending(t *testing.T, entryType models.LedgerType, ref string, amount float64) {
+	t.Helper()
+	dir := models.LedgerCredit
+	if entryType == models.LedgerWithdraw {
+		dir = models.LedgerDebit
+	}
+	err := f.ledger.RecordIntent(context.TODO(), &models.WalletLedgerEntry{
+		UserID: f.user.ID, Type: entryType, Direction: dir, Amount: amount, Currency: "USD",
+		Reference: ref,
+	})
+	if err != nil {
+		t.Fatalf("record intent: %v", err)
+	}
+}
+
+func TestReconciler_SettlesEntriesWithoutCallback(t *testing.T) {
+	f := newReconcileFixture(t)
+	ctx := context.TODO()
+	f.pending(t, models.LedgerTopup, "top-ok", 100)
+	f.pending(t, models.LedgerTopup, "top-rejected", 30)
+	f.pending(t, models.LedgerTopup, "top-wait", 20)
+	f.pending(t, models.LedgerWithdraw, "wd-ok", 40)
+	f.momo.collect["top-ok"] = "SUCCESSFUL"
+	f.momo.collect["top-rejected"] = "REJECTED"
+	f.momo.collect["top-wait"] = "PENDING"
+	f.momo.transfers["wd-ok"] = "SUCCESSFUL"
+
+	res, err := f.reconciler.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Checked != 4 || res.Settled != 2 || res.Failed != 1 || res.StillPending != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if bal, _ := f.ledger.ComputeBalances(ctx, f.user.ID); bal.Available != 60 {
+		t.Fatalf("expected 100 in and 40 out, got %+v", bal)
+	}
+
+	// Once its backoff has passed, only the entry MoMo still reports as pending is polled again
+	f.momo.polls = 0
+	time.Sleep(15 * time.Millisecond)
+	if res, _ := f.reconciler.RunOnce(ctx); res.Checked != 1 || f.momo.polls != 1 {
+		t.Fatalf("settled entries should not be polled again: %+v, polls %d", res, f.momo.polls)
+	}
+
+	// The real callback arriving late must not credit a second time
+	if _, err := f.webhooks.Receive(ctx, callbackBody(t, f.user.ID, "top-ok", "SUCCESSFUL"), ""); !errors.Is(err, services.ErrWebhookDuplicate) {
+		t.Fatalf("late callback expected duplicate, got %v", err)
+	}
+	if bal, _ := f.ledger.ComputeBalances(ctx, f.user.ID); bal.Available != 60 {
+		t.Fatalf("late callback changed balance: %+v", bal)
+	}
+}
+
+func TestReconciler_BacksOffAndGivesUpOnEntriesItCannotSettle(t *testing.T) {
+	f := newReconcileFixture(t)
+	ctx := context.TODO()
+	// MoMo has no record of "lost" or "gone", so every poll of them fails
+	f.pending(t, models.LedgerTopup, "lost", 10)
+
+	eager := f.newReconciler(time.Nanosecond)
+	review := 0
+	for i := 0; i < 20; i++ {
+		res, err := eager.RunOnce(ctx)
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		review += res.NeedsReview
+	}
+	entry, err := f.ledger.Entries().GetByReference(ctx, "lost")
+	if err != nil || review != 1 || !entry.NeedsReview || entry.ReconcileAttempts != 10 || entry.Status != models.LedgerPending {
+		t.Fatalf("expected the entry to be left pending for review after 10 polls, got %+v, %v, %d", entry, err, review)
+	}
+
+	f.pending(t, models.LedgerTopup, "gone", 10)
+	hourly := f.newReconciler(time.Hour)
+	if res, _ := hourly.RunOnce(ctx); res.Checked != 1 || res.Errors != 1 {
+		t.Fatalf("expected only the new failing entry to be polled, got %+v", res)
+	}
+	f.pending(t, models.LedgerTopup, "fresh", 20)
+	f.momo.collect["fresh"] = "SUCCESSFUL"
+	f.momo.polls = 0
+	if res, _ := hourly.RunOnce(ctx); res.Checked != 1 || res.Settled != 1 || f.momo.polls != 1 {
+		t.Fatalf("the failing entry should wait out its backoff while the new one settles, got %+v, polls %d", res, f.momo.polls)
+	}
+}
+
+func TestReconciler_DailyReportListsMismatches(t *testing.T) {
+	f := newReconcileFixture(t)
+	ctx := context.TODO()
+	f.pending(t, models.LedgerTopup, "match", 10)
+	f.pending(t, models.LedgerTopup, "stuck", 10)
+	f.pending(t, models.LedgerTopup, "missing", 10)
+	f.momo.collect["match"] = "SUCCESSFUL"
+	f.momo.collect["stuck"] = "SUCCESSFUL"
+	// "match" is settled by its callback; "stuck" never heard back; MoMo has no record of "missing"
+	if _, err := f.webhooks.Receive(ctx, callbackBody(t, f.user.ID, "match", "SUCCESSFUL"), ""); err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+
+	report, err := f.reconciler.GenerateReport(ctx, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if report.Checked != 3 || report.Matched != 1 || len(report.Mismatches) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, m := range report.Mismatches {
+		switch m.Reference {
+		case "stuck":
+			if m.LedgerStatus != models.LedgerPending || m.ProviderStatus != "SUCCESSFUL" {
+				t.Fatalf("unexpected stuck mismatch: %+v", m)
+			}
+		case "missing":
+			if m.Error == "" {
+				t.Fatalf("expected a provider error for missing reference: %+v", m)
+			}
+		default:
+			t.Fatalf("unexpected mismatch: %+v", m)
+		}
+	}
+
+	saved, err := f.reconciler.Report(ctx, report.Date)
+	if err != nil || len(saved.Mismatches) != 2 {
+		t.Fatalf("report should be saved by date, got %+v, %v", saved, err)
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/smorting/backend/internal/services"
@@ -133,3 +137,106 @@ func TestMomo_GetTokensAndRequestToPayAndTransfer(t *testing.T) {
 	// Validate basic auth header construction
 	_ = base64.StdEncoding.EncodeToString([]byte("apiuser:apikey"))
 }
+
+// tokenServer issues numbered collection tokens and accepts only the latest one
+type tokenServer struct {
+	*httptest.Server
+	issued    atomic.Int32
+	expiresIn int
+	revoked   atomic.Bool
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	t.Helper()
+	ts := &tokenServer{expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/collection/token/", func(w http.ResponseWriter, r *http.Request) {
+		n := ts.issued.Add(1)
+		_ = json.NewEncoder(w).Encode(tokenResp{AccessToken: fmt.Sprintf("tok-%d", n), TokenType: "Bearer", ExpiresIn: ts.expiresIn})
+	})
+	mux.HandleFunc("/collection/v1_0/requesttopay/status/", func(w http.ResponseWriter, r *http.Request) {
+		latest := fmt.Sprintf("Bearer tok-%d", ts.issued.Load())
+		if r.Header.Get("Authorization") != latest || ts.revoked.Swap(false) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "SUCCESSFUL"})
+	})
+	ts.Server = httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) client() *services.MomoClient {
+	return services.NewMomoClient(ts.URL, "sandbox", "apiuser", "apikey", "col-sub-key", "disb-sub-key")
+}
+
+func TestMomo_TokenIsCachedAndSharedAcrossConcurrentCalls(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	c := ts.client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetRequestToPayStatus(context.Background(), "ref"); err != nil {
+				t.Errorf("status: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := c.GetRequestToPayStatus(context.Background(), "ref"); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if n := ts.issued.Load(); n != 1 {
+		t.Fatalf("expected a single token fetch, got %d", n)
+	}
+}
+
+func TestMomo_ExpiringTokenIsRefreshed(t *testing.T) {
+	// A token that expires within the refresh margin is never reused
+	ts := newTokenServer(t, 0)
+	c := ts.client()
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetRequestToPayStatus(context.Background(), "ref"); err != nil {
+			t.Fatalf("status: %v", err)
+		}
+	}
+	if n := ts.issued.Load(); n != 3 {
+		t.Fatalf("expected a token fetch per call, got %d", n)
+	}
+}
+
+func TestMomo_RejectedTokenIsReplacedAndRequestRetried(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	c := ts.client()
+	if _, err := c.GetRequestToPayStatus(context.Background(), "ref"); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	// MoMo revokes the cached token before it expires
+	ts.revoked.Store(true)
+	status, err := c.GetRequestToPayStatus(context.Background(), "ref")
+	if err != nil || status != "SUCCESSFUL" {
+		t.Fatalf("expected the retry with a fresh token to succeed, got %q, %v", status, err)
+	}
+	if n := ts.issued.Load(); n != 2 {
+		t.Fatalf("expected one refresh after the 401, got %d fetches", n)
+	}
+}
+
+func TestMomo_OnlyClientErrorsAreDefinitiveRejections(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	codes := map[string]int{"bad": http.StatusBadRequest, "dup": http.StatusConflict, "down": http.StatusServiceUnavailable}
+	ts.Config.Handler.(*http.ServeMux).HandleFunc("/collection/v1_0/requesttopay", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[r.Header.Get("X-Reference-Id")])
+	})
+	c := ts.client()
+	for ref, rejected := range map[string]bool{"bad": true, "dup": false, "down": false} {
+		_, err := c.RequestToPay(context.Background(), services.RequestToPay{ReferenceID: ref, Amount: "5", Currency: "EUR"})
+		if err == nil || errors.Is(err, services.ErrPaymentRejected) != rejected {
+			t.Fatalf("%s: expected rejected=%v, got %v", ref, rejected, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// momoTokenRefreshSkew is how long before expiry a cached token is replaced,
+// so a request never goes out with a token that lapses in flight
+const momoTokenRefreshSkew = time.Minute
+
+// momoTokenCache holds the access token of one MoMo product (collection or
+// disbursement). Concurrent callers that find it stale share one refresh.
+type momoTokenCache struct {
+	fetch func(ctx context.Context) (*momoToken, error)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     *momoToken
+	refreshAt time.Time
+	group     singleflight.Group
+}
+
+func newMomoTokenCache(fetch func(ctx context.Context) (*momoToken, error)) *momoTokenCache {
+	return &momoTokenCache{fetch: fetch, now: time.Now}
+}
+
+// Get returns the cached token, fetching a new one when it is missing or about to expire
+func (c *momoTokenCache) Get(ctx context.Context) (*momoToken, error) {
+	if tok := c.cached(); tok != nil {
+		return tok, nil
+	}
+	// The refresh is shared, so it must not die with the first caller's context
+	ch := c.group.DoChan("token", func() (interface{}, error) {
+		if tok := c.cached(); tok != nil {
+			return tok, nil
+		}
+		tok, err := c.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.store(tok)
+		return tok, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*momoToken), nil
+	}
+}
+
+// Invalidate drops tok after MoMo rejected it. A token that has already been
+// replaced by a concurrent refresh is left alone.
+func (c *momoTokenCache) Invalidate(tok *momoToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && tok != nil && c.token.AccessToken == tok.AccessToken {
+		c.token = nil
+	}
+}
+
+func (c *momoTokenCache) cached() *momoToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == nil || !c.now().Before(c.refreshAt) {
+		return nil
+	}
+	return c.token
+}
+
+func (c *momoTokenCache) store(tok *momoToken) {
+	lifetime := time.Duration(tok.ExpiresIn) * time.Second
+	skew := momoTokenRefreshSkew
+	if skew > lifetime/2 {
+		// Short-lived tokens are still reused for the first half of their life
+		skew = lifetime / 2
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = tok
+	c.refreshAt = c.now().Add(lifetime - skew)
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// MomoWebhookProvider identifies MTN MoMo callbacks in the webhook inbox
+const MomoWebhookProvider = models.PaymentProviderMTNMomo
+
+// defaultWebhookLease is how long an event may stay pending before it is taken
+// to be abandoned, e.g. by an instance that crashed while applying it
+const defaultWebhookLease = 5 * time.Minute
+
+var (
+	ErrWebhookInvalidPayload   = errors.New("invalid webhook payload")
+	ErrWebhookUnauthenticated  = errors.New("webhook authenticity check failed")
+	ErrWebhookDuplicate        = errors.New("webhook already processed")
+	ErrWebhookNotReplayable    = errors.New("only failed or abandoned webhook events can be replayed")
+	ErrWebhookUnknownReference = errors.New("no payment intent for webhook reference")
+)
+
+// PaymentCallback is a provider status update in our own shape. It is the body
+// MoMo (and the simulator) posts; other providers' notifications are parsed into it.
+type PaymentCallback struct {
+	Type        string  `json:"type"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	UserID      string  `json:"user_id"`
+	ReferenceID string  `json:"referenceId"`
+	ProviderRef string  `json:"provider_ref"`
+	Provider    string  `json:"provider,omitempty"` // webhook inbox provider; empty means MoMo
+}
+
+// MomoCallbackVerifier decides whether a callback really came from MoMo. A
+// verifier may correct cb.Status to the status MoMo itself reports.
+type MomoCallbackVerifier interface {
+	Verify(ctx context.Context, body []byte, signature string, cb *PaymentCallback) error
+}
+
+// HMACCallbackVerifier checks a hex HMAC-SHA256 of the raw body made with a shared secret
+type HMACCallbackVerifier struct {
+	secret []byte
+}
+
+func NewHMACCallbackVerifier(secret string) *HMACCallbackVerifier {
+	return &HMACCallbackVerifier{secret: []byte(secret)}
+}
+
+// Sign returns the signature expected for body; used by the simulator and tests
+func (v *HMACCallbackVerifier) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (v *HMACCallbackVerifier) Verify(ctx context.Context, body []byte, signature string, cb *PaymentCallback) error {
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil || len(got) == 0 {
+		return ErrWebhookUnauthenticated
+	}
+	want, _ := hex.DecodeString(v.Sign(body))
+	if !hmac.Equal(got, want) {
+		return ErrWebhookUnauthenticated
+	}
+	return nil
+}
+
+// StatusQueryVerifier ignores the claimed status and asks MoMo for the real one,
+// so a forged callback can at worst replay a status MoMo already reports
+type StatusQueryVerifier struct {
+	momo MomoAPI
+}
+
+func NewStatusQueryVerifier(momo MomoAPI) *StatusQueryVerifier {
+	return &StatusQueryVerifier{momo: momo}
+}
+
+func (v *StatusQueryVerifier) Verify(ctx context.Context, body []byte, signature string, cb *PaymentCallback) error {
+	var (
+		status string
+		err    error
+	)
+	op, ok := paymentOperationFor(models.LedgerType(cb.Type))
+	if !ok {
+		// Anything else is not a MoMo operation and cannot be confirmed with MoMo
+		return ErrWebhookUnauthenticated
+	}
+	if op == PaymentCollection {
+		status, err = v.momo.GetRequestToPayStatus(ctx, cb.ReferenceID)
+	} else {
+		status, err = v.momo.GetTransferStatus(ctx, cb.ReferenceID)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookUnauthenticated, err)
+	}
+	cb.Status = status
+	return nil
+}
+
+// MomoWebhookService verifies MoMo callbacks, records them in the inbox and
+// applies each reference/status pair to the ledger and escrow exactly once
+type MomoWebhookService struct {
+	inbox    WebhookInbox
+	ledger   *WalletLedgerService
+	escrow   *EscrowService
+	verifier MomoCallbackVerifier
+	lease    time.Duration
+	logger   *zap.Logger
+}
+
+// NewMomoWebhookService wires the callback pipeline. A nil verifier accepts every
+// callback and must only be used by tests and local tooling.
+func NewMomoWebhookService(inbox WebhookInbox, ledger *WalletLedgerService, escrow *EscrowService, verifier MomoCallbackVerifier, logger *zap.Logger) *MomoWebhookService {
+	if inbox == nil {
+		inbox = NewMemoryWebhookInbox()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &MomoWebhookService{inbox: inbox, ledger: ledger, escrow: escrow, verifier: verifier, lease: defaultWebhookLease, logger: logger}
+}
+
+// SetProcessingLease changes how long an event may stay pending before a
+// repeated callback or a replay takes it over
+func (s *MomoWebhookService) SetProcessingLease(lease time.Duration) {
+	s.lease = lease
+}
+
+// Receive authenticates and applies a raw callback body. It returns
+// ErrWebhookDuplicate when the same reference/status was already handled or is
+// being handled; a failed earlier attempt, or one pending for longer than the
+// processing lease, is retried instead.
+func (s *MomoWebhookService) Receive(ctx context.Context, body []byte, signature string) (*models.WebhookEvent, error) {
+	var cb PaymentCallback
+	if err := json.Unmarshal(body, &cb); err != nil || cb.ReferenceID == "" || cb.Status == "" {
+		return nil, ErrWebhookInvalidPayload
+	}
+	matched, err := s.resolveIntent(ctx, &cb)
+	if err != nil {
+		return nil, err
+	}
+	if s.verifier != nil {
+		if err := s.verifier.Verify(ctx, body, signature, &cb); err != nil {
+			return nil, err
+		}
+		// Only an unauthenticated (test/local) service falls back to the IDs in the payload
+		if !matched {
+			return nil, ErrWebhookUnknownReference
+		}
+	}
+	return s.record(ctx, &cb)
+}
+
+// ReceiveFrom authenticates and applies a notification from a provider other
+// than the signed MoMo callback. The notification only names a reference: it
+// must match an intent sent to that provider, and its status is taken from the
+// provider itself, so a forged notification cannot move money.
+func (s *MomoWebhookService) ReceiveFrom(ctx context.Context, provider PaymentProvider, body []byte) (*models.WebhookEvent, error) {
+	cb, err := provider.ParseCallback(body)
+	if err != nil {
+		return nil, ErrWebhookInvalidPayload
+	}
+	cb.Provider = provider.Name()
+	matched, err := s.resolveIntent(ctx, cb)
+	if err != nil {
+		return nil, err
+	}
+	if !matched {
+		return nil, ErrWebhookUnknownReference
+	}
+	op, _ := paymentOperationFor(models.LedgerType(cb.Type))
+	status, err := provider.Status(ctx, op, cb.ReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookUnauthenticated, err)
+	}
+	cb.Status = status
+	return s.record(ctx, cb)
+}
+
+// Apply records an already trusted status update (a verified callback, or a
+// status the reconciler polled from MoMo) and applies it once. Callbacks and
+// polls share the inbox, so whichever arrives second is a duplicate.
+func (s *MomoWebhookService) Apply(ctx context.Context, cb *PaymentCallback) (*models.WebhookEvent, error) {
+	matched, err := s.resolveIntent(ctx, cb)
+	if err != nil {
+		return nil, err
+	}
+	if !matched && s.verifier != nil {
+		return nil, ErrWebhookUnknownReference
+	}
+	return s.record(ctx, cb)
+}
+
+// resolveIntent replaces the user, type, amount and currency a callback claims
+// with those of the intent recorded before MoMo was called, and reports whether
+// there was one
+func (s *MomoWebhookService) resolveIntent(ctx context.Context, cb *PaymentCallback) (bool, error) {
+	if s.ledger == nil {
+		return false, nil
+	}
+	intent, err := s.ledger.Intent(ctx, cb.ReferenceID)
+	if errors.Is(err, ErrWalletEntryNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// A reference only settles through the provider it was sent to
+	if webhookProvider(cb.Provider) != webhookProvider(intent.Provider) {
+		return false, nil
+	}
+	if cb.Amount != 0 && roundMinor(cb.Amount) != roundMinor(intent.Amount) {
+		s.logger.Warn("MoMo callback amount differs from intent; using intent",
+			zap.String("reference_id", cb.ReferenceID), zap.Float64("callback_amount", cb.Amount), zap.Float64("intent_amount", intent.Amount))
+	}
+	cb.UserID = intent.UserID.Hex()
+	cb.Type = string(intent.Type)
+	cb.Amount = intent.Amount
+	cb.Currency = intent.Currency
+	return true, nil
+}
+
+// record stores the callback in the inbox and applies it unless it is a repeat
+func (s *MomoWebhookService) record(ctx context.Context, cb *PaymentCallback) (*models.WebhookEvent, error) {
+	// Store the verified callback rather than the raw body, so a replay applies what was checked
+	payload, _ := json.Marshal(cb)
+	provider := webhookProvider(cb.Provider)
+	event := &models.WebhookEvent{
+		Provider:    provider,
+		DedupKey:    webhookDedupKey(cb),
+		ReferenceID: cb.ReferenceID,
+		Type:        cb.Type,
+		Status:      cb.Status,
+		Payload:     string(payload),
+		State:       models.WebhookPending,
+		Attempts:    1,
+	}
+	err := s.inbox.Insert(ctx, event)
+	if errors.Is(err, ErrWebhookEventExists) {
+		existing, getErr := s.inbox.GetByKey(ctx, provider, event.DedupKey)
+		if getErr != nil {
+			return nil, getErr
+		}
+		switch {
+		case existing.State == models.WebhookFailed:
+			// The provider retried a callback we failed to apply: take it over
+			return s.retry(ctx, existing)
+		case s.abandoned(existing):
+			return s.reclaim(ctx, existing)
+		}
+		return existing, ErrWebhookDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return event, s.process(ctx, event, cb)
+}
+
+// webhookProvider names the inbox provider of a callback or intent; MoMo predates the field
+func webhookProvider(name string) string {
+	if name == "" {
+		return MomoWebhookProvider
+	}
+	return name
+}
+
+// webhookDedupKey identifies a callback by reference and status. The type is part
+// of the key because an escrow reference is reused for its hold and its release.
+func webhookDedupKey(cb *PaymentCallback) string {
+	return cb.ReferenceID + ":" + cb.Type + ":" + strings.ToUpper(cb.Status)
+}
+
+// Replay re-applies a failed or abandoned event, e.g. after the underlying fault was fixed
+func (s *MomoWebhookService) Replay(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	event, err := s.inbox.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.abandoned(event) {
+		return s.reclaim(ctx, event)
+	}
+	if event.State != models.WebhookFailed {
+		return event, ErrWebhookNotReplayable
+	}
+	return s.retry(ctx, event)
+}
+
+// ReplayFailed replays up to limit failed events and returns how many succeeded
+func (s *MomoWebhookService) ReplayFailed(ctx context.Context, limit int) (int, error) {
+	failed, err := s.inbox.List(ctx, models.WebhookFailed, limit)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for i := range failed {
+		if _, err := s.retry(ctx, &failed[i]); err != nil {
+			s.logger.Warn("Webhook replay failed", zap.Error(err), zap.String("event_id", failed[i].ID.Hex()))
+			continue
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// Events lists inbox events in the given state
+func (s *MomoWebhookService) Events(ctx context.Context, state models.WebhookEventState, limit int) ([]models.WebhookEvent, error) {
+	return s.inbox.List(ctx, state, limit)
+}
+
+// retry claims a failed event and applies it again
+func (s *MomoWebhookService) retry(ctx context.Context, event *models.WebhookEvent) (*models.WebhookEvent, error) {
+	if err := s.inbox.Transition(ctx, event.ID, models.WebhookFailed, models.WebhookPending, event.LastError); err != nil {
+		if errors.Is(err, ErrWebhookEventStateChanged) {
+			return event, ErrWebhookDuplicate
+		}
+		return event, err
+	}
+	return s.processStored(ctx, event)
+}
+
+// abandoned reports whether a pending event has outlived the processing lease
+func (s *MomoWebhookService) abandoned(event *models.WebhookEvent) bool {
+	return event.State == models.WebhookPending && time.Since(event.UpdatedAt) > s.lease
+}
+
+// reclaim takes over an abandoned pending event and applies it again
+func (s *MomoWebhookService) reclaim(ctx context.Context, event *models.WebhookEvent) (*models.WebhookEvent, error) {
+	if err := s.inbox.Reclaim(ctx, event.ID, time.Now().Add(-s.lease)); err != nil {
+		if errors.Is(err, ErrWebhookEventStateChanged) {
+			return event, ErrWebhookDuplicate
+		}
+		return event, err
+	}
+	s.logger.Warn("Taking over abandoned webhook event", zap.String("event_id", event.ID.Hex()), zap.String("reference_id", event.ReferenceID))
+	return s.processStored(ctx, event)
+}
+
+// processStored applies the callback saved on a pending event the caller has claimed
+func (s *MomoWebhookService) processStored(ctx context.Context, event *models.WebhookEvent) (*models.WebhookEvent, error) {
+	var cb PaymentCallback
+	if err := json.Unmarshal([]byte(event.Payload), &cb); err != nil {
+		_ = s.inbox.Transition(ctx, event.ID, models.WebhookPending, models.WebhookFailed, err.Error())
+		return event, err
+	}
+	return event, s.process(ctx, event, &cb)
+}
+
+// process applies the callback and records the outcome on the inbox event
+func (s *MomoWebhookService) process(ctx context.Context, event *models.WebhookEvent, cb *PaymentCallback) error {
+	applyErr := s.apply(ctx, cb)
+	next, lastErr := models.WebhookProcessed, ""
+	if applyErr != nil {
+		next, lastErr = models.WebhookFailed, applyErr.Error()
+		s.logger.Error("Failed to apply MoMo callback", zap.Error(applyErr),
+			zap.String("reference_id", cb.ReferenceID), zap.String("status", cb.Status))
+	}
+	if err := s.inbox.Transition(ctx, event.ID, models.WebhookPending, next, lastErr); err != nil {
+		s.logger.Error("Failed to record webhook outcome", zap.Error(err), zap.String("event_id", event.ID.Hex()))
+	}
+	event.State, event.LastError = next, lastErr
+	return applyErr
+}
+
+// apply moves money for the callback: a ledger entry for the wallet, then the escrow state for holds
+func (s *MomoWebhookService) apply(ctx context.Context, cb *PaymentCallback) error {
+	if s.ledger != nil && cb.UserID != "" {
+		uid, err := primitive.ObjectIDFromHex(cb.UserID)
+		if err != nil {
+			return fmt.Errorf("invalid user_id: %w", err)
+		}
+		entry := &models.WalletLedgerEntry{
+			UserID:      uid,
+			Amount:      cb.Amount,
+			Currency:    cb.Currency,
+			Reference:   cb.ReferenceID,
+			ProviderRef: cb.ProviderRef,
+			Direction:   models.LedgerCredit,
+			Status:      models.LedgerPending,
+		}
+		switch cb.Type {
+		case "topup":
+			entry.Type = models.LedgerTopup
+		case "payment":
+			entry.Type = models.LedgerPayment
+		case "escrow_hold":
+			entry.Type = models.LedgerEscrowHold
+			entry.IsEscrow = true
+		case "escrow_release":
+			entry.Type = models.LedgerEscrowRelease
+		case "withdraw":
+			entry.Type = models.LedgerWithdraw
+			entry.Direction = models.LedgerDebit
+		case "refund":
+			entry.Type = models.LedgerRefund
+			entry.Direction = models.LedgerDebit
+		case "payout":
+			entry.Type = models.LedgerPayout
+			entry.Direction = models.LedgerDebit
+		}
+		switch cb.Status {
+		case "SUCCESSFUL":
+			entry.Status = models.LedgerCompleted
+			if entry.Type == models.LedgerEscrowHold {
+				entry.Status = models.LedgerHeld
+			}
+		case "FAILED":
+			entry.Status = models.LedgerFailed
+		}
+		if err := s.ledger.RecordEntry(ctx, entry); err != nil {
+			return fmt.Errorf("record ledger entry: %w", err)
+		}
+	}
+	if s.escrow != nil && cb.Type == "escrow_hold" {
+		var err error
+		switch cb.Status {
+		case "SUCCESSFUL":
+			err = s.escrow.MarkFunded(ctx, cb.ReferenceID)
+		case "FAILED":
+			err = s.escrow.MarkFailed(ctx, cb.ReferenceID)
+		}
+		if err != nil && !errors.Is(err, ErrEscrowNotFound) {
+			return fmt.Errorf("update escrow: %w", err)
+		}
+	}
+	return s.settleIntent(ctx, cb)
+}
+
+// settleIntent marks the intent behind a final status so the reconciler stops polling it
+func (s *MomoWebhookService) settleIntent(ctx context.Context, cb *PaymentCallback) error {
+	if s.ledger == nil {
+		return nil
+	}
+	var status models.LedgerStatus
+	switch cb.Status {
+	case "SUCCESSFUL":
+		status = models.LedgerCompleted
+	case "FAILED":
+		status = models.LedgerFailed
+	default:
+		return nil
+	}
+	intent, err := s.ledger.Intent(ctx, cb.ReferenceID)
+	if errors.Is(err, ErrWalletEntryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.ledger.SettleIntent(ctx, intent, status); err != nil {
+		return fmt.Errorf("settle intent: %w", err)
+	}
+	return nil
+}
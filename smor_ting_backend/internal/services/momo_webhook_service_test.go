@@ -0,0 +1,241 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// statusMomo answers status queries from a fixed table
+type statusMomo struct {
+	services.MomoAPI
+	statuses map[string]string
+}
+
+func (s *statusMomo) GetRequestToPayStatus(ctx context.Context, ref string) (string, error) {
+	status, ok := s.statuses[ref]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return status, nil
+}
+
+func (s *statusMomo) GetTransferStatus(ctx context.Context, ref string) (string, error) {
+	return s.GetRequestToPayStatus(ctx, ref)
+}
+
+func callbackBody(t *testing.T, userID primitive.ObjectID, ref, status string) []byte {
+	t.Helper()
+	b, err := json.Marshal(services.PaymentCallback{Type: "topup", Status: status, Amount: 40, Currency: "USD", UserID: userID.Hex(), ReferenceID: ref})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return b
+}
+
+func newWebhookUser(t *testing.T, repo *database.MemoryDatabase) *models.User {
+	t.Helper()
+	u := &models.User{Email: "momo-cb@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	if err := repo.CreateUser(context.TODO(), u); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return u
+}
+
+// topupIntent records the pending top-up a callback for ref settles
+func topupIntent(t *testing.T, ledger *services.WalletLedgerService, userID primitive.ObjectID, ref string, amount float64) {
+	t.Helper()
+	err := ledger.RecordIntent(context.TODO(), &models.WalletLedgerEntry{
+		UserID: userID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: amount, Currency: "USD", Reference: ref,
+	})
+	if err != nil {
+		t.Fatalf("record intent: %v", err)
+	}
+}
+
+func TestMomoWebhook_HMACRejectsForgedCallbacks(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	verifier := services.NewHMACCallbackVerifier("s3cret")
+	svc := services.NewMomoWebhookService(nil, ledger, nil, verifier, nil)
+	topupIntent(t, ledger, u.ID, "ref-hmac", 40)
+
+	body := callbackBody(t, u.ID, "ref-hmac", "SUCCESSFUL")
+	forged := services.NewHMACCallbackVerifier("guess").Sign(body)
+	if _, err := svc.Receive(context.TODO(), body, forged); !errors.Is(err, services.ErrWebhookUnauthenticated) {
+		t.Fatalf("forged signature expected unauthenticated, got %v", err)
+	}
+	if _, err := svc.Receive(context.TODO(), body, ""); !errors.Is(err, services.ErrWebhookUnauthenticated) {
+		t.Fatalf("missing signature expected unauthenticated, got %v", err)
+	}
+	if _, err := svc.Receive(context.TODO(), body, "sha256="+verifier.Sign(body)); err != nil {
+		t.Fatalf("signed callback: %v", err)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 40 {
+		t.Fatalf("expected 40 credited, got %+v", bal)
+	}
+}
+
+func TestMomoWebhook_DuplicateCallbackCreditsOnce(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	svc := services.NewMomoWebhookService(nil, ledger, nil, nil, nil)
+
+	body := callbackBody(t, u.ID, "ref-dup", "SUCCESSFUL")
+	if _, err := svc.Receive(context.TODO(), body, ""); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+	if _, err := svc.Receive(context.TODO(), body, ""); !errors.Is(err, services.ErrWebhookDuplicate) {
+		t.Fatalf("retried callback expected duplicate, got %v", err)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 40 {
+		t.Fatalf("retried callback credited twice: %+v", bal)
+	}
+}
+
+func TestMomoWebhook_StatusQueryTrustsMomoOverClaim(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	momo := &statusMomo{statuses: map[string]string{"ref-q": "PENDING"}}
+	svc := services.NewMomoWebhookService(nil, ledger, nil, services.NewStatusQueryVerifier(momo), nil)
+	topupIntent(t, ledger, u.ID, "ref-q", 40)
+
+	event, err := svc.Receive(context.TODO(), callbackBody(t, u.ID, "ref-q", "SUCCESSFUL"), "")
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if event.Status != "PENDING" {
+		t.Fatalf("expected status from MoMo, got %s", event.Status)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 0 {
+		t.Fatalf("a pending payment must not be credited: %+v", bal)
+	}
+
+	if _, err := svc.Receive(context.TODO(), callbackBody(t, u.ID, "unknown", "SUCCESSFUL"), ""); !errors.Is(err, services.ErrWebhookUnauthenticated) {
+		t.Fatalf("unknown reference expected unauthenticated, got %v", err)
+	}
+}
+
+func TestMomoWebhook_StatusQueryConfirmsPayouts(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	momo := &statusMomo{statuses: map[string]string{"payout-1": "SUCCESSFUL"}}
+	svc := services.NewMomoWebhookService(nil, ledger, nil, services.NewStatusQueryVerifier(momo), nil)
+	err := ledger.RecordIntent(context.TODO(), &models.WalletLedgerEntry{
+		UserID: u.ID, Type: models.LedgerPayout, Direction: models.LedgerDebit, Amount: 40, Currency: "USD", Reference: "payout-1",
+	})
+	if err != nil {
+		t.Fatalf("record intent: %v", err)
+	}
+
+	b, _ := json.Marshal(services.PaymentCallback{Type: "payout", Status: "SUCCESSFUL", ReferenceID: "payout-1"})
+	event, err := svc.Receive(context.TODO(), b, "")
+	if err != nil || event.Status != "SUCCESSFUL" {
+		t.Fatalf("expected the payout callback to be confirmed with MoMo, got %+v, %v", event, err)
+	}
+	if intent, _ := ledger.Intent(context.TODO(), "payout-1"); intent.Status != models.LedgerCompleted {
+		t.Fatalf("expected the payout to settle, got %+v", intent)
+	}
+}
+
+func TestMomoWebhook_AuthenticCallbackNeedsIntent(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	verifier := services.NewHMACCallbackVerifier("s3cret")
+	svc := services.NewMomoWebhookService(nil, ledger, nil, verifier, nil)
+	topupIntent(t, ledger, u.ID, "ref-intent", 25)
+
+	// A signed callback cannot name a reference the server never issued
+	body := callbackBody(t, u.ID, "ref-unissued", "SUCCESSFUL")
+	if _, err := svc.Receive(context.TODO(), body, verifier.Sign(body)); !errors.Is(err, services.ErrWebhookUnknownReference) {
+		t.Fatalf("expected unknown reference, got %v", err)
+	}
+	// The intent, not the payload, decides the amount credited
+	body = callbackBody(t, u.ID, "ref-intent", "SUCCESSFUL")
+	if _, err := svc.Receive(context.TODO(), body, verifier.Sign(body)); err != nil {
+		t.Fatalf("signed callback: %v", err)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 25 {
+		t.Fatalf("expected the intent amount credited, got %+v", bal)
+	}
+	if intent, _ := ledger.Intent(context.TODO(), "ref-intent"); intent == nil || intent.Status != models.LedgerCompleted {
+		t.Fatalf("intent should be completed, got %+v", intent)
+	}
+}
+
+func TestMomoWebhook_FailedEventsCanBeReplayed(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	svc := services.NewMomoWebhookService(nil, ledger, nil, nil, nil)
+
+	// The user does not exist yet, so the ledger write fails and the event is kept
+	u := &models.User{ID: primitive.NewObjectID(), Email: "late@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	event, err := svc.Receive(context.TODO(), callbackBody(t, u.ID, "ref-replay", "SUCCESSFUL"), "")
+	if err == nil || event == nil || event.State != models.WebhookFailed {
+		t.Fatalf("expected a failed event, got %+v, %v", event, err)
+	}
+	failed, _ := svc.Events(context.TODO(), models.WebhookFailed, 10)
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 failed event in the inbox, got %d", len(failed))
+	}
+
+	if err := repo.CreateUser(context.TODO(), u); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if n, err := svc.ReplayFailed(context.TODO(), 0); err != nil || n != 1 {
+		t.Fatalf("expected 1 replayed event, got %d, %v", n, err)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 40 {
+		t.Fatalf("replay should credit the wallet, got %+v", bal)
+	}
+	if _, err := svc.Replay(context.TODO(), event.ID); !errors.Is(err, services.ErrWebhookNotReplayable) {
+		t.Fatalf("processed event must not be replayed again, got %v", err)
+	}
+}
+
+func TestMomoWebhook_AbandonedPendingEventIsTakenOver(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	inbox := services.NewMemoryWebhookInbox()
+	svc := services.NewMomoWebhookService(inbox, ledger, nil, nil, nil)
+
+	// An instance recorded the callback and died before applying it
+	body := callbackBody(t, u.ID, "ref-stuck", "SUCCESSFUL")
+	stuck := &models.WebhookEvent{Provider: services.MomoWebhookProvider, DedupKey: "ref-stuck:topup:SUCCESSFUL", ReferenceID: "ref-stuck",
+		Type: "topup", Status: "SUCCESSFUL", Payload: string(body), State: models.WebhookPending, Attempts: 1}
+	if err := inbox.Insert(context.TODO(), stuck); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := svc.Receive(context.TODO(), body, ""); !errors.Is(err, services.ErrWebhookDuplicate) {
+		t.Fatalf("an event inside its lease is still being handled, got %v", err)
+	}
+
+	svc.SetProcessingLease(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	event, err := svc.Receive(context.TODO(), body, "")
+	if err != nil || event.ID != stuck.ID || event.State != models.WebhookProcessed {
+		t.Fatalf("expected the retried callback to take over the abandoned event, got %+v, %v", event, err)
+	}
+	if bal, _ := ledger.ComputeBalances(context.TODO(), u.ID); bal.Available != 40 {
+		t.Fatalf("expected 40 credited once, got %+v", bal)
+	}
+	if saved, _ := inbox.Get(context.TODO(), stuck.ID); saved.Attempts != 2 {
+		t.Fatalf("expected the takeover to count an attempt, got %+v", saved)
+	}
+	if _, err := svc.Receive(context.TODO(), body, ""); !errors.Is(err, services.ErrWebhookDuplicate) {
+		t.Fatalf("a processed event is a duplicate, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+)
+
+// OrangeMoneyClient talks to the Orange Money Liberia merchant API (OM Core):
+//
+//	POST /oauth/v3/token                              client-credentials access token
+//	POST /omcoreapis/1.0.2/mp/pay                     merchant payment (collection)
+//	POST /omcoreapis/1.0.2/cashin/pay                 cash-in to a subscriber (disbursement)
+//	GET  /omcoreapis/1.0.2/{mp|cashin}/paymentstatus/{orderId}
+//
+// Every call carries the bearer token and an X-AUTH-TOKEN made from the channel
+// user's API credentials. Our reference is sent as orderId, so status queries
+// and notifications are keyed by the same reference as MoMo's X-Reference-Id.
+type OrangeMoneyClient struct {
+	httpClient    *http.Client
+	baseURL       string
+	clientID      string
+	clientSecret  string
+	apiUsername   string
+	apiPassword   string
+	channelMsisdn string
+	notifyURL     string
+	tokens        *momoTokenCache
+}
+
+func NewOrangeMoneyClient(baseURL, clientID, clientSecret, apiUsername, apiPassword, channelMsisdn, notifyURL string) *OrangeMoneyClient {
+	c := &OrangeMoneyClient{
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		apiUsername:   apiUsername,
+		apiPassword:   apiPassword,
+		channelMsisdn: channelMsisdn,
+		notifyURL:     notifyURL,
+	}
+	c.tokens = newMomoTokenCache(c.fetchToken)
+	return c
+}
+
+func (c *OrangeMoneyClient) Name() string { return models.PaymentProviderOrangeMoney }
+
+func (c *OrangeMoneyClient) EnsureOnline(ctx context.Context) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("orange money not reachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (c *OrangeMoneyClient) fetchToken(ctx context.Context) (*momoToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/oauth/v3/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.clientID+":"+c.clientSecret)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("orange token failed: %s", string(b))
+	}
+	var t momoToken
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// do sends an authenticated request, retrying once with a fresh token after a 401
+func (c *OrangeMoneyClient) do(ctx context.Context, method, path string, payload any) (*http.Response, error) {
+	var data []byte
+	if payload != nil {
+		data, _ = json.Marshal(payload)
+	}
+	for attempt := 0; ; attempt++ {
+		tok, err := c.tokens.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var body io.Reader
+		if data != nil {
+			body = strings.NewReader(string(data))
+		}
+		req, _ := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+		req.Header.Set("X-AUTH-TOKEN", base64.StdEncoding.EncodeToString([]byte(c.apiUsername+":"+c.apiPassword)))
+		if data != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		c.tokens.Invalidate(tok)
+	}
+}
+
+type orangePayment struct {
+	OrderID           string `json:"orderId"`
+	Amount            string `json:"amount"`
+	Currency          string `json:"currency"`
+	SubscriberMsisdn  string `json:"subscriberMsisdn"`
+	ChannelUserMsisdn string `json:"channelUserMsisdn"`
+	Description       string `json:"description"`
+	NotifURL          string `json:"notifUrl,omitempty"`
+}
+
+func (c *OrangeMoneyClient) Collect(ctx context.Context, req MobileMoneyRequest) error {
+	return c.pay(ctx, "/omcoreapis/1.0.2/mp/pay", req)
+}
+
+func (c *OrangeMoneyClient) Disburse(ctx context.Context, req MobileMoneyRequest) error {
+	return c.pay(ctx, "/omcoreapis/1.0.2/cashin/pay", req)
+}
+
+func (c *OrangeMoneyClient) pay(ctx context.Context, path string, req MobileMoneyRequest) error {
+	if req.ReferenceID == "" {
+		return fmt.Errorf("orange money: reference id is required")
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, orangePayment{
+		OrderID:           req.ReferenceID,
+		Amount:            req.Amount,
+		Currency:          req.Currency,
+		SubscriberMsisdn:  req.MSISDN,
+		ChannelUserMsisdn: c.channelMsisdn,
+		Description:       req.Message,
+		NotifURL:          c.notifyURL,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return paymentRequestError("orange payment", resp.StatusCode, b)
+	}
+	// An accepted request is only rejected when Orange says so explicitly; an
+	// unreadable body or a missing status leaves it for the callback or reconciler
+	var out struct {
+		Data struct {
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err == nil && orangeStatus(out.Data.Status) == PaymentStatusFailed {
+		return fmt.Errorf("%w: orange payment %s", ErrPaymentRejected, out.Data.Status)
+	}
+	return nil
+}
+
+func (c *OrangeMoneyClient) Status(ctx context.Context, op PaymentOperation, referenceID string) (string, error) {
+	var path string
+	switch op {
+	case PaymentCollection:
+		path = "/omcoreapis/1.0.2/mp/paymentstatus/"
+	case PaymentDisbursement:
+		path = "/omcoreapis/1.0.2/cashin/paymentstatus/"
+	default:
+		return "", fmt.Errorf("unknown payment operation %q", op)
+	}
+	resp, err := c.do(ctx, http.MethodGet, path+url.PathEscape(referenceID), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("orange payment status failed: %s", string(b))
+	}
+	var out struct {
+		Data struct {
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return orangeStatus(out.Data.Status), nil
+}
+
+// ParseCallback reads an Orange notification: {"orderId","status","txnid","amount"}
+func (c *OrangeMoneyClient) ParseCallback(body []byte) (*PaymentCallback, error) {
+	var n struct {
+		OrderID string `json:"orderId"`
+		Status  string `json:"status"`
+		TxnID   string `json:"txnid"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil || n.OrderID == "" || n.Status == "" {
+		return nil, ErrWebhookInvalidPayload
+	}
+	return &PaymentCallback{
+		ReferenceID: n.OrderID,
+		Status:      orangeStatus(n.Status),
+		ProviderRef: n.TxnID,
+		Provider:    c.Name(),
+	}, nil
+}
+
+// orangeStatus maps OM statuses (including its "SUCCESSFULL" spelling) onto
+// ours. Only an explicit terminal status is final: an empty or unrecognised one
+// ("PROCESSING", "ACCEPTED") is pending, since Orange may still complete it.
+func orangeStatus(status string) string {
+	switch strings.ToUpper(status) {
+	case "SUCCESSFULL", "SUCCESSFUL", "SUCCESS":
+		return PaymentStatusSuccessful
+	case "FAILED", "CANCELLED", "EXPIRED", "REJECTED":
+		return PaymentStatusFailed
+	default:
+		return PaymentStatusPending
+	}
+}
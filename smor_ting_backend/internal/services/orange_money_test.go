@@ -0,0 +1,212 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// fakeOrange is a minimal OM Core API that keeps payments by orderId
+type fakeOrange struct {
+	*httptest.Server
+	mu       sync.Mutex
+	payments map[string]map[string]string // orderId -> request body
+	statuses map[string]string            // orderId -> OM status
+	reply    string                       // status the pay endpoints answer with
+}
+
+func newFakeOrange(t *testing.T) *fakeOrange {
+	t.Helper()
+	f := &fakeOrange{payments: map[string]map[string]string{}, statuses: map[string]string{}, reply: "PENDING"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/v3/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "om-token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	authorized := func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer om-token" && r.Header.Get("X-AUTH-TOKEN") != ""
+	}
+	pay := func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.payments[body["orderId"]] = body
+		f.statuses[body["orderId"]] = "PENDING"
+		reply := f.reply
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"status": reply}})
+	}
+	status := func(prefix string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(r) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			f.mu.Lock()
+			s, ok := f.statuses[strings.TrimPrefix(r.URL.Path, prefix)]
+			f.mu.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"status": s}})
+		}
+	}
+	mux.HandleFunc("/omcoreapis/1.0.2/mp/pay", pay)
+	mux.HandleFunc("/omcoreapis/1.0.2/cashin/pay", pay)
+	mux.HandleFunc("/omcoreapis/1.0.2/mp/paymentstatus/", status("/omcoreapis/1.0.2/mp/paymentstatus/"))
+	mux.HandleFunc("/omcoreapis/1.0.2/cashin/paymentstatus/", status("/omcoreapis/1.0.2/cashin/paymentstatus/"))
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOrange) client() *services.OrangeMoneyClient {
+	return services.NewOrangeMoneyClient(f.URL, "client", "secret", "api", "pass", "231880000000", "https://example.com/api/v1/webhooks/orange_money")
+}
+
+func (f *fakeOrange) set(orderID, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[orderID] = status
+}
+
+func TestOrangeMoney_CollectDisburseAndStatus(t *testing.T) {
+	om := newFakeOrange(t)
+	c := om.client()
+	ctx := context.Background()
+
+	if err := c.Collect(ctx, services.MobileMoneyRequest{ReferenceID: "om-1", Amount: "25", Currency: "USD", MSISDN: "231880000001", Message: "Wallet topup"}); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got := om.payments["om-1"]; got["subscriberMsisdn"] != "231880000001" || got["channelUserMsisdn"] != "231880000000" || got["notifUrl"] == "" {
+		t.Fatalf("unexpected payment body: %v", got)
+	}
+	for omStatus, want := range map[string]string{"PENDING": "PENDING", "SUCCESSFULL": "SUCCESSFUL", "CANCELLED": "FAILED", "EXPIRED": "FAILED",
+		"": "PENDING", "PROCESSING": "PENDING"} {
+		om.set("om-1", omStatus)
+		if status, err := c.Status(ctx, services.PaymentCollection, "om-1"); err != nil || status != want {
+			t.Fatalf("OM %s: expected %s, got %q, %v", omStatus, want, status, err)
+		}
+	}
+
+	if err := c.Disburse(ctx, services.MobileMoneyRequest{ReferenceID: "om-2", Amount: "10", Currency: "USD", MSISDN: "231880000002"}); err != nil {
+		t.Fatalf("disburse: %v", err)
+	}
+	if status, err := c.Status(ctx, services.PaymentDisbursement, "om-2"); err != nil || status != "PENDING" {
+		t.Fatalf("disbursement status: %q, %v", status, err)
+	}
+	if err := c.Collect(ctx, services.MobileMoneyRequest{Amount: "10"}); err == nil {
+		t.Fatal("a payment without our reference must be refused")
+	}
+
+	// Only an explicit refusal in an accepted response is a rejection
+	for reply, rejected := range map[string]bool{"": false, "ACCEPTED": false, "REJECTED": true} {
+		om.mu.Lock()
+		om.reply = reply
+		om.mu.Unlock()
+		err := c.Disburse(ctx, services.MobileMoneyRequest{ReferenceID: "om-reply-" + reply, Amount: "10", Currency: "USD", MSISDN: "231880000002"})
+		if errors.Is(err, services.ErrPaymentRejected) != rejected || (!rejected && err != nil) {
+			t.Fatalf("pay answered %q: expected rejected=%v, got %v", reply, rejected, err)
+		}
+	}
+}
+
+func TestPaymentProviders_ResolvesAliasesAndDefault(t *testing.T) {
+	om := newFakeOrange(t)
+	providers := services.NewPaymentProviders(services.NewMomoProvider(newFakeMomoAPI()), om.client())
+
+	for name, want := range map[string]string{"": models.PaymentProviderMTNMomo, "lonestar_cell_mtn": models.PaymentProviderMTNMomo, "Orange": models.PaymentProviderOrangeMoney, "orange_money": models.PaymentProviderOrangeMoney} {
+		p, err := providers.Get(name)
+		if err != nil || p.Name() != want {
+			t.Fatalf("%q: expected %s, got %v, %v", name, want, p, err)
+		}
+	}
+	if _, err := providers.Get("flutterwave"); !errors.Is(err, services.ErrUnknownPaymentProvider) {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+}
+
+func TestMomoWebhook_OrangeNotificationIsConfirmedWithOrange(t *testing.T) {
+	om := newFakeOrange(t)
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	u := newWebhookUser(t, repo)
+	svc := services.NewMomoWebhookService(nil, ledger, nil, services.NewHMACCallbackVerifier("s3cret"), nil)
+	orange := om.client()
+	ctx := context.Background()
+
+	err := ledger.RecordIntent(ctx, &models.WalletLedgerEntry{
+		UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 35, Currency: "USD",
+		Reference: "om-topup", Provider: models.PaymentProviderOrangeMoney,
+	})
+	if err != nil {
+		t.Fatalf("record intent: %v", err)
+	}
+	topupIntent(t, ledger, u.ID, "momo-topup", 10)
+
+	// Orange has not completed the payment: the notification's claim is overridden
+	om.set("om-topup", "PENDING")
+	if event, err := svc.ReceiveFrom(ctx, orange, []byte(`{"orderId":"om-topup","status":"SUCCESSFULL","txnid":"MP1"}`)); err != nil || event.Status != "PENDING" {
+		t.Fatalf("expected the PENDING status from Orange, got %+v, %v", event, err)
+	}
+	om.set("om-topup", "SUCCESSFULL")
+	if _, err := svc.ReceiveFrom(ctx, orange, []byte(`{"orderId":"om-topup","status":"SUCCESSFULL","txnid":"MP1"}`)); err != nil {
+		t.Fatalf("notification: %v", err)
+	}
+	if bal, _ := ledger.ComputeBalances(ctx, u.ID); bal.Available != 35 {
+		t.Fatalf("expected 35 credited, got %+v", bal)
+	}
+
+	// A MoMo reference cannot be settled through the Orange route
+	if _, err := svc.ReceiveFrom(ctx, orange, []byte(`{"orderId":"momo-topup","status":"SUCCESSFULL"}`)); !errors.Is(err, services.ErrWebhookUnknownReference) {
+		t.Fatalf("expected unknown reference for another provider's intent, got %v", err)
+	}
+	if _, err := svc.ReceiveFrom(ctx, orange, []byte(`{"status":"SUCCESSFULL"}`)); !errors.Is(err, services.ErrWebhookInvalidPayload) {
+		t.Fatalf("expected invalid payload, got %v", err)
+	}
+}
+
+func TestReconciler_PollsTheIntentsProvider(t *testing.T) {
+	f := newReconcileFixture(t)
+	om := newFakeOrange(t)
+	ctx := context.Background()
+	f.reconciler = services.NewMomoReconciler(services.NewPaymentProviders(services.NewMomoProvider(f.momo), om.client()),
+		f.ledger.Entries(), f.webhooks, nil, 0, time.Minute, nil)
+
+	f.pending(t, models.LedgerTopup, "momo-ref", 10)
+	err := f.ledger.RecordIntent(ctx, &models.WalletLedgerEntry{
+		UserID: f.user.ID, Type: models.LedgerWithdraw, Direction: models.LedgerDebit, Amount: 4, Currency: "USD",
+		Reference: "om-ref", Provider: models.PaymentProviderOrangeMoney,
+	})
+	if err != nil {
+		t.Fatalf("record intent: %v", err)
+	}
+	f.momo.collect["momo-ref"] = "SUCCESSFUL"
+	om.set("om-ref", "SUCCESSFULL")
+
+	res, err := f.reconciler.RunOnce(ctx)
+	if err != nil || res.Settled != 2 || res.Errors != 0 {
+		t.Fatalf("expected both intents settled at their own provider, got %+v, %v", res, err)
+	}
+	if bal, _ := f.ledger.ComputeBalances(ctx, f.user.ID); bal.Available != 6 {
+		t.Fatalf("expected 10 in and 4 out, got %+v", bal)
+	}
+}
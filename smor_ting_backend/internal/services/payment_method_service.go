@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidMsisdn                        = errors.New("invalid msisdn")
+	ErrPaymentMethodExists                  = errors.New("payment method already linked")
+	ErrPaymentMethodNotPending              = errors.New("payment method is not awaiting verification")
+	ErrPaymentMethodInactive                = errors.New("payment method is not active")
+	ErrPaymentMethodOTPInvalid              = errors.New("invalid verification code")
+	ErrPaymentMethodOTPExpired              = errors.New("verification code expired")
+	ErrPaymentMethodOTPLocked               = errors.New("too many verification attempts")
+	ErrPaymentMethodVerificationUnavailable = errors.New("payment method verification unavailable")
+)
+
+const (
+	paymentMethodOTPTTL         = 10 * time.Minute
+	paymentMethodOTPMaxAttempts = 5
+)
+
+// PaymentMethodOTPSender delivers the code that proves the user holds the number being linked
+type PaymentMethodOTPSender interface {
+	SendOTP(ctx context.Context, msisdn, code string) error
+}
+
+// LoggingOTPSender writes codes to the log instead of sending them; development only
+type LoggingOTPSender struct {
+	logger *zap.Logger
+}
+
+func NewLoggingOTPSender(logger *zap.Logger) *LoggingOTPSender {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &LoggingOTPSender{logger: logger}
+}
+
+func (s *LoggingOTPSender) SendOTP(ctx context.Context, msisdn, code string) error {
+	s.logger.Info("Payment method verification code", zap.String("msisdn", MaskMsisdn(msisdn)), zap.String("code", code))
+	return nil
+}
+
+// PaymentMethodService links mobile-money numbers to users. A number is stored
+// encrypted and stays pending until the user enters the OTP sent to it.
+type PaymentMethodService struct {
+	store        PaymentMethodStore
+	encryption   *EncryptionService
+	sender       PaymentMethodOTPSender
+	auditService *AuditService
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+// NewPaymentMethodService creates the service; with a nil sender numbers cannot be verified, so linking is refused
+func NewPaymentMethodService(store PaymentMethodStore, encryption *EncryptionService, sender PaymentMethodOTPSender, auditService *AuditService, logger *zap.Logger) *PaymentMethodService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	return &PaymentMethodService{store: store, encryption: encryption, sender: sender, auditService: auditService, logger: logger, now: time.Now}
+}
+
+// AuditContext is who performed a change and from where, for the audit trail
+type AuditContext struct {
+	IPAddress string
+	UserAgent string
+}
+
+// Link starts linking msisdn and sends it a verification code. Linking a number
+// that is already pending re-sends the code instead of creating a duplicate.
+func (s *PaymentMethodService) Link(ctx context.Context, user *models.User, provider, msisdn string, makeDefault bool) (*models.LinkedPaymentMethod, error) {
+	if s.sender == nil {
+		return nil, ErrPaymentMethodVerificationUnavailable
+	}
+	canonical, ok := models.CanonicalPaymentProvider(provider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPaymentProvider, provider)
+	}
+	number, err := NormalizeMsisdn(msisdn)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := s.findByNumber(ctx, user.ID, canonical, number)
+	if err != nil {
+		return nil, err
+	}
+	if method != nil && method.Status == models.PaymentMethodActive {
+		return nil, ErrPaymentMethodExists
+	}
+	code, err := newPaymentMethodOTP()
+	if err != nil {
+		return nil, err
+	}
+	if method == nil {
+		encrypted, err := s.encryption.EncryptString(number)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt msisdn: %w", err)
+		}
+		method = &models.LinkedPaymentMethod{
+			ID:              primitive.NewObjectID(),
+			UserID:          user.ID,
+			Type:            models.PaymentMethodMobileMoney,
+			Provider:        canonical,
+			Msisdn:          MaskMsisdn(number),
+			MsisdnEncrypted: encrypted,
+			Status:          models.PaymentMethodPending,
+		}
+		s.issueOTP(method, code, makeDefault)
+		err = s.store.Create(ctx, method)
+	} else {
+		s.issueOTP(method, code, makeDefault)
+		err = s.store.Update(ctx, method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sender.SendOTP(ctx, number, code); err != nil {
+		return nil, fmt.Errorf("send verification code: %w", err)
+	}
+	return method, nil
+}
+
+// Verify activates a pending method when code matches the one sent to its number
+func (s *PaymentMethodService) Verify(ctx context.Context, user *models.User, id primitive.ObjectID, code string, ac AuditContext) (*models.LinkedPaymentMethod, error) {
+	method, err := s.store.Get(ctx, user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if method.Status != models.PaymentMethodPending {
+		return nil, ErrPaymentMethodNotPending
+	}
+	if method.OTPAttempts >= paymentMethodOTPMaxAttempts {
+		return nil, ErrPaymentMethodOTPLocked
+	}
+	if method.OTPExpiresAt == nil || !s.now().Before(*method.OTPExpiresAt) {
+		return nil, ErrPaymentMethodOTPExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPaymentMethodOTP(method.ID, strings.TrimSpace(code))), []byte(method.OTPHash)) != 1 {
+		method.OTPAttempts++
+		if err := s.store.Update(ctx, method); err != nil {
+			return nil, err
+		}
+		s.audit(ctx, user, ActionWalletLink, method, ac, false, map[string]interface{}{"reason": "invalid_otp", "attempts": method.OTPAttempts})
+		return nil, ErrPaymentMethodOTPInvalid
+	}
+
+	makeDefault := method.DefaultOnVerify
+	now := s.now()
+	method.Status = models.PaymentMethodActive
+	method.VerifiedAt = &now
+	method.OTPHash, method.OTPExpiresAt, method.OTPAttempts, method.DefaultOnVerify = "", nil, 0, false
+	if err := s.store.Update(ctx, method); err != nil {
+		return nil, err
+	}
+	// The first verified method becomes the default even when not asked for
+	if !makeDefault {
+		current, err := s.Default(ctx, user.ID)
+		if err != nil && !errors.Is(err, ErrPaymentMethodNotFound) {
+			return nil, err
+		}
+		makeDefault = current == nil
+	}
+	if makeDefault {
+		if err := s.store.SetDefault(ctx, user.ID, method.ID); err != nil {
+			return nil, err
+		}
+		method.IsDefault = true
+	}
+	s.audit(ctx, user, ActionWalletLink, method, ac, true, nil)
+	return method, nil
+}
+
+// List returns the user's linked methods, pending ones included so they can be verified
+func (s *PaymentMethodService) List(ctx context.Context, userID primitive.ObjectID) ([]models.LinkedPaymentMethod, error) {
+	return s.store.ListByUser(ctx, userID)
+}
+
+// Default returns the user's default active method
+func (s *PaymentMethodService) Default(ctx context.Context, userID primitive.ObjectID) (*models.LinkedPaymentMethod, error) {
+	methods, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range methods {
+		if methods[i].IsDefault && methods[i].Status == models.PaymentMethodActive {
+			return &methods[i], nil
+		}
+	}
+	return nil, ErrPaymentMethodNotFound
+}
+
+// SetDefault makes an active method the user's default
+func (s *PaymentMethodService) SetDefault(ctx context.Context, user *models.User, id primitive.ObjectID) (*models.LinkedPaymentMethod, error) {
+	method, err := s.store.Get(ctx, user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if method.Status != models.PaymentMethodActive {
+		return nil, ErrPaymentMethodInactive
+	}
+	if err := s.store.SetDefault(ctx, user.ID, id); err != nil {
+		return nil, err
+	}
+	method.IsDefault = true
+	return method, nil
+}
+
+// Unlink removes a method. When it was the default, the most recently linked
+// remaining active method takes over.
+func (s *PaymentMethodService) Unlink(ctx context.Context, user *models.User, id primitive.ObjectID, ac AuditContext) error {
+	method, err := s.store.Get(ctx, user.ID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, user.ID, id); err != nil {
+		return err
+	}
+	s.audit(ctx, user, ActionWalletUnlink, method, ac, true, nil)
+	if !method.IsDefault {
+		return nil
+	}
+	remaining, err := s.store.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range remaining {
+		if m.Status == models.PaymentMethodActive {
+			return s.store.SetDefault(ctx, user.ID, m.ID)
+		}
+	}
+	return nil
+}
+
+// Resolve returns an active method and its full MSISDN, for paying to or collecting from it
+func (s *PaymentMethodService) Resolve(ctx context.Context, userID, id primitive.ObjectID) (*models.LinkedPaymentMethod, string, error) {
+	method, err := s.store.Get(ctx, userID, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if method.Status != models.PaymentMethodActive {
+		return nil, "", ErrPaymentMethodInactive
+	}
+	number, err := s.encryption.DecryptString(method.MsisdnEncrypted)
+	if err != nil {
+		return nil, "", fmt.Errorf("decrypt msisdn: %w", err)
+	}
+	return method, number, nil
+}
+
+// findByNumber returns the user's non-disabled method for the number at the provider, if any
+func (s *PaymentMethodService) findByNumber(ctx context.Context, userID primitive.ObjectID, provider, number string) (*models.LinkedPaymentMethod, error) {
+	methods, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range methods {
+		m := &methods[i]
+		if m.Provider != provider || m.Status == models.PaymentMethodDisabled {
+			continue
+		}
+		stored, err := s.encryption.DecryptString(m.MsisdnEncrypted)
+		if err != nil {
+			s.logger.Warn("Undecryptable linked payment method", zap.String("method_id", m.ID.Hex()), zap.Error(err))
+			continue
+		}
+		if stored == number {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *PaymentMethodService) issueOTP(method *models.LinkedPaymentMethod, code string, makeDefault bool) {
+	expires := s.now().Add(paymentMethodOTPTTL)
+	method.OTPHash = hashPaymentMethodOTP(method.ID, code)
+	method.OTPExpiresAt = &expires
+	method.OTPAttempts = 0
+	method.DefaultOnVerify = makeDefault
+}
+
+func (s *PaymentMethodService) audit(ctx context.Context, user *models.User, action AuditAction, method *models.LinkedPaymentMethod, ac AuditContext, success bool, extra map[string]interface{}) {
+	details := map[string]interface{}{
+		"method_id": method.ID.Hex(),
+		"provider":  method.Provider,
+		"msisdn":    method.Msisdn,
+	}
+	for k, v := range extra {
+		details[k] = v
+	}
+	_ = s.auditService.LogAction(ctx, &AuditEntry{
+		UserID:     user.ID.Hex(),
+		UserEmail:  user.Email,
+		UserRole:   string(user.Role),
+		Action:     action,
+		Resource:   "payment_method",
+		ResourceID: method.ID.Hex(),
+		IPAddress:  ac.IPAddress,
+		UserAgent:  ac.UserAgent,
+		Details:    details,
+		Success:    success,
+	})
+}
+
+// NormalizeMsisdn strips formatting from a phone number, leaving 8 to 15 digits in international form
+func NormalizeMsisdn(msisdn string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(strings.TrimSpace(msisdn), "+") {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidMsisdn
+		}
+	}
+	if n := b.Len(); n < 8 || n > 15 {
+		return "", ErrInvalidMsisdn
+	}
+	return b.String(), nil
+}
+
+// MaskMsisdn keeps only the last four digits of a number
+func MaskMsisdn(msisdn string) string {
+	if len(msisdn) < 4 {
+		return msisdn
+	}
+	return "***" + msisdn[len(msisdn)-4:]
+}
+
+func newPaymentMethodOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashPaymentMethodOTP binds the code to the method so it cannot verify another one
+func hashPaymentMethodOTP(id primitive.ObjectID, code string) string {
+	sum := sha256.Sum256([]byte(id.Hex() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,201 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// capturedOTPs records the last code sent to each number
+type capturedOTPs map[string]string
+
+func (c capturedOTPs) SendOTP(ctx context.Context, msisdn, code string) error {
+	c[msisdn] = code
+	return nil
+}
+
+func newPaymentMethodService(t *testing.T) (*services.PaymentMethodService, services.PaymentMethodStore, capturedOTPs, *observer.ObservedLogs) {
+	t.Helper()
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption: %v", err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	lg := zap.New(core)
+	store := services.NewMemoryPaymentMethodStore()
+	otps := capturedOTPs{}
+	return services.NewPaymentMethodService(store, enc, otps, services.NewAuditService(nil, lg), lg), store, otps, logs
+}
+
+func auditActions(logs *observer.ObservedLogs) []string {
+	var out []string
+	for _, e := range logs.FilterMessage("Audit log entry created").All() {
+		if e.ContextMap()["success"] == true {
+			out = append(out, e.ContextMap()["action"].(string))
+		}
+	}
+	return out
+}
+
+func TestPaymentMethods_LinkRequiresOTPAndEncryptsNumber(t *testing.T) {
+	svc, store, otps, logs := newPaymentMethodService(t)
+	ctx := context.Background()
+	user := &models.User{ID: primitive.NewObjectID(), Email: "link@example.com"}
+
+	method, err := svc.Link(ctx, user, "Lonestar", "+231 77 000 1234", false)
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if method.Status != models.PaymentMethodPending || method.Provider != models.PaymentProviderMTNMomo || method.Msisdn != "***1234" {
+		t.Fatalf("unexpected pending method: %+v", method)
+	}
+	stored, _ := store.Get(ctx, user.ID, method.ID)
+	if stored.MsisdnEncrypted == "" || strings.Contains(stored.MsisdnEncrypted, "2317700") {
+		t.Fatalf("the full number must only be stored encrypted, got %q", stored.MsisdnEncrypted)
+	}
+	if _, _, err := svc.Resolve(ctx, user.ID, method.ID); !errors.Is(err, services.ErrPaymentMethodInactive) {
+		t.Fatalf("an unverified number must not be usable, got %v", err)
+	}
+
+	code := otps["231770001234"]
+	if _, err := svc.Verify(ctx, user, method.ID, "not-the-code", services.AuditContext{}); !errors.Is(err, services.ErrPaymentMethodOTPInvalid) {
+		t.Fatalf("expected invalid otp, got %v", err)
+	}
+	verified, err := svc.Verify(ctx, user, method.ID, code, services.AuditContext{IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if verified.Status != models.PaymentMethodActive || !verified.IsDefault {
+		t.Fatalf("the first verified method should be active and default, got %+v", verified)
+	}
+	if _, number, err := svc.Resolve(ctx, user.ID, method.ID); err != nil || number != "231770001234" {
+		t.Fatalf("resolve: %q, %v", number, err)
+	}
+	if _, err := svc.Link(ctx, user, "mtn_momo", "231770001234", false); !errors.Is(err, services.ErrPaymentMethodExists) {
+		t.Fatalf("expected an already linked number to be refused, got %v", err)
+	}
+	if got := auditActions(logs); len(got) != 1 || got[0] != string(services.ActionWalletLink) {
+		t.Fatalf("expected one successful WALLET_LINK audit entry, got %v", got)
+	}
+
+	// Another user cannot verify or resolve it
+	other := &models.User{ID: primitive.NewObjectID()}
+	if _, _, err := svc.Resolve(ctx, other.ID, method.ID); !errors.Is(err, services.ErrPaymentMethodNotFound) {
+		t.Fatalf("expected not found for another user, got %v", err)
+	}
+}
+
+func TestPaymentMethods_OTPAttemptsAreLimited(t *testing.T) {
+	svc, _, otps, _ := newPaymentMethodService(t)
+	ctx := context.Background()
+	user := &models.User{ID: primitive.NewObjectID()}
+
+	method, _ := svc.Link(ctx, user, "orange", "231880000001", false)
+	for i := 0; i < 5; i++ {
+		if _, err := svc.Verify(ctx, user, method.ID, "wrong", services.AuditContext{}); !errors.Is(err, services.ErrPaymentMethodOTPInvalid) {
+			t.Fatalf("attempt %d: expected invalid otp, got %v", i, err)
+		}
+	}
+	if _, err := svc.Verify(ctx, user, method.ID, otps["231880000001"], services.AuditContext{}); !errors.Is(err, services.ErrPaymentMethodOTPLocked) {
+		t.Fatalf("expected lockout even with the right code, got %v", err)
+	}
+
+	// Linking the same number again re-sends a code to the pending method
+	again, err := svc.Link(ctx, user, "orange_money", "231880000001", false)
+	if err != nil || again.ID != method.ID {
+		t.Fatalf("expected the pending method to be reused, got %+v, %v", again, err)
+	}
+	if _, err := svc.Verify(ctx, user, method.ID, otps["231880000001"], services.AuditContext{}); err != nil {
+		t.Fatalf("verify with the re-sent code: %v", err)
+	}
+}
+
+func TestPaymentMethods_OneDefaultPerUser(t *testing.T) {
+	svc, store, otps, logs := newPaymentMethodService(t)
+	ctx := context.Background()
+	user := &models.User{ID: primitive.NewObjectID()}
+	link := func(provider, msisdn string, makeDefault bool) *models.LinkedPaymentMethod {
+		t.Helper()
+		m, err := svc.Link(ctx, user, provider, msisdn, makeDefault)
+		if err != nil {
+			t.Fatalf("link: %v", err)
+		}
+		if m, err = svc.Verify(ctx, user, m.ID, otps[msisdn], services.AuditContext{}); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		return m
+	}
+	defaults := func() []primitive.ObjectID {
+		list, _ := store.ListByUser(ctx, user.ID)
+		var out []primitive.ObjectID
+		for _, m := range list {
+			if m.IsDefault {
+				out = append(out, m.ID)
+			}
+		}
+		return out
+	}
+
+	first := link("mtn", "231770000001", false)
+	second := link("mtn", "231770000002", false)
+	if d := defaults(); len(d) != 1 || d[0] != first.ID {
+		t.Fatalf("expected the first method to stay default, got %v", d)
+	}
+	third := link("orange", "231880000003", true)
+	if d := defaults(); len(d) != 1 || d[0] != third.ID {
+		t.Fatalf("expected the method linked as default to take over, got %v", d)
+	}
+	if _, err := svc.SetDefault(ctx, user, second.ID); err != nil {
+		t.Fatalf("set default: %v", err)
+	}
+	if d := defaults(); len(d) != 1 || d[0] != second.ID {
+		t.Fatalf("expected a single default, got %v", d)
+	}
+
+	pending, _ := svc.Link(ctx, user, "mtn", "231770000004", false)
+	if _, err := svc.SetDefault(ctx, user, pending.ID); !errors.Is(err, services.ErrPaymentMethodInactive) {
+		t.Fatalf("a pending method cannot be the default, got %v", err)
+	}
+
+	// Unlinking the default hands it to the newest remaining active method
+	if err := svc.Unlink(ctx, user, second.ID, services.AuditContext{}); err != nil {
+		t.Fatalf("unlink: %v", err)
+	}
+	if d := defaults(); len(d) != 1 || d[0] != third.ID {
+		t.Fatalf("expected the newest active method to become default, got %v", d)
+	}
+	if err := svc.Unlink(ctx, user, second.ID, services.AuditContext{}); !errors.Is(err, services.ErrPaymentMethodNotFound) {
+		t.Fatalf("expected not found on a second unlink, got %v", err)
+	}
+	if got := auditActions(logs); got[len(got)-1] != string(services.ActionWalletUnlink) {
+		t.Fatalf("expected a WALLET_UNLINK audit entry, got %v", got)
+	}
+}
+
+func TestPaymentMethods_RejectsBadInput(t *testing.T) {
+	svc, _, _, _ := newPaymentMethodService(t)
+	ctx := context.Background()
+	user := &models.User{ID: primitive.NewObjectID()}
+
+	if _, err := svc.Link(ctx, user, "mtn", "0770-ABC", false); !errors.Is(err, services.ErrInvalidMsisdn) {
+		t.Fatalf("expected invalid msisdn, got %v", err)
+	}
+	if _, err := svc.Link(ctx, user, "paypal", "231770000001", false); !errors.Is(err, services.ErrUnknownPaymentProvider) {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+
+	key, _ := services.GenerateEncryptionKey()
+	enc, _ := services.NewEncryptionService(key)
+	unverifiable := services.NewPaymentMethodService(services.NewMemoryPaymentMethodStore(), enc, nil, nil, nil)
+	if _, err := unverifiable.Link(ctx, user, "mtn", "231770000001", false); !errors.Is(err, services.ErrPaymentMethodVerificationUnavailable) {
+		t.Fatalf("expected linking to be refused without an OTP sender, got %v", err)
+	}
+}
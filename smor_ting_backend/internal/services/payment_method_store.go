@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrPaymentMethodNotFound = errors.New("payment method not found")
+
+// PaymentMethodStore persists linked payment methods. SetDefault is the only way
+// a method becomes the default, so each user has at most one.
+type PaymentMethodStore interface {
+	Create(ctx context.Context, method *models.LinkedPaymentMethod) error
+	// Get returns the user's method; another user's method is reported as not found
+	Get(ctx context.Context, userID, id primitive.ObjectID) (*models.LinkedPaymentMethod, error)
+	// ListByUser returns the user's methods, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.LinkedPaymentMethod, error)
+	// Update replaces the method; IsDefault is left as stored
+	Update(ctx context.Context, method *models.LinkedPaymentMethod) error
+	// SetDefault makes the method the user's default and clears the flag on the others
+	SetDefault(ctx context.Context, userID, id primitive.ObjectID) error
+	Delete(ctx context.Context, userID, id primitive.ObjectID) error
+}
+
+// In-memory implementation for tests/dev
+type memoryPaymentMethodStore struct {
+	mu      sync.RWMutex
+	methods map[primitive.ObjectID]*models.LinkedPaymentMethod
+}
+
+func NewMemoryPaymentMethodStore() PaymentMethodStore {
+	return &memoryPaymentMethodStore{methods: make(map[primitive.ObjectID]*models.LinkedPaymentMethod)}
+}
+
+func (m *memoryPaymentMethodStore) Create(ctx context.Context, method *models.LinkedPaymentMethod) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if method.ID.IsZero() {
+		method.ID = primitive.NewObjectID()
+	}
+	method.CreatedAt = time.Now()
+	method.UpdatedAt = method.CreatedAt
+	method.IsDefault = false
+	cp := *method
+	m.methods[method.ID] = &cp
+	return nil
+}
+
+func (m *memoryPaymentMethodStore) Get(ctx context.Context, userID, id primitive.ObjectID) (*models.LinkedPaymentMethod, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.methods[id]
+	if !ok || stored.UserID != userID {
+		return nil, ErrPaymentMethodNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryPaymentMethodStore) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.LinkedPaymentMethod, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.LinkedPaymentMethod{}
+	for _, method := range m.methods {
+		if method.UserID == userID {
+			out = append(out, *method)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryPaymentMethodStore) Update(ctx context.Context, method *models.LinkedPaymentMethod) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.methods[method.ID]
+	if !ok || stored.UserID != method.UserID {
+		return ErrPaymentMethodNotFound
+	}
+	method.IsDefault = stored.IsDefault
+	method.UpdatedAt = time.Now()
+	cp := *method
+	m.methods[method.ID] = &cp
+	return nil
+}
+
+func (m *memoryPaymentMethodStore) SetDefault(ctx context.Context, userID, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	target, ok := m.methods[id]
+	if !ok || target.UserID != userID {
+		return ErrPaymentMethodNotFound
+	}
+	for _, method := range m.methods {
+		if method.UserID == userID {
+			method.IsDefault = method.ID == id
+		}
+	}
+	target.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memoryPaymentMethodStore) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.methods[id]
+	if !ok || stored.UserID != userID {
+		return ErrPaymentMethodNotFound
+	}
+	delete(m.methods, id)
+	return nil
+}
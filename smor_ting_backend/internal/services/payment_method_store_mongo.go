@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoPaymentMethodStore persists linked payment methods in the
+// linked_payment_methods collection. A partial unique index on user_id over
+// default methods backs the one-default-per-user rule across instances.
+type MongoPaymentMethodStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoPaymentMethodStore(db *mongo.Database, logger *logger.Logger) (*MongoPaymentMethodStore, error) {
+	s := &MongoPaymentMethodStore{coll: db.Collection("linked_payment_methods"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("one_default_per_user").SetUnique(true).SetPartialFilterExpression(bson.M{"is_default": true}),
+		},
+	})
+	return s, nil
+}
+
+func (m *MongoPaymentMethodStore) Create(ctx context.Context, method *models.LinkedPaymentMethod) error {
+	if method.ID.IsZero() {
+		method.ID = primitive.NewObjectID()
+	}
+	method.CreatedAt = time.Now()
+	method.UpdatedAt = method.CreatedAt
+	method.IsDefault = false
+	_, err := m.coll.InsertOne(ctx, method)
+	return err
+}
+
+func (m *MongoPaymentMethodStore) Get(ctx context.Context, userID, id primitive.ObjectID) (*models.LinkedPaymentMethod, error) {
+	var out models.LinkedPaymentMethod
+	if err := m.coll.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPaymentMethodNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoPaymentMethodStore) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.LinkedPaymentMethod, error) {
+	cur, err := m.coll.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.LinkedPaymentMethod{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *MongoPaymentMethodStore) Update(ctx context.Context, method *models.LinkedPaymentMethod) error {
+	method.UpdatedAt = time.Now()
+	raw, err := bson.Marshal(method)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+	delete(set, "_id")
+	delete(set, "is_default")
+	// Fields cleared on the struct must be cleared in the document too
+	unset := bson.M{}
+	for _, field := range []string{"otp_hash", "otp_expires_at", "otp_attempts", "default_on_verify", "verified_at"} {
+		if _, ok := set[field]; !ok {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := m.coll.UpdateOne(ctx, bson.M{"_id": method.ID, "user_id": method.UserID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPaymentMethodNotFound
+	}
+	return nil
+}
+
+func (m *MongoPaymentMethodStore) SetDefault(ctx context.Context, userID, id primitive.ObjectID) error {
+	for attempt := 0; ; attempt++ {
+		if _, err := m.coll.UpdateMany(ctx,
+			bson.M{"user_id": userID, "is_default": true, "_id": bson.M{"$ne": id}},
+			bson.M{"$set": bson.M{"is_default": false, "updated_at": time.Now()}},
+		); err != nil {
+			return err
+		}
+		res, err := m.coll.UpdateOne(ctx,
+			bson.M{"_id": id, "user_id": userID},
+			bson.M{"$set": bson.M{"is_default": true, "updated_at": time.Now()}},
+		)
+		// A concurrent SetDefault for the same user won the index; clear it and retry
+		if mongo.IsDuplicateKeyError(err) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrPaymentMethodNotFound
+		}
+		return nil
+	}
+}
+
+func (m *MongoPaymentMethodStore) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	res, err := m.coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrPaymentMethodNotFound
+	}
+	return nil
+}
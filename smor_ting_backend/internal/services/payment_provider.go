@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smorting/backend/internal/models"
+)
+
+var (
+	ErrUnknownPaymentProvider = errors.New("unsupported payment provider")
+	// ErrPaymentRejected marks a provider's definitive refusal of a collection or
+	// disbursement. Any other error (a timeout, a dropped connection, a 5xx) leaves
+	// the outcome unknown: the provider may still complete the payment under our
+	// reference, so its intent stays pending until a callback or status query settles it.
+	ErrPaymentRejected = errors.New("payment rejected by provider")
+)
+
+// paymentRequestError describes a provider's non-success answer to a payment
+// request. A 4xx is a definitive rejection, except 409, which means the
+// reference was already received.
+func paymentRequestError(op string, statusCode int, body []byte) error {
+	if statusCode >= 400 && statusCode < 500 && statusCode != http.StatusConflict {
+		return fmt.Errorf("%w: %s failed: %s", ErrPaymentRejected, op, string(body))
+	}
+	return fmt.Errorf("%s failed (%d): %s", op, statusCode, string(body))
+}
+
+// PaymentOperation is the direction of money movement with a provider
+type PaymentOperation string
+
+const (
+	PaymentCollection   PaymentOperation = "collection"   // pull from the customer's mobile wallet
+	PaymentDisbursement PaymentOperation = "disbursement" // pay out to a mobile wallet
+)
+
+// Provider statuses after normalisation; the ledger, webhooks and reconciler only see these
+const (
+	PaymentStatusSuccessful = "SUCCESSFUL"
+	PaymentStatusPending    = "PENDING"
+	PaymentStatusFailed     = "FAILED"
+)
+
+// MobileMoneyRequest is a collection or disbursement in provider-neutral terms.
+// ReferenceID is ours, recorded as an intent before the provider is called.
+type MobileMoneyRequest struct {
+	ReferenceID string
+	Amount      string
+	Currency    string
+	MSISDN      string
+	ExternalID  string
+	Message     string // shown to the payer/payee where the provider supports it
+	Note        string
+}
+
+// PaymentProvider is a mobile-money operator the wallet can collect from and pay out to
+type PaymentProvider interface {
+	// Name is the canonical provider name stored on intents and LinkedPaymentMethod.Provider
+	Name() string
+	EnsureOnline(ctx context.Context) error
+	Collect(ctx context.Context, req MobileMoneyRequest) error
+	Disburse(ctx context.Context, req MobileMoneyRequest) error
+	// Status returns the normalised status of one of our references
+	Status(ctx context.Context, op PaymentOperation, referenceID string) (string, error)
+	// ParseCallback turns the provider's notification body into a PaymentCallback.
+	// The result is untrusted until confirmed with Status or a signature.
+	ParseCallback(body []byte) (*PaymentCallback, error)
+}
+
+// paymentOperationFor maps an intent type onto the provider operation that funds it
+func paymentOperationFor(t models.LedgerType) (PaymentOperation, bool) {
+	switch t {
+	case models.LedgerTopup, models.LedgerEscrowHold, models.LedgerPayment:
+		return PaymentCollection, true
+	case models.LedgerWithdraw, models.LedgerRefund, models.LedgerPayout:
+		return PaymentDisbursement, true
+	}
+	return "", false
+}
+
+// PaymentProviders is the registry of configured providers, looked up by the
+// name (or an alias) a client or a LinkedPaymentMethod uses
+type PaymentProviders struct {
+	mu        sync.RWMutex
+	providers map[string]PaymentProvider
+	fallback  string
+}
+
+// NewPaymentProviders creates a registry; the first provider is the default for
+// requests and intents that name none
+func NewPaymentProviders(defaultProvider PaymentProvider, others ...PaymentProvider) *PaymentProviders {
+	r := &PaymentProviders{providers: map[string]PaymentProvider{}, fallback: defaultProvider.Name()}
+	r.Register(defaultProvider)
+	for _, p := range others {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds or replaces a provider under its name
+func (r *PaymentProviders) Register(p PaymentProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name()] = p
+}
+
+// Get returns the provider for a name or alias; an empty name yields the default
+func (r *PaymentProviders) Get(name string) (PaymentProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key := strings.ToLower(strings.TrimSpace(name))
+	if canonical, ok := models.CanonicalPaymentProvider(key); ok {
+		key = canonical
+	} else if key == "" {
+		key = r.fallback
+	}
+	p, ok := r.providers[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPaymentProvider, name)
+	}
+	return p, nil
+}
+
+// Names lists the canonical names of the registered providers
+func (r *PaymentProviders) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MomoProvider adapts the MTN MoMo API (MomoClient, the simulator or a fake) to PaymentProvider
+type MomoProvider struct {
+	api MomoAPI
+}
+
+func NewMomoProvider(api MomoAPI) *MomoProvider {
+	return &MomoProvider{api: api}
+}
+
+func (p *MomoProvider) Name() string { return models.PaymentProviderMTNMomo }
+
+func (p *MomoProvider) EnsureOnline(ctx context.Context) error {
+	return p.api.EnsureOnline(ctx)
+}
+
+func (p *MomoProvider) Collect(ctx context.Context, req MobileMoneyRequest) error {
+	_, err := p.api.RequestToPay(ctx, RequestToPay{
+		ReferenceID:  req.ReferenceID,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		ExternalId:   req.ExternalID,
+		Payer:        Party{PartyIdType: "MSISDN", PartyId: req.MSISDN},
+		PayerMessage: req.Message,
+		PayeeNote:    req.Note,
+	})
+	return err
+}
+
+func (p *MomoProvider) Disburse(ctx context.Context, req MobileMoneyRequest) error {
+	_, err := p.api.Transfer(ctx, TransferRequest{
+		ReferenceID:  req.ReferenceID,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		ExternalId:   req.ExternalID,
+		Payee:        Party{PartyIdType: "MSISDN", PartyId: req.MSISDN},
+		PayerMessage: req.Message,
+		PayeeNote:    req.Note,
+	})
+	return err
+}
+
+// Status folds MoMo's terminal failure statuses (REJECTED, TIMEOUT, ...) into FAILED
+func (p *MomoProvider) Status(ctx context.Context, op PaymentOperation, referenceID string) (string, error) {
+	var (
+		status string
+		err    error
+	)
+	switch op {
+	case PaymentCollection:
+		status, err = p.api.GetRequestToPayStatus(ctx, referenceID)
+	case PaymentDisbursement:
+		status, err = p.api.GetTransferStatus(ctx, referenceID)
+	default:
+		return "", fmt.Errorf("unknown payment operation %q", op)
+	}
+	if err != nil {
+		return "", err
+	}
+	switch status = strings.ToUpper(status); status {
+	case PaymentStatusSuccessful, PaymentStatusPending:
+		return status, nil
+	default:
+		return PaymentStatusFailed, nil
+	}
+}
+
+// ParseCallback reads MoMo's callback, which is already in our shape
+func (p *MomoProvider) ParseCallback(body []byte) (*PaymentCallback, error) {
+	var cb PaymentCallback
+	if err := json.Unmarshal(body, &cb); err != nil || cb.ReferenceID == "" || cb.Status == "" {
+		return nil, ErrWebhookInvalidPayload
+	}
+	cb.Provider = p.Name()
+	return &cb, nil
+}
@@ -0,0 +1,612 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// PayoutPolicy controls which balances are paid and how batches run
+type PayoutPolicy struct {
+	// Minimums is the smallest balance paid out per currency; currencies without one are not paid
+	Minimums map[string]float64
+	// Concurrency bounds the transfers in flight at once
+	Concurrency int
+	// Every is how often the worker gathers a batch; 0 leaves batches to admins
+	Every time.Duration
+	// PollInterval is how often the worker checks submitted items with the provider
+	PollInterval time.Duration
+}
+
+// PayoutService pays providers' wallet balances out to their default payout
+// number in batches. A batch gathers every provider's spendable balance at or
+// above the currency's minimum, records one item and one pending payout intent
+// per balance, then sends the transfers with bounded concurrency. Items settle
+// with their intent, through the provider's callback or by polling the
+// provider's transfer status.
+//
+// An item is only ever sent from pending, under a compare-and-set. It fails only
+// when the provider definitively rejects the transfer or reports it FAILED; when
+// the outcome is unknown (a timeout, a 5xx) it stays submitted and is tracked
+// under the same reference. A failed item is retried under a new reference once
+// its previous attempt is known to have failed, and only while the wallet still
+// covers it, so a retry can never pay twice.
+type PayoutService struct {
+	store        PayoutStore
+	repo         database.Repository
+	ledger       *WalletLedgerService
+	providers    *PaymentProviders
+	methods      *PaymentMethodService
+	encryption   *EncryptionService
+	webhooks     *MomoWebhookService
+	policy       PayoutPolicy
+	auditService *AuditService
+	logger       *zap.Logger
+
+	workerMu  sync.Mutex
+	isRunning bool
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewPayoutService creates a payout service. Settlements go through webhooks so
+// that a late callback for the same reference is recognised as a duplicate.
+func NewPayoutService(store PayoutStore, repo database.Repository, ledger *WalletLedgerService, providers *PaymentProviders, methods *PaymentMethodService, encryption *EncryptionService, webhooks *MomoWebhookService, policy PayoutPolicy, auditService *AuditService, logger *zap.Logger) *PayoutService {
+	if store == nil {
+		store = NewMemoryPayoutStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	if policy.Concurrency <= 0 {
+		policy.Concurrency = 1
+	}
+	if policy.PollInterval <= 0 {
+		policy.PollInterval = 5 * time.Minute
+	}
+	return &PayoutService{
+		store:        store,
+		repo:         repo,
+		ledger:       ledger,
+		providers:    providers,
+		methods:      methods,
+		encryption:   encryption,
+		webhooks:     webhooks,
+		policy:       policy,
+		auditService: auditService,
+		logger:       logger,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// RunBatch gathers the eligible provider balances and pays them. It returns a
+// nil batch when nothing is due. admin is nil for scheduled batches.
+func (s *PayoutService) RunBatch(ctx context.Context, admin *models.User, ac AuditContext) (*models.PayoutBatch, error) {
+	batch, items, err := s.gather(ctx, admin)
+	if batch == nil {
+		return nil, err
+	}
+	// Items gathered before a failure hold reserved funds, so they go out regardless
+	s.send(ctx, items)
+	batch, summariseErr := s.summarise(ctx, batch.ID)
+	if err == nil {
+		err = summariseErr
+	}
+	if admin != nil {
+		s.audit(ctx, admin, batch, "run", ac, err)
+	}
+	return batch, err
+}
+
+// Refresh settles the batch's submitted items whose transfer the provider has
+// completed or failed, and returns the updated batch
+func (s *PayoutService) Refresh(ctx context.Context, batchID primitive.ObjectID) (*models.PayoutBatch, error) {
+	items, err := s.store.ListItems(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].Status == models.PayoutItemSubmitted {
+			s.track(ctx, &items[i])
+		}
+	}
+	return s.summarise(ctx, batchID)
+}
+
+// Retry sends the batch's failed items again, and any never sent. Items whose
+// wallet no longer covers them stay failed.
+func (s *PayoutService) Retry(ctx context.Context, admin *models.User, batchID primitive.ObjectID, ac AuditContext) (*models.PayoutBatch, error) {
+	if _, err := s.Refresh(ctx, batchID); err != nil {
+		return nil, err
+	}
+	items, err := s.store.ListItems(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	var resend []*models.PayoutItem
+	for i := range items {
+		item := &items[i]
+		switch item.Status {
+		case models.PayoutItemPending:
+			// Never reached the provider, or did under this reference and is deduplicated by it
+			resend = append(resend, item)
+		case models.PayoutItemFailed:
+			if err := s.reopen(ctx, item); err != nil {
+				s.logger.Warn("Payout item not retried", zap.Error(err), zap.String("item_id", item.ID.Hex()))
+				continue
+			}
+			resend = append(resend, item)
+		}
+	}
+
+	s.send(ctx, resend)
+	batch, err := s.summarise(ctx, batchID)
+	s.audit(ctx, admin, batch, "retry", ac, err)
+	return batch, err
+}
+
+func (s *PayoutService) GetBatch(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error) {
+	return s.store.GetBatch(ctx, id)
+}
+
+func (s *PayoutService) ListBatches(ctx context.Context, limit int) ([]models.PayoutBatch, error) {
+	return s.store.ListBatches(ctx, limit)
+}
+
+func (s *PayoutService) Items(ctx context.Context, batchID primitive.ObjectID) ([]models.PayoutItem, error) {
+	if _, err := s.store.GetBatch(ctx, batchID); err != nil {
+		return nil, err
+	}
+	return s.store.ListItems(ctx, batchID)
+}
+
+// gather records a batch with one pending item and payout intent per eligible
+// balance; the intents reserve the funds before any transfer is sent. Each
+// balance is checked again and reserved under the provider's wallet lock, so a
+// debit or another batch in between cannot make it pay out more than is there.
+// If it fails part way, it returns the batch and the items already reserved
+// along with the error, so that they are still sent.
+func (s *PayoutService) gather(ctx context.Context, admin *models.User) (*models.PayoutBatch, []*models.PayoutItem, error) {
+	providers, err := s.repo.GetUsersByRole(ctx, models.ProviderRole)
+	if err != nil {
+		return nil, nil, err
+	}
+	type due struct {
+		user     *models.User
+		amount   float64
+		currency string
+		provider string
+		number   string
+	}
+	var dues []due
+	skipped := 0
+	for i := range providers {
+		user := &providers[i]
+		bal, err := s.ledger.ComputeBalances(ctx, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var owed []due
+		for currency, b := range bal.Currencies {
+			minimum, ok := s.policy.Minimums[currency]
+			if !ok {
+				continue
+			}
+			pending, err := s.ledger.PendingPayouts(ctx, user.ID, currency)
+			if err != nil {
+				return nil, nil, err
+			}
+			if amount := roundMinor(b.Available - pending); amount > 0 && amount >= minimum {
+				owed = append(owed, due{user: user, amount: amount, currency: currency})
+			}
+		}
+		if len(owed) == 0 {
+			continue
+		}
+		provider, number, err := s.destination(ctx, user)
+		if err != nil {
+			s.logger.Warn("Provider has no payout number", zap.Error(err), zap.String("user_id", user.ID.Hex()))
+			skipped++
+			continue
+		}
+		for _, d := range owed {
+			d.provider, d.number = provider, number
+			dues = append(dues, d)
+		}
+	}
+	if len(dues) == 0 {
+		return nil, nil, nil
+	}
+
+	batch := &models.PayoutBatch{
+		Status:  models.PayoutBatchProcessing,
+		Totals:  map[string]float64{},
+		Counts:  map[models.PayoutItemStatus]int{},
+		Skipped: skipped,
+	}
+	if admin != nil {
+		batch.TriggeredBy = &admin.ID
+	}
+	if err := s.store.CreateBatch(ctx, batch); err != nil {
+		return nil, nil, err
+	}
+	var (
+		items     []*models.PayoutItem
+		gatherErr error
+	)
+	for _, d := range dues {
+		encrypted, err := s.encryption.EncryptString(d.number)
+		if err != nil {
+			gatherErr = fmt.Errorf("encrypt msisdn: %w", err)
+			break
+		}
+		item := &models.PayoutItem{
+			BatchID:         batch.ID,
+			UserID:          d.user.ID,
+			Currency:        d.currency,
+			Provider:        d.provider,
+			Msisdn:          MaskMsisdn(d.number),
+			MsisdnEncrypted: encrypted,
+			Attempts:        1,
+			Status:          models.PayoutItemPending,
+		}
+		err = s.ledger.WithWalletLock(ctx, d.user.ID, func(ctx context.Context) error {
+			amount, err := s.ledger.Spendable(ctx, d.user.ID, d.currency)
+			if err != nil {
+				return err
+			}
+			if amount <= 0 || amount < s.policy.Minimums[d.currency] {
+				item.Amount = 0
+				return nil
+			}
+			item.Amount = amount
+			item.Reference = NewMomoReferenceID()
+			if err := s.store.CreateItem(ctx, item); err != nil {
+				item.Amount = 0
+				return err
+			}
+			if err := s.recordIntent(ctx, item); err != nil {
+				// Nothing is reserved, so the item must not be sent; Retry reopens it
+				item.Status, item.Failure = models.PayoutItemFailed, "funds could not be reserved"
+				if updateErr := s.store.UpdateItem(ctx, item, models.PayoutItemPending); updateErr != nil {
+					s.logger.Error("Failed to fail unreserved payout item", zap.Error(updateErr), zap.String("item_id", item.ID.Hex()))
+				}
+				return err
+			}
+			return nil
+		})
+		if item.Amount > 0 {
+			if item.Status == models.PayoutItemPending {
+				items = append(items, item)
+			}
+			batch.ItemCount++
+			batch.Totals[d.currency] = roundMinor(batch.Totals[d.currency] + item.Amount)
+		}
+		if err != nil {
+			gatherErr = err
+			break
+		}
+	}
+	if err := s.store.UpdateBatch(ctx, batch); err != nil && gatherErr == nil {
+		gatherErr = err
+	}
+	return batch, items, gatherErr
+}
+
+// destination is the provider and number a provider is paid at: their default
+// linked method, else their phone at the default provider
+func (s *PayoutService) destination(ctx context.Context, user *models.User) (string, string, error) {
+	if s.methods != nil {
+		method, err := s.methods.Default(ctx, user.ID)
+		if err == nil {
+			_, number, err := s.methods.Resolve(ctx, user.ID, method.ID)
+			if err != nil {
+				return "", "", err
+			}
+			return method.Provider, number, nil
+		}
+		if !errors.Is(err, ErrPaymentMethodNotFound) {
+			return "", "", err
+		}
+	}
+	number, err := NormalizeMsisdn(user.Phone)
+	if err != nil {
+		return "", "", err
+	}
+	provider, err := s.providers.Get("")
+	if err != nil {
+		return "", "", err
+	}
+	return provider.Name(), number, nil
+}
+
+func (s *PayoutService) recordIntent(ctx context.Context, item *models.PayoutItem) error {
+	return s.ledger.RecordIntent(ctx, &models.WalletLedgerEntry{
+		UserID:    item.UserID,
+		Type:      models.LedgerPayout,
+		Direction: models.LedgerDebit,
+		Amount:    item.Amount,
+		Currency:  item.Currency,
+		Reference: item.Reference,
+		Provider:  item.Provider,
+	})
+}
+
+// reopen moves a failed item back to pending under a new reference and intent,
+// if its last attempt is final and the wallet still covers it. The check and the
+// new reservation run under the provider's wallet lock.
+func (s *PayoutService) reopen(ctx context.Context, item *models.PayoutItem) error {
+	if intent, err := s.ledger.Intent(ctx, item.Reference); err == nil && intent.Status != models.LedgerFailed {
+		return fmt.Errorf("attempt %s is %s", item.Reference, intent.Status)
+	}
+	attempts, failure := item.Attempts, item.Failure
+	return s.ledger.WithWalletLock(ctx, item.UserID, func(ctx context.Context) error {
+		spendable, err := s.ledger.Spendable(ctx, item.UserID, item.Currency)
+		if err != nil {
+			return err
+		}
+		if spendable < item.Amount {
+			return ErrInsufficientBalance
+		}
+		item.Reference = NewMomoReferenceID()
+		item.Attempts = attempts + 1
+		item.Status = models.PayoutItemPending
+		item.Failure = ""
+		if err := s.store.UpdateItem(ctx, item, models.PayoutItemFailed); err != nil {
+			item.Status, item.Failure = models.PayoutItemFailed, failure
+			return err
+		}
+		return s.recordIntent(ctx, item)
+	})
+}
+
+// send transfers pending items, at most Concurrency at a time
+func (s *PayoutService) send(ctx context.Context, items []*models.PayoutItem) {
+	sem := make(chan struct{}, s.policy.Concurrency)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *models.PayoutItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.transfer(ctx, item)
+		}(item)
+	}
+	wg.Wait()
+}
+
+func (s *PayoutService) transfer(ctx context.Context, item *models.PayoutItem) {
+	number, err := s.encryption.DecryptString(item.MsisdnEncrypted)
+	var provider PaymentProvider
+	if err == nil {
+		provider, err = s.providers.Get(item.Provider)
+	}
+	if err != nil {
+		// Nothing was sent
+		s.settle(ctx, item, PaymentStatusFailed, err.Error(), models.PayoutItemPending)
+		return
+	}
+	err = provider.Disburse(ctx, MobileMoneyRequest{
+		ReferenceID: item.Reference,
+		Amount:      strconv.FormatFloat(item.Amount, 'f', -1, 64),
+		Currency:    item.Currency,
+		MSISDN:      number,
+		ExternalID:  item.ID.Hex(),
+		Message:     "Smor-Ting payout",
+	})
+	if errors.Is(err, ErrPaymentRejected) {
+		s.settle(ctx, item, PaymentStatusFailed, err.Error(), models.PayoutItemPending)
+		return
+	}
+	if err != nil {
+		// The provider may have taken the transfer, so the item is tracked under
+		// this reference rather than failed and sent again under a new one
+		s.logger.Warn("Payout transfer outcome unknown", zap.Error(err), zap.String("reference_id", item.Reference))
+	}
+	item.Status = models.PayoutItemSubmitted
+	if err := s.store.UpdateItem(ctx, item, models.PayoutItemPending); err != nil {
+		s.logger.Error("Failed to record payout submission", zap.Error(err), zap.String("item_id", item.ID.Hex()))
+	}
+}
+
+// track settles a submitted item from its intent, polling the provider when
+// no callback has settled the intent yet
+func (s *PayoutService) track(ctx context.Context, item *models.PayoutItem) {
+	status := PaymentStatusPending
+	if intent, err := s.ledger.Intent(ctx, item.Reference); err == nil && intent.Status != models.LedgerPending {
+		status = PaymentStatusSuccessful
+		if intent.Status == models.LedgerFailed {
+			status = PaymentStatusFailed
+		}
+	} else if provider, err := s.providers.Get(item.Provider); err == nil {
+		if status, err = provider.Status(ctx, PaymentDisbursement, item.Reference); err != nil {
+			s.logger.Warn("Failed to poll payout status", zap.Error(err), zap.String("reference_id", item.Reference))
+			return
+		}
+	}
+	if status == PaymentStatusPending {
+		return
+	}
+	failure := ""
+	if status == PaymentStatusFailed {
+		failure = "provider rejected the transfer"
+	}
+	s.settle(ctx, item, status, failure, models.PayoutItemSubmitted)
+}
+
+// settle closes the item's intent with the provider's final status and records
+// the outcome on the item, if it is still in from
+func (s *PayoutService) settle(ctx context.Context, item *models.PayoutItem, status, failure string, from models.PayoutItemStatus) {
+	_, err := s.webhooks.Apply(ctx, &PaymentCallback{
+		Type:        string(models.LedgerPayout),
+		Status:      status,
+		Amount:      item.Amount,
+		Currency:    item.Currency,
+		UserID:      item.UserID.Hex(),
+		ReferenceID: item.Reference,
+		Provider:    item.Provider,
+	})
+	if err != nil && !errors.Is(err, ErrWebhookDuplicate) {
+		s.logger.Error("Failed to settle payout intent", zap.Error(err), zap.String("reference_id", item.Reference))
+		return
+	}
+	if status == PaymentStatusSuccessful {
+		now := time.Now()
+		item.Status = models.PayoutItemCompleted
+		item.CompletedAt = &now
+	} else {
+		item.Status = models.PayoutItemFailed
+		item.Failure = failure
+	}
+	if err := s.store.UpdateItem(ctx, item, from); err != nil {
+		s.logger.Error("Failed to record payout outcome", zap.Error(err), zap.String("item_id", item.ID.Hex()))
+	}
+}
+
+// summarise recounts the batch's items and derives its status
+func (s *PayoutService) summarise(ctx context.Context, batchID primitive.ObjectID) (*models.PayoutBatch, error) {
+	batch, err := s.store.GetBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.store.ListItems(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	batch.Counts = map[models.PayoutItemStatus]int{}
+	for _, item := range items {
+		batch.Counts[item.Status]++
+	}
+	open := batch.Counts[models.PayoutItemPending] + batch.Counts[models.PayoutItemSubmitted]
+	switch {
+	case open > 0:
+		batch.Status = models.PayoutBatchProcessing
+	case batch.Counts[models.PayoutItemFailed] == 0:
+		batch.Status = models.PayoutBatchCompleted
+	case batch.Counts[models.PayoutItemCompleted] == 0:
+		batch.Status = models.PayoutBatchFailed
+	default:
+		batch.Status = models.PayoutBatchPartiallyFailed
+	}
+	if open == 0 && batch.CompletedAt == nil {
+		now := time.Now()
+		batch.CompletedAt = &now
+	} else if open > 0 {
+		batch.CompletedAt = nil
+	}
+	if err := s.store.UpdateBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func (s *PayoutService) audit(ctx context.Context, admin *models.User, batch *models.PayoutBatch, op string, ac AuditContext, err error) {
+	entry := &AuditEntry{
+		UserID:    admin.ID.Hex(),
+		UserEmail: admin.Email,
+		UserRole:  string(admin.Role),
+		Action:    ActionPayoutBatch,
+		Resource:  "payout_batch",
+		IPAddress: ac.IPAddress,
+		UserAgent: ac.UserAgent,
+		Details:   map[string]interface{}{"operation": op},
+		Success:   err == nil,
+	}
+	if batch != nil {
+		entry.ResourceID = batch.ID.Hex()
+		entry.Details["status"] = batch.Status
+		entry.Details["totals"] = batch.Totals
+		entry.Details["counts"] = batch.Counts
+	}
+	if err != nil {
+		entry.ErrorMessage = err.Error()
+	}
+	_ = s.auditService.LogAction(ctx, entry)
+}
+
+// Start tracks submitted items every PollInterval and gathers a batch once the
+// last one is Every old
+func (s *PayoutService) Start(ctx context.Context) error {
+	s.workerMu.Lock()
+	defer s.workerMu.Unlock()
+	if s.isRunning {
+		return fmt.Errorf("payout worker is already running")
+	}
+	s.isRunning = true
+	s.wg.Add(1)
+	go s.run(ctx)
+	s.logger.Info("Payout worker started", zap.Duration("every", s.policy.Every), zap.Duration("poll_interval", s.policy.PollInterval))
+	return nil
+}
+
+// Stop stops the payout worker
+func (s *PayoutService) Stop() error {
+	s.workerMu.Lock()
+	defer s.workerMu.Unlock()
+	if !s.isRunning {
+		return fmt.Errorf("payout worker is not running")
+	}
+	close(s.stopChan)
+	s.wg.Wait()
+	s.isRunning = false
+	s.logger.Info("Payout worker stopped")
+	return nil
+}
+
+func (s *PayoutService) run(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.policy.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.tick(ctx, time.Now())
+		}
+	}
+}
+
+// recentBatches bounds how many of the newest batches the worker tracks
+const recentBatches = 20
+
+func (s *PayoutService) tick(ctx context.Context, now time.Time) {
+	batches, err := s.store.ListBatches(ctx, recentBatches)
+	if err != nil {
+		s.logger.Error("Failed to list payout batches", zap.Error(err))
+		return
+	}
+	for _, b := range batches {
+		if b.Status != models.PayoutBatchProcessing {
+			continue
+		}
+		if _, err := s.Refresh(ctx, b.ID); err != nil {
+			s.logger.Error("Failed to refresh payout batch", zap.Error(err), zap.String("batch_id", b.ID.Hex()))
+		}
+	}
+	if s.policy.Every <= 0 || (len(batches) > 0 && now.Sub(batches[0].CreatedAt) < s.policy.Every) {
+		return
+	}
+	batch, err := s.RunBatch(ctx, nil, AuditContext{})
+	switch {
+	case err != nil:
+		s.logger.Error("Payout batch failed", zap.Error(err))
+	case batch != nil:
+		s.logger.Info("Payout batch sent", zap.String("batch_id", batch.ID.Hex()), zap.Int("items", batch.ItemCount),
+			zap.Int("skipped", batch.Skipped), zap.String("status", string(batch.Status)))
+	}
+}
@@ -0,0 +1,314 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// batchMomo is a PaymentProvider that records disbursements, refuses those to
+// numbers in refuse, takes but times out on those to numbers in timeout,
+// reports statuses from a table and tracks peak concurrency
+type batchMomo struct {
+	mu       sync.Mutex
+	refuse   map[string]bool
+	timeout  map[string]bool
+	statuses map[string]string // reference -> status
+	sent     map[string]string // reference -> msisdn
+	inflight int
+	peak     int
+}
+
+func newBatchMomo() *batchMomo {
+	return &batchMomo{refuse: map[string]bool{}, timeout: map[string]bool{}, statuses: map[string]string{}, sent: map[string]string{}}
+}
+
+func (p *batchMomo) Name() string                           { return models.PaymentProviderMTNMomo }
+func (p *batchMomo) EnsureOnline(ctx context.Context) error { return nil }
+func (p *batchMomo) Collect(ctx context.Context, req services.MobileMoneyRequest) error {
+	return errors.New("not used")
+}
+func (p *batchMomo) Disburse(ctx context.Context, req services.MobileMoneyRequest) error {
+	p.mu.Lock()
+	p.inflight++
+	if p.inflight > p.peak {
+		p.peak = p.inflight
+	}
+	p.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inflight--
+	if p.refuse[req.MSISDN] {
+		return fmt.Errorf("%w: payee not found", services.ErrPaymentRejected)
+	}
+	p.sent[req.ReferenceID] = req.MSISDN
+	if p.timeout[req.MSISDN] {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+func (p *batchMomo) Status(ctx context.Context, op services.PaymentOperation, ref string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if status, ok := p.statuses[ref]; ok {
+		return status, nil
+	}
+	return services.PaymentStatusPending, nil
+}
+func (p *batchMomo) ParseCallback(body []byte) (*services.PaymentCallback, error) {
+	return nil, services.ErrWebhookInvalidPayload
+}
+
+func (p *batchMomo) settle(ref, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statuses[ref] = status
+}
+
+type payoutFixture struct {
+	repo    *database.MemoryDatabase
+	ledger  *services.WalletLedgerService
+	momo    *batchMomo
+	payouts *services.PayoutService
+}
+
+func newPayoutFixture(t *testing.T, concurrency int) *payoutFixture {
+	t.Helper()
+	return newPayoutFixtureWithStore(t, concurrency, nil)
+}
+
+func newPayoutFixtureWithStore(t *testing.T, concurrency int, store services.PayoutStore) *payoutFixture {
+	t.Helper()
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption: %v", err)
+	}
+	momo := newBatchMomo()
+	webhooks := services.NewMomoWebhookService(nil, ledger, nil, nil, nil)
+	payouts := services.NewPayoutService(store, repo, ledger, services.NewPaymentProviders(momo), nil, enc, webhooks, services.PayoutPolicy{
+		Minimums:    map[string]float64{"USD": 5, "LRD": 1000},
+		Concurrency: concurrency,
+	}, nil, nil)
+	return &payoutFixture{repo: repo, ledger: ledger, momo: momo, payouts: payouts}
+}
+
+// provider creates a provider with phone and credits their wallet
+func (f *payoutFixture) provider(t *testing.T, phone string, amount float64, currency string) *models.User {
+	t.Helper()
+	ctx := context.TODO()
+	u := &models.User{Email: phone + "@example.com", Phone: phone, Role: models.ProviderRole, Wallet: models.Wallet{Currency: "USD"}}
+	if err := f.repo.CreateUser(ctx, u); err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+	f.credit(t, u, amount, currency)
+	return u
+}
+
+func (f *payoutFixture) credit(t *testing.T, u *models.User, amount float64, currency string) {
+	t.Helper()
+	err := f.ledger.RecordEntry(context.TODO(), &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit,
+		Amount: amount, Currency: currency, Status: models.LedgerCompleted, Reference: services.NewMomoReferenceID()})
+	if err != nil {
+		t.Fatalf("credit: %v", err)
+	}
+}
+
+func (f *payoutFixture) available(t *testing.T, u *models.User, currency string) float64 {
+	t.Helper()
+	bal, err := f.ledger.ComputeBalances(context.TODO(), u.ID)
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	return bal.Currencies[currency].Available
+}
+
+func TestPayoutBatch_BoundedConcurrencyTrackingAndRetry(t *testing.T) {
+	f := newPayoutFixture(t, 2)
+	ctx := context.TODO()
+	admin := &models.User{Email: "admin@example.com", Role: models.AdminRole}
+	phones := []string{"231770000011", "231770000012", "231770000013", "231770000014", "231770000015"}
+	for _, phone := range phones {
+		f.provider(t, phone, 10, "USD")
+	}
+
+	batch, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{})
+	if err != nil || batch == nil || batch.ItemCount != 5 || batch.Totals["USD"] != 50 || batch.Status != models.PayoutBatchProcessing {
+		t.Fatalf("expected a batch of 5 submitted payouts, got %+v, %v", batch, err)
+	}
+	if f.momo.peak > 2 || len(f.momo.sent) != 5 {
+		t.Fatalf("expected 5 transfers at most 2 at a time, got %d with peak %d", len(f.momo.sent), f.momo.peak)
+	}
+
+	items, _ := f.payouts.Items(ctx, batch.ID)
+	var failed models.PayoutItem
+	for i, item := range items {
+		status := services.PaymentStatusSuccessful
+		if i == 0 {
+			status, failed = services.PaymentStatusFailed, item
+		}
+		f.momo.settle(item.Reference, status)
+	}
+	batch, _ = f.payouts.Refresh(ctx, batch.ID)
+	if batch.Status != models.PayoutBatchPartiallyFailed || batch.Counts[models.PayoutItemCompleted] != 4 || batch.Counts[models.PayoutItemFailed] != 1 {
+		t.Fatalf("expected 4 paid and 1 failed, got %+v", batch)
+	}
+	owner := &models.User{ID: failed.UserID}
+	if f.available(t, owner, "USD") != 10 {
+		t.Fatalf("a failed payout must leave the balance in the wallet")
+	}
+
+	batch, err = f.payouts.Retry(ctx, admin, batch.ID, services.AuditContext{})
+	if err != nil || batch.Status != models.PayoutBatchProcessing || len(f.momo.sent) != 6 {
+		t.Fatalf("expected only the failed item to be sent again, got %+v (%d sent), %v", batch, len(f.momo.sent), err)
+	}
+	items, _ = f.payouts.Items(ctx, batch.ID)
+	for _, item := range items {
+		if item.ID == failed.ID && (item.Attempts != 2 || item.Reference == failed.Reference || item.Status != models.PayoutItemSubmitted) {
+			t.Fatalf("expected a second attempt under a new reference, got %+v", item)
+		}
+		if item.ID == failed.ID {
+			f.momo.settle(item.Reference, services.PaymentStatusSuccessful)
+		}
+	}
+	batch, _ = f.payouts.Refresh(ctx, batch.ID)
+	if batch.Status != models.PayoutBatchCompleted || batch.CompletedAt == nil {
+		t.Fatalf("expected the batch to complete, got %+v", batch)
+	}
+	if _, err := f.payouts.Retry(ctx, admin, batch.ID, services.AuditContext{}); err != nil || len(f.momo.sent) != 6 {
+		t.Fatalf("retrying a completed batch must not pay again (%d sent), %v", len(f.momo.sent), err)
+	}
+	if f.available(t, owner, "USD") != 0 {
+		t.Fatalf("expected the retried payout to debit the wallet once, got %.2f", f.available(t, owner, "USD"))
+	}
+}
+
+func TestPayoutBatch_EligibilityAndNoDoublePayAcrossBatches(t *testing.T) {
+	f := newPayoutFixture(t, 4)
+	ctx := context.TODO()
+	admin := &models.User{Email: "admin@example.com", Role: models.AdminRole}
+	refused := f.provider(t, "231770000021", 40, "USD")
+	f.momo.refuse["231770000021"] = true
+	dual := f.provider(t, "231770000022", 20, "USD")
+	f.credit(t, dual, 1500, "LRD")
+	f.provider(t, "231770000023", 4, "USD") // below the minimum
+	f.provider(t, "", 30, "USD")            // no payout number
+	customer := &models.User{Email: "cust@example.com", Phone: "231770000024", Role: models.CustomerRole}
+	_ = f.repo.CreateUser(ctx, customer)
+	f.credit(t, customer, 100, "USD")
+
+	first, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{})
+	if err != nil || first.ItemCount != 3 || first.Skipped != 1 || first.Totals["USD"] != 60 || first.Totals["LRD"] != 1500 {
+		t.Fatalf("unexpected batch %+v, %v", first, err)
+	}
+	if first.Counts[models.PayoutItemFailed] != 1 || first.Counts[models.PayoutItemSubmitted] != 2 {
+		t.Fatalf("expected the refused transfer to fail, got %+v", first.Counts)
+	}
+
+	// In-flight payouts reserve their funds: nothing is due again but the refused 40
+	f.momo.refuse["231770000021"] = false
+	second, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{})
+	if err != nil || second.ItemCount != 1 || second.Totals["USD"] != 40 {
+		t.Fatalf("expected only the refused balance in the next batch, got %+v, %v", second, err)
+	}
+	// The next batch is paying that balance, so retrying the first sends nothing
+	sent := len(f.momo.sent)
+	if _, err := f.payouts.Retry(ctx, admin, first.ID, services.AuditContext{}); err != nil || len(f.momo.sent) != sent {
+		t.Fatalf("retry must not pay a balance another batch is paying (%d sent, was %d), %v", len(f.momo.sent), sent, err)
+	}
+	if f.available(t, refused, "USD") != 40 {
+		t.Fatalf("nothing settled yet, got %.2f", f.available(t, refused, "USD"))
+	}
+	if none, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{}); err != nil || none != nil {
+		t.Fatalf("expected nothing due, got %+v, %v", none, err)
+	}
+}
+
+func TestPayoutBatch_UnknownOutcomeIsTrackedNotRepaid(t *testing.T) {
+	f := newPayoutFixture(t, 1)
+	ctx := context.TODO()
+	admin := &models.User{Email: "admin@example.com", Role: models.AdminRole}
+	provider := f.provider(t, "231770000031", 25, "USD")
+	f.momo.timeout["231770000031"] = true
+
+	batch, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{})
+	if err != nil || batch.Counts[models.PayoutItemSubmitted] != 1 {
+		t.Fatalf("a timed-out transfer must stay submitted, got %+v, %v", batch, err)
+	}
+	items, _ := f.payouts.Items(ctx, batch.ID)
+	if intent, err := f.ledger.Intent(ctx, items[0].Reference); err != nil || intent.Status != models.LedgerPending {
+		t.Fatalf("expected the intent to stay pending, got %+v, %v", intent, err)
+	}
+	if _, err := f.payouts.Retry(ctx, admin, batch.ID, services.AuditContext{}); err != nil || len(f.momo.sent) != 1 {
+		t.Fatalf("retry must not send a transfer whose outcome is unknown (%d sent), %v", len(f.momo.sent), err)
+	}
+	if again, _ := f.payouts.RunBatch(ctx, admin, services.AuditContext{}); again != nil {
+		t.Fatalf("the in-flight transfer still reserves the balance, got %+v", again)
+	}
+
+	// The provider did take it
+	f.momo.settle(items[0].Reference, services.PaymentStatusSuccessful)
+	if batch, _ = f.payouts.Refresh(ctx, batch.ID); batch.Status != models.PayoutBatchCompleted {
+		t.Fatalf("expected the batch to complete, got %+v", batch)
+	}
+	if f.available(t, provider, "USD") != 0 || len(f.momo.sent) != 1 {
+		t.Fatalf("expected one payout of 25, got %.2f left and %d sent", f.available(t, provider, "USD"), len(f.momo.sent))
+	}
+}
+
+// flakyItemStore fails every item insert after the first ok
+type flakyItemStore struct {
+	services.PayoutStore
+	mu sync.Mutex
+	ok int
+}
+
+func (s *flakyItemStore) CreateItem(ctx context.Context, item *models.PayoutItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ok == 0 {
+		return errors.New("store unavailable")
+	}
+	s.ok--
+	return s.PayoutStore.CreateItem(ctx, item)
+}
+
+func TestPayoutBatch_GatherFailureStillSendsReservedItems(t *testing.T) {
+	f := newPayoutFixtureWithStore(t, 2, &flakyItemStore{PayoutStore: services.NewMemoryPayoutStore(), ok: 2})
+	ctx := context.TODO()
+	admin := &models.User{Email: "admin@example.com", Role: models.AdminRole}
+	providers := []*models.User{
+		f.provider(t, "231770000041", 30, "USD"),
+		f.provider(t, "231770000042", 30, "USD"),
+		f.provider(t, "231770000043", 30, "USD"),
+	}
+
+	batch, err := f.payouts.RunBatch(ctx, admin, services.AuditContext{})
+	if err == nil || batch == nil {
+		t.Fatalf("expected the failure alongside the partial batch, got %+v, %v", batch, err)
+	}
+	if batch.ItemCount != 2 || batch.Counts[models.PayoutItemSubmitted] != 2 || len(f.momo.sent) != 2 {
+		t.Fatalf("the two reserved items must be sent, got %+v with %d sent", batch, len(f.momo.sent))
+	}
+	left := 0.0
+	for _, p := range providers {
+		spendable, err := f.ledger.Spendable(ctx, p.ID, "USD")
+		if err != nil {
+			t.Fatalf("spendable: %v", err)
+		}
+		left += spendable
+	}
+	if left != 30 {
+		t.Fatalf("only the unrecorded provider keeps their balance free, got %.2f spendable in total", left)
+	}
+}
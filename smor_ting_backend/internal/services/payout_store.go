@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrPayoutBatchNotFound    = errors.New("payout batch not found")
+	ErrPayoutItemNotFound     = errors.New("payout item not found")
+	ErrPayoutItemStateChanged = errors.New("payout item status changed concurrently")
+)
+
+// PayoutStore persists payout batches and their items. UpdateItem is a
+// compare-and-set on Status so that an item is never sent twice.
+type PayoutStore interface {
+	CreateBatch(ctx context.Context, batch *models.PayoutBatch) error
+	GetBatch(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error)
+	UpdateBatch(ctx context.Context, batch *models.PayoutBatch) error
+	// ListBatches returns the newest batches
+	ListBatches(ctx context.Context, limit int) ([]models.PayoutBatch, error)
+	CreateItem(ctx context.Context, item *models.PayoutItem) error
+	// UpdateItem replaces the item if its stored status is still from, otherwise returns ErrPayoutItemStateChanged
+	UpdateItem(ctx context.Context, item *models.PayoutItem, from models.PayoutItemStatus) error
+	// ListItems returns a batch's items, oldest first
+	ListItems(ctx context.Context, batchID primitive.ObjectID) ([]models.PayoutItem, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryPayoutStore struct {
+	mu      sync.RWMutex
+	batches map[primitive.ObjectID]*models.PayoutBatch
+	items   map[primitive.ObjectID]*models.PayoutItem
+}
+
+func NewMemoryPayoutStore() PayoutStore {
+	return &memoryPayoutStore{
+		batches: make(map[primitive.ObjectID]*models.PayoutBatch),
+		items:   make(map[primitive.ObjectID]*models.PayoutItem),
+	}
+}
+
+func (m *memoryPayoutStore) CreateBatch(ctx context.Context, batch *models.PayoutBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if batch.ID.IsZero() {
+		batch.ID = primitive.NewObjectID()
+	}
+	batch.CreatedAt = time.Now()
+	batch.UpdatedAt = batch.CreatedAt
+	cp := *batch
+	m.batches[batch.ID] = &cp
+	return nil
+}
+
+func (m *memoryPayoutStore) GetBatch(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.batches[id]
+	if !ok {
+		return nil, ErrPayoutBatchNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryPayoutStore) UpdateBatch(ctx context.Context, batch *models.PayoutBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.batches[batch.ID]; !ok {
+		return ErrPayoutBatchNotFound
+	}
+	batch.UpdatedAt = time.Now()
+	cp := *batch
+	m.batches[batch.ID] = &cp
+	return nil
+}
+
+func (m *memoryPayoutStore) ListBatches(ctx context.Context, limit int) ([]models.PayoutBatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.PayoutBatch{}
+	for _, b := range m.batches {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *memoryPayoutStore) CreateItem(ctx context.Context, item *models.PayoutItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+	cp := *item
+	m.items[item.ID] = &cp
+	return nil
+}
+
+func (m *memoryPayoutStore) UpdateItem(ctx context.Context, item *models.PayoutItem, from models.PayoutItemStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.items[item.ID]
+	if !ok {
+		return ErrPayoutItemNotFound
+	}
+	if stored.Status != from {
+		return ErrPayoutItemStateChanged
+	}
+	item.UpdatedAt = time.Now()
+	cp := *item
+	m.items[item.ID] = &cp
+	return nil
+}
+
+func (m *memoryPayoutStore) ListItems(ctx context.Context, batchID primitive.ObjectID) ([]models.PayoutItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.PayoutItem{}
+	for _, item := range m.items {
+		if item.BatchID == batchID {
+			out = append(out, *item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID.Hex() < out[j].ID.Hex()
+	})
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoPayoutStore persists batches in payout_batches and their items in payout_items
+type MongoPayoutStore struct {
+	batches *mongo.Collection
+	items   *mongo.Collection
+	logger  *logger.Logger
+}
+
+func NewMongoPayoutStore(db *mongo.Database, logger *logger.Logger) (*MongoPayoutStore, error) {
+	s := &MongoPayoutStore{batches: db.Collection("payout_batches"), items: db.Collection("payout_items"), logger: logger}
+	_, _ = s.batches.Indexes().CreateOne(context.Background(), mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: -1}}})
+	_, _ = s.items.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "batch_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "reference", Value: 1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoPayoutStore) CreateBatch(ctx context.Context, batch *models.PayoutBatch) error {
+	if batch.ID.IsZero() {
+		batch.ID = primitive.NewObjectID()
+	}
+	batch.CreatedAt = time.Now()
+	batch.UpdatedAt = batch.CreatedAt
+	_, err := m.batches.InsertOne(ctx, batch)
+	return err
+}
+
+func (m *MongoPayoutStore) GetBatch(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error) {
+	var out models.PayoutBatch
+	if err := m.batches.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPayoutBatchNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoPayoutStore) UpdateBatch(ctx context.Context, batch *models.PayoutBatch) error {
+	batch.UpdatedAt = time.Now()
+	res, err := m.batches.ReplaceOne(ctx, bson.M{"_id": batch.ID}, batch)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPayoutBatchNotFound
+	}
+	return nil
+}
+
+func (m *MongoPayoutStore) ListBatches(ctx context.Context, limit int) ([]models.PayoutBatch, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := m.batches.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.PayoutBatch{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *MongoPayoutStore) CreateItem(ctx context.Context, item *models.PayoutItem) error {
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+	_, err := m.items.InsertOne(ctx, item)
+	return err
+}
+
+func (m *MongoPayoutStore) UpdateItem(ctx context.Context, item *models.PayoutItem, from models.PayoutItemStatus) error {
+	item.UpdatedAt = time.Now()
+	res, err := m.items.ReplaceOne(ctx, bson.M{"_id": item.ID, "status": from}, item)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if err := m.items.FindOne(ctx, bson.M{"_id": item.ID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrPayoutItemNotFound
+		} else if err != nil {
+			return err
+		}
+		return ErrPayoutItemStateChanged
+	}
+	return nil
+}
+
+func (m *MongoPayoutStore) ListItems(ctx context.Context, batchID primitive.ObjectID) ([]models.PayoutItem, error) {
+	cur, err := m.items.Find(ctx, bson.M{"batch_id": batchID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.PayoutItem{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -1,24 +1,34 @@
 package services
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+var (
+	ErrInvalidPaymentRequest = errors.New("invalid payment request")
+	ErrPaymentTokenNotFound  = errors.New("payment token not found")
+)
+
 // PCIDSSService provides PCI-DSS compliant payment processing
 type PCIDSSService struct {
 	encryptionKey []byte
 	logger        *zap.Logger
 	store         PaymentTokenStore
 	tokenTTL      time.Duration
+	gateway       CardGateway
+	returnURL     string // 3-D Secure return, /api/v1/payments/3ds/return
+	charges       CardChargeStore
 }
 
 // PaymentToken represents a tokenized payment method
@@ -36,24 +46,30 @@ type PaymentToken struct {
 
 // PaymentRequest represents a PCI-DSS compliant payment request
 type PaymentRequest struct {
-	Amount      float64                `json:"amount" validate:"required,gt=0"`
-	Currency    string                 `json:"currency" validate:"required"`
-	TokenID     string                 `json:"token_id" validate:"required"`
-	Description string                 `json:"description"`
-	Reference   string                 `json:"reference"`
-	MerchantID  string                 `json:"merchant_id"`
-	CustomerID  string                 `json:"customer_id"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Amount      float64 `json:"amount" validate:"required,gt=0"`
+	Currency    string  `json:"currency" validate:"required"`
+	TokenID     string  `json:"token_id" validate:"required"`
+	Description string  `json:"description"`
+	Reference   string  `json:"reference"`
+	MerchantID  string  `json:"merchant_id"`
+	CustomerID  string  `json:"customer_id"`
+	Email       string  `json:"email,omitempty"`
+	// CaptureMethod is "automatic" (default) or "manual", which leaves the charge authorized until captured
+	CaptureMethod string                 `json:"capture_method,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // PaymentResponse represents a PCI-DSS compliant payment response
 type PaymentResponse struct {
 	TransactionID string                 `json:"transaction_id"`
-	Status        string                 `json:"status"` // "pending", "completed", "failed"
+	Status        string                 `json:"status"` // "requires_action", "authorized", "completed", "voided", "refunded", "failed"
 	Amount        float64                `json:"amount"`
 	Currency      string                 `json:"currency"`
 	Reference     string                 `json:"reference"`
 	GatewayRef    string                 `json:"gateway_ref"`
+	RedirectURL   string                 `json:"redirect_url,omitempty"` // 3-D Secure challenge to send the cardholder to
+	Captured      float64                `json:"captured_amount"`
+	Refunded      float64                `json:"refunded_amount"`
 	CreatedAt     time.Time              `json:"created_at"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 }
@@ -80,9 +96,23 @@ func NewPCIDSSService(encryptionKey []byte, logger *zap.Logger) (*PCIDSSService,
 		logger:        logger,
 		store:         NewMemoryPaymentTokenStore(),
 		tokenTTL:      30 * 24 * time.Hour, // default 30 days
+		charges:       NewMemoryCardChargeStore(),
 	}, nil
 }
 
+// SetGateway configures the card processor and the URL cardholders return to after 3-D Secure
+func (p *PCIDSSService) SetGateway(gateway CardGateway, returnURL string) {
+	p.gateway = gateway
+	p.returnURL = returnURL
+}
+
+// SetChargeStore allows injection of a persistent card charge store
+func (p *PCIDSSService) SetChargeStore(store CardChargeStore) {
+	if store != nil {
+		p.charges = store
+	}
+}
+
 // SetTokenStore allows injection of a persistent store (Mongo, etc.)
 func (p *PCIDSSService) SetTokenStore(store PaymentTokenStore) {
 	if store != nil {
@@ -146,53 +176,271 @@ func (p *PCIDSSService) TokenizePaymentMethod(sensitiveData *SensitivePaymentDat
 	return token, nil
 }
 
-// ProcessPayment processes a payment using a tokenized payment method
-func (p *PCIDSSService) ProcessPayment(req *PaymentRequest) (*PaymentResponse, error) {
+// ProcessPayment authorizes a card payment with a tokenized payment method and,
+// unless the request asks for manual capture, captures it. A card that needs
+// 3-D Secure comes back as requires_action with the challenge's RedirectURL;
+// CompleteAuthentication resumes it. Declines are returned as *CardDeclinedError.
+func (p *PCIDSSService) ProcessPayment(ctx context.Context, req *PaymentRequest) (*PaymentResponse, error) {
 	// Validate payment request
 	if err := p.validatePaymentRequest(req); err != nil {
-		return nil, fmt.Errorf("invalid payment request: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentRequest, err)
+	}
+	if p.gateway == nil {
+		return nil, fmt.Errorf("%w: no card gateway configured", ErrCardGatewayUnavailable)
 	}
 
-	// Retrieve encrypted payment data
-	encryptedData, err := p.retrieveEncryptedData(req.TokenID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve payment data: %w", err)
+	// Retrieve encrypted payment data; a token is only usable by the customer it belongs to
+	rec, err := p.store.Get(req.TokenID)
+	if err != nil || (req.CustomerID != "" && rec.UserID != req.CustomerID) || time.Now().After(rec.ExpiresAt) {
+		return nil, ErrPaymentTokenNotFound
 	}
 
 	// Decrypt sensitive data for processing
-	sensitiveData, err := p.decryptSensitiveData(encryptedData)
+	sensitiveData, err := p.decryptSensitiveData(rec.EncryptedData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt payment data: %w", err)
 	}
 
+	charge := &CardCharge{
+		TransactionID: p.generateTransactionID(),
+		Reference:     req.Reference,
+		UserID:        rec.UserID,
+		TokenID:       req.TokenID,
+		Gateway:       p.gateway.Name(),
+		Amount:        roundCents(req.Amount),
+		Currency:      req.Currency,
+		CaptureMethod: CaptureAutomatic,
+	}
+	if req.CaptureMethod == CaptureManual {
+		charge.CaptureMethod = CaptureManual
+	}
+
 	// Process payment through secure gateway
-	gatewayResponse, err := p.processWithGateway(sensitiveData, req)
+	result, err := p.gateway.Authorize(ctx, CardAuthorization{
+		Reference:   charge.TransactionID,
+		Amount:      charge.Amount,
+		Currency:    charge.Currency,
+		Card:        sensitiveData,
+		Email:       req.Email,
+		RedirectURL: p.returnURL,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("payment processing failed: %w", err)
+		p.recordFailure(ctx, charge, err)
+		return nil, err
+	}
+	charge.Status = result.Status
+	charge.GatewayRef = result.GatewayRef
+	charge.GatewayID = result.GatewayID
+	charge.RedirectURL = result.RedirectURL
+	if err := p.charges.Create(ctx, charge); err != nil {
+		return nil, fmt.Errorf("failed to record card charge: %w", err)
 	}
+	_ = p.store.TouchLastUsed(req.TokenID, time.Now())
 
-	// Create payment response
-	response := &PaymentResponse{
-		TransactionID: p.generateTransactionID(),
-		Status:        gatewayResponse.Status,
-		Amount:        req.Amount,
-		Currency:      req.Currency,
-		Reference:     req.Reference,
-		GatewayRef:    gatewayResponse.GatewayRef,
-		CreatedAt:     time.Now(),
-		Metadata:      req.Metadata,
+	if charge.Status == CardChargeAuthorized && charge.CaptureMethod == CaptureAutomatic {
+		if charge, err = p.capture(ctx, charge, charge.Amount); err != nil {
+			return nil, err
+		}
 	}
 
 	// Log payment attempt (without sensitive data)
 	p.logger.Info("Payment processed",
-		zap.String("transaction_id", response.TransactionID),
+		zap.String("transaction_id", charge.TransactionID),
 		zap.String("token_id", req.TokenID),
-		zap.String("status", response.Status),
+		zap.String("status", string(charge.Status)),
 		zap.Float64("amount", req.Amount),
 		zap.String("currency", req.Currency),
 	)
 
-	return response, nil
+	return p.paymentResponse(charge, req.Metadata), nil
+}
+
+// CompleteAuthentication resumes a charge after the cardholder returns from
+// 3-D Secure. The outcome is taken from the gateway, never from the redirect.
+// Charges past requires_action are returned as they are, so repeated returns are harmless.
+func (p *PCIDSSService) CompleteAuthentication(ctx context.Context, transactionID string) (*PaymentResponse, error) {
+	charge, err := p.charges.Get(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status != CardChargeRequiresAction {
+		return p.paymentResponse(charge, nil), nil
+	}
+	result, err := p.gateway.ConfirmAuthentication(ctx, charge)
+	var declined *CardDeclinedError
+	if errors.As(err, &declined) {
+		charge.Status = CardChargeFailed
+		charge.DeclineCode = declined.Code
+		if uerr := p.charges.Update(ctx, charge, CardChargeRequiresAction); uerr != nil {
+			return nil, uerr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Status == CardChargeRequiresAction {
+		return p.paymentResponse(charge, nil), nil
+	}
+	charge.Status = result.Status
+	if result.GatewayRef != "" {
+		charge.GatewayRef = result.GatewayRef
+	}
+	if result.GatewayID != "" {
+		charge.GatewayID = result.GatewayID
+	}
+	if err := p.charges.Update(ctx, charge, CardChargeRequiresAction); err != nil {
+		return nil, err
+	}
+	if charge.Status == CardChargeAuthorized && charge.CaptureMethod == CaptureAutomatic {
+		if charge, err = p.capture(ctx, charge, charge.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return p.paymentResponse(charge, nil), nil
+}
+
+// CapturePayment captures an authorized charge; amount 0 captures the full authorization
+func (p *PCIDSSService) CapturePayment(ctx context.Context, transactionID string, amount float64) (*PaymentResponse, error) {
+	charge, err := p.charges.Get(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status != CardChargeAuthorized {
+		return nil, ErrCardChargeInvalidState
+	}
+	if amount == 0 {
+		amount = charge.Amount
+	}
+	if amount < 0 || roundCents(amount) > charge.Amount {
+		return nil, ErrCardChargeAmountExceeded
+	}
+	if charge, err = p.capture(ctx, charge, roundCents(amount)); err != nil {
+		return nil, err
+	}
+	return p.paymentResponse(charge, nil), nil
+}
+
+// VoidPayment releases an authorization that has not been captured
+func (p *PCIDSSService) VoidPayment(ctx context.Context, transactionID string) (*PaymentResponse, error) {
+	charge, err := p.charges.Get(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	from := charge.Status
+	if from != CardChargeAuthorized && from != CardChargeRequiresAction {
+		return nil, ErrCardChargeInvalidState
+	}
+	result, err := p.gateway.Void(ctx, charge)
+	if err != nil {
+		return nil, err
+	}
+	charge.Status = result.Status
+	if err := p.charges.Update(ctx, charge, from); err != nil {
+		return nil, err
+	}
+	p.logger.Info("Card payment voided", zap.String("transaction_id", charge.TransactionID))
+	return p.paymentResponse(charge, nil), nil
+}
+
+// RefundPayment refunds all or part of a captured charge; amount 0 refunds what
+// is left. The amount is reserved on the charge before the gateway is asked, so
+// concurrent refunds cannot together exceed the capture, and released again if
+// the gateway does not refund it.
+func (p *PCIDSSService) RefundPayment(ctx context.Context, transactionID string, amount float64) (*PaymentResponse, error) {
+	charge, err := p.charges.Get(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status != CardChargeCaptured {
+		return nil, ErrCardChargeInvalidState
+	}
+	if amount == 0 {
+		amount = charge.CapturedAmount - charge.RefundedAmount - charge.RefundPending
+	}
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, ErrCardChargeAmountExceeded
+	}
+	if charge, err = p.charges.ReserveRefund(ctx, transactionID, amount); err != nil {
+		return nil, err
+	}
+	if _, err := p.gateway.Refund(ctx, charge, amount); err != nil {
+		if _, rerr := p.charges.SettleRefund(ctx, transactionID, amount, false); rerr != nil {
+			p.logger.Error("Failed to release card refund reservation", zap.Error(rerr), zap.String("transaction_id", transactionID))
+		}
+		return nil, err
+	}
+	if charge, err = p.charges.SettleRefund(ctx, transactionID, amount, true); err != nil {
+		return nil, err
+	}
+	p.logger.Info("Card payment refunded", zap.String("transaction_id", charge.TransactionID), zap.Float64("amount", amount))
+	return p.paymentResponse(charge, nil), nil
+}
+
+// GetCharge returns a card charge by transaction id
+func (p *PCIDSSService) GetCharge(ctx context.Context, transactionID string) (*CardCharge, error) {
+	return p.charges.Get(ctx, transactionID)
+}
+
+// capture claims an authorized charge before asking the gateway to capture it,
+// so a concurrent capture cannot reach the gateway too; a failed capture hands
+// the authorization back
+func (p *PCIDSSService) capture(ctx context.Context, charge *CardCharge, amount float64) (*CardCharge, error) {
+	charge.Status = CardChargeCapturing
+	if err := p.charges.Update(ctx, charge, CardChargeAuthorized); err != nil {
+		return nil, err
+	}
+	if _, err := p.gateway.Capture(ctx, charge, amount); err != nil {
+		charge.Status = CardChargeAuthorized
+		if uerr := p.charges.Update(ctx, charge, CardChargeCapturing); uerr != nil {
+			p.logger.Error("Failed to release card capture claim", zap.Error(uerr), zap.String("transaction_id", charge.TransactionID))
+		}
+		return nil, err
+	}
+	charge.Status = CardChargeCaptured
+	charge.CapturedAmount = amount
+	if err := p.charges.Update(ctx, charge, CardChargeCapturing); err != nil {
+		return nil, err
+	}
+	return charge, nil
+}
+
+// recordFailure keeps declined and failed authorizations for support and fraud review
+func (p *PCIDSSService) recordFailure(ctx context.Context, charge *CardCharge, cause error) {
+	charge.Status = CardChargeFailed
+	var declined *CardDeclinedError
+	if errors.As(cause, &declined) {
+		charge.DeclineCode = declined.Code
+	}
+	if err := p.charges.Create(ctx, charge); err != nil {
+		p.logger.Error("Failed to record failed card charge", zap.Error(err), zap.String("transaction_id", charge.TransactionID))
+	}
+	p.logger.Info("Card payment not authorized",
+		zap.String("transaction_id", charge.TransactionID),
+		zap.String("decline_code", charge.DeclineCode),
+		zap.Error(cause),
+	)
+}
+
+func (p *PCIDSSService) paymentResponse(charge *CardCharge, metadata map[string]interface{}) *PaymentResponse {
+	status := string(charge.Status)
+	if charge.Status == CardChargeCaptured {
+		status = "completed"
+	}
+	return &PaymentResponse{
+		TransactionID: charge.TransactionID,
+		Status:        status,
+		Amount:        charge.Amount,
+		Currency:      charge.Currency,
+		Reference:     charge.Reference,
+		GatewayRef:    charge.GatewayRef,
+		RedirectURL:   charge.RedirectURL,
+		Captured:      charge.CapturedAmount,
+		Refunded:      charge.RefundedAmount,
+		CreatedAt:     charge.CreatedAt,
+		Metadata:      metadata,
+	}
 }
 
 // ValidatePaymentToken validates a payment token
@@ -307,8 +555,9 @@ func (p *PCIDSSService) generateTokenID() (string, error) {
 
 // generateTransactionID generates a unique transaction ID
 func (p *PCIDSSService) generateTransactionID() string {
-	hash := sha256.Sum256([]byte(fmt.Sprintf("%d", time.Now().UnixNano())))
-	return fmt.Sprintf("txn_%x", hash[:8])
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "txn_" + hex.EncodeToString(b)
 }
 
 // determineTokenType determines the type of payment token
@@ -368,23 +617,6 @@ func (p *PCIDSSService) validatePaymentRequest(req *PaymentRequest) error {
 	return nil
 }
 
-// processWithGateway processes payment through secure gateway
-func (p *PCIDSSService) processWithGateway(data *SensitivePaymentData, req *PaymentRequest) (*GatewayResponse, error) {
-	// TODO: Implement actual payment gateway integration
-	// This is a placeholder for demonstration purposes
-
-	return &GatewayResponse{
-		Status:     "completed",
-		GatewayRef: fmt.Sprintf("gw_%d", time.Now().Unix()),
-	}, nil
-}
-
-// GatewayResponse represents a payment gateway response
-type GatewayResponse struct {
-	Status     string `json:"status"`
-	GatewayRef string `json:"gateway_ref"`
-}
-
 // Database operations via store abstraction
 func (p *PCIDSSService) storeEncryptedData(tokenID, encryptedData, userID string) error {
 	if p.store == nil {
@@ -1,6 +1,8 @@
 package services_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -64,3 +66,173 @@ func TestDeleteTokenRemovesData(t *testing.T) {
 		t.Fatalf("expected deleted token to be invalid")
 	}
 }
+
+func newCardPCI(t *testing.T) *services.PCIDSSService {
+	t.Helper()
+	svc := newPCI(t)
+	svc.SetTokenTTL(time.Hour)
+	svc.SetGateway(services.NewFakeCardGateway(), "https://api.example.com/api/v1/payments/3ds/return")
+	return svc
+}
+
+func cardToken(t *testing.T, svc *services.PCIDSSService, number, userID string) string {
+	t.Helper()
+	token, err := svc.TokenizePaymentMethod(&services.SensitivePaymentData{CardNumber: number, CVV: "123", ExpiryMonth: "12", ExpiryYear: "2030"}, userID)
+	if err != nil {
+		t.Fatalf("tokenize: %v", err)
+	}
+	return token.TokenID
+}
+
+func TestProcessPayment_AuthorizesAndCaptures(t *testing.T) {
+	svc := newCardPCI(t)
+	ctx := context.Background()
+
+	res, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 42.5, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCardApproved, "user1"), CustomerID: "user1"})
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if res.Status != "completed" || res.Captured != 42.5 || res.GatewayRef == "" {
+		t.Fatalf("expected a captured charge, got %+v", res)
+	}
+
+	// Partial refunds until nothing is left
+	if res, err = svc.RefundPayment(ctx, res.TransactionID, 20); err != nil || res.Status != "completed" || res.Refunded != 20 {
+		t.Fatalf("partial refund: %+v, %v", res, err)
+	}
+	if _, err := svc.RefundPayment(ctx, res.TransactionID, 30); !errors.Is(err, services.ErrCardChargeAmountExceeded) {
+		t.Fatalf("expected an over-refund to be refused, got %v", err)
+	}
+	if res, err = svc.RefundPayment(ctx, res.TransactionID, 0); err != nil || res.Status != "refunded" || res.Refunded != 42.5 {
+		t.Fatalf("refund of the remainder: %+v, %v", res, err)
+	}
+}
+
+// slowRefunds holds each gateway refund until release is closed, then fails it with err
+type slowRefunds struct {
+	services.CardGateway
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (g *slowRefunds) Refund(ctx context.Context, c *services.CardCharge, amount float64) (*services.GatewayResult, error) {
+	g.started <- struct{}{}
+	<-g.release
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.CardGateway.Refund(ctx, c, amount)
+}
+
+func TestRefundPayment_ReservesBeforeCallingTheGateway(t *testing.T) {
+	svc := newCardPCI(t)
+	ctx := context.Background()
+	res, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 50, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCardApproved, "user1"), CustomerID: "user1"})
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	gateway := &slowRefunds{CardGateway: services.NewFakeCardGateway(), started: make(chan struct{}, 1), release: make(chan struct{}), err: services.ErrCardGatewayUnavailable}
+	svc.SetGateway(gateway, "")
+
+	done := make(chan error)
+	go func() {
+		_, err := svc.RefundPayment(ctx, res.TransactionID, 30)
+		done <- err
+	}()
+	<-gateway.started
+	// 30 is reserved while the gateway works, so only 20 is left to refund
+	if _, err := svc.RefundPayment(ctx, res.TransactionID, 30); !errors.Is(err, services.ErrCardChargeAmountExceeded) {
+		t.Fatalf("a concurrent refund must not exceed the capture, got %v", err)
+	}
+	close(gateway.release)
+	if err := <-done; !errors.Is(err, services.ErrCardGatewayUnavailable) {
+		t.Fatalf("expected the gateway failure, got %v", err)
+	}
+	charge, _ := svc.GetCharge(ctx, res.TransactionID)
+	if charge.RefundPending != 0 || charge.RefundedAmount != 0 || charge.Status != services.CardChargeCaptured {
+		t.Fatalf("a failed refund must release its reservation, got %+v", charge)
+	}
+}
+
+func TestProcessPayment_ManualCaptureAndVoid(t *testing.T) {
+	svc := newCardPCI(t)
+	ctx := context.Background()
+	token := cardToken(t, svc, services.FakeCardApproved, "user1")
+
+	held, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 100, Currency: "USD", TokenID: token, CustomerID: "user1", CaptureMethod: services.CaptureManual})
+	if err != nil || held.Status != "authorized" {
+		t.Fatalf("expected an authorization, got %+v, %v", held, err)
+	}
+	if _, err := svc.CapturePayment(ctx, held.TransactionID, 150); !errors.Is(err, services.ErrCardChargeAmountExceeded) {
+		t.Fatalf("expected capture above the authorization to be refused, got %v", err)
+	}
+	if res, err := svc.CapturePayment(ctx, held.TransactionID, 80); err != nil || res.Captured != 80 {
+		t.Fatalf("partial capture: %+v, %v", res, err)
+	}
+	if _, err := svc.VoidPayment(ctx, held.TransactionID); !errors.Is(err, services.ErrCardChargeInvalidState) {
+		t.Fatalf("a captured charge cannot be voided, got %v", err)
+	}
+
+	other, _ := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 10, Currency: "USD", TokenID: token, CustomerID: "user1", CaptureMethod: services.CaptureManual})
+	if res, err := svc.VoidPayment(ctx, other.TransactionID); err != nil || res.Status != "voided" {
+		t.Fatalf("void: %+v, %v", res, err)
+	}
+	if _, err := svc.CapturePayment(ctx, other.TransactionID, 0); !errors.Is(err, services.ErrCardChargeInvalidState) {
+		t.Fatalf("a voided charge cannot be captured, got %v", err)
+	}
+}
+
+func TestProcessPayment_DeclinesAreTyped(t *testing.T) {
+	svc := newCardPCI(t)
+	ctx := context.Background()
+	cases := map[string]string{
+		services.FakeCardInsufficientFunds: services.DeclineInsufficientFunds,
+		services.FakeCardDeclined:          services.DeclineDoNotHonor,
+		services.FakeCardExpired:           services.DeclineExpiredCard,
+		services.FakeCardIncorrectCVV:      services.DeclineIncorrectCVV,
+		services.FakeCardFraud:             services.DeclineSuspectedFraud,
+	}
+	for number, code := range cases {
+		_, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 5, Currency: "USD", TokenID: cardToken(t, svc, number, "user1"), CustomerID: "user1"})
+		var declined *services.CardDeclinedError
+		if !errors.Is(err, services.ErrCardDeclined) || !errors.As(err, &declined) || declined.Code != code {
+			t.Fatalf("%s: expected decline %s, got %v", number, code, err)
+		}
+	}
+	_, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 5, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCardProcessingError, "user1"), CustomerID: "user1"})
+	if !errors.Is(err, services.ErrCardGatewayUnavailable) || errors.Is(err, services.ErrCardDeclined) {
+		t.Fatalf("expected a gateway fault rather than a decline, got %v", err)
+	}
+	// Another customer's token is not usable
+	_, err = svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 5, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCardApproved, "user1"), CustomerID: "user2"})
+	if !errors.Is(err, services.ErrPaymentTokenNotFound) {
+		t.Fatalf("expected token not found for another customer, got %v", err)
+	}
+}
+
+func TestProcessPayment_ThreeDSecure(t *testing.T) {
+	svc := newCardPCI(t)
+	ctx := context.Background()
+
+	res, err := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 30, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCard3DS, "user1"), CustomerID: "user1"})
+	if err != nil || res.Status != "requires_action" || res.RedirectURL == "" {
+		t.Fatalf("expected a 3-D Secure challenge, got %+v, %v", res, err)
+	}
+	if res, err = svc.CompleteAuthentication(ctx, res.TransactionID); err != nil || res.Status != "completed" || res.Captured != 30 {
+		t.Fatalf("expected capture after authentication, got %+v, %v", res, err)
+	}
+	// A repeated return does not capture twice
+	if again, err := svc.CompleteAuthentication(ctx, res.TransactionID); err != nil || again.Captured != 30 {
+		t.Fatalf("repeated return: %+v, %v", again, err)
+	}
+
+	failed, _ := svc.ProcessPayment(ctx, &services.PaymentRequest{Amount: 30, Currency: "USD", TokenID: cardToken(t, svc, services.FakeCard3DSFails, "user1"), CustomerID: "user1"})
+	var declined *services.CardDeclinedError
+	if _, err := svc.CompleteAuthentication(ctx, failed.TransactionID); !errors.As(err, &declined) || declined.Code != services.DeclineAuthenticationFailed {
+		t.Fatalf("expected an authentication decline, got %v", err)
+	}
+	if charge, _ := svc.GetCharge(ctx, failed.TransactionID); charge.Status != services.CardChargeFailed {
+		t.Fatalf("expected the charge to be failed, got %s", charge.Status)
+	}
+}
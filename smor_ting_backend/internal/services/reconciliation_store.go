@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrReconciliationReportNotFound = errors.New("reconciliation report not found")
+
+// ReconciliationReportStore keeps one report per day; saving a day again replaces it
+type ReconciliationReportStore interface {
+	Save(ctx context.Context, report *models.ReconciliationReport) error
+	GetByDate(ctx context.Context, date string) (*models.ReconciliationReport, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryReconciliationStore struct {
+	mu      sync.RWMutex
+	reports map[string]*models.ReconciliationReport
+}
+
+func NewMemoryReconciliationStore() ReconciliationReportStore {
+	return &memoryReconciliationStore{reports: make(map[string]*models.ReconciliationReport)}
+}
+
+func (m *memoryReconciliationStore) Save(ctx context.Context, report *models.ReconciliationReport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.reports[report.Date]; ok {
+		report.ID = existing.ID
+	} else if report.ID.IsZero() {
+		report.ID = primitive.NewObjectID()
+	}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = time.Now()
+	}
+	cp := *report
+	m.reports[report.Date] = &cp
+	return nil
+}
+
+func (m *memoryReconciliationStore) GetByDate(ctx context.Context, date string) (*models.ReconciliationReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.reports[date]
+	if !ok {
+		return nil, ErrReconciliationReportNotFound
+	}
+	cp := *r
+	return &cp, nil
+}
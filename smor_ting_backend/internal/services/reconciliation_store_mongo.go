@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoReconciliationStore persists daily reports in the reconciliation_reports collection
+type MongoReconciliationStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoReconciliationStore(db *mongo.Database, logger *logger.Logger) (*MongoReconciliationStore, error) {
+	s := &MongoReconciliationStore{coll: db.Collection("reconciliation_reports"), logger: logger}
+	_, _ = s.coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "date", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	return s, nil
+}
+
+func (m *MongoReconciliationStore) Save(ctx context.Context, report *models.ReconciliationReport) error {
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = time.Now()
+	}
+	set := bson.M{
+		"date":         report.Date,
+		"checked":      report.Checked,
+		"matched":      report.Matched,
+		"mismatches":   report.Mismatches,
+		"generated_at": report.GeneratedAt,
+	}
+	res := m.coll.FindOneAndUpdate(ctx, bson.M{"date": report.Date},
+		bson.M{"$set": set, "$setOnInsert": bson.M{"_id": primitive.NewObjectID()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After))
+	var saved models.ReconciliationReport
+	if err := res.Decode(&saved); err != nil {
+		return err
+	}
+	report.ID = saved.ID
+	return nil
+}
+
+func (m *MongoReconciliationStore) GetByDate(ctx context.Context, date string) (*models.ReconciliationReport, error) {
+	var out models.ReconciliationReport
+	if err := m.coll.FindOne(ctx, bson.M{"date": date}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrReconciliationReportNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
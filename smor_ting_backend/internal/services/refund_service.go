@@ -0,0 +1,489 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidRefundRequest    = errors.New("invalid refund request")
+	ErrRefundSourceNotFound    = errors.New("payment to refund not found")
+	ErrRefundNotRefundable     = errors.New("payment cannot be refunded in its current state")
+	ErrRefundAmountExceeded    = errors.New("refund exceeds the amount still refundable")
+	ErrRefundInsufficientFunds = errors.New("wallet balance does not cover the refund")
+	ErrRefundUnavailable       = errors.New("refunds of this kind are not configured")
+)
+
+// RefundRequest asks for money to be returned. Amount 0 refunds everything
+// that is still refundable. Msisdn overrides the customer's phone as the
+// number a mobile money refund is paid to.
+type RefundRequest struct {
+	Kind   models.RefundKind   `json:"kind"`
+	Source string              `json:"source"`
+	Amount float64             `json:"amount"`
+	Reason models.RefundReason `json:"reason"`
+	Note   string              `json:"note"`
+	Msisdn string              `json:"msisdn"`
+}
+
+// RefundService returns money to customers from wherever they paid it:
+//
+//   - card charges through the card gateway (PCIDSSService)
+//   - mobile money collections by a disbursement back to the payer, which
+//     settles through the webhook and reconciler like a withdrawal
+//   - escrow still held for a booking, moved back to the customer's wallet
+//   - escrow already released, moved back from the provider's wallet
+//
+// Every refund is recorded with its reason, and the sum of a payment's refunds
+// (pending and completed) can never exceed what was captured. Refunds that debit
+// a wallet are checked and recorded under that wallet's lock, and card refunds
+// reserve their amount on the charge, so two admins cannot over-refund together.
+type RefundService struct {
+	store        RefundStore
+	repo         database.Repository
+	ledger       *WalletLedgerService
+	escrow       *EscrowService
+	cards        *PCIDSSService
+	providers    *PaymentProviders
+	auditService *AuditService
+	logger       *zap.Logger
+}
+
+// NewRefundService creates a refund service. A nil cards or providers disables
+// card or mobile money refunds respectively.
+func NewRefundService(store RefundStore, repo database.Repository, ledger *WalletLedgerService, escrow *EscrowService, cards *PCIDSSService, providers *PaymentProviders, auditService *AuditService, logger *zap.Logger) *RefundService {
+	if store == nil {
+		store = NewMemoryRefundStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	return &RefundService{
+		store:        store,
+		repo:         repo,
+		ledger:       ledger,
+		escrow:       escrow,
+		cards:        cards,
+		providers:    providers,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// Refund returns all or part of a payment to the customer on behalf of admin
+func (s *RefundService) Refund(ctx context.Context, admin *models.User, req RefundRequest, ac AuditContext) (*models.Refund, error) {
+	req.Source = strings.TrimSpace(req.Source)
+	if req.Source == "" || req.Amount < 0 || !req.Reason.IsValid() {
+		return nil, ErrInvalidRefundRequest
+	}
+	req.Amount = roundMinor(req.Amount)
+
+	var (
+		refund *models.Refund
+		err    error
+	)
+	switch req.Kind {
+	case models.RefundCard:
+		refund, err = s.refundCard(ctx, admin, req)
+	case models.RefundMobileMoney:
+		refund, err = s.refundMobileMoney(ctx, admin, req)
+	case models.RefundEscrow:
+		refund, err = s.refundEscrow(ctx, admin, req)
+	case models.RefundWallet:
+		refund, err = s.refundWallet(ctx, admin, req)
+	default:
+		return nil, ErrInvalidRefundRequest
+	}
+	if refund != nil {
+		s.audit(ctx, admin, refund, ac, err)
+	}
+	return refund, err
+}
+
+// Get returns a refund, first picking up the outcome of a pending payout
+func (s *RefundService) Get(ctx context.Context, id primitive.ObjectID) (*models.Refund, error) {
+	refund, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.sync(ctx, refund)
+	return refund, nil
+}
+
+// List returns the newest refunds, optionally only those paid to one customer
+func (s *RefundService) List(ctx context.Context, userID *primitive.ObjectID, limit int) ([]models.Refund, error) {
+	refunds, err := s.store.List(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range refunds {
+		s.sync(ctx, &refunds[i])
+	}
+	return refunds, nil
+}
+
+func (s *RefundService) refundCard(ctx context.Context, admin *models.User, req RefundRequest) (*models.Refund, error) {
+	if s.cards == nil {
+		return nil, ErrRefundUnavailable
+	}
+	charge, err := s.cards.GetCharge(ctx, req.Source)
+	if errors.Is(err, ErrCardChargeNotFound) {
+		return nil, ErrRefundSourceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status != CardChargeCaptured {
+		return nil, ErrRefundNotRefundable
+	}
+	amount, err := refundAmount(req.Amount, charge.CapturedAmount-charge.RefundedAmount-charge.RefundPending)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := primitive.ObjectIDFromHex(charge.UserID)
+	refund, err := s.create(ctx, admin, req, userID, amount, charge.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.cards.RefundPayment(ctx, charge.TransactionID, amount); err != nil {
+		if errors.Is(err, ErrCardChargeAmountExceeded) {
+			err = ErrRefundAmountExceeded
+		}
+		return refund, s.finish(ctx, refund, err)
+	}
+	return refund, s.finish(ctx, refund, nil)
+}
+
+// refundMobileMoney pays a confirmed collection back to the payer. The payout
+// debits the customer's wallet once the provider confirms it, so the wallet must
+// still hold the money (an escrow hold is first refunded to the wallet).
+func (s *RefundService) refundMobileMoney(ctx context.Context, admin *models.User, req RefundRequest) (*models.Refund, error) {
+	if s.providers == nil {
+		return nil, ErrRefundUnavailable
+	}
+	intent, err := s.ledger.Intent(ctx, req.Source)
+	if errors.Is(err, ErrWalletEntryNotFound) {
+		return nil, ErrRefundSourceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if op, _ := paymentOperationFor(intent.Type); op != PaymentCollection || intent.Status != models.LedgerCompleted {
+		return nil, ErrRefundNotRefundable
+	}
+	msisdn, err := s.payoutMsisdn(ctx, intent.UserID, req.Msisdn)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.providers.Get(intent.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		refund    *models.Refund
+		payout    *models.WalletLedgerEntry
+		amount    float64
+		intentErr error
+	)
+	// The payout intent reserves the money, so it is recorded with the refund under the payer's wallet lock
+	err = s.ledger.WithWalletLock(ctx, intent.UserID, func(ctx context.Context) error {
+		prior, err := s.refunded(ctx, models.RefundMobileMoney, req.Source)
+		if err != nil {
+			return err
+		}
+		if amount, err = refundAmount(req.Amount, intent.Amount-prior); err != nil {
+			return err
+		}
+		if err := s.ensureAvailable(ctx, intent.UserID, amount, intent.Currency); err != nil {
+			return err
+		}
+		refund = &models.Refund{Reference: NewMomoReferenceID(), Provider: provider.Name()}
+		if refund, err = s.createWith(ctx, refund, admin, req, intent.UserID, amount, intent.Currency); err != nil {
+			return err
+		}
+		payout = &models.WalletLedgerEntry{
+			UserID:    intent.UserID,
+			Type:      models.LedgerRefund,
+			Direction: models.LedgerDebit,
+			Amount:    amount,
+			Currency:  intent.Currency,
+			Reference: refund.Reference,
+			Provider:  provider.Name(),
+		}
+		intentErr = s.ledger.RecordIntent(ctx, payout)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if intentErr != nil {
+		return refund, s.finish(ctx, refund, intentErr)
+	}
+	err = provider.Disburse(ctx, MobileMoneyRequest{
+		ReferenceID: refund.Reference,
+		Amount:      strconv.FormatFloat(amount, 'f', -1, 64),
+		Currency:    intent.Currency,
+		MSISDN:      msisdn,
+		ExternalID:  refund.ID.Hex(),
+		Message:     "Smor-Ting refund",
+		Note:        string(req.Reason),
+	})
+	if errors.Is(err, ErrPaymentRejected) {
+		if settleErr := s.ledger.SettleIntent(ctx, payout, models.LedgerFailed); settleErr != nil {
+			s.logger.Error("Failed to close refund intent", zap.Error(settleErr), zap.String("reference_id", refund.Reference))
+		}
+		return refund, s.finish(ctx, refund, err)
+	}
+	if err != nil {
+		// The provider may have paid, so the refund stays pending under this reference
+		s.logger.Warn("Refund payout outcome unknown; left for reconciliation", zap.Error(err), zap.String("reference_id", refund.Reference))
+	}
+	// The payout settles through the provider's callback or the reconciler
+	return refund, nil
+}
+
+func (s *RefundService) refundEscrow(ctx context.Context, admin *models.User, req RefundRequest) (*models.Refund, error) {
+	escrow, err := s.bookingEscrow(ctx, req.Source)
+	if err != nil {
+		return nil, err
+	}
+	switch escrow.Status {
+	case models.EscrowHeld, models.EscrowReleasePending, models.EscrowDisputed:
+	default:
+		return nil, ErrRefundNotRefundable
+	}
+	amount, err := refundAmount(req.Amount, escrow.Outstanding())
+	if err != nil {
+		return nil, err
+	}
+	refund, err := s.create(ctx, admin, req, escrow.CustomerID, amount, escrow.Currency)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.escrow.Refund(ctx, escrow.BookingID, amount, refund.ID.Hex(), string(req.Reason))
+	if errors.Is(err, ErrEscrowNotRefundable) || errors.Is(err, ErrEscrowStateChanged) {
+		err = ErrRefundNotRefundable
+	}
+	return refund, s.finish(ctx, refund, err)
+}
+
+// refundWallet claws back (part of) a released escrow from the provider's wallet
+func (s *RefundService) refundWallet(ctx context.Context, admin *models.User, req RefundRequest) (*models.Refund, error) {
+	escrow, err := s.bookingEscrow(ctx, req.Source)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.Status != models.EscrowReleased {
+		return nil, ErrRefundNotRefundable
+	}
+	paid := escrow.Outstanding()
+	if escrow.Fees != nil {
+		// Only what reached the provider can be clawed back; the platform's fees are not
+		paid = escrow.Fees.Net
+	}
+
+	var (
+		refund  *models.Refund
+		postErr error
+	)
+	err = s.ledger.WithWalletLock(ctx, escrow.ProviderID, func(ctx context.Context) error {
+		prior, err := s.refunded(ctx, models.RefundWallet, req.Source)
+		if err != nil {
+			return err
+		}
+		amount, err := refundAmount(req.Amount, paid-prior)
+		if err != nil {
+			return err
+		}
+		if err := s.ensureAvailable(ctx, escrow.ProviderID, amount, escrow.Currency); err != nil {
+			return err
+		}
+		if refund, err = s.create(ctx, admin, req, escrow.CustomerID, amount, escrow.Currency); err != nil {
+			return err
+		}
+		tx := &models.LedgerTransaction{
+			IdempotencyKey: "refund:" + refund.ID.Hex(),
+			Type:           models.LedgerRefund,
+			Reference:      escrow.HoldReference,
+			Description:    "Refund for booking " + escrow.BookingID.Hex(),
+		}
+		tx.Debit(models.UserAvailableAccount(escrow.ProviderID), amount, escrow.Currency).
+			Credit(models.UserAvailableAccount(escrow.CustomerID), amount, escrow.Currency)
+		// A posting that fails is recorded on the refund rather than undoing it
+		postErr = s.ledger.Post(ctx, tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, s.finish(ctx, refund, postErr)
+}
+
+func (s *RefundService) bookingEscrow(ctx context.Context, source string) (*models.Escrow, error) {
+	if s.escrow == nil {
+		return nil, ErrRefundUnavailable
+	}
+	bookingID, err := primitive.ObjectIDFromHex(source)
+	if err != nil {
+		return nil, ErrInvalidRefundRequest
+	}
+	escrow, err := s.escrow.Get(ctx, bookingID)
+	if errors.Is(err, ErrEscrowNotFound) {
+		return nil, ErrRefundSourceNotFound
+	}
+	return escrow, err
+}
+
+// refunded sums the pending and completed refunds already issued against a payment
+func (s *RefundService) refunded(ctx context.Context, kind models.RefundKind, source string) (float64, error) {
+	prior, err := s.store.ListBySource(ctx, kind, source)
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	for i := range prior {
+		s.sync(ctx, &prior[i])
+		if prior[i].Status != models.RefundFailed {
+			sum += prior[i].Amount
+		}
+	}
+	return roundMinor(sum), nil
+}
+
+// refundAmount resolves a requested amount (0 meaning everything) against what is left
+func refundAmount(requested, remaining float64) (float64, error) {
+	remaining = roundMinor(remaining)
+	if requested == 0 {
+		requested = remaining
+	}
+	if requested <= 0 || requested > remaining {
+		return 0, ErrRefundAmountExceeded
+	}
+	return requested, nil
+}
+
+// ensureAvailable checks the user's spendable balance in the refund's currency
+func (s *RefundService) ensureAvailable(ctx context.Context, userID primitive.ObjectID, amount float64, currency string) error {
+	spendable, err := s.ledger.Spendable(ctx, userID, currency)
+	if err != nil {
+		return err
+	}
+	if spendable < amount {
+		return ErrRefundInsufficientFunds
+	}
+	return nil
+}
+
+// payoutMsisdn is the number a mobile money refund goes to: the override, else the customer's phone
+func (s *RefundService) payoutMsisdn(ctx context.Context, userID primitive.ObjectID, override string) (string, error) {
+	msisdn := override
+	if msisdn == "" {
+		user, err := s.repo.GetUserByID(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		msisdn = user.Phone
+	}
+	normalized, err := NormalizeMsisdn(msisdn)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRefundRequest, err)
+	}
+	return normalized, nil
+}
+
+func (s *RefundService) create(ctx context.Context, admin *models.User, req RefundRequest, userID primitive.ObjectID, amount float64, currency string) (*models.Refund, error) {
+	return s.createWith(ctx, &models.Refund{}, admin, req, userID, amount, currency)
+}
+
+// createWith records a pending refund before any money moves
+func (s *RefundService) createWith(ctx context.Context, refund *models.Refund, admin *models.User, req RefundRequest, userID primitive.ObjectID, amount float64, currency string) (*models.Refund, error) {
+	refund.Kind = req.Kind
+	refund.Source = req.Source
+	refund.UserID = userID
+	refund.Amount = amount
+	refund.Currency = currency
+	refund.Reason = req.Reason
+	refund.Note = req.Note
+	refund.Status = models.RefundPending
+	refund.RequestedBy = admin.ID
+	if err := s.store.Create(ctx, refund); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// finish settles a refund as completed, or failed with cause, and passes cause on
+func (s *RefundService) finish(ctx context.Context, refund *models.Refund, cause error) error {
+	if cause != nil {
+		refund.Status = models.RefundFailed
+		refund.Failure = cause.Error()
+	} else {
+		now := time.Now()
+		refund.Status = models.RefundCompleted
+		refund.CompletedAt = &now
+	}
+	if err := s.store.Update(ctx, refund, models.RefundPending); err != nil && !errors.Is(err, ErrRefundStateChanged) {
+		s.logger.Error("Failed to record refund outcome", zap.Error(err), zap.String("refund_id", refund.ID.Hex()))
+	}
+	return cause
+}
+
+// sync settles a pending mobile money refund once its payout intent has a final status
+func (s *RefundService) sync(ctx context.Context, refund *models.Refund) {
+	if refund.Status != models.RefundPending || refund.Reference == "" {
+		return
+	}
+	intent, err := s.ledger.Intent(ctx, refund.Reference)
+	if err != nil {
+		return
+	}
+	var cause error
+	switch intent.Status {
+	case models.LedgerCompleted:
+	case models.LedgerFailed:
+		cause = errors.New("provider rejected the payout")
+	default:
+		return
+	}
+	_ = s.finish(ctx, refund, cause)
+}
+
+func (s *RefundService) audit(ctx context.Context, admin *models.User, refund *models.Refund, ac AuditContext, err error) {
+	entry := &AuditEntry{
+		UserID:     admin.ID.Hex(),
+		UserEmail:  admin.Email,
+		UserRole:   string(admin.Role),
+		Action:     ActionPaymentRefund,
+		Resource:   "refund",
+		ResourceID: refund.ID.Hex(),
+		IPAddress:  ac.IPAddress,
+		UserAgent:  ac.UserAgent,
+		Details: map[string]interface{}{
+			"kind":        refund.Kind,
+			"source":      refund.Source,
+			"customer_id": refund.UserID.Hex(),
+			"amount":      refund.Amount,
+			"currency":    refund.Currency,
+			"reason":      refund.Reason,
+			"status":      refund.Status,
+		},
+		Success: err == nil,
+	}
+	if err != nil {
+		entry.ErrorMessage = err.Error()
+	}
+	_ = s.auditService.LogAction(ctx, entry)
+}
@@ -0,0 +1,181 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// payoutRecorder is a PaymentProvider that remembers every disbursement and
+// answers it with err, accepting it when err is nil
+type payoutRecorder struct {
+	payouts []services.MobileMoneyRequest
+	err     error
+}
+
+func (p *payoutRecorder) Name() string                           { return models.PaymentProviderMTNMomo }
+func (p *payoutRecorder) EnsureOnline(ctx context.Context) error { return nil }
+func (p *payoutRecorder) Collect(ctx context.Context, req services.MobileMoneyRequest) error {
+	return errors.New("not used")
+}
+func (p *payoutRecorder) Disburse(ctx context.Context, req services.MobileMoneyRequest) error {
+	p.payouts = append(p.payouts, req)
+	return p.err
+}
+func (p *payoutRecorder) Status(ctx context.Context, op services.PaymentOperation, ref string) (string, error) {
+	return services.PaymentStatusPending, nil
+}
+func (p *payoutRecorder) ParseCallback(body []byte) (*services.PaymentCallback, error) {
+	return nil, services.ErrWebhookInvalidPayload
+}
+
+var refundAdmin = &models.User{Email: "admin@example.com", Role: models.AdminRole}
+
+func TestRefund_PartialEscrowRefundThenReleaseRemainder(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	booking := f.fundedBooking(t, "hold-refund-1")
+	refunds := services.NewRefundService(nil, f.repo, f.ledger, f.escrow, nil, nil, nil, nil)
+	ctx := context.TODO()
+	req := services.RefundRequest{Kind: models.RefundEscrow, Source: booking.ID.Hex(), Amount: 40, Reason: models.RefundReasonPoorQuality}
+
+	refund, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{})
+	if err != nil || refund.Status != models.RefundCompleted {
+		t.Fatalf("expected a completed refund, got %+v, %v", refund, err)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 40 || bal.PendingHeld != 110 {
+		t.Fatalf("expected 40 back and 110 still held, got %+v", bal)
+	}
+	req.Amount = 120
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("refunding more than is held must fail, got %v", err)
+	}
+
+	f.advance(t, booking.ID, models.BookingConfirmed, models.BookingInProgress, models.BookingCompleted)
+	if bal := f.balances(t, f.provider); bal.Available != 110 {
+		t.Fatalf("provider should be paid the remaining 110, got %+v", bal)
+	}
+
+	// After release the rest can only come back out of the provider's wallet
+	req.Amount = 0
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundNotRefundable) {
+		t.Fatalf("a released escrow is no longer refundable from escrow, got %v", err)
+	}
+	req.Kind, req.Amount = models.RefundWallet, 10
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); err != nil {
+		t.Fatalf("wallet refund: %v", err)
+	}
+	req.Amount = 101
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("only 100 of the release is left to refund, got %v", err)
+	}
+	if bal := f.balances(t, f.provider); bal.Available != 100 {
+		t.Fatalf("provider should have 100 after the clawback, got %+v", bal)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 50 {
+		t.Fatalf("customer should have 50 back in total, got %+v", bal)
+	}
+}
+
+func TestRefund_MobileMoneyDisbursesAndSettlesThroughWebhook(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	f.customer.Phone = "+231 770 000 001"
+	_ = f.repo.UpdateUser(ctx, f.customer)
+	// A confirmed 80 USD top-up
+	topup := &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 80, Currency: "USD", Reference: "topup-1"}
+	if err := f.ledger.RecordIntent(ctx, topup); err != nil {
+		t.Fatalf("intent: %v", err)
+	}
+	webhooks := services.NewMomoWebhookService(nil, f.ledger, nil, nil, nil)
+	if _, err := webhooks.Apply(ctx, &services.PaymentCallback{ReferenceID: "topup-1", Status: services.PaymentStatusSuccessful}); err != nil {
+		t.Fatalf("settle top-up: %v", err)
+	}
+
+	payouts := &payoutRecorder{}
+	refunds := services.NewRefundService(nil, f.repo, f.ledger, f.escrow, nil, services.NewPaymentProviders(payouts), nil, nil)
+	req := services.RefundRequest{Kind: models.RefundMobileMoney, Source: "topup-1", Amount: 50, Reason: models.RefundReasonDuplicatePayment}
+	refund, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{})
+	if err != nil || refund.Status != models.RefundPending {
+		t.Fatalf("expected a pending payout, got %+v, %v", refund, err)
+	}
+	if len(payouts.payouts) != 1 || payouts.payouts[0].MSISDN != "231770000001" || payouts.payouts[0].Amount != "50" {
+		t.Fatalf("expected 50 paid to the customer's phone, got %+v", payouts.payouts)
+	}
+	// The pending payout already counts against what is refundable
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("expected the second 50 to exceed the top-up, got %v", err)
+	}
+
+	if _, err := webhooks.Apply(ctx, &services.PaymentCallback{ReferenceID: refund.Reference, Status: services.PaymentStatusSuccessful}); err != nil {
+		t.Fatalf("settle payout: %v", err)
+	}
+	if got, _ := refunds.Get(ctx, refund.ID); got.Status != models.RefundCompleted {
+		t.Fatalf("expected the refund to complete with its payout, got %s", got.Status)
+	}
+	if bal := f.balances(t, f.customer); bal.Available != 30 {
+		t.Fatalf("the payout should debit the wallet to 30, got %+v", bal)
+	}
+}
+
+func TestRefund_MobileMoneyTimeoutStaysPending(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	f.customer.Phone = "231770000001"
+	_ = f.repo.UpdateUser(ctx, f.customer)
+	topup := &models.WalletLedgerEntry{UserID: f.customer.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 80, Currency: "USD", Reference: "topup-2"}
+	_ = f.ledger.RecordIntent(ctx, topup)
+	webhooks := services.NewMomoWebhookService(nil, f.ledger, nil, nil, nil)
+	if _, err := webhooks.Apply(ctx, &services.PaymentCallback{ReferenceID: "topup-2", Status: services.PaymentStatusSuccessful}); err != nil {
+		t.Fatalf("settle top-up: %v", err)
+	}
+
+	payouts := &payoutRecorder{err: context.DeadlineExceeded}
+	refunds := services.NewRefundService(nil, f.repo, f.ledger, f.escrow, nil, services.NewPaymentProviders(payouts), nil, nil)
+	req := services.RefundRequest{Kind: models.RefundMobileMoney, Source: "topup-2", Amount: 80, Reason: models.RefundReasonDuplicatePayment}
+	refund, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{})
+	if err != nil || refund.Status != models.RefundPending {
+		t.Fatalf("a payout that may have gone through must stay pending, got %+v, %v", refund, err)
+	}
+	if intent, _ := f.ledger.Intent(ctx, refund.Reference); intent.Status != models.LedgerPending {
+		t.Fatalf("expected the payout intent to stay pending, got %+v", intent)
+	}
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("the pending payout must not be refunded twice, got %v", err)
+	}
+}
+
+func TestRefund_CardChargeIsCappedAtCapturedAmount(t *testing.T) {
+	f := newEscrowFixture(t, 0)
+	ctx := context.TODO()
+	pci := newCardPCI(t)
+	uid := f.customer.ID.Hex()
+	res, err := pci.ProcessPayment(ctx, &services.PaymentRequest{Amount: 60, Currency: "USD", TokenID: cardToken(t, pci, services.FakeCardApproved, uid), CustomerID: uid})
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	refunds := services.NewRefundService(nil, f.repo, f.ledger, f.escrow, pci, nil, nil, nil)
+	req := services.RefundRequest{Kind: models.RefundCard, Source: res.TransactionID, Amount: 25, Reason: models.RefundReasonProviderNoShow}
+
+	refund, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{})
+	if err != nil || refund.Status != models.RefundCompleted || refund.UserID != f.customer.ID {
+		t.Fatalf("expected a completed refund for the cardholder, got %+v, %v", refund, err)
+	}
+	req.Amount = 40
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrRefundAmountExceeded) {
+		t.Fatalf("only 35 is left to refund, got %v", err)
+	}
+	req.Reason = "changed_mind"
+	if _, err := refunds.Refund(ctx, refundAdmin, req, services.AuditContext{}); !errors.Is(err, services.ErrInvalidRefundRequest) {
+		t.Fatalf("an unknown reason must be rejected, got %v", err)
+	}
+	charge, _ := pci.GetCharge(ctx, res.TransactionID)
+	if charge.RefundedAmount != 25 {
+		t.Fatalf("expected 25 refunded at the gateway, got %v", charge.RefundedAmount)
+	}
+	if list, _ := refunds.List(ctx, &f.customer.ID, 10); len(list) != 1 {
+		t.Fatalf("expected one recorded refund, got %d", len(list))
+	}
+}
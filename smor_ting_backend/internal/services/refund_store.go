@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRefundNotFound     = errors.New("refund not found")
+	ErrRefundStateChanged = errors.New("refund status changed concurrently")
+)
+
+// RefundStore persists refund records. Update is a compare-and-set on Status so
+// that a refund is settled once even when callbacks and reads race.
+type RefundStore interface {
+	Create(ctx context.Context, refund *models.Refund) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Refund, error)
+	// Update replaces the refund if its stored status is still from, otherwise returns ErrRefundStateChanged
+	Update(ctx context.Context, refund *models.Refund, from models.RefundStatus) error
+	// ListBySource returns every refund of one payment, oldest first
+	ListBySource(ctx context.Context, kind models.RefundKind, source string) ([]models.Refund, error)
+	// List returns the newest refunds, optionally only those of one customer
+	List(ctx context.Context, userID *primitive.ObjectID, limit int) ([]models.Refund, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryRefundStore struct {
+	mu      sync.RWMutex
+	refunds map[primitive.ObjectID]*models.Refund
+}
+
+func NewMemoryRefundStore() RefundStore {
+	return &memoryRefundStore{refunds: make(map[primitive.ObjectID]*models.Refund)}
+}
+
+func (m *memoryRefundStore) Create(ctx context.Context, refund *models.Refund) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if refund.ID.IsZero() {
+		refund.ID = primitive.NewObjectID()
+	}
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = refund.CreatedAt
+	cp := *refund
+	m.refunds[refund.ID] = &cp
+	return nil
+}
+
+func (m *memoryRefundStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Refund, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.refunds[id]
+	if !ok {
+		return nil, ErrRefundNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryRefundStore) Update(ctx context.Context, refund *models.Refund, from models.RefundStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.refunds[refund.ID]
+	if !ok {
+		return ErrRefundNotFound
+	}
+	if stored.Status != from {
+		return ErrRefundStateChanged
+	}
+	refund.UpdatedAt = time.Now()
+	cp := *refund
+	m.refunds[refund.ID] = &cp
+	return nil
+}
+
+func (m *memoryRefundStore) ListBySource(ctx context.Context, kind models.RefundKind, source string) ([]models.Refund, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.Refund{}
+	for _, r := range m.refunds {
+		if r.Kind == kind && r.Source == source {
+			out = append(out, *r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryRefundStore) List(ctx context.Context, userID *primitive.ObjectID, limit int) ([]models.Refund, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.Refund{}
+	for _, r := range m.refunds {
+		if userID == nil || r.UserID == *userID {
+			out = append(out, *r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
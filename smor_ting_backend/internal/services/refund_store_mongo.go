@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRefundStore persists refunds in the refunds collection
+type MongoRefundStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoRefundStore(db *mongo.Database, logger *logger.Logger) (*MongoRefundStore, error) {
+	s := &MongoRefundStore{coll: db.Collection("refunds"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "source", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoRefundStore) Create(ctx context.Context, refund *models.Refund) error {
+	if refund.ID.IsZero() {
+		refund.ID = primitive.NewObjectID()
+	}
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = refund.CreatedAt
+	_, err := m.coll.InsertOne(ctx, refund)
+	return err
+}
+
+func (m *MongoRefundStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Refund, error) {
+	var out models.Refund
+	if err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefundNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoRefundStore) Update(ctx context.Context, refund *models.Refund, from models.RefundStatus) error {
+	refund.UpdatedAt = time.Now()
+	res, err := m.coll.ReplaceOne(ctx, bson.M{"_id": refund.ID, "status": from}, refund)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.Get(ctx, refund.ID); err != nil {
+			return err
+		}
+		return ErrRefundStateChanged
+	}
+	return nil
+}
+
+func (m *MongoRefundStore) ListBySource(ctx context.Context, kind models.RefundKind, source string) ([]models.Refund, error) {
+	return m.find(ctx, bson.M{"kind": kind, "source": source}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+}
+
+func (m *MongoRefundStore) List(ctx context.Context, userID *primitive.ObjectID, limit int) ([]models.Refund, error) {
+	filter := bson.M{}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return m.find(ctx, filter, opts)
+}
+
+func (m *MongoRefundStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Refund, error) {
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.Refund{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidTransfer           = errors.New("invalid transfer request")
+	ErrTransferRecipientNotFound = errors.New("no Smor-Ting user with that phone or email")
+	ErrTransferNotPending        = errors.New("transfer is not awaiting verification")
+	ErrTransferOTPInvalid        = errors.New("invalid verification code")
+	ErrTransferOTPExpired        = errors.New("verification code expired")
+	// ErrTransferStepUpRequired is returned for a transfer above the threshold sent without the sender's PIN
+	ErrTransferStepUpRequired = errors.New("wallet PIN required for this amount")
+	// ErrTransferStepUpUnavailable is returned when a large transfer cannot be verified: no PIN is set and no code can be sent
+	ErrTransferStepUpUnavailable = errors.New("set a wallet PIN to send this amount")
+	ErrWalletPINFormat           = errors.New("wallet PIN must be 4 to 6 digits")
+	ErrWalletPINInvalid          = errors.New("incorrect wallet PIN")
+	ErrWalletPINLocked           = errors.New("wallet PIN locked after too many attempts")
+)
+
+const (
+	transferOTPTTL         = 10 * time.Minute
+	transferOTPMaxAttempts = 5
+	walletPINMaxAttempts   = 5
+	walletPINLockout       = 15 * time.Minute
+)
+
+// TransferPolicy holds the rules for wallet-to-wallet transfers
+type TransferPolicy struct {
+	// StepUpThreshold is the amount in USD above which the sender must enter their
+	// PIN or, without one, a code sent to their phone. 0 verifies every transfer.
+	StepUpThreshold float64
+}
+
+// WalletTransferRequest sends Amount to the user found by Recipient, a phone number or
+// email. An empty Currency is the sender's wallet currency.
+type WalletTransferRequest struct {
+	Recipient string
+	Amount    float64
+	Currency  string
+	Note      string
+	PIN       string
+}
+
+// TransferRecipient is what a sender is shown about the user a lookup found
+type TransferRecipient struct {
+	ID    primitive.ObjectID `json:"id"`
+	Name  string             `json:"name"`
+	Role  models.UserRole    `json:"role"`
+	Phone string             `json:"phone,omitempty"`
+}
+
+// TransferService moves funds between users' wallets. A transfer is a single
+// balanced ledger transaction debiting the sender and crediting the recipient,
+// so it appears in both parties' histories and either happens whole or not at all.
+//
+// Transfers above the step-up threshold need the sender's wallet PIN; senders
+// without a PIN confirm with a one-time code sent to their phone instead.
+// The balance check and the posting run under the sender's wallet lock so
+// concurrent debits cannot overdraw the wallet.
+type TransferService struct {
+	store        TransferStore
+	repo         database.Repository
+	ledger       *WalletLedgerService
+	sender       PaymentMethodOTPSender
+	fx           *FXService
+	policy       TransferPolicy
+	auditService *AuditService
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+// NewTransferService creates the service; with a nil sender, large transfers need a PIN
+func NewTransferService(store TransferStore, repo database.Repository, ledger *WalletLedgerService, sender PaymentMethodOTPSender, policy TransferPolicy, auditService *AuditService, logger *zap.Logger) *TransferService {
+	if store == nil {
+		store = NewMemoryTransferStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	return &TransferService{
+		store:        store,
+		repo:         repo,
+		ledger:       ledger,
+		sender:       sender,
+		policy:       policy,
+		auditService: auditService,
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// SetFXService converts transfers in other currencies to USD for the step-up threshold
+func (s *TransferService) SetFXService(fx *FXService) {
+	s.fx = fx
+}
+
+// Lookup finds the user a sender means by a phone number or email
+func (s *TransferService) Lookup(ctx context.Context, sender *models.User, query string) (*TransferRecipient, error) {
+	user, err := s.findRecipient(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == sender.ID {
+		return nil, fmt.Errorf("%w: cannot send to yourself", ErrInvalidTransfer)
+	}
+	out := &TransferRecipient{ID: user.ID, Name: displayName(user), Role: user.Role}
+	if number, err := NormalizeMsisdn(user.Phone); err == nil {
+		out.Phone = MaskMsisdn(number)
+	}
+	return out, nil
+}
+
+// Send transfers funds to the recipient. A transfer that needs a one-time code
+// is returned pending verification; Confirm completes it.
+func (s *TransferService) Send(ctx context.Context, user *models.User, req WalletTransferRequest, ac AuditContext) (*models.WalletTransfer, error) {
+	amount := roundMinor(req.Amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidTransfer)
+	}
+	currency := walletCurrency(user)
+	if req.Currency != "" {
+		var ok bool
+		if currency, ok = models.NormalizeCurrency(req.Currency); !ok {
+			return nil, models.ErrUnsupportedCurrency
+		}
+	}
+	recipient, err := s.findRecipient(ctx, req.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.ID == user.ID {
+		return nil, fmt.Errorf("%w: cannot send to yourself", ErrInvalidTransfer)
+	}
+	t := &models.WalletTransfer{
+		SenderID:      user.ID,
+		SenderName:    displayName(user),
+		RecipientID:   recipient.ID,
+		RecipientName: displayName(recipient),
+		Amount:        amount,
+		Currency:      currency,
+		Note:          strings.TrimSpace(req.Note),
+		Verification:  models.TransferVerifiedNone,
+		Reference:     "p2p-" + primitive.NewObjectID().Hex(),
+	}
+
+	if s.needsStepUp(ctx, amount, currency) {
+		switch {
+		case req.PIN != "":
+			if err := s.checkPIN(ctx, user, req.PIN); err != nil {
+				s.audit(ctx, user, t, "send", ac, err)
+				return nil, err
+			}
+			t.Verification = models.TransferVerifiedPIN
+		case user.WalletPIN != "":
+			return nil, ErrTransferStepUpRequired
+		default:
+			return s.challenge(ctx, user, t, ac)
+		}
+	}
+	if err := s.complete(ctx, user, t, ac); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Confirm completes a transfer held for the one-time code sent to the sender
+func (s *TransferService) Confirm(ctx context.Context, user *models.User, id primitive.ObjectID, code string, ac AuditContext) (*models.WalletTransfer, error) {
+	t, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.SenderID != user.ID {
+		return nil, ErrTransferNotFound
+	}
+	if t.Status != models.TransferPendingVerification {
+		return nil, ErrTransferNotPending
+	}
+	if t.OTPExpiresAt == nil || !s.now().Before(*t.OTPExpiresAt) {
+		s.cancel(ctx, t)
+		return nil, ErrTransferOTPExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(hashPaymentMethodOTP(t.ID, strings.TrimSpace(code))), []byte(t.OTPHash)) != 1 {
+		t.OTPAttempts++
+		if t.OTPAttempts >= transferOTPMaxAttempts {
+			s.cancel(ctx, t)
+		} else if err := s.store.Update(ctx, t, models.TransferPendingVerification); err != nil {
+			return nil, err
+		}
+		s.audit(ctx, user, t, "confirm", ac, ErrTransferOTPInvalid)
+		return nil, ErrTransferOTPInvalid
+	}
+	t.OTPHash, t.OTPExpiresAt = "", nil
+	t.Verification = models.TransferVerifiedOTP
+	if err := s.complete(ctx, user, t, ac); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetPIN sets the user's wallet PIN; changing an existing PIN needs the current one
+func (s *TransferService) SetPIN(ctx context.Context, user *models.User, current, pin string) error {
+	if !validWalletPIN(pin) {
+		return ErrWalletPINFormat
+	}
+	if user.WalletPIN != "" {
+		if err := s.checkPIN(ctx, user, current); err != nil {
+			return err
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if user, err = s.repo.GetUserByID(ctx, user.ID); err != nil {
+		return err
+	}
+	user.WalletPIN = string(hash)
+	user.WalletPINAttempts, user.WalletPINLockedUntil = 0, nil
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	_ = s.auditService.LogUserAction(ctx, user, ActionWalletPINChange, "wallet", "", "", true, nil)
+	return nil
+}
+
+// Get returns a transfer the user sent or received
+func (s *TransferService) Get(ctx context.Context, user *models.User, id primitive.ObjectID) (*models.WalletTransfer, error) {
+	t, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.SenderID != user.ID && t.RecipientID != user.ID {
+		return nil, ErrTransferNotFound
+	}
+	return t, nil
+}
+
+// List returns the transfers the user sent or received, newest first
+func (s *TransferService) List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletTransfer, error) {
+	return s.store.ListByUser(ctx, userID, limit)
+}
+
+// findRecipient looks a user up by email, or by phone in any of the forms it may have been stored in
+func (s *TransferService) findRecipient(ctx context.Context, query string) (*models.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: recipient is required", ErrInvalidTransfer)
+	}
+	if strings.Contains(query, "@") {
+		for _, email := range []string{query, strings.ToLower(query)} {
+			if user, err := s.repo.GetUserByEmail(ctx, email); err == nil && user != nil {
+				return user, nil
+			}
+		}
+		return nil, ErrTransferRecipientNotFound
+	}
+	number, err := NormalizeMsisdn(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: recipient must be a phone number or email", ErrInvalidTransfer)
+	}
+	for _, phone := range phoneForms(query, number) {
+		if user, err := s.repo.GetUserByPhone(ctx, phone); err == nil && user != nil {
+			return user, nil
+		}
+	}
+	return nil, ErrTransferRecipientNotFound
+}
+
+// phoneForms lists the ways a Liberian number may have been entered at registration
+func phoneForms(raw, number string) []string {
+	forms := []string{strings.TrimSpace(raw), number, "+" + number}
+	switch {
+	case strings.HasPrefix(number, "231"):
+		forms = append(forms, "0"+number[3:])
+	case strings.HasPrefix(number, "0"):
+		forms = append(forms, "231"+number[1:], "+231"+number[1:])
+	}
+	seen := map[string]bool{}
+	out := forms[:0]
+	for _, f := range forms {
+		if !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// needsStepUp reports whether amount is above the threshold. An amount that
+// cannot be converted to USD is treated as above it.
+func (s *TransferService) needsStepUp(ctx context.Context, amount float64, currency string) bool {
+	usd := amount
+	if currency != models.CurrencyUSD {
+		if s.fx == nil {
+			return true
+		}
+		rate, err := s.fx.Rate(ctx, currency, models.CurrencyUSD)
+		if err != nil {
+			return true
+		}
+		usd = amount * rate
+	}
+	return usd > s.policy.StepUpThreshold
+}
+
+// checkPIN verifies the user's wallet PIN, locking it after too many wrong attempts.
+// Attempts are counted on the stored user, not the copy the request carries.
+func (s *TransferService) checkPIN(ctx context.Context, caller *models.User, pin string) error {
+	user, err := s.repo.GetUserByID(ctx, caller.ID)
+	if err != nil {
+		return err
+	}
+	if user.WalletPIN == "" {
+		return ErrWalletPINInvalid
+	}
+	now := s.now()
+	if user.WalletPINLockedUntil != nil && now.Before(*user.WalletPINLockedUntil) {
+		return ErrWalletPINLocked
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.WalletPIN), []byte(pin)) != nil {
+		user.WalletPINAttempts++
+		if user.WalletPINAttempts >= walletPINMaxAttempts {
+			until := now.Add(walletPINLockout)
+			user.WalletPINAttempts, user.WalletPINLockedUntil = 0, &until
+		}
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		return ErrWalletPINInvalid
+	}
+	if user.WalletPINAttempts > 0 || user.WalletPINLockedUntil != nil {
+		user.WalletPINAttempts, user.WalletPINLockedUntil = 0, nil
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// challenge records the transfer pending verification and sends the sender a code
+func (s *TransferService) challenge(ctx context.Context, user *models.User, t *models.WalletTransfer, ac AuditContext) (*models.WalletTransfer, error) {
+	number, err := NormalizeMsisdn(user.Phone)
+	if s.sender == nil || err != nil {
+		return nil, ErrTransferStepUpUnavailable
+	}
+	// Refuse up front rather than after the code has been entered
+	if err := s.ensureSpendable(ctx, t); err != nil {
+		return nil, err
+	}
+	code, err := newPaymentMethodOTP()
+	if err != nil {
+		return nil, err
+	}
+	t.ID = primitive.NewObjectID()
+	expires := s.now().Add(transferOTPTTL)
+	t.Status = models.TransferPendingVerification
+	t.OTPHash = hashPaymentMethodOTP(t.ID, code)
+	t.OTPExpiresAt = &expires
+	if err := s.store.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	if err := s.sender.SendOTP(ctx, number, code); err != nil {
+		s.cancel(ctx, t)
+		return nil, fmt.Errorf("send verification code: %w", err)
+	}
+	s.audit(ctx, user, t, "challenge", ac, nil)
+	return t, nil
+}
+
+// complete posts the transfer to the ledger and records it completed. New
+// transfers are created here; verified ones move from pending verification.
+func (s *TransferService) complete(ctx context.Context, user *models.User, t *models.WalletTransfer, ac AuditContext) error {
+	from := t.Status
+	err := s.ledger.WithWalletLock(ctx, t.SenderID, func(ctx context.Context) error {
+		if err := s.ensureSpendable(ctx, t); err != nil {
+			return err
+		}
+		now := s.now()
+		t.Status = models.TransferCompleted
+		t.CompletedAt = &now
+		if from == "" {
+			if err := s.store.Create(ctx, t); err != nil {
+				return err
+			}
+		} else if err := s.store.Update(ctx, t, from); err != nil {
+			return err
+		}
+
+		description := "Wallet transfer from " + t.SenderName + " to " + t.RecipientName
+		if t.Note != "" {
+			description += ": " + t.Note
+		}
+		tx := (&models.LedgerTransaction{
+			IdempotencyKey: "transfer:" + t.ID.Hex(),
+			Type:           models.LedgerTransfer,
+			Reference:      t.Reference,
+			Description:    description,
+			CreatedAt:      now,
+		}).Debit(models.UserAvailableAccount(t.SenderID), t.Amount, t.Currency).
+			Credit(models.UserAvailableAccount(t.RecipientID), t.Amount, t.Currency)
+		if err := s.ledger.Post(ctx, tx); err != nil {
+			// Nothing moved; take the completed record back so neither party sees it
+			t.Status, t.CompletedAt = models.TransferCancelled, nil
+			if uerr := s.store.Update(ctx, t, models.TransferCompleted); uerr != nil {
+				s.logger.Error("Failed to cancel unposted transfer", zap.Error(uerr), zap.String("transfer_id", t.ID.Hex()))
+			}
+			return fmt.Errorf("post transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.audit(ctx, user, t, "send", ac, err)
+		return err
+	}
+
+	s.audit(ctx, user, t, "send", ac, nil)
+	if recipient, err := s.repo.GetUserByID(ctx, t.RecipientID); err == nil {
+		s.audit(ctx, recipient, t, "receive", AuditContext{}, nil)
+	}
+	return nil
+}
+
+// ensureSpendable checks the sender's available balance, less unsettled payouts, covers the transfer
+func (s *TransferService) ensureSpendable(ctx context.Context, t *models.WalletTransfer) error {
+	spendable, err := s.ledger.Spendable(ctx, t.SenderID, t.Currency)
+	if err != nil {
+		return err
+	}
+	if spendable < t.Amount {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+func (s *TransferService) cancel(ctx context.Context, t *models.WalletTransfer) {
+	from := t.Status
+	t.Status = models.TransferCancelled
+	t.OTPHash, t.OTPExpiresAt = "", nil
+	if err := s.store.Update(ctx, t, from); err != nil {
+		s.logger.Warn("Failed to cancel transfer", zap.Error(err), zap.String("transfer_id", t.ID.Hex()))
+	}
+}
+
+// audit records the transfer on the actor's trail: "send", "challenge" and
+// "confirm" for the sender, "receive" for the recipient
+func (s *TransferService) audit(ctx context.Context, actor *models.User, t *models.WalletTransfer, step string, ac AuditContext, err error) {
+	entry := &AuditEntry{
+		UserID:     actor.ID.Hex(),
+		UserEmail:  actor.Email,
+		UserRole:   string(actor.Role),
+		Action:     ActionWalletTransfer,
+		Resource:   "wallet_transfer",
+		ResourceID: t.ID.Hex(),
+		IPAddress:  ac.IPAddress,
+		UserAgent:  ac.UserAgent,
+		Details: map[string]interface{}{
+			"step":         step,
+			"sender_id":    t.SenderID.Hex(),
+			"recipient_id": t.RecipientID.Hex(),
+			"amount":       t.Amount,
+			"currency":     t.Currency,
+			"status":       t.Status,
+			"verification": t.Verification,
+			"reference":    t.Reference,
+		},
+		Success: err == nil,
+	}
+	if err != nil {
+		entry.ErrorMessage = err.Error()
+	}
+	_ = s.auditService.LogAction(ctx, entry)
+}
+
+// displayName is the first name and last initial, enough to confirm a recipient without exposing them
+func displayName(u *models.User) string {
+	name := strings.TrimSpace(u.FirstName)
+	if last := strings.TrimSpace(u.LastName); last != "" {
+		name += " " + last[:1] + "."
+	}
+	if name == "" {
+		return "Smor-Ting user"
+	}
+	return strings.TrimSpace(name)
+}
+
+func validWalletPIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 6 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
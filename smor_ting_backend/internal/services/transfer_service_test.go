@@ -0,0 +1,185 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+// codeRecorder keeps the last code sent to each number
+type codeRecorder struct{ codes map[string]string }
+
+func (r *codeRecorder) SendOTP(ctx context.Context, msisdn, code string) error {
+	r.codes[msisdn] = code
+	return nil
+}
+
+func newTransferFixture(t *testing.T) (*services.TransferService, *services.WalletLedgerService, *database.MemoryDatabase, *codeRecorder) {
+	t.Helper()
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	codes := &codeRecorder{codes: map[string]string{}}
+	transfers := services.NewTransferService(nil, repo, ledger, codes, services.TransferPolicy{StepUpThreshold: 50}, nil, nil)
+	return transfers, ledger, repo, codes
+}
+
+func transferUser(t *testing.T, repo *database.MemoryDatabase, ledger *services.WalletLedgerService, email, phone string, funds float64) *models.User {
+	t.Helper()
+	ctx := context.TODO()
+	u := &models.User{Email: email, FirstName: "Musu", LastName: "Kollie", Phone: phone, Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	if err := repo.CreateUser(ctx, u); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if funds > 0 {
+		_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit,
+			Amount: funds, Status: models.LedgerCompleted, Reference: "fund-" + email})
+	}
+	return u
+}
+
+func available(t *testing.T, ledger *services.WalletLedgerService, u *models.User) float64 {
+	t.Helper()
+	bal, err := ledger.ComputeBalances(context.TODO(), u.ID)
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	return bal.Available
+}
+
+func TestTransfer_PostsToBothWalletsAndRejectsBadRequests(t *testing.T) {
+	transfers, ledger, repo, _ := newTransferFixture(t)
+	ctx := context.TODO()
+	sender := transferUser(t, repo, ledger, "sender@example.com", "231770000101", 100)
+	housemate := transferUser(t, repo, ledger, "housemate@example.com", "231770000102", 0)
+
+	found, err := transfers.Lookup(ctx, sender, "0770000102")
+	if err != nil || found.ID != housemate.ID || found.Name != "Musu K." || found.Phone != "***0102" {
+		t.Fatalf("expected the local number to find the housemate, got %+v, %v", found, err)
+	}
+	tr, err := transfers.Send(ctx, sender, services.WalletTransferRequest{Recipient: "housemate@example.com", Amount: 30, Note: "half the plumber"}, services.AuditContext{})
+	if err != nil || tr.Status != models.TransferCompleted || tr.Verification != models.TransferVerifiedNone {
+		t.Fatalf("expected a completed transfer, got %+v, %v", tr, err)
+	}
+	if available(t, ledger, sender) != 70 || available(t, ledger, housemate) != 30 {
+		t.Fatalf("expected 70/30 after the transfer, got %.2f/%.2f", available(t, ledger, sender), available(t, ledger, housemate))
+	}
+	for _, u := range []*models.User{sender, housemate} {
+		txs, _ := ledger.RecentTransactions(ctx, u.ID, 10)
+		if len(txs) == 0 || txs[0].Type != models.LedgerTransfer || txs[0].Reference != tr.Reference {
+			t.Fatalf("expected the transfer in %s's history, got %+v", u.Email, txs)
+		}
+		list, _ := transfers.List(ctx, u.ID, 0)
+		if len(list) != 1 || list[0].ID != tr.ID {
+			t.Fatalf("expected both parties to list the transfer, got %+v", list)
+		}
+	}
+
+	if _, err := transfers.Send(ctx, sender, services.WalletTransferRequest{Recipient: "231770000101", Amount: 5}, services.AuditContext{}); !errors.Is(err, services.ErrInvalidTransfer) {
+		t.Fatalf("expected sending to yourself to be refused, got %v", err)
+	}
+	if _, err := transfers.Send(ctx, sender, services.WalletTransferRequest{Recipient: "nobody@example.com", Amount: 5}, services.AuditContext{}); !errors.Is(err, services.ErrTransferRecipientNotFound) {
+		t.Fatalf("expected an unknown recipient, got %v", err)
+	}
+	if _, err := transfers.Send(ctx, housemate, services.WalletTransferRequest{Recipient: "sender@example.com", Amount: 40}, services.AuditContext{}); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("expected the housemate's 30 not to cover 40, got %v", err)
+	}
+}
+
+func TestTransfer_ConcurrentSendsCannotOverdraw(t *testing.T) {
+	transfers, ledger, repo, _ := newTransferFixture(t)
+	sender := transferUser(t, repo, ledger, "racer@example.com", "231770000301", 100)
+	friend := transferUser(t, repo, ledger, "friend@example.com", "231770000302", 0)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent, refused := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := transfers.Send(context.TODO(), sender, services.WalletTransferRequest{Recipient: "friend@example.com", Amount: 20}, services.AuditContext{})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				sent++
+			case errors.Is(err, services.ErrInsufficientBalance):
+				refused++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if sent != 5 || refused != 5 || available(t, ledger, sender) != 0 || available(t, ledger, friend) != 100 {
+		t.Fatalf("expected exactly 100 to move, got %d sent, %d refused, %.2f/%.2f", sent, refused, available(t, ledger, sender), available(t, ledger, friend))
+	}
+}
+
+func TestTransfer_AboveThresholdNeedsPINOrCode(t *testing.T) {
+	transfers, ledger, repo, codes := newTransferFixture(t)
+	ctx := context.TODO()
+	customer := transferUser(t, repo, ledger, "tipper@example.com", "231770000201", 500)
+	provider := transferUser(t, repo, ledger, "provider@example.com", "231770000202", 0)
+
+	// Without a PIN the sender confirms with a code sent to their phone
+	pending, err := transfers.Send(ctx, customer, services.WalletTransferRequest{Recipient: "provider@example.com", Amount: 80}, services.AuditContext{})
+	if err != nil || pending.Status != models.TransferPendingVerification || codes.codes["231770000201"] == "" {
+		t.Fatalf("expected the transfer to wait for a code, got %+v, %v", pending, err)
+	}
+	if available(t, ledger, provider) != 0 {
+		t.Fatalf("nothing may move before the code is entered")
+	}
+	if _, err := transfers.Confirm(ctx, provider, pending.ID, codes.codes["231770000201"], services.AuditContext{}); !errors.Is(err, services.ErrTransferNotFound) {
+		t.Fatalf("only the sender may confirm, got %v", err)
+	}
+	if _, err := transfers.Confirm(ctx, customer, pending.ID, "000000", services.AuditContext{}); !errors.Is(err, services.ErrTransferOTPInvalid) {
+		t.Fatalf("expected a wrong code to be refused, got %v", err)
+	}
+	done, err := transfers.Confirm(ctx, customer, pending.ID, codes.codes["231770000201"], services.AuditContext{})
+	if err != nil || done.Status != models.TransferCompleted || done.Verification != models.TransferVerifiedOTP || available(t, ledger, provider) != 80 {
+		t.Fatalf("expected the code to complete the transfer, got %+v, %v", done, err)
+	}
+	if _, err := transfers.Confirm(ctx, customer, pending.ID, codes.codes["231770000201"], services.AuditContext{}); !errors.Is(err, services.ErrTransferNotPending) {
+		t.Fatalf("expected a second confirmation to be refused, got %v", err)
+	}
+
+	// With a PIN set, large transfers need it
+	if err := transfers.SetPIN(ctx, customer, "", "12a4"); !errors.Is(err, services.ErrWalletPINFormat) {
+		t.Fatalf("expected a non-numeric PIN to be refused, got %v", err)
+	}
+	if err := transfers.SetPIN(ctx, customer, "", "4821"); err != nil {
+		t.Fatalf("set PIN: %v", err)
+	}
+	if err := transfers.SetPIN(ctx, customer, "0000", "1111"); !errors.Is(err, services.ErrWalletPINInvalid) {
+		t.Fatalf("changing the PIN must need the current one, got %v", err)
+	}
+	req := services.WalletTransferRequest{Recipient: "231770000202", Amount: 60}
+	if _, err := transfers.Send(ctx, customer, req, services.AuditContext{}); !errors.Is(err, services.ErrTransferStepUpRequired) {
+		t.Fatalf("expected the PIN to be required, got %v", err)
+	}
+	req.PIN = "4821"
+	tr, err := transfers.Send(ctx, customer, req, services.AuditContext{})
+	if err != nil || tr.Verification != models.TransferVerifiedPIN || available(t, ledger, provider) != 140 {
+		t.Fatalf("expected the PIN to authorise the transfer, got %+v, %v", tr, err)
+	}
+
+	req.PIN = "9999"
+	for i := 0; i < 5; i++ {
+		if _, err := transfers.Send(ctx, customer, req, services.AuditContext{}); !errors.Is(err, services.ErrWalletPINInvalid) {
+			t.Fatalf("attempt %d: expected a wrong PIN to be refused, got %v", i+1, err)
+		}
+	}
+	req.PIN = "4821"
+	if _, err := transfers.Send(ctx, customer, req, services.AuditContext{}); !errors.Is(err, services.ErrWalletPINLocked) {
+		t.Fatalf("expected the PIN to lock after five wrong attempts, got %v", err)
+	}
+	if available(t, ledger, customer) != 360 {
+		t.Fatalf("expected 500-80-60 left, got %.2f", available(t, ledger, customer))
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrTransferNotFound     = errors.New("transfer not found")
+	ErrTransferStateChanged = errors.New("transfer status changed concurrently")
+)
+
+// TransferStore persists wallet-to-wallet transfers. Update is a compare-and-set
+// on Status so that a transfer is completed exactly once.
+type TransferStore interface {
+	Create(ctx context.Context, t *models.WalletTransfer) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.WalletTransfer, error)
+	// Update replaces the transfer if its stored status is still from, otherwise returns ErrTransferStateChanged
+	Update(ctx context.Context, t *models.WalletTransfer, from models.TransferStatus) error
+	// ListByUser returns transfers the user sent or received, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletTransfer, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryTransferStore struct {
+	mu        sync.RWMutex
+	transfers map[primitive.ObjectID]*models.WalletTransfer
+}
+
+func NewMemoryTransferStore() TransferStore {
+	return &memoryTransferStore{transfers: make(map[primitive.ObjectID]*models.WalletTransfer)}
+}
+
+func (m *memoryTransferStore) Create(ctx context.Context, t *models.WalletTransfer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.ID.IsZero() {
+		t.ID = primitive.NewObjectID()
+	}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	cp := *t
+	m.transfers[t.ID] = &cp
+	return nil
+}
+
+func (m *memoryTransferStore) Get(ctx context.Context, id primitive.ObjectID) (*models.WalletTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.transfers[id]
+	if !ok {
+		return nil, ErrTransferNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryTransferStore) Update(ctx context.Context, t *models.WalletTransfer, from models.TransferStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.transfers[t.ID]
+	if !ok {
+		return ErrTransferNotFound
+	}
+	if stored.Status != from {
+		return ErrTransferStateChanged
+	}
+	t.UpdatedAt = time.Now()
+	cp := *t
+	m.transfers[t.ID] = &cp
+	return nil
+}
+
+func (m *memoryTransferStore) ListByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.WalletTransfer{}
+	for _, t := range m.transfers {
+		if t.SenderID == userID || t.RecipientID == userID {
+			out = append(out, *t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoTransferStore persists transfers in the wallet_transfers collection
+type MongoTransferStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoTransferStore(db *mongo.Database, logger *logger.Logger) (*MongoTransferStore, error) {
+	s := &MongoTransferStore{coll: db.Collection("wallet_transfers"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "recipient_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoTransferStore) Create(ctx context.Context, t *models.WalletTransfer) error {
+	if t.ID.IsZero() {
+		t.ID = primitive.NewObjectID()
+	}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	_, err := m.coll.InsertOne(ctx, t)
+	return err
+}
+
+func (m *MongoTransferStore) Get(ctx context.Context, id primitive.ObjectID) (*models.WalletTransfer, error) {
+	var out models.WalletTransfer
+	if err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoTransferStore) Update(ctx context.Context, t *models.WalletTransfer, from models.TransferStatus) error {
+	t.UpdatedAt = time.Now()
+	res, err := m.coll.ReplaceOne(ctx, bson.M{"_id": t.ID, "status": from}, t)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.Get(ctx, t.ID); err != nil {
+			return err
+		}
+		return ErrTransferStateChanged
+	}
+	return nil
+}
+
+func (m *MongoTransferStore) ListByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletTransfer, error) {
+	filter := bson.M{"$or": []bson.M{{"sender_id": userID}, {"recipient_id": userID}}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.WalletTransfer{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
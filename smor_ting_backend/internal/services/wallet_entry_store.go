@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWalletEntryNotFound = errors.New("wallet entry not found")
+	ErrWalletEntryExists   = errors.New("wallet entry already recorded")
+	ErrWalletEntrySettled  = errors.New("wallet entry already settled")
+)
+
+// WalletEntryStore holds the payment intents for MoMo-backed wallet operations
+// (top-ups, withdrawals, escrow holds and refunds). An intent is written before
+// MoMo is called, keyed by the X-Reference-Id, and tells callbacks which user
+// and booking a reference belongs to. Pending intents are what the reconciler polls
+// when a callback never arrives.
+type WalletEntryStore interface {
+	// Create records a new entry, or returns ErrWalletEntryExists for a known reference
+	Create(ctx context.Context, entry *models.WalletLedgerEntry) error
+	GetByReference(ctx context.Context, reference string) (*models.WalletLedgerEntry, error)
+	// Settle moves a pending entry to status, or returns ErrWalletEntrySettled if it is no longer pending
+	Settle(ctx context.Context, id primitive.ObjectID, status models.LedgerStatus) error
+	// ListPending returns pending entries created before cutoff that are due a
+	// reconciliation poll and not left for review, oldest first
+	ListPending(ctx context.Context, cutoff time.Time, limit int) ([]models.WalletLedgerEntry, error)
+	// DeferReconcile records an unsettled poll of a pending entry: attempts polls
+	// so far and when to poll next, or no next poll to leave it for review
+	DeferReconcile(ctx context.Context, id primitive.ObjectID, attempts int, next *time.Time) error
+	// ListCreatedBetween returns every entry created in [from, to)
+	ListCreatedBetween(ctx context.Context, from, to time.Time) ([]models.WalletLedgerEntry, error)
+	// ListByUser returns the user's entries matching q, newest first
+	ListByUser(ctx context.Context, q database.LedgerQuery) ([]models.WalletLedgerEntry, error)
+}
+
+// isIntentType reports whether an entry type is initiated with MoMo and confirmed asynchronously
+func isIntentType(t models.LedgerType) bool {
+	return t == models.LedgerTopup || t == models.LedgerWithdraw || t == models.LedgerEscrowHold || t == models.LedgerRefund || t == models.LedgerPayout
+}
+
+// In-memory implementation for tests/dev
+type memoryWalletEntryStore struct {
+	mu      sync.RWMutex
+	entries map[primitive.ObjectID]*models.WalletLedgerEntry
+}
+
+func NewMemoryWalletEntryStore() WalletEntryStore {
+	return &memoryWalletEntryStore{entries: make(map[primitive.ObjectID]*models.WalletLedgerEntry)}
+}
+
+func (m *memoryWalletEntryStore) Create(ctx context.Context, entry *models.WalletLedgerEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.Reference == entry.Reference {
+			return ErrWalletEntryExists
+		}
+	}
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.UpdatedAt = time.Now()
+	cp := *entry
+	m.entries[entry.ID] = &cp
+	return nil
+}
+
+func (m *memoryWalletEntryStore) GetByReference(ctx context.Context, reference string) (*models.WalletLedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.entries {
+		if e.Reference == reference {
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, ErrWalletEntryNotFound
+}
+
+func (m *memoryWalletEntryStore) Settle(ctx context.Context, id primitive.ObjectID, status models.LedgerStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return ErrWalletEntryNotFound
+	}
+	if e.Status != models.LedgerPending {
+		return ErrWalletEntrySettled
+	}
+	e.Status = status
+	e.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memoryWalletEntryStore) ListPending(ctx context.Context, cutoff time.Time, limit int) ([]models.WalletLedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.WalletLedgerEntry
+	now := time.Now()
+	for _, e := range m.entries {
+		if e.Status == models.LedgerPending && e.CreatedAt.Before(cutoff) && !e.NeedsReview &&
+			(e.NextReconcileAt == nil || !e.NextReconcileAt.After(now)) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *memoryWalletEntryStore) DeferReconcile(ctx context.Context, id primitive.ObjectID, attempts int, next *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return ErrWalletEntryNotFound
+	}
+	if e.Status != models.LedgerPending {
+		return ErrWalletEntrySettled
+	}
+	e.ReconcileAttempts = attempts
+	e.NextReconcileAt = next
+	e.NeedsReview = next == nil
+	e.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memoryWalletEntryStore) ListCreatedBetween(ctx context.Context, from, to time.Time) ([]models.WalletLedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.WalletLedgerEntry
+	for _, e := range m.entries {
+		if !e.CreatedAt.Before(from) && e.CreatedAt.Before(to) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *memoryWalletEntryStore) ListByUser(ctx context.Context, q database.LedgerQuery) ([]models.WalletLedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.WalletLedgerEntry
+	for _, e := range m.entries {
+		if e.UserID == q.UserID && entryMatches(e, q) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID.Hex() > out[j].ID.Hex()
+	})
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func entryMatches(e *models.WalletLedgerEntry, q database.LedgerQuery) bool {
+	if (!q.From.IsZero() && e.CreatedAt.Before(q.From)) || (!q.To.IsZero() && !e.CreatedAt.Before(q.To)) {
+		return false
+	}
+	if q.Currency != "" && e.Currency != q.Currency {
+		return false
+	}
+	if !q.Before.After(e.CreatedAt, e.ID) {
+		return false
+	}
+	if len(q.Types) > 0 && !containsType(q.Types, e.Type) {
+		return false
+	}
+	if len(q.Statuses) > 0 {
+		for _, status := range q.Statuses {
+			if status == e.Status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsType(types []models.LedgerType, t models.LedgerType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoWalletEntryStore persists payment intents in the wallet_entries collection
+type MongoWalletEntryStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoWalletEntryStore(db *mongo.Database, logger *logger.Logger) (*MongoWalletEntryStore, error) {
+	s := &MongoWalletEntryStore{coll: db.Collection("wallet_entries"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "reference", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoWalletEntryStore) Create(ctx context.Context, entry *models.WalletLedgerEntry) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.UpdatedAt = time.Now()
+	if _, err := m.coll.InsertOne(ctx, entry); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrWalletEntryExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *MongoWalletEntryStore) GetByReference(ctx context.Context, reference string) (*models.WalletLedgerEntry, error) {
+	var out models.WalletLedgerEntry
+	if err := m.coll.FindOne(ctx, bson.M{"reference": reference}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWalletEntryNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoWalletEntryStore) Settle(ctx context.Context, id primitive.ObjectID, status models.LedgerStatus) error {
+	res, err := m.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.LedgerPending},
+		bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		n, err := m.coll.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrWalletEntryNotFound
+		}
+		return ErrWalletEntrySettled
+	}
+	return nil
+}
+
+func (m *MongoWalletEntryStore) ListPending(ctx context.Context, cutoff time.Time, limit int) ([]models.WalletLedgerEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return m.find(ctx, bson.M{
+		"status":       models.LedgerPending,
+		"created_at":   bson.M{"$lt": cutoff},
+		"needs_review": bson.M{"$ne": true},
+		"$or": bson.A{
+			bson.M{"next_reconcile_at": nil},
+			bson.M{"next_reconcile_at": bson.M{"$lte": time.Now()}},
+		},
+	}, opts)
+}
+
+func (m *MongoWalletEntryStore) DeferReconcile(ctx context.Context, id primitive.ObjectID, attempts int, next *time.Time) error {
+	set := bson.M{"reconcile_attempts": attempts, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if next != nil {
+		set["next_reconcile_at"] = *next
+	} else {
+		set["needs_review"] = true
+		update["$unset"] = bson.M{"next_reconcile_at": ""}
+	}
+	res, err := m.coll.UpdateOne(ctx, bson.M{"_id": id, "status": models.LedgerPending}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		n, err := m.coll.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrWalletEntryNotFound
+		}
+		return ErrWalletEntrySettled
+	}
+	return nil
+}
+
+func (m *MongoWalletEntryStore) ListCreatedBetween(ctx context.Context, from, to time.Time) ([]models.WalletLedgerEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	return m.find(ctx, bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}, opts)
+}
+
+func (m *MongoWalletEntryStore) ListByUser(ctx context.Context, q database.LedgerQuery) ([]models.WalletLedgerEntry, error) {
+	filter := bson.M{"user_id": q.UserID}
+	if len(q.Types) > 0 {
+		filter["type"] = bson.M{"$in": q.Types}
+	}
+	if len(q.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": q.Statuses}
+	}
+	if q.Currency != "" {
+		filter["currency"] = q.Currency
+	}
+	created := bson.M{}
+	if !q.From.IsZero() {
+		created["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		created["$lt"] = q.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	if q.Before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": q.Before.CreatedAt}},
+			bson.M{"created_at": q.Before.CreatedAt, "_id": bson.M{"$lt": q.Before.ID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+	return m.find(ctx, filter, opts)
+}
+
+func (m *MongoWalletEntryStore) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.WalletLedgerEntry, error) {
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.WalletLedgerEntry
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidHistoryCursor = errors.New("invalid history cursor")
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// HistoryFilter narrows a wallet history listing; empty fields do not filter.
+// Status completed lists ledger transactions only, pending and failed list the
+// mobile money operations that have not settled.
+type HistoryFilter struct {
+	Types    []models.LedgerType
+	Status   models.LedgerStatus
+	Currency string
+	From     time.Time
+	To       time.Time // exclusive
+	Cursor   string
+	Limit    int
+}
+
+// historyRow is one ledger transaction or intent with the items it lists
+type historyRow struct {
+	at    time.Time
+	id    primitive.ObjectID
+	items []models.WalletHistoryItem
+}
+
+// History returns one newest-first page of the user's wallet history. Pass the
+// page's NextCursor back to continue after its last row.
+func (s *WalletLedgerService) History(ctx context.Context, userID primitive.ObjectID, f HistoryFilter) (*models.WalletHistoryPage, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	q := database.LedgerQuery{UserID: userID, Types: f.Types, From: f.From, To: f.To, Limit: limit + 1}
+	if f.Currency != "" {
+		currency, ok := models.NormalizeCurrency(f.Currency)
+		if !ok {
+			return nil, models.ErrUnsupportedCurrency
+		}
+		q.Currency = currency
+	}
+	if f.Cursor != "" {
+		before, err := decodeHistoryCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Before = before
+	}
+
+	var rows []historyRow
+	if f.Status == "" || f.Status == models.LedgerCompleted {
+		txs, err := s.repo.ListUserLedgerTransactions(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for i := range txs {
+			rows = append(rows, historyRow{at: txs[i].CreatedAt, id: txs[i].ID, items: historyItems(&txs[i], userID, q.Currency)})
+		}
+	}
+	if f.Status != models.LedgerCompleted {
+		// Settled intents already appear as ledger transactions
+		q.Statuses = []models.LedgerStatus{models.LedgerPending, models.LedgerFailed}
+		if f.Status != "" {
+			q.Statuses = []models.LedgerStatus{f.Status}
+		}
+		entries, err := s.entries.ListByUser(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			rows = append(rows, historyRow{at: e.CreatedAt, id: e.ID, items: []models.WalletHistoryItem{{
+				ID:        e.ID,
+				Type:      e.Type,
+				Direction: e.Direction,
+				Amount:    roundMinor(e.Amount),
+				Currency:  e.Currency,
+				Status:    e.Status,
+				Reference: e.Reference,
+				CreatedAt: e.CreatedAt,
+			}}})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].at.Equal(rows[j].at) {
+			return rows[i].at.After(rows[j].at)
+		}
+		return rows[i].id.Hex() > rows[j].id.Hex()
+	})
+	page := &models.WalletHistoryPage{Items: []models.WalletHistoryItem{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		page.NextCursor = encodeHistoryCursor(last.at, last.id)
+	}
+	for _, row := range rows {
+		page.Items = append(page.Items, row.items...)
+	}
+	return page, nil
+}
+
+// historyItems lists what a transaction did to the user's wallet in each
+// currency: the change to their available balance, or to the funds they hold
+// in escrow when the available balance did not move
+func historyItems(tx *models.LedgerTransaction, userID primitive.ObjectID, currency string) []models.WalletHistoryItem {
+	type movement struct{ available, held float64 }
+	moves := map[string]*movement{}
+	var order []string
+	for _, p := range tx.Postings {
+		if p.UserID != userID || (currency != "" && p.Currency != currency) {
+			continue
+		}
+		m, ok := moves[p.Currency]
+		if !ok {
+			m = &movement{}
+			moves[p.Currency] = m
+			order = append(order, p.Currency)
+		}
+		amount := p.Amount
+		if p.Direction == models.LedgerDebit {
+			amount = -amount
+		}
+		if p.Kind == models.AccountUserEscrow {
+			m.held += amount
+		} else {
+			m.available += amount
+		}
+	}
+	var items []models.WalletHistoryItem
+	for _, cur := range order {
+		net := roundMinor(moves[cur].available)
+		if net == 0 {
+			net = roundMinor(moves[cur].held)
+		}
+		if net == 0 {
+			continue
+		}
+		direction := models.LedgerCredit
+		if net < 0 {
+			direction, net = models.LedgerDebit, -net
+		}
+		items = append(items, models.WalletHistoryItem{
+			ID:          tx.ID,
+			Type:        tx.Type,
+			Direction:   direction,
+			Amount:      net,
+			Currency:    cur,
+			Status:      models.LedgerCompleted,
+			Reference:   tx.Reference,
+			Description: tx.Description,
+			CreatedAt:   tx.CreatedAt,
+		})
+	}
+	return items
+}
+
+func encodeHistoryCursor(at time.Time, id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", at.UnixNano(), id.Hex())))
+}
+
+func decodeHistoryCursor(cursor string) (*database.LedgerCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidHistoryCursor
+	}
+	nanos, hex, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidHistoryCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidHistoryCursor
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, ErrInvalidHistoryCursor
+	}
+	return &database.LedgerCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// Statement lists the movements of the user's available balance in currency
+// (the wallet's own when empty) over [from, to), with the opening and closing
+// balances taken from the ledger
+func (s *WalletLedgerService) Statement(ctx context.Context, userID primitive.ObjectID, currency string, from, to time.Time) (*models.WalletStatement, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = walletCurrency(user)
+	}
+	currency, ok := models.NormalizeCurrency(currency)
+	if !ok {
+		return nil, models.ErrUnsupportedCurrency
+	}
+	available := models.UserAvailableAccount(userID).Key()
+	opening, err := s.repo.GetLedgerCurrencyBalancesBefore(ctx, []string{available}, from)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := s.repo.GetUserLedgerTransactionsBetween(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Email
+	}
+	st := &models.WalletStatement{
+		UserID:         userID,
+		AccountName:    name,
+		Currency:       currency,
+		From:           from,
+		To:             to,
+		OpeningBalance: roundMinor(opening[available][currency]),
+		Lines:          []models.WalletStatementLine{},
+		GeneratedAt:    time.Now().UTC(),
+	}
+	balance := st.OpeningBalance
+	for i := range txs {
+		tx := &txs[i]
+		var delta float64
+		for _, p := range tx.Postings {
+			if p.Account != available || p.Currency != currency {
+				continue
+			}
+			if p.Direction == models.LedgerCredit {
+				delta += p.Amount
+			} else {
+				delta -= p.Amount
+			}
+		}
+		delta = roundMinor(delta)
+		if delta == 0 {
+			continue
+		}
+		line := models.WalletStatementLine{Date: tx.CreatedAt, Type: tx.Type, Reference: tx.Reference, Description: tx.Description}
+		if delta > 0 {
+			line.Credit = delta
+			st.TotalCredits = roundMinor(st.TotalCredits + delta)
+		} else {
+			line.Debit = -delta
+			st.TotalDebits = roundMinor(st.TotalDebits - delta)
+		}
+		balance = roundMinor(balance + delta)
+		line.Balance = balance
+		st.Lines = append(st.Lines, line)
+	}
+	st.ClosingBalance = balance
+	return st, nil
+}
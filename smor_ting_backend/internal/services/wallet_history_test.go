@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+func TestHistory_PaginatesLedgerAndUnsettledIntents(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	ctx := context.TODO()
+	u := &models.User{Email: "history@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, u)
+
+	for i, amount := range []float64{10, 20, 30, 40} {
+		_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: amount, Status: models.LedgerCompleted, Reference: "topup-" + string(rune('a'+i))})
+	}
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 500, Currency: "LRD", Status: models.LedgerCompleted, Reference: "topup-lrd"})
+	_ = ledger.RecordIntent(ctx, &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerWithdraw, Direction: models.LedgerDebit, Amount: 15, Reference: "withdraw-1"})
+	failed := &models.WalletLedgerEntry{UserID: u.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 99, Reference: "topup-failed"}
+	_ = ledger.RecordIntent(ctx, failed)
+	_ = ledger.SettleIntent(ctx, failed, models.LedgerFailed)
+
+	var all []models.WalletHistoryItem
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := ledger.History(ctx, u.ID, services.HistoryFilter{Limit: 3, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("history: %v", err)
+		}
+		all = append(all, page.Items...)
+		if page.NextCursor == "" {
+			if pages != 2 {
+				t.Fatalf("expected 7 rows over 3 pages, got %d pages", pages+1)
+			}
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(all) != 7 {
+		t.Fatalf("expected 7 items, got %d: %+v", len(all), all)
+	}
+	seen := map[string]bool{}
+	for i, item := range all {
+		if seen[item.ID.Hex()] {
+			t.Fatalf("item %s listed twice", item.ID.Hex())
+		}
+		seen[item.ID.Hex()] = true
+		if i > 0 && item.CreatedAt.After(all[i-1].CreatedAt) {
+			t.Fatalf("history must be newest first")
+		}
+	}
+
+	pending, _ := ledger.History(ctx, u.ID, services.HistoryFilter{Status: models.LedgerPending})
+	if len(pending.Items) != 1 || pending.Items[0].Reference != "withdraw-1" || pending.Items[0].Direction != models.LedgerDebit {
+		t.Fatalf("expected the pending withdrawal only, got %+v", pending.Items)
+	}
+	lrd, _ := ledger.History(ctx, u.ID, services.HistoryFilter{Currency: "lrd"})
+	if len(lrd.Items) != 1 || lrd.Items[0].Amount != 500 {
+		t.Fatalf("expected the LRD top-up only, got %+v", lrd.Items)
+	}
+	completed, _ := ledger.History(ctx, u.ID, services.HistoryFilter{Status: models.LedgerCompleted, Types: []models.LedgerType{models.LedgerTopup}, Currency: "USD"})
+	if len(completed.Items) != 4 {
+		t.Fatalf("expected 4 settled USD top-ups, got %+v", completed.Items)
+	}
+	if _, err := ledger.History(ctx, u.ID, services.HistoryFilter{Cursor: "not-a-cursor"}); err != services.ErrInvalidHistoryCursor {
+		t.Fatalf("expected an invalid cursor error, got %v", err)
+	}
+}
+
+func TestStatement_OpeningAndClosingBalancesFromLedger(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	ctx := context.TODO()
+	u := &models.User{Email: "statement@example.com", FirstName: "Musu", LastName: "Kollie", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, u)
+
+	post := func(day string, typ models.LedgerType, amount float64) {
+		at, _ := time.Parse("2006-01-02", day)
+		tx := &models.LedgerTransaction{Type: typ, Reference: string(typ) + "-" + day, CreatedAt: at.Add(10 * time.Hour)}
+		if typ == models.LedgerTopup {
+			tx.Debit(models.MomoClearingAccount, amount, "USD").Credit(models.UserAvailableAccount(u.ID), amount, "USD")
+		} else {
+			tx.Debit(models.UserAvailableAccount(u.ID), amount, "USD").Credit(models.MomoClearingAccount, amount, "USD")
+		}
+		if err := ledger.Post(ctx, tx); err != nil {
+			t.Fatalf("post: %v", err)
+		}
+	}
+	post("2026-01-15", models.LedgerTopup, 100)
+	post("2026-02-03", models.LedgerTopup, 50)
+	post("2026-02-10", models.LedgerWithdraw, 30)
+	post("2026-03-01", models.LedgerTopup, 5)
+
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	st, err := ledger.Statement(ctx, u.ID, "", from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if st.OpeningBalance != 100 || st.TotalCredits != 50 || st.TotalDebits != 30 || st.ClosingBalance != 120 || len(st.Lines) != 2 {
+		t.Fatalf("unexpected statement: %+v", st)
+	}
+	if st.Lines[1].Balance != 120 || st.Lines[1].Debit != 30 {
+		t.Fatalf("unexpected running balance: %+v", st.Lines)
+	}
+
+	var csv bytes.Buffer
+	if err := services.WriteStatementCSV(&csv, st); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(rows) != 5 || !strings.HasPrefix(rows[1], "2026-02-01,opening_balance") || !strings.Contains(rows[4], "closing_balance,,,50.00,30.00,120.00,USD") {
+		t.Fatalf("unexpected csv:\n%s", csv.String())
+	}
+	var pdf bytes.Buffer
+	if err := services.WriteStatementPDF(&pdf, st); err != nil {
+		t.Fatalf("pdf: %v", err)
+	}
+	if !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-1.4")) || !bytes.Contains(pdf.Bytes(), []byte("Closing balance: USD 120.00")) || !bytes.HasSuffix(pdf.Bytes(), []byte("%%EOF\n")) {
+		t.Fatalf("unexpected pdf:\n%s", pdf.String())
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrLedgerArchiveUnavailable is returned when no encrypted ledger archive is attached
+var ErrLedgerArchiveUnavailable = errors.New("encrypted ledger archive not configured")
+
+// ArchivedEntry returns a decrypted entry from the encrypted archive
+func (s *WalletLedgerService) ArchivedEntry(ctx context.Context, id primitive.ObjectID) (*models.WalletLedgerEntry, error) {
+	if s.secure == nil {
+		return nil, ErrLedgerArchiveUnavailable
+	}
+	return s.secure.Get(ctx, id)
+}
+
+// ArchivedEntries returns the user's decrypted entries from the encrypted archive, oldest first
+func (s *WalletLedgerService) ArchivedEntries(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletLedgerEntry, error) {
+	if s.secure == nil {
+		return nil, ErrLedgerArchiveUnavailable
+	}
+	return s.secure.List(ctx, userID, limit)
+}
+
+// VerifyArchive checks the encrypted archive for userID, or for every user when
+// zero. Each record must decrypt and its metadata columns must match the payload
+// (tampered), and every ledger transaction RecordEntry posted must have an
+// archived entry (missing). Entries that never posted, such as pending or failed
+// ones, can only be checked for tampering.
+func (s *WalletLedgerService) VerifyArchive(ctx context.Context, userID primitive.ObjectID) (*models.LedgerIntegrityReport, error) {
+	if s.secure == nil {
+		return nil, ErrLedgerArchiveUnavailable
+	}
+	records, err := s.secure.records.List(ctx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.LedgerIntegrityReport{Records: len(records), Issues: []models.LedgerIntegrityIssue{}}
+	archived := map[string]bool{}
+	users := map[primitive.ObjectID]bool{}
+	for i := range records {
+		rec := &records[i]
+		users[rec.UserID] = true
+		entry, issue := s.secure.open(rec)
+		if issue != nil {
+			report.Tampered++
+			report.Issues = append(report.Issues, *issue)
+			continue
+		}
+		archived[entryIdempotencyKey(entry.Type, entry.Reference, entry.UserID)] = true
+	}
+
+	if userID.IsZero() {
+		for _, role := range []models.UserRole{models.CustomerRole, models.ProviderRole, models.AdminRole} {
+			list, err := s.repo.GetUsersByRole(ctx, role)
+			if err != nil {
+				return nil, err
+			}
+			for _, u := range list {
+				users[u.ID] = true
+			}
+		}
+	} else {
+		users = map[primitive.ObjectID]bool{userID: true}
+	}
+	for id := range users {
+		txs, err := s.repo.ListUserLedgerTransactions(ctx, database.LedgerQuery{UserID: id})
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range txs {
+			key := entryIdempotencyKey(tx.Type, tx.Reference, id)
+			if tx.Reference == "" || tx.IdempotencyKey != key {
+				continue // not posted by RecordEntry, or posted for another user
+			}
+			report.Transactions++
+			if !archived[key] {
+				report.Missing++
+				report.Issues = append(report.Issues, models.LedgerIntegrityIssue{
+					Problem:   models.LedgerRecordMissing,
+					RecordID:  tx.ID,
+					UserID:    id,
+					Type:      tx.Type,
+					Reference: tx.Reference,
+				})
+			}
+		}
+	}
+	report.CheckedAt = time.Now()
+	return report, nil
+}
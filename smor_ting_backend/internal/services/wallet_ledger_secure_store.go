@@ -3,24 +3,89 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/smorting/backend/internal/models"
 	"github.com/smorting/backend/pkg/logger"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrSecureLedgerRecordNotFound = errors.New("archived ledger entry not found")
+	// ErrLedgerRecordTampered is returned when an archived entry cannot be decrypted
+	// or its metadata columns disagree with the encrypted payload
+	ErrLedgerRecordTampered = errors.New("archived ledger entry failed integrity check")
+)
+
+// SecureLedgerRecordStore holds the encrypted ledger archive
+type SecureLedgerRecordStore interface {
+	Insert(ctx context.Context, rec *models.SecureLedgerRecord) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.SecureLedgerRecord, error)
+	// List returns the user's records (every user's when userID is zero), oldest first; limit <= 0 means all
+	List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.SecureLedgerRecord, error)
+}
+
+// In-memory implementation for tests/dev
+type memorySecureLedgerRecordStore struct {
+	mu      sync.RWMutex
+	records []models.SecureLedgerRecord
+}
+
+func NewMemorySecureLedgerRecordStore() SecureLedgerRecordStore {
+	return &memorySecureLedgerRecordStore{}
+}
+
+func (m *memorySecureLedgerRecordStore) Insert(ctx context.Context, rec *models.SecureLedgerRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec.ID.IsZero() {
+		rec.ID = primitive.NewObjectID()
+	}
+	m.records = append(m.records, *rec)
+	return nil
+}
+
+func (m *memorySecureLedgerRecordStore) Get(ctx context.Context, id primitive.ObjectID) (*models.SecureLedgerRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, rec := range m.records {
+		if rec.ID == id {
+			return &rec, nil
+		}
+	}
+	return nil, ErrSecureLedgerRecordNotFound
+}
+
+func (m *memorySecureLedgerRecordStore) List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.SecureLedgerRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.SecureLedgerRecord
+	for _, rec := range m.records {
+		if userID.IsZero() || rec.UserID == userID {
+			out = append(out, rec)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
 // WalletLedgerSecureStore persists wallet ledger entries with encryption-at-rest.
 // MongoDB Atlas is the system of record.
 type WalletLedgerSecureStore struct {
-	coll   *mongo.Collection
-	enc    *EncryptionService
-	logger *logger.Logger
+	records SecureLedgerRecordStore
+	enc     *EncryptionService
+	logger  *logger.Logger
 }
 
-func NewWalletLedgerSecureStore(db *mongo.Database, enc *EncryptionService, logger *logger.Logger) *WalletLedgerSecureStore {
-	return &WalletLedgerSecureStore{coll: db.Collection("wallet_ledger"), enc: enc, logger: logger}
+func NewWalletLedgerSecureStore(records SecureLedgerRecordStore, enc *EncryptionService, logger *logger.Logger) *WalletLedgerSecureStore {
+	return &WalletLedgerSecureStore{records: records, enc: enc, logger: logger}
 }
 
 // EncryptLedgerEntryForStorage serializes and encrypts a ledger entry for storage
@@ -41,20 +106,110 @@ func (s *WalletLedgerSecureStore) SaveEncrypted(ctx context.Context, entry *mode
 	if err != nil {
 		return err
 	}
-	doc := bson.M{
-		"user_id":      entry.UserID,
-		"type":         entry.Type,
-		"direction":    entry.Direction,
-		"amount":       entry.Amount,
-		"currency":     entry.Currency,
-		"status":       entry.Status,
-		"is_escrow":    entry.IsEscrow,
-		"reference":    entry.Reference,
-		"provider_ref": entry.ProviderRef,
-		"created_at":   entry.CreatedAt,
-		"updated_at":   entry.UpdatedAt,
-		"encrypted":    cipher,
-	}
-	_, err = s.coll.InsertOne(ctx, doc)
-	return err
+	return s.records.Insert(ctx, &models.SecureLedgerRecord{
+		ID:          entry.ID,
+		UserID:      entry.UserID,
+		Type:        entry.Type,
+		Direction:   entry.Direction,
+		Amount:      entry.Amount,
+		Currency:    entry.Currency,
+		Status:      entry.Status,
+		IsEscrow:    entry.IsEscrow,
+		Reference:   entry.Reference,
+		ProviderRef: entry.ProviderRef,
+		CreatedAt:   entry.CreatedAt,
+		UpdatedAt:   entry.UpdatedAt,
+		Encrypted:   cipher,
+	})
+}
+
+// Get decrypts the archived entry with the given ID. An entry that fails its
+// integrity check is not returned; the error wraps ErrLedgerRecordTampered.
+func (s *WalletLedgerSecureStore) Get(ctx context.Context, id primitive.ObjectID) (*models.WalletLedgerEntry, error) {
+	rec, err := s.records.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	entry, issue := s.open(rec)
+	if issue != nil {
+		return nil, tamperedError(issue)
+	}
+	return entry, nil
+}
+
+// List decrypts the user's archived entries, oldest first; limit <= 0 means all.
+// It stops at the first entry that fails its integrity check.
+func (s *WalletLedgerSecureStore) List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.WalletLedgerEntry, error) {
+	recs, err := s.records.List(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.WalletLedgerEntry, 0, len(recs))
+	for i := range recs {
+		entry, issue := s.open(&recs[i])
+		if issue != nil {
+			return nil, tamperedError(issue)
+		}
+		out = append(out, *entry)
+	}
+	return out, nil
+}
+
+// open decrypts a record and checks its metadata columns against the payload
+func (s *WalletLedgerSecureStore) open(rec *models.SecureLedgerRecord) (*models.WalletLedgerEntry, *models.LedgerIntegrityIssue) {
+	issue := &models.LedgerIntegrityIssue{
+		RecordID:  rec.ID,
+		UserID:    rec.UserID,
+		Type:      rec.Type,
+		Reference: rec.Reference,
+	}
+	raw, err := s.enc.Decrypt(rec.Encrypted)
+	if err != nil {
+		issue.Problem = models.LedgerRecordUndecryptable
+		return nil, issue
+	}
+	var entry models.WalletLedgerEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		issue.Problem = models.LedgerRecordUndecryptable
+		return nil, issue
+	}
+	if fields := ledgerRecordMismatches(rec, &entry); len(fields) > 0 {
+		issue.Problem = models.LedgerRecordMismatch
+		issue.Fields = fields
+		return nil, issue
+	}
+	return &entry, nil
+}
+
+// ledgerRecordMismatches names the metadata columns that differ from the decrypted entry.
+// Timestamps are compared to the millisecond, the precision MongoDB stores.
+func ledgerRecordMismatches(rec *models.SecureLedgerRecord, entry *models.WalletLedgerEntry) []string {
+	sameTime := func(a, b time.Time) bool {
+		return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+	}
+	var fields []string
+	check := func(name string, same bool) {
+		if !same {
+			fields = append(fields, name)
+		}
+	}
+	check("user_id", rec.UserID == entry.UserID)
+	check("type", rec.Type == entry.Type)
+	check("direction", rec.Direction == entry.Direction)
+	check("amount", rec.Amount == entry.Amount)
+	check("currency", rec.Currency == entry.Currency)
+	check("status", rec.Status == entry.Status)
+	check("is_escrow", rec.IsEscrow == entry.IsEscrow)
+	check("reference", rec.Reference == entry.Reference)
+	check("provider_ref", rec.ProviderRef == entry.ProviderRef)
+	check("created_at", sameTime(rec.CreatedAt, entry.CreatedAt))
+	check("updated_at", sameTime(rec.UpdatedAt, entry.UpdatedAt))
+	return fields
+}
+
+func tamperedError(issue *models.LedgerIntegrityIssue) error {
+	if issue.Problem == models.LedgerRecordMismatch {
+		return fmt.Errorf("%w: record %s: %s differ from payload", ErrLedgerRecordTampered, issue.RecordID.Hex(), issue.Fields)
+	}
+	return fmt.Errorf("%w: record %s is %s", ErrLedgerRecordTampered, issue.RecordID.Hex(), issue.Problem)
 }
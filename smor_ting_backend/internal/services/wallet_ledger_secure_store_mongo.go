@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoSecureLedgerRecordStore keeps the encrypted ledger archive in the wallet_ledger collection
+type MongoSecureLedgerRecordStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoSecureLedgerRecordStore(db *mongo.Database, logger *logger.Logger) (*MongoSecureLedgerRecordStore, error) {
+	s := &MongoSecureLedgerRecordStore{coll: db.Collection("wallet_ledger"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "reference", Value: 1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoSecureLedgerRecordStore) Insert(ctx context.Context, rec *models.SecureLedgerRecord) error {
+	if rec.ID.IsZero() {
+		rec.ID = primitive.NewObjectID()
+	}
+	_, err := m.coll.InsertOne(ctx, rec)
+	return err
+}
+
+func (m *MongoSecureLedgerRecordStore) Get(ctx context.Context, id primitive.ObjectID) (*models.SecureLedgerRecord, error) {
+	var out models.SecureLedgerRecord
+	if err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSecureLedgerRecordNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoSecureLedgerRecordStore) List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.SecureLedgerRecord, error) {
+	filter := bson.M{}
+	if !userID.IsZero() {
+		filter["user_id"] = userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.SecureLedgerRecord
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -3,10 +3,14 @@ package services_test
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/smorting/backend/internal/database"
 	"github.com/smorting/backend/internal/models"
 	"github.com/smorting/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestMongoWalletLedgerSecureStore_SavesEncrypted(t *testing.T) {
@@ -39,3 +43,124 @@ func (f *fakeSecureStore) SaveEncrypted(ctx context.Context, entry *models.Walle
 	f.saved++
 	return nil
 }
+
+// editableArchive is an in-memory archive whose records the test can tamper with or delete
+type editableArchive struct {
+	services.SecureLedgerRecordStore
+	records []*models.SecureLedgerRecord
+	failing bool
+}
+
+func (a *editableArchive) Insert(ctx context.Context, rec *models.SecureLedgerRecord) error {
+	if a.failing {
+		return errors.New("atlas unavailable")
+	}
+	copied := *rec
+	a.records = append(a.records, &copied)
+	return nil
+}
+
+func (a *editableArchive) Get(ctx context.Context, id primitive.ObjectID) (*models.SecureLedgerRecord, error) {
+	for _, rec := range a.records {
+		if rec.ID == id {
+			copied := *rec
+			return &copied, nil
+		}
+	}
+	return nil, services.ErrSecureLedgerRecordNotFound
+}
+
+func (a *editableArchive) List(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.SecureLedgerRecord, error) {
+	var out []models.SecureLedgerRecord
+	for _, rec := range a.records {
+		if userID.IsZero() || rec.UserID == userID {
+			out = append(out, *rec)
+		}
+	}
+	return out, nil
+}
+
+func newArchivedLedger(t *testing.T) (*services.WalletLedgerService, *editableArchive, *database.MemoryDatabase) {
+	t.Helper()
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption init: %v", err)
+	}
+	repo := database.NewMemoryDatabase()
+	archive := &editableArchive{}
+	ledger := services.AttachSecureStore(services.NewWalletLedgerService(repo), services.NewWalletLedgerSecureStore(archive, enc, nil))
+	return ledger, archive, repo
+}
+
+func TestWalletLedgerArchive_DecryptsAndDetectsTamperedAndMissingEntries(t *testing.T) {
+	ledger, archive, repo := newArchivedLedger(t)
+	ctx := context.TODO()
+	user := &models.User{Email: "archive@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, user)
+	for i, amount := range []float64{50, 20, 5} {
+		err := ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit,
+			Amount: amount, Status: models.LedgerCompleted, Reference: fmt.Sprintf("topup-%d", i)})
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	entries, err := ledger.ArchivedEntries(ctx, user.ID, 0)
+	if err != nil || len(entries) != 3 || entries[1].Amount != 20 || entries[1].Reference != "topup-1" {
+		t.Fatalf("expected the three decrypted entries, got %+v, %v", entries, err)
+	}
+	report, err := ledger.VerifyArchive(ctx, primitive.NilObjectID)
+	if err != nil || !report.OK() || report.Records != 3 || report.Transactions != 3 {
+		t.Fatalf("expected a clean archive, got %+v, %v", report, err)
+	}
+
+	// Inflate one entry's queryable amount, corrupt another's payload and drop the third
+	archive.records[0].Amount = 5000
+	archive.records[1].Encrypted = archive.records[2].Encrypted[:len(archive.records[2].Encrypted)-4] + "AAAA"
+	tamperedID := archive.records[0].ID
+	archive.records = archive.records[:2]
+
+	if _, err := ledger.ArchivedEntry(ctx, tamperedID); !errors.Is(err, services.ErrLedgerRecordTampered) {
+		t.Fatalf("expected reading a tampered entry to fail, got %v", err)
+	}
+	report, err = ledger.VerifyArchive(ctx, user.ID)
+	if err != nil || report.OK() || report.Tampered != 2 || report.Missing != 3 {
+		t.Fatalf("expected 2 tampered and 3 unarchived transactions, got %+v, %v", report, err)
+	}
+	problems := map[models.LedgerIntegrityProblem]int{}
+	for _, issue := range report.Issues {
+		problems[issue.Problem]++
+		if issue.Problem == models.LedgerRecordMismatch && (len(issue.Fields) != 1 || issue.Fields[0] != "amount") {
+			t.Fatalf("expected only the amount to be flagged, got %v", issue.Fields)
+		}
+	}
+	if problems[models.LedgerRecordMismatch] != 1 || problems[models.LedgerRecordUndecryptable] != 1 || problems[models.LedgerRecordMissing] != 3 {
+		t.Fatalf("unexpected issues %+v", report.Issues)
+	}
+}
+
+func TestWalletLedgerArchive_SaveFailureIsNotPosted(t *testing.T) {
+	ledger, archive, repo := newArchivedLedger(t)
+	ctx := context.TODO()
+	user := &models.User{Email: "archive-down@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, user)
+
+	archive.failing = true
+	entry := &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 40, Status: models.LedgerCompleted, Reference: "topup-down"}
+	if err := ledger.RecordEntry(ctx, entry); err == nil {
+		t.Fatalf("expected the archive failure to be returned")
+	}
+	if bal, _ := ledger.ComputeBalances(ctx, user.ID); bal.Available != 0 {
+		t.Fatalf("an entry that was not archived must not be posted, got %.2f", bal.Available)
+	}
+
+	archive.failing = false
+	entry = &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: 40, Status: models.LedgerCompleted, Reference: "topup-down"}
+	if err := ledger.RecordEntry(ctx, entry); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if bal, _ := ledger.ComputeBalances(ctx, user.ID); bal.Available != 40 {
+		t.Fatalf("expected the retried entry to post, got %.2f", bal.Available)
+	}
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/smorting/backend/internal/database"
@@ -10,13 +12,15 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// WalletLedgerService records wallet movements in the double-entry ledger and derives balances from it
 type WalletLedgerService struct {
-	repo   database.Repository
-	secure *WalletLedgerSecureStore
+	repo    database.Repository
+	secure  *WalletLedgerSecureStore
+	entries WalletEntryStore
 }
 
 func NewWalletLedgerService(repo database.Repository) *WalletLedgerService {
-	return &WalletLedgerService{repo: repo}
+	return &WalletLedgerService{repo: repo, entries: NewMemoryWalletEntryStore()}
 }
 
 // AttachSecureStore wires an encrypted MongoDB Atlas-backed store
@@ -27,71 +31,273 @@ func AttachSecureStore(svc *WalletLedgerService, store *WalletLedgerSecureStore)
 	return svc
 }
 
-// RecordEntry persists a ledger entry. For memory repo we’ll extend with minimal support.
+// AttachEntryStore replaces the in-memory payment intent store
+func AttachEntryStore(svc *WalletLedgerService, store WalletEntryStore) *WalletLedgerService {
+	if svc != nil && store != nil {
+		svc.entries = store
+	}
+	return svc
+}
+
+// Entries exposes the payment intent store, e.g. for reconciliation
+func (s *WalletLedgerService) Entries() WalletEntryStore {
+	return s.entries
+}
+
+// RecordEntry translates a single-sided wallet entry, as reported by MoMo callbacks,
+// into a balanced ledger transaction. Entries that move no money yet (pending
+// top-ups, withdrawals and escrow holds, failures) are archived but not posted. Entries carrying
+// a Reference are idempotent: replaying the same type/reference/user is a no-op.
 func (s *WalletLedgerService) RecordEntry(ctx context.Context, entry *models.WalletLedgerEntry) error {
 	if entry == nil {
 		return errors.New("entry is nil")
 	}
+	user, err := s.repo.GetUserByID(ctx, entry.UserID)
+	if err != nil {
+		return err
+	}
+	if err := entryCurrency(user, entry); err != nil {
+		return err
+	}
 	entry.ID = primitive.NewObjectID()
 	entry.CreatedAt = time.Now()
 	entry.UpdatedAt = time.Now()
-	// Persist encrypted copy in system-of-record (Mongo) when available
+	// Persist encrypted copy in system-of-record (Mongo) when available; an entry
+	// that could not be archived is not posted, so the caller can retry it
 	if s.secure != nil {
-		_ = s.secure.SaveEncrypted(ctx, entry)
+		if err := s.secure.SaveEncrypted(ctx, entry); err != nil {
+			return fmt.Errorf("archive ledger entry: %w", err)
+		}
 	}
-	// For now, store as user wallet transaction shadow in memory; real impl should use dedicated collection
-	user, err := s.repo.GetUserByID(ctx, entry.UserID)
+
+	tx := ledgerTransactionForEntry(entry)
+	if tx == nil {
+		return nil
+	}
+	return s.Post(ctx, tx)
+}
+
+// RecordIntent persists a pending MoMo operation under its X-Reference-Id. It must
+// succeed before MoMo is called so that the callback can be matched to the user
+// (and booking) without trusting anything the callback claims.
+func (s *WalletLedgerService) RecordIntent(ctx context.Context, intent *models.WalletLedgerEntry) error {
+	if intent == nil || intent.Reference == "" || !isIntentType(intent.Type) {
+		return errors.New("intent needs a reference and a MoMo-backed type")
+	}
+	user, err := s.repo.GetUserByID(ctx, intent.UserID)
 	if err != nil {
 		return err
 	}
-	user.Wallet.Transactions = append(user.Wallet.Transactions, models.Transaction{
-		ID:          entry.ID,
-		Type:        string(entry.Type),
-		Amount:      entry.Amount,
-		Description: entry.ProviderRef,
+	if err := entryCurrency(user, intent); err != nil {
+		return err
+	}
+	intent.Status = models.LedgerPending
+	intent.CreatedAt = time.Now()
+	return s.entries.Create(ctx, intent)
+}
+
+// Intent returns the intent recorded for a MoMo reference
+func (s *WalletLedgerService) Intent(ctx context.Context, reference string) (*models.WalletLedgerEntry, error) {
+	return s.entries.GetByReference(ctx, reference)
+}
+
+// SettleIntent records MoMo's final status on a pending intent; settling twice is a no-op
+func (s *WalletLedgerService) SettleIntent(ctx context.Context, intent *models.WalletLedgerEntry, status models.LedgerStatus) error {
+	err := s.entries.Settle(ctx, intent.ID, status)
+	if errors.Is(err, ErrWalletEntrySettled) {
+		return nil
+	}
+	return err
+}
+
+// Post appends a balanced transaction to the ledger. A transaction whose
+// idempotency key has already been posted is treated as success.
+func (s *WalletLedgerService) Post(ctx context.Context, tx *models.LedgerTransaction) error {
+	err := s.repo.AppendLedgerTransaction(ctx, tx)
+	if errors.Is(err, database.ErrDuplicateLedgerTransaction) {
+		return nil
+	}
+	return err
+}
+
+// entryIdempotencyKey is the key of the transaction RecordEntry posts for a user's entry
+func entryIdempotencyKey(t models.LedgerType, reference string, userID primitive.ObjectID) string {
+	return fmt.Sprintf("%s:%s:%s", t, reference, userID.Hex())
+}
+
+// ledgerTransactionForEntry maps a wallet entry onto debit/credit legs, or nil when nothing has settled
+func ledgerTransactionForEntry(entry *models.WalletLedgerEntry) *models.LedgerTransaction {
+	if entry.Amount <= 0 || entry.Status == models.LedgerFailed {
+		return nil
+	}
+	user := entry.UserID
+	tx := &models.LedgerTransaction{
+		Type:        entry.Type,
 		Reference:   entry.Reference,
-		Status:      string(entry.Status),
+		ProviderRef: entry.ProviderRef,
 		CreatedAt:   entry.CreatedAt,
-	})
-	// Update wallet balance for completed entries
+	}
+	if entry.Reference != "" {
+		tx.IdempotencyKey = entryIdempotencyKey(entry.Type, entry.Reference, user)
+	}
+
 	switch entry.Type {
 	case models.LedgerTopup:
-		if entry.Status == models.LedgerCompleted && entry.Direction == models.LedgerCredit {
-			user.Wallet.Balance += entry.Amount
+		if entry.Status != models.LedgerCompleted || entry.Direction != models.LedgerCredit {
+			return nil
+		}
+		tx.Debit(models.MomoClearingAccount, entry.Amount, entry.Currency).
+			Credit(models.UserAvailableAccount(user), entry.Amount, entry.Currency)
+	case models.LedgerWithdraw, models.LedgerRefund, models.LedgerPayout:
+		if entry.Status != models.LedgerCompleted || entry.Direction != models.LedgerDebit {
+			return nil
 		}
-	case models.LedgerWithdraw:
-		if entry.Status == models.LedgerCompleted && entry.Direction == models.LedgerDebit {
-			user.Wallet.Balance -= entry.Amount
+		tx.Debit(models.UserAvailableAccount(user), entry.Amount, entry.Currency).
+			Credit(models.MomoClearingAccount, entry.Amount, entry.Currency)
+	case models.LedgerEscrowHold, models.LedgerPayment:
+		// Only collected money is held: a hold still awaiting its payer posts nothing
+		if entry.Status != models.LedgerHeld && entry.Status != models.LedgerCompleted {
+			return nil
 		}
-	case models.LedgerEscrowHold:
-		// pending held handled at compute-time; no immediate balance change
-	case models.LedgerEscrowRelease:
-		if entry.Status == models.LedgerCompleted {
-			user.Wallet.Balance += entry.Amount
-			// Mark corresponding escrow hold as completed to remove from pending
-			for i := range user.Wallet.Transactions {
-				tx := &user.Wallet.Transactions[i]
-				if tx.Type == string(models.LedgerEscrowHold) && tx.Reference == entry.Reference && tx.Status == string(models.LedgerPending) {
-					tx.Status = string(models.LedgerCompleted)
-				}
-			}
+		tx.Debit(models.MomoClearingAccount, entry.Amount, entry.Currency).
+			Credit(models.UserEscrowAccount(user), entry.Amount, entry.Currency)
+	case models.LedgerEscrowRelease, models.LedgerEscrowRefund:
+		if entry.Status != models.LedgerCompleted {
+			return nil
 		}
+		tx.Debit(models.UserEscrowAccount(user), entry.Amount, entry.Currency).
+			Credit(models.UserAvailableAccount(user), entry.Amount, entry.Currency)
+	default:
+		return nil
 	}
-	return s.repo.UpdateUser(ctx, user)
+	return tx
 }
 
+// ComputeBalances derives the user's available and held balances from ledger
+// sums, per currency in Currencies. The top-level figures sum every currency, as
+// they did before wallets held more than one, so existing clients still see
+// all their money; Currency is the wallet's own.
 func (s *WalletLedgerService) ComputeBalances(ctx context.Context, userID primitive.ObjectID) (*models.WalletBalances, error) {
 	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	var pending float64
-	// In a real impl we would query ledger entries; for demo use transactions' status and type
-	for _, tx := range user.Wallet.Transactions {
-		if tx.Status == string(models.LedgerPending) && (tx.Type == string(models.LedgerEscrowHold) || tx.Type == string(models.LedgerPayment)) {
-			pending += tx.Amount
+	available := models.UserAvailableAccount(userID).Key()
+	escrow := models.UserEscrowAccount(userID).Key()
+	sums, err := s.repo.GetLedgerCurrencyBalances(ctx, []string{available, escrow})
+	if err != nil {
+		return nil, err
+	}
+	primary := walletCurrency(user)
+	currencies := map[string]models.CurrencyBalance{primary: {}}
+	for _, account := range []string{available, escrow} {
+		for currency := range sums[account] {
+			currencies[currency] = models.CurrencyBalance{}
 		}
 	}
-	total := user.Wallet.Balance + pending
-	return &models.WalletBalances{Available: user.Wallet.Balance, PendingHeld: pending, Total: total, Currency: user.Wallet.Currency}, nil
+	var all models.CurrencyBalance
+	for currency := range currencies {
+		currencies[currency] = models.CurrencyBalance{
+			Available:   roundMinor(sums[available][currency]),
+			PendingHeld: roundMinor(sums[escrow][currency]),
+			Total:       roundMinor(sums[available][currency] + sums[escrow][currency]),
+		}
+		all.Available += sums[available][currency]
+		all.PendingHeld += sums[escrow][currency]
+	}
+	return &models.WalletBalances{
+		Available:   roundMinor(all.Available),
+		PendingHeld: roundMinor(all.PendingHeld),
+		Total:       roundMinor(all.Available + all.PendingHeld),
+		Currency:    primary,
+		Currencies:  currencies,
+	}, nil
+}
+
+// WithWalletLock runs fn under the user's wallet lock. Every debit checks what
+// is spendable and posts or reserves the money inside fn, using the ctx fn is
+// given, so concurrent debits of one wallet cannot overdraw it.
+func (s *WalletLedgerService) WithWalletLock(ctx context.Context, userID primitive.ObjectID, fn func(ctx context.Context) error) error {
+	return s.repo.WithWalletLock(ctx, userID, fn)
+}
+
+// Spendable is what the user can still spend in currency: the available
+// balance less the payouts on their way out of it
+func (s *WalletLedgerService) Spendable(ctx context.Context, userID primitive.ObjectID, currency string) (float64, error) {
+	bal, err := s.ComputeBalances(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := s.PendingPayouts(ctx, userID, currency)
+	if err != nil {
+		return 0, err
+	}
+	return roundMinor(bal.Currencies[currency].Available - pending), nil
+}
+
+// PendingPayouts sums the user's payouts in currency that the provider has not
+// settled yet: money still in the available balance but already on its way out
+func (s *WalletLedgerService) PendingPayouts(ctx context.Context, userID primitive.ObjectID, currency string) (float64, error) {
+	pending, err := s.entries.ListByUser(ctx, database.LedgerQuery{
+		UserID:   userID,
+		Types:    []models.LedgerType{models.LedgerWithdraw, models.LedgerRefund, models.LedgerPayout},
+		Statuses: []models.LedgerStatus{models.LedgerPending},
+		Currency: currency,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	for _, e := range pending {
+		sum += e.Amount
+	}
+	return roundMinor(sum), nil
+}
+
+// walletCurrency is the currency a user's wallet reports in by default
+func walletCurrency(user *models.User) string {
+	if currency, ok := models.NormalizeCurrency(user.Wallet.Currency); ok {
+		return currency
+	}
+	return models.DefaultCurrency
+}
+
+// entryCurrency checks the currency of a wallet entry, defaulting it to the wallet's own
+func entryCurrency(user *models.User, entry *models.WalletLedgerEntry) error {
+	if entry.Currency == "" {
+		entry.Currency = walletCurrency(user)
+		return nil
+	}
+	currency, ok := models.NormalizeCurrency(entry.Currency)
+	if !ok {
+		return models.ErrUnsupportedCurrency
+	}
+	entry.Currency = currency
+	return nil
+}
+
+// RecentTransactions returns the newest ledger transactions touching the user's accounts
+func (s *WalletLedgerService) RecentTransactions(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.LedgerTransaction, error) {
+	return s.repo.GetUserLedgerTransactions(ctx, userID, limit)
+}
+
+// UserNet returns the signed effect of tx on the user's accounts (credits positive)
+func UserNet(tx *models.LedgerTransaction, userID primitive.ObjectID) float64 {
+	var net float64
+	for _, p := range tx.Postings {
+		if p.UserID != userID {
+			continue
+		}
+		if p.Direction == models.LedgerCredit {
+			net += p.Amount
+		} else {
+			net -= p.Amount
+		}
+	}
+	return roundMinor(net)
+}
+
+// roundMinor trims float noise from posting sums to two decimal places
+func roundMinor(v float64) float64 {
+	return math.Round(v*100) / 100
 }
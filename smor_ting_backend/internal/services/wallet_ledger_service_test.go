@@ -2,6 +2,7 @@ package services_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -38,7 +39,7 @@ func TestComputeBalances_AvailableAndPending(t *testing.T) {
 		Direction: models.LedgerCredit,
 		Amount:    200,
 		Currency:  "LRD",
-		Status:    models.LedgerPending,
+		Status:    models.LedgerHeld,
 		IsEscrow:  true,
 		CreatedAt: time.Now(),
 	})
@@ -51,3 +52,78 @@ func TestComputeBalances_AvailableAndPending(t *testing.T) {
 		t.Fatalf("unexpected balances: %+v", bal)
 	}
 }
+
+func TestRecordEntry_IdempotentOnReference(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	svc := services.NewWalletLedgerService(repo)
+	u := &models.User{Email: "idem@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), u)
+
+	topup := func() error {
+		return svc.RecordEntry(context.TODO(), &models.WalletLedgerEntry{
+			UserID:    u.ID,
+			Type:      models.LedgerTopup,
+			Direction: models.LedgerCredit,
+			Amount:    75,
+			Currency:  "USD",
+			Status:    models.LedgerCompleted,
+			Reference: "ref-1",
+		})
+	}
+	for i := 0; i < 3; i++ {
+		if err := topup(); err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+	}
+
+	bal, _ := svc.ComputeBalances(context.TODO(), u.ID)
+	if bal.Available != 75 {
+		t.Fatalf("replayed callback credited more than once: %+v", bal)
+	}
+	txs, _ := svc.RecentTransactions(context.TODO(), u.ID, 10)
+	if len(txs) != 1 || services.UserNet(&txs[0], u.ID) != 75 {
+		t.Fatalf("expected a single posted transaction, got %+v", txs)
+	}
+}
+
+func TestPost_RejectsUnbalancedTransaction(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	svc := services.NewWalletLedgerService(repo)
+	u := &models.User{Email: "unbalanced@example.com"}
+	_ = repo.CreateUser(context.TODO(), u)
+
+	tx := (&models.LedgerTransaction{Type: models.LedgerTopup}).
+		Debit(models.MomoClearingAccount, 50, "USD").
+		Credit(models.UserAvailableAccount(u.ID), 40, "USD")
+	if err := svc.Post(context.TODO(), tx); !errors.Is(err, models.ErrLedgerUnbalanced) {
+		t.Fatalf("expected unbalanced error, got %v", err)
+	}
+	if bal, _ := svc.ComputeBalances(context.TODO(), u.ID); bal.Available != 0 {
+		t.Fatalf("unbalanced transaction must not move funds: %+v", bal)
+	}
+}
+
+func TestRecordEntry_OnlyConfirmedHoldsAreHeld(t *testing.T) {
+	repo := database.NewMemoryDatabase()
+	svc := services.NewWalletLedgerService(repo)
+	u := &models.User{Email: "hold@example.com", Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(context.TODO(), u)
+
+	hold := func(status models.LedgerStatus) {
+		t.Helper()
+		err := svc.RecordEntry(context.TODO(), &models.WalletLedgerEntry{
+			UserID: u.ID, Type: models.LedgerEscrowHold, Direction: models.LedgerCredit, Amount: 60, Currency: "USD", Status: status, IsEscrow: true, Reference: "hold-1",
+		})
+		if err != nil {
+			t.Fatalf("record %s hold: %v", status, err)
+		}
+	}
+	hold(models.LedgerPending)
+	if bal, _ := svc.ComputeBalances(context.TODO(), u.ID); bal.PendingHeld != 0 {
+		t.Fatalf("a hold awaiting its payer must not be held yet: %+v", bal)
+	}
+	hold(models.LedgerHeld)
+	if bal, _ := svc.ComputeBalances(context.TODO(), u.ID); bal.PendingHeld != 60 || bal.Available != 0 {
+		t.Fatalf("a confirmed hold should be held: %+v", bal)
+	}
+}
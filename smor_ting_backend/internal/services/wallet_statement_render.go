@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/smorting/backend/internal/models"
+)
+
+// WriteStatementCSV renders a statement as CSV: one row per movement between
+// opening and closing balance rows
+func WriteStatementCSV(w io.Writer, st *models.WalletStatement) error {
+	out := csv.NewWriter(w)
+	money := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	rows := [][]string{
+		{"date", "type", "reference", "description", "credit", "debit", "balance", "currency"},
+		{st.From.Format("2006-01-02"), "opening_balance", "", "", "", "", strconv.FormatFloat(st.OpeningBalance, 'f', 2, 64), st.Currency},
+	}
+	for _, l := range st.Lines {
+		rows = append(rows, []string{
+			l.Date.UTC().Format("2006-01-02 15:04:05"), string(l.Type), l.Reference, l.Description,
+			money(l.Credit), money(l.Debit), strconv.FormatFloat(l.Balance, 'f', 2, 64), st.Currency,
+		})
+	}
+	rows = append(rows, []string{
+		statementLastDay(st), "closing_balance", "", "",
+		strconv.FormatFloat(st.TotalCredits, 'f', 2, 64), strconv.FormatFloat(st.TotalDebits, 'f', 2, 64),
+		strconv.FormatFloat(st.ClosingBalance, 'f', 2, 64), st.Currency,
+	})
+	if err := out.WriteAll(rows); err != nil {
+		return err
+	}
+	return out.Error()
+}
+
+// statementLastDay is the last day a statement covers; To itself is excluded
+func statementLastDay(st *models.WalletStatement) string {
+	return st.To.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+const (
+	pdfLinesPerPage = 60
+	pdfLineWidth    = 86
+)
+
+// WriteStatementPDF renders a statement as a plain, fixed-width PDF (A4, Courier)
+func WriteStatementPDF(w io.Writer, st *models.WalletStatement) error {
+	row := func(date, kind, details, credit, debit, balance string) string {
+		return fmt.Sprintf("%-10s %-14s %-20s %12s %12s %12s", date, clip(kind, 14), clip(details, 20), credit, debit, balance)
+	}
+	money := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	lines := []string{
+		"Smor-Ting wallet statement",
+		"",
+		"Account:  " + st.AccountName,
+		"Currency: " + st.Currency,
+		"Period:   " + st.From.Format("2006-01-02") + " to " + statementLastDay(st),
+		"",
+		fmt.Sprintf("Opening balance: %s %.2f", st.Currency, st.OpeningBalance),
+		fmt.Sprintf("Total credits:   %s %.2f", st.Currency, st.TotalCredits),
+		fmt.Sprintf("Total debits:    %s %.2f", st.Currency, st.TotalDebits),
+		fmt.Sprintf("Closing balance: %s %.2f", st.Currency, st.ClosingBalance),
+		"",
+		row("Date", "Type", "Details", "Credit", "Debit", "Balance"),
+		strings.Repeat("-", pdfLineWidth),
+	}
+	for _, l := range st.Lines {
+		details := l.Description
+		if details == "" {
+			details = l.Reference
+		}
+		lines = append(lines, row(l.Date.UTC().Format("2006-01-02"), string(l.Type), details, money(l.Credit), money(l.Debit), strconv.FormatFloat(l.Balance, 'f', 2, 64)))
+	}
+	lines = append(lines, strings.Repeat("-", pdfLineWidth), "", "Generated "+st.GeneratedAt.Format("2006-01-02 15:04 MST"))
+
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+	return writeTextPDF(w, pages)
+}
+
+func clip(s string, n int) string {
+	if len(s) > n {
+		return s[:n-1] + "~"
+	}
+	return s
+}
+
+// writeTextPDF writes a minimal PDF with one page of Courier text per entry of pages
+func writeTextPDF(w io.Writer, pages [][]string) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, lines := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 9 Tf 12 TL 40 800 Td\n")
+		for _, line := range lines {
+			content.WriteString("(" + pdfEscape(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfEscape escapes a PDF string literal; characters outside printable ASCII become '?'
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
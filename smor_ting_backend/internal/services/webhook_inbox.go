@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWebhookEventNotFound     = errors.New("webhook event not found")
+	ErrWebhookEventExists       = errors.New("webhook event already received")
+	ErrWebhookEventStateChanged = errors.New("webhook event state changed concurrently")
+)
+
+// WebhookInbox persists provider callbacks before they are applied so that a
+// failure can be replayed and a repeat can be recognised. Transition is a
+// compare-and-set on State; exactly one caller wins the right to apply an event.
+type WebhookInbox interface {
+	// Insert stores a new event, or returns ErrWebhookEventExists if its DedupKey is already known
+	Insert(ctx context.Context, event *models.WebhookEvent) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error)
+	GetByKey(ctx context.Context, provider, dedupKey string) (*models.WebhookEvent, error)
+	// Transition moves the event from one state to another, recording lastErr and
+	// counting an attempt when it re-enters pending
+	Transition(ctx context.Context, id primitive.ObjectID, from, to models.WebhookEventState, lastErr string) error
+	// Reclaim restarts a pending event last updated before staleBefore, counting
+	// an attempt; it returns ErrWebhookEventStateChanged if the event moved on
+	// or was reclaimed first
+	Reclaim(ctx context.Context, id primitive.ObjectID, staleBefore time.Time) error
+	// List returns events in the given state, oldest first
+	List(ctx context.Context, state models.WebhookEventState, limit int) ([]models.WebhookEvent, error)
+}
+
+// applyWebhookTransition updates the bookkeeping fields shared by both stores
+func applyWebhookTransition(e *models.WebhookEvent, to models.WebhookEventState, lastErr string, now time.Time) {
+	e.State = to
+	e.LastError = lastErr
+	e.UpdatedAt = now
+	switch to {
+	case models.WebhookPending:
+		e.Attempts++
+	case models.WebhookProcessed:
+		e.ProcessedAt = &now
+	}
+}
+
+// In-memory implementation for tests/dev
+type memoryWebhookInbox struct {
+	mu     sync.RWMutex
+	events map[primitive.ObjectID]*models.WebhookEvent
+}
+
+func NewMemoryWebhookInbox() WebhookInbox {
+	return &memoryWebhookInbox{events: make(map[primitive.ObjectID]*models.WebhookEvent)}
+}
+
+func (m *memoryWebhookInbox) Insert(ctx context.Context, event *models.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.Provider == event.Provider && e.DedupKey == event.DedupKey {
+			return ErrWebhookEventExists
+		}
+	}
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	event.ReceivedAt = time.Now()
+	event.UpdatedAt = event.ReceivedAt
+	cp := *event
+	m.events[event.ID] = &cp
+	return nil
+}
+
+func (m *memoryWebhookInbox) Get(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.events[id]
+	if !ok {
+		return nil, ErrWebhookEventNotFound
+	}
+	cp := *e
+	return &cp, nil
+}
+
+func (m *memoryWebhookInbox) GetByKey(ctx context.Context, provider, dedupKey string) (*models.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.events {
+		if e.Provider == provider && e.DedupKey == dedupKey {
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, ErrWebhookEventNotFound
+}
+
+func (m *memoryWebhookInbox) Transition(ctx context.Context, id primitive.ObjectID, from, to models.WebhookEventState, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.events[id]
+	if !ok {
+		return ErrWebhookEventNotFound
+	}
+	if e.State != from {
+		return ErrWebhookEventStateChanged
+	}
+	applyWebhookTransition(e, to, lastErr, time.Now())
+	return nil
+}
+
+func (m *memoryWebhookInbox) Reclaim(ctx context.Context, id primitive.ObjectID, staleBefore time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.events[id]
+	if !ok {
+		return ErrWebhookEventNotFound
+	}
+	if e.State != models.WebhookPending || !e.UpdatedAt.Before(staleBefore) {
+		return ErrWebhookEventStateChanged
+	}
+	applyWebhookTransition(e, models.WebhookPending, e.LastError, time.Now())
+	return nil
+}
+
+func (m *memoryWebhookInbox) List(ctx context.Context, state models.WebhookEventState, limit int) ([]models.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []models.WebhookEvent
+	for _, e := range m.events {
+		if e.State == state {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ReceivedAt.Before(out[j].ReceivedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoWebhookInbox persists provider callbacks in the webhook_inbox collection
+type MongoWebhookInbox struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoWebhookInbox(db *mongo.Database, logger *logger.Logger) (*MongoWebhookInbox, error) {
+	s := &MongoWebhookInbox{coll: db.Collection("webhook_inbox"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "dedup_key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "received_at", Value: 1}}},
+		{Keys: bson.D{{Key: "reference_id", Value: 1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoWebhookInbox) Insert(ctx context.Context, event *models.WebhookEvent) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	event.ReceivedAt = time.Now()
+	event.UpdatedAt = event.ReceivedAt
+	if _, err := m.coll.InsertOne(ctx, event); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrWebhookEventExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *MongoWebhookInbox) Get(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	return m.findOne(ctx, bson.M{"_id": id})
+}
+
+func (m *MongoWebhookInbox) GetByKey(ctx context.Context, provider, dedupKey string) (*models.WebhookEvent, error) {
+	return m.findOne(ctx, bson.M{"provider": provider, "dedup_key": dedupKey})
+}
+
+func (m *MongoWebhookInbox) Transition(ctx context.Context, id primitive.ObjectID, from, to models.WebhookEventState, lastErr string) error {
+	current, err := m.findOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if current.State != from {
+		return ErrWebhookEventStateChanged
+	}
+	applyWebhookTransition(current, to, lastErr, time.Now())
+	res, err := m.coll.ReplaceOne(ctx, bson.M{"_id": id, "state": from}, current)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrWebhookEventStateChanged
+	}
+	return nil
+}
+
+func (m *MongoWebhookInbox) Reclaim(ctx context.Context, id primitive.ObjectID, staleBefore time.Time) error {
+	res, err := m.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "state": models.WebhookPending, "updated_at": bson.M{"$lt": staleBefore}},
+		bson.M{"$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"attempts": 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.findOne(ctx, bson.M{"_id": id}); err != nil {
+			return err
+		}
+		return ErrWebhookEventStateChanged
+	}
+	return nil
+}
+
+func (m *MongoWebhookInbox) List(ctx context.Context, state models.WebhookEventState, limit int) ([]models.WebhookEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := m.coll.Find(ctx, bson.M{"state": state}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []models.WebhookEvent
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (m *MongoWebhookInbox) findOne(ctx context.Context, filter bson.M) (*models.WebhookEvent, error) {
+	var out models.WebhookEvent
+	if err := m.coll.FindOne(ctx, filter).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWebhookEventNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,502 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidWithdrawal        = errors.New("invalid withdrawal request")
+	ErrWithdrawalLimitExceeded  = errors.New("withdrawal limit exceeded")
+	ErrWithdrawalNotPending     = errors.New("withdrawal is not awaiting review")
+	ErrWithdrawalPayoutRejected = errors.New("provider rejected the withdrawal")
+)
+
+// WithdrawalLimit caps what one role may withdraw per UTC day and calendar month, in USD; 0 is unlimited
+type WithdrawalLimit struct {
+	Daily   float64
+	Monthly float64
+}
+
+// WithdrawalPolicy holds the hard limits and the velocity rules for withdrawals
+type WithdrawalPolicy struct {
+	Limits map[models.UserRole]WithdrawalLimit
+	// MaxPerHour withdrawals are paid straight away; further ones in the hour wait for review. 0 disables the rule.
+	MaxPerHour int
+	// NewNumberHold is how long a payout number must have been known before it is paid without review
+	NewNumberHold time.Duration
+}
+
+// WithdrawalRequest asks for Amount to be paid to Msisdn at Provider. An empty
+// Currency is the wallet's own.
+type WithdrawalRequest struct {
+	Amount   float64
+	Currency string
+	Provider string
+	Msisdn   string
+}
+
+// WithdrawalService pays wallet funds out to mobile money. Every withdrawal is
+// checked against the spendable balance and the role's daily and monthly
+// limits, which reject it outright, and against the velocity rules, which hold
+// it for an admin to approve or reject before the provider is called.
+//
+// Money reserved by unsettled payouts and by withdrawals awaiting review is not
+// spendable. Checks and reservations run under the user's wallet lock so
+// concurrent debits cannot overdraw the wallet.
+type WithdrawalService struct {
+	store        WithdrawalStore
+	repo         database.Repository
+	ledger       *WalletLedgerService
+	providers    *PaymentProviders
+	encryption   *EncryptionService
+	methods      *PaymentMethodService
+	fx           *FXService
+	policy       WithdrawalPolicy
+	auditService *AuditService
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+func NewWithdrawalService(store WithdrawalStore, repo database.Repository, ledger *WalletLedgerService, providers *PaymentProviders, encryption *EncryptionService, policy WithdrawalPolicy, auditService *AuditService, logger *zap.Logger) *WithdrawalService {
+	if store == nil {
+		store = NewMemoryWithdrawalStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if auditService == nil {
+		auditService = NewAuditService(nil, logger)
+	}
+	return &WithdrawalService{
+		store:        store,
+		repo:         repo,
+		ledger:       ledger,
+		providers:    providers,
+		encryption:   encryption,
+		policy:       policy,
+		auditService: auditService,
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// SetPaymentMethods counts a verified linked method as a known payout number from its verification
+func (s *WithdrawalService) SetPaymentMethods(methods *PaymentMethodService) {
+	s.methods = methods
+}
+
+// SetFXService converts withdrawals in other currencies to USD for the limits
+func (s *WithdrawalService) SetFXService(fx *FXService) {
+	s.fx = fx
+}
+
+// Withdraw checks and records a withdrawal, then pays it unless a velocity rule
+// holds it for review. A withdrawal the provider refuses is returned with
+// ErrWithdrawalPayoutRejected.
+func (s *WithdrawalService) Withdraw(ctx context.Context, user *models.User, req WithdrawalRequest, ac AuditContext) (*models.Withdrawal, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidWithdrawal
+	}
+	currency := walletCurrency(user)
+	if req.Currency != "" {
+		var ok bool
+		if currency, ok = models.NormalizeCurrency(req.Currency); !ok {
+			return nil, models.ErrUnsupportedCurrency
+		}
+	}
+	number, err := NormalizeMsisdn(req.Msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWithdrawal, err)
+	}
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encryption.EncryptString(number)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt msisdn: %w", err)
+	}
+	w := &models.Withdrawal{
+		UserID:          user.ID,
+		Role:            user.Role,
+		Amount:          roundMinor(req.Amount),
+		Currency:        currency,
+		Provider:        provider.Name(),
+		Msisdn:          MaskMsisdn(number),
+		MsisdnEncrypted: encrypted,
+	}
+
+	var intent *models.WalletLedgerEntry
+	err = s.ledger.WithWalletLock(ctx, user.ID, func(ctx context.Context) error {
+		if err := s.ensureSpendable(ctx, w, 0); err != nil {
+			return err
+		}
+		limitsChecked, err := s.checkLimits(ctx, w)
+		if err != nil {
+			return err
+		}
+		var flags []models.WithdrawalFlag
+		if !limitsChecked {
+			flags = append(flags, models.WithdrawalFlagLimitUnverified)
+		}
+		velocity, err := s.velocityFlags(ctx, w, number)
+		if err != nil {
+			return err
+		}
+		w.Flags = append(flags, velocity...)
+
+		if len(w.Flags) > 0 {
+			w.Status = models.WithdrawalPendingReview
+			return s.store.Create(ctx, w)
+		}
+		w.Status = models.WithdrawalSubmitted
+		w.Reference = NewMomoReferenceID()
+		if err := s.store.Create(ctx, w); err != nil {
+			return err
+		}
+		intent, err = s.recordIntent(ctx, w)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if w.Status == models.WithdrawalPendingReview {
+		s.audit(ctx, user, ActionWalletWithdraw, w, ac, nil)
+		return w, nil
+	}
+	err = s.disburse(ctx, w, intent, number)
+	s.audit(ctx, user, ActionWalletWithdraw, w, ac, err)
+	return w, err
+}
+
+// Approve pays a withdrawal held for review, if the wallet still covers it
+func (s *WithdrawalService) Approve(ctx context.Context, admin *models.User, id primitive.ObjectID, note string, ac AuditContext) (*models.Withdrawal, error) {
+	w, err := s.pendingReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	number, err := s.encryption.DecryptString(w.MsisdnEncrypted)
+	if err != nil {
+		return w, fmt.Errorf("decrypt msisdn: %w", err)
+	}
+	var intent *models.WalletLedgerEntry
+	err = s.ledger.WithWalletLock(ctx, w.UserID, func(ctx context.Context) error {
+		// The withdrawal's own reservation is what it is about to spend
+		if err := s.ensureSpendable(ctx, w, w.Amount); err != nil {
+			return err
+		}
+		s.review(w, admin, note, models.WithdrawalSubmitted)
+		w.Reference = NewMomoReferenceID()
+		if err := s.store.Update(ctx, w, models.WithdrawalPendingReview); err != nil {
+			return err
+		}
+		var err error
+		intent, err = s.recordIntent(ctx, w)
+		return err
+	})
+	if err != nil {
+		return w, err
+	}
+	err = s.disburse(ctx, w, intent, number)
+	s.audit(ctx, admin, ActionWithdrawalReview, w, ac, err)
+	return w, err
+}
+
+// Reject declines a withdrawal held for review; nothing is paid
+func (s *WithdrawalService) Reject(ctx context.Context, admin *models.User, id primitive.ObjectID, note string, ac AuditContext) (*models.Withdrawal, error) {
+	w, err := s.pendingReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.review(w, admin, note, models.WithdrawalRejected)
+	if err := s.store.Update(ctx, w, models.WithdrawalPendingReview); err != nil {
+		return nil, err
+	}
+	s.audit(ctx, admin, ActionWithdrawalReview, w, ac, nil)
+	return w, nil
+}
+
+func (s *WithdrawalService) Get(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error) {
+	return s.store.Get(ctx, id)
+}
+
+// List returns matching withdrawals, newest first; the review queue is Status pending_review
+func (s *WithdrawalService) List(ctx context.Context, f WithdrawalFilter) ([]models.Withdrawal, error) {
+	return s.store.List(ctx, f)
+}
+
+func (s *WithdrawalService) pendingReview(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error) {
+	w, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w.Status != models.WithdrawalPendingReview {
+		return w, ErrWithdrawalNotPending
+	}
+	return w, nil
+}
+
+func (s *WithdrawalService) review(w *models.Withdrawal, admin *models.User, note string, status models.WithdrawalStatus) {
+	now := s.now()
+	w.Status = status
+	w.ReviewedBy = &admin.ID
+	w.ReviewNote = strings.TrimSpace(note)
+	w.ReviewedAt = &now
+}
+
+// ensureSpendable checks that the available balance, less what unsettled payouts
+// and reviewed withdrawals reserve (excluding own), covers the withdrawal
+func (s *WithdrawalService) ensureSpendable(ctx context.Context, w *models.Withdrawal, own float64) error {
+	spendable, err := s.ledger.Spendable(ctx, w.UserID, w.Currency)
+	if err != nil {
+		return err
+	}
+	reserved := -own
+	held, err := s.store.List(ctx, WithdrawalFilter{UserID: &w.UserID, Status: models.WithdrawalPendingReview})
+	if err != nil {
+		return err
+	}
+	for _, h := range held {
+		if h.Currency == w.Currency {
+			reserved += h.Amount
+		}
+	}
+	if roundMinor(spendable-reserved) < w.Amount {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+// checkLimits rejects a withdrawal that would take the user past their role's
+// daily or monthly limit. It reports false when an amount could not be
+// converted to USD, leaving the limits unchecked.
+func (s *WithdrawalService) checkLimits(ctx context.Context, w *models.Withdrawal) (bool, error) {
+	limit, ok := s.policy.Limits[w.Role]
+	if !ok || (limit.Daily <= 0 && limit.Monthly <= 0) {
+		return true, nil
+	}
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	type spend struct {
+		amount   float64
+		currency string
+		at       time.Time
+	}
+	var spent []spend
+	// Settled and in-flight withdrawals count; failed ones paid nothing
+	payouts, err := s.ledger.Entries().ListByUser(ctx, database.LedgerQuery{
+		UserID:   w.UserID,
+		Types:    []models.LedgerType{models.LedgerWithdraw},
+		Statuses: []models.LedgerStatus{models.LedgerPending, models.LedgerCompleted},
+		From:     month,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, p := range payouts {
+		spent = append(spent, spend{p.Amount, p.Currency, p.CreatedAt})
+	}
+	held, err := s.store.List(ctx, WithdrawalFilter{UserID: &w.UserID, Status: models.WithdrawalPendingReview, Since: month})
+	if err != nil {
+		return false, err
+	}
+	for _, h := range held {
+		spent = append(spent, spend{h.Amount, h.Currency, h.CreatedAt})
+	}
+
+	requested, err := s.toUSD(ctx, w.Amount, w.Currency)
+	if err != nil {
+		return false, nil
+	}
+	daily, monthly := requested, requested
+	for _, sp := range spent {
+		usd, err := s.toUSD(ctx, sp.amount, sp.currency)
+		if err != nil {
+			return false, nil
+		}
+		monthly += usd
+		if !sp.at.Before(day) {
+			daily += usd
+		}
+	}
+	if limit.Daily > 0 && roundMinor(daily) > limit.Daily {
+		return true, fmt.Errorf("%w: daily limit is %.2f USD", ErrWithdrawalLimitExceeded, limit.Daily)
+	}
+	if limit.Monthly > 0 && roundMinor(monthly) > limit.Monthly {
+		return true, fmt.Errorf("%w: monthly limit is %.2f USD", ErrWithdrawalLimitExceeded, limit.Monthly)
+	}
+	return true, nil
+}
+
+func (s *WithdrawalService) toUSD(ctx context.Context, amount float64, currency string) (float64, error) {
+	if currency == models.CurrencyUSD {
+		return amount, nil
+	}
+	if s.fx == nil {
+		return 0, ErrFXRateUnavailable
+	}
+	rate, err := s.fx.Rate(ctx, currency, models.CurrencyUSD)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+// velocityFlags lists the rules that hold a withdrawal for review: too many
+// withdrawals in the last hour, or a payout number the user has not been known
+// to use for NewNumberHold
+func (s *WithdrawalService) velocityFlags(ctx context.Context, w *models.Withdrawal, number string) ([]models.WithdrawalFlag, error) {
+	var flags []models.WithdrawalFlag
+	now := s.now()
+	if s.policy.MaxPerHour > 0 {
+		recent, err := s.store.List(ctx, WithdrawalFilter{UserID: &w.UserID, Since: now.Add(-time.Hour)})
+		if err != nil {
+			return nil, err
+		}
+		if len(recent) >= s.policy.MaxPerHour {
+			flags = append(flags, models.WithdrawalFlagHourlyVelocity)
+		}
+	}
+	if s.policy.NewNumberHold > 0 {
+		since, err := s.numberKnownSince(ctx, w.UserID, w.Provider, number)
+		if err != nil {
+			return nil, err
+		}
+		if since == nil || now.Sub(*since) < s.policy.NewNumberHold {
+			flags = append(flags, models.WithdrawalFlagNewPayoutNumber)
+		}
+	}
+	return flags, nil
+}
+
+// numberKnownSince is when the user's payout number was first trusted: its
+// linked method's verification, or the first withdrawal that was paid to it
+func (s *WithdrawalService) numberKnownSince(ctx context.Context, userID primitive.ObjectID, provider, number string) (*time.Time, error) {
+	var since *time.Time
+	if s.methods != nil {
+		method, err := s.methods.findByNumber(ctx, userID, provider, number)
+		if err != nil {
+			return nil, err
+		}
+		if method != nil && method.Status == models.PaymentMethodActive && method.VerifiedAt != nil {
+			since = method.VerifiedAt
+		}
+	}
+	paid, err := s.store.List(ctx, WithdrawalFilter{UserID: &userID, Status: models.WithdrawalSubmitted})
+	if err != nil {
+		return nil, err
+	}
+	for i := range paid {
+		w := &paid[i]
+		if w.Provider != provider || (since != nil && !w.CreatedAt.Before(*since)) {
+			continue
+		}
+		stored, err := s.encryption.DecryptString(w.MsisdnEncrypted)
+		if err != nil {
+			s.logger.Warn("Undecryptable withdrawal number", zap.String("withdrawal_id", w.ID.Hex()), zap.Error(err))
+			continue
+		}
+		if stored == number {
+			at := w.CreatedAt
+			since = &at
+		}
+	}
+	return since, nil
+}
+
+// recordIntent records the pending payout that reserves the withdrawal's funds
+// until the provider settles it
+func (s *WithdrawalService) recordIntent(ctx context.Context, w *models.Withdrawal) (*models.WalletLedgerEntry, error) {
+	intent := &models.WalletLedgerEntry{
+		UserID:    w.UserID,
+		Type:      models.LedgerWithdraw,
+		Direction: models.LedgerDebit,
+		Amount:    w.Amount,
+		Currency:  w.Currency,
+		Reference: w.Reference,
+		Provider:  w.Provider,
+	}
+	if err := s.ledger.RecordIntent(ctx, intent); err != nil {
+		s.fail(ctx, w, err)
+		return nil, err
+	}
+	return intent, nil
+}
+
+// disburse asks the provider to pay the withdrawal; it settles through the
+// provider's callback or the reconciler. Only a definitive rejection fails it:
+// when the outcome is unknown the provider may have paid, so the intent stays
+// pending and keeps the funds reserved until the reconciler settles it.
+func (s *WithdrawalService) disburse(ctx context.Context, w *models.Withdrawal, intent *models.WalletLedgerEntry, number string) error {
+	provider, err := s.providers.Get(w.Provider)
+	if err == nil {
+		err = provider.Disburse(ctx, MobileMoneyRequest{
+			ReferenceID: w.Reference,
+			Amount:      strconv.FormatFloat(w.Amount, 'f', -1, 64),
+			Currency:    w.Currency,
+			MSISDN:      number,
+			ExternalID:  "wallet_withdraw",
+			Message:     "Smor-Ting withdrawal",
+		})
+		if err != nil && !errors.Is(err, ErrPaymentRejected) {
+			s.logger.Warn("Withdrawal outcome unknown; left for reconciliation", zap.Error(err), zap.String("reference_id", w.Reference))
+			return nil
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if settleErr := s.ledger.SettleIntent(ctx, intent, models.LedgerFailed); settleErr != nil {
+		s.logger.Error("Failed to close withdrawal intent", zap.Error(settleErr), zap.String("reference_id", w.Reference))
+	}
+	s.fail(ctx, w, err)
+	return fmt.Errorf("%w: %v", ErrWithdrawalPayoutRejected, err)
+}
+
+func (s *WithdrawalService) fail(ctx context.Context, w *models.Withdrawal, cause error) {
+	w.Status = models.WithdrawalFailed
+	w.Failure = cause.Error()
+	if err := s.store.Update(ctx, w, models.WithdrawalSubmitted); err != nil {
+		s.logger.Error("Failed to record withdrawal failure", zap.Error(err), zap.String("withdrawal_id", w.ID.Hex()))
+	}
+}
+
+func (s *WithdrawalService) audit(ctx context.Context, actor *models.User, action AuditAction, w *models.Withdrawal, ac AuditContext, err error) {
+	entry := &AuditEntry{
+		UserID:     actor.ID.Hex(),
+		UserEmail:  actor.Email,
+		UserRole:   string(actor.Role),
+		Action:     action,
+		Resource:   "withdrawal",
+		ResourceID: w.ID.Hex(),
+		IPAddress:  ac.IPAddress,
+		UserAgent:  ac.UserAgent,
+		Details: map[string]interface{}{
+			"user_id":   w.UserID.Hex(),
+			"amount":    w.Amount,
+			"currency":  w.Currency,
+			"provider":  w.Provider,
+			"msisdn":    w.Msisdn,
+			"status":    w.Status,
+			"flags":     w.Flags,
+			"reference": w.Reference,
+		},
+		Success: err == nil,
+	}
+	if err != nil {
+		entry.ErrorMessage = err.Error()
+	}
+	_ = s.auditService.LogAction(ctx, entry)
+}
@@ -0,0 +1,144 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/smorting/backend/internal/database"
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/internal/services"
+)
+
+type withdrawalFixture struct {
+	ledger      *services.WalletLedgerService
+	withdrawals *services.WithdrawalService
+	payouts     *payoutRecorder
+	user        *models.User
+}
+
+func newWithdrawalFixture(t *testing.T, policy services.WithdrawalPolicy, balance float64) *withdrawalFixture {
+	t.Helper()
+	ctx := context.TODO()
+	repo := database.NewMemoryDatabase()
+	ledger := services.NewWalletLedgerService(repo)
+	key, _ := services.GenerateEncryptionKey()
+	enc, err := services.NewEncryptionService(key)
+	if err != nil {
+		t.Fatalf("encryption: %v", err)
+	}
+	user := &models.User{Email: "withdraw@example.com", Role: models.CustomerRole, Wallet: models.Wallet{Currency: "USD"}}
+	_ = repo.CreateUser(ctx, user)
+	_ = ledger.RecordEntry(ctx, &models.WalletLedgerEntry{UserID: user.ID, Type: models.LedgerTopup, Direction: models.LedgerCredit, Amount: balance, Status: models.LedgerCompleted, Reference: "seed"})
+	payouts := &payoutRecorder{}
+	withdrawals := services.NewWithdrawalService(nil, repo, ledger, services.NewPaymentProviders(payouts), enc, policy, nil, nil)
+	return &withdrawalFixture{ledger: ledger, withdrawals: withdrawals, payouts: payouts, user: user}
+}
+
+func (f *withdrawalFixture) withdraw(amount float64, msisdn string) (*models.Withdrawal, error) {
+	return f.withdrawals.Withdraw(context.TODO(), f.user, services.WithdrawalRequest{Amount: amount, Msisdn: msisdn}, services.AuditContext{})
+}
+
+func TestWithdraw_BalanceAndDailyLimitRejectOutright(t *testing.T) {
+	f := newWithdrawalFixture(t, services.WithdrawalPolicy{
+		Limits: map[models.UserRole]services.WithdrawalLimit{models.CustomerRole: {Daily: 60, Monthly: 1000}},
+	}, 100)
+
+	if _, err := f.withdraw(120, "231770000001"); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("expected the balance check to reject 120 of 100, got %v", err)
+	}
+	w, err := f.withdraw(40, "231770000001")
+	if err != nil || w.Status != models.WithdrawalSubmitted || len(f.payouts.payouts) != 1 {
+		t.Fatalf("expected 40 to be paid, got %+v, %v", w, err)
+	}
+	if f.payouts.payouts[0].MSISDN != "231770000001" || w.Msisdn != "***0001" || w.Reference != f.payouts.payouts[0].ReferenceID {
+		t.Fatalf("unexpected payout %+v for %+v", f.payouts.payouts[0], w)
+	}
+	// The pending 40 counts towards today's 60
+	if _, err := f.withdraw(30, "231770000001"); !errors.Is(err, services.ErrWithdrawalLimitExceeded) {
+		t.Fatalf("expected the daily limit to reject, got %v", err)
+	}
+	if w, err := f.withdraw(20, "231770000001"); err != nil || w.Status != models.WithdrawalSubmitted {
+		t.Fatalf("expected 20 more to reach the limit exactly, got %+v, %v", w, err)
+	}
+	if len(f.payouts.payouts) != 2 {
+		t.Fatalf("rejected withdrawals must not be paid, got %d payouts", len(f.payouts.payouts))
+	}
+}
+
+func TestWithdraw_VelocityRulesQueueForReview(t *testing.T) {
+	ctx := context.TODO()
+	f := newWithdrawalFixture(t, services.WithdrawalPolicy{MaxPerHour: 2, NewNumberHold: 24 * time.Hour}, 100)
+	admin := &models.User{Email: "admin@example.com", Role: models.AdminRole}
+
+	held, err := f.withdraw(30, "231770000002")
+	if err != nil || held.Status != models.WithdrawalPendingReview || len(held.Flags) != 1 || held.Flags[0] != models.WithdrawalFlagNewPayoutNumber {
+		t.Fatalf("expected a new number to be held for review, got %+v, %v", held, err)
+	}
+	if len(f.payouts.payouts) != 0 {
+		t.Fatalf("nothing may be paid before review")
+	}
+	second, _ := f.withdraw(50, "231770000002")
+	// 30 and 50 are reserved by the queue, so 30 more is not spendable
+	if _, err := f.withdraw(30, "231770000002"); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("expected queued withdrawals to reserve funds, got %v", err)
+	}
+	if _, err := f.withdrawals.Reject(ctx, admin, second.ID, "not the owner", services.AuditContext{}); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	third, _ := f.withdraw(10, "231770000002")
+	if len(third.Flags) != 2 || third.Flags[0] != models.WithdrawalFlagHourlyVelocity {
+		t.Fatalf("expected the third withdrawal in an hour to be flagged, got %+v", third.Flags)
+	}
+
+	queue, _ := f.withdrawals.List(ctx, services.WithdrawalFilter{Status: models.WithdrawalPendingReview})
+	if len(queue) != 2 {
+		t.Fatalf("expected 2 withdrawals in the review queue, got %d", len(queue))
+	}
+	paid, err := f.withdrawals.Approve(ctx, admin, held.ID, "called the customer", services.AuditContext{})
+	if err != nil || paid.Status != models.WithdrawalSubmitted || paid.ReviewedBy == nil || len(f.payouts.payouts) != 1 {
+		t.Fatalf("expected approval to pay, got %+v, %v", paid, err)
+	}
+	if f.payouts.payouts[0].MSISDN != "231770000002" || f.payouts.payouts[0].Amount != "30" {
+		t.Fatalf("unexpected payout %+v", f.payouts.payouts[0])
+	}
+	if intent, err := f.ledger.Intent(ctx, paid.Reference); err != nil || intent.Status != models.LedgerPending || intent.Amount != 30 {
+		t.Fatalf("expected a pending payout intent, got %+v, %v", intent, err)
+	}
+	if _, err := f.withdrawals.Approve(ctx, admin, held.ID, "", services.AuditContext{}); !errors.Is(err, services.ErrWithdrawalNotPending) {
+		t.Fatalf("expected a second approval to be refused, got %v", err)
+	}
+	if _, err := f.withdrawals.Approve(ctx, admin, second.ID, "", services.AuditContext{}); !errors.Is(err, services.ErrWithdrawalNotPending) {
+		t.Fatalf("expected a rejected withdrawal to stay rejected, got %v", err)
+	}
+}
+
+func TestWithdraw_OnlyARejectionFailsTheWithdrawal(t *testing.T) {
+	ctx := context.TODO()
+	f := newWithdrawalFixture(t, services.WithdrawalPolicy{}, 100)
+
+	f.payouts.err = fmt.Errorf("%w: payee not found", services.ErrPaymentRejected)
+	w, err := f.withdraw(60, "231770000003")
+	if !errors.Is(err, services.ErrWithdrawalPayoutRejected) || w.Status != models.WithdrawalFailed {
+		t.Fatalf("expected a rejected withdrawal to fail, got %+v, %v", w, err)
+	}
+	if intent, _ := f.ledger.Intent(ctx, w.Reference); intent.Status != models.LedgerFailed {
+		t.Fatalf("expected the rejected intent to be closed, got %+v", intent)
+	}
+
+	// A timeout may still be paid: the withdrawal stays submitted and keeps its funds reserved
+	f.payouts.err = context.DeadlineExceeded
+	w, err = f.withdraw(60, "231770000003")
+	if err != nil || w.Status != models.WithdrawalSubmitted {
+		t.Fatalf("expected a timed-out withdrawal to stay submitted, got %+v, %v", w, err)
+	}
+	if intent, _ := f.ledger.Intent(ctx, w.Reference); intent.Status != models.LedgerPending {
+		t.Fatalf("expected the intent to stay pending for the reconciler, got %+v", intent)
+	}
+	f.payouts.err = nil
+	if _, err := f.withdraw(60, "231770000003"); !errors.Is(err, services.ErrInsufficientBalance) {
+		t.Fatalf("the unsettled withdrawal must keep its 60 reserved, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrWithdrawalNotFound     = errors.New("withdrawal not found")
+	ErrWithdrawalStateChanged = errors.New("withdrawal status changed concurrently")
+)
+
+// WithdrawalFilter narrows a withdrawal listing; zero fields do not filter
+type WithdrawalFilter struct {
+	UserID *primitive.ObjectID
+	Status models.WithdrawalStatus
+	Since  time.Time
+	Limit  int
+}
+
+// WithdrawalStore persists withdrawal requests. Update is a compare-and-set on
+// Status so that a reviewed withdrawal is approved or rejected exactly once.
+type WithdrawalStore interface {
+	Create(ctx context.Context, w *models.Withdrawal) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error)
+	// Update replaces the withdrawal if its stored status is still from, otherwise returns ErrWithdrawalStateChanged
+	Update(ctx context.Context, w *models.Withdrawal, from models.WithdrawalStatus) error
+	// List returns matching withdrawals, newest first
+	List(ctx context.Context, f WithdrawalFilter) ([]models.Withdrawal, error)
+}
+
+// In-memory implementation for tests/dev
+type memoryWithdrawalStore struct {
+	mu          sync.RWMutex
+	withdrawals map[primitive.ObjectID]*models.Withdrawal
+}
+
+func NewMemoryWithdrawalStore() WithdrawalStore {
+	return &memoryWithdrawalStore{withdrawals: make(map[primitive.ObjectID]*models.Withdrawal)}
+}
+
+func (m *memoryWithdrawalStore) Create(ctx context.Context, w *models.Withdrawal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if w.ID.IsZero() {
+		w.ID = primitive.NewObjectID()
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+	cp := *w
+	m.withdrawals[w.ID] = &cp
+	return nil
+}
+
+func (m *memoryWithdrawalStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.withdrawals[id]
+	if !ok {
+		return nil, ErrWithdrawalNotFound
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (m *memoryWithdrawalStore) Update(ctx context.Context, w *models.Withdrawal, from models.WithdrawalStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.withdrawals[w.ID]
+	if !ok {
+		return ErrWithdrawalNotFound
+	}
+	if stored.Status != from {
+		return ErrWithdrawalStateChanged
+	}
+	w.UpdatedAt = time.Now()
+	cp := *w
+	m.withdrawals[w.ID] = &cp
+	return nil
+}
+
+func (m *memoryWithdrawalStore) List(ctx context.Context, f WithdrawalFilter) ([]models.Withdrawal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []models.Withdrawal{}
+	for _, w := range m.withdrawals {
+		if (f.UserID != nil && w.UserID != *f.UserID) || (f.Status != "" && w.Status != f.Status) || w.CreatedAt.Before(f.Since) {
+			continue
+		}
+		out = append(out, *w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
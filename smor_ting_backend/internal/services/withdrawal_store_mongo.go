@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smorting/backend/internal/models"
+	"github.com/smorting/backend/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoWithdrawalStore persists withdrawals in the withdrawals collection
+type MongoWithdrawalStore struct {
+	coll   *mongo.Collection
+	logger *logger.Logger
+}
+
+func NewMongoWithdrawalStore(db *mongo.Database, logger *logger.Logger) (*MongoWithdrawalStore, error) {
+	s := &MongoWithdrawalStore{coll: db.Collection("withdrawals"), logger: logger}
+	_, _ = s.coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return s, nil
+}
+
+func (m *MongoWithdrawalStore) Create(ctx context.Context, w *models.Withdrawal) error {
+	if w.ID.IsZero() {
+		w.ID = primitive.NewObjectID()
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+	_, err := m.coll.InsertOne(ctx, w)
+	return err
+}
+
+func (m *MongoWithdrawalStore) Get(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error) {
+	var out models.Withdrawal
+	if err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWithdrawalNotFound
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (m *MongoWithdrawalStore) Update(ctx context.Context, w *models.Withdrawal, from models.WithdrawalStatus) error {
+	w.UpdatedAt = time.Now()
+	res, err := m.coll.ReplaceOne(ctx, bson.M{"_id": w.ID, "status": from}, w)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := m.Get(ctx, w.ID); err != nil {
+			return err
+		}
+		return ErrWithdrawalStateChanged
+	}
+	return nil
+}
+
+func (m *MongoWithdrawalStore) List(ctx context.Context, f WithdrawalFilter) ([]models.Withdrawal, error) {
+	filter := bson.M{}
+	if f.UserID != nil {
+		filter["user_id"] = *f.UserID
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if !f.Since.IsZero() {
+		filter["created_at"] = bson.M{"$gte": f.Since}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if f.Limit > 0 {
+		opts.SetLimit(int64(f.Limit))
+	}
+	cur, err := m.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	out := []models.Withdrawal{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/smorting/backend/internal/models"
 	"github.com/smorting/backend/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -81,6 +83,16 @@ func (m *Migrator) RunMigrations(ctx context.Context) error {
 			Description: "Fix geospatial indexes to avoid indexing non-GeoJSON address",
 			Script:      "fix_geospatial_indexes",
 		},
+		{
+			Version:     7,
+			Description: "Create double-entry wallet ledger and post opening balances",
+			Script:      "create_wallet_ledger",
+		},
+		{
+			Version:     8,
+			Description: "Backfill GeoJSON service locations and index them",
+			Script:      "add_service_geo_points",
+		},
 	}
 
 	// Apply pending migrations
@@ -150,6 +162,14 @@ func (m *Migrator) applyMigration(ctx context.Context, collection *mongo.Collect
 		if err := m.fixGeospatialIndexes(ctx); err != nil {
 			return fmt.Errorf("failed to apply migration: %w", err)
 		}
+	case "create_wallet_ledger":
+		if err := m.createWalletLedger(ctx); err != nil {
+			return fmt.Errorf("failed to apply migration: %w", err)
+		}
+	case "add_service_geo_points":
+		if err := m.addServiceGeoPoints(ctx); err != nil {
+			return fmt.Errorf("failed to apply migration: %w", err)
+		}
 	default:
 		return fmt.Errorf("unknown migration script: %s", migration.Script)
 	}
@@ -363,3 +383,128 @@ func (m *Migrator) addSyncCollections(ctx context.Context) error {
 
 	return nil
 }
+
+// createWalletLedger creates the ledger_transactions indexes and carries every
+// non-zero embedded wallet balance over as an opening-balance transaction
+func (m *Migrator) createWalletLedger(ctx context.Context) error {
+	ledgerCollection := m.db.Collection("ledger_transactions")
+	_, err := ledgerCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.M{"idempotency_key": 1},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.M{"postings.account": 1}},
+		{Keys: bson.D{bson.E{Key: "postings.user_id", Value: 1}, bson.E{Key: "created_at", Value: -1}}},
+		{Keys: bson.M{"reference": 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ledger indexes: %w", err)
+	}
+
+	cursor, err := m.db.Collection("users").Find(ctx,
+		bson.M{"wallet.balance": bson.M{"$ne": 0, "$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "wallet": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to load wallets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("failed to decode wallet: %w", err)
+		}
+		currency := user.Wallet.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+		tx := &models.LedgerTransaction{
+			ID:             primitive.NewObjectID(),
+			IdempotencyKey: "opening_balance:" + user.ID.Hex(),
+			Type:           models.LedgerOpeningBalance,
+			Description:    "Opening balance carried over from embedded wallet",
+			CreatedAt:      time.Now(),
+		}
+		// Negative embedded balances are carried over as a debit on the user's account
+		if user.Wallet.Balance > 0 {
+			tx.Debit(models.MomoClearingAccount, user.Wallet.Balance, currency).
+				Credit(models.UserAvailableAccount(user.ID), user.Wallet.Balance, currency)
+		} else {
+			tx.Debit(models.UserAvailableAccount(user.ID), -user.Wallet.Balance, currency).
+				Credit(models.MomoClearingAccount, -user.Wallet.Balance, currency)
+		}
+		if _, err := ledgerCollection.InsertOne(ctx, tx); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			return fmt.Errorf("failed to post opening balance for %s: %w", user.ID.Hex(), err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate wallets: %w", err)
+	}
+
+	m.logger.Info("Wallet balances migrated to ledger", zap.Int("wallets", migrated))
+	return nil
+}
+
+// addServiceGeoPoints replaces the services location index, which could never
+// work on the flat latitude/longitude address, with one on a GeoJSON geo point
+// backfilled from those coordinates. Services at 0/0 or out of range get no point.
+func (m *Migrator) addServiceGeoPoints(ctx context.Context) error {
+	servicesCollection := m.db.Collection("services")
+
+	cur, err := servicesCollection.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list service indexes: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var idx bson.M
+		if err := cur.Decode(&idx); err != nil {
+			continue
+		}
+		if keys, ok := idx["key"].(bson.M); ok && keys["location"] == "2dsphere" {
+			if name, ok := idx["name"].(string); ok {
+				if _, dropErr := servicesCollection.Indexes().DropOne(ctx, name); dropErr != nil {
+					m.logger.Warn("Failed to drop service location index", zap.Error(dropErr))
+				}
+			}
+		}
+	}
+
+	result, err := servicesCollection.UpdateMany(ctx,
+		bson.M{
+			"geo":                bson.M{"$exists": false},
+			"location.latitude":  bson.M{"$gte": -90, "$lte": 90},
+			"location.longitude": bson.M{"$gte": -180, "$lte": 180},
+			"$or": bson.A{
+				bson.M{"location.latitude": bson.M{"$ne": 0}},
+				bson.M{"location.longitude": bson.M{"$ne": 0}},
+			},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"geo": bson.M{
+				"type":        "Point",
+				"coordinates": bson.A{"$location.longitude", "$location.latitude"},
+			},
+		}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to backfill service geo points: %w", err)
+	}
+
+	geoIndex := mongo.IndexModel{
+		Keys:    bson.M{"geo": "2dsphere"},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"geo.type": "Point"}),
+	}
+	if _, err := servicesCollection.Indexes().CreateOne(ctx, geoIndex); err != nil {
+		return fmt.Errorf("failed to create service geo index: %w", err)
+	}
+
+	m.logger.Info("Service locations backfilled", zap.Int64("services", result.ModifiedCount))
+	return nil
+}
@@ -178,11 +178,12 @@ func (m *MongoDB) createIndexes(ctx context.Context) error {
 		},
 	}
 
-	// Location index for geospatial queries
+	// Location index for geospatial queries; services without coordinates have no geo point
 	locationIndex := mongo.IndexModel{
 		Keys: map[string]interface{}{
-			"location": "2dsphere",
+			"geo": "2dsphere",
 		},
+		Options: options.Index().SetPartialFilterExpression(map[string]interface{}{"geo.type": "Point"}),
 	}
 
 	_, err = servicesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{categoryIndex, locationIndex})